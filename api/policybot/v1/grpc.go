@@ -0,0 +1,211 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policybotv1
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// MaxMessageSize is the largest request message accepted by the server, the
+// same as the default of gRPC servers.
+const MaxMessageSize = 4 << 20
+
+const contentType = "application/grpc"
+
+// Code is a gRPC status code.
+type Code uint32
+
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	NotFound           Code = 5
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	Unauthenticated    Code = 16
+)
+
+// RPCError is an error with a gRPC status code. Methods return it to set
+// the status of the response; other errors are reported as internal errors.
+type RPCError struct {
+	Code    Code
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error: code = %d desc = %s", e.Code, e.Message)
+}
+
+// Errorf returns an RPCError with a formatted message.
+func Errorf(code Code, format string, args ...interface{}) error {
+	return &RPCError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// UnaryHandler returns a handler for a unary gRPC method. Each request
+// decodes into the message returned by newRequest, which is passed to call.
+// The handler requires HTTP/2 clients, because the status of the call is
+// sent in trailers, and does not support compressed messages.
+func UnaryHandler(newRequest func() Message, call func(context.Context, Message) (Message, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != contentType && !strings.HasPrefix(ct, contentType+"+proto") {
+			http.Error(w, fmt.Sprintf("unsupported content type %q", ct), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		ctx := r.Context()
+		if timeout, ok := parseTimeout(r.Header.Get("Grpc-Timeout")); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Add("Trailer", "Grpc-Status")
+		w.Header().Add("Trailer", "Grpc-Message")
+
+		res, err := serveUnary(ctx, r.Body, newRequest, call)
+		if err != nil {
+			writeStatus(ctx, w, err)
+			return
+		}
+
+		b := res.Marshal()
+		frame := make([]byte, 5, 5+len(b))
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(b)))
+		frame = append(frame, b...)
+
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(frame); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to write gRPC response")
+			return
+		}
+		w.Header().Set("Grpc-Status", strconv.Itoa(int(OK)))
+	})
+}
+
+func serveUnary(ctx context.Context, body io.Reader, newRequest func() Message, call func(context.Context, Message) (Message, error)) (Message, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		return nil, Errorf(InvalidArgument, "failed to read request: %v", err)
+	}
+	if header[0] != 0 {
+		return nil, Errorf(Unimplemented, "compressed messages are not supported")
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxMessageSize {
+		return nil, Errorf(ResourceExhausted, "request of %d bytes exceeds the limit of %d bytes", size, MaxMessageSize)
+	}
+
+	b := make([]byte, size)
+	if _, err := io.ReadFull(body, b); err != nil {
+		return nil, Errorf(InvalidArgument, "failed to read request: %v", err)
+	}
+
+	req := newRequest()
+	if err := req.Unmarshal(b); err != nil {
+		return nil, Errorf(InvalidArgument, "invalid request: %v", err)
+	}
+	return call(ctx, req)
+}
+
+// writeStatus writes the status of a failed call.
+func writeStatus(ctx context.Context, w http.ResponseWriter, err error) {
+	serr, ok := errors.Cause(err).(*RPCError)
+	switch {
+	case ok:
+	case ctx.Err() == context.DeadlineExceeded:
+		serr = &RPCError{Code: DeadlineExceeded, Message: "deadline exceeded"}
+	case ctx.Err() == context.Canceled:
+		serr = &RPCError{Code: Canceled, Message: "request canceled"}
+	default:
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Unexpected error handling gRPC request")
+		serr = &RPCError{Code: Internal, Message: "internal error"}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(serr.Code)))
+	w.Header().Set("Grpc-Message", encodeMessage(serr.Message))
+}
+
+// encodeMessage percent-encodes a status message, as required for the
+// Grpc-Message trailer.
+func encodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// parseTimeout parses the value of a Grpc-Timeout header, which is at most
+// eight digits followed by a unit.
+func parseTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+
+	var unit time.Duration
+	switch s[len(s)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if d := time.Duration(n); d > time.Duration(1<<63-1)/unit {
+		return time.Duration(1<<63 - 1), true
+	}
+	return time.Duration(n) * unit, true
+}
@@ -0,0 +1,523 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policybotv1 implements the messages and the gRPC transport of the
+// evaluation service defined in policybot.proto. The messages encode the
+// protobuf wire format by hand, so the server does not depend on the gRPC
+// and protobuf runtimes.
+package policybotv1
+
+import (
+	"time"
+)
+
+// Message is a message of the evaluation service.
+type Message interface {
+	Marshal() []byte
+	Unmarshal(b []byte) error
+}
+
+// Status is the status of a result.
+type Status int32
+
+const (
+	StatusUnspecified Status = iota
+	StatusSkipped
+	StatusPending
+	StatusApproved
+	StatusDisapproved
+	StatusError
+)
+
+// PullRequest identifies a pull request.
+type PullRequest struct {
+	Owner  string
+	Repo   string
+	Number int32
+}
+
+type EvaluateRequest struct {
+	PullRequest *PullRequest
+}
+
+type SimulateRequest struct {
+	PullRequest *PullRequest
+
+	// Policy is the content of a policy file to evaluate instead of the
+	// policy of the repository
+	Policy string
+
+	Approvers      []string
+	UnchangedFiles []string
+	AddedLabels    []string
+	RemovedLabels  []string
+}
+
+type EvaluateResponse struct {
+	SHA          string
+	PolicySource string
+
+	// Result is nil if the policy is invalid or the result was cached
+	Result *Result
+
+	State       string
+	Description string
+}
+
+// Result is the result of evaluating a policy, a conjunction, or a rule.
+type Result struct {
+	Name        string
+	Description string
+	Status      Status
+
+	// Error is set if Status is StatusError
+	Error string
+
+	Approvals []*ApprovalDecision
+	Requires  *Actors
+	Labels    []string
+	Children  []*Result
+	Required  int32
+}
+
+type ApprovalDecision struct {
+	User      string
+	CreatedAt time.Time
+	Counted   bool
+	Reason    string
+}
+
+type Actors struct {
+	Users              []string
+	Teams              []string
+	Organizations      []string
+	Groups             []string
+	Admins             bool
+	WriteCollaborators bool
+	Apps               []string
+}
+
+type ValidateRequest struct {
+	Policy string
+}
+
+type ValidateResponse struct {
+	Valid    bool
+	Errors   []string
+	Warnings []string
+}
+
+func marshal(m interface{ marshal(*encoder) }) []byte {
+	var e encoder
+	m.marshal(&e)
+	return e.b
+}
+
+func (m *PullRequest) Marshal() []byte          { return marshal(m) }
+func (m *PullRequest) Unmarshal(b []byte) error { return m.unmarshal(&decoder{b: b}) }
+
+func (m *PullRequest) marshal(e *encoder) {
+	e.string(1, m.Owner)
+	e.string(2, m.Repo)
+	e.int64(3, int64(m.Number))
+}
+
+func (m *PullRequest) unmarshal(d *decoder) error {
+	for !d.done() {
+		field, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			m.Owner, err = d.string(wireType)
+		case 2:
+			m.Repo, err = d.string(wireType)
+		case 3:
+			m.Number, err = d.int32(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *EvaluateRequest) Marshal() []byte          { return marshal(m) }
+func (m *EvaluateRequest) Unmarshal(b []byte) error { return m.unmarshal(&decoder{b: b}) }
+
+func (m *EvaluateRequest) marshal(e *encoder) {
+	if m.PullRequest != nil {
+		e.message(1, m.PullRequest)
+	}
+}
+
+func (m *EvaluateRequest) unmarshal(d *decoder) error {
+	for !d.done() {
+		field, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			m.PullRequest = &PullRequest{}
+			err = d.message(wireType, m.PullRequest)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *SimulateRequest) Marshal() []byte          { return marshal(m) }
+func (m *SimulateRequest) Unmarshal(b []byte) error { return m.unmarshal(&decoder{b: b}) }
+
+func (m *SimulateRequest) marshal(e *encoder) {
+	if m.PullRequest != nil {
+		e.message(1, m.PullRequest)
+	}
+	e.string(2, m.Policy)
+	e.strings(3, m.Approvers)
+	e.strings(4, m.UnchangedFiles)
+	e.strings(5, m.AddedLabels)
+	e.strings(6, m.RemovedLabels)
+}
+
+func (m *SimulateRequest) unmarshal(d *decoder) error {
+	for !d.done() {
+		field, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		var s string
+		switch field {
+		case 1:
+			m.PullRequest = &PullRequest{}
+			err = d.message(wireType, m.PullRequest)
+		case 2:
+			m.Policy, err = d.string(wireType)
+		case 3:
+			s, err = d.string(wireType)
+			m.Approvers = append(m.Approvers, s)
+		case 4:
+			s, err = d.string(wireType)
+			m.UnchangedFiles = append(m.UnchangedFiles, s)
+		case 5:
+			s, err = d.string(wireType)
+			m.AddedLabels = append(m.AddedLabels, s)
+		case 6:
+			s, err = d.string(wireType)
+			m.RemovedLabels = append(m.RemovedLabels, s)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *EvaluateResponse) Marshal() []byte          { return marshal(m) }
+func (m *EvaluateResponse) Unmarshal(b []byte) error { return m.unmarshal(&decoder{b: b}) }
+
+func (m *EvaluateResponse) marshal(e *encoder) {
+	e.string(1, m.SHA)
+	e.string(2, m.PolicySource)
+	if m.Result != nil {
+		e.message(3, m.Result)
+	}
+	e.string(4, m.State)
+	e.string(5, m.Description)
+}
+
+func (m *EvaluateResponse) unmarshal(d *decoder) error {
+	for !d.done() {
+		field, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			m.SHA, err = d.string(wireType)
+		case 2:
+			m.PolicySource, err = d.string(wireType)
+		case 3:
+			m.Result = &Result{}
+			err = d.message(wireType, m.Result)
+		case 4:
+			m.State, err = d.string(wireType)
+		case 5:
+			m.Description, err = d.string(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Result) Marshal() []byte          { return marshal(m) }
+func (m *Result) Unmarshal(b []byte) error { return m.unmarshal(&decoder{b: b}) }
+
+func (m *Result) marshal(e *encoder) {
+	e.string(1, m.Name)
+	e.string(2, m.Description)
+	e.int64(3, int64(m.Status))
+	e.string(4, m.Error)
+	for _, a := range m.Approvals {
+		e.message(5, a)
+	}
+	if m.Requires != nil {
+		e.message(6, m.Requires)
+	}
+	e.strings(7, m.Labels)
+	for _, c := range m.Children {
+		e.message(8, c)
+	}
+	e.int64(9, int64(m.Required))
+}
+
+func (m *Result) unmarshal(d *decoder) error {
+	for !d.done() {
+		field, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		var s string
+		var status int32
+		switch field {
+		case 1:
+			m.Name, err = d.string(wireType)
+		case 2:
+			m.Description, err = d.string(wireType)
+		case 3:
+			status, err = d.int32(wireType)
+			m.Status = Status(status)
+		case 4:
+			m.Error, err = d.string(wireType)
+		case 5:
+			a := &ApprovalDecision{}
+			err = d.message(wireType, a)
+			m.Approvals = append(m.Approvals, a)
+		case 6:
+			m.Requires = &Actors{}
+			err = d.message(wireType, m.Requires)
+		case 7:
+			s, err = d.string(wireType)
+			m.Labels = append(m.Labels, s)
+		case 8:
+			c := &Result{}
+			err = d.message(wireType, c)
+			m.Children = append(m.Children, c)
+		case 9:
+			m.Required, err = d.int32(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *ApprovalDecision) Marshal() []byte          { return marshal(m) }
+func (m *ApprovalDecision) Unmarshal(b []byte) error { return m.unmarshal(&decoder{b: b}) }
+
+func (m *ApprovalDecision) marshal(e *encoder) {
+	e.string(1, m.User)
+	if !m.CreatedAt.IsZero() {
+		e.message(2, timestamp(m.CreatedAt))
+	}
+	e.bool(3, m.Counted)
+	e.string(4, m.Reason)
+}
+
+func (m *ApprovalDecision) unmarshal(d *decoder) error {
+	for !d.done() {
+		field, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			m.User, err = d.string(wireType)
+		case 2:
+			var ts timestamp
+			err = d.message(wireType, &ts)
+			m.CreatedAt = time.Time(ts).UTC()
+		case 3:
+			m.Counted, err = d.bool(wireType)
+		case 4:
+			m.Reason, err = d.string(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Actors) Marshal() []byte          { return marshal(m) }
+func (m *Actors) Unmarshal(b []byte) error { return m.unmarshal(&decoder{b: b}) }
+
+func (m *Actors) marshal(e *encoder) {
+	e.strings(1, m.Users)
+	e.strings(2, m.Teams)
+	e.strings(3, m.Organizations)
+	e.strings(4, m.Groups)
+	e.bool(5, m.Admins)
+	e.bool(6, m.WriteCollaborators)
+	e.strings(7, m.Apps)
+}
+
+func (m *Actors) unmarshal(d *decoder) error {
+	for !d.done() {
+		field, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		var s string
+		switch field {
+		case 1:
+			s, err = d.string(wireType)
+			m.Users = append(m.Users, s)
+		case 2:
+			s, err = d.string(wireType)
+			m.Teams = append(m.Teams, s)
+		case 3:
+			s, err = d.string(wireType)
+			m.Organizations = append(m.Organizations, s)
+		case 4:
+			s, err = d.string(wireType)
+			m.Groups = append(m.Groups, s)
+		case 5:
+			m.Admins, err = d.bool(wireType)
+		case 6:
+			m.WriteCollaborators, err = d.bool(wireType)
+		case 7:
+			s, err = d.string(wireType)
+			m.Apps = append(m.Apps, s)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *ValidateRequest) Marshal() []byte          { return marshal(m) }
+func (m *ValidateRequest) Unmarshal(b []byte) error { return m.unmarshal(&decoder{b: b}) }
+
+func (m *ValidateRequest) marshal(e *encoder) {
+	e.string(1, m.Policy)
+}
+
+func (m *ValidateRequest) unmarshal(d *decoder) error {
+	for !d.done() {
+		field, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			m.Policy, err = d.string(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *ValidateResponse) Marshal() []byte          { return marshal(m) }
+func (m *ValidateResponse) Unmarshal(b []byte) error { return m.unmarshal(&decoder{b: b}) }
+
+func (m *ValidateResponse) marshal(e *encoder) {
+	e.bool(1, m.Valid)
+	e.strings(2, m.Errors)
+	e.strings(3, m.Warnings)
+}
+
+func (m *ValidateResponse) unmarshal(d *decoder) error {
+	for !d.done() {
+		field, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		var s string
+		switch field {
+		case 1:
+			m.Valid, err = d.bool(wireType)
+		case 2:
+			s, err = d.string(wireType)
+			m.Errors = append(m.Errors, s)
+		case 3:
+			s, err = d.string(wireType)
+			m.Warnings = append(m.Warnings, s)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timestamp is a google.protobuf.Timestamp.
+type timestamp time.Time
+
+func (t timestamp) marshal(e *encoder) {
+	tt := time.Time(t)
+	e.int64(1, tt.Unix())
+	e.int64(2, int64(tt.Nanosecond()))
+}
+
+func (t *timestamp) unmarshal(d *decoder) error {
+	var seconds, nanos int64
+	for !d.done() {
+		field, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			seconds, err = d.int64(wireType)
+		case 2:
+			nanos, err = d.int64(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	*t = timestamp(time.Unix(seconds, nanos))
+	return nil
+}
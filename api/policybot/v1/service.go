@@ -0,0 +1,66 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policybotv1
+
+import (
+	"context"
+	"net/http"
+)
+
+// The paths of the methods of the evaluation service.
+const (
+	EvaluateMethod = "/policybot.v1.EvaluationService/Evaluate"
+	SimulateMethod = "/policybot.v1.EvaluationService/Simulate"
+	ValidateMethod = "/policybot.v1.EvaluationService/Validate"
+)
+
+// EvaluationServiceServer implements the evaluation service.
+type EvaluationServiceServer interface {
+	Evaluate(ctx context.Context, req *EvaluateRequest) (*EvaluateResponse, error)
+	Simulate(ctx context.Context, req *SimulateRequest) (*EvaluateResponse, error)
+	Validate(ctx context.Context, req *ValidateRequest) (*ValidateResponse, error)
+}
+
+// EvaluationServiceHandlers are the handlers for the methods of the
+// evaluation service. Each method has its own handler so that callers can
+// require different permissions for each method.
+type EvaluationServiceHandlers struct {
+	Evaluate http.Handler
+	Simulate http.Handler
+	Validate http.Handler
+}
+
+func NewEvaluationServiceHandlers(srv EvaluationServiceServer) EvaluationServiceHandlers {
+	return EvaluationServiceHandlers{
+		Evaluate: UnaryHandler(
+			func() Message { return &EvaluateRequest{} },
+			func(ctx context.Context, req Message) (Message, error) {
+				return srv.Evaluate(ctx, req.(*EvaluateRequest))
+			},
+		),
+		Simulate: UnaryHandler(
+			func() Message { return &SimulateRequest{} },
+			func(ctx context.Context, req Message) (Message, error) {
+				return srv.Simulate(ctx, req.(*SimulateRequest))
+			},
+		),
+		Validate: UnaryHandler(
+			func() Message { return &ValidateRequest{} },
+			func(ctx context.Context, req Message) (Message, error) {
+				return srv.Validate(ctx, req.(*ValidateRequest))
+			},
+		),
+	}
+}
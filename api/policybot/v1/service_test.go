@@ -0,0 +1,199 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policybotv1
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	res := &EvaluateResponse{
+		SHA:          "ab12",
+		PolicySource: "palantir/policy-bot ref=develop",
+		State:        "pending",
+		Description:  "0/1 rules approved",
+		Result: &Result{
+			Name:   "policy",
+			Status: StatusPending,
+			Children: []*Result{
+				{
+					Name:        "rule",
+					Description: "requires one approval",
+					Status:      StatusPending,
+					Required:    1,
+					Labels:      []string{"needs-review"},
+					Requires: &Actors{
+						Users:              []string{"mhaypenny"},
+						Apps:               []string{"dependabot"},
+						WriteCollaborators: true,
+					},
+					Approvals: []*ApprovalDecision{
+						{
+							User:      "bkeyes",
+							CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+							Reason:    "not the head commit",
+						},
+					},
+				},
+				{
+					Name:   "broken",
+					Status: StatusError,
+					Error:  "failed to load reviews",
+				},
+			},
+		},
+	}
+
+	var decoded EvaluateResponse
+	require.NoError(t, decoded.Unmarshal(res.Marshal()))
+	assert.Equal(t, res, &decoded)
+
+	sim := &SimulateRequest{
+		PullRequest:    &PullRequest{Owner: "palantir", Repo: "policy-bot", Number: 42},
+		Policy:         "policy:\n  approval: []\n",
+		Approvers:      []string{"a", "b"},
+		UnchangedFiles: []string{"README.md"},
+		AddedLabels:    []string{"x"},
+		RemovedLabels:  []string{"y"},
+	}
+
+	var decodedSim SimulateRequest
+	require.NoError(t, decodedSim.Unmarshal(sim.Marshal()))
+	assert.Equal(t, sim, &decodedSim)
+}
+
+func TestUnmarshalSkipsUnknownFields(t *testing.T) {
+	var e encoder
+	e.string(1, "palantir")
+	e.int64(20, 7)
+	e.string(21, "unknown")
+	e.tag(22, wireFixed64)
+	e.b = append(e.b, make([]byte, 8)...)
+	e.tag(23, wireFixed32)
+	e.b = append(e.b, make([]byte, 4)...)
+	e.int64(3, 42)
+
+	var pr PullRequest
+	require.NoError(t, pr.Unmarshal(e.b))
+	assert.Equal(t, PullRequest{Owner: "palantir", Number: 42}, pr)
+
+	assert.Error(t, pr.Unmarshal([]byte{0x0a, 0x05, 'a'}), "truncated fields are errors")
+	assert.Error(t, pr.Unmarshal([]byte{0x08, 0x01}), "wrong wire types are errors")
+}
+
+type testServer struct{}
+
+func (testServer) Evaluate(ctx context.Context, req *EvaluateRequest) (*EvaluateResponse, error) {
+	return nil, Errorf(NotFound, "not found: %s/%s#%d", req.PullRequest.Owner, req.PullRequest.Repo, req.PullRequest.Number)
+}
+
+func (testServer) Simulate(ctx context.Context, req *SimulateRequest) (*EvaluateResponse, error) {
+	return &EvaluateResponse{SHA: "ab12", Description: req.Policy}, nil
+}
+
+func (testServer) Validate(ctx context.Context, req *ValidateRequest) (*ValidateResponse, error) {
+	return &ValidateResponse{Valid: req.Policy != ""}, nil
+}
+
+func TestUnaryHandler(t *testing.T) {
+	handlers := NewEvaluationServiceHandlers(testServer{})
+
+	call := func(h http.Handler, req Message) *httptest.ResponseRecorder {
+		b := req.Marshal()
+		frame := make([]byte, 5, 5+len(b))
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(b)))
+		frame = append(frame, b...)
+
+		r := httptest.NewRequest(http.MethodPost, EvaluateMethod, bytes.NewReader(frame))
+		r.Header.Set("Content-Type", "application/grpc")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("success", func(t *testing.T) {
+		w := call(handlers.Simulate, &SimulateRequest{Policy: "policy"})
+
+		res := w.Result()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "0", res.Trailer.Get("Grpc-Status"))
+
+		body := w.Body.Bytes()
+		require.True(t, len(body) >= 5)
+		assert.Equal(t, byte(0), body[0])
+		assert.Equal(t, uint32(len(body)-5), binary.BigEndian.Uint32(body[1:5]))
+
+		var decoded EvaluateResponse
+		require.NoError(t, decoded.Unmarshal(body[5:]))
+		assert.Equal(t, EvaluateResponse{SHA: "ab12", Description: "policy"}, decoded)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		w := call(handlers.Evaluate, &EvaluateRequest{PullRequest: &PullRequest{Owner: "o", Repo: "r", Number: 1}})
+
+		res := w.Result()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "5", res.Trailer.Get("Grpc-Status"))
+		assert.Equal(t, "not found: o/r#1", res.Trailer.Get("Grpc-Message"))
+		assert.Empty(t, w.Body.Bytes())
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, ValidateMethod, bytes.NewReader([]byte{1, 0, 0, 0, 0}))
+		r.Header.Set("Content-Type", "application/grpc")
+		w := httptest.NewRecorder()
+		handlers.Validate.ServeHTTP(w, r)
+
+		assert.Equal(t, "12", w.Result().Trailer.Get("Grpc-Status"))
+	})
+
+	t.Run("contentType", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, ValidateMethod, bytes.NewReader(nil))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handlers.Validate.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+}
+
+func TestParseTimeout(t *testing.T) {
+	d, ok := parseTimeout("250m")
+	assert.True(t, ok)
+	assert.Equal(t, 250*time.Millisecond, d)
+
+	d, ok = parseTimeout("3S")
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+
+	_, ok = parseTimeout("10x")
+	assert.False(t, ok)
+
+	_, ok = parseTimeout("S")
+	assert.False(t, ok)
+}
+
+func TestEncodeMessage(t *testing.T) {
+	assert.Equal(t, "100%25 done%0A", encodeMessage("100% done\n"))
+}
@@ -0,0 +1,193 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policybotv1
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Wire types of the protobuf encoding. Groups are not supported.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// encoder appends fields in the protobuf wire format. Like proto3, it omits
+// fields with default values.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	e.b = append(e.b, buf[:n]...)
+}
+
+func (e *encoder) tag(field, wireType int) {
+	e.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (e *encoder) bytes(field int, b []byte) {
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(b)))
+	e.b = append(e.b, b...)
+}
+
+func (e *encoder) string(field int, s string) {
+	if s != "" {
+		e.tag(field, wireBytes)
+		e.varint(uint64(len(s)))
+		e.b = append(e.b, s...)
+	}
+}
+
+func (e *encoder) strings(field int, ss []string) {
+	for _, s := range ss {
+		e.tag(field, wireBytes)
+		e.varint(uint64(len(s)))
+		e.b = append(e.b, s...)
+	}
+}
+
+func (e *encoder) int64(field int, v int64) {
+	if v != 0 {
+		e.tag(field, wireVarint)
+		e.varint(uint64(v))
+	}
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if v {
+		e.tag(field, wireVarint)
+		e.varint(1)
+	}
+}
+
+// message encodes a nested message. Callers omit nil messages.
+func (e *encoder) message(field int, m interface{ marshal(*encoder) }) {
+	var n encoder
+	m.marshal(&n)
+	e.bytes(field, n.b)
+}
+
+// decoder reads fields in the protobuf wire format.
+type decoder struct {
+	b []byte
+}
+
+func (d *decoder) done() bool {
+	return len(d.b) == 0
+}
+
+// next reads the tag of the next field.
+func (d *decoder) next() (int, int, error) {
+	v, err := d.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	field, wireType := int(v>>3), int(v&7)
+	if field <= 0 || field > math.MaxInt32 {
+		return 0, 0, errors.Errorf("invalid field number %d", field)
+	}
+	return field, wireType, nil
+}
+
+func (d *decoder) varint() (uint64, error) {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		return 0, errors.New("invalid varint")
+	}
+	d.b = d.b[n:]
+	return v, nil
+}
+
+func (d *decoder) bytes(wireType int) ([]byte, error) {
+	if wireType != wireBytes {
+		return nil, errors.Errorf("unexpected wire type %d for a length-delimited field", wireType)
+	}
+	n, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.b)) {
+		return nil, errors.New("length-delimited field exceeds the message")
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b, nil
+}
+
+func (d *decoder) string(wireType int) (string, error) {
+	b, err := d.bytes(wireType)
+	return string(b), err
+}
+
+func (d *decoder) int64(wireType int) (int64, error) {
+	if wireType != wireVarint {
+		return 0, errors.Errorf("unexpected wire type %d for a varint field", wireType)
+	}
+	v, err := d.varint()
+	return int64(v), err
+}
+
+func (d *decoder) int32(wireType int) (int32, error) {
+	v, err := d.int64(wireType)
+	return int32(v), err
+}
+
+func (d *decoder) bool(wireType int) (bool, error) {
+	v, err := d.int64(wireType)
+	return v != 0, err
+}
+
+// message decodes a nested message.
+func (d *decoder) message(wireType int, m interface{ unmarshal(*decoder) error }) error {
+	b, err := d.bytes(wireType)
+	if err != nil {
+		return err
+	}
+	return m.unmarshal(&decoder{b: b})
+}
+
+// skip skips a field with an unknown number, as required for compatibility
+// with newer clients.
+func (d *decoder) skip(wireType int) error {
+	var n int
+	switch wireType {
+	case wireVarint:
+		_, err := d.varint()
+		return err
+	case wireFixed64:
+		n = 8
+	case wireBytes:
+		_, err := d.bytes(wireType)
+		return err
+	case wireFixed32:
+		n = 4
+	default:
+		return errors.Errorf("unsupported wire type %d", wireType)
+	}
+	if n > len(d.b) {
+		return errors.New("fixed-length field exceeds the message")
+	}
+	d.b = d.b[n:]
+	return nil
+}
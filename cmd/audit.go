@@ -0,0 +1,129 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/policy-bot/server/audit"
+)
+
+var auditVerifyCmdConfig struct {
+	PublicKey   string
+	Checkpoints []string
+}
+
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Works with evaluation audit records.",
+}
+
+var AuditVerifyCmd = &cobra.Command{
+	Use:   "verify record-file...",
+	Short: "Verifies the hash chain of audit records.",
+	Long: "Checks that each record in the files matches its hash and links to the previous record in its " +
+		"chain, reporting the first altered or missing record. If a public key is given, the signature " +
+		"of each record is also checked. Files are read in order as a single sequence of records. If " +
+		"checkpoints are given, the records must also reach each checkpoint, which detects removal of " +
+		"the newest records.",
+	Args: cobra.MinimumNArgs(1),
+
+	RunE: auditVerifyCmd,
+}
+
+var AuditKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generates a key for signing audit records.",
+	Args:  cobra.NoArgs,
+
+	RunE: auditKeygenCmd,
+}
+
+func auditVerifyCmd(cmd *cobra.Command, args []string) error {
+	var key ed25519.PublicKey
+	if auditVerifyCmdConfig.PublicKey != "" {
+		var err error
+		if key, err = audit.ParsePublicKey(auditVerifyCmdConfig.PublicKey); err != nil {
+			return err
+		}
+	}
+
+	checkpoints := make([]audit.ChainState, 0, len(auditVerifyCmdConfig.Checkpoints))
+	for _, path := range auditVerifyCmdConfig.Checkpoints {
+		cp, err := audit.ReadChainState(path)
+		if err != nil {
+			return err
+		}
+		if cp == nil {
+			return errors.Errorf("checkpoint %s does not exist", path)
+		}
+		checkpoints = append(checkpoints, *cp)
+	}
+
+	files := make([]*os.File, 0, len(args))
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	readers := make([]io.Reader, 0, len(args))
+	for _, path := range args {
+		f, err := os.Open(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to open audit records")
+		}
+		files = append(files, f)
+		readers = append(readers, f, strings.NewReader("\n"))
+	}
+
+	v, err := audit.Verify(io.MultiReader(readers...), key, checkpoints...)
+	if err != nil {
+		return errors.Wrapf(err, "verification failed after %d valid records", v.Records)
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), v)
+	return nil
+}
+
+func auditKeygenCmd(cmd *cobra.Command, args []string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate key")
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "signing_key: %s\n", base64.StdEncoding.EncodeToString(priv.Seed()))
+	fmt.Fprintf(out, "public_key: %s\n", base64.StdEncoding.EncodeToString(pub))
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(AuditCmd)
+	AuditCmd.AddCommand(AuditVerifyCmd)
+	AuditCmd.AddCommand(AuditKeygenCmd)
+
+	AuditVerifyCmd.Flags().StringVar(&auditVerifyCmdConfig.PublicKey, "public-key", "", "base64-encoded Ed25519 public key used to verify record signatures")
+	AuditVerifyCmd.Flags().StringSliceVar(&auditVerifyCmdConfig.Checkpoints, "checkpoint", nil, "copy of a chain state file that the records must reach; may be repeated")
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/codeowners"
+)
+
+var codeownersCmdConfig struct {
+	Strict bool
+}
+
+var CodeownersCmd = &cobra.Command{
+	Use:   "codeowners [codeowners-file]",
+	Short: "Generates a policy from a CODEOWNERS file.",
+	Long: "Converts a CODEOWNERS file into a starting policy that requires an approval from an owner of " +
+		"each changed path and prints it. Entries that do not translate exactly are listed as warnings and " +
+		"as comments in the policy. If no file is given, the locations GitHub uses for CODEOWNERS are checked.",
+	Args: cobra.MaximumNArgs(1),
+
+	RunE: codeownersCmd,
+}
+
+func codeownersCmd(cmd *cobra.Command, args []string) error {
+	path, err := findCodeowners(args)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read CODEOWNERS")
+	}
+
+	f, err := codeowners.Parse(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	out, warnings := codeowners.Generate(f)
+
+	// the policy is generated as text, so make sure it is valid
+	config, err := policy.ParseConfig(out)
+	if err != nil {
+		return errors.WithMessage(err, "generated an invalid policy")
+	}
+	if _, err := policy.ParsePolicy(config); err != nil {
+		return errors.WithMessage(err, "generated an invalid policy")
+	}
+
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", path, w)
+	}
+	if _, err := cmd.OutOrStdout().Write(out); err != nil {
+		return err
+	}
+
+	if codeownersCmdConfig.Strict && len(warnings) > 0 {
+		return errors.Errorf("CODEOWNERS does not translate exactly: %d warnings", len(warnings))
+	}
+	return nil
+}
+
+func findCodeowners(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	for _, path := range codeowners.Paths {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("no CODEOWNERS file found; pass the path to the file")
+}
+
+func init() {
+	RootCmd.AddCommand(CodeownersCmd)
+
+	CodeownersCmd.Flags().BoolVar(&codeownersCmdConfig.Strict, "strict", false, "fail if there are warnings")
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/policy-bot/policy"
+)
+
+var convertCmdConfig struct {
+	Write bool
+}
+
+var ConvertCmd = &cobra.Command{
+	Use:   "convert [policy-file...]",
+	Short: "Upgrades policy files that use legacy constructs.",
+	Long: "Rewrites legacy constructs in policy files, like renamed options and deprecated method settings, " +
+		"to the current schema and prints each change. The upgraded policy is printed unless --write is set. " +
+		"If no files are given, .policy.yml is converted. Comments are not preserved in upgraded files.",
+
+	RunE: convertCmd,
+}
+
+func convertCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{".policy.yml"}
+	}
+	if len(args) > 1 && !convertCmdConfig.Write {
+		return errors.New("use --write to convert more than one file")
+	}
+
+	out := cmd.OutOrStdout()
+	for _, path := range args {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", path)
+		}
+
+		if policy.IsRemoteConfig(b) {
+			fmt.Fprintf(os.Stderr, "%s: references a remote policy; convert that file instead\n", path)
+			continue
+		}
+
+		upgraded, changes, err := policy.Upgrade(b)
+		if err != nil {
+			return errors.WithMessage(err, path)
+		}
+
+		config, err := policy.ParseConfig(upgraded)
+		if err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("%s: upgraded policy is invalid", path))
+		}
+		if _, err := policy.ParsePolicy(config); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("%s: upgraded policy is invalid", path))
+		}
+
+		if len(changes) == 0 {
+			fmt.Fprintf(os.Stderr, "%s: no legacy constructs\n", path)
+		}
+		for _, c := range changes {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, c)
+		}
+
+		if !convertCmdConfig.Write {
+			if _, err := out.Write(upgraded); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(changes) > 0 {
+			if err := ioutil.WriteFile(path, upgraded, 0644); err != nil {
+				return errors.Wrapf(err, "failed to write %s", path)
+			}
+		}
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(ConvertCmd)
+
+	ConvertCmd.Flags().BoolVarP(&convertCmdConfig.Write, "write", "w", false, "write upgraded policies to their files")
+}
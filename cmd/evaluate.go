@@ -0,0 +1,234 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/version"
+)
+
+var evaluateCmdConfig struct {
+	Token      string
+	V3URL      string
+	V4URL      string
+	Policy     string
+	PolicyPath string
+	Record     string
+	Replay     string
+}
+
+var EvaluateCmd = &cobra.Command{
+	Use:   "evaluate owner/repo#number",
+	Short: "Evaluates the policy of a pull request.",
+	Long: "Evaluates the policy of a pull request using a GitHub token and prints the result of each rule. " +
+		"No statuses, comments, or reviews are posted. By default, the policy is read from the target " +
+		"branch of the pull request; use --policy to evaluate a local policy file instead. Use --record to " +
+		"save the GitHub API responses of the evaluation and --replay to evaluate offline from a recording.",
+	Args: cobra.ExactArgs(1),
+
+	RunE: evaluateCmd,
+}
+
+func evaluateCmd(cmd *cobra.Command, args []string) error {
+	loc, err := pull.ParseLocator(args[0])
+	if err != nil {
+		return err
+	}
+
+	if evaluateCmdConfig.Record != "" && evaluateCmdConfig.Replay != "" {
+		return errors.New("--record and --replay cannot be used together")
+	}
+
+	var middleware []githubapp.ClientMiddleware
+	var recorder *pull.Recorder
+
+	token := evaluateCmdConfig.Token
+	if token == "" {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+
+	switch {
+	case evaluateCmdConfig.Replay != "":
+		replayer, err := pull.LoadReplayer(evaluateCmdConfig.Replay)
+		if err != nil {
+			return err
+		}
+		middleware = append(middleware, func(http.RoundTripper) http.RoundTripper { return replayer })
+		token = "replay"
+
+	case token == "":
+		return errors.New("a GitHub token is required: set --token or GITHUB_TOKEN")
+
+	case evaluateCmdConfig.Record != "":
+		recorder = &pull.Recorder{}
+		middleware = append(middleware, recorder.Wrap)
+	}
+
+	logger := zerolog.Nop()
+	if IsDebugMode() {
+		logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
+	}
+	ctx := logger.WithContext(context.Background())
+
+	cc := githubapp.NewClientCreator(
+		evaluateCmdConfig.V3URL,
+		evaluateCmdConfig.V4URL,
+		0,
+		nil,
+		githubapp.WithClientUserAgent(fmt.Sprintf("%s/%s", handler.DefaultAppName, version.GetVersion())),
+		githubapp.WithClientMiddleware(middleware...),
+	)
+
+	client, err := cc.NewTokenClient(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to create GitHub client")
+	}
+	v4client, err := cc.NewTokenV4Client(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to create GitHub client")
+	}
+
+	mbrCtx := pull.NewGitHubMembershipContext(ctx, client, v4client)
+	prctx, err := pull.NewGitHubContext(ctx, mbrCtx, client, v4client, loc)
+	if err != nil {
+		return errors.Wrap(err, "failed to load pull request")
+	}
+
+	var config *policy.Config
+	var source string
+	if evaluateCmdConfig.Policy != "" {
+		source = evaluateCmdConfig.Policy
+		if config, err = readPolicyFile(evaluateCmdConfig.Policy); err != nil {
+			return err
+		}
+	} else {
+		opts := &handler.PullEvaluationOptions{PolicyPath: evaluateCmdConfig.PolicyPath}
+		opts.FillDefaults()
+
+		fetcher := &handler.ConfigFetcher{Options: opts}
+		fc, err := fetcher.ConfigForPR(ctx, prctx, client)
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch policy")
+		}
+
+		source = fmt.Sprintf("%s in %s", fc.Path, fc)
+		switch {
+		case fc.Missing():
+			return errors.Errorf("no policy found at %s", source)
+		case fc.Invalid():
+			return errors.Wrapf(fc.Error, "invalid policy at %s", source)
+		}
+		config = fc.Config
+	}
+
+	evaluator, err := policy.ParsePolicy(config)
+	if err != nil {
+		return errors.Wrapf(err, "invalid policy at %s", source)
+	}
+
+	result := evaluator.Evaluate(ctx, prctx)
+
+	if recorder != nil {
+		if err := recorder.Save(evaluateCmdConfig.Record); err != nil {
+			return err
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Pull request: %s/%s#%d (%s)\n", loc.Owner, loc.Repo, loc.Number, prctx.HeadSHA())
+	fmt.Fprintf(out, "Policy: %s\n\n", source)
+	printResult(out, &result, 0)
+
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "failed to evaluate policy")
+	}
+	return nil
+}
+
+func readPolicyFile(path string) (*policy.Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read policy")
+	}
+
+	config, err := policy.ParseConfig(b)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid policy at "+path)
+	}
+	return config, nil
+}
+
+// printResult prints an evaluation result and its children as a tree,
+// including the approval candidates considered by each rule.
+func printResult(out io.Writer, r *common.Result, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	status := r.Status.String()
+	if r.Error != nil {
+		status = "error"
+	}
+
+	line := fmt.Sprintf("%s%s: %s", indent, r.Name, status)
+	if r.Description != "" {
+		line += " - " + r.Description
+	}
+	fmt.Fprintln(out, line)
+
+	if r.Error != nil {
+		fmt.Fprintf(out, "%s  error: %v\n", indent, r.Error)
+	}
+	if r.Requires != nil && r.Status == common.StatusPending {
+		fmt.Fprintf(out, "%s  can approve: %s\n", indent, describeActors(r.Requires))
+	}
+	for _, a := range r.Approvals {
+		if a.Counted {
+			fmt.Fprintf(out, "%s  approval by %s: counted\n", indent, a.User)
+		} else {
+			fmt.Fprintf(out, "%s  approval by %s: not counted (%s)\n", indent, a.User, a.Reason)
+		}
+	}
+
+	for _, c := range r.Children {
+		printResult(out, c, depth+1)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(EvaluateCmd)
+
+	EvaluateCmd.Flags().StringVarP(&evaluateCmdConfig.Token, "token", "t", "", "GitHub token used to read the pull request (default $GITHUB_TOKEN)")
+	EvaluateCmd.Flags().StringVar(&evaluateCmdConfig.V3URL, "github-url", "https://api.github.com/", "base URL of the GitHub REST API")
+	EvaluateCmd.Flags().StringVar(&evaluateCmdConfig.V4URL, "github-graphql-url", "https://api.github.com/graphql", "URL of the GitHub GraphQL API")
+	EvaluateCmd.Flags().StringVarP(&evaluateCmdConfig.Policy, "policy", "p", "", "local policy file to evaluate instead of the policy of the repository")
+	EvaluateCmd.Flags().StringVar(&evaluateCmdConfig.PolicyPath, "policy-path", handler.DefaultPolicyPath, "path of the policy file in the repository")
+	EvaluateCmd.Flags().StringVar(&evaluateCmdConfig.Record, "record", "", "save the GitHub API requests and responses of the evaluation to this file")
+	EvaluateCmd.Flags().StringVar(&evaluateCmdConfig.Replay, "replay", "", "evaluate using the GitHub API responses saved in this file instead of GitHub")
+}
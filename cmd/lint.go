@@ -0,0 +1,465 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/version"
+)
+
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+	lintNote    = "note"
+)
+
+var lintCmdConfig struct {
+	Strict bool
+	GitHub bool
+	Token  string
+	V3URL  string
+}
+
+var LintCmd = &cobra.Command{
+	Use:   "lint [policy-file...]",
+	Short: "Lints policy files.",
+	Long: "Checks policy files for unknown keys, invalid values, rules that are unused or can never " +
+		"affect the result, and malformed user, team, and organization names, printing each problem " +
+		"with its line number. Use --github to also check that users, teams, and organizations exist. " +
+		"If no files are given, .policy.yml is linted.",
+
+	RunE: lintCmd,
+}
+
+// lintFinding is a problem in a policy file. Line is zero if the problem
+// cannot be located in the file.
+type lintFinding struct {
+	Line     int
+	Severity string
+	Message  string
+}
+
+func (f lintFinding) format(path string) string {
+	if f.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", path, f.Line, f.Severity, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", path, f.Severity, f.Message)
+}
+
+func lintCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{".policy.yml"}
+	}
+
+	var refs *referenceChecker
+	if lintCmdConfig.GitHub {
+		client, err := newLintClient()
+		if err != nil {
+			return err
+		}
+		refs = &referenceChecker{ctx: context.Background(), client: client, results: make(map[string]string)}
+	}
+
+	out := cmd.OutOrStdout()
+
+	var failed int
+	for _, path := range args {
+		findings := lintPolicyFile(path, refs)
+
+		var errs, warnings int
+		for _, f := range findings {
+			fmt.Fprintln(out, f.format(path))
+			switch f.Severity {
+			case lintError:
+				errs++
+			case lintWarning:
+				warnings++
+			}
+		}
+		if errs > 0 || (lintCmdConfig.Strict && warnings > 0) {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d policy files have problems", failed, len(args))
+	}
+	return nil
+}
+
+func newLintClient() (*github.Client, error) {
+	token := lintCmdConfig.Token
+	if token == "" {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+	if token == "" {
+		return nil, errors.New("a GitHub token is required with --github: set --token or GITHUB_TOKEN")
+	}
+
+	cc := githubapp.NewClientCreator(
+		lintCmdConfig.V3URL,
+		"",
+		0,
+		nil,
+		githubapp.WithClientUserAgent(fmt.Sprintf("%s/%s", handler.DefaultAppName, version.GetVersion())),
+	)
+
+	client, err := cc.NewTokenClient(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create GitHub client")
+	}
+	return client, nil
+}
+
+// lintPolicyFile returns the problems in the policy at path. If refs is not
+// nil, it also checks that referenced users, teams, and organizations exist.
+func lintPolicyFile(path string, refs *referenceChecker) []lintFinding {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []lintFinding{{Severity: lintError, Message: fmt.Sprintf("failed to read policy: %v", err)}}
+	}
+	lines := newLineIndex(b)
+
+	if err := policy.DefaultLimits.Check(b); err != nil {
+		return []lintFinding{{Severity: lintError, Message: err.Error()}}
+	}
+
+	if policy.IsRemoteConfig(b) {
+		remote, err := policy.ParseRemoteConfig(b)
+		if err != nil {
+			return yamlFindings(err)
+		}
+		return []lintFinding{{Severity: lintNote, Message: fmt.Sprintf("references the policy in %s; lint that file instead", remote.Remote)}}
+	}
+
+	config, err := policy.ParseConfigWithLimits(b, policy.DefaultLimits)
+	if err != nil {
+		return yamlFindings(err)
+	}
+
+	var findings []lintFinding
+	for _, c := range config.Upgrades {
+		findings = append(findings, lintFinding{
+			Severity: lintWarning,
+			Message:  fmt.Sprintf("legacy construct at %s; run 'policy-bot convert' to upgrade", c),
+		})
+	}
+
+	if _, err := policy.ParsePolicy(config); err != nil {
+		return append(findings, lines.locate(lintError, err.Error()))
+	}
+
+	warnings, err := lintPolicy(config)
+	for _, w := range warnings {
+		findings = append(findings, lines.locate(lintWarning, w))
+	}
+	if err != nil {
+		return append(findings, lines.locate(lintError, err.Error()))
+	}
+
+	for _, w := range lintUnreachable(config) {
+		findings = append(findings, lines.locate(lintWarning, w))
+	}
+
+	for _, ref := range collectReferences(config) {
+		msg := ref.validate()
+		if msg == "" && refs != nil {
+			msg = refs.check(ref)
+		}
+		if msg != "" {
+			findings = append(findings, lintFinding{Line: lines.value(ref.Name), Severity: lintError, Message: msg})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+var yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+
+// yamlFindings converts a parse error into findings, with one finding for
+// each unknown key or invalid value reported by the YAML decoder.
+func yamlFindings(err error) []lintFinding {
+	msgs := []string{err.Error()}
+	if terr, ok := errors.Cause(err).(*yaml.TypeError); ok {
+		msgs = terr.Errors
+	}
+
+	findings := make([]lintFinding, 0, len(msgs))
+	for _, msg := range msgs {
+		f := lintFinding{Severity: lintError, Message: msg}
+		if m := yamlLinePattern.FindStringSubmatch(msg); m != nil {
+			f.Line, _ = strconv.Atoi(m[1])
+			f.Message = m[2]
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// lintUnreachable returns warnings for rules in an "or" that can never affect
+// the result because another rule in the same "or" is always approved.
+func lintUnreachable(config *policy.Config) []string {
+	rules := make(map[string]*approval.Rule)
+	for _, r := range config.ApprovalRules {
+		if r != nil {
+			rules[r.Name] = r
+		}
+	}
+
+	var warnings []string
+	var visit func(p interface{})
+	visit = func(p interface{}) {
+		switch v := p.(type) {
+		case approval.Policy:
+			for _, sub := range v {
+				visit(sub)
+			}
+		case map[interface{}]interface{}:
+			for op, subs := range v {
+				subpolicies, _ := subs.([]interface{})
+				if op == "or" {
+					warnings = append(warnings, unreachableInOr(subpolicies, rules)...)
+				}
+				for _, sub := range subpolicies {
+					visit(sub)
+				}
+			}
+		}
+	}
+	visit(config.Policy.Approval)
+	return warnings
+}
+
+func unreachableInOr(subpolicies []interface{}, rules map[string]*approval.Rule) []string {
+	var always string
+	for _, sub := range subpolicies {
+		if name, ok := sub.(string); ok && isAlwaysApproved(rules[name]) {
+			always = name
+			break
+		}
+	}
+	if always == "" {
+		return nil
+	}
+
+	var warnings []string
+	for _, sub := range subpolicies {
+		if name, ok := sub.(string); ok && name != always {
+			warnings = append(warnings, fmt.Sprintf("rule %q can never affect the result because rule %q in the same \"or\" is always approved", name, always))
+		}
+	}
+	return warnings
+}
+
+// isAlwaysApproved returns true if a rule has no predicates and no
+// requirements, so it approves every pull request.
+func isAlwaysApproved(r *approval.Rule) bool {
+	return r != nil && len(predicateNames(&r.Predicates)) == 0 &&
+		r.Requires.Count == 0 && !r.Requires.CodeOwners && !r.Requires.SignedCommits
+}
+
+// reference is a user, team, or organization named by a policy.
+type reference struct {
+	Kind string
+	Name string
+}
+
+var loginPattern = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9]|-[A-Za-z0-9])*$`)
+
+// validate returns a problem with the format of the name, if any.
+func (ref reference) validate() string {
+	switch ref.Kind {
+	case "team":
+		parts := strings.Split(ref.Name, "/")
+		if len(parts) != 2 || !loginPattern.MatchString(parts[0]) || parts[1] == "" {
+			return fmt.Sprintf("team %q must be in the form \"org/team-slug\"", ref.Name)
+		}
+	default:
+		if !loginPattern.MatchString(ref.Name) {
+			return fmt.Sprintf("%s %q is not a valid GitHub login", ref.Kind, ref.Name)
+		}
+	}
+	return ""
+}
+
+// collectReferences returns the users, teams, and organizations named by the
+// rules, predicates, and disapproval policy of a policy, in a stable order.
+func collectReferences(config *policy.Config) []reference {
+	seen := make(map[reference]bool)
+	var refs []reference
+
+	add := func(a *common.Actors) {
+		for _, g := range []struct {
+			kind   string
+			values []string
+		}{
+			{"user", a.Users},
+			{"team", a.Teams},
+			{"organization", a.Organizations},
+		} {
+			for _, v := range g.values {
+				ref := reference{Kind: g.kind, Name: v}
+				if !seen[ref] {
+					seen[ref] = true
+					refs = append(refs, ref)
+				}
+			}
+		}
+	}
+
+	for _, r := range config.ApprovalRules {
+		if r == nil {
+			continue
+		}
+		add(&r.Requires.Actors)
+		if r.Predicates.HasAuthorIn != nil {
+			add(&r.Predicates.HasAuthorIn.Actors)
+		}
+		if r.Predicates.HasContributorIn != nil {
+			add(&r.Predicates.HasContributorIn.Actors)
+		}
+	}
+	if d := config.Policy.Disapproval; d != nil {
+		add(&d.Requires.Actors)
+	}
+	return refs
+}
+
+// referenceChecker checks that users, teams, and organizations exist on
+// GitHub. It caches results, so each name is only requested once.
+type referenceChecker struct {
+	ctx     context.Context
+	client  *github.Client
+	results map[string]string
+}
+
+// check returns a problem with a reference, or an empty string if it exists.
+func (c *referenceChecker) check(ref reference) string {
+	key := ref.Kind + ":" + strings.ToLower(ref.Name)
+	if msg, ok := c.results[key]; ok {
+		return msg
+	}
+
+	var err error
+	switch ref.Kind {
+	case "user":
+		_, _, err = c.client.Users.Get(c.ctx, ref.Name)
+	case "organization":
+		_, _, err = c.client.Organizations.Get(c.ctx, ref.Name)
+	case "team":
+		// the vendored client cannot get teams by slug
+		parts := strings.SplitN(ref.Name, "/", 2)
+		var req *http.Request
+		if req, err = c.client.NewRequest("GET", fmt.Sprintf("orgs/%s/teams/%s", parts[0], parts[1]), nil); err == nil {
+			_, err = c.client.Do(c.ctx, req, nil)
+		}
+	}
+
+	var msg string
+	if rerr, ok := err.(*github.ErrorResponse); ok && rerr.Response.StatusCode == http.StatusNotFound {
+		msg = fmt.Sprintf("%s %q does not exist or is not visible to the token", ref.Kind, ref.Name)
+	} else if err != nil {
+		msg = fmt.Sprintf("failed to check %s %q: %v", ref.Kind, ref.Name, err)
+	}
+	c.results[key] = msg
+	return msg
+}
+
+// lineIndex locates names in the lines of a policy file. The YAML decoder does
+// not report positions, so names are found by searching the text.
+type lineIndex []string
+
+func newLineIndex(b []byte) lineIndex {
+	return lineIndex(strings.Split(string(b), "\n"))
+}
+
+var quotedPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'[^']*'`)
+
+// locate returns a finding for a message. If the message names a rule, the
+// finding is on the line that defines the rule or, if there is no such line,
+// the first line that uses the name. Quoted strings in the message are tried
+// in order until one is found.
+func (l lineIndex) locate(severity, msg string) lintFinding {
+	f := lintFinding{Severity: severity, Message: msg}
+	for _, q := range quotedPattern.FindAllString(msg, -1) {
+		name := strings.Trim(q, "'")
+		if q[0] == '"' {
+			var err error
+			if name, err = strconv.Unquote(q); err != nil {
+				continue
+			}
+		}
+		if f.Line = l.rule(name); f.Line == 0 {
+			f.Line = l.value(name)
+		}
+		if f.Line > 0 {
+			break
+		}
+	}
+	return f
+}
+
+// rule returns the line that defines the rule with a name, or zero.
+func (l lineIndex) rule(name string) int {
+	re := regexp.MustCompile(`^\s*(?:-\s*)?name:\s*["']?` + regexp.QuoteMeta(name) + `["']?\s*(?:#.*)?$`)
+	return l.match(re)
+}
+
+// value returns the first line that contains a scalar value, or zero.
+func (l lineIndex) value(v string) int {
+	re := regexp.MustCompile(`(?:^|[\s\[,:-])["']?` + regexp.QuoteMeta(v) + `["']?\s*(?:$|[,\]#])`)
+	return l.match(re)
+}
+
+func (l lineIndex) match(re *regexp.Regexp) int {
+	for i, line := range l {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if re.MatchString(line) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func init() {
+	RootCmd.AddCommand(LintCmd)
+
+	LintCmd.Flags().BoolVar(&lintCmdConfig.Strict, "strict", false, "fail if there are warnings")
+	LintCmd.Flags().BoolVar(&lintCmdConfig.GitHub, "github", false, "check that users, teams, and organizations exist on GitHub")
+	LintCmd.Flags().StringVarP(&lintCmdConfig.Token, "token", "t", "", "GitHub token used with --github (default $GITHUB_TOKEN)")
+	LintCmd.Flags().StringVar(&lintCmdConfig.V3URL, "github-url", "https://api.github.com/", "base URL of the GitHub REST API")
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/policy-bot/policy/policytest"
+)
+
+var TestCmd = &cobra.Command{
+	Use:   "test suite-file...",
+	Short: "Tests a policy with synthetic pull requests.",
+	Long: "Evaluates the policy of each test suite against the synthetic pull requests of its test cases " +
+		"and compares the results to the expected outcomes, without contacting GitHub.",
+	Args: cobra.MinimumNArgs(1),
+
+	RunE: testCmd,
+}
+
+func testCmd(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+
+	var failed int
+	for _, path := range args {
+		fmt.Fprintf(out, "%s\n", path)
+
+		s, err := policytest.Load(path)
+		if err != nil {
+			return err
+		}
+
+		outcomes, err := s.Run(context.Background())
+		if err != nil {
+			return errors.WithMessage(err, path)
+		}
+		fmt.Fprintln(out, policytest.Format(outcomes))
+
+		for _, o := range outcomes {
+			if !o.Passed() {
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d test cases failed", failed)
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(TestCmd)
+}
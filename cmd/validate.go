@@ -0,0 +1,350 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+var validateCmdConfig struct {
+	Strict bool
+	Quiet  bool
+	Lint   bool
+}
+
+var ValidateCmd = &cobra.Command{
+	Use:   "validate [policy-file...]",
+	Short: "Validates policy files.",
+	Long: "Parses and lints policy files without contacting GitHub, printing errors, warnings, and " +
+		"the approval policy of each valid file. With --lint, it runs the lint command instead. " +
+		"If no files are given, .policy.yml is validated.",
+
+	RunE: validateCmd,
+}
+
+func validateCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{".policy.yml"}
+	}
+
+	if validateCmdConfig.Lint {
+		lintCmdConfig.Strict = lintCmdConfig.Strict || validateCmdConfig.Strict
+		return lintCmd(cmd, args)
+	}
+
+	out := cmd.OutOrStdout()
+
+	var failed int
+	for _, path := range args {
+		warnings, err := validatePolicyFile(out, path)
+		for _, w := range warnings {
+			fmt.Fprintf(out, "%s: warning: %s\n", path, w)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "%s: error: %v\n", path, err)
+		}
+		if err != nil || (validateCmdConfig.Strict && len(warnings) > 0) {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d policy files are invalid", failed, len(args))
+	}
+	return nil
+}
+
+// validatePolicyFile validates the policy at path and prints the approval
+// policy if it is valid. It returns warnings about valid but likely
+// unintended configuration.
+func validatePolicyFile(out io.Writer, path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read policy")
+	}
+
+	if err := policy.DefaultLimits.Check(b); err != nil {
+		return nil, err
+	}
+
+	if policy.IsRemoteConfig(b) {
+		remote, err := policy.ParseRemoteConfig(b)
+		if err != nil {
+			return nil, err
+		}
+		if !validateCmdConfig.Quiet {
+			fmt.Fprintf(out, "%s: references the policy in %s; validate that file instead\n", path, remote.Remote)
+		}
+		return nil, nil
+	}
+
+	config, err := policy.ParseConfigWithLimits(b, policy.DefaultLimits)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := policy.ParsePolicy(config); err != nil {
+		return nil, err
+	}
+
+	var upgrades []string
+	for _, c := range config.Upgrades {
+		upgrades = append(upgrades, fmt.Sprintf("legacy construct at %s; run 'policy-bot convert' to upgrade", c))
+	}
+
+	warnings, err := lintPolicy(config)
+	warnings = append(upgrades, warnings...)
+	if err != nil {
+		return warnings, err
+	}
+
+	if !validateCmdConfig.Quiet {
+		fmt.Fprintf(out, "%s: valid\n", path)
+		renderPolicy(out, config)
+	}
+	return warnings, nil
+}
+
+// lintPolicy checks parts of the policy that are only checked during
+// evaluation, like regular expressions, and looks for rules that are unused
+// or can never be approved.
+func lintPolicy(config *policy.Config) ([]string, error) {
+	var warnings []string
+
+	used := make(map[string]bool)
+	collectRuleNames(config.Policy.Approval, used)
+
+	seen := make(map[string]bool)
+	for _, r := range config.ApprovalRules {
+		if r == nil {
+			continue
+		}
+		if seen[r.Name] {
+			return warnings, errors.Errorf("rule %q is defined more than once", r.Name)
+		}
+		seen[r.Name] = true
+
+		if err := lintPredicates(&r.Predicates); err != nil {
+			return warnings, errors.WithMessage(err, fmt.Sprintf("invalid predicate in rule %q", r.Name))
+		}
+
+		if !used[r.Name] {
+			warnings = append(warnings, fmt.Sprintf("rule %q is not used by the approval policy", r.Name))
+		}
+		if r.Requires.Count > 0 && r.Requires.IsEmpty() && !r.Requires.Admins && !r.Requires.WriteCollaborators {
+			warnings = append(warnings, fmt.Sprintf("rule %q requires approval but does not allow any users to approve", r.Name))
+		}
+	}
+	return warnings, nil
+}
+
+func collectRuleNames(p interface{}, names map[string]bool) {
+	switch v := p.(type) {
+	case string:
+		names[v] = true
+	case approval.Policy:
+		for _, sub := range v {
+			collectRuleNames(sub, names)
+		}
+	case []interface{}:
+		for _, sub := range v {
+			collectRuleNames(sub, names)
+		}
+	case map[interface{}]interface{}:
+		for _, sub := range v {
+			collectRuleNames(sub, names)
+		}
+	}
+}
+
+func lintPredicates(p *approval.Predicates) error {
+	for _, pattern := range p.Patterns() {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return errors.Wrapf(err, "invalid pattern %q", pattern)
+		}
+	}
+
+	if p.HasLabels != nil {
+		for _, pattern := range *p.HasLabels {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return errors.Wrapf(err, "invalid label pattern %q", pattern)
+			}
+		}
+	}
+
+	if p.AuthorHasPermission != nil {
+		if err := p.AuthorHasPermission.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if p.ModifiedLines != nil {
+		for _, expr := range p.ModifiedLines.Expressions() {
+			if _, err := expr.Evaluate(0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderPolicy prints the approval policy as a tree with the requirements of
+// each rule. The implicit "and" of the top-level list is made explicit.
+func renderPolicy(out io.Writer, config *policy.Config) {
+	rules := make(map[string]*approval.Rule)
+	for _, r := range config.ApprovalRules {
+		if r != nil {
+			rules[r.Name] = r
+		}
+	}
+
+	if len(config.Policy.Approval) == 0 {
+		fmt.Fprintln(out, "  approval: no approval required")
+	} else {
+		fmt.Fprintln(out, "  approval:")
+		renderPolicyR(out, map[interface{}]interface{}{"and": []interface{}(config.Policy.Approval)}, rules, 2)
+	}
+
+	if d := config.Policy.Disapproval; d != nil && !d.Requires.IsEmpty() {
+		fmt.Fprintf(out, "  disapproval: %s\n", describeActors(&d.Requires.Actors))
+	} else {
+		fmt.Fprintln(out, "  disapproval: disabled")
+	}
+}
+
+func renderPolicyR(out io.Writer, p interface{}, rules map[string]*approval.Rule, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	switch v := p.(type) {
+	case string:
+		fmt.Fprintf(out, "%s- %q: %s\n", indent, v, describeRule(rules[v]))
+	case map[interface{}]interface{}:
+		for op, subs := range v {
+			label := "all of"
+			if op == "or" {
+				label = "any of"
+			}
+			fmt.Fprintf(out, "%s- %s:\n", indent, label)
+			subpolicies, _ := subs.([]interface{})
+			for _, sub := range subpolicies {
+				renderPolicyR(out, sub, rules, depth+1)
+			}
+		}
+	}
+}
+
+func describeRule(r *approval.Rule) string {
+	if r == nil {
+		return "undefined"
+	}
+
+	var desc string
+	switch {
+	case r.Requires.Count > 0:
+		desc = fmt.Sprintf("%d approval(s) from %s", r.Requires.Count, describeActors(&r.Requires.Actors))
+		if r.Requires.CodeOwners {
+			desc += " and code owners"
+		}
+	case r.Requires.CodeOwners:
+		desc = "approval from code owners"
+	default:
+		desc = "no approval required"
+	}
+
+	if r.Requires.SignedCommits {
+		desc += " and signed commits"
+	}
+
+	if preds := predicateNames(&r.Predicates); len(preds) > 0 {
+		desc += fmt.Sprintf(" (if %s)", strings.Join(preds, ", "))
+	}
+	return desc
+}
+
+func describeActors(a *common.Actors) string {
+	var parts []string
+	for _, g := range []struct {
+		name   string
+		values []string
+	}{
+		{"users", a.Users},
+		{"teams", a.Teams},
+		{"organizations", a.Organizations},
+		{"groups", a.Groups},
+	} {
+		if len(g.values) > 0 {
+			values := append([]string(nil), g.values...)
+			sort.Strings(values)
+			parts = append(parts, fmt.Sprintf("%s [%s]", g.name, strings.Join(values, ", ")))
+		}
+	}
+	if a.Admins {
+		parts = append(parts, "admins")
+	}
+	if a.WriteCollaborators {
+		parts = append(parts, "write collaborators")
+	}
+
+	if len(parts) == 0 {
+		return "nobody"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func predicateNames(p *approval.Predicates) []string {
+	var names []string
+	for name, set := range map[string]bool{
+		"changed_files":              p.ChangedFiles != nil,
+		"only_changed_files":         p.OnlyChangedFiles != nil,
+		"has_author_in":              p.HasAuthorIn != nil,
+		"has_contributor_in":         p.HasContributorIn != nil,
+		"author_is_only_contributor": p.AuthorIsOnlyContributor != nil,
+		"author_has_permission":      p.AuthorHasPermission != nil,
+		"targets_branch":             p.TargetsBranch != nil,
+		"has_labels":                 p.HasLabels != nil,
+		"title_matches":              p.TitleMatches != nil,
+		"body_matches":               p.BodyMatches != nil,
+		"modified_lines":             p.ModifiedLines != nil,
+		"modified_content":           p.ModifiedContent != nil,
+		"file_contents":              p.FileContents != nil,
+	} {
+		if set {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RootCmd.AddCommand(ValidateCmd)
+
+	ValidateCmd.Flags().BoolVar(&validateCmdConfig.Strict, "strict", false, "fail if there are warnings")
+	ValidateCmd.Flags().BoolVarP(&validateCmdConfig.Quiet, "quiet", "q", false, "only print errors and warnings")
+	ValidateCmd.Flags().BoolVar(&validateCmdConfig.Lint, "lint", false, "run the checks of the lint command instead")
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
 	"github.com/palantir/policy-bot/pull"
 )
 
@@ -33,6 +34,10 @@ type Rule struct {
 	Predicates Predicates `yaml:"if"`
 	Options    Options    `yaml:"options"`
 	Requires   Requires   `yaml:"requires"`
+
+	// Labels are added to a pull request while the rule is pending and
+	// removed once it is approved or skipped.
+	Labels []string `yaml:"labels"`
 }
 
 type Options struct {
@@ -41,6 +46,33 @@ type Options struct {
 	InvalidateOnPush   bool `yaml:"invalidate_on_push"`
 	IgnoreUpdateMerges bool `yaml:"ignore_update_merges"`
 
+	// AllowSuggester allows users whose only commits applied their own
+	// review suggestions to approve, even if contributors are not allowed.
+	AllowSuggester bool `yaml:"allow_suggester"`
+
+	// IgnoreAppliedSuggestions keeps approvals that would be invalidated by
+	// a push if the only new commits applied the approver's suggestions.
+	IgnoreAppliedSuggestions bool `yaml:"ignore_applied_suggestions"`
+
+	// RequireSigningKey only counts approvals by users who registered a
+	// verified GPG or SSH signing key with GitHub.
+	RequireSigningKey bool `yaml:"require_signing_key"`
+
+	// IgnoreUpstreamCommits ignores the commits of the upstream pull request
+	// of a stacked pull request. When the upstream pull request is squashed
+	// or rebased on merge, its original commits remain part of the stacked
+	// pull request until the stacked branch is rebased.
+	IgnoreUpstreamCommits bool `yaml:"ignore_upstream_commits"`
+
+	// ExpireApprovalsAfter ignores approvals that are older than the
+	// duration when the rule is evaluated. Zero disables expiration.
+	ExpireApprovalsAfter common.Duration `yaml:"expire_approvals_after"`
+
+	// RequestReview selects the users and teams that are requested to review
+	// a pull request while the rule is pending, if the server requests
+	// reviewers. By default, all of them are requested.
+	RequestReview *common.ReviewRequest `yaml:"request_review"`
+
 	Methods *common.Methods `yaml:"methods"`
 }
 
@@ -56,13 +88,34 @@ func (opts *Options) GetMethods() *common.Methods {
 		}
 	}
 
-	methods.GithubReviewState = pull.ReviewApproved
-	return methods
+	// copy the methods so that concurrent evaluations of the same rule do
+	// not modify shared state
+	m := *methods
+	m.GithubReviewState = pull.ReviewApproved
+	return &m
+}
+
+// AddComments adds patterns to the comments that approve for the rule, unless
+// the rule does not allow approval by comment.
+func (opts *Options) AddComments(patterns []string) {
+	if len(patterns) > 0 {
+		opts.Methods = opts.GetMethods().AddComments(patterns)
+	}
 }
 
 type Requires struct {
 	Count int `yaml:"count"`
 
+	// SignedCommits prevents approval while any commit does not have a valid
+	// signature. Commits ignored by the options of the rule are not checked.
+	SignedCommits bool `yaml:"signed_commits"`
+
+	// CodeOwners requires an approval from an owner of each changed file
+	// that has owners in the CODEOWNERS file of the base branch. Owners do
+	// not need to satisfy the other requirements and do not count toward
+	// Count.
+	CodeOwners bool `yaml:"codeowners"`
+
 	common.Actors `yaml:",inline"`
 }
 
@@ -71,10 +124,29 @@ func (r *Rule) Evaluate(ctx context.Context, prctx pull.Context) (res common.Res
 
 	res.Name = r.Name
 	res.Status = common.StatusSkipped
+	res.Labels = r.Labels
+	res.ReviewRequest = r.Options.RequestReview
 
-	for _, p := range r.Predicates.Predicates() {
+	predicates := r.Predicates.Predicates()
+	predicate.SortByCost(predicates)
+
+	// if the pull request is too large to evaluate a predicate or its data is
+	// unavailable, keep going: another predicate may still skip the rule
+	var tooLarge, unavailable error
+
+	for _, p := range predicates {
 		satisfied, desc, err := p.Evaluate(ctx, prctx)
 		if err != nil {
+			if pull.IsTooLarge(err) {
+				log.Debug().Err(err).Msgf("predicate of type %T is indeterminate", p)
+				tooLarge = err
+				continue
+			}
+			if pull.IsUnavailable(err) {
+				log.Debug().Err(err).Msgf("predicate of type %T is unknown", p)
+				unavailable = err
+				continue
+			}
 			res.Error = errors.Wrap(err, "failed to evaluate predicate")
 			return
 		}
@@ -84,20 +156,42 @@ func (r *Rule) Evaluate(ctx context.Context, prctx pull.Context) (res common.Res
 
 			res.Description = desc
 			if desc == "" {
-				res.Description = "The preconditions of this rule are not satisfied"
+				res.Describe(common.NewMessage(common.MessagePreconditions, nil))
 			}
 
 			return
 		}
 	}
 
-	approved, msg, err := r.IsApproved(ctx, prctx)
+	if tooLarge != nil {
+		res.Error = indeterminate(tooLarge)
+		return
+	}
+	if unavailable != nil {
+		res.Error = unknown(unavailable)
+		return
+	}
+
+	approved, msg, decisions, err := r.evaluateApprovals(ctx, prctx)
 	if err != nil {
+		if pull.IsTooLarge(err) {
+			res.Error = indeterminate(err)
+			return
+		}
+		if pull.IsUnavailable(err) {
+			res.Error = unknown(err)
+			return
+		}
 		res.Error = errors.Wrap(err, "failed to compute approval status")
 		return
 	}
 
-	res.Description = msg
+	res.Describe(msg)
+	res.Approvals = decisions
+	if r.Requires.Count > 0 {
+		res.Requires = &r.Requires.Actors
+		res.Required = r.Requires.Count
+	}
 	if approved {
 		res.Status = common.StatusApproved
 	} else {
@@ -106,42 +200,119 @@ func (r *Rule) Evaluate(ctx context.Context, prctx pull.Context) (res common.Res
 	return
 }
 
+// indeterminate returns the error of a rule that cannot be evaluated because
+// the pull request is too large. The error omits intermediate messages to
+// keep the explanation short, but has the same cause.
+func indeterminate(err error) error {
+	return errors.WithMessage(errors.Cause(err), "Indeterminate: pull request is too large")
+}
+
+// unknown returns the error of a rule that cannot be evaluated because a
+// GitHub API is unavailable. Like indeterminate, it omits intermediate
+// messages, but keeps the UnavailableError in the chain of causes.
+func unknown(err error) error {
+	return errors.WithMessage(pull.AsUnavailable(err), "Unknown")
+}
+
+// cost returns the relative cost of evaluating the rule, which is the cost of
+// the most expensive data it may load.
+func (r *Rule) cost() predicate.Cost {
+	cost := predicate.CostLocal
+	for _, p := range r.Predicates.Predicates() {
+		if c := predicate.CostOf(p); c > cost {
+			cost = c
+		}
+	}
+
+	if r.Requires.SignedCommits && predicate.CostCommits > cost {
+		cost = predicate.CostCommits
+	}
+	if r.Requires.Count > 0 || r.Requires.CodeOwners {
+		approvalCost := predicate.CostReviews
+		if !r.Options.AllowContributor || r.Options.InvalidateOnPush {
+			approvalCost = predicate.CostCommits
+		}
+		if approvalCost > cost {
+			cost = approvalCost
+		}
+	}
+	return cost
+}
+
 func (r *Rule) IsApproved(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	approved, msg, _, err := r.evaluateApprovals(ctx, prctx)
+	if msg == nil {
+		return approved, "", err
+	}
+	return approved, msg.String(), err
+}
+
+// evaluateApprovals is like IsApproved, but also returns a decision for each
+// approval candidate.
+func (r *Rule) evaluateApprovals(ctx context.Context, prctx pull.Context) (bool, *common.Message, []*common.ApprovalDecision, error) {
 	log := zerolog.Ctx(ctx)
 
-	if r.Requires.Count <= 0 {
+	if r.Requires.SignedCommits {
+		unsigned, err := r.unsignedCommit(prctx)
+		if err != nil {
+			return false, nil, nil, err
+		}
+		if unsigned != nil {
+			log.Debug().Msgf("commit %s does not have a valid signature", unsigned.SHA)
+			return false, unsignedMessage(unsigned), nil, nil
+		}
+	}
+
+	if r.Requires.Count <= 0 && !r.Requires.CodeOwners {
 		log.Debug().Msg("rule requires no approvals")
-		return true, "No approval required", nil
+		return true, common.NewMessage(common.MessageNoApprovalRequired, nil), nil, nil
 	}
 
 	candidates, err := r.Options.GetMethods().Candidates(ctx, prctx)
 	if err != nil {
-		return false, "", errors.Wrap(err, "failed to get approval candidates")
+		return false, nil, nil, errors.Wrap(err, "failed to get approval candidates")
 	}
 	sort.Stable(common.CandidatesByCreationTime(candidates))
 
-	if r.Options.InvalidateOnPush {
-		commits, err := r.filteredCommits(prctx)
-		if err != nil {
-			return false, "", err
-		}
+	var decisions []*common.ApprovalDecision
+	reject := func(c *common.Candidate, reason string) {
+		decisions = append(decisions, &common.ApprovalDecision{User: c.User, CreatedAt: c.CreatedAt, Reason: reason})
+	}
+
+	var expired int
+	if r.Options.ExpireApprovalsAfter > 0 && len(candidates) > 0 {
+		cutoff := time.Now().Add(-time.Duration(r.Options.ExpireApprovalsAfter))
 
-		last := findLastPushed(commits)
-		if last == nil {
-			return false, "", errors.New("no commit contained a push date")
+		var allowedCandidates []*common.Candidate
+		for _, candidate := range candidates {
+			if candidate.CreatedAt.Before(cutoff) {
+				reject(candidate, fmt.Sprintf("expired after %s", r.Options.ExpireApprovalsAfter))
+				expired++
+			} else {
+				allowedCandidates = append(allowedCandidates, candidate)
+			}
 		}
 
+		log.Debug().Msgf("discarded %d candidates older than %s", expired, r.Options.ExpireApprovalsAfter)
+
+		candidates = allowedCandidates
+	}
+
+	if r.Options.InvalidateOnPush && len(candidates) > 0 {
 		var allowedCandidates []*common.Candidate
 		for _, candidate := range candidates {
-			if candidate.CreatedAt.After(*last.PushedAt) {
+			pushed, err := r.invalidatingCommit(prctx, candidate)
+			if err != nil {
+				return false, nil, nil, err
+			}
+			if pushed == nil {
 				allowedCandidates = append(allowedCandidates, candidate)
+			} else {
+				reject(candidate, fmt.Sprintf("invalidated by push of %s", pushed.SHA))
 			}
 		}
 
-		log.Debug().Msgf("discarded %d candidates invalidated by push of %s at %s",
-			len(candidates)-len(allowedCandidates),
-			last.SHA,
-			last.PushedAt.Format(time.RFC3339))
+		log.Debug().Msgf("discarded %d candidates invalidated by pushes", len(candidates)-len(allowedCandidates))
 
 		candidates = allowedCandidates
 	}
@@ -159,13 +330,25 @@ func (r *Rule) IsApproved(ctx context.Context, prctx pull.Context) (bool, string
 	}
 
 	// "contributor" is any user who added a commit to the PR
-	if !r.Options.AllowContributor {
-		commits, err := r.filteredCommits(prctx)
+	// commits are only needed to check candidates, so skip loading them if
+	// there are none
+	if !r.Options.AllowContributor && len(candidates) > 0 {
+		commits, err := r.filteredCommits(prctx, false)
 		if err != nil {
-			return false, "", err
+			return false, nil, nil, err
+		}
+
+		var suggestions map[string]string
+		if r.Options.AllowSuggester {
+			if suggestions, err = appliedSuggestions(prctx, commits); err != nil {
+				return false, nil, nil, err
+			}
 		}
 
 		for _, c := range commits {
+			if _, ok := suggestions[c.SHA]; ok {
+				continue
+			}
 			for _, u := range c.Users() {
 				if u != author {
 					banned[u] = true
@@ -175,60 +358,269 @@ func (r *Rule) IsApproved(ctx context.Context, prctx pull.Context) (bool, string
 	}
 
 	// filter real approvers using banned status and required membership
+	// if code owners can approve, keep the other candidates to check later
 	var approvers []string
+	var ownerCandidates []*common.Candidate
 	for _, c := range candidates {
 		if banned[c.User] {
 			log.Debug().Str("user", c.User).Msg("rejecting approval by banned user")
+			if c.User == author {
+				reject(c, "user is the author")
+			} else {
+				reject(c, "user is a contributor")
+			}
 			continue
 		}
 
 		isApprover, err := r.Requires.IsActor(ctx, prctx, c.User)
 		if err != nil {
-			return false, "", errors.Wrap(err, "failed to check candidate status")
+			return false, nil, nil, errors.Wrap(err, "failed to check candidate status")
 		}
-		if !isApprover {
+		if !isApprover && !r.Requires.CodeOwners {
 			log.Debug().Str("user", c.User).Msg("ignoring approval by non-whitelisted user")
+			reject(c, "user does not satisfy the rule requirements")
+			continue
+		}
+
+		if r.Options.RequireSigningKey {
+			hasKey, err := prctx.HasVerifiedSigningKey(c.User)
+			if err != nil {
+				return false, nil, nil, errors.Wrap(err, "failed to check candidate signing keys")
+			}
+			if !hasKey {
+				log.Debug().Str("user", c.User).Msg("ignoring approval by user without a verified signing key")
+				reject(c, "user does not have a verified signing key")
+				continue
+			}
+		}
+
+		if !isApprover {
+			ownerCandidates = append(ownerCandidates, c)
 			continue
 		}
 
 		approvers = append(approvers, c.User)
+		decisions = append(decisions, &common.ApprovalDecision{User: c.User, CreatedAt: c.CreatedAt, Counted: true})
+	}
+
+	counted := approvers
+	var unapproved []string
+	if r.Requires.CodeOwners {
+		users := append([]string(nil), approvers...)
+		for _, c := range ownerCandidates {
+			users = append(users, c.User)
+		}
+
+		var owners map[string]bool
+		if unapproved, owners, err = codeOwnerApprovals(ctx, prctx, users); err != nil {
+			return false, nil, nil, err
+		}
+		log.Debug().Msgf("found %d files without code owner approval", len(unapproved))
+
+		for _, c := range ownerCandidates {
+			if !owners[c.User] {
+				log.Debug().Str("user", c.User).Msg("ignoring approval by user who is not a code owner")
+				reject(c, "user does not satisfy the rule requirements")
+				continue
+			}
+			counted = append(counted, c.User)
+			decisions = append(decisions, &common.ApprovalDecision{User: c.User, CreatedAt: c.CreatedAt, Counted: true})
+		}
 	}
 
 	log.Debug().Msgf("found %d/%d required approvers", len(approvers), r.Requires.Count)
 	remaining := r.Requires.Count - len(approvers)
 
+	if remaining <= 0 && len(unapproved) == 0 {
+		if len(counted) == 0 {
+			return true, common.NewMessage(common.MessageNoApprovalRequired, nil), decisions, nil
+		}
+		return true, common.NewMessage(common.MessageApprovedBy, map[string]interface{}{
+			"Approvers": strings.Join(counted, ", "),
+		}), decisions, nil
+	}
+
 	if remaining <= 0 {
-		msg := fmt.Sprintf("Approved by %s", strings.Join(approvers, ", "))
-		return true, msg, nil
+		return false, codeOwnersMessage(common.MessageCodeOwners, unapproved, nil), decisions, nil
 	}
 
-	if len(candidates) > 0 && len(approvers) == 0 {
-		msg := fmt.Sprintf("%d/%d approvals required. Ignored %s from disqualified users",
-			len(approvers),
-			r.Requires.Count,
-			numberOfApprovals(len(candidates)))
-		return false, msg, nil
+	// disqualified approvals are only mentioned if none counted
+	disqualified := 0
+	if len(candidates) > 0 && len(counted) == 0 {
+		disqualified = len(candidates)
 	}
+	return false, codeOwnersMessage(common.MessageApprovalsRequired, unapproved, map[string]interface{}{
+		"Approved":     len(approvers),
+		"Required":     r.Requires.Count,
+		"Disqualified": disqualified,
+		"Expired":      expired,
+		"ExpireAfter":  r.Options.ExpireApprovalsAfter.String(),
+	}), decisions, nil
+}
 
-	msg := fmt.Sprintf("%d/%d approvals required", len(approvers), r.Requires.Count)
-	return false, msg, nil
+// invalidatingCommit returns the commit whose push invalidated a candidate,
+// or nil if the candidate is still valid.
+//
+// Reviews record the commit they approved, so they are compared by commit
+// order: a review is valid if every commit considered by the rule is the
+// approved commit or one of its ancestors. This avoids pushed dates, which
+// GitHub does not always provide and which may be skewed relative to the
+// review time. Comments do not record a commit, so they are valid if they
+// were created after the last considered commit was pushed.
+func (r *Rule) invalidatingCommit(prctx pull.Context, c *common.Candidate) (*pull.Commit, error) {
+	if c.CommitSHA != "" {
+		all, err := prctx.Commits()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list commits")
+		}
+
+		filtered, err := r.filterCommits(prctx, all)
+		if err != nil {
+			return nil, err
+		}
+
+		considered, err := r.withoutSuggestionsBy(prctx, filtered, c.User)
+		if err != nil {
+			return nil, err
+		}
+		return lastUnapprovedCommit(all, considered, c.CommitSHA), nil
+	}
+
+	commits, err := r.filteredCommits(prctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	considered, err := r.withoutSuggestionsBy(prctx, commits, c.User)
+	if err != nil {
+		return nil, err
+	}
+	if len(considered) == 0 {
+		return nil, nil
+	}
+
+	last := findLastPushed(considered)
+	if last == nil {
+		// only the head commit is guaranteed to have a pushed date, so if it
+		// applied suggestions, the other commits cannot be compared to the
+		// comment and the approval is conservatively invalidated
+		if len(considered) < len(commits) {
+			return considered[len(considered)-1], nil
+		}
+		return nil, errors.New("no commit contained a push date")
+	}
+	if c.CreatedAt.After(*last.PushedAt) {
+		return nil, nil
+	}
+	return last, nil
+}
+
+// lastUnapprovedCommit returns the last of the considered commits that is not
+// the approved commit or one of its ancestors in the pull request.
+func lastUnapprovedCommit(all, considered []*pull.Commit, approved string) *pull.Commit {
+	contained := ancestors(all, approved)
+	for i := len(considered) - 1; i >= 0; i-- {
+		if !contained[considered[i].SHA] {
+			return considered[i]
+		}
+	}
+	return nil
+}
+
+// ancestors returns the SHAs of a commit and its ancestors in a list of
+// commits. The traversal stops at commits that are not in the list.
+func ancestors(commits []*pull.Commit, sha string) map[string]bool {
+	parents := make(map[string][]string, len(commits))
+	for _, c := range commits {
+		parents[c.SHA] = c.Parents
+	}
+
+	contained := make(map[string]bool)
+	queue := []string{sha}
+	for len(queue) > 0 {
+		sha := queue[0]
+		queue = queue[1:]
+		if !contained[sha] {
+			contained[sha] = true
+			queue = append(queue, parents[sha]...)
+		}
+	}
+	return contained
+}
+
+// filteredCommits returns the commits considered by the rule. Pushed dates are
+// only loaded if requested, because loading them can require extra requests.
+func (r *Rule) filteredCommits(prctx pull.Context, pushedDates bool) ([]*pull.Commit, error) {
+	loadCommits := prctx.Commits
+	if pushedDates {
+		loadCommits = prctx.CommitsWithPushedDates
+	}
+
+	commits, err := loadCommits()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list commits")
+	}
+	return r.filterCommits(prctx, commits)
 }
 
-func (r *Rule) filteredCommits(prctx pull.Context) ([]*pull.Commit, error) {
+// unsignedCommit returns the first commit considered by the rule that does not
+// have a valid signature, or nil if all commits are signed.
+func (r *Rule) unsignedCommit(prctx pull.Context) (*pull.Commit, error) {
 	commits, err := prctx.Commits()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to list commits")
 	}
 
-	needsFiltering := r.Options.IgnoreUpdateMerges
+	filtered, err := r.filterCommits(prctx, commits)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range filtered {
+		if c.Signature == nil || !c.Signature.Valid {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+func unsignedMessage(c *pull.Commit) *common.Message {
+	sha := c.SHA
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+	if c.Signature == nil {
+		return common.NewMessage(common.MessageUnsignedCommit, map[string]interface{}{"SHA": sha})
+	}
+	return common.NewMessage(common.MessageInvalidSignature, map[string]interface{}{
+		"SHA":   sha,
+		"State": strings.ToLower(c.Signature.State),
+	})
+}
+
+// filterCommits removes commits the rule ignores from a list of commits.
+func (r *Rule) filterCommits(prctx pull.Context, commits []*pull.Commit) ([]*pull.Commit, error) {
+	needsFiltering := r.Options.IgnoreUpdateMerges || r.Options.IgnoreUpstreamCommits
 	if !needsFiltering {
 		return commits, nil
 	}
 
+	var upstream map[string]bool
+	if r.Options.IgnoreUpstreamCommits {
+		u, err := prctx.Upstream()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load upstream pull request")
+		}
+		if u != nil {
+			upstream = ancestors(commits, u.HeadSHA)
+		}
+	}
+
 	var filtered []*pull.Commit
 	for _, c := range commits {
 		switch {
-		case isUpdateMerge(commits, c):
+		case r.Options.IgnoreUpdateMerges && isUpdateMerge(commits, c):
+		case upstream[c.SHA]:
 		default:
 			filtered = append(filtered, c)
 		}
@@ -257,6 +649,69 @@ func isUpdateMerge(commits []*pull.Commit, c *pull.Commit) bool {
 	return shas[c.Parents[0]] && !shas[c.Parents[1]]
 }
 
+// withoutSuggestionsBy removes commits that applied the suggestions of user
+// from a list of commits, if the rule ignores applied suggestions.
+func (r *Rule) withoutSuggestionsBy(prctx pull.Context, commits []*pull.Commit, user string) ([]*pull.Commit, error) {
+	if !r.Options.IgnoreAppliedSuggestions {
+		return commits, nil
+	}
+
+	suggestions, err := appliedSuggestions(prctx, commits)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []*pull.Commit
+	for _, c := range commits {
+		if suggestions[c.SHA] != user {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered, nil
+}
+
+// suggestionMessagePrefix starts the default message of commits created by
+// applying review suggestions in the GitHub web interface.
+const suggestionMessagePrefix = "Apply suggestion"
+
+// appliedSuggestions returns the login of the user who made the suggestions
+// applied by each commit, keyed by commit SHA. A commit applied suggestions
+// if it was created in the web interface with the default message, has a
+// single parent, is authored by a user other than the author of the pull
+// request, and that user reviewed the pull request before the commit was
+// created. Reviews are only loaded if a commit may have applied suggestions.
+func appliedSuggestions(prctx pull.Context, commits []*pull.Commit) (map[string]string, error) {
+	var possible []*pull.Commit
+	for _, c := range commits {
+		switch {
+		case !c.CommittedViaWeb, len(c.Parents) != 1:
+		case c.Author == "", c.Author == prctx.Author():
+		case !strings.HasPrefix(c.MessageHeadline, suggestionMessagePrefix):
+		default:
+			possible = append(possible, c)
+		}
+	}
+	if len(possible) == 0 {
+		return nil, nil
+	}
+
+	reviews, err := prctx.Reviews()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list reviews")
+	}
+
+	suggestions := make(map[string]string)
+	for _, c := range possible {
+		for _, r := range reviews {
+			if r.Author == c.Author && r.CreatedAt.Before(c.CommittedAt) {
+				suggestions[c.SHA] = c.Author
+				break
+			}
+		}
+	}
+	return suggestions, nil
+}
+
 func findLastPushed(commits []*pull.Commit) *pull.Commit {
 	var last *pull.Commit
 	for _, c := range commits {
@@ -266,10 +721,3 @@ func findLastPushed(commits []*pull.Commit) *pull.Commit {
 	}
 	return last
 }
-
-func numberOfApprovals(count int) string {
-	if count == 1 {
-		return "1 approval"
-	}
-	return fmt.Sprintf("%d approvals", count)
-}
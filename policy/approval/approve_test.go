@@ -16,6 +16,7 @@ package approval
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
 	"time"
@@ -25,6 +26,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
 	"github.com/palantir/policy-bot/pull"
 	"github.com/palantir/policy-bot/pull/pulltest"
 )
@@ -147,6 +149,23 @@ func TestIsApproved(t *testing.T) {
 		assertPending(t, prctx, r, "0/1 approvals required. Ignored 5 approvals from disqualified users")
 	})
 
+	t.Run("noCandidatesSkipsCommits", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommentsValue = nil
+		prctx.ReviewsValue = nil
+		prctx.CommitsError = errors.New("commits should not be loaded")
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+			},
+			Options: Options{
+				InvalidateOnPush: true,
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required")
+	})
+
 	t.Run("authorCannotApprove", func(t *testing.T) {
 		prctx := basePullContext()
 		r := &Rule{
@@ -305,6 +324,71 @@ func TestIsApproved(t *testing.T) {
 		assertPending(t, prctx, r, "0/1 approvals required")
 	})
 
+	t.Run("invalidateReviewOnPushByCommit", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommentsValue = nil
+		for _, c := range prctx.CommitsValue {
+			c.PushedAt = nil
+		}
+		prctx.CommitsValue[1].Parents = []string{prctx.CommitsValue[0].SHA}
+		prctx.CommitsValue[2].Parents = []string{prctx.CommitsValue[1].SHA}
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"review-approver"},
+				},
+			},
+			Options: Options{
+				InvalidateOnPush: true,
+			},
+		}
+
+		// reviewed the head commit: valid, even though pushed dates are missing
+		prctx.ReviewsValue[1].CommitSHA = "97d5ea26da319a987d80f6db0b7ef759f2f2e441"
+		assertApproved(t, prctx, r, "Approved by review-approver")
+
+		// reviewed an earlier commit: invalidated by later commits
+		prctx.ReviewsValue[1].CommitSHA = "674832587eaaf416371b30f5bc5a47e377f534ec"
+		assertPending(t, prctx, r, "0/1 approvals required")
+
+		// reviewed a commit that was force-pushed away
+		prctx.ReviewsValue[1].CommitSHA = "0c2bbc8c5ba5a5fdba8ef8e3a27b6e2e9e7ba45c"
+		assertPending(t, prctx, r, "0/1 approvals required")
+	})
+
+	t.Run("ignoreUpdateMergeAfterReviewByCommit", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommitsValue = append(prctx.CommitsValue[:1], &pull.Commit{
+			SHA:             "647c5078288f0ea9de27b5c280f25edaf2089045",
+			CommittedViaWeb: true,
+			Parents: []string{
+				"c6ade256ecfc755d8bc877ef22cc9e01745d46bb",
+				"2e1b0bb6ab144bf7a1b7a1df9d3bdcb0fe85a206",
+			},
+			Author: "merge-committer",
+		})
+		prctx.CommentsValue = nil
+		prctx.ReviewsValue[1].CommitSHA = "c6ade256ecfc755d8bc877ef22cc9e01745d46bb"
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"review-approver"},
+				},
+			},
+			Options: Options{
+				InvalidateOnPush: true,
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required")
+
+		r.Options.IgnoreUpdateMerges = true
+		assertApproved(t, prctx, r, "Approved by review-approver")
+	})
+
 	t.Run("ignoreUpdateMergeAfterReview", func(t *testing.T) {
 		prctx := basePullContext()
 		prctx.CommitsValue = append(prctx.CommitsValue[:1], &pull.Commit{
@@ -366,6 +450,486 @@ func TestIsApproved(t *testing.T) {
 		r.Options.IgnoreUpdateMerges = true
 		assertApproved(t, prctx, r, "Approved by merge-committer")
 	})
+
+	t.Run("requireSigningKey", func(t *testing.T) {
+		prctx := basePullContext()
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Organizations: []string{"cool-org", "even-cooler-org"},
+				},
+			},
+			Options: Options{
+				RequireSigningKey: true,
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required. Ignored 5 approvals from disqualified users")
+
+		prctx.SigningKeys = []string{"review-approver"}
+		assertApproved(t, prctx, r, "Approved by review-approver")
+
+		prctx.SigningKeyError = errors.New("keys unavailable")
+		_, _, err := r.IsApproved(ctx, prctx)
+		assert.Error(t, err)
+	})
+
+	suggestionCommit := func(author, message string) *pull.Commit {
+		return &pull.Commit{
+			PushedAt:        newTime(now.Add(90 * time.Second)),
+			CommittedAt:     now.Add(90 * time.Second),
+			SHA:             "5b1e3bbf4d6e0e3f4a0f7e1cfa9e4cc0f8f5d2a1",
+			CommittedViaWeb: true,
+			Parents:         []string{"97d5ea26da319a987d80f6db0b7ef759f2f2e441"},
+			Author:          author,
+			Committer:       "web-flow",
+			MessageHeadline: message,
+		}
+	}
+
+	t.Run("allowSuggester", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommitsValue = append(prctx.CommitsValue, suggestionCommit("review-approver", "Apply suggestions from code review"))
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"review-approver"},
+				},
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required. Ignored 5 approvals from disqualified users")
+
+		r.Options.AllowSuggester = true
+		assertApproved(t, prctx, r, "Approved by review-approver")
+
+		// commits with other messages are normal contributions
+		prctx.CommitsValue[3].MessageHeadline = "Update README.md"
+		assertPending(t, prctx, r, "0/1 approvals required. Ignored 5 approvals from disqualified users")
+	})
+
+	t.Run("allowSuggesterRequiresEarlierReview", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommitsValue = append(prctx.CommitsValue, suggestionCommit("review-approver", "Apply suggestions from code review"))
+		prctx.CommitsValue[3].CommittedAt = now.Add(75 * time.Second)
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"review-approver"},
+				},
+			},
+			Options: Options{
+				AllowSuggester: true,
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required. Ignored 5 approvals from disqualified users")
+	})
+
+	t.Run("ignoreAppliedSuggestionsAfterReview", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommitsValue = append(prctx.CommitsValue, suggestionCommit("review-approver", "Apply suggestion from code review"))
+		prctx.CommentsValue = nil
+		prctx.CommitsValue[1].Parents = []string{prctx.CommitsValue[0].SHA}
+		prctx.CommitsValue[2].Parents = []string{prctx.CommitsValue[1].SHA}
+		prctx.ReviewsValue[1].CommitSHA = "97d5ea26da319a987d80f6db0b7ef759f2f2e441"
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"review-approver"},
+				},
+			},
+			Options: Options{
+				AllowSuggester:   true,
+				InvalidateOnPush: true,
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required")
+
+		r.Options.IgnoreAppliedSuggestions = true
+		assertApproved(t, prctx, r, "Approved by review-approver")
+
+		// suggestions by other users still invalidate the approval
+		prctx.CommitsValue[3].Author = "disapprover"
+		r.Options.AllowContributor = true
+		assertPending(t, prctx, r, "0/1 approvals required")
+	})
+
+	t.Run("ignoreUpstreamCommits", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.CommitsValue[1].Parents = []string{prctx.CommitsValue[0].SHA}
+		prctx.CommitsValue[2].Parents = []string{prctx.CommitsValue[1].SHA}
+		prctx.UpstreamValue = &pull.Upstream{
+			Number:  120,
+			HeadSHA: "674832587eaaf416371b30f5bc5a47e377f534ec",
+			Base:    "develop",
+			Merged:  true,
+		}
+
+		r := &Rule{
+			Requires: Requires{
+				Count: 1,
+				Actors: common.Actors{
+					Users: []string{"contributor-author"},
+				},
+			},
+		}
+		assertPending(t, prctx, r, "0/1 approvals required. Ignored 5 approvals from disqualified users")
+
+		r.Options.IgnoreUpstreamCommits = true
+		assertApproved(t, prctx, r, "Approved by contributor-author")
+
+		prctx.UpstreamError = errors.New("upstream unavailable")
+		_, _, err := r.IsApproved(ctx, prctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("signedCommits", func(t *testing.T) {
+		prctx := basePullContext()
+		r := &Rule{
+			Requires: Requires{
+				Count:         1,
+				SignedCommits: true,
+				Actors: common.Actors{
+					Organizations: []string{"cool-org"},
+				},
+			},
+		}
+		assertPending(t, prctx, r, "Commit c6ade25 is not signed")
+
+		for _, c := range prctx.CommitsValue {
+			c.Signature = &pull.Signature{Type: "GPG", Valid: true, State: "VALID", Signer: c.Committer}
+		}
+		assertApproved(t, prctx, r, "Approved by comment-approver")
+
+		prctx.CommitsValue[2].Signature = &pull.Signature{Type: "GPG", State: "UNKNOWN_KEY"}
+		assertPending(t, prctx, r, "Commit 97d5ea2 does not have a valid signature (unknown_key)")
+
+		// signatures are required even if no approval is
+		r.Requires.Count = 0
+		assertPending(t, prctx, r, "Commit 97d5ea2 does not have a valid signature (unknown_key)")
+
+		prctx.CommitsError = errors.New("commits unavailable")
+		_, _, err := r.IsApproved(ctx, prctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("codeOwners", func(t *testing.T) {
+		prctx := basePullContext()
+		prctx.ChangedFilesValue = []*pull.File{
+			{Filename: "docs/README.md", Status: pull.FileModified},
+			{Filename: "server/app.go", Status: pull.FileModified},
+			{Filename: "server/vendor/lib.go", Status: pull.FileAdded},
+			{Filename: "Makefile", Status: pull.FileModified},
+		}
+		prctx.BaseFileContents = map[string]string{
+			".github/CODEOWNERS": "/server/ @review-approver\n/server/vendor/\n/docs/ @alice\n",
+		}
+
+		r := &Rule{
+			Requires: Requires{
+				CodeOwners: true,
+			},
+		}
+		assertPending(t, prctx, r, "Waiting for approval from the code owners of docs/README.md")
+
+		prctx.BaseFileContents[".github/CODEOWNERS"] = "/server/ @review-approver\n/server/vendor/\n/docs/ @alice @comment-approver\n"
+		assertApproved(t, prctx, r, "Approved by comment-approver, review-approver")
+
+		// owners are required in addition to the count
+		r.Requires.Count = 2
+		r.Requires.Organizations = []string{"cool-org"}
+		assertPending(t, prctx, r, "1/2 approvals required")
+
+		r.Requires.Count = 1
+		prctx.BaseFileContents[".github/CODEOWNERS"] = "* docs@example.com\n/server/ @review-approver\n"
+		assertPending(t, prctx, r, "Waiting for approval from the code owners of docs/README.md and 1 other file")
+
+		// the first CODEOWNERS location wins
+		prctx.BaseFileContents["CODEOWNERS"] = "* @nobody\n"
+		prctx.BaseFileContents[".github/CODEOWNERS"] = "*.go @review-approver\n"
+		assertApproved(t, prctx, r, "Approved by comment-approver, review-approver")
+
+		prctx.BaseFileContents = nil
+		assertApproved(t, prctx, r, "Approved by comment-approver")
+
+		r.Requires.Count = 0
+		r.Requires.Organizations = nil
+		assertApproved(t, prctx, r, "No approval required")
+
+		prctx.BaseFileContentError = errors.New("contents unavailable")
+		_, _, err := r.IsApproved(ctx, prctx)
+		assert.Error(t, err)
+	})
+}
+
+func TestApprovalDecisions(t *testing.T) {
+	logger := zerolog.New(os.Stdout)
+	ctx := logger.WithContext(context.Background())
+
+	now := time.Now()
+	prctx := &pulltest.Context{
+		AuthorValue: "mhaypenny",
+		CommentsValue: []*pull.Comment{
+			{
+				CreatedAt: now.Add(10 * time.Second),
+				Author:    "early-approver",
+				Body:      ":+1:",
+			},
+			{
+				CreatedAt: now.Add(30 * time.Second),
+				Author:    "mhaypenny",
+				Body:      ":+1:",
+			},
+			{
+				CreatedAt: now.Add(40 * time.Second),
+				Author:    "outsider",
+				Body:      ":+1:",
+			},
+			{
+				CreatedAt: now.Add(50 * time.Second),
+				Author:    "comment-approver",
+				Body:      ":+1:",
+			},
+		},
+		CommitsValue: []*pull.Commit{
+			{
+				PushedAt:  newTime(now.Add(20 * time.Second)),
+				SHA:       "c6ade256ecfc755d8bc877ef22cc9e01745d46bb",
+				Author:    "mhaypenny",
+				Committer: "mhaypenny",
+			},
+		},
+		OrgMemberships: map[string][]string{
+			"mhaypenny":        {"everyone"},
+			"early-approver":   {"everyone"},
+			"comment-approver": {"everyone"},
+		},
+	}
+
+	r := &Rule{
+		Options: Options{
+			InvalidateOnPush: true,
+		},
+		Requires: Requires{
+			Count: 1,
+			Actors: common.Actors{
+				Organizations: []string{"everyone"},
+			},
+		},
+	}
+
+	res := r.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusApproved, res.Status)
+	require.NotNil(t, res.Requires)
+	assert.Equal(t, []string{"everyone"}, res.Requires.Organizations)
+	assert.Equal(t, 1, res.Required)
+
+	decisions := make(map[string]*common.ApprovalDecision)
+	for _, d := range res.Approvals {
+		decisions[d.User] = d
+	}
+	require.Len(t, decisions, 4)
+
+	assert.False(t, decisions["early-approver"].Counted)
+	assert.Equal(t, "invalidated by push of c6ade256ecfc755d8bc877ef22cc9e01745d46bb", decisions["early-approver"].Reason)
+
+	assert.False(t, decisions["mhaypenny"].Counted)
+	assert.Equal(t, "user is the author", decisions["mhaypenny"].Reason)
+
+	assert.False(t, decisions["outsider"].Counted)
+	assert.Equal(t, "user does not satisfy the rule requirements", decisions["outsider"].Reason)
+
+	assert.True(t, decisions["comment-approver"].Counted)
+	assert.Empty(t, decisions["comment-approver"].Reason)
+}
+
+func TestApprovalExpiration(t *testing.T) {
+	logger := zerolog.New(os.Stdout)
+	ctx := logger.WithContext(context.Background())
+
+	now := time.Now()
+	prctx := &pulltest.Context{
+		AuthorValue: "mhaypenny",
+		CommentsValue: []*pull.Comment{
+			{
+				CreatedAt: now.Add(-20 * 24 * time.Hour),
+				Author:    "old-approver",
+				Body:      ":+1:",
+			},
+			{
+				CreatedAt: now.Add(-time.Hour),
+				Author:    "comment-approver",
+				Body:      ":+1:",
+			},
+		},
+		CommitsValue: []*pull.Commit{
+			{
+				PushedAt:  newTime(now.Add(-30 * 24 * time.Hour)),
+				SHA:       "c6ade256ecfc755d8bc877ef22cc9e01745d46bb",
+				Author:    "mhaypenny",
+				Committer: "mhaypenny",
+			},
+		},
+	}
+
+	r := &Rule{
+		Options: Options{
+			ExpireApprovalsAfter: common.Duration(14 * 24 * time.Hour),
+		},
+		Requires: Requires{
+			Count: 1,
+			Actors: common.Actors{
+				Users: []string{"old-approver"},
+			},
+		},
+	}
+
+	res := r.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusPending, res.Status)
+	assert.Equal(t, "0/1 approvals required. Ignored 1 approval from disqualified users. Ignored 1 approval older than 14d", res.Description)
+	require.Len(t, res.Approvals, 2)
+	assert.Equal(t, "old-approver", res.Approvals[0].User)
+	assert.False(t, res.Approvals[0].Counted)
+	assert.Equal(t, "expired after 14d", res.Approvals[0].Reason)
+
+	r.Requires.Users = []string{"old-approver", "comment-approver"}
+	res = r.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusApproved, res.Status)
+	assert.Equal(t, "Approved by comment-approver", res.Description)
+
+	r.Options.ExpireApprovalsAfter = 0
+	r.Requires.Users = []string{"old-approver"}
+	res = r.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusApproved, res.Status)
+}
+
+func TestRuleLabels(t *testing.T) {
+	ctx := context.Background()
+	prctx := &pulltest.Context{
+		AuthorValue: "mhaypenny",
+	}
+
+	r := &Rule{
+		Name: "security",
+		Requires: Requires{
+			Count: 1,
+			Actors: common.Actors{
+				Users: []string{"security-reviewer"},
+			},
+		},
+		Labels: []string{"needs-security-review"},
+	}
+
+	res := r.Evaluate(ctx, prctx)
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusPending, res.Status)
+	assert.Equal(t, []string{"needs-security-review"}, res.Labels)
+}
+
+func TestRuleTooLarge(t *testing.T) {
+	ctx := context.Background()
+	tooLarge := &pull.TooLargeError{Kind: "files", Max: 300}
+
+	newRule := func() *Rule {
+		return &Rule{
+			Name: "docs",
+			Predicates: Predicates{
+				ChangedFiles: &predicate.ChangedFiles{
+					Paths: []string{"docs/.*"},
+				},
+				AuthorIsOnlyContributor: authorIsOnlyContributor(true),
+			},
+		}
+	}
+
+	t.Run("indeterminate", func(t *testing.T) {
+		prctx := &pulltest.Context{
+			AuthorValue:       "mhaypenny",
+			ChangedFilesError: tooLarge,
+			CommitsValue: []*pull.Commit{
+				{SHA: "c6ade256ecfc755d8bc877ef22cc9e01745d46bb", Author: "mhaypenny", Committer: "mhaypenny"},
+			},
+		}
+
+		res := newRule().Evaluate(ctx, prctx)
+		require.Error(t, res.Error)
+		assert.True(t, pull.IsTooLarge(res.Error), "error is not a TooLargeError")
+		assert.EqualError(t, res.Error, "Indeterminate: pull request is too large: too many files in pull request, maximum is 300")
+	})
+
+	t.Run("skippedByOtherPredicate", func(t *testing.T) {
+		prctx := &pulltest.Context{
+			AuthorValue:       "mhaypenny",
+			ChangedFilesError: tooLarge,
+			CommitsValue: []*pull.Commit{
+				{SHA: "c6ade256ecfc755d8bc877ef22cc9e01745d46bb", Author: "contributor", Committer: "contributor"},
+			},
+		}
+
+		res := newRule().Evaluate(ctx, prctx)
+		require.NoError(t, res.Error)
+		assert.Equal(t, common.StatusSkipped, res.Status)
+	})
+}
+
+func TestRuleUnknown(t *testing.T) {
+	ctx := context.Background()
+	unavailable := &pull.UnavailableError{API: "REST", Err: errors.New("502 Bad Gateway")}
+
+	newRule := func() *Rule {
+		return &Rule{
+			Name: "docs",
+			Predicates: Predicates{
+				ChangedFiles: &predicate.ChangedFiles{
+					Paths: []string{"docs/.*"},
+				},
+				AuthorIsOnlyContributor: authorIsOnlyContributor(true),
+			},
+		}
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		prctx := &pulltest.Context{
+			AuthorValue:       "mhaypenny",
+			ChangedFilesError: unavailable,
+			CommitsValue: []*pull.Commit{
+				{SHA: "c6ade256ecfc755d8bc877ef22cc9e01745d46bb", Author: "mhaypenny", Committer: "mhaypenny"},
+			},
+		}
+
+		res := newRule().Evaluate(ctx, prctx)
+		require.Error(t, res.Error)
+		assert.True(t, pull.IsUnavailable(res.Error), "error is not an UnavailableError")
+		assert.EqualError(t, res.Error, "Unknown: GitHub REST API is unavailable: 502 Bad Gateway")
+	})
+
+	t.Run("skippedByOtherPredicate", func(t *testing.T) {
+		prctx := &pulltest.Context{
+			AuthorValue:       "mhaypenny",
+			ChangedFilesError: unavailable,
+			CommitsValue: []*pull.Commit{
+				{SHA: "c6ade256ecfc755d8bc877ef22cc9e01745d46bb", Author: "contributor", Committer: "contributor"},
+			},
+		}
+
+		res := newRule().Evaluate(ctx, prctx)
+		require.NoError(t, res.Error)
+		assert.Equal(t, common.StatusSkipped, res.Status)
+	})
+}
+
+func authorIsOnlyContributor(b bool) *predicate.AuthorIsOnlyContributor {
+	p := predicate.AuthorIsOnlyContributor(b)
+	return &p
 }
 
 func newTime(t time.Time) *time.Time {
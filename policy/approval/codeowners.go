@@ -0,0 +1,155 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approval
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/codeowners"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// ownerEntry is a CODEOWNERS entry with its pattern compiled and its owners
+// converted to actors. Owners that policies cannot refer to, like email
+// addresses, are dropped, so an entry may have owners but no actors.
+type ownerEntry struct {
+	pattern   *regexp.Regexp
+	hasOwners bool
+	actors    common.Actors
+}
+
+// loadCodeOwners loads the CODEOWNERS file from the base branch, so that pull
+// requests cannot change their own owners. It returns nil if the repository
+// does not have a CODEOWNERS file.
+func loadCodeOwners(ctx context.Context, prctx pull.Context) ([]ownerEntry, error) {
+	log := zerolog.Ctx(ctx)
+
+	for _, path := range codeowners.Paths {
+		content, err := prctx.BaseFileContent(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load %s", path)
+		}
+		if content == nil {
+			continue
+		}
+
+		f, err := codeowners.Parse(bytes.NewReader(content))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", path)
+		}
+
+		// like GitHub, ignore invalid lines instead of rejecting the file
+		var entries []ownerEntry
+		for _, e := range f.Entries {
+			re, err := e.Regexp()
+			if err != nil {
+				log.Debug().Err(err).Msgf("ignoring %s line %d", path, e.Line)
+				continue
+			}
+
+			entry := ownerEntry{pattern: regexp.MustCompile(re), hasOwners: len(e.Owners) > 0}
+			for _, o := range e.Owners {
+				owner, err := codeowners.ParseOwner(o)
+				switch {
+				case err != nil:
+					log.Debug().Err(err).Msgf("ignoring owner on %s line %d", path, e.Line)
+				case owner.User != "":
+					entry.actors.Users = append(entry.actors.Users, owner.User)
+				default:
+					entry.actors.Teams = append(entry.actors.Teams, owner.Team)
+				}
+			}
+			entries = append(entries, entry)
+		}
+		return entries, nil
+	}
+	return nil, nil
+}
+
+// codeOwnerApprovals checks that each changed file with owners is approved by
+// at least one of its owners among users. It returns the files that are not
+// approved, in the order of the changed files, and the users who approved as
+// owners. When multiple entries match a file, the last entry determines the
+// owners.
+func codeOwnerApprovals(ctx context.Context, prctx pull.Context, users []string) ([]string, map[string]bool, error) {
+	entries, err := loadCodeOwners(ctx, prctx)
+	if err != nil || len(entries) == 0 {
+		return nil, nil, err
+	}
+
+	files, err := prctx.ChangedFiles()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list changed files")
+	}
+
+	var unapproved []string
+	owners := make(map[string]bool)
+	approved := make(map[int]bool)
+
+	for _, f := range files {
+		i := lastMatch(entries, f.Filename)
+		if i < 0 || !entries[i].hasOwners {
+			continue
+		}
+
+		ok, checked := approved[i]
+		if !checked {
+			for _, user := range users {
+				isOwner, err := entries[i].actors.IsActor(ctx, prctx, user)
+				if err != nil {
+					return nil, nil, errors.Wrap(err, "failed to check code owner status")
+				}
+				if isOwner {
+					owners[user] = true
+					ok = true
+				}
+			}
+			approved[i] = ok
+		}
+		if !ok {
+			unapproved = append(unapproved, f.Filename)
+		}
+	}
+	return unapproved, owners, nil
+}
+
+func lastMatch(entries []ownerEntry, filename string) int {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].pattern.MatchString(filename) {
+			return i
+		}
+	}
+	return -1
+}
+
+// codeOwnersMessage returns the message with the given ID and args, adding
+// the first file that is waiting for approval from its code owners and the
+// number of other files.
+func codeOwnersMessage(id string, unapproved []string, args map[string]interface{}) *common.Message {
+	if args == nil {
+		args = make(map[string]interface{})
+	}
+	args["File"], args["OtherFiles"] = "", 0
+	if len(unapproved) > 0 {
+		args["File"], args["OtherFiles"] = unapproved[0], len(unapproved)-1
+	}
+	return common.NewMessage(id, args)
+}
@@ -17,10 +17,12 @@ package approval
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/rs/zerolog"
 
 	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
 	"github.com/palantir/policy-bot/pull"
 )
 
@@ -35,7 +37,7 @@ func (eval *evaluator) Evaluate(ctx context.Context, prctx pull.Context) (res co
 		zerolog.Ctx(ctx).Debug().Msg("No approval policy defined; skipping")
 
 		res.Status = common.StatusApproved
-		res.Description = "No approval policy defined"
+		res.Describe(common.NewMessage(common.MessageNoApprovalPolicy, nil))
 	}
 
 	res.Name = "approval"
@@ -62,11 +64,34 @@ type OrRequirement struct {
 	requirements []common.Evaluator
 }
 
+// Evaluate evaluates the requirements from cheapest to most expensive and
+// stops after the first approval, since the remaining requirements cannot
+// change the result. Requirements with the same cost are evaluated together,
+// concurrently if the context allows it. Requirements that are not evaluated
+// are skipped. Children are returned in the order of the requirements.
 func (r *OrRequirement) Evaluate(ctx context.Context, prctx pull.Context) common.Result {
-	var children []*common.Result
-	for _, req := range r.requirements {
-		res := req.Evaluate(ctx, prctx)
-		children = append(children, &res)
+	children := make([]*common.Result, len(r.requirements))
+
+	done := false
+	for _, group := range groupByCost(r.requirements) {
+		if done {
+			for _, i := range group {
+				res := notEvaluated(r.requirements[i])
+				children[i] = &res
+			}
+			continue
+		}
+
+		reqs := make([]common.Evaluator, len(group))
+		for j, i := range group {
+			reqs[j] = r.requirements[i]
+		}
+		for j, res := range common.EvaluateAll(ctx, prctx, reqs) {
+			children[group[j]] = res
+			if res.Error == nil && res.Status == common.StatusApproved {
+				done = true
+			}
+		}
 	}
 
 	var err error
@@ -114,18 +139,20 @@ type AndRequirement struct {
 	requirements []common.Evaluator
 }
 
+// Evaluate evaluates all requirements, concurrently if the context allows it.
+// If a requirement is unknown because a GitHub API is unavailable, but
+// another requirement is pending, the result is pending: it cannot be
+// approved no matter what the unknown requirement is.
 func (r *AndRequirement) Evaluate(ctx context.Context, prctx pull.Context) common.Result {
-	var children []*common.Result
-	for _, req := range r.requirements {
-		res := req.Evaluate(ctx, prctx)
-		children = append(children, &res)
-	}
+	children := common.EvaluateAll(ctx, prctx, r.requirements)
 
 	var err error
+	unknown := true
 	var pending, approved, skipped int
 	for _, c := range children {
 		if c.Error != nil {
 			err = c.Error
+			unknown = unknown && pull.IsUnavailable(c.Error)
 			continue
 		}
 
@@ -149,6 +176,9 @@ func (r *AndRequirement) Evaluate(ctx context.Context, prctx pull.Context) commo
 	case pending > 0:
 		status = common.StatusPending
 		description = fmt.Sprintf("%d/%d rules approved", approved, approved+pending)
+		if err != nil && unknown {
+			err = nil
+		}
 	}
 
 	return common.Result{
@@ -159,3 +189,77 @@ func (r *AndRequirement) Evaluate(ctx context.Context, prctx pull.Context) commo
 		Children:    children,
 	}
 }
+
+// cost returns the relative cost of evaluating the requirement, which is the
+// cost of the most expensive data it may load.
+func (r *RuleRequirement) cost() predicate.Cost {
+	return r.rule.cost()
+}
+
+func (r *OrRequirement) cost() predicate.Cost {
+	return maxCost(r.requirements)
+}
+
+func (r *AndRequirement) cost() predicate.Cost {
+	return maxCost(r.requirements)
+}
+
+type coster interface {
+	cost() predicate.Cost
+}
+
+func costOf(req common.Evaluator) predicate.Cost {
+	if c, ok := req.(coster); ok {
+		return c.cost()
+	}
+	return predicate.CostUnknown
+}
+
+func maxCost(reqs []common.Evaluator) predicate.Cost {
+	cost := predicate.CostLocal
+	for _, req := range reqs {
+		if c := costOf(req); c > cost {
+			cost = c
+		}
+	}
+	return cost
+}
+
+// groupByCost returns the indices of the requirements grouped by cost and
+// ordered from cheapest to most expensive. Indices in a group are in the
+// order of the requirements.
+func groupByCost(reqs []common.Evaluator) [][]int {
+	order := make([]int, len(reqs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return costOf(reqs[order[i]]) < costOf(reqs[order[j]])
+	})
+
+	var groups [][]int
+	for k, i := range order {
+		if k == 0 || costOf(reqs[i]) != costOf(reqs[order[k-1]]) {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], i)
+	}
+	return groups
+}
+
+// notEvaluated returns the result of a requirement that was not evaluated
+// because the result of its parent was already known.
+func notEvaluated(req common.Evaluator) common.Result {
+	res := common.Result{Status: common.StatusSkipped}
+	res.Describe(common.NewMessage(common.MessageNotEvaluated, nil))
+	switch r := req.(type) {
+	case *RuleRequirement:
+		res.Name = r.rule.Name
+		res.Labels = r.rule.Labels
+	case *OrRequirement:
+		res.Name = "or"
+	case *AndRequirement:
+		res.Name = "and"
+	}
+	return res
+}
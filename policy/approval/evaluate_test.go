@@ -119,6 +119,21 @@ func (m *mockRequirement) Evaluate(ctx context.Context, prctx pull.Context) comm
 	return *m.result
 }
 
+type costedRequirement struct {
+	mockRequirement
+	costValue predicate.Cost
+	evaluated bool
+}
+
+func (m *costedRequirement) Evaluate(ctx context.Context, prctx pull.Context) common.Result {
+	m.evaluated = true
+	return m.mockRequirement.Evaluate(ctx, prctx)
+}
+
+func (m *costedRequirement) cost() predicate.Cost {
+	return m.costValue
+}
+
 func makeRulesResultingIn(es ...common.EvaluationStatus) []common.Evaluator {
 	var requirements []common.Evaluator
 	for _, e := range es {
@@ -184,6 +199,43 @@ func TestAndRequirement(t *testing.T) {
 	}
 	result = and.Evaluate(ctx, prctx)
 	assert.Error(t, result.Error)
+
+	// Unknown requirements do not matter if another is pending
+	and = &AndRequirement{
+		requirements: []common.Evaluator{
+			&mockRequirement{
+				result: &common.Result{
+					Status: common.StatusPending,
+				},
+			},
+			&mockRequirement{
+				result: &common.Result{
+					Error: &pull.UnavailableError{API: "GraphQL", Err: errors.New("502 Bad Gateway")},
+				},
+			},
+		},
+	}
+	result = and.Evaluate(ctx, prctx)
+	assert.NoError(t, result.Error)
+	assert.Equal(t, common.StatusPending, result.Status)
+
+	// Unknown requirements block approval
+	and = &AndRequirement{
+		requirements: []common.Evaluator{
+			&mockRequirement{
+				result: &common.Result{
+					Status: common.StatusApproved,
+				},
+			},
+			&mockRequirement{
+				result: &common.Result{
+					Error: &pull.UnavailableError{API: "GraphQL", Err: errors.New("502 Bad Gateway")},
+				},
+			},
+		},
+	}
+	result = and.Evaluate(ctx, prctx)
+	assert.True(t, pull.IsUnavailable(result.Error), "error is not unavailable")
 }
 
 func TestOrRequirement(t *testing.T) {
@@ -241,3 +293,41 @@ func TestOrRequirement(t *testing.T) {
 	assert.NoError(t, result.Error)
 	assert.Equal(t, common.StatusApproved, result.Status)
 }
+
+func TestOrRequirementShortCircuit(t *testing.T) {
+	ctx := context.Background()
+	prctx := &pulltest.Context{}
+
+	expensive := &costedRequirement{
+		mockRequirement: mockRequirement{result: &common.Result{Name: "expensive", Status: common.StatusPending}},
+		costValue:       predicate.CostCommits,
+	}
+	cheap := &costedRequirement{
+		mockRequirement: mockRequirement{result: &common.Result{Name: "cheap", Status: common.StatusApproved}},
+		costValue:       predicate.CostLocal,
+	}
+
+	or := &OrRequirement{
+		requirements: []common.Evaluator{expensive, cheap},
+	}
+	result := or.Evaluate(ctx, prctx)
+	assert.NoError(t, result.Error)
+	assert.Equal(t, common.StatusApproved, result.Status)
+
+	assert.True(t, cheap.evaluated, "cheap requirement was not evaluated")
+	assert.False(t, expensive.evaluated, "expensive requirement was evaluated after approval")
+
+	require.Len(t, result.Children, 2)
+	assert.Equal(t, common.StatusSkipped, result.Children[0].Status)
+	assert.Equal(t, "cheap", result.Children[1].Name)
+
+	// all requirements are evaluated if none approve
+	cheap.result.Status = common.StatusPending
+	cheap.evaluated = false
+	result = or.Evaluate(ctx, prctx)
+	assert.NoError(t, result.Error)
+	assert.Equal(t, common.StatusPending, result.Status)
+
+	assert.True(t, cheap.evaluated, "cheap requirement was not evaluated")
+	assert.True(t, expensive.evaluated, "expensive requirement was not evaluated")
+}
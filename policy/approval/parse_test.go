@@ -181,6 +181,21 @@ func TestParsePolicyError_multikey(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestParsePolicyError_nonStringKey(t *testing.T) {
+	// Keys that are not strings
+	policy := `
+- 1:
+    - rule1
+`
+
+	rules := `
+- name: rule1
+`
+
+	_, err := loadAndParsePolicy(t, policy, rules)
+	require.Error(t, err)
+}
+
 func TestParsePolicyError_recursiveDepth(t *testing.T) {
 	// Recursive depth 5 is allowed
 	policy := `
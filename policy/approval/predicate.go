@@ -25,10 +25,17 @@ type Predicates struct {
 	HasAuthorIn             *predicate.HasAuthorIn             `yaml:"has_author_in"`
 	HasContributorIn        *predicate.HasContributorIn        `yaml:"has_contributor_in"`
 	AuthorIsOnlyContributor *predicate.AuthorIsOnlyContributor `yaml:"author_is_only_contributor"`
+	AuthorHasPermission     *predicate.AuthorHasPermission     `yaml:"author_has_permission"`
 
 	TargetsBranch *predicate.TargetsBranch `yaml:"targets_branch"`
+	HasLabels     *predicate.HasLabels     `yaml:"has_labels"`
 
-	ModifiedLines *predicate.ModifiedLines `yaml:"modified_lines"`
+	TitleMatches *predicate.TitleMatches `yaml:"title_matches"`
+	BodyMatches  *predicate.BodyMatches  `yaml:"body_matches"`
+
+	ModifiedLines   *predicate.ModifiedLines   `yaml:"modified_lines"`
+	ModifiedContent *predicate.ModifiedContent `yaml:"modified_content"`
+	FileContents    *predicate.FileContents    `yaml:"file_contents"`
 }
 
 func (p *Predicates) Predicates() []predicate.Predicate {
@@ -50,13 +57,58 @@ func (p *Predicates) Predicates() []predicate.Predicate {
 	if p.AuthorIsOnlyContributor != nil {
 		ps = append(ps, predicate.Predicate(p.AuthorIsOnlyContributor))
 	}
+	if p.AuthorHasPermission != nil {
+		ps = append(ps, predicate.Predicate(p.AuthorHasPermission))
+	}
 
 	if p.TargetsBranch != nil {
 		ps = append(ps, predicate.Predicate(p.TargetsBranch))
 	}
+	if p.HasLabels != nil {
+		ps = append(ps, predicate.Predicate(p.HasLabels))
+	}
+	if p.TitleMatches != nil {
+		ps = append(ps, predicate.Predicate(p.TitleMatches))
+	}
+	if p.BodyMatches != nil {
+		ps = append(ps, predicate.Predicate(p.BodyMatches))
+	}
 	if p.ModifiedLines != nil {
 		ps = append(ps, predicate.Predicate(p.ModifiedLines))
 	}
+	if p.ModifiedContent != nil {
+		ps = append(ps, predicate.Predicate(p.ModifiedContent))
+	}
+	if p.FileContents != nil {
+		ps = append(ps, predicate.Predicate(p.FileContents))
+	}
 
 	return ps
 }
+
+// Patterns returns the regular expressions used by the predicates.
+func (p *Predicates) Patterns() []string {
+	var patterns []string
+	if p.ChangedFiles != nil {
+		patterns = append(patterns, p.ChangedFiles.Paths...)
+	}
+	if p.OnlyChangedFiles != nil {
+		patterns = append(patterns, p.OnlyChangedFiles.Paths...)
+	}
+	if p.TargetsBranch != nil {
+		patterns = append(patterns, p.TargetsBranch.Pattern)
+	}
+	if p.TitleMatches != nil {
+		patterns = append(patterns, p.TitleMatches.Patterns()...)
+	}
+	if p.BodyMatches != nil {
+		patterns = append(patterns, p.BodyMatches.Patterns()...)
+	}
+	if p.ModifiedContent != nil {
+		patterns = append(patterns, p.ModifiedContent.Patterns()...)
+	}
+	if p.FileContents != nil {
+		patterns = append(patterns, p.FileContents.Patterns()...)
+	}
+	return patterns
+}
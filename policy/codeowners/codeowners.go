@@ -0,0 +1,163 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package codeowners parses GitHub CODEOWNERS files and converts their
+// patterns to the regular expressions used by policies.
+package codeowners
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Paths are the locations GitHub checks for a CODEOWNERS file, in order.
+var Paths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// Entry is a line of a CODEOWNERS file that assigns owners to a pattern.
+type Entry struct {
+	Line    int
+	Pattern string
+
+	// Owners are the owners as written, like "@user", "@org/team", or an
+	// email address. If empty, matching paths have no owners.
+	Owners []string
+}
+
+// File is a parsed CODEOWNERS file. When multiple entries match a path, the
+// last entry determines the owners.
+type File struct {
+	Entries []Entry
+}
+
+// Parse reads a CODEOWNERS file. Blank lines and comments are ignored.
+// Entries are not validated; use Regexp to check that a pattern is supported.
+func Parse(r io.Reader) (*File, error) {
+	var f File
+
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		for i, field := range fields {
+			if strings.HasPrefix(field, "#") {
+				fields = fields[:i]
+				break
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		e := Entry{Line: line, Pattern: fields[0]}
+		if len(fields) > 1 {
+			e.Owners = fields[1:]
+		}
+		f.Entries = append(f.Entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read CODEOWNERS")
+	}
+	return &f, nil
+}
+
+// Regexp converts the pattern of the entry to a regular expression that
+// matches the same file paths. Patterns follow the gitignore rules supported
+// by GitHub: patterns without a slash match at any depth, patterns that
+// name a directory match all files in it, "*" and "?" do not match "/", and
+// "**" matches any number of directories. Like GitHub, a final path segment
+// with a wildcard, as in "docs/*", only matches files, not directories. Negation, character ranges, and
+// escapes are not supported by GitHub and return an error.
+func (e Entry) Regexp() (string, error) {
+	p := e.Pattern
+	switch {
+	case strings.HasPrefix(p, "!"):
+		return "", errors.Errorf("negated pattern %q is not supported", p)
+	case strings.ContainsAny(p, "[]"):
+		return "", errors.Errorf("character ranges in pattern %q are not supported", p)
+	case strings.Contains(p, "\\"):
+		return "", errors.Errorf("escapes in pattern %q are not supported", p)
+	}
+
+	dir := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return "", errors.Errorf("pattern %q matches nothing", e.Pattern)
+	}
+
+	var re strings.Builder
+	if anchored {
+		re.WriteString("^")
+	} else {
+		re.WriteString("^(?:.*/)?")
+	}
+
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/") && (i == 0 || p[i-1] == '/'):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case p[i] == '*':
+			re.WriteString("[^/]*")
+		case p[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+
+	last := p[strings.LastIndex(p, "/")+1:]
+	switch {
+	case dir:
+		re.WriteString("/.*$")
+	case last != "**" && strings.ContainsAny(last, "*?"):
+		re.WriteString("$")
+	default:
+		re.WriteString("(?:/.*)?$")
+	}
+	return re.String(), nil
+}
+
+// Owner is a CODEOWNERS owner in the format used by policies.
+type Owner struct {
+	// User is the login of a user owner
+	User string
+
+	// Team is a team owner in "org/team-slug" format
+	Team string
+}
+
+// ParseOwner converts an owner as written in a CODEOWNERS file. Owners
+// identified by email address return an error because policies cannot refer
+// to users by email.
+func ParseOwner(s string) (Owner, error) {
+	if !strings.HasPrefix(s, "@") {
+		return Owner{}, errors.Errorf("owner %q is not a user or team; email owners are not supported", s)
+	}
+
+	name := strings.TrimPrefix(s, "@")
+	switch parts := strings.Split(name, "/"); {
+	case len(parts) == 1 && parts[0] != "":
+		return Owner{User: name}, nil
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return Owner{Team: name}, nil
+	}
+	return Owner{}, errors.Errorf("invalid owner %q", s)
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codeowners
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(`
+# default owners
+*       @org/everyone
+
+/docs/  @alice docs@example.com # inline comment
+*.go    @org/go-team @bob
+/vendor/
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []Entry{
+		{Line: 3, Pattern: "*", Owners: []string{"@org/everyone"}},
+		{Line: 5, Pattern: "/docs/", Owners: []string{"@alice", "docs@example.com"}},
+		{Line: 6, Pattern: "*.go", Owners: []string{"@org/go-team", "@bob"}},
+		{Line: 7, Pattern: "/vendor/"},
+	}, f.Entries)
+}
+
+func TestRegexp(t *testing.T) {
+	tests := map[string]struct {
+		Pattern string
+		Matches []string
+		Misses  []string
+	}{
+		"everything": {
+			Pattern: "*",
+			Matches: []string{"README.md", "a/b/c.go"},
+		},
+		"extension": {
+			Pattern: "*.js",
+			Matches: []string{"app.js", "web/src/app.js"},
+			Misses:  []string{"app.jsx", "app.js.map"},
+		},
+		"unanchoredDirectory": {
+			Pattern: "apps/",
+			Matches: []string{"apps/a.go", "services/apps/b/c.go"},
+			Misses:  []string{"apps", "myapps/a.go"},
+		},
+		"anchoredDirectory": {
+			Pattern: "/build/logs/",
+			Matches: []string{"build/logs/a.log", "build/logs/x/b.log"},
+			Misses:  []string{"src/build/logs/a.log", "build/log.txt"},
+		},
+		"directoryWithoutSlash": {
+			Pattern: "/docs",
+			Matches: []string{"docs", "docs/a.md", "docs/x/b.md"},
+			Misses:  []string{"docs.md"},
+		},
+		"singleLevel": {
+			Pattern: "docs/*",
+			Matches: []string{"docs/getting-started.md"},
+			Misses:  []string{"docs/build-app/troubleshooting.md", "src/docs/a.md"},
+		},
+		"doubleStar": {
+			Pattern: "/src/**/test/",
+			Matches: []string{"src/test/a.go", "src/a/b/test/c.go"},
+			Misses:  []string{"test/a.go", "src/testdata/a.go"},
+		},
+		"question": {
+			Pattern: "/v?.txt",
+			Matches: []string{"v1.txt"},
+			Misses:  []string{"v10.txt", "v/.txt"},
+		},
+		"literal": {
+			Pattern: "/a+b.txt",
+			Matches: []string{"a+b.txt"},
+			Misses:  []string{"aab.txt"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			expr, err := Entry{Pattern: test.Pattern}.Regexp()
+			require.NoError(t, err)
+
+			re := regexp.MustCompile(expr)
+			for _, path := range test.Matches {
+				assert.True(t, re.MatchString(path), "%s should match %s", expr, path)
+			}
+			for _, path := range test.Misses {
+				assert.False(t, re.MatchString(path), "%s should not match %s", expr, path)
+			}
+		})
+	}
+
+	for _, pattern := range []string{"!docs/", "[abc].go", "\\#file", "/"} {
+		_, err := Entry{Pattern: pattern}.Regexp()
+		assert.Error(t, err, "pattern %q should be unsupported", pattern)
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	o, err := ParseOwner("@alice")
+	require.NoError(t, err)
+	assert.Equal(t, Owner{User: "alice"}, o)
+
+	o, err = ParseOwner("@org/team")
+	require.NoError(t, err)
+	assert.Equal(t, Owner{Team: "org/team"}, o)
+
+	for _, owner := range []string{"alice@example.com", "@", "@org/", "@a/b/c"} {
+		_, err := ParseOwner(owner)
+		assert.Error(t, err, "owner %q should be invalid", owner)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codeowners
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Generate returns a policy file that requires an approval from an owner of
+// each changed path, with one approval rule for each entry, and warnings
+// about entries that do not translate exactly. Entries that cannot be
+// translated are left out of the policy.
+//
+// The generated policy is a starting point: in a CODEOWNERS file only the
+// last matching entry applies to a path, while every rule with a matching
+// path applies in a policy, so paths that match multiple entries require
+// approval from the owners of each entry.
+func Generate(f *File) ([]byte, []string) {
+	var warnings []string
+	warnf := func(e Entry, format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf("line %d: %s", e.Line, fmt.Sprintf(format, args...)))
+	}
+
+	type rule struct {
+		name   string
+		path   string
+		users  []string
+		teams  []string
+		source Entry
+	}
+
+	var rules []rule
+	names := make(map[string]bool)
+	for i, e := range f.Entries {
+		path, err := e.Regexp()
+		if err != nil {
+			warnf(e, "%v; the entry is not included", err)
+			continue
+		}
+
+		for _, later := range f.Entries[i+1:] {
+			if _, err := later.Regexp(); err != nil {
+				continue
+			}
+			if overlaps(e.Pattern, later.Pattern) {
+				warnf(e, "paths matching %q (line %d) also require approval from the owners of %q", later.Pattern, later.Line, e.Pattern)
+				break
+			}
+		}
+
+		r := rule{name: e.Pattern, path: path, source: e}
+		if names[r.name] {
+			r.name = fmt.Sprintf("%s (line %d)", e.Pattern, e.Line)
+		}
+
+		for _, owner := range e.Owners {
+			o, err := ParseOwner(owner)
+			if err != nil {
+				warnf(e, "%v", err)
+				continue
+			}
+			if o.Team != "" {
+				r.teams = append(r.teams, o.Team)
+			} else {
+				r.users = append(r.users, o.User)
+			}
+		}
+		if len(r.users) == 0 && len(r.teams) == 0 {
+			if len(e.Owners) == 0 {
+				warnf(e, "pattern %q has no owners; rules for earlier entries still apply to matching paths", e.Pattern)
+			} else {
+				warnf(e, "pattern %q has no supported owners; the entry is not included", e.Pattern)
+			}
+			continue
+		}
+
+		names[r.name] = true
+		rules = append(rules, r)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "# Generated from CODEOWNERS. Review the rules before using this policy.")
+	for _, w := range warnings {
+		fmt.Fprintf(&b, "# WARNING: %s\n", w)
+	}
+	fmt.Fprintln(&b)
+
+	fmt.Fprintln(&b, "policy:")
+	if len(rules) == 0 {
+		fmt.Fprintln(&b, "  approval: []")
+	} else {
+		fmt.Fprintln(&b, "  approval:")
+		for _, r := range rules {
+			fmt.Fprintf(&b, "    - %s\n", quote(r.name))
+		}
+	}
+	fmt.Fprintln(&b)
+
+	fmt.Fprintln(&b, "approval_rules:")
+	for _, r := range rules {
+		fmt.Fprintf(&b, "  # CODEOWNERS line %d: %s\n", r.source.Line, strings.Join(append([]string{r.source.Pattern}, r.source.Owners...), " "))
+		fmt.Fprintf(&b, "  - name: %s\n", quote(r.name))
+		fmt.Fprintln(&b, "    if:")
+		fmt.Fprintln(&b, "      changed_files:")
+		fmt.Fprintln(&b, "        paths:")
+		fmt.Fprintf(&b, "          - %s\n", quote(r.path))
+		fmt.Fprintln(&b, "    requires:")
+		fmt.Fprintln(&b, "      count: 1")
+		if len(r.users) > 0 {
+			fmt.Fprintf(&b, "      users: [%s]\n", quoteAll(r.users))
+		}
+		if len(r.teams) > 0 {
+			fmt.Fprintf(&b, "      teams: [%s]\n", quoteAll(r.teams))
+		}
+	}
+	if len(rules) == 0 {
+		fmt.Fprintln(&b, "  []")
+	}
+
+	return b.Bytes(), warnings
+}
+
+// overlaps returns true if a later pattern may match paths that also match
+// an earlier pattern. It compares the literal directories that start each
+// pattern, so it can report overlaps that do not exist, but it does not miss
+// overlaps between patterns that are valid for Regexp.
+func overlaps(earlier, later string) bool {
+	a, b := literalPrefix(earlier), literalPrefix(later)
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// literalPrefix returns the path of an anchored pattern up to the directory
+// that contains the first wildcard, or the empty string for patterns that
+// match at any depth.
+func literalPrefix(pattern string) string {
+	p := strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(p, "/") {
+		return ""
+	}
+	p = strings.TrimPrefix(p, "/")
+	if i := strings.IndexAny(p, "*?"); i >= 0 {
+		p = p[:i]
+		return p[:strings.LastIndex(p, "/")+1]
+	}
+	return p + "/"
+}
+
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quote(v)
+	}
+	return strings.Join(quoted, ", ")
+}
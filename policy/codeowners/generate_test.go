@@ -0,0 +1,70 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The generated policies are parsed by the policy package, which imports this
+// package, so these tests are in a separate package.
+package codeowners_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/codeowners"
+)
+
+func TestGenerate(t *testing.T) {
+	f, err := codeowners.Parse(strings.NewReader(`
+*            @org/everyone
+/docs/       @alice docs@example.com
+/src/        @org/src
+[ab].go      @carol
+/src/vendor/
+/tools/      someone@example.com
+`))
+	require.NoError(t, err)
+
+	out, warnings := codeowners.Generate(f)
+	assert.Equal(t, []string{
+		`line 2: paths matching "/docs/" (line 3) also require approval from the owners of "*"`,
+		`line 3: owner "docs@example.com" is not a user or team; email owners are not supported`,
+		`line 4: paths matching "/src/vendor/" (line 6) also require approval from the owners of "/src/"`,
+		`line 5: character ranges in pattern "[ab].go" are not supported; the entry is not included`,
+		`line 6: pattern "/src/vendor/" has no owners; rules for earlier entries still apply to matching paths`,
+		`line 7: owner "someone@example.com" is not a user or team; email owners are not supported`,
+		`line 7: pattern "/tools/" has no supported owners; the entry is not included`,
+	}, warnings)
+
+	config, err := policy.ParseConfig(out)
+	require.NoError(t, err)
+
+	_, err = policy.ParsePolicy(config)
+	require.NoError(t, err)
+
+	assert.Equal(t, []interface{}{"*", "/docs/", "/src/"}, []interface{}(config.Policy.Approval))
+	require.Len(t, config.ApprovalRules, 3)
+
+	docs := config.ApprovalRules[1]
+	assert.Equal(t, "/docs/", docs.Name)
+	assert.Equal(t, []string{"^docs/.*$"}, docs.Predicates.ChangedFiles.Paths)
+	assert.Equal(t, 1, docs.Requires.Count)
+	assert.Equal(t, []string{"alice"}, docs.Requires.Users)
+	assert.Empty(t, docs.Requires.Teams)
+
+	src := config.ApprovalRules[2]
+	assert.Equal(t, []string{"org/src"}, src.Requires.Teams)
+}
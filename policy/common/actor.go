@@ -18,6 +18,7 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 
 	"github.com/palantir/policy-bot/pull"
 )
@@ -30,6 +31,14 @@ type Actors struct {
 	Teams         []string `yaml:"teams"`
 	Organizations []string `yaml:"organizations"`
 
+	// Groups are directory groups, specified as "provider-name/group-name",
+	// that are resolved by the configured group providers
+	Groups []string `yaml:"groups"`
+
+	// Apps are the slugs of GitHub Apps whose bot users are actors, with or
+	// without the "[bot]" suffix
+	Apps []string `yaml:"apps"`
+
 	// Github repository specific interpolation options
 	Admins             bool `yaml:"admins"`
 	WriteCollaborators bool `yaml:"write_collaborators"`
@@ -42,18 +51,37 @@ const (
 
 // IsEmpty returns true if no conditions for actors are defined.
 func (a *Actors) IsEmpty() bool {
-	return a == nil || (len(a.Users) == 0 && len(a.Teams) == 0 && len(a.Organizations) == 0)
+	return a == nil || (len(a.Users) == 0 && len(a.Teams) == 0 && len(a.Organizations) == 0 && len(a.Groups) == 0 && len(a.Apps) == 0)
 }
 
 // IsActor returns true if the given user satisfies at least one of the
 // conditions in this structure.
 func (a *Actors) IsActor(ctx context.Context, prctx pull.Context, user string) (bool, error) {
 	for _, u := range a.Users {
-		if user == u {
+		if pull.CanonicalLogin(user) == pull.CanonicalLogin(u) {
 			return true, nil
 		}
 	}
 
+	// apps cannot belong to teams, organizations, or groups or be
+	// collaborators, so there is nothing else to check
+	if pull.IsBotLogin(user) {
+		for _, app := range a.Apps {
+			if pull.CanonicalLogin(user) == pull.AppLogin(app) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	// with more than one team or organization, load all memberships at once;
+	// if this fails, the checks below make individual requests instead
+	if p, ok := prctx.(pull.MembershipPrefetcher); ok && len(a.Teams)+len(a.Organizations) > 1 {
+		if err := p.PrefetchMembership(user, a.Teams, a.Organizations); err != nil {
+			zerolog.Ctx(ctx).Debug().Err(err).Msgf("Failed to prefetch memberships of %s", user)
+		}
+	}
+
 	for _, t := range a.Teams {
 		member, err := prctx.IsTeamMember(t, user)
 		if err != nil {
@@ -74,6 +102,16 @@ func (a *Actors) IsActor(ctx context.Context, prctx pull.Context, user string) (
 		}
 	}
 
+	for _, g := range a.Groups {
+		member, err := prctx.IsGroupMember(g, user)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to get group membership")
+		}
+		if member {
+			return true, nil
+		}
+	}
+
 	if a.Admins {
 		isAdmin, err := prctx.IsCollaborator(prctx.RepositoryOwner(), prctx.RepositoryName(), user, GithubAdminPermission)
 		if err != nil {
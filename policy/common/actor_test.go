@@ -36,6 +36,9 @@ func TestIsActor(t *testing.T) {
 		CollaboratorMemberships: map[string][]string{
 			"mhaypenny": {GithubAdminPermission, GithubWritePermission},
 		},
+		GroupMemberships: map[string][]string{
+			"mhaypenny": {"directory/security"},
+		},
 	}
 
 	assertActor := func(t *testing.T, a *Actors, user string) {
@@ -59,6 +62,29 @@ func TestIsActor(t *testing.T) {
 		assertNotActor(t, a, "ttest")
 	})
 
+	t.Run("usersIgnoreCase", func(t *testing.T) {
+		a := &Actors{
+			Users: []string{"MHaypenny"},
+		}
+
+		assertActor(t, a, "mhaypenny")
+		assertActor(t, a, "MHAYPENNY")
+		assertNotActor(t, a, "ttest")
+	})
+
+	t.Run("apps", func(t *testing.T) {
+		a := &Actors{
+			Apps:          []string{"risk-scorer", "other-app[bot]"},
+			Organizations: []string{"cool-org"},
+		}
+
+		assertActor(t, a, "risk-scorer[bot]")
+		assertActor(t, a, "other-app[bot]")
+		assertNotActor(t, a, "risk-scorer")
+		assertNotActor(t, a, "cool-org[bot]")
+		assertActor(t, a, "mhaypenny")
+	})
+
 	t.Run("teams", func(t *testing.T) {
 		a := &Actors{
 			Teams: []string{"regular-org/team2"},
@@ -77,6 +103,15 @@ func TestIsActor(t *testing.T) {
 		assertNotActor(t, a, "ttest")
 	})
 
+	t.Run("groups", func(t *testing.T) {
+		a := &Actors{
+			Groups: []string{"directory/security"},
+		}
+
+		assertActor(t, a, "mhaypenny")
+		assertNotActor(t, a, "ttest")
+	})
+
 	t.Run("admins", func(t *testing.T) {
 		a := &Actors{Admins: true}
 
@@ -105,6 +140,9 @@ func TestIsEmpty(t *testing.T) {
 	a = &Actors{Organizations: []string{"org"}}
 	assert.False(t, a.IsEmpty(), "Actors struct was empty")
 
+	a = &Actors{Groups: []string{"directory/group"}}
+	assert.False(t, a.IsEmpty(), "Actors struct was empty")
+
 	a = nil
 	assert.True(t, a.IsEmpty(), "nil struct was not empty")
 }
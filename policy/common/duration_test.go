@@ -0,0 +1,48 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseDuration(t *testing.T) {
+	d, err := ParseDuration("14d")
+	require.NoError(t, err)
+	assert.Equal(t, Duration(14*24*time.Hour), d)
+	assert.Equal(t, "14d", d.String())
+
+	d, err = ParseDuration("36h")
+	require.NoError(t, err)
+	assert.Equal(t, Duration(36*time.Hour), d)
+	assert.Equal(t, "36h0m0s", d.String())
+
+	for _, s := range []string{"", "d", "1.5d", "-2d", "-1h", "two weeks"} {
+		_, err := ParseDuration(s)
+		assert.Error(t, err, "%q should be invalid", s)
+	}
+
+	var v struct {
+		D Duration `yaml:"d"`
+	}
+	require.NoError(t, yaml.UnmarshalStrict([]byte("d: 2d"), &v))
+	assert.Equal(t, Duration(48*time.Hour), v.D)
+	assert.Error(t, yaml.UnmarshalStrict([]byte("d: 2 days"), &v))
+}
@@ -16,6 +16,9 @@ package common
 
 import (
 	"context"
+	"sync"
+
+	"github.com/pkg/errors"
 
 	"github.com/palantir/policy-bot/pull"
 )
@@ -23,3 +26,60 @@ import (
 type Evaluator interface {
 	Evaluate(ctx context.Context, prctx pull.Context) Result
 }
+
+type concurrencyKey struct{}
+
+// WithConcurrency returns a context that allows up to n evaluators to run at
+// the same time when evaluating independent requirements. Without it,
+// requirements are evaluated one at a time. The pull.Context used for
+// evaluation must be safe for concurrent use.
+func WithConcurrency(ctx context.Context, n int) context.Context {
+	if n <= 1 {
+		return ctx
+	}
+	// the caller evaluates requirements too, so it counts as one worker
+	return context.WithValue(ctx, concurrencyKey{}, make(chan struct{}, n-1))
+}
+
+// EvaluateAll evaluates independent requirements and returns their results
+// in the same order. Requirements run concurrently if the context allows it;
+// when all workers are busy, the calling goroutine evaluates the requirement
+// itself, so nested calls cannot deadlock.
+func EvaluateAll(ctx context.Context, prctx pull.Context, evaluators []Evaluator) []*Result {
+	results := make([]*Result, len(evaluators))
+	workers, _ := ctx.Value(concurrencyKey{}).(chan struct{})
+
+	var wg sync.WaitGroup
+	for i, e := range evaluators {
+		i, e := i, e
+		select {
+		case workers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-workers
+					wg.Done()
+				}()
+				results[i] = evaluateRecover(ctx, prctx, e)
+			}()
+		default:
+			results[i] = evaluateRecover(ctx, prctx, e)
+		}
+	}
+	wg.Wait()
+
+	return results
+}
+
+// evaluateRecover evaluates a requirement, converting a panic into an error
+// result so that a panic in a worker does not stop the server.
+func evaluateRecover(ctx context.Context, prctx pull.Context, e Evaluator) (res *Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			res = &Result{Error: errors.Errorf("panic during evaluation: %v", r)}
+		}
+	}()
+
+	result := e.Evaluate(ctx, prctx)
+	return &result
+}
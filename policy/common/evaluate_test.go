@@ -0,0 +1,103 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+type countingEvaluator struct {
+	name    string
+	running *int32
+	maxSeen *int32
+	panics  bool
+}
+
+func (e *countingEvaluator) Evaluate(ctx context.Context, prctx pull.Context) Result {
+	n := atomic.AddInt32(e.running, 1)
+	defer atomic.AddInt32(e.running, -1)
+
+	for {
+		max := atomic.LoadInt32(e.maxSeen)
+		if n <= max || atomic.CompareAndSwapInt32(e.maxSeen, max, n) {
+			break
+		}
+	}
+
+	if e.panics {
+		panic("evaluation failed")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	return Result{Name: e.name, Status: StatusApproved}
+}
+
+func makeCountingEvaluators(n int, running, maxSeen *int32) []Evaluator {
+	var evaluators []Evaluator
+	for i := 0; i < n; i++ {
+		evaluators = append(evaluators, &countingEvaluator{
+			name:    string(rune('a' + i)),
+			running: running,
+			maxSeen: maxSeen,
+		})
+	}
+	return evaluators
+}
+
+func TestEvaluateAll(t *testing.T) {
+	prctx := &pulltest.Context{}
+
+	t.Run("sequential", func(t *testing.T) {
+		var running, maxSeen int32
+		results := EvaluateAll(context.Background(), prctx, makeCountingEvaluators(4, &running, &maxSeen))
+
+		require.Len(t, results, 4)
+		assert.Equal(t, int32(1), maxSeen, "evaluators ran concurrently without a concurrency limit")
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		var running, maxSeen int32
+		ctx := WithConcurrency(context.Background(), 3)
+		results := EvaluateAll(ctx, prctx, makeCountingEvaluators(8, &running, &maxSeen))
+
+		require.Len(t, results, 8)
+		for i, res := range results {
+			assert.Equal(t, string(rune('a'+i)), res.Name, "results are not in order")
+		}
+		assert.True(t, maxSeen > 1, "evaluators did not run concurrently")
+		assert.True(t, maxSeen <= 3, "more than 3 evaluators ran concurrently: %d", maxSeen)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		var running, maxSeen int32
+		evaluators := makeCountingEvaluators(2, &running, &maxSeen)
+		evaluators[1].(*countingEvaluator).panics = true
+
+		results := EvaluateAll(WithConcurrency(context.Background(), 2), prctx, evaluators)
+
+		require.Len(t, results, 2)
+		assert.NoError(t, results[0].Error)
+		assert.EqualError(t, results[1].Error, "panic during evaluation: evaluation failed")
+	})
+}
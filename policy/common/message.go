@@ -0,0 +1,100 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// IDs of the messages that describe results.
+const (
+	MessageNoApprovalPolicy    = "result.no_approval_policy"
+	MessageNoDisapprovalPolicy = "result.no_disapproval_policy"
+	MessageDraft               = "result.draft"
+	MessagePreconditions       = "result.preconditions"
+	MessageNotEvaluated        = "result.not_evaluated"
+	MessageNoApprovalRequired  = "result.no_approval_required"
+	MessageApprovedBy          = "result.approved_by"
+	MessageApprovalsRequired   = "result.approvals_required"
+	MessageCodeOwners          = "result.code_owners"
+	MessageUnsignedCommit      = "result.unsigned_commit"
+	MessageInvalidSignature    = "result.invalid_signature"
+)
+
+// codeOwnersTemplate describes the files that are waiting for approval from
+// their code owners. It is shared by messages that end with these files.
+const codeOwnersTemplate = `Waiting for approval from the code owners of {{.File}}` +
+	`{{if eq .OtherFiles 1}} and 1 other file{{else if .OtherFiles}} and {{.OtherFiles}} other files{{end}}`
+
+// Messages are the English templates of the messages that describe results.
+// The server may translate them with its message catalog.
+var Messages = map[string]string{
+	MessageNoApprovalPolicy:    "No approval policy defined",
+	MessageNoDisapprovalPolicy: "No disapproval policy is specified or the policy is empty",
+	MessageDraft:               "Pull request is a draft",
+	MessagePreconditions:       "The preconditions of this rule are not satisfied",
+	MessageNotEvaluated:        "Not evaluated because another rule is approved",
+	MessageNoApprovalRequired:  "No approval required",
+	MessageApprovedBy:          "Approved by {{.Approvers}}",
+	MessageApprovalsRequired: "{{.Approved}}/{{.Required}} approvals required" +
+		"{{if .Disqualified}}. Ignored {{if eq .Disqualified 1}}1 approval{{else}}{{.Disqualified}} approvals{{end}} from disqualified users{{end}}" +
+		"{{if .Expired}}. Ignored {{if eq .Expired 1}}1 approval{{else}}{{.Expired}} approvals{{end}} older than {{.ExpireAfter}}{{end}}" +
+		"{{if .File}}. " + codeOwnersTemplate + "{{end}}",
+	MessageCodeOwners:       codeOwnersTemplate,
+	MessageUnsignedCommit:   "Commit {{.SHA}} is not signed",
+	MessageInvalidSignature: "Commit {{.SHA}} does not have a valid signature ({{.State}})",
+}
+
+var messageTemplates = make(map[string]*template.Template, len(Messages))
+
+func init() {
+	for id, text := range Messages {
+		messageTemplates[id] = template.Must(template.New(id).Parse(text))
+	}
+}
+
+// Message identifies the description of a result in Messages, so that the
+// server can translate it. Args are the values for the template of the
+// message.
+type Message struct {
+	ID   string
+	Args map[string]interface{}
+}
+
+// NewMessage returns the message with the given ID and arguments.
+func NewMessage(id string, args map[string]interface{}) *Message {
+	return &Message{ID: id, Args: args}
+}
+
+// String returns the English text of the message.
+func (m *Message) String() string {
+	tmpl, ok := messageTemplates[m.ID]
+	if !ok {
+		return m.ID
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, m.Args); err != nil {
+		return m.ID
+	}
+	return b.String()
+}
+
+// Describe sets the description of a result to a message.
+func (r *Result) Describe(m *Message) {
+	r.Description = m.String()
+	r.Message = m
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageString(t *testing.T) {
+	required := func(disqualified, expired int, file string, others int) *Message {
+		return NewMessage(MessageApprovalsRequired, map[string]interface{}{
+			"Approved":     1,
+			"Required":     2,
+			"Disqualified": disqualified,
+			"Expired":      expired,
+			"ExpireAfter":  "14d",
+			"File":         file,
+			"OtherFiles":   others,
+		})
+	}
+
+	assert.Equal(t, "1/2 approvals required", required(0, 0, "", 0).String())
+	assert.Equal(t, "1/2 approvals required. Ignored 1 approval from disqualified users", required(1, 0, "", 0).String())
+	assert.Equal(t, "1/2 approvals required. Ignored 3 approvals older than 14d", required(0, 3, "", 0).String())
+	assert.Equal(t, "1/2 approvals required. Waiting for approval from the code owners of a.go and 2 other files", required(0, 0, "a.go", 2).String())
+
+	owners := NewMessage(MessageCodeOwners, map[string]interface{}{"File": "a.go", "OtherFiles": 1})
+	assert.Equal(t, "Waiting for approval from the code owners of a.go and 1 other file", owners.String())
+
+	assert.Equal(t, "unknown.message", NewMessage("unknown.message", nil).String())
+
+	var res Result
+	res.Describe(NewMessage(MessageApprovedBy, map[string]interface{}{"Approvers": "alice, bob"}))
+	assert.Equal(t, "Approved by alice, bob", res.Description)
+	assert.Equal(t, MessageApprovedBy, res.Message.ID)
+}
@@ -16,9 +16,13 @@ package common
 
 import (
 	"context"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/palantir/policy-bot/pull"
 )
 
@@ -26,15 +30,210 @@ type Methods struct {
 	Comments     []string `yaml:"comments,omitempty"`
 	GithubReview bool     `yaml:"github_review,omitempty"`
 
+	// CommentsIgnoreCase is true if comments match patterns regardless of
+	// letter case.
+	CommentsIgnoreCase bool `yaml:"comments_ignore_case,omitempty"`
+
+	// Tracking, if set, also considers comments and reviews on issues or pull
+	// requests in another repository that the pull request body references.
+	Tracking *TrackingMethods `yaml:"tracking,omitempty"`
+
 	// If GithubReview is true, GithubReviewState is the state a review must
 	// have to be considered a candidated. It is currently excluded from
 	// serialized forms and should be set by the application.
 	GithubReviewState pull.ReviewState `yaml:"-" json:"-"`
 }
 
+// Keywords are comment patterns that a deployment adds to the comment methods
+// of every policy, like approval phrases in languages other than English.
+// Approval keywords also revoke disapprovals, like the default patterns.
+type Keywords struct {
+	Approve    []string `yaml:"approve"`
+	Disapprove []string `yaml:"disapprove"`
+}
+
+// AddComments returns a copy of the methods that also match the given comment
+// patterns, ignoring patterns that are already present. If the methods do not
+// match comments at all, comments stay disabled and the copy is unchanged.
+func (m *Methods) AddComments(patterns []string) *Methods {
+	copied := *m
+	if len(m.Comments) == 0 {
+		return &copied
+	}
+
+	copied.Comments = append([]string(nil), m.Comments...)
+	for _, p := range patterns {
+		if p != "" && !containsString(copied.Comments, p) {
+			copied.Comments = append(copied.Comments, p)
+		}
+	}
+	return &copied
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// TrackingMethods define how users express approval on tracking issues or
+// pull requests in a central repository, like the repository of a change
+// advisory board. A pull request references a tracking issue in its body as
+// "owner/repo#123" or with the URL of the issue, and the tracking issue must
+// refer back to the pull request in the same way.
+type TrackingMethods struct {
+	// Repository is the repository of the tracking issues, as "owner/repo"
+	Repository string `yaml:"repository"`
+
+	Comments     []string `yaml:"comments,omitempty"`
+	GithubReview bool     `yaml:"github_review,omitempty"`
+
+	// references matches references to tracking issues. It is compiled when
+	// the methods are unmarshaled.
+	references *regexp.Regexp
+}
+
+func (t *TrackingMethods) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawTrackingMethods TrackingMethods
+
+	var raw rawTrackingMethods
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*t = TrackingMethods(raw)
+	t.references = referencePattern(t.Repository)
+	return nil
+}
+
+// referencePattern returns a pattern that matches references to issues in a
+// repository as "owner/repo#123" or with the URL of the issue. The issue
+// number is in the first or second group.
+func referencePattern(repository string) *regexp.Regexp {
+	repo := regexp.QuoteMeta(repository)
+	return regexp.MustCompile(`(?i)(?:^|[\s(\[])` + repo + `#(\d+)\b|/` + repo + `/(?:issues|pull)/(\d+)\b`)
+}
+
+// Validate returns an error if the methods are invalid.
+func (m *Methods) Validate() error {
+	if m.Tracking != nil {
+		if _, _, err := m.Tracking.repository(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TrackingMethods) repository() (owner, repo string, err error) {
+	parts := strings.Split(t.Repository, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.Errorf("invalid tracking repository %q, expected owner/repo", t.Repository)
+	}
+	return parts[0], parts[1], nil
+}
+
+// References returns the numbers of the tracking issues referenced in the body
+// of a pull request, in order of appearance and without duplicates.
+func (t *TrackingMethods) References(body string) []int {
+	pattern := t.references
+	if pattern == nil {
+		// the methods were not unmarshaled, like in tests
+		pattern = referencePattern(t.Repository)
+	}
+
+	var numbers []int
+	seen := make(map[int]bool)
+	for _, m := range pattern.FindAllStringSubmatch(body, -1) {
+		n, err := strconv.Atoi(m[1] + m[2])
+		if err == nil && n > 0 && !seen[n] {
+			seen[n] = true
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
+
+// candidates returns the users who approved the tracking issues referenced by
+// a pull request. Reviews must have the given state. Approvals only count if
+// the tracking issue or the approval refers to the pull request, so that an
+// approval for one pull request cannot be reused by another.
+func (t *TrackingMethods) candidates(prctx pull.Context, state pull.ReviewState, ignoreCase bool) ([]*Candidate, error) {
+	owner, repo, err := t.repository()
+	if err != nil {
+		return nil, err
+	}
+	comments := &Methods{Comments: t.Comments, CommentsIgnoreCase: ignoreCase}
+
+	var candidates []*Candidate
+	for _, number := range t.References(prctx.Body()) {
+		issue, err := prctx.LinkedIssue(owner, repo, number)
+		if err != nil {
+			return nil, err
+		}
+		issueMentions := mentionsPullRequest(issue.Body, prctx)
+		for _, c := range issue.Comments {
+			if comments.CommentMatches(c.Body) && (issueMentions || mentionsPullRequest(c.Body, prctx)) {
+				candidates = append(candidates, &Candidate{User: c.Author, CreatedAt: c.CreatedAt})
+			}
+		}
+		if t.GithubReview {
+			// the reviewed commit is in the tracking pull request, so these
+			// reviews are invalidated by push time like comments
+			for _, r := range issue.Reviews {
+				if r.State == state && (issueMentions || mentionsPullRequest(r.Body, prctx)) {
+					candidates = append(candidates, &Candidate{User: r.Author, CreatedAt: r.CreatedAt})
+				}
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// mentionsPullRequest returns true if text refers to the pull request as
+// "owner/repo#123" or with the URL of the pull request.
+func mentionsPullRequest(text string, prctx pull.Context) bool {
+	repo := strings.ToLower(prctx.RepositoryOwner() + "/" + prctx.RepositoryName())
+	number := strconv.Itoa(prctx.Number())
+
+	text = strings.ToLower(text)
+	return containsReference(text, repo+"#"+number, true) || containsReference(text, "/"+repo+"/pull/"+number, false)
+}
+
+// containsReference returns true if text contains ref and ref is not followed
+// by a letter or digit. If standalone is true, ref must also be at the start
+// of text or follow a space or opening bracket, so that "other/owner/repo#1"
+// does not refer to "owner/repo#1".
+func containsReference(text, ref string, standalone bool) bool {
+	for i := 0; ; {
+		j := strings.Index(text[i:], ref)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(ref)
+
+		endOK := end == len(text) || !isWordByte(text[end])
+		startOK := !standalone || start == 0 || strings.IndexByte(" \t\r\n([", text[start-1]) >= 0
+		if endOK && startOK {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
 type Candidate struct {
 	User      string
 	CreatedAt time.Time
+
+	// CommitSHA is the commit the candidate approved, if known. It is only
+	// set for reviews.
+	CommitSHA string
 }
 
 type CandidatesByCreationTime []*Candidate
@@ -79,11 +278,20 @@ func (m *Methods) Candidates(ctx context.Context, prctx pull.Context) ([]*Candid
 				candidates = append(candidates, &Candidate{
 					User:      r.Author,
 					CreatedAt: r.CreatedAt,
+					CommitSHA: r.CommitSHA,
 				})
 			}
 		}
 	}
 
+	if m.Tracking != nil {
+		tracking, err := m.Tracking.candidates(prctx, m.GithubReviewState, m.CommentsIgnoreCase)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, tracking...)
+	}
+
 	return deduplicateCandidates(candidates), nil
 }
 
@@ -104,9 +312,15 @@ func deduplicateCandidates(all []*Candidate) []*Candidate {
 	return candidates
 }
 
+// CommentMatches returns true if the comment contains one of the comment
+// patterns. Comments and patterns are normalized before matching, so Unicode
+// letters with combining marks match their precomposed forms, smart quotes and
+// dashes match their ASCII forms, and emoji shortcodes like ":+1:" match the
+// literal emoji.
 func (m *Methods) CommentMatches(commentBody string) bool {
+	body := normalizeComment(commentBody, m.CommentsIgnoreCase)
 	for _, comment := range m.Comments {
-		if strings.Contains(commentBody, comment) {
+		if strings.Contains(body, normalizeComment(comment, m.CommentsIgnoreCase)) {
 			return true
 		}
 	}
@@ -16,12 +16,14 @@ package common
 
 import (
 	"context"
+	"errors"
 	"sort"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 
 	"github.com/palantir/policy-bot/pull"
 	"github.com/palantir/policy-bot/pull/pulltest"
@@ -116,6 +118,174 @@ func TestCandidates(t *testing.T) {
 	})
 }
 
+func TestTrackingCandidates(t *testing.T) {
+	now := time.Now()
+
+	ctx := context.Background()
+	prctx := &pulltest.Context{
+		BodyValue: "Implements the change approved in palantir/cab#12 and palantir/cab#14.\nReuses palantir/cab#15.",
+		LinkedIssues: map[string]*pull.LinkedIssue{
+			"palantir/cab#12": {
+				Body: "Deploys pulltest/context#1 on Friday.",
+				Comments: []*pull.Comment{
+					{
+						CreatedAt: now.Add(1 * time.Minute),
+						Body:      "CAB approved",
+						Author:    "cab-member",
+					},
+					{
+						CreatedAt: now.Add(2 * time.Minute),
+						Body:      "When is this scheduled?",
+						Author:    "rrandom",
+					},
+				},
+				Reviews: []*pull.Review{
+					{
+						CreatedAt: now.Add(3 * time.Minute),
+						Author:    "cab-chair",
+						State:     pull.ReviewApproved,
+					},
+				},
+			},
+			"palantir/cab#13": {
+				Body: "Deploys pulltest/context#1 on Friday.",
+				Comments: []*pull.Comment{
+					{
+						CreatedAt: now.Add(4 * time.Minute),
+						Body:      "CAB approved",
+						Author:    "unreferenced",
+					},
+				},
+			},
+			"palantir/cab#14": {
+				Body: "Weekly changes",
+				Comments: []*pull.Comment{
+					{
+						CreatedAt: now.Add(5 * time.Minute),
+						Body:      "CAB approved https://github.com/pulltest/context/pull/1",
+						Author:    "cab-deputy",
+					},
+					{
+						CreatedAt: now.Add(6 * time.Minute),
+						Body:      "CAB approved pulltest/context#2",
+						Author:    "other-pull-request",
+					},
+				},
+			},
+			"palantir/cab#15": {
+				Body: "Deploys pulltest/context#10 and other/pulltest/context#1",
+				Comments: []*pull.Comment{
+					{
+						CreatedAt: now.Add(7 * time.Minute),
+						Body:      "CAB approved",
+						Author:    "reused",
+					},
+				},
+				Reviews: []*pull.Review{
+					{
+						CreatedAt: now.Add(8 * time.Minute),
+						Author:    "reused-review",
+						State:     pull.ReviewApproved,
+					},
+				},
+			},
+		},
+	}
+
+	m := &Methods{
+		GithubReviewState: pull.ReviewApproved,
+		Tracking: &TrackingMethods{
+			Repository:   "palantir/cab",
+			Comments:     []string{"CAB approved"},
+			GithubReview: true,
+		},
+	}
+
+	cs, err := m.Candidates(ctx, prctx)
+	require.NoError(t, err)
+
+	sort.Sort(CandidatesByCreationTime(cs))
+
+	require.Len(t, cs, 3, "incorrect number of candidates found")
+	assert.Equal(t, "cab-member", cs[0].User)
+	assert.Equal(t, "cab-chair", cs[1].User)
+	assert.Empty(t, cs[1].CommitSHA, "tracking reviews must not approve a commit")
+	assert.Equal(t, "cab-deputy", cs[2].User)
+
+	prctx.LinkedIssueError = errors.New("no access to palantir/cab")
+	_, err = m.Candidates(ctx, prctx)
+	assert.Error(t, err)
+}
+
+func TestTrackingReferences(t *testing.T) {
+	tracking := &TrackingMethods{Repository: "palantir/cab"}
+
+	body := `Approved in palantir/cab#12 and (Palantir/CAB#3).
+See https://github.com/palantir/cab/issues/40 and https://github.com/palantir/cab/pull/12.
+Not other/palantir/cab#5, palantir/cabinet#6, or palantir/cab#7a.`
+	assert.Equal(t, []int{12, 3, 40}, tracking.References(body))
+
+	assert.Empty(t, tracking.References(""))
+
+	var parsed TrackingMethods
+	require.NoError(t, yaml.Unmarshal([]byte("repository: palantir/cab"), &parsed))
+	require.NotNil(t, parsed.references, "pattern was not compiled")
+	assert.Equal(t, []int{12, 3, 40}, parsed.References(body))
+}
+
+func TestCommentMatches(t *testing.T) {
+	m := &Methods{
+		Comments: []string{":+1:", "LGTM", "don't merge", "ça va"},
+	}
+
+	assert.True(t, m.CommentMatches("\U0001F44D"), "literal emoji should match shortcode")
+	assert.True(t, m.CommentMatches("\U0001F44D\U0001F3FD"), "emoji with skin tone should match shortcode")
+	assert.True(t, m.CommentMatches(":thumbsup:"), "alias should match shortcode")
+	assert.True(t, m.CommentMatches("I don\u2019t merge"), "smart quote should match ASCII quote")
+	assert.True(t, m.CommentMatches("c\u0327a va"), "combining mark should match precomposed letter")
+	assert.False(t, m.CommentMatches("lgtm"), "case should not be ignored by default")
+	assert.False(t, m.CommentMatches(":-1:"), "other emoji should not match")
+
+	m.CommentsIgnoreCase = true
+	assert.True(t, m.CommentMatches("lgtm"), "case should be ignored")
+	assert.True(t, m.CommentMatches("\u00C7A VA"), "case should be ignored for non-ASCII letters")
+}
+
+func TestCommentMatchesDecomposed(t *testing.T) {
+	tests := map[string]struct {
+		Pattern string
+		Comment string
+	}{
+		"greek": {
+			Pattern: "εγκρίνω",
+			Comment: "εγκρι\u0301νω",
+		},
+		"cyrillic": {
+			Pattern: "одобрено й ё",
+			Comment: "одобрено и\u0306 е\u0308",
+		},
+		"hangul": {
+			Pattern: "승인",
+			Comment: "\u1109\u1173\u11BC\u110B\u1175\u11AB",
+		},
+		"vietnamese": {
+			Pattern: "được duyệt",
+			Comment: "đu\u031Bo\u031B\u0323c duye\u0323\u0302t",
+		},
+		"precomposed pattern with marks out of order": {
+			Pattern: "duye\u0302\u0323t",
+			Comment: "duyệt",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := &Methods{Comments: []string{test.Pattern}}
+			assert.True(t, m.CommentMatches(test.Comment), "decomposed comment should match pattern")
+		})
+	}
+}
+
 func TestCandidatesByCreationTime(t *testing.T) {
 	cs := []*Candidate{
 		{
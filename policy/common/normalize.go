@@ -0,0 +1,76 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// commentReplacer replaces characters and sequences that have several common
+// forms with a single form, so that comments typed on different clients match
+// the same patterns. In particular, mobile keyboards often insert smart
+// punctuation and the GitHub UI inserts literal emoji for shortcodes. Only
+// the shortcodes below are replaced; others are matched literally.
+var commentReplacer = strings.NewReplacer(
+	// punctuation
+	"‘", "'", // left single quotation mark
+	"’", "'", // right single quotation mark
+	"“", `"`, // left double quotation mark
+	"”", `"`, // right double quotation mark
+	"–", "-", // en dash
+	"—", "-", // em dash
+	"…", "...", // horizontal ellipsis
+	"\u00A0", " ", // no-break space
+
+	// emoji shortcodes
+	":+1:", "\U0001F44D",
+	":thumbsup:", "\U0001F44D",
+	":-1:", "\U0001F44E",
+	":thumbsdown:", "\U0001F44E",
+	":white_check_mark:", "✅",
+	":heavy_check_mark:", "✔",
+	":ok_hand:", "\U0001F44C",
+	":rocket:", "\U0001F680",
+	":ship:", "\U0001F6A2",
+	":tada:", "\U0001F389",
+	":100:", "\U0001F4AF",
+	":x:", "❌",
+	":no_entry:", "⛔",
+	":stop_sign:", "\U0001F6D1",
+)
+
+// normalizeComment returns a form of s for matching comments against
+// patterns. It converts s to Unicode normalization form C, replaces smart
+// punctuation and the emoji shortcodes in commentReplacer, and removes emoji
+// variation selectors and skin tone modifiers. If foldCase is true, it also
+// converts s to lower case.
+func normalizeComment(s string, foldCase bool) string {
+	s = commentReplacer.Replace(norm.NFC.String(s))
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\uFE0E' || r == '\uFE0F':
+			return -1
+		case r >= 0x1F3FB && r <= 0x1F3FF:
+			return -1
+		}
+		return r
+	}, s)
+	if foldCase {
+		s = strings.ToLower(s)
+	}
+	return s
+}
@@ -14,6 +14,10 @@
 
 package common
 
+import (
+	"time"
+)
+
 type EvaluationStatus int
 
 const (
@@ -42,7 +46,41 @@ type Result struct {
 	Description string
 	Status      EvaluationStatus
 
+	// Message, if set, identifies the description in Messages so that it can
+	// be translated. The description is the English text of the message.
+	Message *Message
+
 	Error error
 
+	// Approvals lists the approval candidates considered by an approval rule
+	// and whether each one counted toward the rule.
+	Approvals []*ApprovalDecision
+
+	// Requires lists the actors who can approve an approval rule that
+	// requires approval.
+	Requires *Actors
+
+	// Required is the number of approvals required by an approval rule, or
+	// zero if the rule does not require approval.
+	Required int
+
+	// Labels lists the labels to add to a pull request while the result is
+	// pending and to remove otherwise.
+	Labels []string
+
+	// ReviewRequest selects the actors in Requires who are requested to
+	// review a pull request while the result is pending. If nil, all of them
+	// are requested.
+	ReviewRequest *ReviewRequest
+
 	Children []*Result
 }
+
+// ApprovalDecision records whether an approval candidate counted toward a
+// rule and, if not, why.
+type ApprovalDecision struct {
+	User      string
+	CreatedAt time.Time
+	Counted   bool
+	Reason    string
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"math/rand"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ReviewRequestAll    = "all"
+	ReviewRequestRandom = "random"
+	ReviewRequestNone   = "none"
+)
+
+// ReviewRequest selects which of the users and teams that can approve a rule
+// are requested to review a pull request.
+type ReviewRequest struct {
+	// Mode is "all" to request every user and team, "random" to request
+	// Count of them at random, or "none" to request nobody. The default is
+	// "all".
+	Mode string `yaml:"mode"`
+
+	// Count is the number of users and teams requested in "random" mode.
+	Count int `yaml:"count"`
+}
+
+// Validate returns an error if the mode is unknown or a random request does
+// not request anyone.
+func (r *ReviewRequest) Validate() error {
+	switch r.Mode {
+	case "", ReviewRequestAll, ReviewRequestNone:
+	case ReviewRequestRandom:
+		if r.Count <= 0 {
+			return errors.New("request_review count must be positive in random mode")
+		}
+	default:
+		return errors.Errorf("invalid request_review mode %q, allowed values: [all, random, none]", r.Mode)
+	}
+	return nil
+}
+
+// Select returns the reviewers to request from the candidates. A nil request
+// selects all candidates. The candidates are not modified.
+func (r *ReviewRequest) Select(candidates []string) []string {
+	if r == nil {
+		return candidates
+	}
+
+	switch r.Mode {
+	case ReviewRequestNone:
+		return nil
+	case ReviewRequestRandom:
+		if len(candidates) <= r.Count {
+			return candidates
+		}
+		selected := append([]string(nil), candidates...)
+		rand.Shuffle(len(selected), func(i, j int) {
+			selected[i], selected[j] = selected[j], selected[i]
+		})
+		return selected[:r.Count]
+	}
+	return candidates
+}
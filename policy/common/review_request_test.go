@@ -0,0 +1,51 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReviewRequestSelect(t *testing.T) {
+	candidates := []string{"alice", "bob", "carol", "palantir/security"}
+
+	var unset *ReviewRequest
+	assert.Equal(t, candidates, unset.Select(candidates))
+	assert.Equal(t, candidates, (&ReviewRequest{Mode: ReviewRequestAll}).Select(candidates))
+	assert.Empty(t, (&ReviewRequest{Mode: ReviewRequestNone}).Select(candidates))
+
+	random := &ReviewRequest{Mode: ReviewRequestRandom, Count: 2}
+	for i := 0; i < 10; i++ {
+		selected := random.Select(candidates)
+		assert.Len(t, selected, 2)
+		assert.Subset(t, candidates, selected)
+		assert.NotEqual(t, selected[0], selected[1])
+	}
+	assert.Equal(t, []string{"alice", "bob", "carol", "palantir/security"}, candidates, "candidates were modified")
+
+	random.Count = 10
+	assert.Equal(t, candidates, random.Select(candidates))
+}
+
+func TestReviewRequestValidate(t *testing.T) {
+	assert.NoError(t, (&ReviewRequest{}).Validate())
+	assert.NoError(t, (&ReviewRequest{Mode: ReviewRequestNone}).Validate())
+	assert.NoError(t, (&ReviewRequest{Mode: ReviewRequestRandom, Count: 1}).Validate())
+
+	assert.Error(t, (&ReviewRequest{Mode: ReviewRequestRandom}).Validate())
+	assert.Error(t, (&ReviewRequest{Mode: "round-robin"}).Validate())
+}
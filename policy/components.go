@@ -0,0 +1,120 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// Component is a part of a repository, like a project in a monorepo, with its
+// own approval policy. Each component whose files changed in a pull request
+// has a separate status, so it is clear which owners still need to approve.
+type Component struct {
+	Name string `yaml:"name"`
+
+	// Paths are the path prefixes of the files in the component, like
+	// "services/api/".
+	Paths []string `yaml:"paths"`
+
+	// Approval is the approval policy of the component. It uses the same
+	// syntax and rules as the approval policy of the repository.
+	Approval approval.Policy `yaml:"approval"`
+}
+
+// Changed returns true if any of the files belong to the component.
+func (c *Component) Changed(files []*pull.File) bool {
+	for _, f := range files {
+		for _, p := range c.Paths {
+			if strings.HasPrefix(f.Filename, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ComponentResult is the result of evaluating the approval policy of a
+// component.
+type ComponentResult struct {
+	Name   string
+	Result common.Result
+}
+
+type componentEvaluator struct {
+	component *Component
+	approval  common.Evaluator
+}
+
+// parseComponents returns evaluators for the components of a policy. It
+// returns an error if a component has no name or paths, if two components
+// have the same name, or if the policy of a component is invalid.
+func parseComponents(c *Config, rulesByName map[string]*approval.Rule) ([]componentEvaluator, error) {
+	names := make(map[string]bool)
+	evaluators := make([]componentEvaluator, 0, len(c.Components))
+	for i, comp := range c.Components {
+		switch {
+		case comp == nil || comp.Name == "":
+			return nil, errors.Errorf("component %d has no name", i+1)
+		case names[comp.Name]:
+			return nil, errors.Errorf("component %q is defined more than once", comp.Name)
+		case len(comp.Paths) == 0:
+			return nil, errors.Errorf("component %q has no paths", comp.Name)
+		}
+		names[comp.Name] = true
+
+		eval, err := comp.Approval.Parse(rulesByName)
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("failed to parse approval policy of component %q", comp.Name))
+		}
+		evaluators = append(evaluators, componentEvaluator{component: comp, approval: eval})
+	}
+	return evaluators, nil
+}
+
+// EvaluateComponents evaluates the approval policies of the components whose
+// files changed in a pull request, in the order the components are defined.
+// Components without changed files are not evaluated.
+func EvaluateComponents(ctx context.Context, c *Config, prctx pull.Context) ([]ComponentResult, error) {
+	if len(c.Components) == 0 {
+		return nil, nil
+	}
+
+	evaluators, err := parseComponents(c, c.rulesByName())
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := prctx.ChangedFiles()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list changed files")
+	}
+
+	var results []ComponentResult
+	for _, e := range evaluators {
+		if e.component.Changed(files) {
+			res := e.approval.Evaluate(ctx, prctx)
+			results = append(results, ComponentResult{Name: e.component.Name, Result: res})
+		}
+	}
+	return results, nil
+}
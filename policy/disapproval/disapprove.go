@@ -72,6 +72,17 @@ func (opts *Options) GetRevokeMethods() *common.Methods {
 	return m
 }
 
+// AddComments adds patterns to the comments that disapprove and that revoke
+// disapproval, unless the policy does not allow the action by comment.
+func (opts *Options) AddComments(disapprove, revoke []string) {
+	if len(disapprove) > 0 {
+		opts.Methods.Disapprove = opts.GetDisapproveMethods().AddComments(disapprove)
+	}
+	if len(revoke) > 0 {
+		opts.Methods.Revoke = opts.GetRevokeMethods().AddComments(revoke)
+	}
+}
+
 type Requires struct {
 	common.Actors `yaml:",inline"`
 }
@@ -85,7 +96,7 @@ func (p *Policy) Evaluate(ctx context.Context, prctx pull.Context) (res common.R
 	if p.Requires.IsEmpty() {
 		log.Debug().Msg("no users are allowed to disapprove; skipping")
 
-		res.Description = "No disapproval policy is specified or the policy is empty"
+		res.Describe(common.NewMessage(common.MessageNoDisapprovalPolicy, nil))
 		return
 	}
 
@@ -0,0 +1,253 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Change describes the upgrade of a legacy construct in a policy file.
+type Change struct {
+	// Path is the location of the construct, like "approval_rules[0].options"
+	Path        string
+	Description string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s", c.Path, c.Description)
+}
+
+// renamedOptions maps the legacy names of approval rule options to their
+// current names.
+var renamedOptions = map[string]string{
+	"allow_authors":       "allow_author",
+	"allow_contributors":  "allow_contributor",
+	"ignore_update_merge": "ignore_update_merges",
+}
+
+// listKeys are the keys whose values are lists but were scalars in legacy
+// policies.
+var listKeys = map[string]bool{
+	"users":         true,
+	"teams":         true,
+	"organizations": true,
+	"groups":        true,
+	"apps":          true,
+	"paths":         true,
+	"comments":      true,
+}
+
+// Upgrade rewrites the legacy constructs in the content of a policy file to
+// the current schema and returns the new content and the changes. If there
+// are no legacy constructs, it returns the original content and no changes.
+// The upgraded content is not validated; parse it to check it.
+//
+// Upgrade recognizes these constructs:
+//
+//   - approval_rules as a mapping from rule names to rules
+//   - policy.approval as a single rule name
+//   - scalar values for lists of actors, paths, and comments
+//   - renamed approval rule options, like allow_authors
+//   - disapproval methods set directly in policy.disapproval.options.methods
+//     instead of in its disapprove section
+//
+// Comments and anchors in the content are not preserved.
+func Upgrade(b []byte) ([]byte, []Change, error) {
+	var doc yaml.MapSlice
+	if err := unmarshal(b, &doc); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to unmarshal policy")
+	}
+
+	u := &upgrader{}
+	u.upgrade(doc)
+	if len(u.changes) == 0 {
+		return b, nil, nil
+	}
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to marshal upgraded policy")
+	}
+	return out, u.changes, nil
+}
+
+func unmarshal(b []byte, v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("invalid YAML: %v", r)
+		}
+	}()
+	return yaml.Unmarshal(b, v)
+}
+
+// parseLegacyConfig parses a policy that failed to parse with the current
+// schema. If upgrading the policy does not fix it, it returns the original
+// error.
+func parseLegacyConfig(b []byte, parseErr error) (*Config, error) {
+	upgraded, changes, err := Upgrade(b)
+	if err != nil || len(changes) == 0 {
+		return nil, parseErr
+	}
+
+	var c Config
+	if err := unmarshalStrict(upgraded, &c); err != nil {
+		return nil, parseErr
+	}
+	c.Upgrades = changes
+	return &c, nil
+}
+
+type upgrader struct {
+	changes []Change
+}
+
+func (u *upgrader) record(path, format string, args ...interface{}) {
+	u.changes = append(u.changes, Change{Path: path, Description: fmt.Sprintf(format, args...)})
+}
+
+func (u *upgrader) upgrade(doc yaml.MapSlice) {
+	if i := index(doc, "approval_rules"); i >= 0 {
+		if rules, ok := doc[i].Value.(yaml.MapSlice); ok {
+			list := make([]interface{}, 0, len(rules))
+			for _, item := range rules {
+				rule, _ := item.Value.(yaml.MapSlice)
+				list = append(list, append(yaml.MapSlice{{Key: "name", Value: item.Key}}, rule...))
+			}
+			doc[i].Value = list
+			u.record("approval_rules", "converted the mapping of rule names to a list of rules with names")
+		}
+
+		rules, _ := doc[i].Value.([]interface{})
+		for n, r := range rules {
+			if rule, ok := r.(yaml.MapSlice); ok {
+				u.upgradeRule(fmt.Sprintf("approval_rules[%d]", n), rule)
+			}
+		}
+	}
+
+	if i := index(doc, "policy"); i >= 0 {
+		p, _ := doc[i].Value.(yaml.MapSlice)
+		if j := index(p, "approval"); j >= 0 {
+			if name, ok := p[j].Value.(string); ok {
+				p[j].Value = []interface{}{name}
+				u.record("policy.approval", "converted the rule name %q to a list", name)
+			}
+		}
+		if j := index(p, "disapproval"); j >= 0 {
+			if d, ok := p[j].Value.(yaml.MapSlice); ok {
+				u.upgradeDisapproval("policy.disapproval", d)
+			}
+		}
+	}
+}
+
+func (u *upgrader) upgradeRule(path string, rule yaml.MapSlice) {
+	for _, key := range []string{"if", "requires"} {
+		if i := index(rule, key); i >= 0 {
+			if m, ok := rule[i].Value.(yaml.MapSlice); ok {
+				u.upgradeLists(path+"."+key, m)
+			}
+		}
+	}
+
+	i := index(rule, "options")
+	if i < 0 {
+		return
+	}
+	options, _ := rule[i].Value.(yaml.MapSlice)
+	for j, item := range options {
+		key, _ := item.Key.(string)
+		if name, ok := renamedOptions[key]; ok && index(options, name) < 0 {
+			options[j].Key = name
+			u.record(path+".options", "renamed %s to %s", key, name)
+		}
+	}
+	if j := index(options, "methods"); j >= 0 {
+		if m, ok := options[j].Value.(yaml.MapSlice); ok {
+			u.upgradeLists(path+".options.methods", m)
+		}
+	}
+}
+
+func (u *upgrader) upgradeDisapproval(path string, d yaml.MapSlice) {
+	if i := index(d, "requires"); i >= 0 {
+		if m, ok := d[i].Value.(yaml.MapSlice); ok {
+			u.upgradeLists(path+".requires", m)
+		}
+	}
+
+	i := index(d, "options")
+	if i < 0 {
+		return
+	}
+	options, _ := d[i].Value.(yaml.MapSlice)
+	j := index(options, "methods")
+	if j < 0 {
+		return
+	}
+	methods, _ := options[j].Value.(yaml.MapSlice)
+
+	var flat, nested yaml.MapSlice
+	for _, item := range methods {
+		switch item.Key {
+		case "comments", "comments_ignore_case", "github_review", "tracking":
+			flat = append(flat, item)
+		default:
+			nested = append(nested, item)
+		}
+	}
+	if len(flat) > 0 && index(methods, "disapprove") < 0 {
+		options[j].Value = append(yaml.MapSlice{{Key: "disapprove", Value: flat}}, nested...)
+		u.record(path+".options.methods", "moved the disapproval methods to the disapprove section")
+	}
+
+	methods, _ = options[j].Value.(yaml.MapSlice)
+	for _, key := range []string{"disapprove", "revoke"} {
+		if k := index(methods, key); k >= 0 {
+			if m, ok := methods[k].Value.(yaml.MapSlice); ok {
+				u.upgradeLists(path+".options.methods."+key, m)
+			}
+		}
+	}
+}
+
+// upgradeLists converts scalar values of list keys to lists in m and in the
+// mappings it contains.
+func (u *upgrader) upgradeLists(path string, m yaml.MapSlice) {
+	for i, item := range m {
+		key, _ := item.Key.(string)
+		switch v := item.Value.(type) {
+		case yaml.MapSlice:
+			u.upgradeLists(path+"."+key, v)
+		case string:
+			if listKeys[key] {
+				m[i].Value = []interface{}{v}
+				u.record(path+"."+key, "converted %q to a list", v)
+			}
+		}
+	}
+}
+
+func index(m yaml.MapSlice, key string) int {
+	for i, item := range m {
+		if item.Key == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const legacyPolicy = `
+policy:
+  approval: review
+  disapproval:
+    requires:
+      teams: org/security
+    options:
+      methods:
+        comments: ["-1"]
+        github_review: true
+        revoke:
+          comments: "+1"
+approval_rules:
+  review:
+    if:
+      changed_files:
+        paths: "^src/.*$"
+    requires:
+      count: 1
+      users: alice
+    options:
+      allow_authors: true
+      invalidate_on_push: true
+`
+
+func TestUpgrade(t *testing.T) {
+	out, changes, err := Upgrade([]byte(legacyPolicy))
+	require.NoError(t, err)
+
+	assert.Equal(t, []Change{
+		{Path: "approval_rules", Description: "converted the mapping of rule names to a list of rules with names"},
+		{Path: "approval_rules[0].if.changed_files.paths", Description: `converted "^src/.*$" to a list`},
+		{Path: "approval_rules[0].requires.users", Description: `converted "alice" to a list`},
+		{Path: "approval_rules[0].options", Description: "renamed allow_authors to allow_author"},
+		{Path: "policy.approval", Description: `converted the rule name "review" to a list`},
+		{Path: "policy.disapproval.requires.teams", Description: `converted "org/security" to a list`},
+		{Path: "policy.disapproval.options.methods", Description: "moved the disapproval methods to the disapprove section"},
+		{Path: "policy.disapproval.options.methods.revoke.comments", Description: `converted "+1" to a list`},
+	}, changes)
+
+	c, err := ParseConfig(out)
+	require.NoError(t, err)
+	assert.Empty(t, c.Upgrades, "upgraded policy should not use legacy constructs")
+
+	_, err = ParsePolicy(c)
+	require.NoError(t, err)
+
+	require.Len(t, c.ApprovalRules, 1)
+	r := c.ApprovalRules[0]
+	assert.Equal(t, "review", r.Name)
+	assert.Equal(t, []string{"^src/.*$"}, r.Predicates.ChangedFiles.Paths)
+	assert.Equal(t, []string{"alice"}, r.Requires.Users)
+	assert.True(t, r.Options.AllowAuthor)
+	assert.True(t, r.Options.InvalidateOnPush)
+
+	assert.Equal(t, []interface{}{"review"}, []interface{}(c.Policy.Approval))
+
+	d := c.Policy.Disapproval
+	assert.Equal(t, []string{"org/security"}, d.Requires.Teams)
+	assert.Equal(t, []string{"-1"}, d.Options.Methods.Disapprove.Comments)
+	assert.True(t, d.Options.Methods.Disapprove.GithubReview)
+	assert.Equal(t, []string{"+1"}, d.Options.Methods.Revoke.Comments)
+}
+
+func TestUpgradeCurrent(t *testing.T) {
+	b := []byte(limitsPolicy)
+
+	out, changes, err := Upgrade(b)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, b, out)
+}
+
+func TestParseConfigLegacy(t *testing.T) {
+	c, err := ParseConfig([]byte(legacyPolicy))
+	require.NoError(t, err)
+	assert.Len(t, c.Upgrades, 8)
+	assert.Equal(t, "review", c.ApprovalRules[0].Name)
+
+	c, err = ParseConfigWithLimits([]byte(legacyPolicy), DefaultLimits)
+	require.NoError(t, err)
+	assert.Len(t, c.Upgrades, 8)
+
+	_, err = ParseConfig([]byte("approval_rules:\n  review:\n    unknown_key: true\n"))
+	assert.EqualError(t, err, "failed to unmarshal policy: yaml: unmarshal errors:\n  line 2: cannot unmarshal !!map into []*approval.Rule")
+}
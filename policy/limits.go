@@ -0,0 +1,372 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+// Limits bound the resources used to parse a policy file. Servers that parse
+// policies written by untrusted repository owners should use
+// ParseConfigWithLimits instead of ParseConfig. A zero value disables the
+// corresponding limit.
+type Limits struct {
+	// MaxSize is the maximum size of a policy file in bytes, both as written
+	// and after expanding YAML aliases.
+	MaxSize int
+
+	// MaxDepth is the maximum nesting depth of YAML collections.
+	MaxDepth int
+
+	// MaxPatternLength is the maximum length of a regular expression used by
+	// a predicate.
+	MaxPatternLength int
+
+	// PatternTimeout is the maximum time to compile a regular expression used
+	// by a predicate.
+	PatternTimeout time.Duration
+}
+
+// DefaultLimits are generous enough for any reasonable policy file.
+var DefaultLimits = Limits{
+	MaxSize:          1 << 20,
+	MaxDepth:         32,
+	MaxPatternLength: 1024,
+	PatternTimeout:   time.Second,
+}
+
+// ParseConfigWithLimits is like ParseConfig, but rejects content that exceeds
+// the limits before decoding it and validates the regular expressions used by
+// predicates. It never panics, regardless of the content.
+func ParseConfigWithLimits(b []byte, l Limits) (*Config, error) {
+	if err := l.Check(b); err != nil {
+		return nil, err
+	}
+
+	var c Config
+	if err := unmarshalStrict(b, &c); err != nil {
+		legacy, legacyErr := parseLegacyConfig(b, errors.Wrap(err, "failed to unmarshal policy"))
+		if legacyErr != nil {
+			return nil, legacyErr
+		}
+		c = *legacy
+	}
+
+	for _, r := range c.ApprovalRules {
+		if r == nil {
+			continue
+		}
+		for _, p := range r.Predicates.Patterns() {
+			if err := l.checkPattern(p); err != nil {
+				return nil, errors.WithMessage(err, fmt.Sprintf("invalid predicate in rule %q", r.Name))
+			}
+		}
+	}
+	return &c, nil
+}
+
+// ParseWithLimits is like Parse, but uses ParseConfigWithLimits.
+func ParseWithLimits(b []byte, l Limits) (common.Evaluator, error) {
+	c, err := ParseConfigWithLimits(b, l)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(c)
+}
+
+// Check returns an error if the content of a policy file exceeds the size or
+// depth limits. It scans the content without decoding it, so it is safe to
+// call before any other function that parses the content, like
+// IsRemoteConfig.
+func (l Limits) Check(b []byte) error {
+	if l.MaxSize > 0 && len(b) > l.MaxSize {
+		return errors.Errorf("policy is %d bytes, which exceeds the limit of %d bytes", len(b), l.MaxSize)
+	}
+	s := &yamlScanner{
+		limits:  l,
+		anchors: make(map[string]*yamlAnchor),
+		prefix:  []int64{0},
+		size:    int64(len(b)),
+	}
+	return s.scan(b)
+}
+
+func (l Limits) checkPattern(p string) error {
+	if l.MaxPatternLength > 0 && len(p) > l.MaxPatternLength {
+		return errors.Errorf("pattern is %d characters, which exceeds the limit of %d characters", len(p), l.MaxPatternLength)
+	}
+
+	compile := func() error {
+		_, err := regexp.Compile(p)
+		return errors.Wrapf(err, "invalid pattern %q", p)
+	}
+	if l.PatternTimeout <= 0 {
+		return compile()
+	}
+
+	// compilation can't be canceled, but the goroutine finishes eventually
+	// and the length limit bounds the work it does
+	done := make(chan error, 1)
+	go func() { done <- compile() }()
+
+	timer := time.NewTimer(l.PatternTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errors.Errorf("pattern %q took longer than %s to compile", p, l.PatternTimeout)
+	}
+}
+
+func unmarshalStrict(b []byte, v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("invalid YAML: %v", r)
+		}
+	}()
+	return yaml.UnmarshalStrict(b, v)
+}
+
+// yamlAnchor is the extent of a node with an anchor. The extent is an
+// approximation that may include content after the node, but never excludes
+// content of the node.
+type yamlAnchor struct {
+	start, end int
+	open       bool
+
+	// indent is the indentation of the line with the anchor and flowDepth is
+	// the number of unclosed flow collections before the anchor
+	indent    int
+	flowDepth int
+}
+
+// yamlScanner finds the nesting depth and the anchors and aliases of a YAML
+// document without decoding it. The decoder expands aliases, so a small
+// document with nested aliases can expand to billions of nodes; the scanner
+// computes the expanded size from the extent of each anchor and rejects
+// documents that exceed the size limit.
+type yamlScanner struct {
+	limits Limits
+
+	anchors map[string]*yamlAnchor
+	open    []*yamlAnchor
+
+	// aliases are the offsets of all aliases and prefix[i] is the expanded
+	// size of the first i aliases
+	aliases []int
+	prefix  []int64
+	size    int64
+}
+
+var blockScalarPattern = regexp.MustCompile(`^[|>][-+0-9]*$`)
+
+func (s *yamlScanner) scan(b []byte) error {
+	var (
+		indents      []int
+		flowDepth    int
+		quote        byte
+		scalarIndent = -1
+	)
+
+	for offset := 0; offset < len(b); {
+		lineStart := offset
+		lineEnd := bytes.IndexByte(b[offset:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(b)
+		} else {
+			lineEnd += offset
+		}
+		line := b[lineStart:lineEnd]
+		offset = lineEnd + 1
+
+		indent := 0
+		for indent < len(line) && line[indent] == ' ' {
+			indent++
+		}
+
+		if quote == 0 && flowDepth == 0 {
+			content := bytes.TrimSpace(line)
+			if scalarIndent >= 0 {
+				if len(content) == 0 || indent > scalarIndent {
+					continue
+				}
+				scalarIndent = -1
+			}
+			if len(content) == 0 || content[0] == '#' {
+				continue
+			}
+
+			s.closeBlock(indent, lineStart)
+
+			for len(indents) > 0 && indents[len(indents)-1] >= indent {
+				indents = indents[:len(indents)-1]
+			}
+			indents = append(indents, indent)
+
+			// each sequence indicator on the line starts a nested collection
+			for i := indent; i < len(line) && line[i] == '-' && (i+1 == len(line) || isYAMLSpace(line[i+1])); {
+				for i++; i < len(line) && isYAMLSpace(line[i]); i++ {
+				}
+				indents = append(indents, i)
+			}
+			if err := s.checkDepth(len(indents)); err != nil {
+				return err
+			}
+		}
+
+		comment := len(line)
+	chars:
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			if quote != 0 {
+				switch {
+				case quote == '"' && c == '\\':
+					i++
+				case quote == '\'' && c == '\'' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+				case c == quote:
+					quote = 0
+				}
+				continue
+			}
+
+			tokenStart := i == 0 || isYAMLSpace(line[i-1]) || bytes.IndexByte([]byte("[{,"), line[i-1]) >= 0
+			switch {
+			case c == '#' && (i == 0 || isYAMLSpace(line[i-1])):
+				comment = i
+				break chars
+			case (c == '"' || c == '\'') && tokenStart:
+				quote = c
+			case c == '[' || c == '{':
+				flowDepth++
+				if err := s.checkDepth(len(indents) + flowDepth); err != nil {
+					return err
+				}
+			case c == ']' || c == '}':
+				if flowDepth > 0 {
+					flowDepth--
+				}
+				s.closeFlow(flowDepth+1, lineStart+i)
+			case c == ',' && flowDepth > 0:
+				s.closeFlow(flowDepth, lineStart+i)
+			case (c == '&' || c == '*') && tokenStart:
+				j := i + 1
+				for j < len(line) && !isYAMLSpace(line[j]) && bytes.IndexByte([]byte(",[]{}"), line[j]) < 0 {
+					j++
+				}
+				if name := string(line[i+1 : j]); name != "" {
+					if c == '&' {
+						s.anchor(name, lineStart+i, indent, flowDepth)
+					} else if err := s.alias(name, lineStart+i); err != nil {
+						return err
+					}
+				}
+				i = j - 1
+			}
+		}
+
+		if quote == 0 && flowDepth == 0 {
+			if fields := bytes.Fields(line[:comment]); len(fields) > 0 && blockScalarPattern.Match(fields[len(fields)-1]) {
+				scalarIndent = indent
+			}
+		}
+	}
+	return nil
+}
+
+func (s *yamlScanner) checkDepth(depth int) error {
+	if s.limits.MaxDepth > 0 && depth > s.limits.MaxDepth {
+		return errors.Errorf("policy exceeds the nesting limit of %d levels", s.limits.MaxDepth)
+	}
+	return nil
+}
+
+func (s *yamlScanner) anchor(name string, offset, indent, flowDepth int) {
+	if s.limits.MaxSize <= 0 {
+		return
+	}
+	a := &yamlAnchor{start: offset, open: true, indent: indent, flowDepth: flowDepth}
+	s.anchors[name] = a
+	s.open = append(s.open, a)
+}
+
+func (s *yamlScanner) alias(name string, offset int) error {
+	a, ok := s.anchors[name]
+	if !ok {
+		return nil
+	}
+
+	end, aliasEnd := a.end, s.aliasIndex(a.end)
+	if a.open {
+		end, aliasEnd = offset, len(s.aliases)
+	}
+	size := int64(end-a.start) + s.prefix[aliasEnd] - s.prefix[s.aliasIndex(a.start)]
+
+	s.aliases = append(s.aliases, offset)
+	s.prefix = append(s.prefix, s.prefix[len(s.prefix)-1]+size)
+
+	s.size += size
+	if s.size > int64(s.limits.MaxSize) {
+		return errors.Errorf("policy exceeds the limit of %d bytes after expanding aliases", s.limits.MaxSize)
+	}
+	return nil
+}
+
+// aliasIndex returns the number of aliases before an offset.
+func (s *yamlScanner) aliasIndex(offset int) int {
+	return sort.SearchInts(s.aliases, offset)
+}
+
+// closeBlock ends the anchors in block collections at a line with the given
+// indentation.
+func (s *yamlScanner) closeBlock(indent, offset int) {
+	s.close(offset, func(a *yamlAnchor) bool {
+		return a.flowDepth == 0 && a.indent >= indent
+	})
+}
+
+// closeFlow ends the anchors in flow collections at least depth levels deep.
+func (s *yamlScanner) closeFlow(depth, offset int) {
+	s.close(offset, func(a *yamlAnchor) bool {
+		return a.flowDepth > 0 && a.flowDepth >= depth
+	})
+}
+
+func (s *yamlScanner) close(offset int, ends func(*yamlAnchor) bool) {
+	open := s.open[:0]
+	for _, a := range s.open {
+		if ends(a) {
+			a.end, a.open = offset, false
+		} else {
+			open = append(open, a)
+		}
+	}
+	s.open = open
+}
+
+func isYAMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
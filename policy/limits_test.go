@@ -0,0 +1,179 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const limitsPolicy = `
+policy:
+  approval:
+    - or:
+      - docs
+      - &review review
+approval_rules:
+  - name: docs
+    if:
+      changed_files:
+        paths: ["^docs/.*$", "^README\\.md$"]
+    requires:
+      count: 1
+      teams: &teams
+        - "palantir/docs"
+  - name: *review
+    requires:
+      count: 2
+      teams: *teams
+`
+
+func TestParseConfigWithLimits(t *testing.T) {
+	c, err := ParseConfigWithLimits([]byte(limitsPolicy), DefaultLimits)
+	require.NoError(t, err)
+	require.Len(t, c.ApprovalRules, 2)
+	assert.Equal(t, "review", c.ApprovalRules[1].Name)
+	assert.Equal(t, []string{"palantir/docs"}, c.ApprovalRules[1].Requires.Teams)
+
+	_, err = ParseWithLimits([]byte(limitsPolicy), DefaultLimits)
+	assert.NoError(t, err)
+}
+
+func TestParseConfigWithLimitsSize(t *testing.T) {
+	_, err := ParseConfigWithLimits([]byte(limitsPolicy), Limits{MaxSize: 100})
+	assert.EqualError(t, err, fmt.Sprintf("policy is %d bytes, which exceeds the limit of 100 bytes", len(limitsPolicy)))
+
+	_, err = ParseConfigWithLimits([]byte(limitsPolicy), Limits{MaxSize: len(limitsPolicy)})
+	assert.EqualError(t, err, fmt.Sprintf("policy exceeds the limit of %d bytes after expanding aliases", len(limitsPolicy)))
+}
+
+func TestParseConfigWithLimitsAliases(t *testing.T) {
+	tests := map[string]string{
+		"block": `
+a: &a ["lol","lol","lol","lol","lol","lol","lol","lol","lol"]
+b: &b [*a,*a,*a,*a,*a,*a,*a,*a,*a]
+c: &c [*b,*b,*b,*b,*b,*b,*b,*b,*b]
+d: &d [*c,*c,*c,*c,*c,*c,*c,*c,*c]
+e: &e [*d,*d,*d,*d,*d,*d,*d,*d,*d]
+f: &f [*e,*e,*e,*e,*e,*e,*e,*e,*e]
+g: &g [*f,*f,*f,*f,*f,*f,*f,*f,*f]
+h: &h [*g,*g,*g,*g,*g,*g,*g,*g,*g]
+i: &i [*h,*h,*h,*h,*h,*h,*h,*h,*h]
+`,
+		"flow": `[&a [lol,lol,lol,lol], &b [*a,*a,*a,*a], &c [*b,*b,*b,*b], &d [*c,*c,*c,*c], &e [*d,*d,*d,*d], &f [*e,*e,*e,*e], &g [*f,*f,*f,*f], &h [*g,*g,*g,*g], &i [*h,*h,*h,*h], &j [*i,*i,*i,*i], &k [*j,*j,*j,*j]]`,
+		"nested": `
+a: &a
+  - lol
+  - lol
+b: &b
+  - *a
+  - *a
+  - *a
+  - *a
+c: &c
+  - - *b
+    - *b
+  - - *b
+    - *b
+d: &d {w: *c, x: *c, y: *c, z: *c}
+e: &e {w: *d, x: *d, y: *d, z: *d}
+f: &f {w: *e, x: *e, y: *e, z: *e}
+g: &g {w: *f, x: *f, y: *f, z: *f}
+h: &h {w: *g, x: *g, y: *g, z: *g}
+`,
+	}
+
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			_, err := ParseConfigWithLimits([]byte(doc), Limits{MaxSize: 64 << 10})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "after expanding aliases")
+			assert.True(t, time.Since(start) < time.Second, "checking the policy took too long")
+		})
+	}
+}
+
+func TestParseConfigWithLimitsDepth(t *testing.T) {
+	flow := strings.Repeat("[", 100) + strings.Repeat("]", 100)
+	_, err := ParseConfigWithLimits([]byte("policy: "+flow), DefaultLimits)
+	assert.EqualError(t, err, "policy exceeds the nesting limit of 32 levels")
+
+	var block strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&block, "%sk%d:\n", strings.Repeat(" ", i), i)
+	}
+	_, err = ParseConfigWithLimits([]byte(block.String()), DefaultLimits)
+	assert.EqualError(t, err, "policy exceeds the nesting limit of 32 levels")
+
+	sequence := "policy:\n  " + strings.Repeat("- ", 40) + "x"
+	_, err = ParseConfigWithLimits([]byte(sequence), DefaultLimits)
+	assert.EqualError(t, err, "policy exceeds the nesting limit of 32 levels")
+
+	// brackets in quotes, comments, and block scalars are not collections
+	text := "policy: # " + flow + "\n  approval:\n    - '" + flow + "'\napproval_rules:\n  - name: |\n      " + flow + "\n"
+	_, err = ParseConfigWithLimits([]byte(text), DefaultLimits)
+	assert.NoError(t, err)
+}
+
+func TestParseConfigWithLimitsPatterns(t *testing.T) {
+	rule := func(pattern string) []byte {
+		return []byte(fmt.Sprintf("approval_rules:\n  - name: rule\n    if:\n      targets_branch:\n        pattern: %q\n", pattern))
+	}
+
+	_, err := ParseConfigWithLimits(rule("^(develop|release/.*)$"), DefaultLimits)
+	assert.NoError(t, err)
+
+	_, err = ParseConfigWithLimits(rule("^(develop"), DefaultLimits)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid predicate in rule "rule": invalid pattern "^(develop"`)
+
+	_, err = ParseConfigWithLimits(rule(strings.Repeat("a", 2000)), DefaultLimits)
+	assert.EqualError(t, err, `invalid predicate in rule "rule": pattern is 2000 characters, which exceeds the limit of 1024 characters`)
+
+	_, err = ParseConfigWithLimits(rule(strings.Repeat("(a{999}){999}", 3)), Limits{PatternTimeout: time.Nanosecond})
+	assert.Error(t, err)
+}
+
+func TestParseConfigWithLimitsInvalid(t *testing.T) {
+	tests := []string{
+		"approval_rules:\n  -\n",
+		"policy:\n  approval:\n    - 1: [rule]\n",
+		"policy:\n  approval:\n    - or: rule\n",
+		"policy: [\n",
+		"policy: *undefined\n",
+		"a: &a [*a]\n",
+	}
+
+	for _, test := range tests {
+		_, err := ParseWithLimits([]byte(test), DefaultLimits)
+		assert.Error(t, err, "expected an error for %q", test)
+	}
+}
+
+func FuzzParseWithLimits(f *testing.F) {
+	f.Add([]byte(limitsPolicy))
+	f.Add([]byte("policy:\n  approval:\n    - and: [a, {or: [b, c]}]\n"))
+	f.Add([]byte("a: &a [x, x]\nb: &b [*a, *a]\nc: [*b, *b]\n"))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		_, _ = ParseWithLimits(b, DefaultLimits)
+	})
+}
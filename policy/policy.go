@@ -12,12 +12,23 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Package policy parses policy files and evaluates them against pull
+// requests. It does not depend on the server and can be used as a library:
+// parse the content of a policy file with Parse and evaluate the result
+// against any implementation of pull.Context, like the one returned by
+// pull.NewGitHubContext.
+//
+// The functions and types in this package, the common.Result type, and the
+// pull.Context interface are the stable API for embedding the policy engine.
 package policy
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 
 	"github.com/palantir/policy-bot/policy/approval"
 	"github.com/palantir/policy-bot/policy/common"
@@ -35,9 +46,109 @@ type RemoteConfig struct {
 	Ref    string `yaml:"ref"`
 }
 
+// Repository returns the owner and name of the remote repository.
+func (rc RemoteConfig) Repository() (owner, repo string, err error) {
+	parts := strings.Split(rc.Remote, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.Errorf("failed to parse remote config location from %q", rc.Remote)
+	}
+	return parts[0], parts[1], nil
+}
+
+// IsRemoteConfig returns true if the content of a policy file is a reference
+// to a remote policy instead of a policy.
+func IsRemoteConfig(b []byte) bool {
+	var raw map[string]interface{}
+	_ = yaml.Unmarshal(b, &raw)
+
+	_, isRemote := raw["remote"]
+	return isRemote
+}
+
+// ParseRemoteConfig parses the content of a policy file that references a
+// remote policy. It returns an error if the content contains unknown keys or
+// if the remote repository is invalid.
+func ParseRemoteConfig(b []byte) (*RemoteConfig, error) {
+	var rc RemoteConfig
+	if err := yaml.UnmarshalStrict(b, &rc); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal reference to remote policy")
+	}
+	if _, _, err := rc.Repository(); err != nil {
+		return nil, err
+	}
+	return &rc, nil
+}
+
 type Config struct {
 	Policy        Policy           `yaml:"policy"`
 	ApprovalRules []*approval.Rule `yaml:"approval_rules"`
+	AutoMerge     *AutoMerge       `yaml:"auto_merge"`
+	Stacked       *Stacked         `yaml:"stacked"`
+	Drafts        *Drafts          `yaml:"drafts"`
+	Components    []*Component     `yaml:"components"`
+
+	// Upgrades lists the legacy constructs that were upgraded when parsing
+	// the policy. See Upgrade.
+	Upgrades []Change `yaml:"-"`
+}
+
+// rulesByName returns the approval rules of the policy by name. It ignores
+// empty rules, which ParsePolicy rejects.
+func (c *Config) rulesByName() map[string]*approval.Rule {
+	rulesByName := make(map[string]*approval.Rule)
+	for _, r := range c.ApprovalRules {
+		if r != nil {
+			rulesByName[r.Name] = r
+		}
+	}
+	return rulesByName
+}
+
+// AddKeywords adds deployment-wide comment patterns to the approval methods of
+// every rule and to the disapproval methods of the policy.
+func (c *Config) AddKeywords(k common.Keywords) {
+	for _, r := range c.ApprovalRules {
+		if r != nil {
+			r.Options.AddComments(k.Approve)
+		}
+	}
+	if d := c.Policy.Disapproval; d != nil {
+		d.Options.AddComments(k.Disapprove, k.Approve)
+	}
+}
+
+const (
+	MergeMethodMerge  = "merge"
+	MergeMethodSquash = "squash"
+	MergeMethodRebase = "rebase"
+)
+
+// AutoMerge enables merging pull requests when the policy is approved and all
+// other statuses and checks succeed.
+type AutoMerge struct {
+	// Method is the merge method: "merge" (the default), "squash", or
+	// "rebase".
+	Method string `yaml:"method"`
+
+	// Label, if set, limits merging to pull requests with this label.
+	Label string `yaml:"label"`
+}
+
+// Stacked configures the evaluation of stacked pull requests, whose base
+// branch is the head branch of another pull request. See pull.Upstream.
+type Stacked struct {
+	// RequireUpstreamApproval keeps the status of a stacked pull request
+	// pending until the policy of its open upstream pull request is
+	// approved. It is enforced when posting statuses, not by Evaluate.
+	RequireUpstreamApproval bool `yaml:"require_upstream_approval"`
+}
+
+// Drafts configures the evaluation of draft pull requests.
+type Drafts struct {
+	// Pending keeps the status of draft pull requests pending, even if the
+	// approval policy is satisfied. Rules are still evaluated so that the
+	// details show what the pull request needs once it is ready for review.
+	Pending bool `yaml:"pending"`
 }
 
 type Policy struct {
@@ -45,31 +156,85 @@ type Policy struct {
 	Disapproval *disapproval.Policy `yaml:"disapproval"`
 }
 
+// ParseConfig parses the content of a policy file. It returns an error if
+// the content contains unknown keys. Content that uses legacy constructs is
+// upgraded to the current schema and the upgrades are listed in the Upgrades
+// field. Use IsRemoteConfig to check for references to remote policies
+// before parsing.
+func ParseConfig(b []byte) (*Config, error) {
+	var c Config
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return parseLegacyConfig(b, errors.Wrap(err, "failed to unmarshal policy"))
+	}
+	return &c, nil
+}
+
+// Parse parses the content of a policy file and returns an evaluator for the
+// policy.
+func Parse(b []byte) (common.Evaluator, error) {
+	c, err := ParseConfig(b)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(c)
+}
+
+// ParsePolicy returns an evaluator for a parsed policy. It returns an error
+// if the policy references undefined rules or has invalid options.
 func ParsePolicy(c *Config) (common.Evaluator, error) {
-	rulesByName := make(map[string]*approval.Rule)
-	for _, r := range c.ApprovalRules {
-		rulesByName[r.Name] = r
+	if c.AutoMerge != nil {
+		switch c.AutoMerge.Method {
+		case "", MergeMethodMerge, MergeMethodSquash, MergeMethodRebase:
+		default:
+			return nil, errors.Errorf("invalid auto_merge method %q", c.AutoMerge.Method)
+		}
 	}
 
+	for i, r := range c.ApprovalRules {
+		if r == nil {
+			return nil, errors.Errorf("approval rule %d is empty", i+1)
+		}
+		if err := r.Options.GetMethods().Validate(); err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("invalid methods in rule %q", r.Name))
+		}
+		if rr := r.Options.RequestReview; rr != nil {
+			if err := rr.Validate(); err != nil {
+				return nil, errors.WithMessage(err, fmt.Sprintf("invalid options in rule %q", r.Name))
+			}
+		}
+	}
+	rulesByName := c.rulesByName()
+
 	evalApproval, err := c.Policy.Approval.Parse(rulesByName)
 	if err != nil {
 		return nil, errors.WithMessage(err, "failed to parse approval policy")
 	}
 
+	if _, err := parseComponents(c, rulesByName); err != nil {
+		return nil, err
+	}
+
 	evalDisapproval := c.Policy.Disapproval
 	if evalDisapproval == nil {
 		evalDisapproval = &disapproval.Policy{}
 	}
+	for _, m := range []*common.Methods{evalDisapproval.Options.GetDisapproveMethods(), evalDisapproval.Options.GetRevokeMethods()} {
+		if err := m.Validate(); err != nil {
+			return nil, errors.WithMessage(err, "invalid disapproval methods")
+		}
+	}
 
 	return evaluator{
 		approval:    evalApproval,
 		disapproval: evalDisapproval,
+		drafts:      c.Drafts,
 	}, nil
 }
 
 type evaluator struct {
 	approval    common.Evaluator
 	disapproval common.Evaluator
+	drafts      *Drafts
 }
 
 func (e evaluator) Evaluate(ctx context.Context, prctx pull.Context) (res common.Result) {
@@ -79,20 +244,41 @@ func (e evaluator) Evaluate(ctx context.Context, prctx pull.Context) (res common
 	res.Name = "policy"
 	res.Children = []*common.Result{&approval, &disapproval}
 
+	// if a GitHub API is unavailable, the known parts of the policy may still
+	// determine the result: a disapproval or a pending approval is final
+	unknown := true
 	for _, r := range res.Children {
 		if r.Error != nil {
 			res.Error = r.Error
+			unknown = unknown && pull.IsUnavailable(r.Error)
 		}
 	}
 
 	switch {
-	case res.Error != nil:
-	case disapproval.Status == common.StatusDisapproved:
+	case res.Error != nil && !unknown:
+	case disapproval.Error == nil && disapproval.Status == common.StatusDisapproved:
+		res.Error = nil
 		res.Status = common.StatusDisapproved
-		res.Description = disapproval.Description
+		res.Description, res.Message = disapproval.Description, disapproval.Message
+	case approval.Error == nil && approval.Status == common.StatusPending:
+		res.Error = nil
+		res.Status = common.StatusPending
+		res.Description, res.Message = approval.Description, approval.Message
+	case res.Error != nil:
 	default:
 		res.Status = approval.Status
-		res.Description = approval.Description
+		res.Description, res.Message = approval.Description, approval.Message
+	}
+
+	if e.drafts != nil && e.drafts.Pending && res.Error == nil && res.Status == common.StatusApproved {
+		draft, err := prctx.IsDraft()
+		switch {
+		case err != nil:
+			res.Error = err
+		case draft:
+			res.Status = common.StatusPending
+			res.Describe(common.NewMessage(common.MessageDraft, nil))
+		}
 	}
 	return
 }
@@ -89,6 +89,56 @@ func TestEvaluator(t *testing.T) {
 		assert.Equal(t, common.StatusSkipped, r.Status)
 	})
 
+	t.Run("disapprovalWinsWhenApprovalUnknown", func(t *testing.T) {
+		eval := evaluator{
+			approval: &StaticEvaluator{
+				Error: &pull.UnavailableError{API: "GraphQL", Err: errors.New("502 Bad Gateway")},
+			},
+			disapproval: &StaticEvaluator{
+				Status:      common.StatusDisapproved,
+				Description: "disapproved by test",
+			},
+		}
+
+		r := eval.Evaluate(ctx, prctx)
+		require.NoError(t, r.Error)
+
+		assert.Equal(t, common.StatusDisapproved, r.Status)
+		assert.Equal(t, "disapproved by test", r.Description)
+	})
+
+	t.Run("pendingWhenDisapprovalUnknown", func(t *testing.T) {
+		eval := evaluator{
+			approval: &StaticEvaluator{
+				Status:      common.StatusPending,
+				Description: "2 approvals needed",
+			},
+			disapproval: &StaticEvaluator{
+				Error: &pull.UnavailableError{API: "REST", Err: errors.New("502 Bad Gateway")},
+			},
+		}
+
+		r := eval.Evaluate(ctx, prctx)
+		require.NoError(t, r.Error)
+
+		assert.Equal(t, common.StatusPending, r.Status)
+		assert.Equal(t, "2 approvals needed", r.Description)
+	})
+
+	t.Run("unknownBlocksApproval", func(t *testing.T) {
+		eval := evaluator{
+			approval: &StaticEvaluator{
+				Status: common.StatusApproved,
+			},
+			disapproval: &StaticEvaluator{
+				Error: &pull.UnavailableError{API: "REST", Err: errors.New("502 Bad Gateway")},
+			},
+		}
+
+		r := eval.Evaluate(ctx, prctx)
+		assert.True(t, pull.IsUnavailable(r.Error), "error is not unavailable")
+	})
+
 	t.Run("setsProperties", func(t *testing.T) {
 		eval := evaluator{
 			approval: &StaticEvaluator{
@@ -113,3 +163,266 @@ func TestEvaluator(t *testing.T) {
 func castToResult(e common.Evaluator) *common.Result {
 	return (*common.Result)(e.(*StaticEvaluator))
 }
+
+func TestParsePolicyAutoMerge(t *testing.T) {
+	_, err := ParsePolicy(&Config{
+		AutoMerge: &AutoMerge{Method: MergeMethodSquash, Label: "automerge"},
+	})
+	require.NoError(t, err)
+
+	_, err = ParsePolicy(&Config{
+		AutoMerge: &AutoMerge{Method: "fast-forward"},
+	})
+	assert.EqualError(t, err, `invalid auto_merge method "fast-forward"`)
+}
+
+func TestParsePolicyRequestReview(t *testing.T) {
+	_, err := Parse([]byte(`
+policy:
+  approval:
+    - review
+approval_rules:
+  - name: review
+    options:
+      request_review:
+        mode: random
+        count: 2
+`))
+	require.NoError(t, err)
+
+	_, err = Parse([]byte(`
+policy:
+  approval:
+    - review
+approval_rules:
+  - name: review
+    options:
+      request_review:
+        mode: random
+`))
+	assert.EqualError(t, err, `invalid options in rule "review": request_review count must be positive in random mode`)
+}
+
+func TestEvaluatorDrafts(t *testing.T) {
+	ctx := context.Background()
+
+	e, err := Parse([]byte(`
+drafts:
+  pending: true
+policy:
+  approval:
+    - no review
+approval_rules:
+  - name: no review
+`))
+	require.NoError(t, err)
+
+	res := e.Evaluate(ctx, &pulltest.Context{DraftValue: true})
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusPending, res.Status)
+	assert.Equal(t, "Pull request is a draft", res.Description)
+
+	res = e.Evaluate(ctx, &pulltest.Context{})
+	require.NoError(t, res.Error)
+	assert.Equal(t, common.StatusApproved, res.Status)
+
+	res = e.Evaluate(ctx, &pulltest.Context{DraftError: errors.New("draft state unavailable")})
+	assert.EqualError(t, res.Error, "draft state unavailable")
+}
+
+func TestParse(t *testing.T) {
+	ctx := context.Background()
+	prctx := &pulltest.Context{}
+
+	t.Run("valid", func(t *testing.T) {
+		eval, err := Parse([]byte(`
+policy:
+  approval:
+    - no review required
+approval_rules:
+  - name: no review required
+`))
+		require.NoError(t, err)
+
+		r := eval.Evaluate(ctx, prctx)
+		require.NoError(t, r.Error)
+		assert.Equal(t, common.StatusApproved, r.Status)
+	})
+
+	t.Run("unknownKey", func(t *testing.T) {
+		_, err := Parse([]byte(`
+approval_rules:
+  - name: typo
+    requries:
+      count: 1
+`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "field requries not found")
+	})
+
+	t.Run("undefinedRule", func(t *testing.T) {
+		_, err := Parse([]byte(`
+policy:
+  approval:
+    - missing
+`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "policy references undefined rule 'missing'")
+	})
+}
+
+func TestAddKeywords(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+policy:
+  approval:
+    - default
+    - custom
+    - reviews only
+  disapproval:
+    requires:
+      users: ["disapprover"]
+approval_rules:
+  - name: default
+  - name: custom
+    options:
+      methods:
+        comments: ["LGTM"]
+  - name: reviews only
+    options:
+      methods:
+        github_review: true
+`))
+	require.NoError(t, err)
+
+	config.AddKeywords(common.Keywords{
+		Approve:    []string{"approuvé", "LGTM"},
+		Disapprove: []string{"refusé"},
+	})
+
+	assert.Equal(t, []string{":+1:", "👍", "approuvé", "LGTM"}, config.ApprovalRules[0].Options.GetMethods().Comments)
+	assert.True(t, config.ApprovalRules[0].Options.GetMethods().GithubReview)
+	assert.Equal(t, []string{"LGTM", "approuvé"}, config.ApprovalRules[1].Options.GetMethods().Comments)
+	assert.Empty(t, config.ApprovalRules[2].Options.GetMethods().Comments, "comments were enabled for a rule without them")
+
+	d := config.Policy.Disapproval.Options
+	assert.Equal(t, []string{":-1:", "👎", "refusé"}, d.GetDisapproveMethods().Comments)
+	assert.Equal(t, []string{":+1:", "👍", "approuvé", "LGTM"}, d.GetRevokeMethods().Comments)
+
+	// adding the same keywords again does not duplicate them
+	config.AddKeywords(common.Keywords{Approve: []string{"approuvé"}})
+	assert.Equal(t, []string{":+1:", "👍", "approuvé", "LGTM"}, config.ApprovalRules[0].Options.GetMethods().Comments)
+}
+
+func TestEvaluateComponents(t *testing.T) {
+	ctx := context.Background()
+
+	config, err := ParseConfig([]byte(`
+policy:
+  approval:
+    - no review required
+components:
+  - name: api
+    paths: ["services/api/"]
+    approval:
+      - api review
+  - name: web
+    paths: ["services/web/", "shared/"]
+    approval:
+      - no review required
+  - name: docs
+    paths: ["docs/"]
+    approval:
+      - no review required
+approval_rules:
+  - name: no review required
+  - name: api review
+    requires:
+      count: 1
+      users: ["api-owner"]
+`))
+	require.NoError(t, err)
+
+	_, err = ParsePolicy(config)
+	require.NoError(t, err)
+
+	prctx := &pulltest.Context{
+		AuthorValue: "mhaypenny",
+		ChangedFilesValue: []*pull.File{
+			{Filename: "services/api/server.go"},
+			{Filename: "shared/util.go"},
+		},
+	}
+
+	results, err := EvaluateComponents(ctx, config, prctx)
+	require.NoError(t, err)
+	require.Len(t, results, 2, "incorrect number of evaluated components")
+
+	assert.Equal(t, "api", results[0].Name)
+	assert.Equal(t, common.StatusPending, results[0].Result.Status)
+	assert.Equal(t, "web", results[1].Name)
+	assert.Equal(t, common.StatusApproved, results[1].Result.Status)
+
+	prctx.ChangedFilesError = errors.New("files unavailable")
+	_, err = EvaluateComponents(ctx, config, prctx)
+	assert.Error(t, err)
+}
+
+func TestParsePolicyComponents(t *testing.T) {
+	tests := map[string]struct {
+		Components []*Component
+		Error      string
+	}{
+		"noName": {
+			Components: []*Component{{Paths: []string{"api/"}}},
+			Error:      "component 1 has no name",
+		},
+		"noPaths": {
+			Components: []*Component{{Name: "api"}},
+			Error:      `component "api" has no paths`,
+		},
+		"duplicate": {
+			Components: []*Component{
+				{Name: "api", Paths: []string{"api/"}},
+				{Name: "api", Paths: []string{"web/"}},
+			},
+			Error: `component "api" is defined more than once`,
+		},
+		"undefinedRule": {
+			Components: []*Component{
+				{Name: "api", Paths: []string{"api/"}, Approval: []interface{}{"missing"}},
+			},
+			Error: `failed to parse approval policy of component "api"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParsePolicy(&Config{Components: test.Components})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.Error)
+		})
+	}
+}
+
+func TestParseRemoteConfig(t *testing.T) {
+	assert.False(t, IsRemoteConfig([]byte("policy:\n  approval: []\n")))
+	assert.False(t, IsRemoteConfig(nil))
+
+	b := []byte("remote: palantir/policy-bot\npath: policies/default.yml\n")
+	require.True(t, IsRemoteConfig(b))
+
+	rc, err := ParseRemoteConfig(b)
+	require.NoError(t, err)
+	assert.Equal(t, "policies/default.yml", rc.Path)
+
+	owner, repo, err := rc.Repository()
+	require.NoError(t, err)
+	assert.Equal(t, "palantir", owner)
+	assert.Equal(t, "policy-bot", repo)
+
+	_, err = ParseRemoteConfig([]byte("remote: policy-bot\n"))
+	assert.EqualError(t, err, `failed to parse remote config location from "policy-bot"`)
+
+	_, err = ParseRemoteConfig([]byte("remote: palantir/policy-bot\nbranch: develop\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,244 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policytest runs test cases for a policy. Each test case describes
+// a synthetic pull request and the expected outcome of the policy, so policy
+// authors can check changes to a policy in their own CI.
+package policytest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// Suite is a set of test cases for a policy.
+type Suite struct {
+	// Policy is the path of the policy file, relative to the suite file
+	Policy string `yaml:"policy"`
+	Cases  []Case `yaml:"cases"`
+
+	config *policy.Config
+}
+
+// Case is a synthetic pull request and the expected outcome of the policy.
+type Case struct {
+	Name        string         `yaml:"name"`
+	PullRequest pull.Synthetic `yaml:"pull_request"`
+	Expect      Expectation    `yaml:"expect"`
+}
+
+// Expectation is the expected outcome of a test case. Empty values are not
+// checked.
+type Expectation struct {
+	// Status is the status of the policy: "approved", "pending",
+	// "disapproved", "skipped", or "error"
+	Status string `yaml:"status"`
+
+	// Rules maps the names of rules to their expected status
+	Rules map[string]string `yaml:"rules"`
+}
+
+// Load reads a suite and the policy it tests.
+func Load(path string) (*Suite, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read test suite")
+	}
+
+	var s Suite
+	if err := yaml.UnmarshalStrict(b, &s); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse test suite %s", path)
+	}
+	if s.Policy == "" {
+		return nil, errors.Errorf("test suite %s does not set a policy", path)
+	}
+	if len(s.Cases) == 0 {
+		return nil, errors.Errorf("test suite %s has no cases", path)
+	}
+
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case %d", i+1)
+		}
+		if err := c.PullRequest.FillDefaults(); err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("invalid pull request in %q", c.Name))
+		}
+	}
+
+	policyPath := s.Policy
+	if !filepath.IsAbs(policyPath) {
+		policyPath = filepath.Join(filepath.Dir(path), policyPath)
+	}
+	pb, err := ioutil.ReadFile(policyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read policy")
+	}
+	if policy.IsRemoteConfig(pb) {
+		return nil, errors.Errorf("policy %s references a remote policy, which cannot be tested", policyPath)
+	}
+	if s.config, err = policy.ParseConfig(pb); err != nil {
+		return nil, errors.WithMessage(err, "invalid policy at "+policyPath)
+	}
+	return &s, nil
+}
+
+// Outcome is the result of a test case.
+type Outcome struct {
+	Case   *Case
+	Result *common.Result
+
+	// Diff lists the differences from the expectation, one per line, with
+	// expected values prefixed by "-" and actual values by "+". It is empty
+	// if the test case passed.
+	Diff []string
+}
+
+// Passed returns true if the outcome matches the expectation.
+func (o *Outcome) Passed() bool {
+	return len(o.Diff) == 0
+}
+
+// Run evaluates the policy for each test case.
+func (s *Suite) Run(ctx context.Context) ([]*Outcome, error) {
+	evaluator, err := policy.ParsePolicy(s.config)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid policy")
+	}
+
+	outcomes := make([]*Outcome, 0, len(s.Cases))
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		result := evaluator.Evaluate(ctx, c.PullRequest.Context())
+		outcomes = append(outcomes, &Outcome{
+			Case:   c,
+			Result: &result,
+			Diff:   diff(c.Expect, &result),
+		})
+	}
+	return outcomes, nil
+}
+
+func diff(expect Expectation, result *common.Result) []string {
+	var lines []string
+	add := func(key, expected, actual, detail string) {
+		if expected == "" || expected == actual {
+			return
+		}
+		if detail != "" {
+			actual += " (" + detail + ")"
+		}
+		lines = append(lines, fmt.Sprintf("-%s: %s", key, expected), fmt.Sprintf("+%s: %s", key, actual))
+	}
+
+	status, detail := resultStatus(result)
+	add("status", expect.Status, status, detail)
+
+	rules := make(map[string]*common.Result)
+	collectRules(result, rules)
+
+	names := make([]string, 0, len(expect.Rules))
+	for name := range expect.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		status, detail := "missing", ""
+		if r, ok := rules[name]; ok {
+			status, detail = resultStatus(r)
+		}
+		add("rules."+name, expect.Rules[name], status, detail)
+	}
+	return lines
+}
+
+// collectRules finds the results of rules in a result tree by name. The
+// "approval" and "disapproval" results are included, so expectations can
+// check either part of the policy.
+func collectRules(r *common.Result, rules map[string]*common.Result) {
+	if _, ok := rules[r.Name]; !ok {
+		rules[r.Name] = r
+	}
+	for _, c := range r.Children {
+		collectRules(c, rules)
+	}
+}
+
+func resultStatus(r *common.Result) (string, string) {
+	if r.Error != nil {
+		return "error", r.Error.Error()
+	}
+	return r.Status.String(), r.Description
+}
+
+// Format returns a readable report of the outcomes, listing the differences
+// for each failed test case.
+func Format(outcomes []*Outcome) string {
+	var sb strings.Builder
+	failed := 0
+	for _, o := range outcomes {
+		if o.Passed() {
+			fmt.Fprintf(&sb, "PASS %s\n", o.Case.Name)
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(&sb, "FAIL %s\n", o.Case.Name)
+		for _, line := range o.Diff {
+			fmt.Fprintf(&sb, "    %s\n", line)
+		}
+	}
+	fmt.Fprintf(&sb, "\n%d passed, %d failed\n", len(outcomes)-failed, failed)
+	return sb.String()
+}
+
+// TestingT is the subset of *testing.T used by Test.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Test loads and runs a suite in a Go test, reporting each failed test case
+// with its differences.
+func Test(t TestingT, path string) {
+	t.Helper()
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	outcomes, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, o := range outcomes {
+		if !o.Passed() {
+			t.Errorf("%s:\n    %s", o.Case.Name, strings.Join(o.Diff, "\n    "))
+		}
+	}
+}
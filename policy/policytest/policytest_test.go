@@ -0,0 +1,54 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policytest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuite(t *testing.T) {
+	Test(t, "testdata/suite.yml")
+}
+
+func TestFailingSuite(t *testing.T) {
+	s, err := Load("testdata/failing.yml")
+	require.NoError(t, err)
+
+	outcomes, err := s.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, outcomes, 1)
+
+	assert.False(t, outcomes[0].Passed())
+	assert.Equal(t, []string{
+		"-status: approved",
+		"+status: pending (0/1 rules approved)",
+		"-rules.code review: approved",
+		"+rules.code review: pending (0/1 approvals required)",
+		"-rules.security review: approved",
+		"+rules.security review: missing",
+	}, outcomes[0].Diff)
+
+	assert.Contains(t, Format(outcomes), "FAIL wrong expectations\n")
+	assert.Contains(t, Format(outcomes), "0 passed, 1 failed\n")
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := Load("testdata/missing.yml")
+	assert.Error(t, err)
+}
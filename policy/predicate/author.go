@@ -30,6 +30,10 @@ type HasAuthorIn struct {
 
 var _ Predicate = &HasAuthorIn{}
 
+func (pred *HasAuthorIn) cost() Cost {
+	return CostMembership
+}
+
 func (pred *HasAuthorIn) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
 	author := prctx.Author()
 
@@ -43,35 +47,98 @@ func (pred *HasAuthorIn) Evaluate(ctx context.Context, prctx pull.Context) (bool
 	return result, desc, err
 }
 
+// AuthorHasPermission is satisfied if the author of the pull request has at
+// least the given permission on the repository: "read", "write", or "admin".
+type AuthorHasPermission string
+
+var _ Predicate = AuthorHasPermission("")
+
+// permissionLevels orders repository permissions from least to most access.
+var permissionLevels = map[string]int{
+	"none":  0,
+	"read":  1,
+	"write": 2,
+	"admin": 3,
+}
+
+// Validate returns an error if the permission is not a known permission.
+func (pred AuthorHasPermission) Validate() error {
+	if _, ok := permissionLevels[string(pred)]; !ok || pred == "none" {
+		return errors.Errorf("invalid permission %q, must be one of read, write, or admin", string(pred))
+	}
+	return nil
+}
+
+func (pred AuthorHasPermission) cost() Cost {
+	return CostMembership
+}
+
+func (pred AuthorHasPermission) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	if err := pred.Validate(); err != nil {
+		return false, "", err
+	}
+
+	perm, err := prctx.AuthorPermission()
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get author permission")
+	}
+
+	if permissionLevels[perm] < permissionLevels[string(pred)] {
+		desc := fmt.Sprintf("The pull request author %q does not have %s permission", prctx.Author(), string(pred))
+		return false, desc, nil
+	}
+	return true, "", nil
+}
+
 type HasContributorIn struct {
 	common.Actors `yaml:",inline"`
 }
 
 var _ Predicate = &HasContributorIn{}
 
-func (pred *HasContributorIn) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
-	commits, err := prctx.Commits()
-	if err != nil {
-		return false, "", errors.Wrap(err, "failed to get commits")
-	}
+func (pred *HasContributorIn) cost() Cost {
+	return CostCommits
+}
 
-	users := make(map[string]struct{})
-	users[prctx.Author()] = struct{}{}
+func (pred *HasContributorIn) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	checked := make(map[string]bool)
+	isActor := func(users ...string) (bool, error) {
+		for _, u := range users {
+			if checked[u] {
+				continue
+			}
+			checked[u] = true
 
-	for _, c := range commits {
-		for _, u := range c.Users() {
-			users[u] = struct{}{}
+			member, err := pred.IsActor(ctx, prctx, u)
+			if err != nil || member {
+				return member, err
+			}
 		}
+		return false, nil
 	}
 
-	for user := range users {
-		member, err := pred.IsActor(ctx, prctx, user)
-		if err != nil {
-			return false, "", err
-		}
-		if member {
-			return true, "", nil
+	member, err := isActor(prctx.Author())
+	if err != nil {
+		return false, "", err
+	}
+	if member {
+		return true, "", nil
+	}
+
+	// check commits in chunks so that large pull requests are supported
+	err = prctx.WalkCommits(func(commits []*pull.Commit) (bool, error) {
+		for _, c := range commits {
+			if member, err = isActor(c.Users()...); err != nil || member {
+				return false, err
+			}
 		}
+		return true, nil
+	})
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get commits")
+	}
+	if member {
+		return true, "", nil
 	}
 
 	desc := "No contributors meet the required membership conditions"
@@ -82,20 +149,32 @@ type AuthorIsOnlyContributor bool
 
 var _ Predicate = AuthorIsOnlyContributor(false)
 
+func (pred AuthorIsOnlyContributor) cost() Cost {
+	return CostCommits
+}
+
 func (pred AuthorIsOnlyContributor) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
-	commits, err := prctx.Commits()
+	author := prctx.Author()
+
+	var other *pull.Commit
+	err := prctx.WalkCommits(func(commits []*pull.Commit) (bool, error) {
+		for _, c := range commits {
+			if c.Author != author || (!c.CommittedViaWeb && c.Committer != author) {
+				other = c
+				return false, nil
+			}
+		}
+		return true, nil
+	})
 	if err != nil {
 		return false, "", errors.Wrap(err, "failed to get commits")
 	}
 
-	author := prctx.Author()
-	for _, c := range commits {
-		if c.Author != author || (!c.CommittedViaWeb && c.Committer != author) {
-			if pred {
-				return false, fmt.Sprintf("Commit %.10s was authored or committed by a different user", c.SHA), nil
-			}
-			return true, "", nil
+	if other != nil {
+		if pred {
+			return false, fmt.Sprintf("Commit %.10s was authored or committed by a different user", other.SHA), nil
 		}
+		return true, "", nil
 	}
 
 	if pred {
@@ -18,6 +18,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/palantir/policy-bot/policy/common"
@@ -88,6 +89,51 @@ func TestHasAuthorIn(t *testing.T) {
 	})
 }
 
+func TestAuthorHasPermission(t *testing.T) {
+	p := AuthorHasPermission("write")
+
+	runAuthorTests(t, p, []AuthorTestCase{
+		{
+			"admin",
+			true,
+			&pulltest.Context{
+				AuthorValue:           "mhaypenny",
+				AuthorPermissionValue: "admin",
+			},
+		},
+		{
+			"write",
+			true,
+			&pulltest.Context{
+				AuthorValue:           "mhaypenny",
+				AuthorPermissionValue: "write",
+			},
+		},
+		{
+			"read",
+			false,
+			&pulltest.Context{
+				AuthorValue:           "ttest",
+				AuthorPermissionValue: "read",
+			},
+		},
+		{
+			"none",
+			false,
+			&pulltest.Context{
+				AuthorValue:           "ttest",
+				AuthorPermissionValue: "none",
+			},
+		},
+	})
+
+	_, _, err := AuthorHasPermission("maintain").Evaluate(context.Background(), &pulltest.Context{})
+	assert.Error(t, err, "unknown permissions should be rejected")
+
+	_, _, err = p.Evaluate(context.Background(), &pulltest.Context{AuthorPermissionError: errors.New("rate limited")})
+	assert.Error(t, err)
+}
+
 func TestHasContributorIn(t *testing.T) {
 	p := &HasContributorIn{
 		common.Actors{
@@ -30,6 +30,10 @@ type TargetsBranch struct {
 
 var _ Predicate = &TargetsBranch{}
 
+func (pred *TargetsBranch) cost() Cost {
+	return CostLocal
+}
+
 func (pred *TargetsBranch) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
 	pattern, err := regexp.Compile(pred.Pattern)
 	if err != nil {
@@ -0,0 +1,104 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// FileContents is satisfied if the content of any changed file that matches
+// Paths matches the patterns. Deleted files are ignored. Each matching file
+// is loaded separately, so Paths should be as specific as possible.
+type FileContents struct {
+	Paths []string `yaml:"paths"`
+
+	// AddedOnly limits the files to those added by the pull request
+	AddedOnly bool `yaml:"added_only"`
+
+	TextPatterns `yaml:",inline"`
+}
+
+var _ Predicate = &FileContents{}
+
+func (pred *FileContents) cost() Cost {
+	return CostContents
+}
+
+// Patterns returns all regular expressions.
+func (pred *FileContents) Patterns() []string {
+	return append(append([]string(nil), pred.Paths...), pred.TextPatterns.Patterns()...)
+}
+
+func (pred *FileContents) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	paths, err := pathsToRegexps(pred.Paths)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to parse paths")
+	}
+	matches, notMatches, err := pred.compile("content")
+	if err != nil {
+		return false, "", err
+	}
+
+	files, err := prctx.ChangedFiles()
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to list changed files")
+	}
+
+	var matched []string
+	for _, f := range files {
+		if f.Status == pull.FileDeleted || (pred.AddedOnly && f.Status != pull.FileAdded) {
+			continue
+		}
+		if anyMatches(paths, f.Filename) {
+			matched = append(matched, f.Filename)
+		}
+	}
+
+	// with more than one file, load all contents at once; if this fails, the
+	// loop below loads each file individually instead
+	if p, ok := prctx.(pull.ContentPrefetcher); ok && len(matched) > 1 {
+		if err := p.PrefetchFileContents(matched); err != nil {
+			zerolog.Ctx(ctx).Debug().Err(err).Msg("Failed to prefetch file contents")
+		}
+	}
+
+	// a file that is too large to load does not decide the predicate if the
+	// content of another file matches
+	var tooLarge error
+	for _, path := range matched {
+		content, err := prctx.FileContent(path)
+		if err != nil {
+			if pull.IsTooLarge(err) {
+				tooLarge = err
+				continue
+			}
+			return false, "", errors.Wrapf(err, "failed to load content of %s", path)
+		}
+		if content != nil && textMatches(matches, notMatches, string(content)) {
+			return true, "", nil
+		}
+	}
+	if tooLarge != nil {
+		return false, "", tooLarge
+	}
+
+	desc := "No changed file contents match the patterns"
+	return false, desc, nil
+}
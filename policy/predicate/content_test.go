@@ -0,0 +1,94 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+func TestFileContents(t *testing.T) {
+	prctx := &pulltest.Context{
+		ChangedFilesValue: []*pull.File{
+			{Filename: "Dockerfile", Status: pull.FileModified},
+			{Filename: "server/new.go", Status: pull.FileAdded},
+			{Filename: "server/old.go", Status: pull.FileModified},
+			{Filename: "server/gone.go", Status: pull.FileDeleted},
+		},
+		FileContents: map[string]string{
+			"Dockerfile":     "FROM golang:latest\nRUN make\n",
+			"server/new.go":  "package server\n",
+			"server/old.go":  "// Copyright 2018 Palantir\npackage server\n",
+			"server/gone.go": "FROM golang:latest\n",
+		},
+	}
+
+	tests := map[string]struct {
+		Pred     FileContents
+		Expected bool
+	}{
+		"matches": {
+			FileContents{Paths: []string{"Dockerfile$"}, TextPatterns: TextPatterns{Matches: []string{"(?m)^FROM .*:latest$"}}},
+			true,
+		},
+		"noMatch": {
+			FileContents{Paths: []string{"Dockerfile$"}, TextPatterns: TextPatterns{Matches: []string{"FROM .*:1\\.12"}}},
+			false,
+		},
+		"notMatches": {
+			FileContents{Paths: []string{"\\.go$"}, TextPatterns: TextPatterns{NotMatches: []string{"Copyright"}}},
+			true,
+		},
+		"addedOnly": {
+			FileContents{Paths: []string{"server/old\\.go$"}, AddedOnly: true, TextPatterns: TextPatterns{NotMatches: []string{"Copyright"}}},
+			false,
+		},
+		"ignoresDeleted": {
+			FileContents{Paths: []string{"gone\\.go$"}, TextPatterns: TextPatterns{Matches: []string{"latest"}}},
+			false,
+		},
+		"noPaths": {
+			FileContents{TextPatterns: TextPatterns{Matches: []string{"latest"}}},
+			false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ok, desc, err := test.Pred.Evaluate(context.Background(), prctx)
+			require.NoError(t, err)
+			assert.Equal(t, test.Expected, ok)
+			if !ok {
+				assert.Equal(t, "No changed file contents match the patterns", desc)
+			}
+		})
+	}
+
+	prctx.FileContentError = errors.New("rate limited")
+	pred := FileContents{Paths: []string{"Dockerfile$"}, TextPatterns: TextPatterns{Matches: []string{"latest"}}}
+	_, _, err := pred.Evaluate(context.Background(), prctx)
+	assert.Error(t, err)
+
+	prctx.FileContentError = &pull.TooLargeError{Kind: "file", Path: "Dockerfile", Max: pull.MaxFileContentSize}
+	_, _, err = pred.Evaluate(context.Background(), prctx)
+	assert.True(t, pull.IsTooLarge(err), "expected too large error, got: %v", err)
+}
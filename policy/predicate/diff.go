@@ -0,0 +1,102 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// ModifiedContent is satisfied if a line added by the pull request matches
+// any of the Added patterns or a line removed by the pull request matches
+// any of the Removed patterns. If Paths is set, only files that match one of
+// the paths are considered. Files without a patch, like binary files or
+// files with very large diffs, never match.
+type ModifiedContent struct {
+	Paths   []string `yaml:"paths"`
+	Added   []string `yaml:"added"`
+	Removed []string `yaml:"removed"`
+}
+
+var _ Predicate = &ModifiedContent{}
+
+func (pred *ModifiedContent) cost() Cost {
+	return CostFiles
+}
+
+// Patterns returns all regular expressions.
+func (pred *ModifiedContent) Patterns() []string {
+	var patterns []string
+	patterns = append(patterns, pred.Paths...)
+	patterns = append(patterns, pred.Added...)
+	patterns = append(patterns, pred.Removed...)
+	return patterns
+}
+
+func (pred *ModifiedContent) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	paths, err := pathsToRegexps(pred.Paths)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to parse paths")
+	}
+	added, err := pathsToRegexps(pred.Added)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to parse added patterns")
+	}
+	removed, err := pathsToRegexps(pred.Removed)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to parse removed patterns")
+	}
+
+	files, err := prctx.ChangedFiles()
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to list changed files")
+	}
+
+	for _, f := range files {
+		if len(paths) > 0 && !anyMatches(paths, f.Filename) {
+			continue
+		}
+		if patchMatches(f.Patch, added, removed) {
+			return true, "", nil
+		}
+	}
+
+	desc := "No added or removed lines match the required patterns"
+	return false, desc, nil
+}
+
+// patchMatches returns true if an added line in the unified diff matches
+// one of the added patterns or a removed line matches one of the removed
+// patterns. The leading "+" or "-" is not part of the matched line.
+func patchMatches(patch string, added, removed []*regexp.Regexp) bool {
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			if anyMatches(added, line[1:]) {
+				return true
+			}
+		case strings.HasPrefix(line, "-"):
+			if anyMatches(removed, line[1:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
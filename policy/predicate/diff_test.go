@@ -0,0 +1,87 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"testing"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+func TestModifiedContent(t *testing.T) {
+	patch := "@@ -10,3 +10,3 @@ package config\n const (\n-\tEnableBeta = true\n+\tSECURITY_LEVEL = 2\n )"
+
+	p := &ModifiedContent{
+		Added: []string{"SECURITY_"},
+	}
+
+	runFileTests(t, p, []FileTestCase{
+		{
+			"empty",
+			false,
+			[]*pull.File{},
+		},
+		{
+			"addedLine",
+			true,
+			[]*pull.File{
+				{Filename: "config/config.go", Patch: patch},
+			},
+		},
+		{
+			"removedLine",
+			false,
+			[]*pull.File{
+				{Filename: "config/config.go", Patch: "@@ -1 +0,0 @@\n-SECURITY_LEVEL = 1"},
+			},
+		},
+		{
+			"noPatch",
+			false,
+			[]*pull.File{
+				{Filename: "image.png", Additions: 1},
+			},
+		},
+	})
+
+	p = &ModifiedContent{
+		Paths:   []string{"^config/"},
+		Removed: []string{"^\\s*Enable\\w+ = "},
+	}
+
+	runFileTests(t, p, []FileTestCase{
+		{
+			"removedFlag",
+			true,
+			[]*pull.File{
+				{Filename: "config/config.go", Patch: patch},
+			},
+		},
+		{
+			"otherPath",
+			false,
+			[]*pull.File{
+				{Filename: "server/config.go", Patch: patch},
+			},
+		},
+		{
+			"contextLine",
+			false,
+			[]*pull.File{
+				{Filename: "config/config.go", Patch: "@@ -1,2 +1,2 @@\n EnableBeta = true\n+x"},
+			},
+		},
+	})
+}
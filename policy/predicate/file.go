@@ -31,6 +31,10 @@ type ChangedFiles struct {
 
 var _ Predicate = &ChangedFiles{}
 
+func (pred *ChangedFiles) cost() Cost {
+	return CostFiles
+}
+
 func (pred *ChangedFiles) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
 	paths, err := pathsToRegexps(pred.Paths)
 	if err != nil {
@@ -58,6 +62,10 @@ type OnlyChangedFiles struct {
 
 var _ Predicate = &OnlyChangedFiles{}
 
+func (pred *OnlyChangedFiles) cost() Cost {
+	return CostFiles
+}
+
 func (pred *OnlyChangedFiles) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
 	paths, err := pathsToRegexps(pred.Paths)
 	if err != nil {
@@ -91,6 +99,21 @@ type ModifiedLines struct {
 	Additions ComparisonExpr `yaml:"additions"`
 	Deletions ComparisonExpr `yaml:"deletions"`
 	Total     ComparisonExpr `yaml:"total"`
+
+	// FileTotal is compared to the lines added and deleted in each file. It
+	// matches if any single file matches.
+	FileTotal ComparisonExpr `yaml:"file_total"`
+}
+
+// Expressions returns the non-empty comparison expressions.
+func (pred *ModifiedLines) Expressions() []ComparisonExpr {
+	var exprs []ComparisonExpr
+	for _, expr := range []ComparisonExpr{pred.Additions, pred.Deletions, pred.Total, pred.FileTotal} {
+		if !expr.IsEmpty() {
+			exprs = append(exprs, expr)
+		}
+	}
+	return exprs
 }
 
 type ComparisonExpr string
@@ -136,13 +159,28 @@ func (pred *ModifiedLines) Evaluate(ctx context.Context, prctx pull.Context) (bo
 		deletions += int64(f.Deletions)
 	}
 
-	for expr, v := range map[ComparisonExpr]int64{
-		pred.Additions: additions,
-		pred.Deletions: deletions,
-		pred.Total:     additions + deletions,
+	for _, c := range []struct {
+		expr  ComparisonExpr
+		value int64
+	}{
+		{pred.Additions, additions},
+		{pred.Deletions, deletions},
+		{pred.Total, additions + deletions},
 	} {
-		if !expr.IsEmpty() {
-			ok, err := expr.Evaluate(v)
+		if !c.expr.IsEmpty() {
+			ok, err := c.expr.Evaluate(c.value)
+			if err != nil {
+				return false, "", err
+			}
+			if ok {
+				return true, "", nil
+			}
+		}
+	}
+
+	if !pred.FileTotal.IsEmpty() {
+		for _, f := range files {
+			ok, err := pred.FileTotal.Evaluate(int64(f.Additions + f.Deletions))
 			if err != nil {
 				return false, "", err
 			}
@@ -156,6 +194,10 @@ func (pred *ModifiedLines) Evaluate(ctx context.Context, prctx pull.Context) (bo
 
 var _ Predicate = &ModifiedLines{}
 
+func (pred *ModifiedLines) cost() Cost {
+	return CostFiles
+}
+
 func anyMatches(re []*regexp.Regexp, s string) bool {
 	for _, r := range re {
 		if r.MatchString(s) {
@@ -191,6 +191,44 @@ func TestModifiedLines(t *testing.T) {
 			},
 		},
 	})
+
+	p = &ModifiedLines{
+		Additions: ">50",
+		Deletions: ">50",
+	}
+
+	runFileTests(t, p, []FileTestCase{
+		{
+			"sameExpressionDeletions",
+			true,
+			[]*pull.File{
+				{Additions: 10, Deletions: 60},
+			},
+		},
+	})
+
+	p = &ModifiedLines{
+		FileTotal: ">50",
+	}
+
+	runFileTests(t, p, []FileTestCase{
+		{
+			"fileTotal",
+			true,
+			[]*pull.File{
+				{Additions: 10},
+				{Additions: 30, Deletions: 30},
+			},
+		},
+		{
+			"fileTotalSpread",
+			false,
+			[]*pull.File{
+				{Additions: 20, Deletions: 20},
+				{Additions: 20, Deletions: 20},
+			},
+		},
+	})
 }
 
 func TestComparisonExpr(t *testing.T) {
@@ -0,0 +1,66 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// HasLabels is satisfied if the pull request has a label matching each
+// pattern. Patterns are case-insensitive globs, like "area/*", using the
+// syntax of path.Match.
+type HasLabels []string
+
+var _ Predicate = &HasLabels{}
+
+func (pred HasLabels) cost() Cost {
+	return CostLocal
+}
+
+func (pred HasLabels) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	labels := prctx.Labels()
+
+	for _, pattern := range pred {
+		matched, err := matchesLabel(pattern, labels)
+		if err != nil {
+			return false, "", err
+		}
+		if !matched {
+			return false, fmt.Sprintf("Pull request does not have a label matching %q", pattern), nil
+		}
+	}
+	return true, "", nil
+}
+
+func matchesLabel(pattern string, labels []string) (bool, error) {
+	pattern = strings.ToLower(pattern)
+	for _, label := range labels {
+		matched, err := path.Match(pattern, strings.ToLower(label))
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid label pattern %q", pattern)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
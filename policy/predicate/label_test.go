@@ -0,0 +1,61 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+func TestHasLabels(t *testing.T) {
+	prctx := &pulltest.Context{
+		LabelsValue: []string{"Breaking-Change", "area/server"},
+	}
+
+	tests := map[string]struct {
+		Labels   HasLabels
+		Expected bool
+	}{
+		"exact":           {HasLabels{"breaking-change"}, true},
+		"glob":            {HasLabels{"area/*"}, true},
+		"all":             {HasLabels{"breaking-change", "area/*"}, true},
+		"missing":         {HasLabels{"breaking-change", "security"}, false},
+		"globNoMatch":     {HasLabels{"area/ui*"}, false},
+		"globSingleLevel": {HasLabels{"*"}, true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ok, desc, err := test.Labels.Evaluate(context.Background(), prctx)
+			require.NoError(t, err)
+			assert.Equal(t, test.Expected, ok)
+			if !ok {
+				assert.Contains(t, desc, "does not have a label matching")
+			}
+		})
+	}
+
+	_, _, err := HasLabels{"[a-"}.Evaluate(context.Background(), prctx)
+	assert.Error(t, err)
+
+	ok, _, err := HasLabels{"anything"}.Evaluate(context.Background(), &pulltest.Context{})
+	require.NoError(t, err)
+	assert.False(t, ok, "pull requests without labels should not match")
+}
@@ -16,6 +16,7 @@ package predicate
 
 import (
 	"context"
+	"sort"
 
 	"github.com/palantir/policy-bot/pull"
 )
@@ -25,3 +26,55 @@ type Predicate interface {
 	// optional string providing details about the evaluation result.
 	Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error)
 }
+
+// Cost is the relative cost of evaluating a predicate, based on the pull
+// request data it needs. Cheaper predicates are evaluated first so that rules
+// can be skipped without loading expensive data.
+type Cost int
+
+const (
+	// CostLocal predicates only use data included with the pull request.
+	CostLocal Cost = iota
+
+	// CostMembership predicates check the membership of users, which may
+	// require API requests.
+	CostMembership
+
+	// CostFiles predicates list the files changed by the pull request.
+	CostFiles
+
+	// CostReviews predicates list the comments and reviews on the pull
+	// request.
+	CostReviews
+
+	// CostCommits predicates list the commits in the pull request.
+	CostCommits
+
+	// CostContents predicates load the content of changed files, which
+	// requires an API request for each file.
+	CostContents
+
+	// CostUnknown is the cost of predicates without a known cost. They are
+	// evaluated last.
+	CostUnknown
+)
+
+type coster interface {
+	cost() Cost
+}
+
+// CostOf returns the relative cost of evaluating a predicate.
+func CostOf(p Predicate) Cost {
+	if c, ok := p.(coster); ok {
+		return c.cost()
+	}
+	return CostUnknown
+}
+
+// SortByCost sorts predicates from cheapest to most expensive. Predicates with
+// the same cost keep their relative order.
+func SortByCost(ps []Predicate) {
+	sort.SliceStable(ps, func(i, j int) bool {
+		return CostOf(ps[i]) < CostOf(ps[j])
+	})
+}
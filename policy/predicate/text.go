@@ -0,0 +1,103 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// TextPatterns matches text against regular expressions. It is satisfied if
+// the text matches any of the Matches patterns or if it does not match any of
+// the NotMatches patterns.
+type TextPatterns struct {
+	Matches    []string `yaml:"matches"`
+	NotMatches []string `yaml:"not_matches"`
+}
+
+// Patterns returns all regular expressions.
+func (p *TextPatterns) Patterns() []string {
+	return append(append([]string(nil), p.Matches...), p.NotMatches...)
+}
+
+func (p *TextPatterns) compile(name string) (matches, notMatches []*regexp.Regexp, err error) {
+	if matches, err = pathsToRegexps(p.Matches); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to compile %s pattern", name)
+	}
+	if notMatches, err = pathsToRegexps(p.NotMatches); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to compile %s pattern", name)
+	}
+	return matches, notMatches, nil
+}
+
+func textMatches(matches, notMatches []*regexp.Regexp, text string) bool {
+	return anyMatches(matches, text) || (len(notMatches) > 0 && !anyMatches(notMatches, text))
+}
+
+func (p *TextPatterns) evaluate(name, text string) (bool, string, error) {
+	matches, notMatches, err := p.compile(name)
+	if err != nil {
+		return false, "", err
+	}
+
+	if textMatches(matches, notMatches, text) {
+		return true, "", nil
+	}
+
+	switch {
+	case len(matches) > 0 && len(notMatches) > 0:
+		return false, fmt.Sprintf("The %s does not match a required pattern or matches an excluded pattern", name), nil
+	case len(notMatches) > 0:
+		return false, fmt.Sprintf("The %s matches an excluded pattern", name), nil
+	}
+	return false, fmt.Sprintf("The %s does not match a required pattern", name), nil
+}
+
+// TitleMatches is satisfied if the title of the pull request matches the
+// patterns.
+type TitleMatches struct {
+	TextPatterns `yaml:",inline"`
+}
+
+var _ Predicate = &TitleMatches{}
+
+func (pred *TitleMatches) cost() Cost {
+	return CostLocal
+}
+
+func (pred *TitleMatches) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	return pred.evaluate("title", prctx.Title())
+}
+
+// BodyMatches is satisfied if the description of the pull request matches
+// the patterns.
+type BodyMatches struct {
+	TextPatterns `yaml:",inline"`
+}
+
+var _ Predicate = &BodyMatches{}
+
+func (pred *BodyMatches) cost() Cost {
+	return CostLocal
+}
+
+func (pred *BodyMatches) Evaluate(ctx context.Context, prctx pull.Context) (bool, string, error) {
+	return pred.evaluate("body", prctx.Body())
+}
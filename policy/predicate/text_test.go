@@ -0,0 +1,92 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/pull/pulltest"
+)
+
+func TestTitleMatches(t *testing.T) {
+	tests := map[string]struct {
+		Patterns TextPatterns
+		Title    string
+		Expected bool
+	}{
+		"matches": {
+			TextPatterns{Matches: []string{`^\[HOTFIX\]`}},
+			"[HOTFIX] fix the thing",
+			true,
+		},
+		"doesNotMatch": {
+			TextPatterns{Matches: []string{`^\[HOTFIX\]`}},
+			"fix the thing",
+			false,
+		},
+		"notMatches": {
+			TextPatterns{NotMatches: []string{`^(feat|fix):`}},
+			"update things",
+			true,
+		},
+		"notMatchesExcluded": {
+			TextPatterns{NotMatches: []string{`^(feat|fix):`}},
+			"fix: the thing",
+			false,
+		},
+		"either": {
+			TextPatterns{Matches: []string{`^\[HOTFIX\]`}, NotMatches: []string{`^fix:`}},
+			"fix: the thing",
+			false,
+		},
+		"empty": {
+			TextPatterns{},
+			"anything",
+			false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pred := &TitleMatches{TextPatterns: test.Patterns}
+			ok, desc, err := pred.Evaluate(context.Background(), &pulltest.Context{TitleValue: test.Title})
+			require.NoError(t, err)
+			assert.Equal(t, test.Expected, ok)
+			if !ok {
+				assert.NotEmpty(t, desc)
+			}
+		})
+	}
+
+	_, _, err := (&TitleMatches{TextPatterns{Matches: []string{"("}}}).Evaluate(context.Background(), &pulltest.Context{})
+	assert.Error(t, err)
+}
+
+func TestBodyMatches(t *testing.T) {
+	pred := &BodyMatches{TextPatterns{NotMatches: []string{`(?m)^Ticket: [A-Z]+-[0-9]+$`}}}
+
+	ok, _, err := pred.Evaluate(context.Background(), &pulltest.Context{BodyValue: "Adds a feature.\n\nTicket: ABC-123\n"})
+	require.NoError(t, err)
+	assert.False(t, ok, "body with a ticket should not satisfy the predicate")
+
+	ok, desc, err := pred.Evaluate(context.Background(), &pulltest.Context{BodyValue: "Adds a feature."})
+	require.NoError(t, err)
+	assert.True(t, ok, "body without a ticket should satisfy the predicate")
+	assert.Empty(t, desc)
+}
@@ -15,11 +15,16 @@
 package pull
 
 import (
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // MembershipContext defines methods to get information
-// about about user membership in Github organizations and teams.
+// about about user membership in Github organizations and teams, and in
+// groups managed by external directories.
 type MembershipContext interface {
 	// IsTeamMember returns true if the user is a member of the given team.
 	// Teams are specified as "org-name/team-name".
@@ -30,8 +35,53 @@ type MembershipContext interface {
 
 	// IsCollaborator returns true if the user meets the desiredPerm of the given organzation's repository.
 	IsCollaborator(org, repo, user, desiredPerm string) (bool, error)
+
+	// IsGroupMember returns true if the user is a member of the given
+	// directory group. Groups are specified as "provider-name/group-name".
+	IsGroupMember(group, user string) (bool, error)
+
+	// HasVerifiedSigningKey returns true if the user registered a key that
+	// GitHub uses to verify their commit signatures: a GPG key that can sign
+	// and has a verified email address, or an SSH signing key.
+	HasVerifiedSigningKey(user string) (bool, error)
+}
+
+// MembershipPrefetcher is implemented by membership contexts that can check
+// many memberships of a user at once. After a successful call, checks of the
+// user's membership in the given teams and organizations should not require
+// additional requests.
+type MembershipPrefetcher interface {
+	PrefetchMembership(user string, teams, orgs []string) error
+}
+
+// ContentPrefetcher is implemented by contexts that can load the content of
+// many files at once. After a successful call, FileContent should not require
+// additional requests for the given paths, except for files that could not be
+// loaded together, like binary files.
+type ContentPrefetcher interface {
+	PrefetchFileContents(paths []string) error
+}
+
+// CanonicalLogin returns the canonical form of a GitHub login. GitHub logins
+// are case-insensitive, so logins must be canonicalized before comparing them.
+// Contexts return canonical logins for authors, reviewers, and committers.
+func CanonicalLogin(login string) string {
+	return strings.ToLower(login)
 }
 
+// AppLogin returns the canonical login of the bot user of the GitHub App with
+// the given slug. The slug may include the "[bot]" suffix.
+func AppLogin(slug string) string {
+	return CanonicalLogin(strings.TrimSuffix(slug, botSuffix) + botSuffix)
+}
+
+// IsBotLogin returns true if the login is the bot user of a GitHub App.
+func IsBotLogin(login string) bool {
+	return strings.HasSuffix(login, botSuffix)
+}
+
+const botSuffix = "[bot]"
+
 // Context is the context for a pull request. It defines methods to get
 // information about the pull request and the VCS system containing the pull
 // request (e.g. GitHub).
@@ -53,6 +103,26 @@ type Context interface {
 	// Author returns the username of the user who opened the pull request.
 	Author() string
 
+	// AuthorPermission returns the permission of the author on the
+	// repository: "admin", "write", "read", or "none".
+	AuthorPermission() (string, error)
+
+	// Title returns the title of the pull request.
+	Title() string
+
+	// Body returns the description of the pull request.
+	Body() string
+
+	// Labels returns the names of the labels on the pull request.
+	Labels() []string
+
+	// IsDraft returns true if the pull request is a draft.
+	IsDraft() (bool, error)
+
+	// CreatedAt returns the time when the pull request was opened. It is zero
+	// if the time is not known.
+	CreatedAt() time.Time
+
 	// HeadSHA returns the SHA of the head commit of the pull request.
 	HeadSHA() string
 
@@ -63,12 +133,42 @@ type Context interface {
 	Branches() (base string, head string)
 
 	// ChangedFiles returns the files that were changed in this pull request.
+	// It returns a TooLargeError if the pull request changes more files than
+	// can be listed.
 	ChangedFiles() ([]*File, error)
 
+	// FileContent returns the content of a file at the head commit of the
+	// pull request. It returns nil if the file does not exist at the head
+	// commit, for example because the pull request deletes it. It returns a
+	// TooLargeError if the file is larger than MaxFileContentSize.
+	FileContent(path string) ([]byte, error)
+
+	// BaseFileContent is like FileContent, but returns the content of a file
+	// on the base branch. Use it for files that the pull request must not be
+	// able to change, like CODEOWNERS.
+	BaseFileContent(path string) ([]byte, error)
+
 	// Commits returns the commits that are part of this pull request. The
-	// commit order is implementation dependent.
+	// commit order is implementation dependent. Pushed dates are set when
+	// they are available without additional work, but may be missing. It
+	// returns a TooLargeError if the pull request contains more commits
+	// than can be listed.
 	Commits() ([]*Commit, error)
 
+	// WalkCommits calls fn with successive chunks of the commits in this
+	// pull request until fn returns false or there are no more commits. Use
+	// it instead of Commits to check each commit independently: it also
+	// works for pull requests with more commits than Commits can list. The
+	// commit order and chunk size are implementation dependent, and pushed
+	// dates may be missing.
+	WalkCommits(fn func(chunk []*Commit) (bool, error)) error
+
+	// CommitsWithPushedDates returns the same commits as Commits, but
+	// guarantees that the head commit has a pushed date. Loading pushed
+	// dates may require additional requests, so only callers that use them
+	// should call this method.
+	CommitsWithPushedDates() ([]*Commit, error)
+
 	// Comments lists all comments on a Pull Request. The comment order is
 	// implementation dependent.
 	Comments() ([]*Comment, error)
@@ -76,6 +176,123 @@ type Context interface {
 	// Reviews lists all reviews on a Pull Request. The review order is
 	// implementation dependent.
 	Reviews() ([]*Review, error)
+
+	// Upstream returns the pull request that this pull request is stacked
+	// on, or nil if the pull request is not stacked.
+	Upstream() (*Upstream, error)
+
+	// LinkedIssue returns the comments and reviews of an issue or pull
+	// request that may be in a different repository, like a tracking issue
+	// referenced by this pull request. Issues have no reviews.
+	LinkedIssue(owner, repo string, number int) (*LinkedIssue, error)
+}
+
+// LinkedIssue is the activity on an issue or pull request referenced by a
+// pull request.
+type LinkedIssue struct {
+	Body     string
+	Comments []*Comment
+	Reviews  []*Review
+}
+
+// Upstream is a pull request that another pull request is stacked on. A pull
+// request is stacked if its base branch is the head branch of an open pull
+// request in the same repository. It remains stacked after the upstream pull
+// request merges and the base branch changes to the base branch of the
+// upstream pull request, which GitHub does when it deletes the merged branch.
+type Upstream struct {
+	Number  int
+	HeadSHA string
+
+	// Base is the base branch of the upstream pull request.
+	Base string
+
+	// Merged is true if the upstream pull request merged and the stacked pull
+	// request now targets the same base branch.
+	Merged bool
+}
+
+// TooLargeError is returned when a pull request has more files, commits, or
+// comments than can be listed, or changes a file that is too large to load,
+// so data needed for evaluation is incomplete.
+type TooLargeError struct {
+	// Kind is the kind of data that exceeds the limit: "files", "commits",
+	// "comments", or "file"
+	Kind string
+	Max  int
+
+	// Path is the path of the file that is too large, if Kind is "file"
+	Path string
+}
+
+func (e *TooLargeError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("file %s is too large, maximum size is %d bytes", e.Path, e.Max)
+	}
+	return fmt.Sprintf("too many %s in pull request, maximum is %d", e.Kind, e.Max)
+}
+
+// IsTooLarge returns true if the cause of err is a TooLargeError.
+func IsTooLarge(err error) bool {
+	_, ok := errors.Cause(err).(*TooLargeError)
+	return ok
+}
+
+// HeadMissingError is returned when the commits of a pull request do not
+// include its head commit, usually because the head branch was force-pushed
+// after the pull request was loaded.
+type HeadMissingError struct {
+	SHA string
+}
+
+func (e *HeadMissingError) Error() string {
+	return fmt.Sprintf("head commit %.10s is missing, probably due to a force-push", e.SHA)
+}
+
+// IsHeadMissing returns true if the cause of err is a HeadMissingError.
+func IsHeadMissing(err error) bool {
+	_, ok := errors.Cause(err).(*HeadMissingError)
+	return ok
+}
+
+// UnavailableError is returned when data cannot be loaded because a GitHub
+// API is unavailable or rate limited. Other data may still be available, so
+// callers can evaluate the parts of a policy that do not need this data.
+type UnavailableError struct {
+	// API is the API that failed: "GraphQL" or "REST"
+	API string
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("GitHub %s API is unavailable: %v", e.API, e.Err)
+}
+
+// Cause returns the error from the API, so errors.Cause returns the original
+// error instead of the UnavailableError.
+func (e *UnavailableError) Cause() error {
+	return e.Err
+}
+
+// AsUnavailable returns the first UnavailableError in the chain of causes of
+// err, or nil if there is none.
+func AsUnavailable(err error) *UnavailableError {
+	for err != nil {
+		if u, ok := err.(*UnavailableError); ok {
+			return u
+		}
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			return nil
+		}
+		err = c.Cause()
+	}
+	return nil
+}
+
+// IsUnavailable returns true if err was caused by an UnavailableError.
+func IsUnavailable(err error) bool {
+	return AsUnavailable(err) != nil
 }
 
 type FileStatus int
@@ -91,6 +308,10 @@ type File struct {
 	Status    FileStatus
 	Additions int
 	Deletions int
+
+	// Patch is the unified diff of the file. It is empty for binary files and
+	// for files with diffs that are too large for GitHub to return.
+	Patch string
 }
 
 type Commit struct {
@@ -109,6 +330,37 @@ type Commit struct {
 	// PushedAt is the timestamp when the commit was pushed. It is nil if that
 	// information is not available for this commit.
 	PushedAt *time.Time
+
+	// CommittedAt is the commit timestamp recorded by git. It is set by the
+	// committer and may not match when the commit was pushed.
+	CommittedAt time.Time
+
+	// MessageHeadline is the first line of the commit message.
+	MessageHeadline string
+
+	// Signature is the signature of the commit. It is nil if the commit is
+	// not signed.
+	Signature *Signature
+}
+
+// Signature is a commit signature and the result of its verification by
+// GitHub.
+type Signature struct {
+	// Type is the kind of signature: "GPG", "SMIME", or "SSH". It is empty
+	// if GitHub does not recognize the signature.
+	Type string
+
+	// Valid is true if GitHub verified the signature with a key or
+	// certificate that belongs to the signer.
+	Valid bool
+
+	// State is the verification state reported by GitHub, like "VALID",
+	// "UNKNOWN_KEY", or "UNVERIFIED_EMAIL".
+	State string
+
+	// Signer is the login name of the user who owns the signing key. It is
+	// empty if the key does not belong to a known user.
+	Signer string
 }
 
 // Users returns the login names of the users associated with this commit.
@@ -129,6 +381,9 @@ type Comment struct {
 	Body      string
 }
 
+// CommentFilter returns true if a comment is relevant for evaluation.
+type CommentFilter func(c *Comment) bool
+
 type ReviewState string
 
 const (
@@ -147,4 +402,8 @@ type Review struct {
 
 	// ID is the GitHub node ID of the review, used to resolve dismissals
 	ID string
+
+	// CommitSHA is the head commit of the pull request when the review was
+	// submitted, if known
+	CommitSHA string
 }
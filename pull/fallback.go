@@ -0,0 +1,67 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// PushedDateFallback is the date used as the pushed date of commits when
+// GitHub does not return one.
+type PushedDateFallback string
+
+const (
+	// PushedDateFallbackNone returns an error if a pushed date is missing
+	PushedDateFallbackNone PushedDateFallback = ""
+
+	// PushedDateFallbackCommitted uses the commit date recorded by git. This
+	// date is set by the committer, so it may be earlier than the push and
+	// can be changed by rewriting the commit.
+	PushedDateFallbackCommitted PushedDateFallback = "committed_date"
+)
+
+// UnmarshalYAML rejects unknown fallbacks, so that a typo does not silently
+// disable the fallback.
+func (f *PushedDateFallback) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+
+	switch fallback := PushedDateFallback(name); fallback {
+	case PushedDateFallbackNone, PushedDateFallbackCommitted:
+		*f = fallback
+		return nil
+	}
+	return errors.Errorf("invalid pushed date fallback %q, allowed values: [%s]", name, PushedDateFallbackCommitted)
+}
+
+type pushedDateFallbackKey struct{}
+
+// WithPushedDateFallback returns a context that makes GitHubContexts created
+// with it use the fallback when a pushed date is missing.
+func WithPushedDateFallback(ctx context.Context, fallback PushedDateFallback) context.Context {
+	if fallback == PushedDateFallbackNone {
+		return ctx
+	}
+	return context.WithValue(ctx, pushedDateFallbackKey{}, fallback)
+}
+
+func pushedDateFallback(ctx context.Context) PushedDateFallback {
+	fallback, _ := ctx.Value(pushedDateFallbackKey{}).(PushedDateFallback)
+	return fallback
+}
@@ -0,0 +1,38 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestUnmarshalPushedDateFallback(t *testing.T) {
+	var opts struct {
+		Fallback PushedDateFallback `yaml:"pushed_date_fallback"`
+	}
+
+	require.NoError(t, yaml.UnmarshalStrict([]byte("pushed_date_fallback: committed_date"), &opts))
+	assert.Equal(t, PushedDateFallbackCommitted, opts.Fallback)
+
+	require.NoError(t, yaml.UnmarshalStrict([]byte("pushed_date_fallback: ''"), &opts))
+	assert.Equal(t, PushedDateFallbackNone, opts.Fallback)
+
+	err := yaml.UnmarshalStrict([]byte("pushed_date_fallback: commited_date"), &opts)
+	assert.EqualError(t, err, `invalid pushed date fallback "commited_date", allowed values: [committed_date]`)
+}
@@ -16,8 +16,15 @@ package pull
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/github"
@@ -27,13 +34,35 @@ import (
 )
 
 const (
+	// graphQLPageSize is the number of items requested per page of a GraphQL
+	// connection. When the rate limit is low, queries request
+	// graphQLReducedPageSize items instead, which costs fewer points.
+	graphQLPageSize        = 100
+	graphQLReducedPageSize = 50
+
 	// MaxPullRequestFiles is the max number of files returned by GitHub
 	// https://developer.github.com/v3/pulls/#list-pull-requests-files
 	MaxPullRequestFiles = 300
 
+	// MaxFileContentSize is the max size of a file loaded by FileContent,
+	// which is the largest file the contents API returns
+	// https://developer.github.com/v3/repos/contents/#get-contents
+	MaxFileContentSize = 1024 * 1024
+
+	// contentBatchSize is the maximum number of files loaded by one query in
+	// PrefetchFileContents
+	contentBatchSize = 50
+
+	// MaxWalkedCommits is the max number of commits WalkCommits lists
+	MaxWalkedCommits = 10000
+
 	// MaxPullRequestCommits is the max number of commits returned by GitHub
 	// https://developer.github.com/v3/pulls/#list-commits-on-a-pull-request
 	MaxPullRequestCommits = 250
+
+	// MaxPullRequestComments is the max number of comments kept in memory
+	// after applying the comment filter
+	MaxPullRequestComments = 5000
 )
 
 var (
@@ -52,8 +81,26 @@ type Locator struct {
 	Value *github.PullRequest
 }
 
+var locatorPattern = regexp.MustCompile(`^(?:https?://[^/]+/)?([^/#\s]+)/([^/#\s]+)(?:#|/pull/)(\d+)/?$`)
+
+// ParseLocator parses a pull request reference in the form
+// "owner/repo#number" or a pull request URL.
+func ParseLocator(s string) (Locator, error) {
+	m := locatorPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Locator{}, errors.Errorf("invalid pull request %q, expected owner/repo#number", s)
+	}
+
+	number, err := strconv.Atoi(m[3])
+	if err != nil || number <= 0 {
+		return Locator{}, errors.Errorf("invalid pull request number %q", m[3])
+	}
+	return Locator{Owner: m[1], Repo: m[2], Number: number}, nil
+}
+
 // IsComplete returns true if the locator contains a pull request object with
-// all required fields.
+// all required fields. Optional fields, like the labels and the number of
+// changed files and commits, are used when present in a complete object.
 func (loc Locator) IsComplete() bool {
 	switch {
 	case loc.Value == nil:
@@ -92,17 +139,34 @@ func (loc Locator) toV4(ctx context.Context, client *githubv4.Client) (*v4PullRe
 
 	var v4 v4PullRequest
 	v4.Author.Login = loc.Value.GetUser().GetLogin()
+	v4.Title = loc.Value.GetTitle()
 	v4.IsCrossRepository = loc.Value.GetHead().GetRepo().GetID() != loc.Value.GetBase().GetRepo().GetID()
 	v4.HeadRefOID = loc.Value.GetHead().GetSHA()
 	v4.HeadRefName = loc.Value.GetHead().GetRef()
 	v4.HeadRepository.Name = loc.Value.GetHead().GetRepo().GetName()
 	v4.HeadRepository.Owner.Login = loc.Value.GetHead().GetRepo().GetOwner().GetLogin()
 	v4.BaseRefName = loc.Value.GetBase().GetRef()
+	v4.CreatedAt = loc.Value.GetCreatedAt()
+	v4.Body = loc.Value.GetBody()
+	for _, l := range loc.Value.Labels {
+		v4.Labels.Nodes = append(v4.Labels.Nodes, struct{ Name string }{Name: l.GetName()})
+	}
+
+	// counts are missing from some payloads, like review events
+	v4.ChangedFiles = -1
+	if loc.Value.ChangedFiles != nil {
+		v4.ChangedFiles = loc.Value.GetChangedFiles()
+	}
+	v4.Commits.TotalCount = -1
+	if loc.Value.Commits != nil {
+		v4.Commits.TotalCount = loc.Value.GetCommits()
+	}
 	return &v4, nil
 }
 
 // GitHubContext is a Context implementation that gets information from GitHub.
-// A new instance must be created for each request.
+// A new instance must be created for each request. It is safe for concurrent
+// use; concurrent calls that need the same data share a single load.
 type GitHubContext struct {
 	MembershipContext
 
@@ -115,13 +179,37 @@ type GitHubContext struct {
 	number int
 	pr     *v4PullRequest
 
-	// cached fields
-	files      []*File
+	// mu protects the fields below it, but is never held during requests.
+	// Each lazily loaded field is protected by the load lock for its key, so
+	// loads of different data run concurrently.
+	mu           sync.Mutex
+	loads        map[string]*sync.Mutex
+	usage        GraphQLUsage
+	contents     map[string][]byte
+	linked       map[string]*LinkedIssue
+	linkedClient func(owner, repo string) (*github.Client, error)
+
+	// protected by the "files" load lock
+	files []*File
+
+	// protected by the "commits" load lock
 	commits    []*Commit
-	comments   []*Comment
-	reviews    []*Review
-	teamIDs    map[string]int64
-	membership map[string]bool
+	commitsErr *TooLargeError
+	pushedAt   bool
+
+	// protected by the "paged" load lock
+	comments  []*Comment
+	reviews   []*Review
+	dismissed map[string]bool
+	filter    CommentFilter
+
+	// protected by the "upstream" load lock
+	upstream       *Upstream
+	upstreamLoaded bool
+
+	// protected by the "permission" and "draft" load locks
+	authorPerm  string
+	draftLoaded bool
 }
 
 // NewGitHubContext creates a new pull.Context that makes GitHub requests to
@@ -149,9 +237,32 @@ func NewGitHubContext(ctx context.Context, mbrCtx MembershipContext, client *git
 		repo:   loc.Repo,
 		number: loc.Number,
 		pr:     pr,
+
+		// the REST pull request object does not include the draft state
+		draftLoaded: !loc.IsComplete(),
 	}, nil
 }
 
+// lockLoad locks the data with the given key and returns a function that
+// unlocks it. Callers check for cached data after locking, so concurrent calls
+// that need the same data share a single load. Failed loads are not cached, so
+// the next caller tries again.
+func (ghc *GitHubContext) lockLoad(key string) func() {
+	ghc.mu.Lock()
+	if ghc.loads == nil {
+		ghc.loads = make(map[string]*sync.Mutex)
+	}
+	l, ok := ghc.loads[key]
+	if !ok {
+		l = &sync.Mutex{}
+		ghc.loads[key] = l
+	}
+	ghc.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
 func (ghc *GitHubContext) RepositoryOwner() string {
 	return ghc.owner
 }
@@ -165,7 +276,66 @@ func (ghc *GitHubContext) Number() int {
 }
 
 func (ghc *GitHubContext) Author() string {
-	return ghc.pr.Author.Login
+	return CanonicalLogin(ghc.pr.Author.Login)
+}
+
+func (ghc *GitHubContext) AuthorPermission() (string, error) {
+	defer ghc.lockLoad("permission")()
+
+	if ghc.authorPerm == "" {
+		perm, _, err := ghc.client.Repositories.GetPermissionLevel(ghc.ctx, ghc.owner, ghc.repo, ghc.pr.Author.Login)
+		if err != nil {
+			return "", errors.Wrap(checkAvailable("REST", err), "failed to get author permission")
+		}
+		ghc.authorPerm = perm.GetPermission()
+	}
+	return ghc.authorPerm, nil
+}
+
+func (ghc *GitHubContext) Title() string {
+	return ghc.pr.Title
+}
+
+func (ghc *GitHubContext) Body() string {
+	return ghc.pr.Body
+}
+
+func (ghc *GitHubContext) Labels() []string {
+	labels := make([]string, 0, len(ghc.pr.Labels.Nodes))
+	for _, l := range ghc.pr.Labels.Nodes {
+		labels = append(labels, l.Name)
+	}
+	return labels
+}
+
+func (ghc *GitHubContext) IsDraft() (bool, error) {
+	defer ghc.lockLoad("draft")()
+
+	if !ghc.draftLoaded {
+		var q struct {
+			Repository struct {
+				PullRequest struct {
+					IsDraft bool
+				} `graphql:"pullRequest(number: $number)"`
+			} `graphql:"repository(owner: $owner, name: $name)"`
+			RateLimit v4RateLimit
+		}
+		qvars := map[string]interface{}{
+			"owner":  githubv4.String(ghc.owner),
+			"name":   githubv4.String(ghc.repo),
+			"number": githubv4.Int(ghc.number),
+		}
+		if err := ghc.query(&q, &q.RateLimit, qvars); err != nil {
+			return false, errors.Wrap(err, "failed to load draft state")
+		}
+		ghc.pr.IsDraft = q.Repository.PullRequest.IsDraft
+		ghc.draftLoaded = true
+	}
+	return ghc.pr.IsDraft, nil
+}
+
+func (ghc *GitHubContext) CreatedAt() time.Time {
+	return ghc.pr.CreatedAt
 }
 
 func (ghc *GitHubContext) HeadSHA() string {
@@ -174,7 +344,8 @@ func (ghc *GitHubContext) HeadSHA() string {
 
 // Branches returns the names of the base and head branch. If the head branch
 // is from another repository (it is a fork) then the branch name is
-// `owner:branchName`.
+// `owner:branchName`. If the fork was deleted, the owner is unknown and the
+// branch name is `:branchName`.
 func (ghc *GitHubContext) Branches() (base string, head string) {
 	base = ghc.pr.BaseRefName
 	head = ghc.pr.HeadRefName
@@ -184,14 +355,31 @@ func (ghc *GitHubContext) Branches() (base string, head string) {
 	return
 }
 
+// headRepositoryDeleted returns true if the pull request is from a fork that
+// was deleted. The commits are still available from the base repository, but
+// data that is only available from the fork, like pushed dates, is not.
+func (ghc *GitHubContext) headRepositoryDeleted() bool {
+	return ghc.pr.IsCrossRepository && ghc.pr.HeadRepository.Name == ""
+}
+
 func (ghc *GitHubContext) ChangedFiles() ([]*File, error) {
+	defer ghc.lockLoad("files")()
+
+	// avoid listing files when the count shows the result is known
+	switch {
+	case ghc.pr.ChangedFiles >= MaxPullRequestFiles:
+		return nil, &TooLargeError{Kind: "files", Max: MaxPullRequestFiles}
+	case ghc.pr.ChangedFiles == 0:
+		return []*File{}, nil
+	}
+
 	if ghc.files == nil {
 		var opt github.ListOptions
 		var allFiles []*github.CommitFile
 		for {
 			files, res, err := ghc.client.PullRequests.ListFiles(ghc.ctx, ghc.owner, ghc.repo, ghc.number, &opt)
 			if err != nil {
-				return nil, errors.Wrap(err, "failed to list pull request files")
+				return nil, errors.Wrap(checkAvailable("REST", err), "failed to list pull request files")
 			}
 			allFiles = append(allFiles, files...)
 			if res.NextPage == 0 {
@@ -216,32 +404,292 @@ func (ghc *GitHubContext) ChangedFiles() ([]*File, error) {
 				Status:    status,
 				Additions: f.GetAdditions(),
 				Deletions: f.GetDeletions(),
+				Patch:     f.GetPatch(),
 			})
 		}
 	}
 	if len(ghc.files) >= MaxPullRequestFiles {
-		return nil, errors.Errorf("too many files in pull request, maximum is %d", MaxPullRequestFiles)
+		return nil, &TooLargeError{Kind: "files", Max: MaxPullRequestFiles}
 	}
 	return ghc.files, nil
 }
 
+// FileContent loads files from the base repository, which includes the head
+// commits of pull requests from forks.
+func (ghc *GitHubContext) FileContent(path string) ([]byte, error) {
+	return ghc.fileContent(ghc.pr.HeadRefOID, path)
+}
+
+func (ghc *GitHubContext) BaseFileContent(path string) ([]byte, error) {
+	return ghc.fileContent(ghc.pr.BaseRefName, path)
+}
+
+func (ghc *GitHubContext) fileContent(ref, path string) ([]byte, error) {
+	key := ref + ":" + path
+	defer ghc.lockLoad("content:" + key)()
+
+	if content, ok := ghc.cachedContent(key); ok {
+		return content, nil
+	}
+
+	opt := &github.RepositoryContentGetOptions{Ref: ref}
+	file, _, _, err := ghc.client.Repositories.GetContents(ghc.ctx, ghc.owner, ghc.repo, path, opt)
+	if err != nil && !isNotFound(err) {
+		return nil, errors.Wrapf(checkAvailable("REST", err), "failed to get content of %s", path)
+	}
+
+	var content []byte
+	if file != nil {
+		if file.GetSize() > MaxFileContentSize {
+			return nil, &TooLargeError{Kind: "file", Path: path, Max: MaxFileContentSize}
+		}
+		s, err := file.GetContent()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode content of %s", path)
+		}
+		content = []byte(s)
+	}
+
+	ghc.setContent(key, content)
+	return content, nil
+}
+
+func (ghc *GitHubContext) cachedContent(key string) ([]byte, bool) {
+	ghc.mu.Lock()
+	defer ghc.mu.Unlock()
+
+	content, ok := ghc.contents[key]
+	return content, ok
+}
+
+func (ghc *GitHubContext) setContent(key string, content []byte) {
+	ghc.mu.Lock()
+	defer ghc.mu.Unlock()
+
+	if ghc.contents == nil {
+		ghc.contents = make(map[string][]byte)
+	}
+	ghc.contents[key] = content
+}
+
+// PrefetchFileContents loads the content of files at the head commit with
+// batched GraphQL queries and caches it. Files that GraphQL does not return
+// in full, like binary or large files, are not cached and are loaded
+// individually when needed.
+func (ghc *GitHubContext) PrefetchFileContents(paths []string) error {
+	ref := ghc.pr.HeadRefOID
+
+	var uncached []string
+	for _, p := range paths {
+		if _, ok := ghc.cachedContent(ref + ":" + p); !ok {
+			uncached = append(uncached, p)
+		}
+	}
+
+	for start := 0; start < len(uncached); start += contentBatchSize {
+		end := start + contentBatchSize
+		if end > len(uncached) {
+			end = len(uncached)
+		}
+		if err := ghc.prefetchFileContents(ref, uncached[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v4Blob is the content of a file. Text is nil for binary files.
+type v4Blob struct {
+	Blob struct {
+		Text        *string
+		ByteSize    int
+		IsBinary    bool
+		IsTruncated bool
+	} `graphql:"... on Blob"`
+}
+
+// prefetchFileContents loads files with a query that selects each file using
+// an alias.
+//
+//	repository(owner: $owner, name: $name) {
+//	  f0: object(expression: $path0) { ... on Blob { text } }
+//	  f1: object(expression: $path1) { ... on Blob { text } }
+//	}
+func (ghc *GitHubContext) prefetchFileContents(ref string, paths []string) error {
+	vars := map[string]interface{}{
+		"owner": githubv4.String(ghc.owner),
+		"name":  githubv4.String(ghc.repo),
+	}
+
+	fields := make([]reflect.StructField, 0, len(paths))
+	for i, p := range paths {
+		vars[fmt.Sprintf("path%d", i)] = githubv4.String(ref + ":" + p)
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("F%d", i),
+			Type: reflect.TypeOf(&v4Blob{}),
+			Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"f%d: object(expression: $path%d)"`, i, i)),
+		})
+	}
+
+	q := reflect.New(reflect.StructOf([]reflect.StructField{{
+		Name: "Repository",
+		Type: reflect.PtrTo(reflect.StructOf(fields)),
+		Tag:  `graphql:"repository(owner: $owner, name: $name)"`,
+	}}))
+	if err := ghc.v4client.Query(ghc.ctx, q.Interface(), vars); err != nil {
+		return errors.Wrap(checkAvailable("GraphQL", err), "failed to get file contents")
+	}
+
+	repo := q.Elem().Field(0)
+	if repo.IsNil() {
+		return nil
+	}
+	for i, p := range paths {
+		obj := repo.Elem().Field(i).Interface().(*v4Blob)
+		if obj == nil {
+			// the file does not exist at the head commit
+			ghc.setContent(ref+":"+p, nil)
+			continue
+		}
+
+		blob := obj.Blob
+		if blob.Text == nil || blob.IsBinary || blob.IsTruncated || blob.ByteSize > MaxFileContentSize {
+			continue
+		}
+		ghc.setContent(ref+":"+p, []byte(*blob.Text))
+	}
+	return nil
+}
+
 func (ghc *GitHubContext) Commits() ([]*Commit, error) {
-	if ghc.commits == nil {
-		commits, err := ghc.loadCommits()
+	defer ghc.lockLoad("commits")()
+
+	return ghc.cachedCommits()
+}
+
+func (ghc *GitHubContext) CommitsWithPushedDates() ([]*Commit, error) {
+	defer ghc.lockLoad("commits")()
+
+	if !ghc.pushedAt {
+		cached, err := ghc.cachedCommits()
 		if err != nil {
 			return nil, err
 		}
-		if len(commits) >= MaxPullRequestCommits {
-			return nil, errors.Errorf("too many commits in pull request, maximum is %d", MaxPullRequestCommits)
+
+		// loading pushed dates modifies the commits, so copy them to avoid
+		// changing commits returned by previous calls to Commits
+		commits := make([]*Commit, len(cached))
+		for i, c := range cached {
+			copied := *c
+			commits[i] = &copied
+		}
+
+		commits, err = ghc.loadPushedDates(commits)
+		if err != nil {
+			return nil, err
+		}
+
+		ghc.commits = commits
+		ghc.pushedAt = true
+	}
+	return ghc.commits, nil
+}
+
+// WalkCommits calls fn with the commits returned by Commits, if the pull
+// request is not too large. Otherwise, it lists the commits by comparing the
+// base branch and the head commit, calling fn with each page.
+func (ghc *GitHubContext) WalkCommits(fn func([]*Commit) (bool, error)) error {
+	commits, err := ghc.Commits()
+	switch {
+	case err == nil:
+		_, err := fn(commits)
+		return err
+	case !IsTooLarge(err):
+		return err
+	}
+
+	// compare in the base repository, which also contains the head commits
+	// of pull requests from forks
+	path := fmt.Sprintf("repos/%s/%s/compare/%s...%s", ghc.owner, ghc.repo, url.PathEscape(ghc.pr.BaseRefName), ghc.pr.HeadRefOID)
+
+	walked := 0
+	for page := 1; page != 0; {
+		req, err := ghc.client.NewRequest("GET", fmt.Sprintf("%s?per_page=100&page=%d", path, page), nil)
+		if err != nil {
+			return errors.Wrap(err, "failed to create compare request")
+		}
+
+		var comparison github.CommitsComparison
+		res, err := ghc.client.Do(ghc.ctx, req, &comparison)
+		if err != nil {
+			return errors.Wrap(checkAvailable("REST", err), "failed to compare commits")
+		}
+
+		walked += len(comparison.Commits)
+		if walked > MaxWalkedCommits {
+			return &TooLargeError{Kind: "commits", Max: MaxWalkedCommits}
+		}
+
+		chunk := make([]*Commit, 0, len(comparison.Commits))
+		for _, c := range comparison.Commits {
+			chunk = append(chunk, newCommitFromV3(c))
+		}
+
+		more, err := fn(chunk)
+		if err != nil || !more {
+			return err
 		}
+		page = res.NextPage
+	}
+	return nil
+}
+
+// newCommitFromV3 converts a commit returned by a compare request. Commits
+// made in the GitHub web interface have "web-flow" as the committer.
+func newCommitFromV3(c github.RepositoryCommit) *Commit {
+	commit := &Commit{
+		SHA:             c.GetSHA(),
+		Author:          CanonicalLogin(c.GetAuthor().GetLogin()),
+		Committer:       CanonicalLogin(c.GetCommitter().GetLogin()),
+		MessageHeadline: strings.SplitN(c.GetCommit().GetMessage(), "\n", 2)[0],
+	}
+	for _, p := range c.Parents {
+		commit.Parents = append(commit.Parents, p.GetSHA())
+	}
+	if commit.Committer == "web-flow" {
+		commit.CommittedViaWeb = true
+	}
+	return commit
+}
 
-		backfillPushedAt(commits, ghc.pr.HeadRefOID)
+// cachedCommits returns the commits, loading them if necessary. The caller
+// must hold the "commits" load lock.
+func (ghc *GitHubContext) cachedCommits() ([]*Commit, error) {
+	// the pull request is fixed for the lifetime of the context, so remember
+	// when it is too large to avoid loading hundreds of commits again
+	if ghc.commitsErr != nil {
+		return nil, ghc.commitsErr
+	}
+	if ghc.pr.Commits.TotalCount >= MaxPullRequestCommits {
+		ghc.commitsErr = &TooLargeError{Kind: "commits", Max: MaxPullRequestCommits}
+		return nil, ghc.commitsErr
+	}
+	if ghc.commits == nil {
+		commits, err := ghc.loadCommits()
+		if err != nil {
+			if tooLarge, ok := err.(*TooLargeError); ok {
+				ghc.commitsErr = tooLarge
+			}
+			return nil, err
+		}
 		ghc.commits = commits
 	}
 	return ghc.commits, nil
 }
 
 func (ghc *GitHubContext) Comments() ([]*Comment, error) {
+	defer ghc.lockLoad("paged")()
+
 	if ghc.comments == nil {
 		if err := ghc.loadPagedData(); err != nil {
 			return nil, err
@@ -251,6 +699,8 @@ func (ghc *GitHubContext) Comments() ([]*Comment, error) {
 }
 
 func (ghc *GitHubContext) Reviews() ([]*Review, error) {
+	defer ghc.lockLoad("paged")()
+
 	if ghc.reviews == nil {
 		if err := ghc.loadPagedData(); err != nil {
 			return nil, err
@@ -259,6 +709,312 @@ func (ghc *GitHubContext) Reviews() ([]*Review, error) {
 	return ghc.reviews, nil
 }
 
+// DismissReviews excludes the reviews with the given node IDs from the reviews
+// of the pull request. GitHub may return a review in its previous state for a
+// short time after it is dismissed, so callers that know about a dismissal,
+// like webhook handlers, use this to make sure the review no longer counts.
+func (ghc *GitHubContext) DismissReviews(ids ...string) {
+	defer ghc.lockLoad("paged")()
+
+	if ghc.dismissed == nil {
+		ghc.dismissed = make(map[string]bool)
+	}
+	for _, id := range ids {
+		ghc.dismissed[id] = true
+	}
+
+	if ghc.reviews != nil {
+		reviews := make([]*Review, 0, len(ghc.reviews))
+		for _, r := range ghc.reviews {
+			if !ghc.dismissed[r.ID] {
+				reviews = append(reviews, r)
+			}
+		}
+		ghc.reviews = reviews
+	}
+}
+
+// FilterComments keeps only the comments for which filter returns true.
+// Comments are filtered page by page as they load, so pull requests with many
+// comments that do not matter, like comments from bots, use less memory.
+// Comments that are already loaded are filtered immediately.
+func (ghc *GitHubContext) FilterComments(filter CommentFilter) {
+	defer ghc.lockLoad("paged")()
+
+	ghc.filter = filter
+	if ghc.comments != nil {
+		comments := make([]*Comment, 0, len(ghc.comments))
+		for _, c := range ghc.comments {
+			if filter(c) {
+				comments = append(comments, c)
+			}
+		}
+		ghc.comments = comments
+	}
+}
+
+// Upstream returns the pull request that this pull request is stacked on. If
+// several open pull requests use the base branch as their head branch, it
+// returns the first one. Pull requests from forks are never upstreams.
+func (ghc *GitHubContext) Upstream() (*Upstream, error) {
+	defer ghc.lockLoad("upstream")()
+
+	if !ghc.upstreamLoaded {
+		upstream, err := ghc.loadUpstream()
+		if err != nil {
+			return nil, err
+		}
+		ghc.upstream = upstream
+		ghc.upstreamLoaded = true
+	}
+	return ghc.upstream, nil
+}
+
+// loadUpstream finds the open pull request whose head branch is the base
+// branch. If there is none and the base branch changed, it finds the merged
+// pull request whose head branch was the previous base branch and whose base
+// branch is the current one.
+func (ghc *GitHubContext) loadUpstream() (*Upstream, error) {
+	var q struct {
+		Repository struct {
+			PullRequests struct {
+				Nodes []v4UpstreamPullRequest
+			} `graphql:"pullRequests(headRefName: $ref, states: [OPEN], first: $pageSize)"`
+
+			PullRequest struct {
+				TimelineItems struct {
+					Nodes []struct {
+						BaseRefChangedEvent struct {
+							PreviousRefName string
+						} `graphql:"... on BaseRefChangedEvent"`
+					}
+				} `graphql:"timelineItems(last: 1, itemTypes: [BASE_REF_CHANGED_EVENT])"`
+			} `graphql:"pullRequest(number: $number)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+		RateLimit v4RateLimit
+	}
+	qvars := map[string]interface{}{
+		"owner":  githubv4.String(ghc.owner),
+		"name":   githubv4.String(ghc.repo),
+		"number": githubv4.Int(ghc.number),
+		"ref":    githubv4.String(ghc.pr.BaseRefName),
+	}
+	if err := ghc.query(&q, &q.RateLimit, qvars); err != nil {
+		return nil, errors.Wrap(err, "failed to load upstream pull request")
+	}
+
+	for _, pr := range q.Repository.PullRequests.Nodes {
+		if !pr.IsCrossRepository && pr.Number != ghc.number {
+			return pr.ToUpstream(false), nil
+		}
+	}
+
+	var previousRef string
+	if events := q.Repository.PullRequest.TimelineItems.Nodes; len(events) > 0 {
+		previousRef = events[0].BaseRefChangedEvent.PreviousRefName
+	}
+	if previousRef == "" {
+		return nil, nil
+	}
+
+	var mq struct {
+		Repository struct {
+			PullRequests struct {
+				Nodes []v4UpstreamPullRequest
+			} `graphql:"pullRequests(headRefName: $ref, states: [MERGED], first: $pageSize)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+		RateLimit v4RateLimit
+	}
+	mqvars := map[string]interface{}{
+		"owner": githubv4.String(ghc.owner),
+		"name":  githubv4.String(ghc.repo),
+		"ref":   githubv4.String(previousRef),
+	}
+	if err := ghc.query(&mq, &mq.RateLimit, mqvars); err != nil {
+		return nil, errors.Wrap(err, "failed to load merged upstream pull request")
+	}
+
+	for _, pr := range mq.Repository.PullRequests.Nodes {
+		if !pr.IsCrossRepository && pr.BaseRefName == ghc.pr.BaseRefName {
+			return pr.ToUpstream(true), nil
+		}
+	}
+	return nil, nil
+}
+
+// SetLinkedIssueClient sets the function that returns the client used to load
+// linked issues in a repository. By default, linked issues are loaded with the
+// client of the context, which may not have access to other repositories.
+func (ghc *GitHubContext) SetLinkedIssueClient(fn func(owner, repo string) (*github.Client, error)) {
+	ghc.mu.Lock()
+	defer ghc.mu.Unlock()
+
+	ghc.linkedClient = fn
+}
+
+func (ghc *GitHubContext) LinkedIssue(owner, repo string, number int) (*LinkedIssue, error) {
+	key := strings.ToLower(fmt.Sprintf("%s/%s#%d", owner, repo, number))
+	defer ghc.lockLoad("linked:" + key)()
+
+	ghc.mu.Lock()
+	issue, ok := ghc.linked[key]
+	linkedClient := ghc.linkedClient
+	ghc.mu.Unlock()
+	if ok {
+		return issue, nil
+	}
+
+	client := ghc.client
+	if linkedClient != nil {
+		c, err := linkedClient(owner, repo)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create client for %s/%s", owner, repo)
+		}
+		client = c
+	}
+
+	issue, err := ghc.loadLinkedIssue(client, owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+
+	ghc.mu.Lock()
+	defer ghc.mu.Unlock()
+
+	if ghc.linked == nil {
+		ghc.linked = make(map[string]*LinkedIssue)
+	}
+	ghc.linked[key] = issue
+	return issue, nil
+}
+
+// loadLinkedIssue loads the body, comments, and reviews of an issue or pull
+// request. Listing the reviews of an issue fails with a 404 error, which means
+// the issue has no reviews.
+func (ghc *GitHubContext) loadLinkedIssue(client *github.Client, owner, repo string, number int) (*LinkedIssue, error) {
+	gi, _, err := client.Issues.Get(ghc.ctx, owner, repo, number)
+	if err != nil {
+		return nil, errors.Wrapf(checkAvailable("REST", err), "failed to get %s/%s#%d", owner, repo, number)
+	}
+	issue := &LinkedIssue{Body: gi.GetBody()}
+
+	commentOpt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, res, err := client.Issues.ListComments(ghc.ctx, owner, repo, number, commentOpt)
+		if err != nil {
+			return nil, errors.Wrapf(checkAvailable("REST", err), "failed to list comments of %s/%s#%d", owner, repo, number)
+		}
+		for _, c := range comments {
+			issue.Comments = append(issue.Comments, &Comment{
+				CreatedAt: c.GetCreatedAt(),
+				Author:    CanonicalLogin(c.GetUser().GetLogin()),
+				Body:      c.GetBody(),
+			})
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		commentOpt.Page = res.NextPage
+	}
+
+	reviewOpt := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, res, err := client.PullRequests.ListReviews(ghc.ctx, owner, repo, number, reviewOpt)
+		if err != nil {
+			if isNotFound(err) {
+				break
+			}
+			return nil, errors.Wrapf(checkAvailable("REST", err), "failed to list reviews of %s/%s#%d", owner, repo, number)
+		}
+		for _, r := range reviews {
+			issue.Reviews = append(issue.Reviews, &Review{
+				CreatedAt: r.GetSubmittedAt(),
+				Author:    CanonicalLogin(r.GetUser().GetLogin()),
+				State:     ReviewState(strings.ToLower(r.GetState())),
+				Body:      r.GetBody(),
+				CommitSHA: r.GetCommitID(),
+			})
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		reviewOpt.Page = res.NextPage
+	}
+
+	return issue, nil
+}
+
+// PrefetchMembership calls the PrefetchMembership method of the membership
+// context, if the membership context is a MembershipPrefetcher.
+func (ghc *GitHubContext) PrefetchMembership(user string, teams, orgs []string) error {
+	if p, ok := ghc.MembershipContext.(MembershipPrefetcher); ok {
+		return p.PrefetchMembership(user, teams, orgs)
+	}
+	return nil
+}
+
+// GraphQLUsage is the GraphQL API rate limit usage of a GitHubContext.
+type GraphQLUsage struct {
+	// Queries is the number of queries made by the context
+	Queries int
+
+	// Cost is the total cost, in points, of the queries made by the context
+	Cost int
+
+	// Remaining and Limit are the remaining and total points of the rate
+	// limit as of the last query. They are zero if no queries were made.
+	Remaining int
+	Limit     int
+
+	// ResetAt is when the rate limit resets as of the last query. It is zero
+	// if no queries were made.
+	ResetAt time.Time
+}
+
+// GraphQLUsage returns the GraphQL API rate limit usage of the context.
+func (ghc *GitHubContext) GraphQLUsage() GraphQLUsage {
+	ghc.mu.Lock()
+	defer ghc.mu.Unlock()
+
+	return ghc.usage
+}
+
+// query runs a paginated GraphQL query and records its cost. The query must
+// have a top-level RateLimit field, passed as rl, and use the $pageSize
+// variable for the size of its connections.
+func (ghc *GitHubContext) query(q interface{}, rl *v4RateLimit, vars map[string]interface{}) error {
+	ghc.mu.Lock()
+	vars["pageSize"] = githubv4.Int(ghc.pageSize())
+	ghc.mu.Unlock()
+
+	if err := ghc.v4client.Query(ghc.ctx, q, vars); err != nil {
+		return checkAvailable("GraphQL", err)
+	}
+
+	ghc.mu.Lock()
+	defer ghc.mu.Unlock()
+
+	ghc.usage.Queries++
+	ghc.usage.Cost += rl.Cost
+	ghc.usage.Remaining = rl.Remaining
+	ghc.usage.Limit = rl.Limit
+	ghc.usage.ResetAt = rl.ResetAt.Time
+
+	zerolog.Ctx(ghc.ctx).Debug().Msgf("GraphQL query cost %d points, %d/%d points remaining", rl.Cost, rl.Remaining, rl.Limit)
+	return nil
+}
+
+// pageSize returns the number of items to request per page, which is reduced
+// when less than 10% of the rate limit remains. The caller must hold ghc.mu.
+func (ghc *GitHubContext) pageSize() int {
+	if u := ghc.usage; u.Limit > 0 && u.Remaining < u.Limit/10 {
+		return graphQLReducedPageSize
+	}
+	return graphQLPageSize
+}
+
+// loadPagedData loads the comments and reviews. The caller must hold the
+// "paged" load lock.
 func (ghc *GitHubContext) loadPagedData() error {
 	// this is a minor optimization: make max(c,r) requests instead of c+r
 	var q struct {
@@ -267,14 +1023,15 @@ func (ghc *GitHubContext) loadPagedData() error {
 				Comments struct {
 					PageInfo v4PageInfo
 					Nodes    []v4IssueComment
-				} `graphql:"comments(first: 100, after: $commentCursor)"`
+				} `graphql:"comments(first: $pageSize, after: $commentCursor)"`
 
 				Reviews struct {
 					PageInfo v4PageInfo
 					Nodes    []v4PullRequestReview
-				} `graphql:"reviews(first: 100, after: $reviewCursor, states: [APPROVED, CHANGES_REQUESTED])"`
+				} `graphql:"reviews(first: $pageSize, after: $reviewCursor, states: [APPROVED, CHANGES_REQUESTED])"`
 			} `graphql:"pullRequest(number: $number)"`
 		} `graphql:"repository(owner: $owner, name: $name)"`
+		RateLimit v4RateLimit
 	}
 	qvars := map[string]interface{}{
 		"owner":  githubv4.String(ghc.owner),
@@ -289,18 +1046,28 @@ func (ghc *GitHubContext) loadPagedData() error {
 	reviews := []*Review{}
 	for {
 		complete := 0
-		if err := ghc.v4client.Query(ghc.ctx, &q, qvars); err != nil {
+		if err := ghc.query(&q, &q.RateLimit, qvars); err != nil {
 			return errors.Wrap(err, "failed to load pull request data")
 		}
 
-		for _, c := range q.Repository.PullRequest.Comments.Nodes {
-			comments = append(comments, c.ToComment())
+		for _, node := range q.Repository.PullRequest.Comments.Nodes {
+			c := node.ToComment()
+			if ghc.filter != nil && !ghc.filter(c) {
+				continue
+			}
+			if len(comments) >= MaxPullRequestComments {
+				return &TooLargeError{Kind: "comments", Max: MaxPullRequestComments}
+			}
+			comments = append(comments, c)
 		}
 		if !q.Repository.PullRequest.Comments.PageInfo.UpdateCursor(qvars, "commentCursor") {
 			complete++
 		}
 
 		for _, r := range q.Repository.PullRequest.Reviews.Nodes {
+			if ghc.dismissed[r.ID] {
+				continue
+			}
 			reviews = append(reviews, r.ToReview())
 		}
 		if !q.Repository.PullRequest.Reviews.PageInfo.UpdateCursor(qvars, "reviewCursor") {
@@ -318,31 +1085,52 @@ func (ghc *GitHubContext) loadPagedData() error {
 }
 
 func (ghc *GitHubContext) loadCommits() ([]*Commit, error) {
+	rawCommits, err := ghc.loadRawCommits()
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([]*Commit, 0, len(rawCommits))
+	for _, r := range rawCommits {
+		commits = append(commits, r.Commit.ToCommit())
+	}
+
+	// if head is missing from the pull request, retrying won't find it
+	if findCommit(commits, ghc.pr.HeadRefOID) == nil {
+		return nil, &HeadMissingError{SHA: ghc.pr.HeadRefOID}
+	}
+	if len(commits) >= MaxPullRequestCommits {
+		return nil, &TooLargeError{Kind: "commits", Max: MaxPullRequestCommits}
+	}
+
+	backfillPushedAt(commits, ghc.pr.HeadRefOID)
+	return commits, nil
+}
+
+// loadPushedDates makes sure the head commit has a pushed date, loading it
+// separately or reloading the commits as needed. Because this can require
+// additional requests and delays, it only happens when a caller asks for
+// pushed dates instead of every time commits are loaded.
+func (ghc *GitHubContext) loadPushedDates(commits []*Commit) ([]*Commit, error) {
 	log := zerolog.Ctx(ghc.ctx)
 
 	// github does not always return the latest commit information for a PR
 	// immediately after it was updated; if we're missing data, try again
 	attempts := 0
 	for {
-		rawCommits, err := ghc.loadRawCommits()
-		if err != nil {
-			return nil, err
-		}
-
-		var head *Commit
-		commits := make([]*Commit, 0, len(rawCommits))
-
-		for _, r := range rawCommits {
-			c := r.Commit.ToCommit()
-			if c.SHA == ghc.pr.HeadRefOID {
-				head = c
+		head := findCommit(commits, ghc.pr.HeadRefOID)
+
+		// pushed dates of a deleted fork cannot be loaded, so use the fallback
+		// if configured; commit dates are set by the author, so they are never
+		// used without the operator opting in
+		if ghc.pr.IsCrossRepository && head.PushedAt == nil && ghc.headRepositoryDeleted() {
+			fallback := pushedDateFallback(ghc.ctx)
+			if fallback == PushedDateFallbackNone {
+				return nil, errors.Errorf("head repository was deleted and head commit %.10s is missing pushed date", ghc.pr.HeadRefOID)
 			}
-			commits = append(commits, c)
-		}
-
-		// if head is missing from the pull request, retrying won't find it
-		if head == nil {
-			return nil, errors.Errorf("head commit %.10s is missing, probably due to a force-push", ghc.pr.HeadRefOID)
+			log.Debug().Msgf("Head repository was deleted, using %s for commits missing pushed dates", fallback)
+			fillPushedAt(commits, fallback)
+			return commits, nil
 		}
 
 		// as of 2019-05-01, the GitHub API does not return pushed date
@@ -351,13 +1139,22 @@ func (ghc *GitHubContext) loadCommits() ([]*Commit, error) {
 			if err := ghc.loadPushedAt(commits); err != nil {
 				return nil, err
 			}
+			backfillPushedAt(commits, head.SHA)
 		}
 
 		if head.PushedAt != nil {
 			return commits, nil
 		}
 
+		// retrying does not help for forks, so fall back immediately if
+		// possible; otherwise, only fall back after all attempts fail
+		fallback := pushedDateFallback(ghc.ctx)
 		attempts++
+		if fallback != PushedDateFallbackNone && (ghc.pr.IsCrossRepository || attempts >= commitLoadMaxAttempts) {
+			log.Debug().Msgf("Head commit %.10s is missing pushed date, using %s instead", ghc.pr.HeadRefOID, fallback)
+			fillPushedAt(commits, fallback)
+			return commits, nil
+		}
 		if attempts >= commitLoadMaxAttempts {
 			return nil, errors.Errorf("head commit %.10s is missing pushed date; this is probably a bug", ghc.pr.HeadRefOID)
 		}
@@ -365,6 +1162,12 @@ func (ghc *GitHubContext) loadCommits() ([]*Commit, error) {
 		delay := time.Duration(1<<uint(attempts-1)) * commitLoadBaseDelay
 		log.Debug().Msgf("failed to load pushed date on attempt %d, sleeping %s and trying again", attempts, delay)
 		time.Sleep(delay)
+
+		reloaded, err := ghc.loadCommits()
+		if err != nil {
+			return nil, err
+		}
+		commits = reloaded
 	}
 }
 
@@ -375,9 +1178,10 @@ func (ghc *GitHubContext) loadRawCommits() ([]*v4PullRequestCommit, error) {
 				Commits struct {
 					PageInfo v4PageInfo
 					Nodes    []*v4PullRequestCommit
-				} `graphql:"commits(first: 100, after: $cursor)"`
+				} `graphql:"commits(first: $pageSize, after: $cursor)"`
 			} `graphql:"pullRequest(number: $number)"`
 		} `graphql:"repository(owner: $owner, name: $name)"`
+		RateLimit v4RateLimit
 	}
 	qvars := map[string]interface{}{
 		"owner":  githubv4.String(ghc.owner),
@@ -388,7 +1192,7 @@ func (ghc *GitHubContext) loadRawCommits() ([]*v4PullRequestCommit, error) {
 
 	commits := []*v4PullRequestCommit{}
 	for {
-		if err := ghc.v4client.Query(ghc.ctx, &q, qvars); err != nil {
+		if err := ghc.query(&q, &q.RateLimit, qvars); err != nil {
 			return nil, errors.Wrap(err, "failed to load commits")
 		}
 		commits = append(commits, q.Repository.PullRequest.Commits.Nodes...)
@@ -415,10 +1219,11 @@ func (ghc *GitHubContext) loadPushedAt(commits []*Commit) error {
 							OID        string
 							PushedDate *time.Time
 						}
-					} `graphql:"history(first: 100, after: $cursor)"`
+					} `graphql:"history(first: $pageSize, after: $cursor)"`
 				} `graphql:"... on Commit"`
 			} `graphql:"object(oid: $oid)"`
 		} `graphql:"repository(owner: $owner, name: $name)"`
+		RateLimit v4RateLimit
 	}
 	qvars := map[string]interface{}{
 		"owner":  githubv4.String(ghc.pr.HeadRepository.Owner.Login),
@@ -428,7 +1233,7 @@ func (ghc *GitHubContext) loadPushedAt(commits []*Commit) error {
 	}
 
 	for len(commitsBySHA) > 0 {
-		if err := ghc.v4client.Query(ghc.ctx, &q, qvars); err != nil {
+		if err := ghc.query(&q, &q.RateLimit, qvars); err != nil {
 			return errors.Wrap(err, "failed to load commit pushed dates")
 		}
 		for _, n := range q.Repository.Object.Commit.History.Nodes {
@@ -448,6 +1253,31 @@ func (ghc *GitHubContext) loadPushedAt(commits []*Commit) error {
 	return nil
 }
 
+func findCommit(commits []*Commit, sha string) *Commit {
+	for _, c := range commits {
+		if c.SHA == sha {
+			return c
+		}
+	}
+	return nil
+}
+
+// fillPushedAt sets the pushed date of commits without one using a fallback.
+func fillPushedAt(commits []*Commit, fallback PushedDateFallback) {
+	for _, c := range commits {
+		if c.PushedAt != nil {
+			continue
+		}
+		switch fallback {
+		case PushedDateFallbackCommitted:
+			if !c.CommittedAt.IsZero() {
+				committedAt := c.CommittedAt
+				c.PushedAt = &committedAt
+			}
+		}
+	}
+}
+
 func backfillPushedAt(commits []*Commit, headSHA string) {
 	commitsBySHA := make(map[string]*Commit, len(commits))
 	for _, c := range commits {
@@ -475,9 +1305,26 @@ func backfillPushedAt(commits []*Commit, headSHA string) {
 	}
 }
 
+type v4UpstreamPullRequest struct {
+	Number            int
+	HeadRefOID        string
+	BaseRefName       string
+	IsCrossRepository bool
+}
+
+func (pr *v4UpstreamPullRequest) ToUpstream(merged bool) *Upstream {
+	return &Upstream{
+		Number:  pr.Number,
+		HeadSHA: pr.HeadRefOID,
+		Base:    pr.BaseRefName,
+		Merged:  merged,
+	}
+}
+
 // if adding new fields to this struct, modify Locator#toV4() as well
 type v4PullRequest struct {
 	Author v4Actor
+	Title  string
 
 	IsCrossRepository bool
 
@@ -489,6 +1336,30 @@ type v4PullRequest struct {
 	}
 
 	BaseRefName string
+
+	CreatedAt time.Time
+
+	Body    string
+	IsDraft bool
+	Labels  struct {
+		Nodes []struct {
+			Name string
+		}
+	} `graphql:"labels(first: 100)"`
+
+	// ChangedFiles and Commits.TotalCount are -1 if the count is unknown
+	ChangedFiles int
+	Commits      struct {
+		TotalCount int
+	}
+}
+
+// v4RateLimit is the rate limit information of a GraphQL query.
+type v4RateLimit struct {
+	Cost      int
+	Remaining int
+	Limit     int
+	ResetAt   githubv4.DateTime
 }
 
 type v4PageInfo struct {
@@ -513,10 +1384,14 @@ func (pi v4PageInfo) UpdateCursor(vars map[string]interface{}, name string) bool
 }
 
 type v4PullRequestReview struct {
+	ID          string
 	Author      v4Actor
 	State       string
 	Body        string
 	SubmittedAt time.Time
+	Commit      struct {
+		OID string
+	}
 }
 
 func (r *v4PullRequestReview) ToReview() *Review {
@@ -525,6 +1400,8 @@ func (r *v4PullRequestReview) ToReview() *Review {
 		Author:    r.Author.GetV3Login(),
 		State:     ReviewState(strings.ToLower(r.State)),
 		Body:      r.Body,
+		ID:        r.ID,
+		CommitSHA: r.Commit.OID,
 	}
 }
 
@@ -551,12 +1428,42 @@ type v4Commit struct {
 	Author          v4GitActor
 	Committer       v4GitActor
 	CommittedViaWeb bool
+	CommittedDate   time.Time
 	PushedDate      *time.Time
+	MessageHeadline string
 	Parents         struct {
 		Nodes []struct {
 			OID string
 		}
 	} `graphql:"parents(first: 3)"`
+	Signature *v4Signature
+}
+
+type v4Signature struct {
+	Typename string `graphql:"__typename"`
+	IsValid  bool
+	State    string
+	Signer   *v4Actor
+}
+
+func (s *v4Signature) ToSignature() *Signature {
+	if s == nil {
+		return nil
+	}
+
+	sig := &Signature{Valid: s.IsValid, State: s.State}
+	switch s.Typename {
+	case "GpgSignature":
+		sig.Type = "GPG"
+	case "SmimeSignature":
+		sig.Type = "SMIME"
+	case "SshSignature":
+		sig.Type = "SSH"
+	}
+	if s.Signer != nil {
+		sig.Signer = s.Signer.GetV3Login()
+	}
+	return sig
 }
 
 func (c *v4Commit) ToCommit() *Commit {
@@ -572,6 +1479,9 @@ func (c *v4Commit) ToCommit() *Commit {
 		Author:          c.Author.GetV3Login(),
 		Committer:       c.Committer.GetV3Login(),
 		PushedAt:        c.PushedDate,
+		CommittedAt:     c.CommittedDate,
+		MessageHeadline: c.MessageHeadline,
+		Signature:       c.Signature.ToSignature(),
 	}
 }
 
@@ -580,13 +1490,13 @@ type v4Actor struct {
 	Login string
 }
 
-// GetV3Login returns a V3-compatible login string. These login strings contain
-// the "[bot]" suffix for GitHub identities.
+// GetV3Login returns a canonical V3-compatible login string. These login
+// strings contain the "[bot]" suffix for GitHub identities.
 func (a v4Actor) GetV3Login() string {
 	if a.Type == "Bot" {
-		return a.Login + "[bot]"
+		return AppLogin(a.Login)
 	}
-	return a.Login
+	return CanonicalLogin(a.Login)
 }
 
 type v4GitActor struct {
@@ -600,6 +1510,32 @@ func (ga v4GitActor) GetV3Login() string {
 	return ""
 }
 
+// checkAvailable returns an UnavailableError for err if err shows that an API
+// is unavailable or rate limited. Otherwise, it returns err.
+func checkAvailable(api string, err error) error {
+	if err == nil || !isTransient(err) {
+		return err
+	}
+	return &UnavailableError{API: api, Err: err}
+}
+
+// isTransient returns true if err is caused by a rate limit, a server error,
+// or a timeout, so that a later request may succeed.
+func isTransient(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case *github.RateLimitError, *github.AbuseRateLimitError, *github.AcceptedError:
+		return true
+	case *github.ErrorResponse:
+		return cause.Response != nil && cause.Response.StatusCode >= 500
+	case net.Error:
+		return cause.Timeout()
+	}
+
+	// GraphQL errors only have a message
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "rate limit") || strings.Contains(msg, "non-200 ok status code: 5")
+}
+
 func isNotFound(err error) bool {
 	if rerr, ok := err.(*github.ErrorResponse); ok {
 		return rerr.Response.StatusCode == http.StatusNotFound
@@ -16,76 +16,125 @@ package pull
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
+	"github.com/shurcooL/githubv4"
 )
 
+const (
+	// membershipBatchSize is the maximum number of teams or organizations
+	// checked by one GraphQL query
+	membershipBatchSize = 50
+)
+
+// GitHubMembershipContext is a MembershipContext that gets information from
+// GitHub. It is safe for concurrent use.
 type GitHubMembershipContext struct {
-	ctx    context.Context
-	client *github.Client
+	ctx      context.Context
+	client   *github.Client
+	v4client *githubv4.Client
 
-	teamIDs    map[string]int64
-	membership map[string]bool
+	// cached fields, protected by mu
+	mu          sync.Mutex
+	teamIDs     map[string]int64
+	membership  map[string]bool
+	signingKeys map[string]bool
 }
 
-func NewGitHubMembershipContext(ctx context.Context, client *github.Client) *GitHubMembershipContext {
+// NewGitHubMembershipContext creates a GitHubMembershipContext. If v4client
+// is nil, PrefetchMembership does nothing and each membership is checked with
+// a separate request.
+func NewGitHubMembershipContext(ctx context.Context, client *github.Client, v4client *githubv4.Client) *GitHubMembershipContext {
 	return &GitHubMembershipContext{
-		ctx:        ctx,
-		client:     client,
-		teamIDs:    make(map[string]int64),
-		membership: make(map[string]bool),
+		ctx:         ctx,
+		client:      client,
+		v4client:    v4client,
+		teamIDs:     make(map[string]int64),
+		membership:  make(map[string]bool),
+		signingKeys: make(map[string]bool),
 	}
 }
 
+// membershipKey returns the cache key for a membership. Team, organization,
+// and user names are all case-insensitive.
 func membershipKey(group, user string) string {
-	return group + ":" + user
+	return strings.ToLower(group + ":" + CanonicalLogin(user))
 }
 
 func (mc *GitHubMembershipContext) IsTeamMember(team, user string) (bool, error) {
 	key := membershipKey(team, user)
 	org := strings.Split(team, "/")[0]
 
-	id, ok := mc.teamIDs[team]
+	isMember, ok := mc.cachedMembership(key)
+	if ok {
+		return isMember, nil
+	}
+
+	id, ok := mc.teamID(team)
 	if !ok {
 		if err := mc.cacheTeamIDs(org); err != nil {
 			return false, err
 		}
 
-		id, ok = mc.teamIDs[team]
+		id, ok = mc.teamID(team)
 		if !ok {
 			return false, errors.Errorf("failed to get ID for team %s", team)
 		}
 	}
 
-	isMember, ok := mc.membership[key]
-	if ok {
-		return isMember, nil
-	}
-
 	membership, _, err := mc.client.Teams.GetTeamMembership(mc.ctx, id, user)
 	if err != nil && !isNotFound(err) {
-		return false, errors.Wrap(err, "failed to get team membership")
+		return false, errors.Wrap(checkAvailable("REST", err), "failed to get team membership")
 	}
 
 	isMember = membership != nil && membership.GetState() == "active"
 
-	mc.membership[key] = isMember
+	mc.setMembership(key, isMember)
 	return isMember, nil
 }
 
+func (mc *GitHubMembershipContext) teamID(team string) (int64, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	id, ok := mc.teamIDs[strings.ToLower(team)]
+	return id, ok
+}
+
+func (mc *GitHubMembershipContext) cachedMembership(key string) (bool, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	isMember, ok := mc.membership[key]
+	return isMember, ok
+}
+
+func (mc *GitHubMembershipContext) setMembership(key string, isMember bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.membership[key] = isMember
+}
+
 func (mc *GitHubMembershipContext) cacheTeamIDs(org string) error {
+	teamIDs := make(map[string]int64)
+
 	var opt github.ListOptions
 	for {
 		teams, res, err := mc.client.Teams.ListTeams(mc.ctx, org, &opt)
 		if err != nil {
-			return errors.Wrap(err, "failed to list organization teams")
+			return errors.Wrap(checkAvailable("REST", err), "failed to list organization teams")
 		}
 
 		for _, t := range teams {
-			key := org + "/" + t.GetSlug()
-			mc.teamIDs[key] = t.GetID()
+			key := strings.ToLower(org + "/" + t.GetSlug())
+			teamIDs[key] = t.GetID()
 		}
 
 		if res.NextPage == 0 {
@@ -93,31 +142,293 @@ func (mc *GitHubMembershipContext) cacheTeamIDs(org string) error {
 		}
 		opt.Page = res.NextPage
 	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	for key, id := range teamIDs {
+		mc.teamIDs[key] = id
+	}
 	return nil
 }
 
 func (mc *GitHubMembershipContext) IsOrgMember(org, user string) (bool, error) {
 	key := membershipKey(org, user)
 
-	isMember, ok := mc.membership[key]
+	isMember, ok := mc.cachedMembership(key)
 	if ok {
 		return isMember, nil
 	}
 
 	isMember, _, err := mc.client.Organizations.IsMember(mc.ctx, org, user)
 	if err != nil {
-		return false, errors.Wrap(err, "failed to get organization membership")
+		return false, errors.Wrap(checkAvailable("REST", err), "failed to get organization membership")
 	}
 
-	mc.membership[key] = isMember
+	mc.setMembership(key, isMember)
 	return isMember, nil
 }
 
+// PrefetchMembership checks the membership of user in the given teams and
+// organizations with batched GraphQL queries and caches the results. Teams
+// and organizations that GitHub does not return, like teams that do not
+// exist, are not cached and are checked individually when needed.
+func (mc *GitHubMembershipContext) PrefetchMembership(user string, teams, orgs []string) error {
+	if mc.v4client == nil {
+		return nil
+	}
+
+	teams = mc.uncached(teams, user)
+	for start := 0; start < len(teams); start += membershipBatchSize {
+		end := start + membershipBatchSize
+		if end > len(teams) {
+			end = len(teams)
+		}
+		if err := mc.prefetchTeams(user, teams[start:end]); err != nil {
+			return err
+		}
+	}
+
+	orgs = mc.uncached(orgs, user)
+	for start := 0; start < len(orgs); start += membershipBatchSize {
+		end := start + membershipBatchSize
+		if end > len(orgs) {
+			end = len(orgs)
+		}
+		if err := mc.prefetchOrgs(user, orgs[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mc *GitHubMembershipContext) uncached(groups []string, user string) []string {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	var uncached []string
+	for _, g := range groups {
+		if _, ok := mc.membership[membershipKey(g, user)]; !ok {
+			uncached = append(uncached, g)
+		}
+	}
+	return uncached
+}
+
+// v4TeamMembers are the members of a team with logins that match a query. The
+// query matches substrings, so callers must compare the logins.
+type v4TeamMembers struct {
+	Members struct {
+		PageInfo v4PageInfo
+		Nodes    []struct {
+			Login string
+		}
+	} `graphql:"members(query: $user, first: 100)"`
+}
+
+// prefetchTeams checks team memberships with a query that selects each team
+// using an alias:
+//
+//	t0: organization(login: $org0) { team(slug: $team0) { members(...) } }
+//	t1: organization(login: $org1) { team(slug: $team1) { members(...) } }
+func (mc *GitHubMembershipContext) prefetchTeams(user string, teams []string) error {
+	vars := map[string]interface{}{
+		"user": githubv4.String(user),
+	}
+
+	fields := make([]reflect.StructField, 0, len(teams))
+	for i, team := range teams {
+		parts := strings.SplitN(team, "/", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("invalid team name %q", team)
+		}
+		vars[fmt.Sprintf("org%d", i)] = githubv4.String(parts[0])
+		vars[fmt.Sprintf("team%d", i)] = githubv4.String(parts[1])
+
+		org := reflect.StructOf([]reflect.StructField{{
+			Name: "Team",
+			Type: reflect.TypeOf(&v4TeamMembers{}),
+			Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"team(slug: $team%d)"`, i)),
+		}})
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("T%d", i),
+			Type: reflect.PtrTo(org),
+			Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"t%d: organization(login: $org%d)"`, i, i)),
+		})
+	}
+
+	q := reflect.New(reflect.StructOf(fields))
+	if err := mc.v4client.Query(mc.ctx, q.Interface(), vars); err != nil {
+		return errors.Wrap(err, "failed to get team memberships")
+	}
+
+	for i, team := range teams {
+		org := q.Elem().Field(i)
+		if org.IsNil() {
+			continue
+		}
+		members, _ := org.Elem().Field(0).Interface().(*v4TeamMembers)
+		if members == nil {
+			continue
+		}
+
+		isMember := false
+		for _, m := range members.Members.Nodes {
+			if strings.EqualFold(m.Login, user) {
+				isMember = true
+				break
+			}
+		}
+
+		// without a match on the first page, the user may be on a later page
+		if isMember || !members.Members.PageInfo.HasNextPage {
+			mc.setMembership(membershipKey(team, user), isMember)
+		}
+	}
+	return nil
+}
+
+// prefetchOrgs checks organization memberships with a query that selects
+// each organization of the user using an alias:
+//
+//	user(login: $user) {
+//	  o0: organization(login: $org0) { login }
+//	  o1: organization(login: $org1) { login }
+//	}
+func (mc *GitHubMembershipContext) prefetchOrgs(user string, orgs []string) error {
+	vars := map[string]interface{}{
+		"user": githubv4.String(user),
+	}
+
+	fields := make([]reflect.StructField, 0, len(orgs))
+	for i, org := range orgs {
+		vars[fmt.Sprintf("org%d", i)] = githubv4.String(org)
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("O%d", i),
+			Type: reflect.TypeOf(&struct{ Login string }{}),
+			Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"o%d: organization(login: $org%d)"`, i, i)),
+		})
+	}
+
+	q := reflect.New(reflect.StructOf([]reflect.StructField{{
+		Name: "User",
+		Type: reflect.PtrTo(reflect.StructOf(fields)),
+		Tag:  `graphql:"user(login: $user)"`,
+	}}))
+	if err := mc.v4client.Query(mc.ctx, q.Interface(), vars); err != nil {
+		return errors.Wrap(err, "failed to get organization memberships")
+	}
+
+	u := q.Elem().Field(0)
+	if u.IsNil() {
+		return nil
+	}
+	for i, org := range orgs {
+		mc.setMembership(membershipKey(org, user), !u.Elem().Field(i).IsNil())
+	}
+	return nil
+}
+
 func (mc *GitHubMembershipContext) IsCollaborator(org, repo, user, desiredPerm string) (bool, error) {
 	perm, _, err := mc.client.Repositories.GetPermissionLevel(mc.ctx, org, repo, user)
 	if err != nil {
-		return false, errors.Wrapf(err, "failed to get repo %s permission", desiredPerm)
+		return false, errors.Wrapf(checkAvailable("REST", err), "failed to get repo %s permission", desiredPerm)
 	}
 
 	return perm.GetPermission() == desiredPerm, nil
 }
+
+func (mc *GitHubMembershipContext) HasVerifiedSigningKey(user string) (bool, error) {
+	login := CanonicalLogin(user)
+
+	mc.mu.Lock()
+	hasKey, ok := mc.signingKeys[login]
+	mc.mu.Unlock()
+	if ok {
+		return hasKey, nil
+	}
+
+	hasKey, err := mc.hasGPGSigningKey(user)
+	if err != nil {
+		return false, err
+	}
+	if !hasKey {
+		if hasKey, err = mc.hasSSHSigningKey(user); err != nil {
+			return false, err
+		}
+	}
+
+	mc.mu.Lock()
+	mc.signingKeys[login] = hasKey
+	mc.mu.Unlock()
+	return hasKey, nil
+}
+
+// hasGPGSigningKey returns true if the user has an unexpired GPG key or
+// subkey that can sign and the key has a verified email address.
+func (mc *GitHubMembershipContext) hasGPGSigningKey(user string) (bool, error) {
+	now := time.Now()
+	canSign := func(k *github.GPGKey) bool {
+		return k.GetCanSign() && (k.ExpiresAt == nil || k.ExpiresAt.After(now))
+	}
+
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		keys, res, err := mc.client.Users.ListGPGKeys(mc.ctx, user, opt)
+		if err != nil {
+			if isNotFound(err) {
+				return false, nil
+			}
+			return false, errors.Wrap(checkAvailable("REST", err), "failed to list GPG keys")
+		}
+
+		for _, k := range keys {
+			verified := false
+			for _, e := range k.Emails {
+				verified = verified || e.GetVerified()
+			}
+			if !verified {
+				continue
+			}
+
+			signs := canSign(k)
+			for i := range k.Subkeys {
+				signs = signs || canSign(&k.Subkeys[i])
+			}
+			if signs {
+				return true, nil
+			}
+		}
+
+		if res.NextPage == 0 {
+			return false, nil
+		}
+		opt.Page = res.NextPage
+	}
+}
+
+// hasSSHSigningKey returns true if the user has an SSH signing key. GitHub
+// Enterprise Server versions without SSH signing keys return no keys.
+func (mc *GitHubMembershipContext) hasSSHSigningKey(user string) (bool, error) {
+	req, err := mc.client.NewRequest("GET", fmt.Sprintf("users/%s/ssh_signing_keys?per_page=1", user), nil)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create request")
+	}
+
+	var keys []struct {
+		ID int64 `json:"id"`
+	}
+	if _, err := mc.client.Do(mc.ctx, req, &keys); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(checkAvailable("REST", err), "failed to list SSH signing keys")
+	}
+	return len(keys) > 0, nil
+}
+
+// IsGroupMember always returns an error because GitHub does not know about
+// directory groups. Use a MembershipContext with group providers instead.
+func (mc *GitHubMembershipContext) IsGroupMember(group, user string) (bool, error) {
+	return false, errors.Errorf("cannot check membership in directory group %s without a group provider", group)
+}
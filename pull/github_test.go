@@ -16,12 +16,16 @@ package pull
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
 	"github.com/shurcooL/githubv4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -56,6 +60,7 @@ func TestChangedFiles(t *testing.T) {
 
 	assert.Equal(t, "README.md", files[2].Filename)
 	assert.Equal(t, FileModified, files[2].Status)
+	assert.Equal(t, "@@ -1,2 +1,2 @@\n # Test\n-old\n+new", files[2].Patch)
 
 	// verify that the file list is cached
 	files, err = ctx.ChangedFiles()
@@ -65,6 +70,147 @@ func TestChangedFiles(t *testing.T) {
 	assert.Equal(t, 2, filesRule.Count, "cached files were not used")
 }
 
+func TestFileContent(t *testing.T) {
+	rp := &ResponsePlayer{}
+	contentRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/contents/Dockerfile"),
+		"testdata/responses/contents_dockerfile.yml",
+	)
+	missingRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/contents/path/bar.txt"),
+		"testdata/responses/contents_missing.yml",
+	)
+
+	ctx := makeContext(t, rp, nil)
+
+	content, err := ctx.FileContent("Dockerfile")
+	require.NoError(t, err)
+	assert.Equal(t, "FROM golang:latest\n", string(content))
+
+	content, err = ctx.FileContent("path/bar.txt")
+	require.NoError(t, err)
+	assert.Nil(t, content, "missing files should have no content")
+
+	// verify that the content is cached
+	_, err = ctx.FileContent("Dockerfile")
+	require.NoError(t, err)
+	_, err = ctx.FileContent("path/bar.txt")
+	require.NoError(t, err)
+	assert.Equal(t, 1, contentRule.Count, "cached content was not used")
+	assert.Equal(t, 1, missingRule.Count, "cached missing file was not used")
+}
+
+func TestFileContentTooLarge(t *testing.T) {
+	rp := &ResponsePlayer{}
+	rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/contents/large.bin"),
+		"testdata/responses/contents_large.yml",
+	)
+
+	ctx := makeContext(t, rp, nil)
+
+	_, err := ctx.FileContent("large.bin")
+	require.True(t, IsTooLarge(err), "expected too large error, got: %v", err)
+	assert.EqualError(t, err, "file large.bin is too large, maximum size is 1048576 bytes")
+}
+
+func TestPrefetchFileContents(t *testing.T) {
+	rp := &ResponsePlayer{}
+	queryRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.object"),
+		"testdata/responses/contents_prefetch.yml",
+	)
+	contentRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/contents/Dockerfile"),
+		"testdata/responses/contents_dockerfile.yml",
+	)
+	missingRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/contents/path/bar.txt"),
+		"testdata/responses/contents_missing.yml",
+	)
+	binaryRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/contents/image.png"),
+		"testdata/responses/contents_dockerfile.yml",
+	)
+
+	ctx := makeContext(t, rp, nil)
+
+	paths := []string{"Dockerfile", "path/bar.txt", "image.png"}
+	err := ctx.(ContentPrefetcher).PrefetchFileContents(paths)
+	require.NoError(t, err)
+	assert.Equal(t, 1, queryRule.Count, "files were not loaded in one query")
+
+	content, err := ctx.FileContent("Dockerfile")
+	require.NoError(t, err)
+	assert.Equal(t, "FROM golang:latest\n", string(content))
+
+	content, err = ctx.FileContent("path/bar.txt")
+	require.NoError(t, err)
+	assert.Nil(t, content, "missing files should have no content")
+
+	assert.Equal(t, 0, contentRule.Count, "prefetched content was not used")
+	assert.Equal(t, 0, missingRule.Count, "prefetched missing file was not used")
+
+	// binary files are loaded individually
+	_, err = ctx.FileContent("image.png")
+	require.NoError(t, err)
+	assert.Equal(t, 1, binaryRule.Count, "binary file was not loaded individually")
+
+	// cached files are not requested again
+	err = ctx.(ContentPrefetcher).PrefetchFileContents(paths[:2])
+	require.NoError(t, err)
+	assert.Equal(t, 1, queryRule.Count, "cached files were requested")
+}
+
+func TestHydratedCounts(t *testing.T) {
+	rp := &ResponsePlayer{}
+	filesRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/pulls/123/files"),
+		"testdata/responses/pull_files.yml",
+	)
+	dataRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.commits"),
+		"testdata/responses/pull_commits.yml",
+	)
+
+	pr := defaultTestPR()
+	pr.ChangedFiles = github.Int(0)
+	pr.Commits = github.Int(MaxPullRequestCommits + 50)
+	pr.Body = github.String("test body")
+	pr.Labels = []*github.Label{{Name: github.String("test-label")}}
+
+	ctx := makeContext(t, rp, pr)
+
+	files, err := ctx.ChangedFiles()
+	require.NoError(t, err)
+	assert.Empty(t, files, "incorrect number of files")
+	assert.Equal(t, 0, filesRule.Count, "files were listed")
+
+	_, err = ctx.Commits()
+	assert.True(t, IsTooLarge(err), "expected too large error, got: %v", err)
+	assert.Equal(t, 0, dataRule.Count, "commits were loaded")
+
+	ghc := ctx.(*GitHubContext)
+	assert.Equal(t, "test body", ghc.pr.Body)
+	require.Len(t, ghc.pr.Labels.Nodes, 1, "incorrect number of labels")
+	assert.Equal(t, "test-label", ghc.pr.Labels.Nodes[0].Name)
+
+	pr.ChangedFiles = github.Int(MaxPullRequestFiles)
+	ctx = makeContext(t, rp, pr)
+
+	_, err = ctx.ChangedFiles()
+	assert.True(t, IsTooLarge(err), "expected too large error, got: %v", err)
+	assert.Equal(t, 0, filesRule.Count, "files were listed")
+}
+
+func TestCanonicalAuthor(t *testing.T) {
+	pr := defaultTestPR()
+	pr.User.Login = github.String("MHaypenny")
+
+	ctx := makeContext(t, &ResponsePlayer{}, pr)
+	assert.Equal(t, "mhaypenny", ctx.Author())
+}
+
 func TestCommits(t *testing.T) {
 	rp := &ResponsePlayer{}
 	dataRule := rp.AddRule(
@@ -97,6 +243,7 @@ func TestCommits(t *testing.T) {
 	assert.Equal(t, "ttest", commits[2].Author)
 	assert.Equal(t, "mhaypenny", commits[2].Committer)
 	assert.Equal(t, newTime(expectedTime.Add(48*time.Hour)), commits[2].PushedAt)
+	assert.Equal(t, "Apply suggestions from code review", commits[2].MessageHeadline)
 
 	// verify that the commit list is cached
 	commits, err = ctx.Commits()
@@ -104,6 +251,13 @@ func TestCommits(t *testing.T) {
 
 	require.Len(t, commits, 3, "incorrect number of commits")
 	assert.Equal(t, 2, dataRule.Count, "cached commits were not used")
+
+	// verify that pushed dates do not require new requests when available
+	commits, err = ctx.CommitsWithPushedDates()
+	require.NoError(t, err)
+
+	require.Len(t, commits, 3, "incorrect number of commits")
+	assert.Equal(t, 2, dataRule.Count, "cached commits were not used")
 }
 
 func TestCommitsRetry(t *testing.T) {
@@ -115,9 +269,17 @@ func TestCommitsRetry(t *testing.T) {
 
 	ctx := makeContext(t, rp, nil)
 
+	// loading commits without pushed dates does not retry
 	commits, err := ctx.Commits()
 	require.NoError(t, err)
 
+	require.Len(t, commits, 3, "incorrect number of commits")
+	assert.Equal(t, 1, dataRule.Count, "incorrect number of http requests")
+	assert.Nil(t, commits[2].PushedAt)
+
+	commits, err = ctx.CommitsWithPushedDates()
+	require.NoError(t, err)
+
 	require.Len(t, commits, 3, "incorrect number of commits")
 	assert.Equal(t, 2, dataRule.Count, "incorrect number of http requests")
 
@@ -140,6 +302,232 @@ func TestCommitsRetry(t *testing.T) {
 	assert.Equal(t, newTime(expectedTime.Add(48*time.Hour)), commits[2].PushedAt)
 }
 
+func TestCommitsPushedDateFallback(t *testing.T) {
+	rp := &ResponsePlayer{}
+	dataRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.commits"),
+		"testdata/responses/pull_commits_no_pushed_date.yml",
+	)
+
+	ctx := makeContext(t, rp, nil)
+
+	_, err := ctx.CommitsWithPushedDates()
+	require.EqualError(t, err, "head commit e05fcae367 is missing pushed date; this is probably a bug")
+
+	ctx = makeContextWithFallback(t, rp, nil, PushedDateFallbackCommitted)
+	dataRule.Count = 0
+
+	commits, err := ctx.CommitsWithPushedDates()
+	require.NoError(t, err)
+
+	require.Len(t, commits, 2, "incorrect number of commits")
+	assert.Equal(t, commitLoadMaxAttempts, dataRule.Count, "incorrect number of http requests")
+
+	expectedTime, err := time.Parse(time.RFC3339, "2018-12-04T12:34:56Z")
+	require.NoError(t, err)
+
+	assert.Equal(t, newTime(expectedTime), commits[0].PushedAt)
+	assert.Equal(t, newTime(expectedTime.Add(48*time.Hour)), commits[1].PushedAt)
+}
+
+func TestDeletedHeadRepository(t *testing.T) {
+	rp := &ResponsePlayer{}
+	prRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.headRepository"),
+		"testdata/responses/pull_deleted_fork.yml",
+	)
+	dataRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.commits"),
+		"testdata/responses/pull_commits_no_pushed_date.yml",
+	)
+
+	pr := defaultTestPR()
+	pr.Head.Repo = nil
+
+	ctx := makeContext(t, rp, pr)
+	assert.Equal(t, 1, prRule.Count, "incorrect number of http requests")
+
+	base, head := ctx.Branches()
+	assert.Equal(t, "develop", base)
+	assert.Equal(t, ":test-branch", head)
+
+	_, err := ctx.CommitsWithPushedDates()
+	require.Error(t, err, "commit dates must not be used without a fallback")
+	assert.Equal(t, 1, dataRule.Count, "incorrect number of http requests")
+
+	ctx = makeContextWithFallback(t, rp, pr, PushedDateFallbackCommitted)
+
+	commits, err := ctx.CommitsWithPushedDates()
+	require.NoError(t, err)
+
+	require.Len(t, commits, 2, "incorrect number of commits")
+	assert.Equal(t, 2, dataRule.Count, "incorrect number of http requests")
+
+	expectedTime, err := time.Parse(time.RFC3339, "2018-12-04T12:34:56Z")
+	require.NoError(t, err)
+
+	assert.Equal(t, newTime(expectedTime), commits[0].PushedAt)
+	assert.Equal(t, newTime(expectedTime.Add(48*time.Hour)), commits[1].PushedAt)
+}
+
+func TestCommitsConcurrent(t *testing.T) {
+	rp := &ResponsePlayer{}
+	dataRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.commits"),
+		"testdata/responses/pull_commits.yml",
+	)
+
+	ctx := makeContext(t, rp, nil)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = ctx.Commits()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, dataRule.Count, "commits were loaded more than once")
+}
+
+func TestLoadDifferentDataConcurrently(t *testing.T) {
+	rp := &ResponsePlayer{}
+	filesRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/pulls/123/files"),
+		"testdata/responses/pull_files.yml",
+	)
+	commitsRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.commits"),
+		"testdata/responses/pull_commits.yml",
+	)
+
+	// both loads must have a request in flight before either gets a
+	// response, which times out if the loads are serialized
+	barrier := &barrierTransport{rt: rp, n: 2, ready: make(chan struct{})}
+	ctx := makeContextWithTransport(t, barrier, nil, PushedDateFallbackNone)
+
+	var wg sync.WaitGroup
+	var filesErr, commitsErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, filesErr = ctx.ChangedFiles()
+	}()
+	go func() {
+		defer wg.Done()
+		_, commitsErr = ctx.Commits()
+	}()
+	wg.Wait()
+
+	require.NoError(t, filesErr)
+	require.NoError(t, commitsErr)
+	assert.Equal(t, 2, filesRule.Count, "incorrect number of files requests")
+	assert.Equal(t, 2, commitsRule.Count, "incorrect number of commits requests")
+}
+
+// barrierTransport holds requests until n requests have arrived.
+type barrierTransport struct {
+	rt http.RoundTripper
+	n  int
+
+	mu      sync.Mutex
+	arrived int
+	ready   chan struct{}
+}
+
+func (t *barrierTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.arrived++
+	if t.arrived == t.n {
+		close(t.ready)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-t.ready:
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("timed out waiting for concurrent requests")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rt.RoundTrip(req)
+}
+
+func TestWalkCommits(t *testing.T) {
+	rp := &ResponsePlayer{}
+	dataRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.commits"),
+		"testdata/responses/pull_commits.yml",
+	)
+
+	ctx := makeContext(t, rp, nil)
+
+	var chunks [][]*Commit
+	err := ctx.WalkCommits(func(commits []*Commit) (bool, error) {
+		chunks = append(chunks, commits)
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, chunks, 1, "incorrect number of chunks")
+	assert.Len(t, chunks[0], 3, "incorrect number of commits")
+	assert.Equal(t, 2, dataRule.Count, "incorrect number of http requests")
+}
+
+func TestWalkCommitsTooLarge(t *testing.T) {
+	rp := &ResponsePlayer{}
+	dataRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.commits"),
+		"testdata/responses/pull_commits_large.yml",
+	)
+	compareRule := rp.AddRule(
+		ExactPathMatcher("/repos/testorg/testrepo/compare/develop...e05fcae367230ee709313dd2720da527d178ce43"),
+		"testdata/responses/compare_large.yml",
+	)
+
+	ctx := makeContext(t, rp, nil)
+
+	_, err := ctx.Commits()
+	require.True(t, IsTooLarge(err), "expected too large error, got: %v", err)
+
+	var commits []*Commit
+	err = ctx.WalkCommits(func(chunk []*Commit) (bool, error) {
+		commits = append(commits, chunk...)
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, commits, 3, "incorrect number of commits")
+	assert.Equal(t, 2, compareRule.Count, "incorrect number of http requests")
+
+	assert.Equal(t, "a6f3f69b64eaafece5a0d854eb4af11c0d64394c", commits[0].SHA)
+	assert.Equal(t, []string{"0492883704e64bb53834c7c5fbd5fc22d44dedda"}, commits[0].Parents)
+	assert.Equal(t, "mhaypenny", commits[0].Committer)
+	assert.False(t, commits[0].CommittedViaWeb)
+
+	assert.Equal(t, "1fc89f1cedf8e3f3ce516ab75b5952295c8ea5e9", commits[1].SHA)
+	assert.True(t, commits[1].CommittedViaWeb)
+
+	assert.Equal(t, "e05fcae367230ee709313dd2720da527d178ce43", commits[2].SHA)
+	assert.Equal(t, "ttest", commits[2].Author)
+
+	// verify that the walk stops when requested
+	compareRule.Count = 0
+	err = ctx.WalkCommits(func(chunk []*Commit) (bool, error) {
+		return false, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, compareRule.Count, "walk did not stop")
+	assert.Equal(t, 3, dataRule.Count, "too large commits were loaded again")
+}
+
 func TestReviews(t *testing.T) {
 	rp := &ResponsePlayer{}
 	dataRule := rp.AddRule(
@@ -167,6 +555,8 @@ func TestReviews(t *testing.T) {
 	assert.Equal(t, expectedTime.Add(time.Second), reviews[1].CreatedAt)
 	assert.Equal(t, ReviewApproved, reviews[1].State)
 	assert.Equal(t, "the body", reviews[1].Body)
+	assert.Equal(t, "MDE3OlB1bGxSZXF1ZXN0UmV2aWV3Mg==", reviews[1].ID)
+	assert.Equal(t, "e05fcae367230ee709313dd2720da527d178ce43", reviews[1].CommitSHA)
 
 	// verify that the review list is cached
 	reviews, err = ctx.Reviews()
@@ -176,6 +566,85 @@ func TestReviews(t *testing.T) {
 	assert.Equal(t, 2, dataRule.Count, "cached reviews were not used")
 }
 
+func TestDismissReviews(t *testing.T) {
+	rp := &ResponsePlayer{}
+	rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.reviews"),
+		"testdata/responses/pull_reviews.yml",
+	)
+
+	// dismiss before loading reviews
+	ctx := makeContext(t, rp, nil)
+	ctx.(*GitHubContext).DismissReviews("MDE3OlB1bGxSZXF1ZXN0UmV2aWV3Mg==")
+
+	reviews, err := ctx.Reviews()
+	require.NoError(t, err)
+
+	require.Len(t, reviews, 1, "incorrect number of reviews")
+	assert.Equal(t, "mhaypenny", reviews[0].Author)
+
+	// dismiss after loading reviews
+	ctx = makeContext(t, rp, nil)
+
+	reviews, err = ctx.Reviews()
+	require.NoError(t, err)
+	require.Len(t, reviews, 2, "incorrect number of reviews")
+
+	ctx.(*GitHubContext).DismissReviews("MDE3OlB1bGxSZXF1ZXN0UmV2aWV3MQ==")
+
+	reviews, err = ctx.Reviews()
+	require.NoError(t, err)
+
+	require.Len(t, reviews, 1, "incorrect number of reviews")
+	assert.Equal(t, "bkeyes", reviews[0].Author)
+}
+
+// pageSizeRecorder records the pageSize variable of matching GraphQL queries
+type pageSizeRecorder struct {
+	GraphQLNodePrefixMatcher
+	sizes []int
+}
+
+func (m *pageSizeRecorder) Matches(r *http.Request, body []byte) bool {
+	if !m.GraphQLNodePrefixMatcher.Matches(r, body) {
+		return false
+	}
+
+	var d struct {
+		Variables struct {
+			PageSize int `json:"pageSize"`
+		} `json:"variables"`
+	}
+	if err := json.Unmarshal(body, &d); err == nil {
+		m.sizes = append(m.sizes, d.Variables.PageSize)
+	}
+	return true
+}
+
+func TestGraphQLUsage(t *testing.T) {
+	rp := &ResponsePlayer{}
+	matcher := &pageSizeRecorder{GraphQLNodePrefixMatcher: "repository.pullRequest.reviews"}
+	rp.AddRule(matcher, "testdata/responses/pull_reviews_rate_limit.yml")
+
+	ctx := makeContext(t, rp, nil)
+
+	reviews, err := ctx.Reviews()
+	require.NoError(t, err)
+	require.Len(t, reviews, 2, "incorrect number of reviews")
+
+	// the second page is smaller because less than 10% of the limit remains
+	assert.Equal(t, []int{100, 50}, matcher.sizes)
+
+	usage := ctx.(*GitHubContext).GraphQLUsage()
+	assert.Equal(t, GraphQLUsage{
+		Queries:   2,
+		Cost:      2,
+		Remaining: 399,
+		Limit:     5000,
+		ResetAt:   time.Date(2020, 5, 20, 19, 0, 0, 0, time.UTC),
+	}, usage)
+}
+
 func TestNoReviews(t *testing.T) {
 	rp := &ResponsePlayer{}
 	dataRule := rp.AddRule(
@@ -231,6 +700,34 @@ func TestComments(t *testing.T) {
 	assert.Equal(t, 2, dataRule.Count, "cached comments were not used")
 }
 
+func TestFilterComments(t *testing.T) {
+	rp := &ResponsePlayer{}
+	rp.AddRule(
+		GraphQLNodePrefixMatcher("repository.pullRequest.comments"),
+		"testdata/responses/pull_comments.yml",
+	)
+
+	ctx := makeContext(t, rp, nil)
+	ctx.(*GitHubContext).FilterComments(func(c *Comment) bool {
+		return !strings.HasSuffix(c.Author, "[bot]")
+	})
+
+	comments, err := ctx.Comments()
+	require.NoError(t, err)
+
+	require.Len(t, comments, 1, "incorrect number of comments")
+	assert.Equal(t, "bkeyes", comments[0].Author)
+
+	// filtering again removes comments that are already loaded
+	ctx.(*GitHubContext).FilterComments(func(c *Comment) bool {
+		return c.Body != ":+1:"
+	})
+
+	comments, err = ctx.Comments()
+	require.NoError(t, err)
+	assert.Empty(t, comments, "incorrect number of comments")
+}
+
 func TestNoComments(t *testing.T) {
 	rp := &ResponsePlayer{}
 	dataRule := rp.AddRule(
@@ -373,15 +870,249 @@ func TestIsOrgMember(t *testing.T) {
 	assert.Equal(t, 1, yesRule.Count, "cached membership was not used")
 }
 
+func TestHasVerifiedSigningKey(t *testing.T) {
+	rp := &ResponsePlayer{}
+	gpgRule := rp.AddRule(
+		ExactPathMatcher("/users/mhaypenny/gpg_keys"),
+		"testdata/responses/gpg_keys_mhaypenny.yml",
+	)
+	rp.AddRule(
+		ExactPathMatcher("/users/ttest/gpg_keys"),
+		"testdata/responses/gpg_keys_ttest.yml",
+	)
+	rp.AddRule(
+		ExactPathMatcher("/users/signer/gpg_keys"),
+		"testdata/responses/gpg_keys_empty.yml",
+	)
+	sshRule := rp.AddRule(
+		ExactPathMatcher("/users/ttest/ssh_signing_keys"),
+		"testdata/responses/ssh_signing_keys_empty.yml",
+	)
+	rp.AddRule(
+		ExactPathMatcher("/users/signer/ssh_signing_keys"),
+		"testdata/responses/ssh_signing_keys_signer.yml",
+	)
+
+	ctx := makeContext(t, rp, nil)
+
+	// a signing subkey of a key with a verified email
+	hasKey, err := ctx.HasVerifiedSigningKey("mhaypenny")
+	require.NoError(t, err)
+	assert.True(t, hasKey, "user does not have a signing key")
+
+	// a signing key without a verified email and no SSH keys
+	hasKey, err = ctx.HasVerifiedSigningKey("ttest")
+	require.NoError(t, err)
+	assert.False(t, hasKey, "user has a signing key")
+	assert.Equal(t, 1, sshRule.Count, "no http request was made for SSH keys")
+
+	// an SSH signing key
+	hasKey, err = ctx.HasVerifiedSigningKey("signer")
+	require.NoError(t, err)
+	assert.True(t, hasKey, "user does not have a signing key")
+
+	// verify that keys are cached
+	hasKey, err = ctx.HasVerifiedSigningKey("mhaypenny")
+	require.NoError(t, err)
+	assert.True(t, hasKey, "user does not have a signing key")
+	assert.Equal(t, 1, gpgRule.Count, "cached keys were not used")
+}
+
+func TestLinkedIssue(t *testing.T) {
+	rp := &ResponsePlayer{}
+	rp.AddRule(
+		ExactPathMatcher("/repos/palantir/cab/issues/12"),
+		"testdata/responses/issue_cab.yml",
+	)
+	rp.AddRule(
+		ExactPathMatcher("/repos/palantir/cab/issues/13"),
+		"testdata/responses/issue_cab.yml",
+	)
+	commentsRule := rp.AddRule(
+		ExactPathMatcher("/repos/palantir/cab/issues/12/comments"),
+		"testdata/responses/issue_comments_cab.yml",
+	)
+	rp.AddRule(
+		ExactPathMatcher("/repos/palantir/cab/pulls/12/reviews"),
+		"testdata/responses/pull_reviews_cab.yml",
+	)
+	rp.AddRule(
+		ExactPathMatcher("/repos/palantir/cab/issues/13/comments"),
+		"testdata/responses/issue_comments_cab.yml",
+	)
+
+	ctx := makeContext(t, rp, nil)
+
+	issue, err := ctx.LinkedIssue("palantir", "cab", 12)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Approves testorg/testrepo#123", issue.Body)
+	require.Len(t, issue.Comments, 1, "incorrect number of comments")
+	assert.Equal(t, "cab-member", issue.Comments[0].Author)
+	assert.Equal(t, "CAB approved", issue.Comments[0].Body)
+
+	require.Len(t, issue.Reviews, 1, "incorrect number of reviews")
+	assert.Equal(t, "cab-chair", issue.Reviews[0].Author)
+	assert.Equal(t, ReviewApproved, issue.Reviews[0].State)
+
+	// verify that the issue is cached
+	_, err = ctx.LinkedIssue("Palantir", "CAB", 12)
+	require.NoError(t, err)
+	assert.Equal(t, 1, commentsRule.Count, "cached issue was not used")
+
+	// issues have no reviews
+	issue, err = ctx.LinkedIssue("palantir", "cab", 13)
+	require.NoError(t, err)
+	assert.Len(t, issue.Comments, 1, "incorrect number of comments")
+	assert.Empty(t, issue.Reviews, "issue has reviews")
+}
+
+func TestUpstream(t *testing.T) {
+	t.Run("open", func(t *testing.T) {
+		rp := &ResponsePlayer{}
+		dataRule := rp.AddRule(
+			GraphQLNodePrefixMatcher("repository.pullRequest.timelineItems"),
+			"testdata/responses/pull_upstream_open.yml",
+		)
+
+		ctx := makeContext(t, rp, nil)
+
+		upstream, err := ctx.Upstream()
+		require.NoError(t, err)
+		require.NotNil(t, upstream, "no upstream pull request")
+
+		assert.Equal(t, &Upstream{
+			Number:  125,
+			HeadSHA: "c6ade256ecfc755d8bc877ef22cc9e01745d46bb",
+			Base:    "master",
+		}, upstream, "forks must not be upstreams")
+
+		// verify that the upstream is cached
+		_, err = ctx.Upstream()
+		require.NoError(t, err)
+		assert.Equal(t, 1, dataRule.Count, "cached upstream was not used")
+	})
+
+	t.Run("merged", func(t *testing.T) {
+		rp := &ResponsePlayer{}
+		rp.AddRule(
+			GraphQLNodePrefixMatcher("repository.pullRequest.timelineItems"),
+			"testdata/responses/pull_upstream_retargeted.yml",
+		)
+		mergedRule := rp.AddRule(
+			GraphQLNodePrefixMatcher("repository.pullRequests"),
+			"testdata/responses/pull_upstream_merged.yml",
+		)
+
+		ctx := makeContext(t, rp, nil)
+
+		upstream, err := ctx.Upstream()
+		require.NoError(t, err)
+		require.NotNil(t, upstream, "no upstream pull request")
+
+		assert.Equal(t, &Upstream{
+			Number:  121,
+			HeadSHA: "c6ade256ecfc755d8bc877ef22cc9e01745d46bb",
+			Base:    "develop",
+			Merged:  true,
+		}, upstream, "upstream must target the current base branch")
+		assert.Equal(t, 1, mergedRule.Count, "no http request was made")
+	})
+
+	t.Run("none", func(t *testing.T) {
+		rp := &ResponsePlayer{}
+		rp.AddRule(
+			GraphQLNodePrefixMatcher("repository.pullRequest.timelineItems"),
+			"testdata/responses/pull_upstream_none.yml",
+		)
+
+		ctx := makeContext(t, rp, nil)
+
+		upstream, err := ctx.Upstream()
+		require.NoError(t, err)
+		assert.Nil(t, upstream, "pull request is not stacked")
+	})
+}
+
+func TestPrefetchMembership(t *testing.T) {
+	rp := &ResponsePlayer{}
+	teamsRule := rp.AddRule(
+		ExactPathMatcher("/orgs/testorg/teams"),
+		"testdata/responses/teams_testorg.yml",
+	)
+	orgRule := rp.AddRule(
+		ExactPathMatcher("/orgs/testorg/members/mhaypenny"),
+		"testdata/responses/membership_testorg_mhaypenny.yml",
+	)
+	teamQueryRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("organization.team.members"),
+		"testdata/responses/membership_prefetch_teams.yml",
+	)
+	orgQueryRule := rp.AddRule(
+		GraphQLNodePrefixMatcher("user.organization"),
+		"testdata/responses/membership_prefetch_orgs.yml",
+	)
+
+	ctx := makeContext(t, rp, nil)
+	mbrCtx := ctx.(*GitHubContext).MembershipContext.(*GitHubMembershipContext)
+
+	teams := []string{"testorg/yes-team", "testorg/no-team", "testorg/other-team"}
+	orgs := []string{"testorg", "otherorg"}
+
+	err := ctx.(MembershipPrefetcher).PrefetchMembership("mhaypenny", teams, orgs)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, teamQueryRule.Count, "teams were not checked in one query")
+	assert.Equal(t, 1, orgQueryRule.Count, "organizations were not checked in one query")
+
+	isMember, err := ctx.IsTeamMember("testorg/yes-team", "mhaypenny")
+	require.NoError(t, err)
+	assert.True(t, isMember, "user is not a member")
+
+	// the login of the other member contains the user's login
+	isMember, err = ctx.IsTeamMember("testorg/no-team", "mhaypenny")
+	require.NoError(t, err)
+	assert.False(t, isMember, "user is a member")
+
+	// missing teams are checked individually
+	_, cached := mbrCtx.cachedMembership(membershipKey("testorg/other-team", "mhaypenny"))
+	assert.False(t, cached, "membership in missing team was cached")
+
+	isMember, err = ctx.IsOrgMember("testorg", "mhaypenny")
+	require.NoError(t, err)
+	assert.True(t, isMember, "user is not a member")
+
+	isMember, err = ctx.IsOrgMember("otherorg", "mhaypenny")
+	require.NoError(t, err)
+	assert.False(t, isMember, "user is a member")
+
+	assert.Equal(t, 0, teamsRule.Count, "prefetched team memberships were not used")
+	assert.Equal(t, 0, orgRule.Count, "prefetched organization memberships were not used")
+
+	// cached memberships are not requested again
+	err = ctx.(MembershipPrefetcher).PrefetchMembership("mhaypenny", teams[:2], orgs)
+	require.NoError(t, err)
+	assert.Equal(t, 1, teamQueryRule.Count, "cached team memberships were requested")
+	assert.Equal(t, 1, orgQueryRule.Count, "cached organization memberships were requested")
+}
+
 func makeContext(t *testing.T, rp *ResponsePlayer, pr *github.PullRequest) Context {
-	ctx := context.Background()
-	client := github.NewClient(&http.Client{Transport: rp})
-	v4client := githubv4.NewClient(&http.Client{Transport: rp})
+	return makeContextWithFallback(t, rp, pr, PushedDateFallbackNone)
+}
+
+func makeContextWithFallback(t *testing.T, rp *ResponsePlayer, pr *github.PullRequest, fallback PushedDateFallback) Context {
+	return makeContextWithTransport(t, rp, pr, fallback)
+}
+
+func makeContextWithTransport(t *testing.T, rt http.RoundTripper, pr *github.PullRequest, fallback PushedDateFallback) Context {
+	ctx := WithPushedDateFallback(context.Background(), fallback)
+	client := github.NewClient(&http.Client{Transport: rt})
+	v4client := githubv4.NewClient(&http.Client{Transport: rt})
 
 	base, _ := url.Parse("http://github.localhost/")
 	client.BaseURL = base
 
-	mbrCtx := NewGitHubMembershipContext(ctx, client)
+	mbrCtx := NewGitHubMembershipContext(ctx, client, v4client)
 	if pr == nil {
 		pr = defaultTestPR()
 	}
@@ -430,3 +1161,20 @@ func defaultTestPR() *github.PullRequest {
 func newTime(t time.Time) *time.Time {
 	return &t
 }
+
+func TestParseLocator(t *testing.T) {
+	for _, s := range []string{
+		"palantir/policy-bot#123",
+		"https://github.com/palantir/policy-bot/pull/123",
+		" https://github.example.com/palantir/policy-bot/pull/123/ ",
+	} {
+		loc, err := ParseLocator(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, Locator{Owner: "palantir", Repo: "policy-bot", Number: 123}, loc, s)
+	}
+
+	for _, s := range []string{"", "palantir/policy-bot", "palantir/policy-bot#0", "https://github.com/palantir/policy-bot/issues/123"} {
+		_, err := ParseLocator(s)
+		assert.Error(t, err, s)
+	}
+}
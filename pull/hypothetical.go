@@ -0,0 +1,134 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"strings"
+	"time"
+)
+
+// Hypothetical describes changes to a pull request that have not happened. It
+// is used to see how changes would affect the evaluation of a policy.
+type Hypothetical struct {
+	// Approvers are users who are assumed to approve the head commit with a
+	// review.
+	Approvers []string `json:"approvers,omitempty"`
+
+	// UnchangedFiles are the names of changed files that are assumed to be
+	// unchanged.
+	UnchangedFiles []string `json:"unchanged_files,omitempty"`
+
+	// AddedLabels are labels that are assumed to be on the pull request.
+	AddedLabels []string `json:"added_labels,omitempty"`
+
+	// RemovedLabels are labels that are assumed to be removed from the pull
+	// request. Labels are compared case-insensitively.
+	RemovedLabels []string `json:"removed_labels,omitempty"`
+}
+
+// IsEmpty returns true if the hypothetical does not change anything.
+func (h Hypothetical) IsEmpty() bool {
+	return len(h.Approvers) == 0 && len(h.UnchangedFiles) == 0 && len(h.AddedLabels) == 0 && len(h.RemovedLabels) == 0
+}
+
+// WithHypothetical returns a Context that applies the changes described by h
+// to prctx. Other data is loaded from prctx.
+func WithHypothetical(prctx Context, h Hypothetical) Context {
+	if h.IsEmpty() {
+		return prctx
+	}
+
+	unchanged := make(map[string]bool, len(h.UnchangedFiles))
+	for _, f := range h.UnchangedFiles {
+		unchanged[f] = true
+	}
+	return &hypotheticalContext{
+		Context:   prctx,
+		approvers: h.Approvers,
+		unchanged: unchanged,
+		added:     h.AddedLabels,
+		removed:   h.RemovedLabels,
+		now:       time.Now(),
+	}
+}
+
+type hypotheticalContext struct {
+	Context
+
+	approvers []string
+	unchanged map[string]bool
+	added     []string
+	removed   []string
+	now       time.Time
+}
+
+func (c *hypotheticalContext) Labels() []string {
+	labels := c.Context.Labels()
+	if len(c.added) == 0 && len(c.removed) == 0 {
+		return labels
+	}
+
+	result := make([]string, 0, len(labels)+len(c.added))
+	for _, l := range append(append([]string(nil), labels...), c.added...) {
+		if !containsFold(c.removed, l) && !containsFold(result, l) {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+func (c *hypotheticalContext) ChangedFiles() ([]*File, error) {
+	files, err := c.Context.ChangedFiles()
+	if err != nil || len(c.unchanged) == 0 {
+		return files, err
+	}
+
+	changed := make([]*File, 0, len(files))
+	for _, f := range files {
+		if !c.unchanged[f.Filename] {
+			changed = append(changed, f)
+		}
+	}
+	return changed, nil
+}
+
+func (c *hypotheticalContext) Reviews() ([]*Review, error) {
+	reviews, err := c.Context.Reviews()
+	if err != nil || len(c.approvers) == 0 {
+		return reviews, err
+	}
+
+	all := make([]*Review, 0, len(reviews)+len(c.approvers))
+	all = append(all, reviews...)
+	for _, user := range c.approvers {
+		all = append(all, &Review{
+			CreatedAt: c.now,
+			Author:    CanonicalLogin(user),
+			State:     ReviewApproved,
+			ID:        "hypothetical-" + CanonicalLogin(user),
+			CommitSHA: c.HeadSHA(),
+		})
+	}
+	return all, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
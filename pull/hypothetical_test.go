@@ -0,0 +1,96 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticContext struct {
+	Context
+
+	files   []*File
+	reviews []*Review
+	labels  []string
+}
+
+func (c *staticContext) HeadSHA() string                { return "ab12" }
+func (c *staticContext) ChangedFiles() ([]*File, error) { return c.files, nil }
+func (c *staticContext) Reviews() ([]*Review, error)    { return c.reviews, nil }
+func (c *staticContext) Labels() []string               { return c.labels }
+
+func TestWithHypothetical(t *testing.T) {
+	prctx := &staticContext{
+		files: []*File{
+			{Filename: "app.go"},
+			{Filename: "docs/README.md"},
+		},
+		reviews: []*Review{
+			{Author: "mhaypenny", State: ReviewCommented},
+		},
+		labels: []string{"needs-review", "Do-Not-Merge"},
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		assert.Equal(t, Context(prctx), WithHypothetical(prctx, Hypothetical{}))
+	})
+
+	t.Run("approvers", func(t *testing.T) {
+		hctx := WithHypothetical(prctx, Hypothetical{Approvers: []string{"Ttaylorr"}})
+
+		reviews, err := hctx.Reviews()
+		require.NoError(t, err)
+		require.Len(t, reviews, 2)
+		assert.Equal(t, "mhaypenny", reviews[0].Author)
+		assert.Equal(t, "ttaylorr", reviews[1].Author)
+		assert.Equal(t, ReviewApproved, reviews[1].State)
+		assert.Equal(t, "ab12", reviews[1].CommitSHA)
+		assert.Len(t, prctx.reviews, 1, "hypothetical approvals must not modify the original reviews")
+
+		files, err := hctx.ChangedFiles()
+		require.NoError(t, err)
+		assert.Len(t, files, 2)
+	})
+
+	t.Run("unchangedFiles", func(t *testing.T) {
+		hctx := WithHypothetical(prctx, Hypothetical{UnchangedFiles: []string{"docs/README.md"}})
+
+		files, err := hctx.ChangedFiles()
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.Equal(t, "app.go", files[0].Filename)
+
+		reviews, err := hctx.Reviews()
+		require.NoError(t, err)
+		assert.Len(t, reviews, 1)
+	})
+
+	t.Run("labels", func(t *testing.T) {
+		hctx := WithHypothetical(prctx, Hypothetical{
+			AddedLabels:   []string{"approved", "needs-review"},
+			RemovedLabels: []string{"do-not-merge"},
+		})
+
+		assert.Equal(t, []string{"needs-review", "approved"}, hctx.Labels())
+		assert.Equal(t, []string{"needs-review", "Do-Not-Merge"}, prctx.labels, "hypothetical labels must not modify the original labels")
+
+		reviews, err := hctx.Reviews()
+		require.NoError(t, err)
+		assert.Len(t, reviews, 1)
+	})
+}
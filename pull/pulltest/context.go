@@ -15,6 +15,9 @@
 package pulltest
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/palantir/policy-bot/pull"
 )
 
@@ -23,8 +26,17 @@ type Context struct {
 	RepoValue   string
 	NumberValue int
 
-	AuthorValue  string
-	HeadSHAValue string
+	AuthorValue    string
+	TitleValue     string
+	BodyValue      string
+	LabelsValue    []string
+	DraftValue     bool
+	DraftError     error
+	CreatedAtValue time.Time
+	HeadSHAValue   string
+
+	AuthorPermissionValue string
+	AuthorPermissionError error
 
 	BranchBaseName string
 	BranchHeadName string
@@ -32,6 +44,14 @@ type Context struct {
 	ChangedFilesValue []*pull.File
 	ChangedFilesError error
 
+	// FileContents maps file paths to their content at the head commit
+	FileContents     map[string]string
+	FileContentError error
+
+	// BaseFileContents maps file paths to their content on the base branch
+	BaseFileContents     map[string]string
+	BaseFileContentError error
+
 	CommitsValue []*pull.Commit
 	CommitsError error
 
@@ -41,6 +61,13 @@ type Context struct {
 	ReviewsValue []*pull.Review
 	ReviewsError error
 
+	UpstreamValue *pull.Upstream
+	UpstreamError error
+
+	// LinkedIssues maps "owner/repo#number" to the activity on the issue
+	LinkedIssues     map[string]*pull.LinkedIssue
+	LinkedIssueError error
+
 	TeamMemberships     map[string][]string
 	TeamMembershipError error
 
@@ -49,6 +76,13 @@ type Context struct {
 
 	CollaboratorMemberships     map[string][]string
 	CollaboratorMembershipError error
+
+	GroupMemberships     map[string][]string
+	GroupMembershipError error
+
+	// SigningKeys are the users with verified signing keys
+	SigningKeys     []string
+	SigningKeyError error
 }
 
 func (c *Context) RepositoryOwner() string {
@@ -76,6 +110,30 @@ func (c *Context) Author() string {
 	return c.AuthorValue
 }
 
+func (c *Context) AuthorPermission() (string, error) {
+	return c.AuthorPermissionValue, c.AuthorPermissionError
+}
+
+func (c *Context) Title() string {
+	return c.TitleValue
+}
+
+func (c *Context) Body() string {
+	return c.BodyValue
+}
+
+func (c *Context) Labels() []string {
+	return c.LabelsValue
+}
+
+func (c *Context) IsDraft() (bool, error) {
+	return c.DraftValue, c.DraftError
+}
+
+func (c *Context) CreatedAt() time.Time {
+	return c.CreatedAtValue
+}
+
 func (c *Context) HeadSHA() string {
 	return c.HeadSHAValue
 }
@@ -88,10 +146,44 @@ func (c *Context) ChangedFiles() ([]*pull.File, error) {
 	return c.ChangedFilesValue, c.ChangedFilesError
 }
 
+func (c *Context) FileContent(path string) ([]byte, error) {
+	if c.FileContentError != nil {
+		return nil, c.FileContentError
+	}
+
+	if content, ok := c.FileContents[path]; ok {
+		return []byte(content), nil
+	}
+	return nil, nil
+}
+
+func (c *Context) BaseFileContent(path string) ([]byte, error) {
+	if c.BaseFileContentError != nil {
+		return nil, c.BaseFileContentError
+	}
+
+	if content, ok := c.BaseFileContents[path]; ok {
+		return []byte(content), nil
+	}
+	return nil, nil
+}
+
 func (c *Context) Commits() ([]*pull.Commit, error) {
 	return c.CommitsValue, c.CommitsError
 }
 
+func (c *Context) WalkCommits(fn func([]*pull.Commit) (bool, error)) error {
+	if c.CommitsError != nil {
+		return c.CommitsError
+	}
+	_, err := fn(c.CommitsValue)
+	return err
+}
+
+func (c *Context) CommitsWithPushedDates() ([]*pull.Commit, error) {
+	return c.CommitsValue, c.CommitsError
+}
+
 func (c *Context) IsTeamMember(team, user string) (bool, error) {
 	if c.TeamMembershipError != nil {
 		return false, c.TeamMembershipError
@@ -131,6 +223,32 @@ func (c *Context) IsCollaborator(org, repo, user, desiredPerm string) (bool, err
 	return false, nil
 }
 
+func (c *Context) IsGroupMember(group, user string) (bool, error) {
+	if c.GroupMembershipError != nil {
+		return false, c.GroupMembershipError
+	}
+
+	for _, g := range c.GroupMemberships[user] {
+		if g == group {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *Context) HasVerifiedSigningKey(user string) (bool, error) {
+	if c.SigningKeyError != nil {
+		return false, c.SigningKeyError
+	}
+
+	for _, u := range c.SigningKeys {
+		if u == user {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (c *Context) Comments() ([]*pull.Comment, error) {
 	return c.CommentsValue, c.CommentsError
 }
@@ -139,5 +257,20 @@ func (c *Context) Reviews() ([]*pull.Review, error) {
 	return c.ReviewsValue, c.ReviewsError
 }
 
+func (c *Context) Upstream() (*pull.Upstream, error) {
+	return c.UpstreamValue, c.UpstreamError
+}
+
+func (c *Context) LinkedIssue(owner, repo string, number int) (*pull.LinkedIssue, error) {
+	if c.LinkedIssueError != nil {
+		return nil, c.LinkedIssueError
+	}
+
+	if issue, ok := c.LinkedIssues[fmt.Sprintf("%s/%s#%d", owner, repo, number)]; ok {
+		return issue, nil
+	}
+	return &pull.LinkedIssue{}, nil
+}
+
 // assert that the test object implements the full interface
 var _ pull.Context = &Context{}
@@ -0,0 +1,319 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Recording is a list of GitHub API requests and their responses. Create
+// recordings of real evaluations with a Recorder and use them as fixtures
+// with a Replayer instead of writing responses by hand.
+type Recording struct {
+	Interactions []*Interaction `yaml:"interactions"`
+}
+
+// Interaction is a request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `yaml:"request"`
+	Response RecordedResponse `yaml:"response"`
+}
+
+// RecordedRequest identifies a request. The host is not recorded, so a
+// recording can be replayed against any base URL.
+type RecordedRequest struct {
+	Method string `yaml:"method"`
+	URL    string `yaml:"url"`
+	Body   string `yaml:"body,omitempty"`
+}
+
+// RecordedResponse is the content of a response.
+type RecordedResponse struct {
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body"`
+}
+
+// LoadRecording reads a recording from a file.
+func LoadRecording(path string) (*Recording, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read recording")
+	}
+
+	var r Recording
+	if err := yaml.UnmarshalStrict(b, &r); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal recording: %s", path)
+	}
+	return &r, nil
+}
+
+// Save writes the recording to a file.
+func (r *Recording) Save(path string) error {
+	b, err := yaml.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal recording")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, b, 0644), "failed to write recording")
+}
+
+// DefaultHeaders are the response headers kept by a Sanitizer with no
+// headers. The clients need these headers to decode responses and to follow
+// pagination.
+var DefaultHeaders = []string{"Content-Type", "Link"}
+
+var tokenPattern = regexp.MustCompile(`\b(gh[oprsu]_[A-Za-z0-9]{36,}|v1\.[0-9a-f]{40})\b`)
+
+// Sanitizer removes secrets from interactions before they are recorded.
+// Request headers are never recorded, so credentials sent by clients do not
+// need to be replaced.
+type Sanitizer struct {
+	// Headers are the response headers to keep. If empty, DefaultHeaders
+	// are kept.
+	Headers []string
+
+	// Replace lists pairs of strings to replace in the URLs and bodies of
+	// requests and in the headers and bodies of responses, like internal host
+	// names or private user names. GitHub tokens are always replaced.
+	Replace []string
+}
+
+// Sanitize removes secrets from an interaction.
+func (s Sanitizer) Sanitize(i *Interaction) {
+	replacer := strings.NewReplacer(s.Replace...)
+	clean := func(v string) string {
+		return tokenPattern.ReplaceAllString(replacer.Replace(v), "REDACTED")
+	}
+
+	i.Request.URL = clean(i.Request.URL)
+	i.Request.Body = clean(i.Request.Body)
+	i.Response.Body = clean(i.Response.Body)
+
+	keep := s.Headers
+	if len(keep) == 0 {
+		keep = DefaultHeaders
+	}
+
+	headers := make(map[string]string)
+	for _, name := range keep {
+		name = http.CanonicalHeaderKey(name)
+		if v, ok := i.Response.Headers[name]; ok {
+			headers[name] = clean(v)
+		}
+	}
+	i.Response.Headers = headers
+}
+
+// Recorder is an http.RoundTripper that records requests and responses. Use
+// it as the transport of the GitHub clients for a real evaluation and save
+// the recording when the evaluation is complete.
+type Recorder struct {
+	// Transport makes the requests. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+	Sanitizer Sanitizer
+
+	lock      sync.Mutex
+	recording Recording
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return r.record(transport, req)
+}
+
+// Wrap returns a transport that makes requests with next and records them
+// in the recorder. Use it to record the requests of several clients, like
+// the REST and GraphQL clients, in the same recording.
+func (r *Recorder) Wrap(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return r.record(next, req)
+	})
+}
+
+func (r *Recorder) record(transport http.RoundTripper, req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read request body")
+	}
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := readBody(&res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+
+	i := &Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.RequestURI(),
+			Body:   body,
+		},
+		Response: RecordedResponse{
+			Status:  res.StatusCode,
+			Headers: make(map[string]string),
+			Body:    resBody,
+		},
+	}
+	for k := range res.Header {
+		i.Response.Headers[k] = strings.Join(res.Header[k], ", ")
+	}
+	r.Sanitizer.Sanitize(i)
+
+	r.lock.Lock()
+	r.recording.Interactions = append(r.recording.Interactions, i)
+	r.lock.Unlock()
+
+	return res, nil
+}
+
+// Recording returns the interactions recorded so far.
+func (r *Recorder) Recording() *Recording {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return &Recording{
+		Interactions: append([]*Interaction(nil), r.recording.Interactions...),
+	}
+}
+
+// Save writes the interactions recorded so far to a file.
+func (r *Recorder) Save(path string) error {
+	return r.Recording().Save(path)
+}
+
+// Replayer is an http.RoundTripper that responds to requests with the
+// responses of a recording. Requests match an interaction if they have the
+// same method, URL, and body. Identical requests receive the responses of the
+// matching interactions in order; once they are used, the last response is
+// repeated. Requests that do not match any interaction receive a 404
+// response.
+type Replayer struct {
+	lock  sync.Mutex
+	byKey map[string][]*Interaction
+	used  map[string]int
+}
+
+// NewReplayer creates a Replayer for a recording.
+func NewReplayer(r *Recording) *Replayer {
+	rp := &Replayer{
+		byKey: make(map[string][]*Interaction),
+		used:  make(map[string]int),
+	}
+	for _, i := range r.Interactions {
+		key := interactionKey(i.Request.Method, i.Request.URL, i.Request.Body)
+		rp.byKey[key] = append(rp.byKey[key], i)
+	}
+	return rp
+}
+
+// LoadReplayer creates a Replayer for the recording in a file.
+func LoadReplayer(path string) (*Replayer, error) {
+	r, err := LoadRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(r), nil
+}
+
+func (rp *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read request body")
+	}
+
+	key := interactionKey(req.Method, req.URL.RequestURI(), body)
+
+	rp.lock.Lock()
+	interactions := rp.byKey[key]
+	index := rp.used[key]
+	if index < len(interactions)-1 {
+		rp.used[key]++
+	}
+	rp.lock.Unlock()
+
+	if len(interactions) == 0 {
+		return response(req, RecordedResponse{
+			Status: http.StatusNotFound,
+			Body:   fmt.Sprintf("no recorded response for \"%s %s\"", req.Method, req.URL.RequestURI()),
+		}), nil
+	}
+	return response(req, interactions[index].Response), nil
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func interactionKey(method, url, body string) string {
+	return method + " " + url + "\n" + body
+}
+
+func response(req *http.Request, r RecordedResponse) *http.Response {
+	header := make(http.Header)
+	for k, v := range r.Headers {
+		header.Set(k, v)
+	}
+
+	body := strings.NewReader(r.Body)
+
+	return &http.Response{
+		Status:     http.StatusText(r.Status),
+		StatusCode: r.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+
+		Header:        header,
+		Body:          ioutil.NopCloser(body),
+		ContentLength: body.Size(),
+
+		Request: req,
+	}
+}
+
+// readBody reads the content of a body and replaces it with an unread copy.
+func readBody(body *io.ReadCloser) (string, error) {
+	if *body == nil || *body == http.NoBody {
+		return "", nil
+	}
+
+	b, err := ioutil.ReadAll(*body)
+	_ = (*body).Close()
+	if err != nil {
+		return "", err
+	}
+
+	*body = ioutil.NopCloser(bytes.NewReader(b))
+	return string(b), nil
+}
@@ -0,0 +1,469 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Synthetic describes a pull request that does not exist on GitHub, including
+// the memberships of its users. It is used to see how a policy evaluates a
+// pull request before the pull request or the policy exist.
+type Synthetic struct {
+	Owner  string `yaml:"owner"`
+	Repo   string `yaml:"repo"`
+	Number int    `yaml:"number"`
+
+	Author    string    `yaml:"author"`
+	Title     string    `yaml:"title"`
+	Body      string    `yaml:"body"`
+	Labels    []string  `yaml:"labels"`
+	Draft     bool      `yaml:"draft"`
+	CreatedAt time.Time `yaml:"created_at"`
+
+	// Base and Head are the branch names. Head branches in forks are
+	// prefixed with the owner of the fork and a colon.
+	Base string `yaml:"base"`
+	Head string `yaml:"head"`
+
+	Files    []SyntheticFile    `yaml:"files"`
+	Commits  []SyntheticCommit  `yaml:"commits"`
+	Comments []SyntheticComment `yaml:"comments"`
+	Reviews  []SyntheticReview  `yaml:"reviews"`
+
+	// BaseFiles maps paths to the content of files on the base branch, like
+	// CODEOWNERS
+	BaseFiles map[string]string `yaml:"base_files"`
+
+	// Teams, Organizations, and Groups map names to their members.
+	// Permissions maps users to their permission on the repository, like
+	// "admin" or "write".
+	Teams         map[string][]string `yaml:"teams"`
+	Organizations map[string][]string `yaml:"organizations"`
+	Groups        map[string][]string `yaml:"groups"`
+	Permissions   map[string]string   `yaml:"permissions"`
+
+	// SigningKeys are the users with verified commit signing keys
+	SigningKeys []string `yaml:"signing_keys"`
+
+	// Upstream is the pull request this pull request is stacked on, if any
+	Upstream *SyntheticUpstream `yaml:"upstream"`
+
+	// LinkedIssues maps issues referenced by the pull request, as
+	// "owner/repo#number", to their comments and reviews
+	LinkedIssues map[string]SyntheticLinkedIssue `yaml:"linked_issues"`
+}
+
+type SyntheticLinkedIssue struct {
+	Body     string             `yaml:"body"`
+	Comments []SyntheticComment `yaml:"comments"`
+	Reviews  []SyntheticReview  `yaml:"reviews"`
+}
+
+type SyntheticUpstream struct {
+	Number  int    `yaml:"number"`
+	HeadSHA string `yaml:"head_sha"`
+	Base    string `yaml:"base"`
+	Merged  bool   `yaml:"merged"`
+}
+
+type SyntheticFile struct {
+	Filename  string `yaml:"filename"`
+	Status    string `yaml:"status"`
+	Additions int    `yaml:"additions"`
+	Deletions int    `yaml:"deletions"`
+
+	// Content is the content of the file at the head commit
+	Content string `yaml:"content"`
+
+	// Patch is the unified diff of the file
+	Patch string `yaml:"patch"`
+}
+
+type SyntheticCommit struct {
+	SHA       string     `yaml:"sha"`
+	Author    string     `yaml:"author"`
+	Committer string     `yaml:"committer"`
+	PushedAt  *time.Time `yaml:"pushed_at"`
+
+	// ViaWeb and Message describe commits made in the GitHub web interface,
+	// like applied review suggestions
+	ViaWeb  bool   `yaml:"via_web"`
+	Message string `yaml:"message"`
+
+	// Signed commits have a valid GPG signature by the committer, or by the
+	// author if there is no committer
+	Signed bool `yaml:"signed"`
+}
+
+type SyntheticComment struct {
+	Author    string    `yaml:"author"`
+	Body      string    `yaml:"body"`
+	CreatedAt time.Time `yaml:"created_at"`
+}
+
+type SyntheticReview struct {
+	Author    string    `yaml:"author"`
+	State     string    `yaml:"state"`
+	Body      string    `yaml:"body"`
+	CreatedAt time.Time `yaml:"created_at"`
+}
+
+// ParseSynthetic parses the YAML description of a synthetic pull request and
+// fills in defaults.
+func ParseSynthetic(b []byte) (*Synthetic, error) {
+	var s Synthetic
+	if err := yaml.UnmarshalStrict(b, &s); err != nil {
+		return nil, errors.Wrap(err, "failed to parse synthetic pull request")
+	}
+	if err := s.FillDefaults(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// FillDefaults validates the synthetic pull request and sets defaults for
+// omitted values: the pull request was opened an hour ago with a single
+// commit by the author, and comments and reviews were created now.
+func (s *Synthetic) FillDefaults() error {
+	if s.Author == "" {
+		return errors.New("synthetic pull request must have an author")
+	}
+
+	now := time.Now()
+	if s.Owner == "" {
+		s.Owner = "example"
+	}
+	if s.Repo == "" {
+		s.Repo = "example"
+	}
+	if s.Number == 0 {
+		s.Number = 1
+	}
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now.Add(-time.Hour)
+	}
+	if s.Base == "" {
+		s.Base = "master"
+	}
+	if s.Head == "" {
+		s.Head = "feature"
+	}
+
+	if len(s.Commits) == 0 {
+		s.Commits = []SyntheticCommit{{Author: s.Author}}
+	}
+	for i := range s.Commits {
+		c := &s.Commits[i]
+		if c.SHA == "" {
+			c.SHA = fmt.Sprintf("%040x", i+1)
+		}
+		if c.PushedAt == nil {
+			pushedAt := s.CreatedAt
+			c.PushedAt = &pushedAt
+		}
+	}
+
+	if u := s.Upstream; u != nil {
+		if u.Number == 0 {
+			return errors.New("synthetic upstream pull request must have a number")
+		}
+		if u.Base == "" {
+			u.Base = "master"
+		}
+	}
+
+	for _, issue := range s.LinkedIssues {
+		for i := range issue.Comments {
+			if issue.Comments[i].CreatedAt.IsZero() {
+				issue.Comments[i].CreatedAt = now
+			}
+		}
+		for i := range issue.Reviews {
+			if issue.Reviews[i].CreatedAt.IsZero() {
+				issue.Reviews[i].CreatedAt = now
+			}
+			if issue.Reviews[i].State == "" {
+				issue.Reviews[i].State = string(ReviewApproved)
+			}
+		}
+	}
+
+	for i := range s.Files {
+		if _, err := syntheticFileStatus(s.Files[i].Status); err != nil {
+			return err
+		}
+	}
+	for i := range s.Comments {
+		if s.Comments[i].CreatedAt.IsZero() {
+			s.Comments[i].CreatedAt = now
+		}
+	}
+	for i := range s.Reviews {
+		r := &s.Reviews[i]
+		if r.CreatedAt.IsZero() {
+			r.CreatedAt = now
+		}
+		if r.State == "" {
+			r.State = string(ReviewApproved)
+		}
+		switch ReviewState(r.State) {
+		case ReviewApproved, ReviewChangesRequested, ReviewCommented, ReviewDismissed, ReviewPending:
+		default:
+			return errors.Errorf("invalid review state %q", r.State)
+		}
+	}
+	return nil
+}
+
+func syntheticFileStatus(status string) (FileStatus, error) {
+	switch status {
+	case "", "modified":
+		return FileModified, nil
+	case "added":
+		return FileAdded, nil
+	case "deleted":
+		return FileDeleted, nil
+	}
+	return FileModified, errors.Errorf("invalid file status %q", status)
+}
+
+// Context returns a Context for the synthetic pull request. The head commit
+// is the last commit.
+func (s *Synthetic) Context() Context {
+	return &syntheticContext{s: s}
+}
+
+type syntheticContext struct {
+	s *Synthetic
+}
+
+func (c *syntheticContext) RepositoryOwner() string { return c.s.Owner }
+func (c *syntheticContext) RepositoryName() string  { return c.s.Repo }
+func (c *syntheticContext) Number() int             { return c.s.Number }
+func (c *syntheticContext) Author() string          { return CanonicalLogin(c.s.Author) }
+func (c *syntheticContext) Title() string           { return c.s.Title }
+func (c *syntheticContext) Body() string            { return c.s.Body }
+func (c *syntheticContext) Labels() []string        { return c.s.Labels }
+func (c *syntheticContext) IsDraft() (bool, error)  { return c.s.Draft, nil }
+func (c *syntheticContext) CreatedAt() time.Time    { return c.s.CreatedAt }
+
+func (c *syntheticContext) AuthorPermission() (string, error) {
+	for u, perm := range c.s.Permissions {
+		if CanonicalLogin(u) == CanonicalLogin(c.s.Author) {
+			return perm, nil
+		}
+	}
+	return "none", nil
+}
+
+func (c *syntheticContext) HeadSHA() string {
+	return c.s.Commits[len(c.s.Commits)-1].SHA
+}
+
+func (c *syntheticContext) Branches() (string, string) {
+	return c.s.Base, c.s.Head
+}
+
+func (c *syntheticContext) ChangedFiles() ([]*File, error) {
+	files := make([]*File, 0, len(c.s.Files))
+	for _, f := range c.s.Files {
+		status, _ := syntheticFileStatus(f.Status)
+		files = append(files, &File{
+			Filename:  f.Filename,
+			Status:    status,
+			Additions: f.Additions,
+			Deletions: f.Deletions,
+			Patch:     f.Patch,
+		})
+	}
+	return files, nil
+}
+
+func (c *syntheticContext) FileContent(path string) ([]byte, error) {
+	for _, f := range c.s.Files {
+		if f.Filename != path {
+			continue
+		}
+		if status, _ := syntheticFileStatus(f.Status); status == FileDeleted {
+			return nil, nil
+		}
+		return []byte(f.Content), nil
+	}
+	return nil, nil
+}
+
+func (c *syntheticContext) BaseFileContent(path string) ([]byte, error) {
+	if content, ok := c.s.BaseFiles[path]; ok {
+		return []byte(content), nil
+	}
+	return nil, nil
+}
+
+func (c *syntheticContext) Commits() ([]*Commit, error) {
+	commits := make([]*Commit, 0, len(c.s.Commits))
+	for i, sc := range c.s.Commits {
+		commit := &Commit{
+			SHA:         sc.SHA,
+			Author:      CanonicalLogin(sc.Author),
+			Committer:   CanonicalLogin(sc.Committer),
+			PushedAt:    sc.PushedAt,
+			CommittedAt: *sc.PushedAt,
+
+			CommittedViaWeb: sc.ViaWeb,
+			MessageHeadline: strings.SplitN(sc.Message, "\n", 2)[0],
+		}
+		if i > 0 {
+			commit.Parents = []string{c.s.Commits[i-1].SHA}
+		}
+		if sc.Signed {
+			signer := commit.Committer
+			if signer == "" {
+				signer = commit.Author
+			}
+			commit.Signature = &Signature{Type: "GPG", Valid: true, State: "VALID", Signer: signer}
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
+func (c *syntheticContext) WalkCommits(fn func(chunk []*Commit) (bool, error)) error {
+	commits, err := c.Commits()
+	if err != nil {
+		return err
+	}
+	_, err = fn(commits)
+	return err
+}
+
+func (c *syntheticContext) CommitsWithPushedDates() ([]*Commit, error) {
+	return c.Commits()
+}
+
+func (c *syntheticContext) Comments() ([]*Comment, error) {
+	comments := make([]*Comment, 0, len(c.s.Comments))
+	for _, sc := range c.s.Comments {
+		comments = append(comments, &Comment{
+			CreatedAt: sc.CreatedAt,
+			Author:    CanonicalLogin(sc.Author),
+			Body:      sc.Body,
+		})
+	}
+	return comments, nil
+}
+
+func (c *syntheticContext) Reviews() ([]*Review, error) {
+	reviews := make([]*Review, 0, len(c.s.Reviews))
+	for i, sr := range c.s.Reviews {
+		reviews = append(reviews, &Review{
+			CreatedAt: sr.CreatedAt,
+			Author:    CanonicalLogin(sr.Author),
+			State:     ReviewState(sr.State),
+			Body:      sr.Body,
+			ID:        fmt.Sprintf("synthetic-review-%d", i+1),
+			CommitSHA: c.HeadSHA(),
+		})
+	}
+	return reviews, nil
+}
+
+func (c *syntheticContext) Upstream() (*Upstream, error) {
+	if c.s.Upstream == nil {
+		return nil, nil
+	}
+	u := Upstream(*c.s.Upstream)
+	return &u, nil
+}
+
+func (c *syntheticContext) LinkedIssue(owner, repo string, number int) (*LinkedIssue, error) {
+	key := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+	issue := &LinkedIssue{}
+	for k, si := range c.s.LinkedIssues {
+		if !strings.EqualFold(k, key) {
+			continue
+		}
+		issue.Body = si.Body
+		for _, sc := range si.Comments {
+			issue.Comments = append(issue.Comments, &Comment{
+				CreatedAt: sc.CreatedAt,
+				Author:    CanonicalLogin(sc.Author),
+				Body:      sc.Body,
+			})
+		}
+		for _, sr := range si.Reviews {
+			issue.Reviews = append(issue.Reviews, &Review{
+				CreatedAt: sr.CreatedAt,
+				Author:    CanonicalLogin(sr.Author),
+				State:     ReviewState(sr.State),
+				Body:      sr.Body,
+			})
+		}
+	}
+	return issue, nil
+}
+
+func (c *syntheticContext) IsTeamMember(team, user string) (bool, error) {
+	return containsLogin(members(c.s.Teams, team), user), nil
+}
+
+func (c *syntheticContext) IsOrgMember(org, user string) (bool, error) {
+	return containsLogin(members(c.s.Organizations, org), user), nil
+}
+
+func (c *syntheticContext) IsCollaborator(org, repo, user, desiredPerm string) (bool, error) {
+	for u, perm := range c.s.Permissions {
+		if CanonicalLogin(u) == CanonicalLogin(user) {
+			return perm == desiredPerm, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *syntheticContext) IsGroupMember(group, user string) (bool, error) {
+	return containsLogin(members(c.s.Groups, group), user), nil
+}
+
+func (c *syntheticContext) HasVerifiedSigningKey(user string) (bool, error) {
+	return containsLogin(c.s.SigningKeys, user), nil
+}
+
+// members returns the members of a team, organization, or group. Like
+// logins, their names are case-insensitive.
+func members(m map[string][]string, name string) []string {
+	for n, users := range m {
+		if strings.EqualFold(n, name) {
+			return users
+		}
+	}
+	return nil
+}
+
+func containsLogin(users []string, user string) bool {
+	for _, u := range users {
+		if CanonicalLogin(u) == CanonicalLogin(user) {
+			return true
+		}
+	}
+	return false
+}
+
+// assert that the synthetic context implements the full interface
+var _ Context = &syntheticContext{}
@@ -0,0 +1,124 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSynthetic(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		s, err := ParseSynthetic([]byte("author: Mhaypenny\n"))
+		require.NoError(t, err)
+
+		prctx := s.Context()
+		assert.Equal(t, "mhaypenny", prctx.Author())
+		assert.Equal(t, "example", prctx.RepositoryOwner())
+
+		base, head := prctx.Branches()
+		assert.Equal(t, "master", base)
+		assert.Equal(t, "feature", head)
+
+		commits, err := prctx.Commits()
+		require.NoError(t, err)
+		require.Len(t, commits, 1)
+		assert.Equal(t, "mhaypenny", commits[0].Author)
+		assert.Equal(t, commits[0].SHA, prctx.HeadSHA())
+		require.NotNil(t, commits[0].PushedAt)
+		assert.Equal(t, s.CreatedAt, *commits[0].PushedAt)
+	})
+
+	t.Run("full", func(t *testing.T) {
+		s, err := ParseSynthetic([]byte(`
+author: mhaypenny
+base: develop
+files:
+  - filename: server/app.go
+    status: added
+    additions: 10
+commits:
+  - sha: abc
+    author: mhaypenny
+  - sha: def
+    author: ttaylorr
+reviews:
+  - author: bkeyes
+comments:
+  - author: ttaylorr
+    body: LGTM
+teams:
+  Palantir/Devtools: [BKeyes]
+organizations:
+  palantir: [bkeyes, ttaylorr]
+permissions:
+  bkeyes: admin
+`))
+		require.NoError(t, err)
+		prctx := s.Context()
+
+		assert.Equal(t, "def", prctx.HeadSHA())
+
+		commits, err := prctx.Commits()
+		require.NoError(t, err)
+		require.Len(t, commits, 2)
+		assert.Equal(t, []string{"abc"}, commits[1].Parents)
+
+		files, err := prctx.ChangedFiles()
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.Equal(t, FileAdded, files[0].Status)
+		assert.Equal(t, 10, files[0].Additions)
+
+		reviews, err := prctx.Reviews()
+		require.NoError(t, err)
+		require.Len(t, reviews, 1)
+		assert.Equal(t, ReviewApproved, reviews[0].State)
+		assert.Equal(t, "def", reviews[0].CommitSHA)
+
+		comments, err := prctx.Comments()
+		require.NoError(t, err)
+		require.Len(t, comments, 1)
+		assert.Equal(t, "LGTM", comments[0].Body)
+
+		isMember, err := prctx.IsTeamMember("palantir/devtools", "bkeyes")
+		require.NoError(t, err)
+		assert.True(t, isMember)
+
+		isMember, err = prctx.IsOrgMember("palantir", "mhaypenny")
+		require.NoError(t, err)
+		assert.False(t, isMember)
+
+		isCollaborator, err := prctx.IsCollaborator("example", "example", "BKeyes", "admin")
+		require.NoError(t, err)
+		assert.True(t, isCollaborator)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ParseSynthetic([]byte("title: no author\n"))
+		assert.Error(t, err)
+
+		_, err = ParseSynthetic([]byte("author: a\nfiles: [{filename: a, status: renamed}]\n"))
+		assert.Error(t, err)
+
+		_, err = ParseSynthetic([]byte("author: a\nreviews: [{author: b, state: lgtm}]\n"))
+		assert.Error(t, err)
+
+		_, err = ParseSynthetic([]byte("author: a\nunknown: true\n"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	// EnterpriseVersionHeader is set on API responses from GitHub Enterprise
+	// Server and contains the installed version.
+	EnterpriseVersionHeader = "X-GitHub-Enterprise-Version"
+)
+
+// GitHubVersion identifies the GitHub product that serves API requests. The
+// zero value represents github.com, which always has the latest features.
+type GitHubVersion struct {
+	Enterprise bool
+	Major      int
+	Minor      int
+	Patch      int
+}
+
+// ParseEnterpriseVersion parses a GitHub Enterprise Server version string,
+// like "3.2.1".
+func ParseEnterpriseVersion(s string) (GitHubVersion, error) {
+	v := GitHubVersion{Enterprise: true}
+
+	parts := strings.SplitN(strings.TrimSpace(s), ".", 3)
+	fields := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		// ignore pre-release and build suffixes, like "3.2.0.rc1"
+		if j := strings.IndexFunc(p, func(r rune) bool { return r < '0' || r > '9' }); j >= 0 {
+			p = p[:j]
+		}
+
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return GitHubVersion{}, errors.Errorf("invalid GitHub Enterprise version %q", s)
+		}
+		*fields[i] = n
+	}
+	return v, nil
+}
+
+// AtLeast returns true if this version is equal to or newer than the given
+// GitHub Enterprise Server version. It is always true for github.com.
+func (v GitHubVersion) AtLeast(major, minor int) bool {
+	if !v.Enterprise {
+		return true
+	}
+	if v.Major != major {
+		return v.Major > major
+	}
+	return v.Minor >= minor
+}
+
+func (v GitHubVersion) String() string {
+	if !v.Enterprise {
+		return "github.com"
+	}
+	return fmt.Sprintf("GitHub Enterprise Server %d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// DetectGitHubVersion determines the version of GitHub that serves requests
+// for the client.
+func DetectGitHubVersion(ctx context.Context, client *github.Client) (GitHubVersion, error) {
+	req, err := client.NewRequest("GET", "meta", nil)
+	if err != nil {
+		return GitHubVersion{}, errors.Wrap(err, "failed to create request")
+	}
+
+	var meta struct {
+		InstalledVersion string `json:"installed_version"`
+	}
+
+	res, err := client.Do(ctx, req, &meta)
+	if err != nil {
+		return GitHubVersion{}, errors.Wrap(err, "failed to get GitHub metadata")
+	}
+
+	version := meta.InstalledVersion
+	if version == "" {
+		version = res.Header.Get(EnterpriseVersionHeader)
+	}
+	if version == "" {
+		return GitHubVersion{}, nil
+	}
+	return ParseEnterpriseVersion(version)
+}
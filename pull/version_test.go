@@ -0,0 +1,51 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnterpriseVersion(t *testing.T) {
+	v, err := ParseEnterpriseVersion("3.2.1")
+	require.NoError(t, err)
+	assert.Equal(t, GitHubVersion{Enterprise: true, Major: 3, Minor: 2, Patch: 1}, v)
+
+	v, err = ParseEnterpriseVersion("3.4")
+	require.NoError(t, err)
+	assert.Equal(t, GitHubVersion{Enterprise: true, Major: 3, Minor: 4}, v)
+
+	v, err = ParseEnterpriseVersion("3.5.0.rc1")
+	require.NoError(t, err)
+	assert.Equal(t, GitHubVersion{Enterprise: true, Major: 3, Minor: 5}, v)
+
+	_, err = ParseEnterpriseVersion("enterprise")
+	assert.Error(t, err)
+}
+
+func TestGitHubVersionAtLeast(t *testing.T) {
+	dotcom := GitHubVersion{}
+	assert.True(t, dotcom.AtLeast(99, 0), "github.com should support all versions")
+
+	ghes := GitHubVersion{Enterprise: true, Major: 3, Minor: 2}
+	assert.True(t, ghes.AtLeast(2, 22))
+	assert.True(t, ghes.AtLeast(3, 0))
+	assert.True(t, ghes.AtLeast(3, 2))
+	assert.False(t, ghes.AtLeast(3, 3))
+	assert.False(t, ghes.AtLeast(4, 0))
+}
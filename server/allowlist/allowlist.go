@@ -0,0 +1,273 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package allowlist rejects webhook deliveries that do not come from the IP
+// ranges that GitHub publishes in its meta API. The ranges are fetched again
+// periodically so that changes to them do not require a restart.
+package allowlist
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultRefreshInterval = time.Hour
+	DefaultTimeout         = 10 * time.Second
+)
+
+type Config struct {
+	// Enabled rejects webhook deliveries from addresses outside of the
+	// "hooks" ranges of the GitHub meta API, in addition to validating their
+	// signatures.
+	Enabled bool `yaml:"enabled"`
+
+	// RefreshInterval is how often the ranges are fetched again. Set a
+	// negative value to disable refreshing.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	// Timeout is the maximum time for each request to the meta API
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Ranges are additional CIDR ranges that are always allowed. GitHub
+	// Enterprise Server does not publish webhook ranges, so deployments that
+	// use it must list the addresses of their instances here and set
+	// DisableMeta.
+	Ranges []string `yaml:"ranges"`
+
+	// DisableMeta disables fetching ranges from the meta API, so that only
+	// Ranges are allowed.
+	DisableMeta bool `yaml:"disable_meta"`
+
+	// TrustedProxies are CIDR ranges of load balancers and proxies in front
+	// of the server. For requests from these addresses, the source address is
+	// read from the X-Forwarded-For header.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// Allowlist tracks the allowed ranges and checks the source of requests.
+type Allowlist struct {
+	config  Config
+	metaURL []string
+	client  *http.Client
+	logger  zerolog.Logger
+
+	static  []*net.IPNet
+	proxies []*net.IPNet
+
+	mu     sync.RWMutex
+	ranges []*net.IPNet
+}
+
+// New creates an allowlist that fetches ranges from the meta API of each
+// GitHub v3 API URL. Call Refresh to load the ranges before using the
+// allowlist.
+func New(c Config, logger zerolog.Logger, v3URLs ...string) (*Allowlist, error) {
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = DefaultRefreshInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+
+	static, err := parseRanges(c.Ranges)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid allowed range")
+	}
+	proxies, err := parseRanges(c.TrustedProxies)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid trusted proxy")
+	}
+
+	a := &Allowlist{
+		config:  c,
+		client:  &http.Client{Timeout: c.Timeout},
+		logger:  logger,
+		static:  static,
+		proxies: proxies,
+	}
+
+	if !c.DisableMeta {
+		seen := make(map[string]bool)
+		for _, u := range v3URLs {
+			u = strings.TrimSuffix(u, "/") + "/meta"
+			if !seen[u] {
+				seen[u] = true
+				a.metaURL = append(a.metaURL, u)
+			}
+		}
+	}
+	if len(a.metaURL) == 0 && len(static) == 0 {
+		return nil, errors.New("the webhook allowlist has no ranges: set ranges or enable the meta API")
+	}
+	return a, nil
+}
+
+// Refresh fetches the ranges from the meta API. If a request fails, the
+// previous ranges are kept.
+func (a *Allowlist) Refresh(ctx context.Context) error {
+	var ranges []*net.IPNet
+	for _, u := range a.metaURL {
+		r, err := a.fetch(ctx, u)
+		if err != nil {
+			return err
+		}
+		ranges = append(ranges, r...)
+	}
+
+	a.mu.Lock()
+	a.ranges = ranges
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *Allowlist) fetch(ctx context.Context, u string) ([]*net.IPNet, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create meta request")
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	res, err := a.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %s", u)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to fetch %s: %s", u, res.Status)
+	}
+
+	var meta struct {
+		Hooks []string `json:"hooks"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&meta); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s", u)
+	}
+	if len(meta.Hooks) == 0 {
+		return nil, errors.Errorf("%s does not list webhook ranges", u)
+	}
+
+	ranges, err := parseRanges(meta.Hooks)
+	return ranges, errors.WithMessage(err, "invalid range in "+u)
+}
+
+// Start refreshes the ranges in the background until the context is done.
+func (a *Allowlist) Start(ctx context.Context) {
+	if a.config.RefreshInterval < 0 || len(a.metaURL) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(a.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := a.Refresh(ctx); err != nil {
+					a.logger.Error().Err(err).Msg("Failed to refresh webhook allowlist; keeping previous ranges")
+				}
+			}
+		}
+	}()
+}
+
+// Allows returns true if an address is in an allowed range.
+func (a *Allowlist) Allows(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if contains(a.static, ip) {
+		return true
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return contains(a.ranges, ip)
+}
+
+// Middleware rejects requests whose source address is not allowed.
+func (a *Allowlist) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := a.sourceIP(r)
+		if !a.Allows(ip) {
+			zerolog.Ctx(r.Context()).Warn().Str("remote_addr", r.RemoteAddr).Msgf("Rejected webhook from %s, which is not in the allowlist", ip)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sourceIP returns the address that sent a request. If the request comes
+// from a trusted proxy, this is the last address in X-Forwarded-For that is
+// not a trusted proxy.
+func (a *Allowlist) sourceIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !contains(a.proxies, ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip = net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil || !contains(a.proxies, ip) {
+			return ip
+		}
+	}
+	return nil
+}
+
+func parseRanges(values []string) ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid range %q", v)
+		}
+		ranges = append(ranges, n)
+	}
+	return ranges, nil
+}
+
+func contains(ranges []*net.IPNet, ip net.IP) bool {
+	for _, n := range ranges {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gregjones/httpcache"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/audit"
+	"github.com/palantir/policy-bot/server/errorreport"
+	"github.com/palantir/policy-bot/server/evalcache"
+	"github.com/palantir/policy-bot/server/githubclient"
+	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/palantir/policy-bot/server/incomplete"
+	"github.com/palantir/policy-bot/server/lock"
+	"github.com/palantir/policy-bot/server/membership"
+	"github.com/palantir/policy-bot/server/messages"
+	"github.com/palantir/policy-bot/server/notify"
+	"github.com/palantir/policy-bot/server/ratelimit"
+	"github.com/palantir/policy-bot/server/results"
+	"github.com/palantir/policy-bot/server/secrets"
+	"github.com/palantir/policy-bot/server/tracing"
+	"github.com/palantir/policy-bot/version"
+)
+
+// app contains the components that are specific to one GitHub App.
+type app struct {
+	*handler.App
+
+	config        AppConfig
+	logger        zerolog.Logger
+	tokens        *githubclient.TokenCache
+	reconciler    *handler.Reconciler
+	eventHandlers []githubapp.EventHandler
+}
+
+// sharedResources contains the components that all apps share.
+type sharedResources struct {
+	base      *baseapp.Server
+	logger    zerolog.Logger
+	locker    lock.Locker
+	sequencer lock.Sequencer
+	audit     audit.Sink
+	publisher audit.Sink
+
+	incomplete incomplete.Store
+	history    history.Store
+	messages   *messages.Catalog
+	compliance handler.ComplianceRecorder
+
+	metrics  *handler.Metrics
+	notifier *notify.Notifier
+	groups   *membership.Providers
+	secrets  *secrets.Manager
+	errors   errorreport.Reporter
+	results  results.Store
+	outcomes evalcache.Cache
+
+	// pendingRules remembers the pending rules of each pull request
+	pendingRules notify.StateStore
+
+	// responses caches GitHub API responses for all clients
+	responses httpcache.Cache
+
+	rateLimits *ratelimit.Tracker
+}
+
+func newApp(c *Config, ac AppConfig, shared sharedResources) (*app, error) {
+	base, logger := shared.base, shared.logger
+	if ac.Name != "" {
+		logger = logger.With().Str(LogKeyGitHubApp, ac.Name).Logger()
+	}
+
+	userAgent := fmt.Sprintf("%s/%s", c.Options.AppName, version.GetVersion())
+	newDefaultCC := func(privateKey string) (githubapp.ClientCreator, error) {
+		gh := ac.Github
+		gh.App.PrivateKey = privateKey
+		return githubapp.NewDefaultCachingClientCreator(
+			gh,
+			githubapp.WithClientUserAgent(userAgent),
+			githubapp.WithClientMiddleware(
+				githubapp.ClientLogging(zerolog.DebugLevel),
+				githubapp.ClientMetrics(base.Registry()),
+				githubclient.FailureMetrics(base.Registry()),
+				tracing.Transport,
+				githubclient.Timeout(c.Timeouts.GitHubRequest),
+				shared.rateLimits.Middleware(ac.Name),
+				githubclient.CacheResponses(shared.responses),
+			),
+		)
+	}
+
+	// the private key may come from a secret manager, in which case the
+	// client creator is replaced when the key changes
+	var defaultCC *githubclient.RotatingClientCreator
+	err := shared.secrets.Watch(context.Background(), ac.Github.App.PrivateKey, func(privateKey string) error {
+		delegate, err := newDefaultCC(privateKey)
+		if err != nil {
+			return err
+		}
+		if defaultCC == nil {
+			defaultCC = githubclient.NewRotatingClientCreator(delegate)
+		} else {
+			defaultCC.Set(delegate)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize client creator")
+	}
+
+	cc, err := githubclient.NewClientCreator(defaultCC, ac.Github.V3APIURL, ac.GHE.UploadURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize client creator")
+	}
+	if !c.InstallationTokens.Disabled {
+		cc.Tokens = githubclient.NewTokenCache(c.InstallationTokens, defaultCC.NewAppClient)
+	}
+	cc.RepositoryScoped = c.InstallationTokens.RepositoryScoped
+
+	appClient, err := cc.NewAppClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Github app client")
+	}
+
+	githubVersion, err := pull.DetectGitHubVersion(context.Background(), appClient)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to detect GitHub version, assuming github.com")
+	}
+	logger.Info().Msgf("Using %s", githubVersion)
+	if !githubVersion.AtLeast(MinEnterpriseMajorVersion, MinEnterpriseMinorVersion) {
+		logger.Warn().Msgf("GitHub Enterprise Server versions before %d.%d are not supported", MinEnterpriseMajorVersion, MinEnterpriseMinorVersion)
+	}
+
+	basePolicyHandler := &handler.Base{
+		ClientCreator: cc,
+		BaseConfig:    &c.Server,
+		Installations: githubapp.NewInstallationsService(appClient),
+		Locker:        shared.locker,
+		Sequencer:     shared.sequencer,
+		Audit:         shared.audit,
+		Publisher:     shared.publisher,
+		Metrics:       shared.metrics,
+		Notifier:      shared.notifier,
+		Groups:        shared.groups,
+		Errors:        shared.errors,
+		Results:       shared.results,
+		History:       shared.history,
+		Outcomes:      shared.outcomes,
+		PendingRules:  shared.pendingRules,
+		Compliance:    shared.compliance,
+		Messages:      shared.messages,
+
+		EvaluationTimeout: c.Timeouts.Evaluation,
+
+		App:        ac.Name,
+		Incomplete: shared.incomplete,
+
+		PullOpts: &c.Options,
+		ConfigFetcher: &handler.ConfigFetcher{
+			Options: &c.Options,
+		},
+	}
+	if cc.RepositoryScoped {
+		// evaluation clients cannot read policies in other repositories
+		basePolicyHandler.ConfigFetcher.RemoteClient = basePolicyHandler.NewRemoteConfigClient
+	}
+
+	queue := handler.NewEvaluationQueue(basePolicyHandler, logger, c.Queue)
+	basePolicyHandler.Queue = queue
+	handler.RegisterQueueMetrics(base.Registry(), ac.Name, queue)
+	reconciler := &handler.Reconciler{
+		Base:   *basePolicyHandler,
+		Queue:  queue,
+		Config: c.Reconcile,
+	}
+
+	return &app{
+		App: &handler.App{
+			Name:  ac.Name,
+			Base:  basePolicyHandler,
+			Queue: queue,
+		},
+		config:     ac,
+		logger:     logger,
+		tokens:     cc.Tokens,
+		reconciler: reconciler,
+		eventHandlers: []githubapp.EventHandler{
+			&handler.PullRequest{Base: *basePolicyHandler},
+			&handler.PullRequestReview{Base: *basePolicyHandler},
+			&handler.IssueComment{Base: *basePolicyHandler},
+			&handler.Status{Base: *basePolicyHandler},
+			&handler.MergeGroup{Base: *basePolicyHandler},
+			&handler.CheckRun{Base: *basePolicyHandler},
+			&handler.CheckSuite{Base: *basePolicyHandler},
+			&handler.Installation{Base: *basePolicyHandler, Reconciler: reconciler},
+		},
+	}, nil
+}
+
+// readinessChecks returns checks that verify the GitHub API is reachable and
+// that the app can authenticate.
+func (a *app) readinessChecks() []handler.ReadinessCheck {
+	suffix := ""
+	if a.Name != "" {
+		suffix = ":" + a.Name
+	}
+
+	return []handler.ReadinessCheck{
+		{
+			Name: "github" + suffix,
+			Check: func(ctx context.Context) error {
+				client, err := a.Base.NewAppClient()
+				if err != nil {
+					return err
+				}
+				_, _, err = client.APIMeta(ctx)
+				return errors.Wrap(err, "failed to reach GitHub API")
+			},
+		},
+		{
+			Name: "github_app_auth" + suffix,
+			Check: func(ctx context.Context) error {
+				client, err := a.Base.NewAppClient()
+				if err != nil {
+					return err
+				}
+				_, _, err = client.Apps.Get(ctx, "")
+				return errors.Wrap(err, "failed to authenticate as GitHub App")
+			},
+		},
+	}
+}
+
+// loginApps returns the apps that use the same GitHub instance as the primary
+// app, which is used to authenticate users.
+func loginApps(apps []*app) []*handler.App {
+	var login []*handler.App
+	for _, a := range apps {
+		if a.config.Github.WebURL == apps[0].config.Github.WebURL {
+			login = append(login, a.App)
+		}
+	}
+	return login
+}
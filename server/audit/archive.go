@@ -0,0 +1,302 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/server/sigv4"
+)
+
+const (
+	DefaultArchivePartition     = "{year}/{month}/{day}"
+	DefaultArchiveBatchSize     = 1000
+	DefaultArchiveFlushInterval = 5 * time.Minute
+
+	// maxBufferedBatches limits how many batches are kept in memory while
+	// uploads are failing
+	maxBufferedBatches = 10
+)
+
+type ArchiveConfig struct {
+	// Provider is the object storage service: "s3" or "gcs". Google Cloud
+	// Storage is accessed with its S3-compatible XML API and HMAC keys.
+	Provider string `yaml:"provider"`
+
+	Bucket   string `yaml:"bucket"`
+	Region   string `yaml:"region"`
+	Endpoint string `yaml:"endpoint"`
+
+	// AccessKeyID and SecretAccessKey are the credentials used to upload
+	// objects. If unset, the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and
+	// AWS_SESSION_TOKEN environment variables are used.
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+
+	// Prefix is prepended to all object keys
+	Prefix string `yaml:"prefix"`
+
+	// Partition is the template for the path between the prefix and the
+	// object name. It may contain the {year}, {month}, {day}, {hour},
+	// {owner}, and {repo} placeholders, which are replaced using the time
+	// and repository of each record.
+	Partition string `yaml:"partition"`
+
+	// BatchSize is the number of records that triggers an upload
+	BatchSize int `yaml:"batch_size"`
+
+	// FlushInterval is the maximum time records are buffered before they are
+	// uploaded
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+func (c *ArchiveConfig) FillDefaults() {
+	if c.Provider == "" {
+		c.Provider = ProviderS3
+	}
+	if c.Partition == "" {
+		c.Partition = DefaultArchivePartition
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultArchiveBatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultArchiveFlushInterval
+	}
+}
+
+// Archiver is a Sink that buffers records and uploads them in batches to
+// object storage as gzip-compressed JSON lines files.
+type Archiver struct {
+	Store  ObjectStore
+	Config ArchiveConfig
+	Logger zerolog.Logger
+
+	flush chan struct{}
+
+	mu      sync.Mutex
+	records []*Record
+
+	uploadMu sync.Mutex
+}
+
+// NewArchiver returns an Archiver for the configuration. Callers must call
+// Start to upload records in the background and Flush before stopping.
+func NewArchiver(c ArchiveConfig, logger zerolog.Logger) (*Archiver, error) {
+	c.FillDefaults()
+
+	var store ObjectStore
+	switch c.Provider {
+	case ProviderS3, ProviderGCS:
+		s, err := NewS3Store(c)
+		if err != nil {
+			return nil, err
+		}
+		store = s
+	default:
+		return nil, errors.Errorf("unknown audit archive provider %q", c.Provider)
+	}
+
+	return &Archiver{
+		Store:  store,
+		Config: c,
+		Logger: logger,
+		flush:  make(chan struct{}, 1),
+	}, nil
+}
+
+func (a *Archiver) Write(ctx context.Context, r *Record) error {
+	a.mu.Lock()
+	a.records = append(a.records, r)
+	full := len(a.records) >= a.Config.BatchSize
+	a.mu.Unlock()
+
+	if full {
+		select {
+		case a.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Start uploads buffered records in the background until the context is
+// canceled.
+func (a *Archiver) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(a.Config.FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-a.flush:
+			case <-ctx.Done():
+				return
+			}
+			if err := a.Flush(ctx); err != nil {
+				a.Logger.Error().Err(err).Msg("Failed to archive audit records")
+			}
+		}
+	}()
+}
+
+// Flush uploads all buffered records. Records that fail to upload are kept
+// and retried by the next flush.
+func (a *Archiver) Flush(ctx context.Context) error {
+	a.uploadMu.Lock()
+	defer a.uploadMu.Unlock()
+
+	a.mu.Lock()
+	records := a.records
+	a.records = nil
+	a.mu.Unlock()
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	partitions := make(map[string][]*Record)
+	var order []string
+	for _, r := range records {
+		p := a.partition(r)
+		if _, ok := partitions[p]; !ok {
+			order = append(order, p)
+		}
+		partitions[p] = append(partitions[p], r)
+	}
+
+	var failed []*Record
+	var uploadErr error
+	for _, p := range order {
+		if err := a.upload(ctx, p, partitions[p]); err != nil {
+			failed = append(failed, partitions[p]...)
+			uploadErr = err
+		}
+	}
+
+	if len(failed) > 0 {
+		a.requeue(failed)
+	}
+	return uploadErr
+}
+
+func (a *Archiver) upload(ctx context.Context, partition string, records []*Record) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return errors.Wrap(err, "failed to marshal audit record")
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return errors.Wrap(err, "failed to compress audit records")
+	}
+
+	now := time.Now().UTC()
+	key := strings.TrimPrefix(a.Config.Prefix+"/"+partition+"/"+now.Format(sigv4.DateFormat)+"-"+xid.New().String()+".jsonl.gz", "/")
+	if err := a.Store.Put(ctx, key, "application/gzip", buf.Bytes()); err != nil {
+		return err
+	}
+
+	a.Logger.Debug().Msgf("Archived %d audit records to %s", len(records), key)
+	return nil
+}
+
+// requeue returns records that failed to upload to the buffer, discarding the
+// oldest records if too many are buffered.
+func (a *Archiver) requeue(records []*Record) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.records = append(records, a.records...)
+	if max := maxBufferedBatches * a.Config.BatchSize; len(a.records) > max {
+		dropped := len(a.records) - max
+		a.records = a.records[dropped:]
+		a.Logger.Error().Msgf("Discarded %d audit records that could not be archived", dropped)
+	}
+}
+
+func (a *Archiver) partition(r *Record) string {
+	t := r.Time.UTC()
+	return strings.Trim(strings.NewReplacer(
+		"{year}", t.Format("2006"),
+		"{month}", t.Format("01"),
+		"{day}", t.Format("02"),
+		"{hour}", t.Format("15"),
+		"{owner}", pathSegment(r.Owner),
+		"{repo}", pathSegment(r.Repo),
+	).Replace(a.Config.Partition), "/")
+}
+
+// pathSegment replaces characters that are not safe in object keys.
+func pathSegment(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// MultiSink writes records to multiple sinks, returning the first error. If
+// at least one sink wrote the record, the error is a *PartialWriteError.
+type MultiSink []Sink
+
+func (m MultiSink) Write(ctx context.Context, r *Record) error {
+	var firstErr error
+	written := 0
+	for _, s := range m {
+		if err := s.Write(ctx, r); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		written++
+	}
+	if firstErr != nil && written > 0 {
+		return &PartialWriteError{Err: firstErr}
+	}
+	return firstErr
+}
+
+// PartialWriteError is returned by MultiSink when some sinks failed to write
+// a record that other sinks wrote.
+type PartialWriteError struct {
+	Err error
+}
+
+func (e *PartialWriteError) Error() string {
+	return "record was only partially written: " + e.Err.Error()
+}
+
+func (e *PartialWriteError) Cause() error {
+	return e.Err
+}
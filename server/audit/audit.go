@@ -0,0 +1,234 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit records the decision of every pull request evaluation so that
+// the reason a pull request was allowed to merge can be reconstructed later.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+const (
+	SinkLog  = "log"
+	SinkFile = "file"
+	SinkHTTP = "http"
+
+	DefaultHTTPTimeout = 10 * time.Second
+)
+
+type Config struct {
+	// Sink is where records are written: "log", "file", or "http". If empty,
+	// records are not written.
+	Sink string `yaml:"sink"`
+
+	// Path is the file that records are appended to for the "file" sink
+	Path string `yaml:"path"`
+
+	// URL is the endpoint that records are posted to for the "http" sink
+	URL string `yaml:"url"`
+
+	// Archive configures uploading records to object storage for long-term
+	// retention, in addition to the sink. If nil, records are not archived.
+	Archive *ArchiveConfig `yaml:"archive"`
+
+	// Chain configures linking records by hash so that altered or removed
+	// records can be detected.
+	Chain ChainConfig `yaml:"chain"`
+}
+
+// Record describes a single evaluation of a pull request.
+type Record struct {
+	Time time.Time `json:"time"`
+
+	Owner   string `json:"owner"`
+	Repo    string `json:"repo"`
+	Number  int    `json:"number"`
+	HeadSHA string `json:"head_sha"`
+	BaseRef string `json:"base_ref"`
+	Author  string `json:"author"`
+
+	PolicyRef  string `json:"policy_ref"`
+	PolicyPath string `json:"policy_path"`
+	PolicyHash string `json:"policy_hash,omitempty"`
+
+	State       string  `json:"state"`
+	Description string  `json:"description"`
+	Result      *Result `json:"result,omitempty"`
+	Error       string  `json:"error,omitempty"`
+
+	DurationMillis int64 `json:"duration_ms"`
+
+	// These fields are set when records are chained
+	Chain     string `json:"chain,omitempty"`
+	Sequence  uint64 `json:"sequence,omitempty"`
+	PrevHash  string `json:"prev_hash,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Result is the outcome of a policy or rule.
+type Result struct {
+	Name        string      `json:"name,omitempty"`
+	Status      string      `json:"status"`
+	Description string      `json:"description,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	Approvals   []*Approval `json:"approvals,omitempty"`
+	Children    []*Result   `json:"children,omitempty"`
+}
+
+// Approval records whether an approval counted toward a rule.
+type Approval struct {
+	User      string    `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+	Counted   bool      `json:"counted"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// NewResult converts an evaluation result to its audit form.
+func NewResult(r *common.Result) *Result {
+	if r == nil {
+		return nil
+	}
+
+	res := &Result{
+		Name:        r.Name,
+		Status:      r.Status.String(),
+		Description: r.Description,
+	}
+	if r.Error != nil {
+		res.Error = r.Error.Error()
+	}
+	for _, a := range r.Approvals {
+		res.Approvals = append(res.Approvals, &Approval{
+			User:      a.User,
+			CreatedAt: a.CreatedAt,
+			Counted:   a.Counted,
+			Reason:    a.Reason,
+		})
+	}
+	for _, c := range r.Children {
+		res.Children = append(res.Children, NewResult(c))
+	}
+	return res
+}
+
+// Sink writes audit records.
+type Sink interface {
+	Write(ctx context.Context, r *Record) error
+}
+
+// New returns the Sink for the configuration, or nil if auditing is disabled.
+func New(c Config, logger zerolog.Logger) (Sink, error) {
+	switch c.Sink {
+	case "":
+		return nil, nil
+	case SinkLog:
+		return &LogSink{Logger: logger}, nil
+	case SinkFile:
+		if c.Path == "" {
+			return nil, errors.New("the file audit sink requires a path")
+		}
+		return &FileSink{Path: c.Path}, nil
+	case SinkHTTP:
+		if c.URL == "" {
+			return nil, errors.New("the http audit sink requires a URL")
+		}
+		return &HTTPSink{URL: c.URL, Client: &http.Client{Timeout: DefaultHTTPTimeout}}, nil
+	}
+	return nil, errors.Errorf("unknown audit sink %q", c.Sink)
+}
+
+// LogSink writes records to a logger as structured JSON.
+type LogSink struct {
+	Logger zerolog.Logger
+}
+
+func (s *LogSink) Write(ctx context.Context, r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit record")
+	}
+	s.Logger.Info().Str("audit", "evaluation").RawJSON("record", b).Msg("Evaluation audit record")
+	return nil
+}
+
+// FileSink appends records to a file, one JSON object per line.
+type FileSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (s *FileSink) Write(ctx context.Context, r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit record")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open audit file")
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err, "failed to write audit record")
+	}
+	return nil
+}
+
+// HTTPSink posts each record as JSON to a URL.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *HTTPSink) Write(ctx context.Context, r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit record")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "failed to create audit request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to send audit record")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return errors.Errorf("audit endpoint returned status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/xid"
+)
+
+// ChainConfig configures hash chaining of audit records.
+type ChainConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// SigningKey is an optional base64-encoded Ed25519 private key or seed.
+	// If set, the hash of each record is signed. The value may be a secret
+	// reference.
+	SigningKey string `yaml:"signing_key"`
+
+	// StatePath is a file that stores the position of the chain so that it
+	// continues across restarts. If empty, each process starts a new chain.
+	StatePath string `yaml:"state_path"`
+}
+
+// ChainState is the position of a chain after its most recent record. When
+// read from the state file of a chain, it is a checkpoint: records that end
+// before the checkpoint were removed. If the chain is signed, Signature is the
+// signature of the most recent record.
+type ChainState struct {
+	Chain     string `json:"chain"`
+	Sequence  uint64 `json:"sequence"`
+	Hash      string `json:"hash"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// ReadChainState reads the state file of a chain. It returns nil if the file
+// does not exist.
+func ReadChainState(path string) (*ChainState, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read audit chain state")
+	}
+
+	var state ChainState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, errors.Wrap(err, "failed to parse audit chain state")
+	}
+	return &state, nil
+}
+
+// Chain is a Sink that links each record to the previous record by hash
+// before writing it to another sink. Records are written one at a time so
+// that the order in the sink matches the order of the chain.
+type Chain struct {
+	Sink Sink
+	Key  ed25519.PrivateKey
+
+	statePath string
+
+	mu    sync.Mutex
+	state ChainState
+}
+
+// NewChain creates a chain that writes to sink. If the configuration has a
+// state path that contains a previous position, the chain continues from it.
+func NewChain(c ChainConfig, key ed25519.PrivateKey, sink Sink) (*Chain, error) {
+	chain := &Chain{
+		Sink:      sink,
+		Key:       key,
+		statePath: c.StatePath,
+		state:     ChainState{Chain: xid.New().String()},
+	}
+
+	if c.StatePath != "" {
+		state, err := ReadChainState(c.StatePath)
+		if err != nil {
+			return nil, err
+		}
+		if state != nil {
+			chain.state = *state
+		}
+	}
+	return chain, nil
+}
+
+// ParseSigningKey decodes a base64-encoded Ed25519 private key or seed.
+func ParseSigningKey(s string) (ed25519.PrivateKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid audit signing key")
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(b), nil
+	}
+	return nil, errors.Errorf("invalid audit signing key: expected %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(b))
+}
+
+// ParsePublicKey decodes a base64-encoded Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid audit public key")
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, errors.Errorf("invalid audit public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(b))
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+func (c *Chain) Write(ctx context.Context, r *Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r.Chain = c.state.Chain
+	r.Sequence = c.state.Sequence + 1
+	r.PrevHash = c.state.Hash
+
+	hash, err := HashRecord(r)
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	if c.Key != nil {
+		r.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(c.Key, []byte(hash)))
+	}
+
+	// the chain only advances if the record was written, so a failed write
+	// does not leave a gap that looks like a removed record; if some sinks
+	// wrote the record, it advances so the next record is not a duplicate
+	err = c.Sink.Write(ctx, r)
+	if _, partial := err.(*PartialWriteError); err != nil && !partial {
+		return err
+	}
+
+	c.state.Sequence = r.Sequence
+	c.state.Hash = r.Hash
+	c.state.Signature = r.Signature
+	if serr := c.saveState(); serr != nil {
+		return serr
+	}
+	return err
+}
+
+func (c *Chain) saveState() error {
+	if c.statePath == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(c.state)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit chain state")
+	}
+
+	tmp := c.statePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return errors.Wrap(err, "failed to write audit chain state")
+	}
+	return errors.Wrap(os.Rename(tmp, c.statePath), "failed to write audit chain state")
+}
+
+// HashRecord returns the hex-encoded SHA-256 hash of a record. The hash
+// covers every field except the hash and signature, including the hash of
+// the previous record.
+func HashRecord(r *Record) (string, error) {
+	unsigned := *r
+	unsigned.Hash = ""
+	unsigned.Signature = ""
+
+	b, err := json.Marshal(&unsigned)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal audit record")
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verification summarizes the chains found when verifying records.
+type Verification struct {
+	Records int
+	Chains  map[string]ChainState
+}
+
+// Verify reads records, one JSON object per line, and checks that each record
+// matches its hash, links to the previous record in its chain, and, if key
+// is not nil, has a valid signature. Records from different chains may be
+// interleaved, but records within a chain must be in order. If checkpoints
+// are given, the records of each checkpoint's chain must include the
+// checkpoint, which detects removal of the newest records. Verify returns an
+// error describing the first problem it finds.
+func Verify(r io.Reader, key ed25519.PublicKey, checkpoints ...ChainState) (*Verification, error) {
+	v := &Verification{Chains: make(map[string]ChainState)}
+
+	for _, cp := range checkpoints {
+		if key != nil {
+			sig, err := base64.StdEncoding.DecodeString(cp.Signature)
+			if err != nil || !ed25519.Verify(key, []byte(cp.Hash), sig) {
+				return v, errors.Errorf("chain %s: checkpoint at record %d has an invalid signature", cp.Chain, cp.Sequence)
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return v, errors.Wrapf(err, "line %d: invalid record", line)
+		}
+		if err := verifyRecord(v, &rec, key); err != nil {
+			return v, errors.Wrapf(err, "line %d", line)
+		}
+		for _, cp := range checkpoints {
+			if cp.Chain == rec.Chain && cp.Sequence == rec.Sequence && cp.Hash != rec.Hash {
+				return v, errors.Errorf("line %d: chain %s: record %d does not match the checkpoint", line, rec.Chain, rec.Sequence)
+			}
+		}
+		v.Records++
+	}
+	if err := scanner.Err(); err != nil {
+		return v, errors.Wrap(err, "failed to read records")
+	}
+
+	for _, cp := range checkpoints {
+		last, ok := v.Chains[cp.Chain]
+		if !ok || last.Sequence < cp.Sequence {
+			return v, errors.Errorf("chain %s: records end before checkpoint record %d", cp.Chain, cp.Sequence)
+		}
+	}
+	return v, nil
+}
+
+func verifyRecord(v *Verification, r *Record, key ed25519.PublicKey) error {
+	if r.Chain == "" || r.Hash == "" {
+		return errors.New("record is not part of a chain")
+	}
+
+	hash, err := HashRecord(r)
+	if err != nil {
+		return err
+	}
+	if hash != r.Hash {
+		return errors.Errorf("chain %s: record %d does not match its hash", r.Chain, r.Sequence)
+	}
+
+	if key != nil {
+		sig, err := base64.StdEncoding.DecodeString(r.Signature)
+		if err != nil || !ed25519.Verify(key, []byte(r.Hash), sig) {
+			return errors.Errorf("chain %s: record %d has an invalid signature", r.Chain, r.Sequence)
+		}
+	}
+
+	// the first record seen for a chain may not be its first record if the
+	// input is a later segment, such as a single archive object
+	prev, ok := v.Chains[r.Chain]
+	if ok {
+		if r.Sequence != prev.Sequence+1 {
+			return errors.Errorf("chain %s: expected record %d, found record %d", r.Chain, prev.Sequence+1, r.Sequence)
+		}
+		if r.PrevHash != prev.Hash {
+			return errors.Errorf("chain %s: record %d does not link to record %d", r.Chain, r.Sequence, prev.Sequence)
+		}
+	}
+
+	v.Chains[r.Chain] = ChainState{Chain: r.Chain, Sequence: r.Sequence, Hash: r.Hash}
+	return nil
+}
+
+// String describes the position of each verified chain.
+func (v *Verification) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d records in %d chains", v.Records, len(v.Chains))
+
+	ids := make([]string, 0, len(v.Chains))
+	for id := range v.Chains {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		c := v.Chains[id]
+		fmt.Fprintf(&b, "\n  %s: last record %d, hash %s", c.Chain, c.Sequence, c.Hash)
+	}
+	return b.String()
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/sigv4"
+)
+
+const (
+	ProviderS3  = "s3"
+	ProviderGCS = "gcs"
+
+	DefaultGCSEndpoint = "https://storage.googleapis.com"
+)
+
+// ObjectStore writes objects to a bucket.
+type ObjectStore interface {
+	Put(ctx context.Context, key, contentType string, body []byte) error
+}
+
+// S3Store writes objects using the S3 API, authenticating requests with AWS
+// Signature Version 4. It also works with S3-compatible services, like the
+// Google Cloud Storage XML API with HMAC keys.
+type S3Store struct {
+	Bucket string
+	Region string
+
+	// Endpoint is the base URL of the service. If empty, the regional AWS
+	// endpoint is used. Buckets on custom endpoints are addressed by path.
+	Endpoint string
+
+	Credentials sigv4.Credentials
+
+	Client *http.Client
+}
+
+// NewS3Store returns an S3Store for the archive configuration. Credentials
+// that are not set in the configuration are read from the standard AWS
+// environment variables.
+func NewS3Store(c ArchiveConfig) (*S3Store, error) {
+	s := &S3Store{
+		Bucket:   c.Bucket,
+		Region:   c.Region,
+		Endpoint: c.Endpoint,
+		Credentials: sigv4.Credentials{
+			AccessKeyID:     c.AccessKeyID,
+			SecretAccessKey: c.SecretAccessKey,
+		},
+		Client: &http.Client{Timeout: DefaultHTTPTimeout},
+	}
+
+	if c.Provider == ProviderGCS {
+		if s.Endpoint == "" {
+			s.Endpoint = DefaultGCSEndpoint
+		}
+		if s.Region == "" {
+			s.Region = "auto"
+		}
+	}
+
+	if !s.Credentials.Valid() {
+		s.Credentials = sigv4.EnvCredentials()
+	}
+
+	switch {
+	case s.Bucket == "":
+		return nil, errors.New("the audit archive requires a bucket")
+	case s.Region == "":
+		return nil, errors.New("the audit archive requires a region")
+	case !s.Credentials.Valid():
+		return nil, errors.New("the audit archive requires credentials")
+	}
+	return s, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key, contentType string, body []byte) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create archive request")
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	signer := sigv4.Signer{Credentials: s.Credentials, Region: s.Region, Service: "s3"}
+	signer.Sign(req, body, time.Now())
+
+	res, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload %s", key)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("failed to upload %s: status %d: %s", key, res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (s *S3Store) objectURL(key string) (*url.URL, error) {
+	if s.Endpoint == "" {
+		return &url.URL{
+			Scheme: "https",
+			Host:   fmt.Sprintf("%s.s3.%s.amazonaws.com", s.Bucket, s.Region),
+			Path:   "/" + key,
+		}, nil
+	}
+
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid archive endpoint")
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + key
+	return u, nil
+}
@@ -15,6 +15,9 @@
 package server
 
 import (
+	"path"
+	"time"
+
 	"github.com/c2h5oh/datasize"
 	"github.com/palantir/go-baseapp/baseapp"
 	"github.com/palantir/go-baseapp/baseapp/datadog"
@@ -22,18 +25,75 @@ import (
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 
+	"github.com/palantir/policy-bot/server/allowlist"
+	"github.com/palantir/policy-bot/server/audit"
+	"github.com/palantir/policy-bot/server/deadletter"
+	"github.com/palantir/policy-bot/server/digest"
+	"github.com/palantir/policy-bot/server/errorreport"
+	"github.com/palantir/policy-bot/server/evalcache"
+	"github.com/palantir/policy-bot/server/githubclient"
 	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/palantir/policy-bot/server/lock"
+	"github.com/palantir/policy-bot/server/membership"
+	"github.com/palantir/policy-bot/server/messages"
+	"github.com/palantir/policy-bot/server/notify"
+	"github.com/palantir/policy-bot/server/prometheus"
+	"github.com/palantir/policy-bot/server/publish"
+	"github.com/palantir/policy-bot/server/rbac"
+	"github.com/palantir/policy-bot/server/redis"
+	"github.com/palantir/policy-bot/server/report"
+	"github.com/palantir/policy-bot/server/results"
+	"github.com/palantir/policy-bot/server/secrets"
+	"github.com/palantir/policy-bot/server/tracing"
 )
 
 type Config struct {
-	Server   baseapp.HTTPConfig            `yaml:"server"`
-	Logging  LoggingConfig                 `yaml:"logging"`
-	Cache    CachingConfig                 `yaml:"cache"`
-	Github   githubapp.Config              `yaml:"github"`
-	Sessions SessionsConfig                `yaml:"sessions"`
-	Options  handler.PullEvaluationOptions `yaml:"options"`
-	Files    handler.FilesConfig           `yaml:"files"`
-	Datadog  datadog.Config                `yaml:"datadog"`
+	Server     baseapp.HTTPConfig            `yaml:"server"`
+	Logging    LoggingConfig                 `yaml:"logging"`
+	Cache      CachingConfig                 `yaml:"cache"`
+	Github     githubapp.Config              `yaml:"github"`
+	GHE        GitHubEnterpriseConfig        `yaml:"github_enterprise"`
+	Webhooks   WebhookConfig                 `yaml:"webhooks"`
+	Sessions   SessionsConfig                `yaml:"sessions"`
+	Options    handler.PullEvaluationOptions `yaml:"options"`
+	Files      handler.FilesConfig           `yaml:"files"`
+	Datadog    DatadogConfig                 `yaml:"datadog"`
+	Prometheus prometheus.Config             `yaml:"prometheus"`
+	Locking    lock.Config                   `yaml:"locking"`
+	Redis      *redis.Config                 `yaml:"redis"`
+
+	InstallationTokens githubclient.TokenCacheConfig `yaml:"installation_tokens"`
+
+	// Apps are additional GitHub Apps served by this server
+	Apps []AppConfig `yaml:"apps"`
+
+	DeadLetters deadletter.Config       `yaml:"dead_letters"`
+	Queue       handler.QueueConfig     `yaml:"queue"`
+	Reconcile   handler.ReconcileConfig `yaml:"reconcile"`
+	Admin       AdminConfig             `yaml:"admin"`
+	Shutdown    ShutdownConfig          `yaml:"shutdown"`
+	Audit       audit.Config            `yaml:"audit"`
+	Tracing     tracing.Config          `yaml:"tracing"`
+	Notify      notify.Config           `yaml:"notifications"`
+	Digest      digest.Config           `yaml:"digest"`
+	Reports     report.Config           `yaml:"reports"`
+	Publish     publish.Config          `yaml:"publish"`
+	Membership  membership.Config       `yaml:"membership"`
+	Secrets     secrets.Config          `yaml:"secrets"`
+
+	ErrorReporting  errorreport.Config `yaml:"error_reporting"`
+	GraphQL         GraphQLConfig      `yaml:"graphql"`
+	EvaluationCache evalcache.Config   `yaml:"evaluation_cache"`
+	Timeouts        TimeoutConfig      `yaml:"timeouts"`
+	History         history.Config     `yaml:"history"`
+	Dashboard       DashboardConfig    `yaml:"dashboard"`
+	Messages        messages.Config    `yaml:"messages"`
+	Playground      PlaygroundConfig   `yaml:"playground"`
+	GRPC            GRPCConfig         `yaml:"grpc"`
+
+	WebhookAllowlist allowlist.Config `yaml:"webhook_allowlist"`
+	RBAC             rbac.Config      `yaml:"rbac"`
 }
 
 type LoggingConfig struct {
@@ -42,7 +102,98 @@ type LoggingConfig struct {
 }
 
 type CachingConfig struct {
+	// MaxSize is the maximum size of GitHub API responses cached in memory
 	MaxSize datasize.ByteSize `yaml:"max_size"`
+
+	// Redis caches responses in Redis instead of memory, so that all servers
+	// sharing the Redis instance reuse them. Requires the redis option.
+	Redis bool `yaml:"redis"`
+
+	// TTL is how long responses are kept in Redis
+	TTL time.Duration `yaml:"ttl"`
+}
+
+type DatadogConfig struct {
+	datadog.Config `yaml:",inline"`
+
+	// MetricTags are the tags added to evaluation metrics: any of "org",
+	// "repo", and "rule".
+	MetricTags []string `yaml:"metric_tags"`
+}
+
+type AdminConfig struct {
+	// Tokens are the bearer tokens accepted by admin routes. If empty and
+	// RBAC is disabled, admin routes are disabled. With RBAC, these tokens
+	// have the operator role.
+	Tokens []string `yaml:"tokens"`
+}
+
+type GraphQLConfig struct {
+	// Enabled enables the GraphQL API. If false, evaluation results are not
+	// stored unless the dashboard is enabled.
+	Enabled bool `yaml:"enabled"`
+
+	// Results configures the storage of the latest evaluation of each pull
+	// request, which the API queries.
+	Results results.Config `yaml:"results"`
+}
+
+type DashboardConfig struct {
+	// Enabled enables the dashboard of blocked pull requests. The dashboard
+	// uses the stored results configured by graphql.results.
+	Enabled bool `yaml:"enabled"`
+}
+
+type PlaygroundConfig struct {
+	// Enabled enables the page that evaluates pasted policies against pull
+	// requests without posting statuses.
+	Enabled bool `yaml:"enabled"`
+}
+
+type GRPCConfig struct {
+	// Enabled serves the gRPC evaluation service on the server port. The
+	// service requires HTTP/2, so the server must use TLS, and uses the
+	// admin tokens or roles for authorization.
+	Enabled bool `yaml:"enabled"`
+}
+
+type TimeoutConfig struct {
+	// GitHubRequest is the maximum duration of a GitHub API request
+	GitHubRequest time.Duration `yaml:"github_request"`
+
+	// Evaluation is the maximum duration of an evaluation, including all
+	// GitHub requests. Evaluations that exceed it are retried once.
+	Evaluation time.Duration `yaml:"evaluation"`
+}
+
+type AppConfig struct {
+	// Name identifies the app in logs and the admin API
+	Name     string                 `yaml:"name"`
+	Github   githubapp.Config       `yaml:"github"`
+	GHE      GitHubEnterpriseConfig `yaml:"github_enterprise"`
+	Webhooks WebhookConfig          `yaml:"webhooks"`
+}
+
+type GitHubEnterpriseConfig struct {
+	// UploadURL is the base URL for v3 API upload requests. If empty, it is
+	// derived from the v3 API URL.
+	UploadURL string `yaml:"v3_upload_url"`
+}
+
+type WebhookConfig struct {
+	// AdditionalSecrets are accepted in addition to the webhook secret of
+	// the app, so that the secret can be rotated without rejecting
+	// deliveries signed with the old or new secret.
+	AdditionalSecrets []string `yaml:"additional_secrets"`
+}
+
+func (c WebhookConfig) validate() error {
+	for _, secret := range c.AdditionalSecrets {
+		if secret == "" {
+			return errors.New("additional webhook secrets must not be empty")
+		}
+	}
+	return nil
 }
 
 type SessionsConfig struct {
@@ -59,5 +210,75 @@ func ParseConfig(bytes []byte) (*Config, error) {
 
 	c.Options.FillDefaults()
 
+	for _, o := range c.Options.Overrides {
+		for _, pattern := range o.Repositories {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, errors.Wrapf(err, "invalid repository pattern %q in options override", pattern)
+			}
+		}
+	}
+
+	if err := handler.ValidateMetricTags(c.Datadog.MetricTags); err != nil {
+		return nil, errors.Wrap(err, "invalid datadog configuration")
+	}
+	if err := handler.ValidateMetricTags(c.Prometheus.MetricTags); err != nil {
+		return nil, errors.Wrap(err, "invalid prometheus configuration")
+	}
+	if c.Prometheus.Enabled && len(c.Admin.Tokens) == 0 && !c.RBAC.Enabled {
+		return nil, errors.New("invalid prometheus configuration: admin tokens or rbac are required to authenticate scrapers")
+	}
+	c.Prometheus.FillDefaults()
+
+	if err := c.Notify.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid notifications configuration")
+	}
+
+	if err := c.Membership.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid membership configuration")
+	}
+
+	if err := c.ErrorReporting.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid error reporting configuration")
+	}
+
+	if c.Github.App.WebhookSecret == "" {
+		return nil, errors.New("github.app.webhook_secret is required")
+	}
+	if err := c.Webhooks.validate(); err != nil {
+		return nil, err
+	}
+
+	if c.GRPC.Enabled {
+		if c.Server.TLSConfig == nil {
+			return nil, errors.New("the gRPC service requires server.tls_config")
+		}
+		if len(c.Admin.Tokens) == 0 && !c.RBAC.Enabled {
+			return nil, errors.New("the gRPC service requires admin tokens or rbac")
+		}
+	}
+
+	if c.Cache.Redis && c.Redis == nil {
+		return nil, errors.New("caching responses in Redis requires the redis option")
+	}
+
+	names := make(map[string]bool)
+	for _, app := range c.Apps {
+		if app.Name == "" {
+			return nil, errors.New("additional apps must have a name")
+		}
+		if names[app.Name] {
+			return nil, errors.Errorf("duplicate app name %q", app.Name)
+		}
+		names[app.Name] = true
+
+		if app.Github.App.WebhookSecret == "" {
+			return nil, errors.Errorf("app %q requires github.app.webhook_secret", app.Name)
+		}
+
+		if err := app.Webhooks.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid configuration for app %q", app.Name)
+		}
+	}
+
 	return &c, nil
 }
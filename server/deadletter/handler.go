@@ -0,0 +1,175 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deadletter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+// Handler wraps an event handler, retrying failed deliveries and adding them
+// to a queue if every attempt fails.
+type Handler struct {
+	githubapp.EventHandler
+
+	// App is the name of the GitHub App that received the deliveries
+	App string
+
+	Queue   Queue
+	Config  Config
+	Tracker *Tracker
+}
+
+// Wrap wraps each handler of an app in a Handler that uses the given queue
+// and tracker.
+func Wrap(q Queue, c Config, t *Tracker, app string, handlers ...githubapp.EventHandler) []githubapp.EventHandler {
+	c.FillDefaults()
+
+	wrapped := make([]githubapp.EventHandler, len(handlers))
+	for i, h := range handlers {
+		wrapped[i] = &Handler{EventHandler: h, App: app, Queue: q, Config: c, Tracker: t}
+	}
+	return wrapped
+}
+
+// Handle handles a delivery. If it fails, the delivery is retried in the
+// background after a delay, so the webhook response and the handler goroutine
+// do not wait for retries. Handle returns nil when a retry is scheduled and
+// the error of the last attempt when every attempt fails.
+func (h *Handler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	id := deliveryID
+	if id == "" {
+		id = xid.New().String()
+	}
+
+	d := Delivery{
+		ID:         id,
+		App:        h.App,
+		EventType:  eventType,
+		DeliveryID: deliveryID,
+		Payload:    payload,
+	}
+	if h.Tracker != nil {
+		h.Tracker.start(d)
+	}
+	return h.handle(ctx, d, 1, h.Config.RetryDelay)
+}
+
+func (h *Handler) handle(ctx context.Context, d Delivery, attempt int, delay time.Duration) error {
+	logger := zerolog.Ctx(ctx)
+
+	err := h.EventHandler.Handle(ctx, d.EventType, d.DeliveryID, d.Payload)
+	if err == nil {
+		h.done(d.ID)
+		return nil
+	}
+
+	attempts := 1
+	if h.Config.Retries > 0 {
+		attempts += h.Config.Retries
+	}
+
+	// retries run after the request ends, so they use a context that is
+	// never canceled; deliveries that are still waiting when the server
+	// stops are saved by the tracker
+	if attempt < attempts && ctx.Err() == nil {
+		logger.Warn().Err(err).Msgf("Failed to handle delivery on attempt %d, retrying in %s", attempt, delay)
+
+		retryLogger := *logger
+		time.AfterFunc(delay, func() {
+			if h.Tracker != nil && h.Tracker.stopped() {
+				return
+			}
+			_ = h.handle(retryLogger.WithContext(context.Background()), d, attempt+1, delay*2)
+		})
+		return nil
+	}
+
+	d.Error = err.Error()
+	d.Attempts = attempt
+	d.FailedAt = time.Now()
+	if qerr := h.Queue.Add(context.Background(), d); qerr != nil {
+		logger.Error().Err(qerr).Msg("Failed to add delivery to the dead letter queue")
+	} else {
+		logger.Warn().Msgf("Added delivery to the dead letter queue after %d attempts", attempt)
+	}
+	h.done(d.ID)
+	return err
+}
+
+func (h *Handler) done(id string) {
+	if h.Tracker != nil {
+		h.Tracker.done(id)
+	}
+}
+
+// Tracker records deliveries that are being processed so that they can be
+// saved if the server stops before they finish.
+type Tracker struct {
+	mu         sync.Mutex
+	deliveries map[string]Delivery
+	saved      bool
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{deliveries: make(map[string]Delivery)}
+}
+
+func (t *Tracker) start(d Delivery) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.deliveries[d.ID] = d
+}
+
+func (t *Tracker) done(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.deliveries, id)
+}
+
+// stopped returns true if the deliveries were saved, so scheduled retries
+// must not run.
+func (t *Tracker) stopped() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.saved
+}
+
+// Save adds all deliveries that are still being processed or waiting to be
+// retried to the queue and returns the number of saved deliveries. Retries
+// scheduled after Save do not run.
+func (t *Tracker) Save(ctx context.Context, q Queue, reason string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.saved = true
+
+	saved := 0
+	for _, d := range t.deliveries {
+		d.Error = reason
+		d.Attempts = 1
+		d.FailedAt = time.Now()
+		if err := q.Add(ctx, d); err != nil {
+			return saved, err
+		}
+		saved++
+	}
+	return saved, nil
+}
@@ -0,0 +1,332 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package deadletter stores webhook deliveries that could not be processed so
+// they can be inspected and replayed later.
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/redis"
+)
+
+const (
+	DefaultMaxSize    = 1000
+	DefaultRetries    = 2
+	DefaultRetryDelay = 1 * time.Second
+
+	redisKey      = "policy-bot:deadletters"
+	redisIndexKey = "policy-bot:deadletters:index"
+)
+
+type Config struct {
+	// MaxSize is the maximum number of stored deliveries. When the queue is
+	// full, the oldest delivery is discarded.
+	MaxSize int `yaml:"max_size"`
+
+	// Retries is the number of times a failed delivery is retried before it
+	// is added to the queue. Set a negative value to disable retries.
+	Retries int `yaml:"retries"`
+
+	// RetryDelay is the delay before the first retry. The delay doubles for
+	// each additional retry.
+	RetryDelay time.Duration `yaml:"retry_delay"`
+}
+
+func (c *Config) FillDefaults() {
+	if c.MaxSize <= 0 {
+		c.MaxSize = DefaultMaxSize
+	}
+	if c.Retries == 0 {
+		c.Retries = DefaultRetries
+	}
+	if c.RetryDelay == 0 {
+		c.RetryDelay = DefaultRetryDelay
+	}
+}
+
+// Delivery is a webhook delivery that failed processing.
+type Delivery struct {
+	ID         string          `json:"id"`
+	App        string          `json:"app,omitempty"`
+	EventType  string          `json:"event_type"`
+	DeliveryID string          `json:"delivery_id"`
+	Payload    json.RawMessage `json:"payload"`
+	Error      string          `json:"error"`
+	Attempts   int             `json:"attempts"`
+	FailedAt   time.Time       `json:"failed_at"`
+}
+
+// Queue stores failed deliveries.
+type Queue interface {
+	// Add stores a delivery, replacing any existing delivery with the same ID.
+	Add(ctx context.Context, d Delivery) error
+
+	// List returns all stored deliveries, oldest first.
+	List(ctx context.Context) ([]Delivery, error)
+
+	// Get returns the delivery with the given ID or nil if it does not exist.
+	Get(ctx context.Context, id string) (*Delivery, error)
+
+	// Remove deletes the delivery with the given ID, if it exists.
+	Remove(ctx context.Context, id string) error
+}
+
+// New returns a Queue for the given configuration. If client is non-nil,
+// deliveries are stored in Redis. Otherwise, they are stored in memory.
+func New(c Config, client *redis.Client) Queue {
+	c.FillDefaults()
+	if client != nil {
+		return &RedisQueue{Client: client, MaxSize: c.MaxSize}
+	}
+	return NewMemoryQueue(c.MaxSize)
+}
+
+// MemoryQueue is a Queue that stores deliveries in memory.
+type MemoryQueue struct {
+	maxSize int
+
+	mu         sync.Mutex
+	deliveries map[string]Delivery
+}
+
+func NewMemoryQueue(maxSize int) *MemoryQueue {
+	return &MemoryQueue{
+		maxSize:    maxSize,
+		deliveries: make(map[string]Delivery),
+	}
+}
+
+func (q *MemoryQueue) Add(ctx context.Context, d Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.deliveries[d.ID] = d
+	for len(q.deliveries) > q.maxSize {
+		oldest := sortDeliveries(q.deliveries)[0]
+		delete(q.deliveries, oldest.ID)
+	}
+	return nil
+}
+
+func (q *MemoryQueue) List(ctx context.Context) ([]Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return sortDeliveries(q.deliveries), nil
+}
+
+func (q *MemoryQueue) Get(ctx context.Context, id string) (*Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if d, ok := q.deliveries[id]; ok {
+		return &d, nil
+	}
+	return nil, nil
+}
+
+func (q *MemoryQueue) Remove(ctx context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.deliveries, id)
+	return nil
+}
+
+// RedisQueue is a Queue that stores deliveries in a Redis hash. A sorted set
+// of delivery IDs, scored by failure time, orders the deliveries so the oldest
+// can be discarded without reading the whole hash.
+type RedisQueue struct {
+	Client  *redis.Client
+	MaxSize int
+}
+
+func (q *RedisQueue) Add(ctx context.Context, d Delivery) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal delivery")
+	}
+	if _, err := q.Client.Do(ctx, "HSET", redisKey, d.ID, b); err != nil {
+		return errors.Wrap(err, "failed to store delivery")
+	}
+	if _, err := q.Client.Do(ctx, "ZADD", redisIndexKey, score(d), d.ID); err != nil {
+		return errors.Wrap(err, "failed to index delivery")
+	}
+
+	reply, err := q.Client.Do(ctx, "ZCARD", redisIndexKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to count deliveries")
+	}
+	if n, _ := reply.(int64); n > int64(q.MaxSize) {
+		reply, err := q.Client.Do(ctx, "ZRANGE", redisIndexKey, 0, n-int64(q.MaxSize)-1)
+		if err != nil {
+			return errors.Wrap(err, "failed to list oldest deliveries")
+		}
+		if err := q.remove(ctx, stringValues(reply)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *RedisQueue) List(ctx context.Context) ([]Delivery, error) {
+	if err := q.reindex(ctx); err != nil {
+		return nil, err
+	}
+
+	reply, err := q.Client.Do(ctx, "ZRANGE", redisIndexKey, 0, -1)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list deliveries")
+	}
+	ids := stringValues(reply)
+	if len(ids) == 0 {
+		return []Delivery{}, nil
+	}
+
+	args := []interface{}{"HMGET", redisKey}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	reply, err = q.Client.Do(ctx, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get deliveries")
+	}
+
+	values, _ := reply.([]interface{})
+	deliveries := make([]Delivery, 0, len(values))
+	for _, v := range values {
+		// deliveries removed since listing the index are nil
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var d Delivery
+		if err := json.Unmarshal([]byte(s), &d); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal delivery")
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+// reindex adds deliveries that are missing from the index, like deliveries
+// stored by servers that did not maintain it, so they are listed and trimmed.
+func (q *RedisQueue) reindex(ctx context.Context) error {
+	hlen, err := q.Client.Do(ctx, "HLEN", redisKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to count deliveries")
+	}
+	zcard, err := q.Client.Do(ctx, "ZCARD", redisIndexKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to count deliveries")
+	}
+	if hlen == zcard {
+		return nil
+	}
+
+	reply, err := q.Client.Do(ctx, "HVALS", redisKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to list deliveries")
+	}
+	args := []interface{}{"ZADD", redisIndexKey}
+	for _, v := range stringValues(reply) {
+		var d Delivery
+		if err := json.Unmarshal([]byte(v), &d); err != nil {
+			return errors.Wrap(err, "failed to unmarshal delivery")
+		}
+		args = append(args, score(d), d.ID)
+	}
+	if len(args) > 2 {
+		if _, err := q.Client.Do(ctx, args...); err != nil {
+			return errors.Wrap(err, "failed to index deliveries")
+		}
+	}
+	return nil
+}
+
+func (q *RedisQueue) Get(ctx context.Context, id string) (*Delivery, error) {
+	reply, err := q.Client.Do(ctx, "HGET", redisKey, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get delivery")
+	}
+	if reply == nil {
+		return nil, nil
+	}
+
+	var d Delivery
+	if err := json.Unmarshal([]byte(reply.(string)), &d); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal delivery")
+	}
+	return &d, nil
+}
+
+func (q *RedisQueue) Remove(ctx context.Context, id string) error {
+	return q.remove(ctx, id)
+}
+
+func (q *RedisQueue) remove(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	hargs := []interface{}{"HDEL", redisKey}
+	zargs := []interface{}{"ZREM", redisIndexKey}
+	for _, id := range ids {
+		hargs = append(hargs, id)
+		zargs = append(zargs, id)
+	}
+	if _, err := q.Client.Do(ctx, hargs...); err != nil {
+		return errors.Wrap(err, "failed to remove delivery")
+	}
+	if _, err := q.Client.Do(ctx, zargs...); err != nil {
+		return errors.Wrap(err, "failed to remove delivery from index")
+	}
+	return nil
+}
+
+// score returns the score of a delivery in the index, the failure time in
+// milliseconds, which a float64 represents exactly.
+func score(d Delivery) int64 {
+	return d.FailedAt.UnixNano() / int64(time.Millisecond)
+}
+
+func stringValues(reply interface{}) []string {
+	values, _ := reply.([]interface{})
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+func sortDeliveries(deliveries map[string]Delivery) []Delivery {
+	sorted := make([]Delivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].FailedAt.Before(sorted[j].FailedAt)
+	})
+	return sorted
+}
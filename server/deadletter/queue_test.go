@@ -0,0 +1,144 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/server/redis/redistest"
+)
+
+func TestRedisQueue(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2018, 6, 29, 12, 0, 0, 0, time.UTC)
+
+	newQueue := func(t *testing.T, maxSize int) (*RedisQueue, *redistest.Server) {
+		srv, err := redistest.NewServer()
+		require.NoError(t, err)
+		return &RedisQueue{Client: srv.Client(), MaxSize: maxSize}, srv
+	}
+
+	delivery := func(id string, failedAt time.Time) Delivery {
+		return Delivery{
+			ID:        id,
+			EventType: "pull_request",
+			Payload:   json.RawMessage(`{"number":1}`),
+			FailedAt:  failedAt,
+		}
+	}
+
+	ids := func(ds []Delivery) []string {
+		var ids []string
+		for _, d := range ds {
+			ids = append(ids, d.ID)
+		}
+		return ids
+	}
+
+	t.Run("add", func(t *testing.T) {
+		q, srv := newQueue(t, 10)
+		defer srv.Close()
+
+		list, err := q.List(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, list)
+
+		require.NoError(t, q.Add(ctx, delivery("b", now.Add(time.Minute))))
+		require.NoError(t, q.Add(ctx, delivery("a", now)))
+		require.NoError(t, q.Add(ctx, delivery("c", now.Add(2*time.Minute))))
+
+		list, err = q.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c"}, ids(list), "deliveries are not sorted oldest first")
+
+		d, err := q.Get(ctx, "b")
+		require.NoError(t, err)
+		require.NotNil(t, d, "delivery was not found")
+		assert.Equal(t, "pull_request", d.EventType)
+		assert.JSONEq(t, `{"number":1}`, string(d.Payload))
+
+		d, err = q.Get(ctx, "missing")
+		require.NoError(t, err)
+		assert.Nil(t, d, "missing delivery was found")
+	})
+
+	t.Run("trim", func(t *testing.T) {
+		q, srv := newQueue(t, 2)
+		defer srv.Close()
+
+		require.NoError(t, q.Add(ctx, delivery("a", now)))
+		require.NoError(t, q.Add(ctx, delivery("b", now.Add(time.Minute))))
+		require.NoError(t, q.Add(ctx, delivery("c", now.Add(2*time.Minute))))
+		require.NoError(t, q.Add(ctx, delivery("d", now.Add(3*time.Minute))))
+
+		assert.Equal(t, 0, srv.Calls("HVALS"), "adding a delivery read the whole hash")
+		assert.Equal(t, int64(2), srv.Do("HLEN", redisKey), "oldest deliveries were not removed")
+		assert.Equal(t, int64(2), srv.Do("ZCARD", redisIndexKey), "oldest deliveries were not removed from the index")
+
+		list, err := q.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"c", "d"}, ids(list))
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		q, srv := newQueue(t, 10)
+		defer srv.Close()
+
+		require.NoError(t, q.Add(ctx, delivery("a", now)))
+		require.NoError(t, q.Add(ctx, delivery("b", now.Add(time.Minute))))
+
+		// a failed replay adds the delivery again with a new failure time
+		d, err := q.Get(ctx, "a")
+		require.NoError(t, err)
+		d.Attempts++
+		d.FailedAt = now.Add(2 * time.Minute)
+		require.NoError(t, q.Add(ctx, *d))
+
+		list, err := q.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "a"}, ids(list), "replayed delivery did not move to the end")
+		assert.Equal(t, 1, list[1].Attempts)
+
+		// a successful replay removes the delivery
+		require.NoError(t, q.Remove(ctx, "a"))
+
+		list, err = q.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b"}, ids(list))
+		assert.Equal(t, int64(1), srv.Do("ZCARD", redisIndexKey), "delivery was not removed from the index")
+	})
+
+	t.Run("reindex", func(t *testing.T) {
+		q, srv := newQueue(t, 10)
+		defer srv.Close()
+
+		b, err := json.Marshal(delivery("unindexed", now))
+		require.NoError(t, err)
+		srv.Do("HSET", redisKey, "unindexed", string(b))
+
+		require.NoError(t, q.Add(ctx, delivery("a", now.Add(time.Minute))))
+
+		list, err := q.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"unindexed", "a"}, ids(list))
+		assert.Equal(t, int64(2), srv.Do("ZCARD", redisIndexKey), "delivery was not indexed")
+	})
+}
@@ -0,0 +1,328 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package digest emails teams a periodic summary of the pull requests that
+// are waiting for their approval.
+package digest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/server/redis"
+)
+
+const (
+	DefaultTime    = "09:00"
+	DefaultSubject = "Pull requests awaiting approval from {{.Team}}"
+
+	// ClaimTTL is how long the server that sends the digests for a scheduled
+	// time keeps its claim, which must outlast the clock skew between servers
+	ClaimTTL = 24 * time.Hour
+
+	redisKeyPrefix = "policy-bot:digest:"
+)
+
+type Config struct {
+	// Schedule is when digests are sent
+	Schedule ScheduleConfig `yaml:"schedule"`
+
+	SMTP SMTPConfig `yaml:"smtp"`
+
+	// Recipients maps teams, in "org/team-slug" format, to the email
+	// addresses that receive the team's digest. Teams without recipients do
+	// not receive digests.
+	Recipients map[string][]string `yaml:"recipients"`
+}
+
+type ScheduleConfig struct {
+	// Time is the time of day, in "HH:MM" format, to send digests
+	Time string `yaml:"time"`
+
+	// Timezone is the IANA name of the timezone for Time. If empty, UTC is
+	// used.
+	Timezone string `yaml:"timezone"`
+
+	// Weekdays are the days to send digests, like "monday". If empty,
+	// digests are sent every day.
+	Weekdays []string `yaml:"weekdays"`
+}
+
+type SMTPConfig struct {
+	// Address is the host and port of the SMTP server
+	Address  string `yaml:"address"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// From is the sender address of digests
+	From string `yaml:"from"`
+}
+
+// Schedule is a parsed ScheduleConfig.
+type Schedule struct {
+	Hour     int
+	Minute   int
+	Location *time.Location
+	Weekdays map[time.Weekday]bool
+}
+
+// ParseSchedule parses and validates a schedule configuration.
+func ParseSchedule(c ScheduleConfig) (*Schedule, error) {
+	if c.Time == "" {
+		c.Time = DefaultTime
+	}
+
+	t, err := time.Parse("15:04", c.Time)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid digest time %q", c.Time)
+	}
+
+	loc := time.UTC
+	if c.Timezone != "" {
+		if loc, err = time.LoadLocation(c.Timezone); err != nil {
+			return nil, errors.Wrapf(err, "invalid digest timezone %q", c.Timezone)
+		}
+	}
+
+	s := &Schedule{Hour: t.Hour(), Minute: t.Minute(), Location: loc}
+	for _, day := range c.Weekdays {
+		weekday, ok := parseWeekday(day)
+		if !ok {
+			return nil, errors.Errorf("invalid digest weekday %q", day)
+		}
+		if s.Weekdays == nil {
+			s.Weekdays = make(map[time.Weekday]bool)
+		}
+		s.Weekdays[weekday] = true
+	}
+	return s, nil
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s = strings.ToLower(s); s == name || s == name[:3] {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// Next returns the first scheduled time after t.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.Location)
+	next := time.Date(t.Year(), t.Month(), t.Day(), s.Hour, s.Minute, 0, 0, s.Location)
+	for !next.After(t) || (s.Weekdays != nil && !s.Weekdays[next.Weekday()]) {
+		next = time.Date(next.Year(), next.Month(), next.Day()+1, s.Hour, s.Minute, 0, 0, s.Location)
+	}
+	return next
+}
+
+// Source finds pull requests awaiting approval, grouped by team.
+type Source func(ctx context.Context) (map[string][]*handler.AwaitingPullRequest, error)
+
+// Digest sends scheduled digest emails.
+type Digest struct {
+	Config   Config
+	Schedule *Schedule
+	Sources  []Source
+	Logger   zerolog.Logger
+
+	// Client, if set, is used to claim each scheduled time so that only one
+	// of the servers sharing the Redis instance sends the digests
+	Client *redis.Client
+}
+
+// New returns a Digest for the configuration, or nil if no teams have
+// recipients.
+func New(c Config, logger zerolog.Logger, client *redis.Client, sources ...Source) (*Digest, error) {
+	if len(c.Recipients) == 0 {
+		return nil, nil
+	}
+	if c.SMTP.Address == "" || c.SMTP.From == "" {
+		return nil, errors.New("digests require an SMTP address and sender")
+	}
+	if _, _, err := net.SplitHostPort(c.SMTP.Address); err != nil {
+		return nil, errors.Wrap(err, "invalid SMTP address")
+	}
+
+	schedule, err := ParseSchedule(c.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Digest{
+		Config:   c,
+		Schedule: schedule,
+		Sources:  sources,
+		Logger:   logger,
+		Client:   client,
+	}, nil
+}
+
+// Start sends digests on the schedule until the context is canceled.
+func (d *Digest) Start(ctx context.Context) {
+	go func() {
+		for {
+			next := d.Schedule.Next(time.Now())
+			d.Logger.Debug().Msgf("Next pull request digest at %s", next)
+
+			select {
+			case <-time.After(time.Until(next)):
+			case <-ctx.Done():
+				return
+			}
+
+			claimed, err := d.claim(ctx, next)
+			if err != nil {
+				d.Logger.Error().Err(err).Msg("Failed to claim pull request digests")
+				continue
+			}
+			if !claimed {
+				d.Logger.Debug().Msgf("Pull request digests for %s are sent by another server", next)
+				continue
+			}
+
+			if err := d.Send(d.Logger.WithContext(ctx)); err != nil {
+				d.Logger.Error().Err(err).Msg("Failed to send pull request digests")
+			}
+		}
+	}()
+}
+
+// claim returns true if this server should send the digests for the
+// scheduled time. Without Redis, every server sends its own digests.
+func (d *Digest) claim(ctx context.Context, scheduled time.Time) (bool, error) {
+	if d.Client == nil {
+		return true, nil
+	}
+
+	key := fmt.Sprintf("%s%d", redisKeyPrefix, scheduled.Unix())
+	reply, err := d.Client.Do(ctx, "SET", key, xid.New().String(), "NX", "EX", int64(ClaimTTL/time.Second))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to store digest claim")
+	}
+	return reply != nil, nil
+}
+
+// Send finds the pull requests awaiting approval and emails a digest to the
+// recipients of each team with at least one pull request.
+func (d *Digest) Send(ctx context.Context) error {
+	teams := make(map[string][]*handler.AwaitingPullRequest)
+	for _, source := range d.Sources {
+		found, err := source(ctx)
+		if err != nil {
+			return err
+		}
+		for team, prs := range found {
+			teams[team] = append(teams[team], prs...)
+		}
+	}
+
+	sent := 0
+	for team, recipients := range d.Config.Recipients {
+		prs := teams[team]
+		if len(prs) == 0 || len(recipients) == 0 {
+			continue
+		}
+
+		sort.Slice(prs, func(i, j int) bool {
+			return prs[i].CreatedAt.Before(prs[j].CreatedAt)
+		})
+
+		if err := d.send(team, recipients, prs); err != nil {
+			d.Logger.Error().Err(err).Msgf("Failed to send pull request digest to %s", team)
+			continue
+		}
+		sent++
+	}
+
+	d.Logger.Info().Msgf("Sent %d pull request digests", sent)
+	return nil
+}
+
+var (
+	subjectTemplate = template.Must(template.New("subject").Parse(DefaultSubject))
+	bodyTemplate    = template.Must(template.New("body").Funcs(template.FuncMap{
+		"age":  age,
+		"join": strings.Join,
+	}).Parse(`The following pull requests are waiting for approval from {{.Team}}:
+{{range .PullRequests}}
+{{.Owner}}/{{.Repo}}#{{.Number}}: {{.Title}}
+  Opened by {{.Author}} {{age .CreatedAt}} ago
+  Waiting on: {{join .Rules ", "}}
+  {{.URL}}
+{{end}}`))
+)
+
+type templateData struct {
+	Team         string
+	PullRequests []*handler.AwaitingPullRequest
+}
+
+func (d *Digest) send(team string, recipients []string, prs []*handler.AwaitingPullRequest) error {
+	data := templateData{Team: team, PullRequests: prs}
+
+	var subject, body bytes.Buffer
+	if err := subjectTemplate.Execute(&subject, data); err != nil {
+		return errors.Wrap(err, "failed to render subject")
+	}
+	if err := bodyTemplate.Execute(&body, data); err != nil {
+		return errors.Wrap(err, "failed to render body")
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", d.Config.SMTP.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject.String())
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.Replace(body.String(), "\n", "\r\n", -1))
+
+	var auth smtp.Auth
+	if d.Config.SMTP.Username != "" {
+		host, _, _ := net.SplitHostPort(d.Config.SMTP.Address)
+		auth = smtp.PlainAuth("", d.Config.SMTP.Username, d.Config.SMTP.Password, host)
+	}
+
+	if err := smtp.SendMail(d.Config.SMTP.Address, auth, d.Config.SMTP.From, recipients, msg.Bytes()); err != nil {
+		return errors.Wrap(err, "failed to send email")
+	}
+	return nil
+}
+
+// age formats the time since t in days or hours.
+func age(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d/(24*time.Hour)))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(d/time.Hour))
+	}
+	return "less than 2 hours"
+}
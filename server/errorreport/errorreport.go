@@ -0,0 +1,145 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package errorreport sends panics and unexpected errors to an error tracking
+// service, like Sentry, with enough context to find the affected repository
+// and pull request.
+package errorreport
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	TagEvent        = "github_event"
+	TagDelivery     = "github_delivery"
+	TagApp          = "app"
+	TagInstallation = "github_installation_id"
+	TagRepository   = "github_repository"
+	TagPullRequest  = "github_pr_num"
+)
+
+type Config struct {
+	// Sentry reports errors to a Sentry project
+	Sentry *SentryConfig `yaml:"sentry"`
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c Config) Validate() error {
+	if c.Sentry != nil {
+		if _, err := parseDSN(c.Sentry.DSN); err != nil {
+			return errors.Wrap(err, "invalid sentry configuration")
+		}
+	}
+	return nil
+}
+
+// Event is an error to report.
+type Event struct {
+	Err error
+
+	// Message describes the operation that failed. If empty, the error
+	// message is used.
+	Message string
+
+	// Panic is true if the error was recovered from a panic
+	Panic bool
+
+	// Stack is the stack of the goroutine where the error happened, most
+	// recent call first. If empty, the stack is taken from the error if it
+	// has one.
+	Stack []runtime.Frame
+
+	// Tags identify the event, repository, and pull request that caused the
+	// error. Values are scrubbed of secrets before they are sent.
+	Tags map[string]string
+}
+
+// Reporter sends errors to an error tracking service. Implementations must
+// not block the caller while sending and must scrub secrets from events.
+type Reporter interface {
+	Report(ctx context.Context, e Event)
+
+	// Wait waits for pending reports to be sent or for the context to be
+	// done.
+	Wait(ctx context.Context)
+}
+
+// New creates a Reporter from the configuration. It returns nil if no
+// service is configured.
+func New(c Config, logger zerolog.Logger) (Reporter, error) {
+	if c.Sentry == nil {
+		return nil, nil
+	}
+	return NewSentry(*c.Sentry, logger)
+}
+
+// stackTrace returns the stack of the event, most recent call first.
+func (e Event) stackTrace() []runtime.Frame {
+	if len(e.Stack) > 0 {
+		return e.Stack
+	}
+
+	type stackTracer interface {
+		StackTrace() errors.StackTrace
+	}
+
+	// use the deepest stack, which is closest to where the error happened
+	var st errors.StackTrace
+	for err := e.Err; err != nil; {
+		if s, ok := err.(stackTracer); ok {
+			st = s.StackTrace()
+		}
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+
+	pcs := make([]uintptr, len(st))
+	for i, f := range st {
+		pcs[i] = uintptr(f)
+	}
+	return framesOf(pcs)
+}
+
+// Callers returns the stack of the calling goroutine, skipping the given
+// number of frames in addition to Callers itself.
+func Callers(skip int) []runtime.Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	return framesOf(pcs[:n])
+}
+
+func framesOf(pcs []uintptr) []runtime.Frame {
+	if len(pcs) == 0 {
+		return nil
+	}
+
+	var stack []runtime.Frame
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		stack = append(stack, f)
+		if !more {
+			break
+		}
+	}
+	return stack
+}
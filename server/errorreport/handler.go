@@ -0,0 +1,161 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errorreport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bluekeyes/hatpear"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+)
+
+// Middleware reports panics and errors of HTTP handlers. It must run inside
+// middleware that catches errors and recovers from panics, because it
+// reports panics and then continues to panic.
+func Middleware(r Reporter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			tags := map[string]string{
+				"method":    req.Method,
+				"path":      req.URL.Path,
+				TagEvent:    req.Header.Get("X-GitHub-Event"),
+				TagDelivery: req.Header.Get("X-GitHub-Delivery"),
+			}
+
+			defer func() {
+				if v := recover(); v != nil {
+					r.Report(req.Context(), Event{
+						Err:     panicError(v),
+						Message: "Panic while serving route",
+						Panic:   true,
+						Stack:   Callers(2),
+						Tags:    tags,
+					})
+					panic(v)
+				}
+			}()
+
+			next.ServeHTTP(w, req)
+
+			if err := hatpear.Get(req); err != nil {
+				r.Report(req.Context(), Event{
+					Err:     err,
+					Message: "Unhandled error while serving route",
+					Tags:    tags,
+				})
+			}
+		})
+	}
+}
+
+// Handler wraps an event handler to report errors and panics. Panics are
+// returned as errors.
+type Handler struct {
+	githubapp.EventHandler
+
+	// App is the name of the GitHub App that received the events
+	App string
+
+	Reporter Reporter
+}
+
+// Wrap wraps each handler of an app in a Handler that reports to r. If r is
+// nil, the handlers are returned unchanged.
+func Wrap(r Reporter, app string, handlers ...githubapp.EventHandler) []githubapp.EventHandler {
+	if r == nil {
+		return handlers
+	}
+
+	wrapped := make([]githubapp.EventHandler, len(handlers))
+	for i, h := range handlers {
+		wrapped[i] = &Handler{EventHandler: h, App: app, Reporter: r}
+	}
+	return wrapped
+}
+
+func (h *Handler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = panicError(v)
+			h.Reporter.Report(ctx, Event{
+				Err:     err,
+				Message: fmt.Sprintf("Panic while handling %s event", eventType),
+				Panic:   true,
+				Stack:   Callers(2),
+				Tags:    h.tags(eventType, deliveryID, payload),
+			})
+		}
+	}()
+
+	if err = h.EventHandler.Handle(ctx, eventType, deliveryID, payload); err != nil {
+		h.Reporter.Report(ctx, Event{
+			Err:     err,
+			Message: fmt.Sprintf("Failed to handle %s event", eventType),
+			Tags:    h.tags(eventType, deliveryID, payload),
+		})
+	}
+	return err
+}
+
+func (h *Handler) tags(eventType, deliveryID string, payload []byte) map[string]string {
+	tags := map[string]string{
+		TagApp:      h.App,
+		TagEvent:    eventType,
+		TagDelivery: deliveryID,
+	}
+
+	// only the fields common to most events are decoded, so errors are
+	// ignored and missing fields are left out
+	var event struct {
+		Number       int `json:"number"`
+		Installation struct {
+			ID int64 `json:"id"`
+		} `json:"installation"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		PullRequest struct {
+			Number int `json:"number"`
+		} `json:"pull_request"`
+		Issue struct {
+			Number int `json:"number"`
+		} `json:"issue"`
+	}
+	_ = json.Unmarshal(payload, &event)
+
+	tags[TagRepository] = event.Repository.FullName
+	if event.Installation.ID > 0 {
+		tags[TagInstallation] = strconv.FormatInt(event.Installation.ID, 10)
+	}
+	for _, n := range []int{event.PullRequest.Number, event.Issue.Number, event.Number} {
+		if n > 0 {
+			tags[TagPullRequest] = strconv.Itoa(n)
+			break
+		}
+	}
+	return tags
+}
+
+func panicError(v interface{}) error {
+	if err, ok := v.(error); ok {
+		return errors.WithMessage(err, "panic")
+	}
+	return errors.Errorf("panic: %v", v)
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errorreport
+
+import (
+	"regexp"
+)
+
+const redacted = "[REDACTED]"
+
+var scrubbers = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// private keys, like the key of the GitHub App
+	{
+		regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?(-----END [A-Z ]*PRIVATE KEY-----|$)`),
+		redacted,
+	},
+	// GitHub tokens
+	{
+		regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9_]{16,}|github_pat_[A-Za-z0-9_]{16,}|v1\.[0-9a-f]{40})\b`),
+		redacted,
+	},
+	// credentials in authorization headers
+	{
+		regexp.MustCompile(`(?i)\b(bearer|token|basic|ssws)\s+[A-Za-z0-9\-._~+/]{16,}=*`),
+		"$1 " + redacted,
+	},
+	// credentials in URLs
+	{
+		regexp.MustCompile(`(://[^/\s:@]+):[^/\s@]+@`),
+		"$1:" + redacted + "@",
+	},
+	{
+		regexp.MustCompile(`(?i)([?&](?:access_token|client_secret|code|key|password|secret|sig|signature|state|token)=)[^&\s]+`),
+		"$1" + redacted,
+	},
+}
+
+// Scrub removes secrets, like tokens, private keys, and passwords in URLs,
+// from text that is sent to an error tracking service.
+func Scrub(s string) string {
+	for _, sc := range scrubbers {
+		s = sc.pattern.ReplaceAllString(s, sc.replacement)
+	}
+	return s
+}
@@ -0,0 +1,315 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errorreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/version"
+)
+
+const (
+	DefaultSentryTimeout = 10 * time.Second
+
+	// maxPendingReports limits the reports sent at the same time; reports
+	// are dropped when the limit is reached so a burst of failures does not
+	// overwhelm the server or the Sentry project
+	maxPendingReports = 16
+
+	appPackage = "github.com/palantir/policy-bot/"
+)
+
+type SentryConfig struct {
+	// DSN is the client key of the Sentry project, like
+	// https://<key>@<host>/<project>
+	DSN string `yaml:"dsn"`
+
+	// Environment is the name of the deployment, like "production"
+	Environment string `yaml:"environment"`
+
+	// Release is the version reported with errors. If empty, the version
+	// of the server is used.
+	Release string `yaml:"release"`
+
+	// Timeout is the maximum time for each request to Sentry
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type sentryDSN struct {
+	storeURL  string
+	publicKey string
+	secretKey string
+}
+
+func parseDSN(dsn string) (*sentryDSN, error) {
+	if dsn == "" {
+		return nil, errors.New("dsn is required")
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse dsn")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, errors.New("dsn must include a public key")
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	idx := strings.LastIndex(path, "/")
+	if idx < 0 || idx == len(path)-1 {
+		return nil, errors.New("dsn must include a project ID")
+	}
+
+	secret, _ := u.User.Password()
+	return &sentryDSN{
+		storeURL:  fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path[:idx], path[idx+1:]),
+		publicKey: u.User.Username(),
+		secretKey: secret,
+	}, nil
+}
+
+// Sentry reports errors to Sentry using the store API.
+type Sentry struct {
+	dsn         *sentryDSN
+	environment string
+	release     string
+	serverName  string
+
+	client *http.Client
+	logger zerolog.Logger
+
+	wg      sync.WaitGroup
+	pending chan struct{}
+}
+
+// NewSentry creates a Reporter that sends errors to Sentry.
+func NewSentry(c SentryConfig, logger zerolog.Logger) (*Sentry, error) {
+	dsn, err := parseDSN(c.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSentryTimeout
+	}
+
+	release := c.Release
+	if release == "" {
+		release = version.GetVersion()
+	}
+
+	hostname, _ := os.Hostname()
+
+	return &Sentry{
+		dsn:         dsn,
+		environment: c.Environment,
+		release:     release,
+		serverName:  hostname,
+		client:      &http.Client{Timeout: timeout},
+		logger:      logger,
+		pending:     make(chan struct{}, maxPendingReports),
+	}, nil
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	Message     string            `json:"message,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Exception   sentryExceptions  `json:"exception"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+func (s *Sentry) Report(ctx context.Context, e Event) {
+	select {
+	case s.pending <- struct{}{}:
+	default:
+		zerolog.Ctx(ctx).Warn().Msg("Too many pending error reports, dropping report")
+		return
+	}
+
+	event := s.newEvent(e)
+
+	s.wg.Add(1)
+	go func() {
+		defer func() {
+			<-s.pending
+			s.wg.Done()
+		}()
+
+		if err := s.send(event); err != nil {
+			s.logger.Warn().Err(err).Str("event_id", event.EventID).Msg("Failed to report error to Sentry")
+		}
+	}()
+}
+
+func (s *Sentry) Wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.logger.Warn().Msg("Not all errors were reported to Sentry before the deadline")
+	}
+}
+
+func (s *Sentry) newEvent(e Event) *sentryEvent {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+
+	level, errType := "error", "error"
+	if e.Panic {
+		level, errType = "fatal", "panic"
+	} else if e.Err != nil {
+		errType = fmt.Sprintf("%T", errors.Cause(e.Err))
+	}
+
+	var value string
+	if e.Err != nil {
+		value = Scrub(e.Err.Error())
+	}
+
+	tags := make(map[string]string, len(e.Tags))
+	for k, v := range e.Tags {
+		if v != "" {
+			tags[k] = Scrub(v)
+		}
+	}
+
+	exception := sentryException{
+		Type:  errType,
+		Value: value,
+	}
+	if frames := sentryFrames(e.stackTrace()); len(frames) > 0 {
+		exception.Stacktrace = &sentryStacktrace{Frames: frames}
+	}
+
+	return &sentryEvent{
+		EventID:     hex.EncodeToString(id[:]),
+		Timestamp:   time.Now().UTC().Format("2006-01-02T15:04:05"),
+		Level:       level,
+		Platform:    "go",
+		Logger:      "policy-bot",
+		Message:     Scrub(e.Message),
+		Release:     s.release,
+		Environment: s.environment,
+		ServerName:  s.serverName,
+		Tags:        tags,
+		Exception:   sentryExceptions{Values: []sentryException{exception}},
+	}
+}
+
+// sentryFrames converts a stack to Sentry frames, which are ordered from the
+// oldest call to the most recent call.
+func sentryFrames(stack []runtime.Frame) []sentryFrame {
+	frames := make([]sentryFrame, 0, len(stack))
+	for i := len(stack) - 1; i >= 0; i-- {
+		f := stack[i]
+		if f.Function == "" {
+			continue
+		}
+
+		filename := f.File
+		if idx := strings.Index(filename, appPackage); idx >= 0 {
+			filename = filename[idx+len(appPackage):]
+		}
+
+		frames = append(frames, sentryFrame{
+			Function: f.Function,
+			Filename: filename,
+			AbsPath:  f.File,
+			Lineno:   f.Line,
+			InApp:    strings.HasPrefix(f.Function, appPackage) && !strings.Contains(f.Function, "/vendor/"),
+		})
+	}
+	return frames
+}
+
+func (s *Sentry) send(event *sentryEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.dsn.storeURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=policy-bot/%s, sentry_key=%s", version.GetVersion(), s.dsn.publicKey)
+	if s.dsn.secretKey != "" {
+		auth += ", sentry_secret=" + s.dsn.secretKey
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", auth)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode >= 300 {
+		return errors.Errorf("unexpected response: %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package evalcache caches the outcome of evaluations so that events that
+// cannot change the outcome, like an unrelated comment on a pull request, do
+// not cause a new evaluation.
+package evalcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/redis"
+)
+
+const (
+	DefaultTTL     = time.Hour
+	DefaultMaxSize = 10000
+
+	redisKeyPrefix = "policy-bot:evaluations:"
+)
+
+type Config struct {
+	// Enabled enables the cache.
+	Enabled bool `yaml:"enabled"`
+
+	// TTL is how long an outcome is reused. Inputs that are not part of the
+	// key, like team membership, can change during this time.
+	TTL time.Duration `yaml:"ttl"`
+
+	// MaxSize is the maximum number of outcomes cached in memory. It does not
+	// apply when outcomes are cached in Redis.
+	MaxSize int `yaml:"max_size"`
+}
+
+// Inputs are the inputs of an evaluation that identify its outcome. Any data
+// used by the policy that is not included here must not change while an
+// outcome is cached.
+type Inputs struct {
+	// App is the name of the app that evaluates the pull request
+	App string `json:"app"`
+
+	Owner   string `json:"owner"`
+	Repo    string `json:"repo"`
+	Number  int    `json:"number"`
+	HeadSHA string `json:"head_sha"`
+	BaseRef string `json:"base_ref"`
+	Author  string `json:"author"`
+
+	// Title and Body are the title and description of the pull request
+	Title string `json:"title"`
+	Body  string `json:"body"`
+
+	// Labels are the labels on the pull request. The order does not matter.
+	Labels []string `json:"labels"`
+
+	// Draft is true if the pull request is a draft and the policy depends on
+	// the draft state
+	Draft bool `json:"draft,omitempty"`
+
+	// AuthorPermission is the permission of the author on the repository, if
+	// the policy depends on it
+	AuthorPermission string `json:"author_permission,omitempty"`
+
+	// CodeOwnersHash is the hash of the content of the CODEOWNERS file of the
+	// base branch, if the policy depends on it
+	CodeOwnersHash string `json:"code_owners_hash,omitempty"`
+
+	// PolicyHash is the hash of the content of the policy file
+	PolicyHash string `json:"policy_hash"`
+
+	// Reviews identifies the comments and reviews that match an approval,
+	// disapproval, or revocation method of the policy. The order does not
+	// matter.
+	Reviews []string `json:"reviews"`
+}
+
+// Key returns the cache key for the inputs.
+func (in Inputs) Key() string {
+	reviews := append([]string(nil), in.Reviews...)
+	sort.Strings(reviews)
+	in.Reviews = reviews
+
+	labels := append([]string(nil), in.Labels...)
+	sort.Strings(labels)
+	in.Labels = labels
+
+	// marshaling a struct of strings and ints cannot fail
+	b, _ := json.Marshal(in)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Outcome is the cached outcome of an evaluation: the state and description
+// of the posted status and, for check runs, the rule sections of the summary.
+type Outcome struct {
+	State       string `json:"state"`
+	Description string `json:"description"`
+	Rules       string `json:"rules,omitempty"`
+}
+
+// Cache stores evaluation outcomes by key.
+type Cache interface {
+	// Get returns the outcome for a key, or nil if there is no outcome or it
+	// has expired.
+	Get(ctx context.Context, key string) (*Outcome, error)
+
+	// Put stores the outcome for a key.
+	Put(ctx context.Context, key string, o Outcome) error
+}
+
+// New returns a Cache for the given configuration, or nil if the cache is
+// disabled. If client is non-nil, outcomes are cached in Redis. Otherwise,
+// they are cached in memory.
+func New(c Config, client *redis.Client) Cache {
+	if !c.Enabled {
+		return nil
+	}
+	if c.TTL <= 0 {
+		c.TTL = DefaultTTL
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = DefaultMaxSize
+	}
+	if client != nil {
+		return &RedisCache{Client: client, TTL: c.TTL}
+	}
+	return NewMemoryCache(c.TTL, c.MaxSize)
+}
+
+type memoryEntry struct {
+	outcome Outcome
+	expires time.Time
+}
+
+// MemoryCache is a Cache that keeps outcomes in memory.
+type MemoryCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+func NewMemoryCache(ttl time.Duration, maxSize int) *MemoryCache {
+	return &MemoryCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: make(map[string]memoryEntry),
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (*Outcome, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, nil
+	}
+	return &e.outcome, nil
+}
+
+func (c *MemoryCache) Put(ctx context.Context, key string, o Outcome) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxSize {
+		c.evict(now)
+	}
+	c.entries[key] = memoryEntry{outcome: o, expires: now.Add(c.ttl)}
+	return nil
+}
+
+// evict removes expired entries or, if there are none, the entry that
+// expires first.
+func (c *MemoryCache) evict(now time.Time) {
+	var oldest string
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+			continue
+		}
+		if oldest == "" || e.expires.Before(c.entries[oldest].expires) {
+			oldest = k
+		}
+	}
+	if len(c.entries) >= c.maxSize {
+		delete(c.entries, oldest)
+	}
+}
+
+// RedisCache is a Cache that keeps outcomes in Redis, so that all servers
+// sharing the Redis instance reuse the same outcomes. Redis expires the keys.
+type RedisCache struct {
+	Client *redis.Client
+	TTL    time.Duration
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (*Outcome, error) {
+	reply, err := c.Client.Do(ctx, "GET", redisKeyPrefix+key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get cached outcome")
+	}
+
+	s, ok := reply.(string)
+	if !ok {
+		return nil, nil
+	}
+
+	var o Outcome
+	if err := json.Unmarshal([]byte(s), &o); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal cached outcome")
+	}
+	return &o, nil
+}
+
+func (c *RedisCache) Put(ctx context.Context, key string, o Outcome) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal outcome")
+	}
+
+	ttl := int64(c.TTL / time.Millisecond)
+	if _, err := c.Client.Do(ctx, "SET", redisKeyPrefix+key, b, "PX", ttl); err != nil {
+		return errors.Wrap(err, "failed to cache outcome")
+	}
+	return nil
+}
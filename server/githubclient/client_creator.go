@@ -0,0 +1,163 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package githubclient customizes the GitHub clients created by go-githubapp.
+package githubclient
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/shurcooL/githubv4"
+)
+
+// ClientCreator wraps another githubapp.ClientCreator. It configures the
+// upload URL of all v3 clients, which is required for GitHub Enterprise
+// Server, and optionally reuses installation tokens.
+type ClientCreator struct {
+	githubapp.ClientCreator
+	UploadURL *url.URL
+
+	// Tokens, if set, provides the tokens for installation clients
+	Tokens *TokenCache
+
+	// RepositoryScoped limits the tokens of repository clients to their
+	// repository. If false, repository clients are installation clients.
+	RepositoryScoped bool
+}
+
+// NewClientCreator wraps a client creator. If uploadURL is empty, it is
+// derived from the v3 API URL.
+func NewClientCreator(delegate githubapp.ClientCreator, v3APIURL, uploadURL string) (*ClientCreator, error) {
+	if uploadURL == "" {
+		uploadURL = DefaultUploadURL(v3APIURL)
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(uploadURL, "/") + "/")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse upload URL: %q", uploadURL)
+	}
+
+	return &ClientCreator{
+		ClientCreator: delegate,
+		UploadURL:     u,
+	}, nil
+}
+
+// DefaultUploadURL returns the upload URL for a v3 API URL. For GitHub
+// Enterprise Server, API URLs end in "/api/v3" and the upload URL ends in
+// "/api/uploads". For all other URLs, it returns the github.com upload URL.
+func DefaultUploadURL(v3APIURL string) string {
+	base := strings.TrimSuffix(v3APIURL, "/")
+	if strings.HasSuffix(base, "/api/v3") {
+		return strings.TrimSuffix(base, "/v3") + "/uploads/"
+	}
+	return "https://uploads.github.com/"
+}
+
+func (c *ClientCreator) NewAppClient() (*github.Client, error) {
+	return c.configure(c.ClientCreator.NewAppClient())
+}
+
+func (c *ClientCreator) NewInstallationClient(installationID int64) (*github.Client, error) {
+	if c.Tokens == nil {
+		return c.configure(c.ClientCreator.NewInstallationClient(installationID))
+	}
+
+	token, err := c.Tokens.Token(context.Background(), installationID)
+	if err != nil {
+		return nil, err
+	}
+	return c.configure(c.ClientCreator.NewTokenClient(token))
+}
+
+func (c *ClientCreator) NewInstallationV4Client(installationID int64) (*githubv4.Client, error) {
+	if c.Tokens == nil {
+		return c.ClientCreator.NewInstallationV4Client(installationID)
+	}
+
+	token, err := c.Tokens.Token(context.Background(), installationID)
+	if err != nil {
+		return nil, err
+	}
+	return c.ClientCreator.NewTokenV4Client(token)
+}
+
+// NewRepositoryClient returns a client that can only access one repository
+// of the installation, if repository scoping is enabled.
+func (c *ClientCreator) NewRepositoryClient(installationID int64, repo string) (*github.Client, error) {
+	if !c.RepositoryScoped {
+		return c.NewInstallationClient(installationID)
+	}
+
+	token, err := c.repositoryToken(installationID, repo)
+	if err != nil {
+		return nil, err
+	}
+	return c.configure(c.ClientCreator.NewTokenClient(token))
+}
+
+// NewRepositoryV4Client returns a v4 client that can only access one
+// repository of the installation, if repository scoping is enabled.
+func (c *ClientCreator) NewRepositoryV4Client(installationID int64, repo string) (*githubv4.Client, error) {
+	if !c.RepositoryScoped {
+		return c.NewInstallationV4Client(installationID)
+	}
+
+	token, err := c.repositoryToken(installationID, repo)
+	if err != nil {
+		return nil, err
+	}
+	return c.ClientCreator.NewTokenV4Client(token)
+}
+
+func (c *ClientCreator) repositoryToken(installationID int64, repo string) (string, error) {
+	ctx := context.Background()
+	if c.Tokens != nil {
+		return c.Tokens.RepositoryToken(ctx, installationID, repo)
+	}
+
+	client, err := c.ClientCreator.NewAppClient()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create app client")
+	}
+	token, err := createToken(ctx, client, installationID, repo)
+	if err != nil {
+		return "", err
+	}
+	return token.GetToken(), nil
+}
+
+// InvalidateInstallation discards any cached token for the installation.
+func (c *ClientCreator) InvalidateInstallation(installationID int64) {
+	if c.Tokens != nil {
+		c.Tokens.Invalidate(installationID)
+	}
+}
+
+func (c *ClientCreator) NewTokenClient(token string) (*github.Client, error) {
+	return c.configure(c.ClientCreator.NewTokenClient(token))
+}
+
+func (c *ClientCreator) configure(client *github.Client, err error) (*github.Client, error) {
+	if err != nil {
+		return nil, err
+	}
+	client.UploadURL = c.UploadURL
+	return client, nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubclient
+
+import (
+	"net/http"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rcrowley/go-metrics"
+)
+
+// MetricsKeyRequestsFailed counts GitHub API requests that failed without a
+// response, like timeouts and connection errors.
+const MetricsKeyRequestsFailed = "github.requests.failed"
+
+// FailureMetrics returns client middleware that counts requests that fail
+// without a response. githubapp.ClientMetrics only records requests with a
+// response, so use both to count all failures.
+func FailureMetrics(registry metrics.Registry) githubapp.ClientMiddleware {
+	failed := metrics.GetOrRegisterCounter(MetricsKeyRequestsFailed, registry)
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			res, err := next.RoundTrip(r)
+			if err != nil && res == nil {
+				failed.Inc(1)
+			}
+			return res, err
+		})
+	}
+}
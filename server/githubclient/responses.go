@@ -0,0 +1,184 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/die-net/lrucache"
+	"github.com/gregjones/httpcache"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/palantir/policy-bot/server/redis"
+)
+
+const (
+	DefaultResponseCacheTTL = 24 * time.Hour
+
+	// MetricsKeyResponseCacheErrors counts failed reads and writes of cached
+	// responses in Redis.
+	MetricsKeyResponseCacheErrors = "github.cache.errors"
+
+	responseKeyPrefix = "policy-bot:responses:"
+
+	// redisTimeout limits how long a cache operation can delay a request
+	redisTimeout = time.Second
+
+	// variedAuthorization is the header that httpcache uses to store the
+	// Authorization header of the request that a response varies by
+	variedAuthorization = "X-Varied-Authorization"
+)
+
+var maxAgePattern = regexp.MustCompile(`max-age=\d+`)
+
+// CacheResponses returns client middleware that caches the responses to GET
+// requests in cache. It must be the last middleware, so that it runs before
+// clients add credentials to requests: responses are cached without the
+// Authorization header that GitHub varies them by, so cached entries never
+// contain credentials and remain valid when tokens change.
+//
+// Every cached response is validated with a conditional request that uses
+// the credentials of the current client, so a client only receives a cached
+// response if GitHub confirms that the client can read the unchanged
+// resource.
+func CacheResponses(cache httpcache.Cache) githubapp.ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		cached := &httpcache.Transport{
+			Transport:           alwaysValidate(next),
+			Cache:               cache,
+			MarkCachedResponses: true,
+		}
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" {
+				return next.RoundTrip(r)
+			}
+			return cached.RoundTrip(r)
+		})
+	}
+}
+
+// alwaysValidate makes responses stale as soon as they are cached, so that
+// httpcache validates them before every use.
+func alwaysValidate(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		res, err := next.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		if cc := res.Header.Get("Cache-Control"); cc != "" {
+			res.Header.Set("Cache-Control", maxAgePattern.ReplaceAllString(cc, "max-age=0"))
+		}
+		return res, nil
+	})
+}
+
+// NewResponseCache returns the cache of GitHub API responses shared by all
+// clients. Responses are stored with their ETag and Last-Modified validators,
+// so later requests for the same URL are conditional and GitHub does not
+// count them against the rate limit if the resource has not changed.
+//
+// If client is non-nil, responses are cached in Redis for ttl, so that all
+// servers sharing the Redis instance reuse them. Otherwise, they are cached
+// in memory up to maxSize bytes. Use the cache with CacheResponses.
+func NewResponseCache(maxSize int64, client *redis.Client, ttl time.Duration, registry metrics.Registry) httpcache.Cache {
+	if client == nil {
+		return lrucache.New(maxSize, 0)
+	}
+	if ttl <= 0 {
+		ttl = DefaultResponseCacheTTL
+	}
+	return &RedisResponseCache{
+		Client: client,
+		TTL:    ttl,
+		errors: metrics.GetOrRegisterCounter(MetricsKeyResponseCacheErrors, registry),
+	}
+}
+
+// RedisResponseCache is an httpcache.Cache that keeps responses in Redis.
+// The cache interface cannot return errors, so failed operations are counted
+// and treated as misses.
+type RedisResponseCache struct {
+	Client *redis.Client
+	TTL    time.Duration
+
+	errors metrics.Counter
+}
+
+func (c *RedisResponseCache) Get(key string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	reply, err := c.Client.Do(ctx, "GET", responseKey(key))
+	if err != nil {
+		c.errors.Inc(1)
+		return nil, false
+	}
+
+	s, ok := reply.(string)
+	if !ok {
+		return nil, false
+	}
+	return []byte(s), true
+}
+
+func (c *RedisResponseCache) Set(key string, b []byte) {
+	// responses cached by CacheResponses never vary by credentials; refuse
+	// any other response so that tokens are not persisted
+	if hasCredentials(b) {
+		c.errors.Inc(1)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	ttl := int64(c.TTL / time.Millisecond)
+	if _, err := c.Client.Do(ctx, "SET", responseKey(key), b, "PX", ttl); err != nil {
+		c.errors.Inc(1)
+	}
+}
+
+func (c *RedisResponseCache) Delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	if _, err := c.Client.Do(ctx, "DEL", responseKey(key)); err != nil {
+		c.errors.Inc(1)
+	}
+}
+
+// hasCredentials returns true if a cached response records the Authorization
+// header of the request it was cached for.
+func hasCredentials(b []byte) bool {
+	header := b
+	if i := bytes.Index(b, []byte("\r\n\r\n")); i >= 0 {
+		header = b[:i]
+	}
+	return bytes.Contains(header, []byte(variedAuthorization))
+}
+
+// responseKey hashes the URL of a response so that keys have a fixed length
+// and do not reveal repository names.
+func responseKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return responseKeyPrefix + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubclient
+
+import (
+	"sync"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/shurcooL/githubv4"
+)
+
+// RotatingClientCreator delegates to a client creator that can be replaced
+// while the server runs, for example when the private key of the app
+// changes. Clients that already exist keep using the previous creator.
+type RotatingClientCreator struct {
+	mu       sync.RWMutex
+	delegate githubapp.ClientCreator
+}
+
+func NewRotatingClientCreator(delegate githubapp.ClientCreator) *RotatingClientCreator {
+	return &RotatingClientCreator{delegate: delegate}
+}
+
+// Set replaces the delegate for new clients.
+func (c *RotatingClientCreator) Set(delegate githubapp.ClientCreator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delegate = delegate
+}
+
+func (c *RotatingClientCreator) get() githubapp.ClientCreator {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.delegate
+}
+
+func (c *RotatingClientCreator) NewAppClient() (*github.Client, error) {
+	return c.get().NewAppClient()
+}
+
+func (c *RotatingClientCreator) NewAppV4Client() (*githubv4.Client, error) {
+	return c.get().NewAppV4Client()
+}
+
+func (c *RotatingClientCreator) NewInstallationClient(installationID int64) (*github.Client, error) {
+	return c.get().NewInstallationClient(installationID)
+}
+
+func (c *RotatingClientCreator) NewInstallationV4Client(installationID int64) (*githubv4.Client, error) {
+	return c.get().NewInstallationV4Client(installationID)
+}
+
+func (c *RotatingClientCreator) NewTokenClient(token string) (*github.Client, error) {
+	return c.get().NewTokenClient(token)
+}
+
+func (c *RotatingClientCreator) NewTokenV4Client(token string) (*githubv4.Client, error) {
+	return c.get().NewTokenV4Client(token)
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+)
+
+// DefaultRequestTimeout is the maximum duration of a GitHub API request,
+// including reading the response body.
+const DefaultRequestTimeout = 30 * time.Second
+
+// Timeout returns client middleware that cancels requests that take longer
+// than the timeout. The timeout includes reading the response body, so it
+// only ends when the body is closed.
+func Timeout(timeout time.Duration) githubapp.ClientMiddleware {
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+
+			res, err := next.RoundTrip(r.WithContext(ctx))
+			if err != nil || res.Body == nil {
+				cancel()
+				return res, err
+			}
+
+			res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+			return res, nil
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
+
+// cancelBody cancels the request context when the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
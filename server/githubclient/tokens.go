@@ -0,0 +1,238 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultTokenMinValidity   = 5 * time.Minute
+	DefaultTokenRefreshBefore = 15 * time.Minute
+	DefaultTokenIdleTimeout   = 1 * time.Hour
+
+	tokenRefreshInterval = 1 * time.Minute
+)
+
+type TokenCacheConfig struct {
+	// Disabled creates a new installation token for every client.
+	Disabled bool `yaml:"disabled"`
+
+	// MinValidity is the minimum remaining lifetime of a cached token. Tokens
+	// that expire sooner are replaced before use.
+	MinValidity time.Duration `yaml:"min_validity"`
+
+	// RefreshBefore is how long before expiration tokens are refreshed in the
+	// background.
+	RefreshBefore time.Duration `yaml:"refresh_before"`
+
+	// IdleTimeout is how long a token is kept after it was last used. Idle
+	// tokens are not refreshed.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+
+	// RepositoryScoped evaluates pull requests with tokens that can only
+	// access the repository of the pull request.
+	RepositoryScoped bool `yaml:"repository_scoped"`
+}
+
+func (c *TokenCacheConfig) FillDefaults() {
+	if c.MinValidity <= 0 {
+		c.MinValidity = DefaultTokenMinValidity
+	}
+	if c.RefreshBefore <= 0 {
+		c.RefreshBefore = DefaultTokenRefreshBefore
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = DefaultTokenIdleTimeout
+	}
+}
+
+// TokenCache creates installation tokens and reuses them until they are close
+// to expiring. Tokens that are in use are refreshed in the background so that
+// most clients never wait for a new token.
+type TokenCache struct {
+	config    TokenCacheConfig
+	appClient func() (*github.Client, error)
+
+	mu     sync.Mutex
+	tokens map[tokenKey]*cachedToken
+}
+
+// tokenKey identifies a token. The repository is empty for tokens that can
+// access all repositories of the installation.
+type tokenKey struct {
+	installationID int64
+	repo           string
+}
+
+type cachedToken struct {
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	lastUsed  time.Time
+}
+
+// NewTokenCache creates a cache that uses clients returned by appClient to
+// create installation tokens.
+func NewTokenCache(c TokenCacheConfig, appClient func() (*github.Client, error)) *TokenCache {
+	c.FillDefaults()
+	return &TokenCache{
+		config:    c,
+		appClient: appClient,
+		tokens:    make(map[tokenKey]*cachedToken),
+	}
+}
+
+// Token returns a token for the installation that is valid for at least the
+// configured minimum validity.
+func (c *TokenCache) Token(ctx context.Context, installationID int64) (string, error) {
+	return c.token(ctx, tokenKey{installationID: installationID})
+}
+
+// RepositoryToken returns a token for the installation that can only access
+// one repository.
+func (c *TokenCache) RepositoryToken(ctx context.Context, installationID int64, repo string) (string, error) {
+	return c.token(ctx, tokenKey{installationID: installationID, repo: repo})
+}
+
+func (c *TokenCache) token(ctx context.Context, key tokenKey) (string, error) {
+	c.mu.Lock()
+	t, ok := c.tokens[key]
+	if !ok {
+		t = &cachedToken{}
+		c.tokens[key] = t
+	}
+	c.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastUsed = time.Now()
+	if time.Until(t.expiresAt) < c.config.MinValidity {
+		if err := c.refresh(ctx, key, t); err != nil {
+			return "", err
+		}
+	}
+	return t.token, nil
+}
+
+// Invalidate removes the tokens for an installation, for example because the
+// installation was deleted or its permissions changed.
+func (c *TokenCache) Invalidate(installationID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.tokens {
+		if key.installationID == installationID {
+			delete(c.tokens, key)
+		}
+	}
+}
+
+// Start refreshes tokens in the background until the context is canceled.
+func (c *TokenCache) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(tokenRefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.refreshAll(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (c *TokenCache) refreshAll(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+
+	c.mu.Lock()
+	tokens := make(map[tokenKey]*cachedToken, len(c.tokens))
+	for key, t := range c.tokens {
+		tokens[key] = t
+	}
+	c.mu.Unlock()
+
+	for key, t := range tokens {
+		t.mu.Lock()
+		switch {
+		case time.Since(t.lastUsed) > c.config.IdleTimeout:
+			c.mu.Lock()
+			if c.tokens[key] == t {
+				delete(c.tokens, key)
+			}
+			c.mu.Unlock()
+
+		case time.Until(t.expiresAt) < c.config.RefreshBefore:
+			if err := c.refresh(ctx, key, t); err != nil {
+				logger.Warn().Err(err).Msgf("Failed to refresh token for installation %d", key.installationID)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// refresh creates a new token. The caller must hold the token's lock.
+func (c *TokenCache) refresh(ctx context.Context, key tokenKey, t *cachedToken) error {
+	client, err := c.appClient()
+	if err != nil {
+		return errors.Wrap(err, "failed to create app client")
+	}
+
+	token, err := createToken(ctx, client, key.installationID, key.repo)
+	if err != nil {
+		return err
+	}
+
+	t.token = token.GetToken()
+	t.expiresAt = token.GetExpiresAt()
+	return nil
+}
+
+// createToken creates an installation token. If repo is not empty, the token
+// can only access that repository of the installation.
+func createToken(ctx context.Context, client *github.Client, installationID int64, repo string) (*github.InstallationToken, error) {
+	if repo == "" {
+		token, _, err := client.Apps.CreateInstallationToken(ctx, installationID)
+		return token, errors.Wrapf(err, "failed to create token for installation %d", installationID)
+	}
+
+	body := struct {
+		Repositories []string `json:"repositories"`
+	}{
+		Repositories: []string{repo},
+	}
+
+	req, err := client.NewRequest("POST", fmt.Sprintf("installations/%d/access_tokens", installationID), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create token request")
+	}
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+
+	token := new(github.InstallationToken)
+	if _, err := client.Do(ctx, req, token); err != nil {
+		return nil, errors.Wrapf(err, "failed to create token for repository %q of installation %d", repo, installationID)
+	}
+	return token, nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package googleauth gets access tokens for Google Cloud APIs.
+package googleauth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// NewTokenSource returns a TokenSource for the given scope. If
+// credentialsFile is empty, the file named by the
+// GOOGLE_APPLICATION_CREDENTIALS environment variable is used, or if that is
+// unset, the service account of the Compute Engine metadata server.
+func NewTokenSource(client *http.Client, scope, credentialsFile string) (*TokenSource, error) {
+	path := credentialsFile
+	if path == "" {
+		path = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+
+	tokens := &TokenSource{client: client, scope: scope}
+	if path != "" {
+		if err := tokens.loadServiceAccount(path); err != nil {
+			return nil, err
+		}
+	}
+	return tokens, nil
+}
+
+// TokenSource gets OAuth2 access tokens for a service account, either from
+// a key file or from the metadata server.
+type TokenSource struct {
+	client *http.Client
+	scope  string
+
+	email    string
+	key      interface{}
+	tokenURI string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (s *TokenSource) loadServiceAccount(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read Google credentials")
+	}
+
+	var account struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(b, &account); err != nil {
+		return errors.Wrap(err, "failed to parse Google credentials")
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return errors.Wrap(err, "failed to parse Google service account key")
+	}
+
+	s.email = account.ClientEmail
+	s.key = key
+	s.tokenURI = account.TokenURI
+	if s.tokenURI == "" {
+		s.tokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return nil
+}
+
+// Token returns a cached access token, getting a new one if it is close to
+// expiring.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Until(s.expires) > time.Minute {
+		return s.token, nil
+	}
+
+	var req *http.Request
+	var err error
+	if s.key != nil {
+		req, err = s.serviceAccountRequest()
+	} else {
+		req, err = http.NewRequest(http.MethodGet, metadataTokenURL, nil)
+		if req != nil {
+			req.Header.Set("Metadata-Flavor", "Google")
+		}
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create Google token request")
+	}
+
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get Google access token")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return "", errors.Errorf("Google token endpoint returned status %d", res.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", errors.Wrap(err, "failed to parse Google access token")
+	}
+
+	s.token = token.AccessToken
+	s.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+func (s *TokenSource) serviceAccountRequest() (*http.Request, error) {
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.email,
+		"scope": s.scope,
+		"aud":   s.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(s.key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign token assertion")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequest(http.MethodPost, s.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
@@ -0,0 +1,321 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vektah/gqlparser/ast"
+	"github.com/vektah/gqlparser/parser"
+)
+
+// object is a value with fields that can be selected in a query.
+type object interface {
+	typeName() string
+	resolve(field string, args arguments) (interface{}, error)
+}
+
+// Error is an error in a GraphQL response.
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Response is the result of executing a query.
+type Response struct {
+	Data   interface{} `json:"data"`
+	Errors []Error     `json:"errors,omitempty"`
+}
+
+type executor struct {
+	doc  *ast.QueryDocument
+	vars map[string]interface{}
+	errs []Error
+}
+
+// execute runs a query against the root object. It implements the subset of
+// GraphQL needed by the API: fields, aliases, arguments, variables,
+// fragments, and the skip and include directives. Queries are not validated
+// against the schema before execution; invalid selections fail as they are
+// executed. Fragment cycles are rejected before execution.
+func execute(root object, query, operationName string, vars map[string]interface{}) *Response {
+	doc, gerr := parser.ParseQuery(&ast.Source{Name: "query", Input: query})
+	if gerr != nil {
+		return &Response{Errors: []Error{{Message: gerr.Message}}}
+	}
+
+	if err := checkFragmentCycles(doc); err != nil {
+		return &Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	op, err := selectOperation(doc, operationName)
+	if err != nil {
+		return &Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	if vars == nil {
+		vars = make(map[string]interface{})
+	}
+	for _, vd := range op.VariableDefinitions {
+		if _, ok := vars[vd.Variable]; !ok && vd.DefaultValue != nil {
+			v, err := vd.DefaultValue.Value(nil)
+			if err != nil {
+				return &Response{Errors: []Error{{Message: fmt.Sprintf("invalid default value for $%s: %v", vd.Variable, err)}}}
+			}
+			vars[vd.Variable] = v
+		}
+	}
+
+	e := &executor{doc: doc, vars: vars}
+	data := e.selectionSet(root, op.SelectionSet, nil)
+	return &Response{Data: data, Errors: e.errs}
+}
+
+func selectOperation(doc *ast.QueryDocument, name string) (*ast.OperationDefinition, error) {
+	var op *ast.OperationDefinition
+	switch {
+	case name != "":
+		if op = doc.Operations.ForName(name); op == nil {
+			return nil, fmt.Errorf("unknown operation %q", name)
+		}
+	case len(doc.Operations) == 1:
+		op = doc.Operations[0]
+	case len(doc.Operations) == 0:
+		return nil, fmt.Errorf("no operation found in query")
+	default:
+		return nil, fmt.Errorf("operation name is required when the query contains multiple operations")
+	}
+
+	if op.Operation != ast.Query {
+		return nil, fmt.Errorf("unsupported operation %q: only queries are supported", op.Operation)
+	}
+	return op, nil
+}
+
+// checkFragmentCycles returns an error if a fragment spreads itself, directly
+// or through other fragments. Executing such a fragment would never finish.
+func checkFragmentCycles(doc *ast.QueryDocument) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+
+	var visitSet func(set ast.SelectionSet) error
+	visitFragment := func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("cannot spread fragment %q within itself", name)
+		case done:
+			return nil
+		}
+		f := doc.Fragments.ForName(name)
+		if f == nil {
+			// unknown fragments are reported during execution
+			return nil
+		}
+		state[name] = visiting
+		if err := visitSet(f.SelectionSet); err != nil {
+			return err
+		}
+		state[name] = done
+		return nil
+	}
+	visitSet = func(set ast.SelectionSet) error {
+		for _, sel := range set {
+			var err error
+			switch s := sel.(type) {
+			case *ast.Field:
+				err = visitSet(s.SelectionSet)
+			case *ast.InlineFragment:
+				err = visitSet(s.SelectionSet)
+			case *ast.FragmentSpread:
+				err = visitFragment(s.Name)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, f := range doc.Fragments {
+		if err := visitFragment(f.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *executor) fail(path []interface{}, format string, args ...interface{}) {
+	e.errs = append(e.errs, Error{
+		Message: fmt.Sprintf(format, args...),
+		Path:    append([]interface{}(nil), path...),
+	})
+}
+
+func (e *executor) selectionSet(obj object, set ast.SelectionSet, path []interface{}) *orderedMap {
+	out := &orderedMap{values: make(map[string]interface{})}
+	e.collect(obj, set, path, out)
+	return out
+}
+
+func (e *executor) collect(obj object, set ast.SelectionSet, path []interface{}, out *orderedMap) {
+	for _, sel := range set {
+		switch s := sel.(type) {
+		case *ast.Field:
+			if !e.included(s.Directives) {
+				continue
+			}
+			key := s.Alias
+			if key == "" {
+				key = s.Name
+			}
+			out.set(key, e.field(obj, s, append(path, key)))
+
+		case *ast.FragmentSpread:
+			if !e.included(s.Directives) {
+				continue
+			}
+			f := e.doc.Fragments.ForName(s.Name)
+			if f == nil {
+				e.fail(path, "unknown fragment %q", s.Name)
+				continue
+			}
+			if f.TypeCondition == obj.typeName() {
+				e.collect(obj, f.SelectionSet, path, out)
+			}
+
+		case *ast.InlineFragment:
+			if !e.included(s.Directives) {
+				continue
+			}
+			if s.TypeCondition == "" || s.TypeCondition == obj.typeName() {
+				e.collect(obj, s.SelectionSet, path, out)
+			}
+		}
+	}
+}
+
+func (e *executor) included(directives ast.DirectiveList) bool {
+	for _, d := range directives {
+		if d.Name != "skip" && d.Name != "include" {
+			continue
+		}
+		arg := d.Arguments.ForName("if")
+		if arg == nil {
+			continue
+		}
+		v, _ := arg.Value.Value(e.vars)
+		if b, _ := v.(bool); b == (d.Name == "skip") {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *executor) field(obj object, f *ast.Field, path []interface{}) interface{} {
+	if f.Name == "__typename" {
+		return obj.typeName()
+	}
+
+	args := make(arguments, len(f.Arguments))
+	for _, a := range f.Arguments {
+		v, err := a.Value.Value(e.vars)
+		if err != nil {
+			e.fail(path, "invalid value for argument %q: %v", a.Name, err)
+			return nil
+		}
+		args[a.Name] = v
+	}
+
+	v, err := obj.resolve(f.Name, args)
+	if err == errUnknownField {
+		e.fail(path, "cannot query field %q on type %q", f.Name, obj.typeName())
+		return nil
+	}
+	if err != nil {
+		e.fail(path, "%v", err)
+		return nil
+	}
+	return e.complete(f, v, path)
+}
+
+func (e *executor) complete(f *ast.Field, v interface{}, path []interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case object:
+		if len(f.SelectionSet) == 0 {
+			e.fail(path, "field %q of type %q must have a selection of subfields", f.Name, v.typeName())
+			return nil
+		}
+		return e.selectionSet(v, f.SelectionSet, path)
+	case []object:
+		if len(f.SelectionSet) == 0 {
+			e.fail(path, "field %q must have a selection of subfields", f.Name)
+			return nil
+		}
+		list := make([]interface{}, len(v))
+		for i, o := range v {
+			list[i] = e.complete(f, o, append(path, i))
+		}
+		return list
+	default:
+		if len(f.SelectionSet) > 0 {
+			e.fail(path, "field %q must not have a selection since it is a scalar", f.Name)
+			return nil
+		}
+		return v
+	}
+}
+
+// orderedMap is a JSON object that keeps the order of the selected fields.
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (m *orderedMap) set(key string, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(m.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
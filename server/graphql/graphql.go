@@ -0,0 +1,228 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graphql serves a GraphQL API for querying the latest evaluation of
+// pull requests across repositories, like all pull requests waiting for
+// approval from a team.
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/alexedwards/scs"
+	"github.com/bluekeyes/hatpear"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/server/rbac"
+	"github.com/palantir/policy-bot/server/results"
+)
+
+// Schema describes the types and queries supported by the API.
+const Schema = `
+type Query {
+  # Lists evaluated pull requests that match all of the given filters.
+  pullRequests(
+    owner: String
+    repo: String
+    author: String
+    state: PolicyState
+    # only pull requests with a rule with this name
+    rule: String
+    # only pull requests with a rule in this status; combined with rule if set
+    ruleStatus: RuleStatus
+    # only pull requests with a pending rule that this team can approve
+    pendingTeam: String
+    # only pull requests with a pending rule that this user can approve
+    pendingUser: String
+    # the page size, at most 100
+    first: Int = 50
+    after: String
+  ): PullRequestConnection!
+
+  pullRequest(owner: String!, repo: String!, number: Int!): PullRequest
+}
+
+type PullRequestConnection {
+  totalCount: Int!
+  pageInfo: PageInfo!
+  edges: [PullRequestEdge!]!
+  nodes: [PullRequest!]!
+}
+
+type PullRequestEdge {
+  cursor: String!
+  node: PullRequest!
+}
+
+type PageInfo {
+  hasNextPage: Boolean!
+  endCursor: String
+}
+
+type PullRequest {
+  owner: String!
+  repo: String!
+  number: Int!
+  title: String!
+  author: String!
+  headSHA: String!
+  baseRef: String!
+  state: PolicyState!
+  description: String!
+  # RFC 3339 time of the latest evaluation
+  evaluatedAt: String!
+  detailsURL: String!
+  rules(status: RuleStatus): [Rule!]!
+}
+
+type Rule {
+  name: String!
+  status: RuleStatus!
+  description: String!
+  # the actors who can approve the rule, if it is pending
+  pendingUsers: [String!]!
+  pendingTeams: [String!]!
+  pendingOrganizations: [String!]!
+  pendingGroups: [String!]!
+  pendingApps: [String!]!
+}
+
+enum PolicyState {
+  APPROVED
+  PENDING
+  DISAPPROVED
+  ERROR
+}
+
+enum RuleStatus {
+  APPROVED
+  PENDING
+  SKIPPED
+  DISAPPROVED
+  ERROR
+}
+`
+
+// Handler serves GraphQL queries. POST requests contain a JSON object with
+// the query, operation name, and variables; GET requests with a "query"
+// parameter run the query and GET requests without one return the schema.
+type Handler struct {
+	// Apps are the apps that share the GitHub instance used for login. Read
+	// access to a repository is checked with the first app that is installed
+	// for its owner.
+	Apps []*handler.App
+
+	// Roles, if set, limits the API to users with the viewer role.
+	Roles *rbac.Authorizer
+
+	Results  results.Store
+	Sessions *scs.Manager
+
+	// DetailsURL returns the URL of the details page of a pull request
+	DetailsURL func(owner, repo string, number int) string
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	user, err := h.Sessions.Load(r).GetString(handler.SessionKeyUsername)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+
+	allowed, err := h.Roles.UserAllowed(ctx, user, rbac.RoleViewer)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		http.Error(w, "the GraphQL API requires the viewer role", http.StatusForbidden)
+		return nil
+	}
+
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if req.Query == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, err := w.Write([]byte(Schema))
+			return err
+		}
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				baseapp.WriteJSON(w, http.StatusBadRequest, &Response{Errors: []Error{{Message: "invalid variables: " + err.Error()}}})
+				return nil
+			}
+		}
+
+	default:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			baseapp.WriteJSON(w, http.StatusBadRequest, &Response{Errors: []Error{{Message: "invalid request: " + err.Error()}}})
+			return nil
+		}
+	}
+
+	prs, _, err := h.Results.List(ctx, results.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to list evaluation results")
+	}
+
+	// only return repositories the user can read, checking each one once
+	checkers := make(map[string]*handler.ReadChecker)
+	canRead := func(pr *results.PullRequest) (bool, error) {
+		owner := strings.ToLower(pr.Owner)
+		checker, ok := checkers[owner]
+		if !ok {
+			app, installation, err := handler.FindInstallation(ctx, h.Apps, pr.Owner)
+			switch {
+			case err == nil:
+				client, err := app.Base.NewInstallationClient(installation.ID)
+				if err != nil {
+					return false, errors.Wrap(err, "failed to create github client")
+				}
+				checker = handler.NewReadChecker(client, user)
+			case !isInstallationNotFound(err):
+				return false, err
+			}
+			checkers[owner] = checker
+		}
+		if checker == nil {
+			return false, nil
+		}
+		return checker.CanRead(ctx, pr.Owner, pr.Repo)
+	}
+
+	root := &queryObject{prs: prs, canRead: canRead, detailsURL: h.DetailsURL}
+	baseapp.WriteJSON(w, http.StatusOK, execute(root, req.Query, req.OperationName, req.Variables))
+	return nil
+}
+
+func isInstallationNotFound(err error) bool {
+	_, ok := errors.Cause(err).(githubapp.InstallationNotFound)
+	return ok
+}
+
+var _ hatpear.Handler = &Handler{}
@@ -0,0 +1,429 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/results"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+var errUnknownField = errors.New("unknown field")
+
+// arguments are the arguments of a field, after variables are substituted.
+type arguments map[string]interface{}
+
+func (a arguments) string(name string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", errors.Errorf("argument %q must be a string", name)
+	}
+}
+
+func (a arguments) int(name string, def int) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, errors.Errorf("argument %q must be an integer", name)
+}
+
+// enum returns the lowercase value of an enum argument after checking that
+// it is one of the allowed values.
+func (a arguments) enum(name string, allowed ...string) (string, error) {
+	v, err := a.string(name)
+	if err != nil || v == "" {
+		return "", err
+	}
+	for _, value := range allowed {
+		if v == value {
+			return strings.ToLower(v), nil
+		}
+	}
+	return "", errors.Errorf("argument %q must be one of %s", name, strings.Join(allowed, ", "))
+}
+
+var (
+	policyStates = []string{"APPROVED", "PENDING", "DISAPPROVED", "ERROR"}
+	ruleStatuses = []string{"APPROVED", "PENDING", "SKIPPED", "DISAPPROVED", "ERROR"}
+)
+
+// policyState converts the state of a posted status to a PolicyState.
+func policyState(state string) string {
+	switch state {
+	case "success":
+		return "APPROVED"
+	case "failure":
+		return "DISAPPROVED"
+	default:
+		return strings.ToUpper(state)
+	}
+}
+
+type queryObject struct {
+	prs []results.PullRequest
+
+	// canRead returns true if the requesting user can read the repository of
+	// a pull request. Other pull requests are never returned.
+	canRead func(pr *results.PullRequest) (bool, error)
+
+	detailsURL func(owner, repo string, number int) string
+}
+
+func (q *queryObject) typeName() string { return "Query" }
+
+func (q *queryObject) resolve(field string, args arguments) (interface{}, error) {
+	switch field {
+	case "pullRequests":
+		return q.pullRequests(args)
+	case "pullRequest":
+		owner, err := args.string("owner")
+		if err != nil {
+			return nil, err
+		}
+		repo, err := args.string("repo")
+		if err != nil {
+			return nil, err
+		}
+		number, err := args.int("number", 0)
+		if err != nil {
+			return nil, err
+		}
+		if owner == "" || repo == "" || number <= 0 {
+			return nil, errors.New("owner, repo, and number are required")
+		}
+
+		key := results.Key(owner, repo, number)
+		for i := range q.prs {
+			if results.Key(q.prs[i].Owner, q.prs[i].Repo, q.prs[i].Number) == key {
+				ok, err := q.canRead(&q.prs[i])
+				if err != nil || !ok {
+					return nil, err
+				}
+				return q.pullRequest(&q.prs[i]), nil
+			}
+		}
+		return nil, nil
+	}
+	return nil, errUnknownField
+}
+
+func (q *queryObject) pullRequest(pr *results.PullRequest) *pullRequestObject {
+	return &pullRequestObject{pr: pr, detailsURL: q.detailsURL}
+}
+
+type pullRequestFilter struct {
+	owner, repo, author, state string
+	rule, ruleStatus           string
+	pendingTeam, pendingUser   string
+}
+
+func (f *pullRequestFilter) matches(pr *results.PullRequest) bool {
+	switch {
+	case f.owner != "" && !strings.EqualFold(f.owner, pr.Owner):
+		return false
+	case f.repo != "" && !strings.EqualFold(f.repo, pr.Repo):
+		return false
+	case f.author != "" && !strings.EqualFold(f.author, pr.Author):
+		return false
+	case f.state != "" && !strings.EqualFold(f.state, policyState(pr.State)):
+		return false
+	}
+
+	if f.rule == "" && f.ruleStatus == "" && f.pendingTeam == "" && f.pendingUser == "" {
+		return true
+	}
+
+	for _, r := range pr.Rules {
+		if f.rule != "" && r.Name != f.rule {
+			continue
+		}
+		if f.ruleStatus != "" && r.Status != f.ruleStatus {
+			continue
+		}
+		if f.pendingTeam != "" && (r.Pending == nil || !containsFold(r.Pending.Teams, f.pendingTeam)) {
+			continue
+		}
+		if f.pendingUser != "" && (r.Pending == nil || !containsFold(r.Pending.Users, f.pendingUser)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (q *queryObject) pullRequests(args arguments) (interface{}, error) {
+	var f pullRequestFilter
+	var err error
+	for name, v := range map[string]*string{
+		"owner":       &f.owner,
+		"repo":        &f.repo,
+		"author":      &f.author,
+		"rule":        &f.rule,
+		"pendingTeam": &f.pendingTeam,
+		"pendingUser": &f.pendingUser,
+	} {
+		if *v, err = args.string(name); err != nil {
+			return nil, err
+		}
+	}
+	if f.state, err = args.enum("state", policyStates...); err != nil {
+		return nil, err
+	}
+	if f.ruleStatus, err = args.enum("ruleStatus", ruleStatuses...); err != nil {
+		return nil, err
+	}
+
+	first, err := args.int("first", defaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	if first < 0 || first > maxPageSize {
+		return nil, errors.Errorf("argument \"first\" must be between 0 and %d", maxPageSize)
+	}
+
+	after, err := args.string("after")
+	if err != nil {
+		return nil, err
+	}
+	var afterKey string
+	if after != "" {
+		b, err := base64.StdEncoding.DecodeString(after)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		afterKey = string(b)
+	}
+
+	var matches []*results.PullRequest
+	for i := range q.prs {
+		if !f.matches(&q.prs[i]) {
+			continue
+		}
+		ok, err := q.canRead(&q.prs[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, &q.prs[i])
+		}
+	}
+
+	start := 0
+	if afterKey != "" {
+		start = len(matches)
+		for i, pr := range matches {
+			if results.Key(pr.Owner, pr.Repo, pr.Number) == afterKey {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	end := start + first
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	conn := &connectionObject{total: len(matches), hasNext: end < len(matches)}
+	for _, pr := range matches[start:end] {
+		conn.nodes = append(conn.nodes, q.pullRequest(pr))
+	}
+	return conn, nil
+}
+
+type connectionObject struct {
+	total   int
+	hasNext bool
+	nodes   []*pullRequestObject
+}
+
+func (c *connectionObject) typeName() string { return "PullRequestConnection" }
+
+func (c *connectionObject) resolve(field string, args arguments) (interface{}, error) {
+	switch field {
+	case "totalCount":
+		return c.total, nil
+	case "pageInfo":
+		return &pageInfoObject{conn: c}, nil
+	case "nodes":
+		nodes := make([]object, len(c.nodes))
+		for i, n := range c.nodes {
+			nodes[i] = n
+		}
+		return nodes, nil
+	case "edges":
+		edges := make([]object, len(c.nodes))
+		for i, n := range c.nodes {
+			edges[i] = &edgeObject{node: n}
+		}
+		return edges, nil
+	}
+	return nil, errUnknownField
+}
+
+type pageInfoObject struct {
+	conn *connectionObject
+}
+
+func (p *pageInfoObject) typeName() string { return "PageInfo" }
+
+func (p *pageInfoObject) resolve(field string, args arguments) (interface{}, error) {
+	switch field {
+	case "hasNextPage":
+		return p.conn.hasNext, nil
+	case "endCursor":
+		if len(p.conn.nodes) == 0 {
+			return nil, nil
+		}
+		return p.conn.nodes[len(p.conn.nodes)-1].cursor(), nil
+	}
+	return nil, errUnknownField
+}
+
+type edgeObject struct {
+	node *pullRequestObject
+}
+
+func (e *edgeObject) typeName() string { return "PullRequestEdge" }
+
+func (e *edgeObject) resolve(field string, args arguments) (interface{}, error) {
+	switch field {
+	case "cursor":
+		return e.node.cursor(), nil
+	case "node":
+		return e.node, nil
+	}
+	return nil, errUnknownField
+}
+
+type pullRequestObject struct {
+	pr         *results.PullRequest
+	detailsURL func(owner, repo string, number int) string
+}
+
+func (p *pullRequestObject) typeName() string { return "PullRequest" }
+
+func (p *pullRequestObject) cursor() string {
+	return base64.StdEncoding.EncodeToString([]byte(results.Key(p.pr.Owner, p.pr.Repo, p.pr.Number)))
+}
+
+func (p *pullRequestObject) resolve(field string, args arguments) (interface{}, error) {
+	pr := p.pr
+	switch field {
+	case "owner":
+		return pr.Owner, nil
+	case "repo":
+		return pr.Repo, nil
+	case "number":
+		return pr.Number, nil
+	case "title":
+		return pr.Title, nil
+	case "author":
+		return pr.Author, nil
+	case "headSHA":
+		return pr.HeadSHA, nil
+	case "baseRef":
+		return pr.BaseRef, nil
+	case "state":
+		return policyState(pr.State), nil
+	case "description":
+		return pr.Description, nil
+	case "evaluatedAt":
+		return pr.EvaluatedAt.UTC().Format(time.RFC3339), nil
+	case "detailsURL":
+		if p.detailsURL == nil {
+			return "", nil
+		}
+		return p.detailsURL(pr.Owner, pr.Repo, pr.Number), nil
+	case "rules":
+		status, err := args.enum("status", ruleStatuses...)
+		if err != nil {
+			return nil, err
+		}
+		rules := make([]object, 0, len(pr.Rules))
+		for i := range pr.Rules {
+			if status == "" || pr.Rules[i].Status == status {
+				rules = append(rules, &ruleObject{rule: &pr.Rules[i]})
+			}
+		}
+		return rules, nil
+	}
+	return nil, errUnknownField
+}
+
+type ruleObject struct {
+	rule *results.Rule
+}
+
+func (r *ruleObject) typeName() string { return "Rule" }
+
+func (r *ruleObject) resolve(field string, args arguments) (interface{}, error) {
+	rule := r.rule
+	switch field {
+	case "name":
+		return rule.Name, nil
+	case "status":
+		return strings.ToUpper(rule.Status), nil
+	case "description":
+		return rule.Description, nil
+	case "pendingUsers", "pendingTeams", "pendingOrganizations", "pendingGroups", "pendingApps":
+		values := []string{}
+		if rule.Pending != nil {
+			switch field {
+			case "pendingUsers":
+				values = append(values, rule.Pending.Users...)
+			case "pendingTeams":
+				values = append(values, rule.Pending.Teams...)
+			case "pendingOrganizations":
+				values = append(values, rule.Pending.Organizations...)
+			case "pendingGroups":
+				values = append(values, rule.Pending.Groups...)
+			case "pendingApps":
+				values = append(values, rule.Pending.Apps...)
+			}
+		}
+		return values, nil
+	}
+	return nil, errUnknownField
+}
+
+func containsFold(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/server/results"
+)
+
+func TestQueryOnlyReadableRepositories(t *testing.T) {
+	root := &queryObject{
+		prs: []results.PullRequest{
+			{Owner: "palantir", Repo: "public", Number: 1, State: "pending"},
+			{Owner: "palantir", Repo: "private", Number: 2, State: "pending"},
+			{Owner: "palantir", Repo: "public", Number: 3, State: "success"},
+		},
+		canRead: func(pr *results.PullRequest) (bool, error) {
+			return pr.Repo == "public", nil
+		},
+		detailsURL: func(owner, repo string, number int) string { return "" },
+	}
+
+	run := func(query string) string {
+		res := execute(root, query, "", nil)
+		require.Empty(t, res.Errors)
+		b, err := json.Marshal(res.Data)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	assert.JSONEq(t,
+		`{"pullRequests": {"totalCount": 2, "nodes": [{"number": 1}, {"number": 3}]}}`,
+		run(`{ pullRequests { totalCount nodes { number } } }`),
+	)
+	assert.JSONEq(t,
+		`{"pullRequests": {"totalCount": 1, "nodes": [{"number": 1}]}}`,
+		run(`{ pullRequests(state: PENDING) { totalCount nodes { number } } }`),
+	)
+	assert.JSONEq(t,
+		`{"private": null, "public": {"number": 1}}`,
+		run(`{ private: pullRequest(owner: "palantir", repo: "private", number: 2) { number } public: pullRequest(owner: "palantir", repo: "public", number: 1) { number } }`),
+	)
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// AdminEvaluate provides admin routes that force evaluation of a pull
+// request, all open pull requests in a repository, or all open pull requests
+// in an installation. Requests use the first app that is installed for the
+// owner.
+type AdminEvaluate struct {
+	Apps []*App
+}
+
+type adminEvaluateResponse struct {
+	Status string `json:"status"`
+	Queued int    `json:"queued,omitempty"`
+}
+
+func (h *AdminEvaluate) PullRequest(w http.ResponseWriter, r *http.Request) error {
+	owner := pat.Param(r, "owner")
+	repo := pat.Param(r, "repo")
+
+	number, err := strconv.Atoi(pat.Param(r, "number"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid pull request number: %v", err), http.StatusBadRequest)
+		return nil
+	}
+
+	app, installation, ok, err := h.getInstallation(w, r, owner)
+	if !ok {
+		return err
+	}
+
+	if !app.Queue.Enqueue(installation.ID, pull.Locator{Owner: owner, Repo: repo, Number: number}) {
+		http.Error(w, "evaluation queue is full", http.StatusServiceUnavailable)
+		return nil
+	}
+
+	baseapp.WriteJSON(w, http.StatusAccepted, &adminEvaluateResponse{Status: "queued", Queued: 1})
+	return nil
+}
+
+func (h *AdminEvaluate) Repository(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	owner := pat.Param(r, "owner")
+	repo := pat.Param(r, "repo")
+
+	app, installation, ok, err := h.getInstallation(w, r, owner)
+	if !ok {
+		return err
+	}
+
+	client, err := app.Base.NewInstallationClient(installation.ID)
+	if err != nil {
+		return err
+	}
+
+	queued, err := app.Queue.EnqueueOpenPullRequests(ctx, client, installation.ID, owner, repo)
+	if err != nil {
+		return err
+	}
+
+	baseapp.WriteJSON(w, http.StatusAccepted, &adminEvaluateResponse{Status: "queued", Queued: queued})
+	return nil
+}
+
+func (h *AdminEvaluate) Installation(w http.ResponseWriter, r *http.Request) error {
+	owner := pat.Param(r, "owner")
+
+	app, installation, ok, err := h.getInstallation(w, r, owner)
+	if !ok {
+		return err
+	}
+
+	// listing every repository can take a while, so do it in the background
+	logger := *zerolog.Ctx(r.Context())
+	go func() {
+		ctx := logger.WithContext(context.Background())
+		if err := h.enqueueInstallation(ctx, app, installation.ID); err != nil {
+			logger.Error().Err(err).Msgf("Failed to queue evaluations for installation %d", installation.ID)
+		}
+	}()
+
+	baseapp.WriteJSON(w, http.StatusAccepted, &adminEvaluateResponse{Status: "scheduled"})
+	return nil
+}
+
+func (h *AdminEvaluate) enqueueInstallation(ctx context.Context, app *App, installationID int64) error {
+	logger := zerolog.Ctx(ctx)
+
+	client, err := app.Base.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	repos, err := listInstallationRepositories(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, repo := range repos {
+		queued, err := app.Queue.EnqueueOpenPullRequests(ctx, client, installationID, repo.GetOwner().GetLogin(), repo.GetName())
+		if err != nil {
+			return err
+		}
+		total += queued
+	}
+
+	logger.Info().Msgf("Queued %d pull requests in %d repositories for installation %d", total, len(repos), installationID)
+	return nil
+}
+
+// getInstallation returns the app and installation for owner. If no app is
+// installed, it writes a response and returns false with a nil error.
+func (h *AdminEvaluate) getInstallation(w http.ResponseWriter, r *http.Request, owner string) (*App, githubapp.Installation, bool, error) {
+	app, installation, err := FindInstallation(r.Context(), h.Apps, owner)
+	if err != nil {
+		if _, notFound := errors.Cause(err).(githubapp.InstallationNotFound); notFound {
+			http.Error(w, fmt.Sprintf("not found: %s", owner), http.StatusNotFound)
+			return nil, installation, false, nil
+		}
+		return nil, installation, false, err
+	}
+	return app, installation, true, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+)
+
+// App is one of the GitHub Apps served by this server.
+type App struct {
+	// Name identifies the app in logs and routes. It is empty for the
+	// primary app.
+	Name string
+
+	Base  *Base
+	Queue *EvaluationQueue
+}
+
+// FindInstallation returns the first app that is installed for owner and the
+// corresponding installation. If no app is installed, it returns an error
+// with a githubapp.InstallationNotFound cause.
+func FindInstallation(ctx context.Context, apps []*App, owner string) (*App, githubapp.Installation, error) {
+	for _, app := range apps {
+		installation, err := app.Base.Installations.GetByOwner(ctx, owner)
+		if err == nil {
+			return app, installation, nil
+		}
+		if _, notFound := errors.Cause(err).(githubapp.InstallationNotFound); !notFound {
+			return nil, installation, err
+		}
+	}
+	return nil, githubapp.Installation{}, githubapp.InstallationNotFound(owner)
+}
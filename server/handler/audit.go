@@ -14,6 +14,57 @@
 
 package handler
 
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/audit"
+)
+
 const (
 	LogKeyAudit string = "audit"
 )
+
+// audit writes a record of an evaluation to the audit sink and the publisher,
+// if configured. Failures are logged but do not fail the evaluation.
+func (b *Base) audit(ctx context.Context, prctx pull.Context, fc FetchedConfig, result *common.Result, state, description string, duration time.Duration) {
+	if b.Audit == nil && b.Publisher == nil {
+		return
+	}
+
+	base, _ := prctx.Branches()
+	record := &audit.Record{
+		Time:           time.Now(),
+		Owner:          prctx.RepositoryOwner(),
+		Repo:           prctx.RepositoryName(),
+		Number:         prctx.Number(),
+		HeadSHA:        prctx.HeadSHA(),
+		BaseRef:        base,
+		Author:         prctx.Author(),
+		PolicyRef:      fc.Ref,
+		PolicyPath:     fc.Path,
+		PolicyHash:     fc.Hash,
+		State:          state,
+		Description:    description,
+		Result:         audit.NewResult(result),
+		DurationMillis: int64(duration / time.Millisecond),
+	}
+	if fc.Error != nil {
+		record.Error = fc.Error.Error()
+	}
+
+	if b.Audit != nil {
+		if err := b.Audit.Write(ctx, record); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to write audit record")
+		}
+	}
+	if b.Publisher != nil {
+		if err := b.Publisher.Write(ctx, record); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to publish evaluation record")
+		}
+	}
+}
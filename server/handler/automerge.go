@@ -0,0 +1,184 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// TryAutoMerge merges a pull request if its policy enables auto-merge and
+// the pull request is ready. Use it when something other than an evaluation,
+// like another status or a label, may have made the pull request ready.
+func (b *Base) TryAutoMerge(ctx context.Context, installationID int64, loc pull.Locator) error {
+	client, err := b.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	v4client, err := b.NewInstallationV4Client(installationID)
+	if err != nil {
+		return err
+	}
+
+	prctx, err := b.NewPullContext(ctx, client, v4client, loc)
+	if err != nil {
+		return err
+	}
+
+	fetchedConfig, err := b.ConfigFetcher.ConfigForPR(ctx, prctx, client)
+	if err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("failed to fetch policy: %s", fetchedConfig))
+	}
+	return b.autoMerge(ctx, prctx, client, fetchedConfig)
+}
+
+// autoMerge merges a pull request if the policy enables auto-merge, the pull
+// request is open and has the required label, and all statuses and checks on
+// the head commit, including the policy status, succeeded.
+func (b *Base) autoMerge(ctx context.Context, prctx pull.Context, client *github.Client, fetchedConfig FetchedConfig) error {
+	if !fetchedConfig.Valid() || fetchedConfig.Config.AutoMerge == nil {
+		return nil
+	}
+
+	logger := zerolog.Ctx(ctx)
+	config := fetchedConfig.Config.AutoMerge
+	owner, repo, number := prctx.RepositoryOwner(), prctx.RepositoryName(), prctx.Number()
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return errors.Wrap(err, "failed to get pull request")
+	}
+	if pr.GetState() != "open" || pr.GetMerged() {
+		return nil
+	}
+	if config.Label != "" && !hasLabel(pr, config.Label) {
+		logger.Debug().Msgf("Not merging: pull request does not have the %q label", config.Label)
+		return nil
+	}
+
+	sha := pr.GetHead().GetSHA()
+	ready, reason, err := b.readyToMerge(ctx, client, owner, repo, pr.GetBase().GetRef(), sha)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		logger.Debug().Msgf("Not merging: %s", reason)
+		return nil
+	}
+
+	method := config.Method
+	if method == "" {
+		method = policy.MergeMethodMerge
+	}
+
+	logger.Info().Msgf("Merging pull request with method %q", method)
+	_, _, err = client.PullRequests.Merge(ctx, owner, repo, number, "", &github.PullRequestOptions{
+		SHA:         sha,
+		MergeMethod: method,
+	})
+	return errors.Wrap(err, "failed to merge pull request")
+}
+
+// readyToMerge returns true if the policy status and all other statuses and
+// check runs on the commit succeeded. If not, it returns a reason.
+func (b *Base) readyToMerge(ctx context.Context, client *github.Client, owner, repo, base, sha string) (bool, string, error) {
+	state, _, err := b.policyState(ctx, client, owner, repo, base, sha)
+	if err != nil {
+		return false, "", err
+	}
+	if state != "success" {
+		return false, "the policy is not approved", nil
+	}
+
+	// when the policy posts a check run, the commit may have no statuses,
+	// which GitHub reports as a pending combined status
+	status, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, sha, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to get statuses")
+	}
+	if status.GetTotalCount() > 0 && status.GetState() != "success" {
+		return false, fmt.Sprintf("the combined status is %s", status.GetState()), nil
+	}
+
+	opt := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runs, res, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, opt)
+		if err != nil {
+			return false, "", errors.Wrap(err, "failed to list check runs")
+		}
+		for _, run := range runs.CheckRuns {
+			if run.GetStatus() != "completed" {
+				return false, fmt.Sprintf("check %q is %s", run.GetName(), run.GetStatus()), nil
+			}
+			if !checkSucceeded(run.GetConclusion()) {
+				return false, fmt.Sprintf("check %q concluded with %s", run.GetName(), run.GetConclusion()), nil
+			}
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+	return true, "", nil
+}
+
+// checkSucceeded returns true if a check run or check suite with a conclusion
+// does not prevent merging.
+func checkSucceeded(conclusion string) bool {
+	switch conclusion {
+	case "success", "neutral", "skipped":
+		return true
+	}
+	return false
+}
+
+// tryAutoMergeCommit tries to merge the pull requests whose head is a commit
+// after a status or check on the commit succeeded, which may have been the
+// last requirement for merging. Errors are logged so that one pull request
+// does not prevent merging the others.
+func (b *Base) tryAutoMergeCommit(ctx context.Context, installationID int64, owner, repo, sha string, prs []*github.PullRequest) {
+	for _, pr := range prs {
+		if pr.GetHead().GetSHA() != sha {
+			continue
+		}
+		prCtx, logger := b.PreparePRContext(ctx, installationID, pr)
+		if err := b.TryAutoMerge(prCtx, installationID, pull.Locator{
+			Owner:  owner,
+			Repo:   repo,
+			Number: pr.GetNumber(),
+			Value:  pr,
+		}); err != nil {
+			logger.Error().Err(err).Msgf("Failed to auto-merge pull request #%d", pr.GetNumber())
+		}
+	}
+}
+
+func hasLabel(pr *github.PullRequest, name string) bool {
+	for _, l := range pr.Labels {
+		if strings.EqualFold(l.GetName(), name) {
+			return true
+		}
+	}
+	return false
+}
@@ -17,25 +17,47 @@ package handler
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/palantir/go-baseapp/baseapp"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"github.com/shurcooL/githubv4"
 
 	"github.com/palantir/policy-bot/policy"
 	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/audit"
+	"github.com/palantir/policy-bot/server/errorreport"
+	"github.com/palantir/policy-bot/server/evalcache"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/palantir/policy-bot/server/incomplete"
+	"github.com/palantir/policy-bot/server/lock"
+	"github.com/palantir/policy-bot/server/membership"
+	"github.com/palantir/policy-bot/server/messages"
+	"github.com/palantir/policy-bot/server/notify"
+	"github.com/palantir/policy-bot/server/ratelimit"
+	"github.com/palantir/policy-bot/server/results"
+	"github.com/palantir/policy-bot/server/tracing"
 )
 
 const (
 	DefaultPolicyPath         = ".policy.yml"
 	DefaultStatusCheckContext = "policy-bot"
 	DefaultAppName            = "policy-bot"
+	DefaultRuleConcurrency    = 4
 
 	LogKeyGitHubSHA = "github_sha"
+
+	// MaxHeadChanges is the number of times an evaluation restarts because
+	// the head of the pull request changed
+	MaxHeadChanges = 3
+
+	DefaultEvaluationTimeout = 5 * time.Minute
 )
 
 type Base struct {
@@ -45,6 +67,46 @@ type Base struct {
 	PullOpts      *PullEvaluationOptions
 	ConfigFetcher *ConfigFetcher
 	BaseConfig    *baseapp.HTTPConfig
+	Locker        lock.Locker
+	Sequencer     lock.Sequencer
+	Audit         audit.Sink
+	Metrics       *Metrics
+	Notifier      *notify.Notifier
+	Groups        *membership.Providers
+	Errors        errorreport.Reporter
+	Results       results.Store
+	History       history.Store
+	Outcomes      evalcache.Cache
+
+	// PendingRules, if set, remembers the pending rules of each pull request
+	// so that reviewers are requested when rules become pending. If nil,
+	// reviewers are only requested when a pull request is opened.
+	PendingRules notify.StateStore
+
+	// Publisher, if set, publishes the audit record of each evaluation after
+	// it is written to Audit. Publish failures are reported separately and
+	// do not affect the audit log. Writes should not wait for the message
+	// bus, so that a slow bus does not delay evaluations.
+	Publisher audit.Sink
+
+	// Compliance, if set, collects the data for compliance reports
+	Compliance ComplianceRecorder
+
+	// Messages formats user-facing text. If nil, the default messages are
+	// used.
+	Messages *messages.Catalog
+
+	// Queue, if set, retries evaluations that exceed EvaluationTimeout
+	Queue             *EvaluationQueue
+	EvaluationTimeout time.Duration
+
+	// App is the name of the GitHub App in logs and routes. It is empty for
+	// the primary app.
+	App string
+
+	// Incomplete, if set, records evaluations stopped by rate limits or
+	// transient errors so they are retried instead of reporting an error
+	Incomplete incomplete.Store
 }
 
 type PullEvaluationOptions struct {
@@ -59,6 +121,49 @@ type PullEvaluationOptions struct {
 	// no templating. This is turned off by default. This is to support legacy workflows that depend on the original
 	// context behaviour, and will be removed in 2.0
 	PostInsecureStatusChecks bool `yaml:"post_insecure_status_checks"`
+
+	// SummaryComment enables posting a comment on each pull request that
+	// summarizes the state of each rule. The comment is edited in place when
+	// the state changes.
+	SummaryComment bool `yaml:"summary_comment"`
+
+	// CheckRuns reports the policy state with a check run instead of a
+	// commit status. The check run summarizes each rule and has a button to
+	// evaluate the pull request again.
+	CheckRuns bool `yaml:"check_runs"`
+
+	// RequestReviewers enables requesting reviews from the users and teams
+	// that can approve each rule when the rule becomes pending. Rules that set
+	// the request_review option request reviews even if this is false.
+	RequestReviewers bool `yaml:"request_reviewers"`
+
+	// RuleConcurrency is the maximum number of independent rules evaluated
+	// at the same time for a pull request. Set it to 1 to evaluate rules one
+	// at a time.
+	RuleConcurrency int `yaml:"rule_concurrency"`
+
+	// PushedDateFallback is the date used when GitHub does not return the
+	// pushed date of a commit, which rules that invalidate approvals on push
+	// need. By default, evaluation fails with an error. Set it to
+	// "committed_date" to use the commit date instead.
+	PushedDateFallback pull.PushedDateFallback `yaml:"pushed_date_fallback"`
+
+	// RemoteOwners are the owners, in addition to the owner of a pull
+	// request, whose repositories can contain remote policies and tracking
+	// issues for the pull request. Remote repositories are read with the
+	// installation of their owner, so listing an owner allows policies in
+	// every installation to read its repositories.
+	RemoteOwners []string `yaml:"remote_owners"`
+
+	// CommentKeywords are comment patterns added to the approval and
+	// disapproval methods of every policy, in addition to the patterns of
+	// each rule.
+	CommentKeywords common.Keywords `yaml:"comment_keywords"`
+
+	// Overrides change options for specific organizations or repositories.
+	// When multiple overrides match a repository, later overrides take
+	// precedence.
+	Overrides []OptionsOverride `yaml:"overrides"`
 }
 
 func (p *PullEvaluationOptions) FillDefaults() {
@@ -73,18 +178,58 @@ func (p *PullEvaluationOptions) FillDefaults() {
 	if p.AppName == "" {
 		p.AppName = DefaultAppName
 	}
+
+	if p.RuleConcurrency <= 0 {
+		p.RuleConcurrency = DefaultRuleConcurrency
+	}
+}
+
+// RemoteOwnerAllowed returns true if pull requests in repositories owned by
+// owner can read remote policies and tracking issues in repositories owned by
+// remoteOwner.
+func (p *PullEvaluationOptions) RemoteOwnerAllowed(owner, remoteOwner string) bool {
+	if strings.EqualFold(owner, remoteOwner) {
+		return true
+	}
+	for _, o := range p.RemoteOwners {
+		if strings.EqualFold(o, remoteOwner) {
+			return true
+		}
+	}
+	return false
 }
 
 func (b *Base) PostStatus(ctx context.Context, prctx pull.Context, client *github.Client, state, message string) error {
+	return b.PostResult(ctx, prctx, client, nil, state, message)
+}
+
+// PostResult reports the state of a pull request with a commit status or, if
+// enabled for the repository, a check run. Check runs also summarize the
+// result, if it is not nil.
+func (b *Base) PostResult(ctx context.Context, prctx pull.Context, client *github.Client, result *common.Result, state, message string) error {
+	var rules string
+	if b.PullOpts.ForRepository(prctx.RepositoryOwner(), prctx.RepositoryName()).CheckRuns {
+		rules = b.checkRunRules(result)
+	}
+	return b.postResult(ctx, prctx, client, rules, state, message)
+}
+
+// postResult is PostResult with the rule sections of the check run summary
+// rendered by checkRunRules, which cached outcomes store instead of results.
+func (b *Base) postResult(ctx context.Context, prctx pull.Context, client *github.Client, rules, state, message string) error {
 	owner := prctx.RepositoryOwner()
 	repo := prctx.RepositoryName()
 	sha := prctx.HeadSHA()
 	base, _ := prctx.Branches()
 
-	publicURL := strings.TrimSuffix(b.BaseConfig.PublicURL, "/")
-	detailsURL := fmt.Sprintf("%s/details/%s/%s/%d", publicURL, owner, repo, prctx.Number())
+	opts := b.PullOpts.ForRepository(owner, repo)
+	if opts.CheckRuns {
+		return b.postCheckRun(ctx, prctx, client, rules, state, message)
+	}
+
+	detailsURL := b.DetailsURL(owner, repo, prctx.Number())
 
-	contextWithBranch := fmt.Sprintf("%s: %s", b.PullOpts.StatusCheckContext, base)
+	contextWithBranch := b.StatusContext(owner, repo, base)
 	status := &github.RepoStatus{
 		Context:     &contextWithBranch,
 		State:       &state,
@@ -92,13 +237,15 @@ func (b *Base) PostStatus(ctx context.Context, prctx pull.Context, client *githu
 		TargetURL:   &detailsURL,
 	}
 
-	if err := b.postGitHubRepoStatus(ctx, client, owner, repo, sha, status); err != nil {
+	existing := b.existingStatuses(ctx, client, owner, repo, sha)
+
+	if err := b.postChangedStatus(ctx, client, owner, repo, sha, status, existing); err != nil {
 		return err
 	}
 
-	if b.PullOpts.PostInsecureStatusChecks {
-		status.Context = &b.PullOpts.StatusCheckContext
-		if err := b.postGitHubRepoStatus(ctx, client, owner, repo, sha, status); err != nil {
+	if opts.PostInsecureStatusChecks {
+		status.Context = &opts.StatusCheckContext
+		if err := b.postChangedStatus(ctx, client, owner, repo, sha, status, existing); err != nil {
 			return err
 		}
 	}
@@ -106,6 +253,49 @@ func (b *Base) PostStatus(ctx context.Context, prctx pull.Context, client *githu
 	return nil
 }
 
+// existingStatuses returns the latest status for each context on a commit. If
+// the statuses cannot be loaded, it returns nil so that all statuses are
+// posted.
+func (b *Base) existingStatuses(ctx context.Context, client *github.Client, owner, repo, sha string) map[string]github.RepoStatus {
+	combined, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, sha, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msgf("Failed to get existing statuses for %s", sha)
+		return nil
+	}
+
+	statuses := make(map[string]github.RepoStatus, len(combined.Statuses))
+	for _, s := range combined.Statuses {
+		statuses[s.GetContext()] = s
+	}
+	return statuses
+}
+
+// postChangedStatus posts a status unless the commit already has an identical
+// status. Posting the same status again adds nothing to the pull request, but
+// triggers status webhooks and counts against rate limits.
+func (b *Base) postChangedStatus(ctx context.Context, client *github.Client, owner, repo, ref string, status *github.RepoStatus, existing map[string]github.RepoStatus) error {
+	if s, ok := existing[status.GetContext()]; ok {
+		if s.GetState() == status.GetState() && s.GetDescription() == status.GetDescription() && s.GetTargetURL() == status.GetTargetURL() {
+			zerolog.Ctx(ctx).Debug().Msgf("Status %q on %s is already %s: %s", status.GetContext(), ref, status.GetState(), status.GetDescription())
+			b.Metrics.recordUnchangedStatus(owner, repo)
+			return nil
+		}
+	}
+	return b.postGitHubRepoStatus(ctx, client, owner, repo, ref, status)
+}
+
+// DetailsURL returns the URL of the details page for a pull request.
+func (b *Base) DetailsURL(owner, repo string, number int) string {
+	publicURL := strings.TrimSuffix(b.BaseConfig.PublicURL, "/")
+	return fmt.Sprintf("%s/details/%s/%s/%d", publicURL, owner, repo, number)
+}
+
+// StatusContext returns the status context used for pull requests in a
+// repository that target the given base branch.
+func (b *Base) StatusContext(owner, repo, base string) string {
+	return fmt.Sprintf("%s: %s", b.PullOpts.ForRepository(owner, repo).StatusCheckContext, base)
+}
+
 func (b *Base) postGitHubRepoStatus(ctx context.Context, client *github.Client, owner, repo, ref string, status *github.RepoStatus) error {
 	logger := zerolog.Ctx(ctx)
 	logger.Info().Msgf("Setting %q status on %s to %s: %s", status.GetContext(), ref, status.GetState(), status.GetDescription())
@@ -113,38 +303,399 @@ func (b *Base) postGitHubRepoStatus(ctx context.Context, client *github.Client,
 	return err
 }
 
+// RepositoryClientCreator creates clients whose tokens can only access one
+// repository of an installation.
+type RepositoryClientCreator interface {
+	NewRepositoryClient(installationID int64, repo string) (*github.Client, error)
+	NewRepositoryV4Client(installationID int64, repo string) (*githubv4.Client, error)
+}
+
+// newRepositoryClients returns the clients used to evaluate a pull request in
+// a repository. If the client creator supports it, the clients can only
+// access that repository.
+func (b *Base) newRepositoryClients(installationID int64, repo string) (*github.Client, *githubv4.Client, error) {
+	rcc, ok := b.ClientCreator.(RepositoryClientCreator)
+	if !ok {
+		client, err := b.NewInstallationClient(installationID)
+		if err != nil {
+			return nil, nil, err
+		}
+		v4client, err := b.NewInstallationV4Client(installationID)
+		return client, v4client, err
+	}
+
+	client, err := rcc.NewRepositoryClient(installationID, repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	v4client, err := rcc.NewRepositoryV4Client(installationID, repo)
+	return client, v4client, err
+}
+
+// NewRemoteConfigClient returns a client that can read a remote policy in a
+// repository, using the installation for the owner of the repository. Use it
+// as ConfigFetcher.RemoteClient when evaluation clients can only access the
+// repository of the pull request. Pull contexts also use it to load tracking
+// issues in other repositories. Callers must check that the owner is allowed
+// by PullOpts.RemoteOwnerAllowed.
+func (b *Base) NewRemoteConfigClient(ctx context.Context, owner, repo string) (*github.Client, error) {
+	installation, err := b.Installations.GetByOwner(ctx, owner)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get installation for %s", owner)
+	}
+
+	if rcc, ok := b.ClientCreator.(RepositoryClientCreator); ok {
+		return rcc.NewRepositoryClient(installation.ID, repo)
+	}
+	return b.NewInstallationClient(installation.ID)
+}
+
+// NewPullContext returns a pull.Context for the located pull request that
+// uses the membership context for the repository owner and applies the
+// evaluation options.
+func (b *Base) NewPullContext(ctx context.Context, client *github.Client, v4client *githubv4.Client, loc pull.Locator) (pull.Context, error) {
+	opts := b.PullOpts.ForRepository(loc.Owner, loc.Repo)
+	mbrCtx := b.NewMembershipContext(ctx, client, v4client, loc.Owner)
+	ctx = pull.WithPushedDateFallback(ctx, opts.PushedDateFallback)
+
+	prctx, err := pull.NewGitHubContext(ctx, mbrCtx, client, v4client, loc)
+	if err != nil {
+		return nil, err
+	}
+	if ghc, ok := prctx.(*pull.GitHubContext); ok {
+		ghc.SetLinkedIssueClient(func(owner, repo string) (*github.Client, error) {
+			if !opts.RemoteOwnerAllowed(loc.Owner, owner) {
+				return nil, errors.Errorf("tracking repository %s/%s is not owned by %s or an allowed remote owner", owner, repo, loc.Owner)
+			}
+			client, err := b.NewRemoteConfigClient(ctx, owner, repo)
+			if err != nil {
+				return nil, err
+			}
+			if user, ok := ctx.Value(linkedIssueReaderKey{}).(string); ok {
+				readable, err := canRead(ctx, client, owner, repo, user)
+				if err != nil {
+					return nil, err
+				}
+				if !readable {
+					return nil, errors.Errorf("%s cannot read tracking repository %s/%s", user, owner, repo)
+				}
+			}
+			return client, nil
+		})
+	}
+	return prctx, nil
+}
+
+type linkedIssueReaderKey struct{}
+
+// withLinkedIssueReader limits the tracking issues that pull contexts created
+// with the returned context can load to repositories that user can read. Use
+// it when a user provides the policy, like in simulations.
+func withLinkedIssueReader(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, linkedIssueReaderKey{}, user)
+}
+
+type evaluationObserverKey struct{}
+
+// evaluationObservation is the outcome of the last evaluation that posted a
+// status with a context returned by withEvaluationObserver. Result is nil if
+// the outcome was cached.
+type evaluationObservation struct {
+	SHA          string
+	PolicySource string
+	Result       *common.Result
+	State        string
+	Description  string
+}
+
+// withEvaluationObserver returns a context that records the outcome of
+// evaluations in the returned observation, for callers that wait for the
+// outcome, like the evaluation service.
+func withEvaluationObserver(ctx context.Context) (context.Context, *evaluationObservation) {
+	obs := &evaluationObservation{}
+	return context.WithValue(ctx, evaluationObserverKey{}, obs), obs
+}
+
+func observeEvaluation(ctx context.Context, prctx pull.Context, fetchedConfig FetchedConfig, result *common.Result, state, description string) {
+	if obs, ok := ctx.Value(evaluationObserverKey{}).(*evaluationObservation); ok {
+		*obs = evaluationObservation{
+			SHA:          prctx.HeadSHA(),
+			PolicySource: fetchedConfig.String(),
+			Result:       result,
+			State:        state,
+			Description:  description,
+		}
+	}
+}
+
+// NewMembershipContext returns the membership context for pull requests in
+// repositories owned by owner.
+func (b *Base) NewMembershipContext(ctx context.Context, client *github.Client, v4client *githubv4.Client, owner string) pull.MembershipContext {
+	mbrCtx := NewCrossOrgMembershipContext(ctx, client, v4client, owner, b.Installations, b.ClientCreator)
+	mbrCtx.Groups = b.Groups
+	return mbrCtx
+}
+
 func (b *Base) PreparePRContext(ctx context.Context, installationID int64, pr *github.PullRequest) (context.Context, zerolog.Logger) {
 	ctx, logger := githubapp.PreparePRContext(ctx, installationID, pr.GetBase().GetRepo(), pr.GetNumber())
 
 	logger = logger.With().Str(LogKeyGitHubSHA, pr.GetHead().GetSHA()).Logger()
 	ctx = logger.WithContext(ctx)
+	ctx = withRateLimitSource(ctx, installationID, pr.GetBase().GetRepo())
 
 	return ctx, logger
 }
 
+// withRateLimitSource attributes the GitHub requests made with ctx to the
+// installation and repository.
+func withRateLimitSource(ctx context.Context, installationID int64, repo *github.Repository) context.Context {
+	return ratelimit.WithSource(ctx, ratelimit.Source{
+		InstallationID: installationID,
+		Owner:          repo.GetOwner().GetLogin(),
+		Repo:           repo.GetName(),
+	})
+}
+
+// LockPullRequest acquires the evaluation lock for a pull request so that only
+// one evaluation of the pull request runs at a time, even across replicas.
+// Callers must call the returned function to release the lock.
+func (b *Base) LockPullRequest(ctx context.Context, owner, repo string, number int) (func(), error) {
+	if b.Locker == nil {
+		return func() {}, nil
+	}
+	return b.Locker.Lock(ctx, lock.PullRequestKey(owner, repo, number))
+}
+
+// nextSequence returns the sequence number of a new evaluation of the pull
+// request with the given lock key, or 0 if evaluations are not sequenced.
+func (b *Base) nextSequence(ctx context.Context, key string) int64 {
+	if b.Sequencer == nil {
+		return 0
+	}
+
+	seq, err := b.Sequencer.Next(ctx, key)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to sequence evaluation, evaluating anyway")
+		return 0
+	}
+	return seq
+}
+
+// superseded returns true if an evaluation of the pull request that was
+// requested after the evaluation with the sequence number already finished.
+// The caller must hold the lock for the pull request.
+func (b *Base) superseded(ctx context.Context, key string, seq int64) bool {
+	if seq == 0 {
+		return false
+	}
+
+	superseded, err := b.Sequencer.Superseded(ctx, key, seq)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to check evaluation sequence, evaluating anyway")
+		return false
+	}
+	return superseded
+}
+
+// finishSequence records the end of the evaluation with the sequence number.
+func (b *Base) finishSequence(ctx context.Context, key string, seq int64, completed bool) {
+	if seq == 0 {
+		return
+	}
+	if err := b.Sequencer.Finish(ctx, key, seq, completed); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to finish evaluation sequence")
+	}
+}
+
 func (b *Base) Evaluate(ctx context.Context, installationID int64, loc pull.Locator) error {
+	return b.evaluate(ctx, installationID, loc)
+}
+
+// evaluate evaluates a pull request, ignoring reviews with the given node IDs
+// because they were dismissed. Ignoring the reviews also changes the review
+// set, so outcomes cached while the reviews counted are not used.
+//
+// If the head of the pull request changes during an evaluation, the
+// evaluation does not post a result and the new head is evaluated instead, up
+// to MaxHeadChanges times.
+func (b *Base) evaluate(ctx context.Context, installationID int64, loc pull.Locator, dismissed ...string) error {
+	ctx = ratelimit.WithSource(ctx, ratelimit.Source{InstallationID: installationID, Owner: loc.Owner, Repo: loc.Repo})
+	logger := zerolog.Ctx(ctx)
+
+	err := b.evaluateHead(ctx, installationID, loc, dismissed...)
+	for i := 0; i < MaxHeadChanges; i++ {
+		var pr *github.PullRequest
+		switch cause := errors.Cause(err).(type) {
+		case *pull.HeadMissingError:
+			if pr, err = b.forcePushedHead(ctx, installationID, loc, err); err != nil {
+				return err
+			}
+			logger.Info().Msgf("Head commit was force-pushed, evaluating new head %.10s", pr.GetHead().GetSHA())
+		case *headMovedError:
+			pr = cause.PR
+			logger.Info().Msgf("Head changed from %.10s during evaluation, evaluating new head %.10s", cause.SHA, pr.GetHead().GetSHA())
+		default:
+			return err
+		}
+
+		loc.Value = pr
+		err = b.evaluateHead(ctx, installationID, loc, dismissed...)
+	}
+	return err
+}
+
+// forcePushedHead returns the pull request with its new head after an
+// evaluation found that the head commit was missing. If GitHub does not
+// report a new head yet, it returns the original error so the event is
+// retried.
+func (b *Base) forcePushedHead(ctx context.Context, installationID int64, loc pull.Locator, missing error) (*github.PullRequest, error) {
 	client, err := b.NewInstallationClient(installationID)
 	if err != nil {
+		return nil, err
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, loc.Owner, loc.Repo, loc.Number)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get pull request %s/%s#%d", loc.Owner, loc.Repo, loc.Number)
+	}
+
+	if cause, ok := errors.Cause(missing).(*pull.HeadMissingError); ok && cause.SHA == pr.GetHead().GetSHA() {
+		return nil, missing
+	}
+	return pr, nil
+}
+
+// headMovedError is returned when the head of a pull request changed while an
+// evaluation loaded data, so the data may mix the old and new heads.
+type headMovedError struct {
+	SHA string
+	PR  *github.PullRequest
+}
+
+func (e *headMovedError) Error() string {
+	return fmt.Sprintf("head of pull request moved from %.10s to %.10s during evaluation", e.SHA, e.PR.GetHead().GetSHA())
+}
+
+// checkHead returns a headMovedError if the head of the pull request is no
+// longer the head that was evaluated. If the pull request cannot be loaded,
+// it assumes the head did not move.
+func (b *Base) checkHead(ctx context.Context, prctx pull.Context, client *github.Client) error {
+	pr, _, err := client.PullRequests.Get(ctx, prctx.RepositoryOwner(), prctx.RepositoryName(), prctx.Number())
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to check the head of the pull request after evaluation")
+		return nil
+	}
+	if sha := pr.GetHead().GetSHA(); sha != "" && sha != prctx.HeadSHA() {
+		return &headMovedError{SHA: prctx.HeadSHA(), PR: pr}
+	}
+	return nil
+}
+
+// evaluateHead evaluates the head commit of a pull request.
+func (b *Base) evaluateHead(ctx context.Context, installationID int64, loc pull.Locator, dismissed ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "evaluate", tracing.SpanKindInternal)
+	span.SetAttribute("github.repository", loc.Owner+"/"+loc.Repo)
+	span.SetAttribute("github.pull_request", loc.Number)
+	defer func() {
+		span.SetError(err)
+		span.Finish()
+	}()
+
+	// take a sequence number before waiting for the lock: waiting
+	// evaluations can acquire the lock in any order, but an evaluation that
+	// was requested later always sees newer data. Apps post separate
+	// statuses, so each app has its own sequence.
+	key := b.PullOpts.AppName + ":" + lock.PullRequestKey(loc.Owner, loc.Repo, loc.Number)
+	seq := b.nextSequence(ctx, key)
+
+	unlock, err := b.LockPullRequest(ctx, loc.Owner, loc.Repo, loc.Number)
+	if err != nil {
+		b.finishSequence(ctx, key, seq, false)
 		return err
 	}
+	defer unlock()
+	defer func() { b.finishSequence(ctx, key, seq, err == nil) }()
 
-	v4client, err := b.NewInstallationV4Client(installationID)
+	if b.superseded(ctx, key, seq) {
+		zerolog.Ctx(ctx).Info().Msg("Skipping evaluation because a later evaluation already finished")
+		return nil
+	}
+
+	// the deadline applies to everything that calls GitHub, but statuses
+	// about a timeout use the original context
+	evalCtx, cancel := context.WithTimeout(ctx, b.evaluationTimeout())
+	defer cancel()
+
+	var client *github.Client
+	var prctx pull.Context
+	defer func() {
+		switch {
+		case err == nil:
+			b.clearIncomplete(ctx, loc)
+		case ctx.Err() != nil:
+		case evalCtx.Err() == context.DeadlineExceeded:
+			err = b.retryTimedOut(ctx, installationID, loc, client, prctx, err)
+		case isIncomplete(err):
+			err = b.deferIncomplete(ctx, installationID, loc, client, prctx, err)
+		}
+	}()
+
+	var v4client *githubv4.Client
+	client, v4client, err = b.newRepositoryClients(installationID, loc.Repo)
 	if err != nil {
 		return err
 	}
 
-	mbrCtx := NewCrossOrgMembershipContext(ctx, client, loc.Owner, b.Installations, b.ClientCreator)
-	prctx, err := pull.NewGitHubContext(ctx, mbrCtx, client, v4client, loc)
+	prctx, err = b.NewPullContext(evalCtx, client, v4client, loc)
 	if err != nil {
 		return err
 	}
+	if ghc, ok := prctx.(*pull.GitHubContext); ok && len(dismissed) > 0 {
+		ghc.DismissReviews(dismissed...)
+	}
 
-	fetchedConfig, err := b.ConfigFetcher.ConfigForPR(ctx, prctx, client)
+	fetchCtx, fetchSpan := tracing.Start(evalCtx, "fetch_policy", tracing.SpanKindInternal)
+	fetchedConfig, err := b.ConfigFetcher.ConfigForPR(fetchCtx, prctx, client)
+	fetchSpan.SetError(err)
+	fetchSpan.Finish()
 	if err != nil {
 		return errors.WithMessage(err, fmt.Sprintf("failed to fetch policy: %s", fetchedConfig))
 	}
 
-	return b.EvaluateFetchedConfig(ctx, prctx, client, fetchedConfig)
+	return b.EvaluateFetchedConfig(evalCtx, prctx, client, fetchedConfig)
+}
+
+func (b *Base) evaluationTimeout() time.Duration {
+	if b.EvaluationTimeout <= 0 {
+		return DefaultEvaluationTimeout
+	}
+	return b.EvaluationTimeout
+}
+
+// retryTimedOut handles an evaluation that exceeded its deadline. Unless the
+// evaluation was already a retry, it posts a pending status, if the pull
+// request was loaded, and schedules another evaluation. Otherwise, it returns
+// the original error.
+func (b *Base) retryTimedOut(ctx context.Context, installationID int64, loc pull.Locator, client *github.Client, prctx pull.Context, timeoutErr error) error {
+	logger := zerolog.Ctx(ctx)
+
+	if b.Queue == nil || isQueued(ctx) {
+		return timeoutErr
+	}
+
+	logger.Warn().Err(timeoutErr).Msgf("Evaluation exceeded the %s deadline, retrying", b.evaluationTimeout())
+
+	if prctx != nil {
+		if err := b.PostStatus(ctx, prctx, client, "pending", b.Messages.Text(messages.StatusTimeout)); err != nil {
+			logger.Error().Err(err).Msg("Failed to post status for timed out evaluation")
+		}
+	}
+
+	// retry with a fresh copy of the pull request
+	if !b.Queue.Enqueue(installationID, pull.Locator{Owner: loc.Owner, Repo: loc.Repo, Number: loc.Number}) {
+		return errors.WithMessage(timeoutErr, "evaluation timed out and the evaluation queue is full")
+	}
+	return nil
 }
 
 func (b *Base) EvaluateFetchedConfig(ctx context.Context, prctx pull.Context, client *github.Client, fetchedConfig FetchedConfig) error {
@@ -155,43 +706,185 @@ func (b *Base) EvaluateFetchedConfig(ctx context.Context, prctx pull.Context, cl
 		return nil
 	}
 
+	start := time.Now()
+	defer b.recordGraphQLUsage(ctx, prctx)
+
+	filterComments(prctx, fetchedConfig)
+
+	key := b.outcomeKey(ctx, prctx, fetchedConfig)
+	if outcome := b.cachedOutcome(ctx, key); outcome != nil {
+		return b.postCachedOutcome(ctx, prctx, client, fetchedConfig, outcome)
+	}
+
+	evalCtx, evalSpan := tracing.Start(ctx, "evaluate_policy", tracing.SpanKindInternal)
+	result, state, description, err := b.evaluateFetchedConfig(evalCtx, prctx, fetchedConfig)
+	evalSpan.SetAttribute("policy.state", state)
+	evalSpan.SetError(err)
+	evalSpan.Finish()
+	if err != nil {
+		return err
+	}
+
+	// replace any previous status on the old head, but skip all other actions
+	// and let the caller handle the missing head
+	if result != nil && pull.IsHeadMissing(result.Error) {
+		if err := b.PostStatus(ctx, prctx, client, state, description); err != nil {
+			return err
+		}
+		return result.Error
+	}
+
+	if result != nil && isIncomplete(result.Error) {
+		return result.Error
+	}
+
+	// never post a result computed from data for different heads
+	if err := b.checkHead(ctx, prctx, client); err != nil {
+		return err
+	}
+
+	// cache the outcome of the policy, not the status, which also depends on
+	// the upstream pull request
+	policyState, policyDescription := state, description
+	state, description, err = b.upstreamStatus(ctx, prctx, client, fetchedConfig, state, description)
+	if err != nil {
+		return err
+	}
+
+	postCtx, postSpan := tracing.Start(ctx, "post_status", tracing.SpanKindInternal)
+	err = b.PostResult(postCtx, prctx, client, result, state, description)
+	postSpan.SetError(err)
+	postSpan.Finish()
+	if err == nil {
+		observeEvaluation(ctx, prctx, fetchedConfig, result, state, description)
+		b.notify(ctx, prctx, result, state, description)
+		b.recordResult(ctx, prctx, result, state, description)
+		b.cacheOutcome(ctx, prctx, key, result, policyState, policyDescription)
+		if cerr := b.postSummaryComment(ctx, prctx, client, result, state, description); cerr != nil {
+			logger.Error().Err(cerr).Msg("Failed to post summary comment")
+		}
+		if lerr := b.syncLabels(ctx, prctx, client, result); lerr != nil {
+			logger.Error().Err(lerr).Msg("Failed to update labels")
+		}
+		if rerr := b.requestReviewers(ctx, prctx, client, result); rerr != nil {
+			logger.Error().Err(rerr).Msg("Failed to request reviewers")
+		}
+		if cerr := b.postComponentStatuses(ctx, prctx, client, fetchedConfig); cerr != nil {
+			logger.Error().Err(cerr).Msg("Failed to post component statuses")
+		}
+		if state == "success" {
+			if merr := b.autoMerge(ctx, prctx, client, fetchedConfig); merr != nil {
+				logger.Error().Err(merr).Msg("Failed to auto-merge pull request")
+			}
+		}
+	}
+
+	duration := time.Since(start)
+	b.Metrics.recordEvaluation(prctx, result, state, duration)
+	b.audit(ctx, prctx, fetchedConfig, result, state, description, duration)
+	return err
+}
+
+// recordGraphQLUsage logs and records metrics for the GraphQL API rate limit
+// points used to evaluate a pull request, if the context tracks them.
+func (b *Base) recordGraphQLUsage(ctx context.Context, prctx pull.Context) {
+	ghc, ok := prctx.(*pull.GitHubContext)
+	if !ok {
+		return
+	}
+
+	usage := ghc.GraphQLUsage()
+	if usage.Queries == 0 {
+		return
+	}
+	zerolog.Ctx(ctx).Info().Msgf("Evaluation made %d GraphQL queries costing %d points, %d/%d points remaining",
+		usage.Queries, usage.Cost, usage.Remaining, usage.Limit)
+
+	source, _ := ratelimit.SourceFromContext(ctx)
+	b.Metrics.recordGraphQLUsage(prctx.RepositoryOwner(), prctx.RepositoryName(), source.InstallationID, usage)
+}
+
+// evaluateFetchedConfig evaluates a policy and returns the result, if any, and
+// the state and description of the status to post.
+func (b *Base) evaluateFetchedConfig(ctx context.Context, prctx pull.Context, fetchedConfig FetchedConfig) (*common.Result, string, string, error) {
+	logger := zerolog.Ctx(ctx)
+
 	if fetchedConfig.Invalid() {
 		logger.Warn().Err(fetchedConfig.Error).Msgf("invalid policy: %s", fetchedConfig)
-		err := b.PostStatus(ctx, prctx, client, "error", fetchedConfig.Description())
-		return err
+		return nil, "error", fetchedConfig.Description(b.Messages), nil
 	}
 
 	evaluator, err := policy.ParsePolicy(fetchedConfig.Config)
 	if err != nil {
-		statusMessage := fmt.Sprintf("Invalid policy defined by %s", fetchedConfig)
+		statusMessage := b.Messages.Format(messages.StatusInvalidPolicy, messages.Args{"Config": fetchedConfig})
 		logger.Debug().Err(err).Msg(statusMessage)
-		err := b.PostStatus(ctx, prctx, client, "error", statusMessage)
-		return err
+		return nil, "error", statusMessage, nil
 	}
 
-	result := evaluator.Evaluate(ctx, prctx)
+	concurrency := b.PullOpts.ForRepository(prctx.RepositoryOwner(), prctx.RepositoryName()).RuleConcurrency
+	result := evaluator.Evaluate(common.WithConcurrency(ctx, concurrency), prctx)
+	localizeResult(b.Messages, &result)
+	if pull.IsHeadMissing(result.Error) {
+		// the head moved during evaluation, so the result does not apply to
+		// any commit; callers evaluate the new head instead of reporting this
+		logger.Info().Err(result.Error).Msg("Re-evaluating after a force-push")
+		return &result, "pending", b.Messages.Text(messages.StatusForcePush), nil
+	}
+	if isIncomplete(result.Error) {
+		// callers schedule a retry instead of reporting the error
+		logger.Warn().Err(result.Error).Msg("Evaluation stopped by a rate limit or transient error")
+		return &result, "pending", "", nil
+	}
+	if pull.IsTooLarge(result.Error) {
+		// retrying will not help, so post a failure that explains the limit
+		// instead of an error
+		statusMessage := b.Messages.Format(messages.StatusTooLarge, messages.Args{"Error": errors.Cause(result.Error)})
+		logger.Info().Err(result.Error).Msg(statusMessage)
+		return &result, "failure", statusMessage, nil
+	}
 	if result.Error != nil {
-		statusMessage := fmt.Sprintf("Error evaluating policy defined by %s", fetchedConfig)
+		statusMessage := b.Messages.Format(messages.StatusEvaluationError, messages.Args{"Config": fetchedConfig})
 		logger.Warn().Err(result.Error).Msg(statusMessage)
-		err := b.PostStatus(ctx, prctx, client, "error", statusMessage)
-		return err
+		b.reportError(ctx, prctx.RepositoryOwner(), prctx.RepositoryName(), prctx.Number(), result.Error, statusMessage)
+		return &result, "error", statusMessage, nil
 	}
 
-	statusDescription := result.Description
-	var statusState string
+	statusState, statusDescription, err := resultStatus(b.Messages, &result)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return &result, statusState, statusDescription, nil
+}
+
+// resultStatus returns the state and description of the status for a result
+// without an error.
+func resultStatus(m *messages.Catalog, result *common.Result) (string, string, error) {
 	switch result.Status {
 	case common.StatusApproved:
-		statusState = "success"
+		return "success", result.Description, nil
 	case common.StatusDisapproved:
-		statusState = "failure"
+		return "failure", result.Description, nil
 	case common.StatusPending:
-		statusState = "pending"
+		return "pending", pendingDescription(m, result), nil
 	case common.StatusSkipped:
-		statusState = "error"
-		statusDescription = "All rules were skipped. At least one rule must match."
-	default:
-		return errors.Errorf("evaluation resulted in unexpected state: %s", result.Status)
+		return "error", m.Text(messages.StatusSkipped), nil
 	}
+	return "", "", errors.Errorf("evaluation resulted in unexpected state: %s", result.Status)
+}
 
-	return b.PostStatus(ctx, prctx, client, statusState, statusDescription)
+// reportError sends an error that affected a pull request to the error
+// reporter, if one is configured.
+func (b *Base) reportError(ctx context.Context, owner, repo string, number int, err error, message string) {
+	if b.Errors == nil {
+		return
+	}
+	b.Errors.Report(ctx, errorreport.Event{
+		Err:     err,
+		Message: message,
+		Tags: map[string]string{
+			errorreport.TagApp:         b.PullOpts.AppName,
+			errorreport.TagRepository:  owner + "/" + repo,
+			errorreport.TagPullRequest: strconv.Itoa(number),
+		},
+	})
 }
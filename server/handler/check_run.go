@@ -0,0 +1,114 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// checkRunEvent is the payload of a check_run event. The vendored event type
+// does not include the requested action.
+type checkRunEvent struct {
+	github.CheckRunEvent
+
+	RequestedAction struct {
+		Identifier string `json:"identifier"`
+	} `json:"requested_action"`
+}
+
+// CheckRun evaluates pull requests again when users re-run the policy check
+// run or click its re-evaluate button, and updates stacked pull requests when
+// the check run completes.
+type CheckRun struct {
+	Base
+}
+
+func (h *CheckRun) Handles() []string { return []string{"check_run"} }
+
+// Handle check_run
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#check_run
+func (h *CheckRun) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event checkRunEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "failed to parse check run event payload")
+	}
+
+	repo := event.GetRepo()
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	installationID := githubapp.GetInstallationIDFromEvent(&event.CheckRunEvent)
+	run := event.GetCheckRun()
+
+	ctx, logger := githubapp.PrepareRepoContext(ctx, installationID, repo)
+	logger = logger.With().Str(LogKeyGitHubSHA, run.GetHeadSHA()).Logger()
+	ctx = logger.WithContext(ctx)
+	ctx = withRateLimitSource(ctx, installationID, repo)
+
+	opts := h.PullOpts.ForRepository(owner, name)
+	if !opts.CheckRuns || !strings.HasPrefix(run.GetName(), opts.StatusCheckContext+": ") {
+		logger.Debug().Msgf("Ignoring check run event for '%s'", run.GetName())
+		// other successful check runs may make pull requests ready to
+		// auto-merge, but are otherwise ignored
+		if event.GetAction() == "completed" && checkSucceeded(run.GetConclusion()) {
+			h.tryAutoMergeCommit(ctx, installationID, owner, name, run.GetHeadSHA(), run.PullRequests)
+		}
+		return nil
+	}
+
+	switch event.GetAction() {
+	case "rerequested":
+	case "requested_action":
+		if event.RequestedAction.Identifier != checkRunReevaluate {
+			return nil
+		}
+	case "completed":
+		// the policy state changed, so pull requests stacked on the branch
+		// may require a different state
+		client, err := h.NewInstallationClient(installationID)
+		if err != nil {
+			return err
+		}
+		if branch := run.GetCheckSuite().GetHeadBranch(); branch != "" {
+			return h.evaluateDependents(ctx, client, installationID, owner, name, branch)
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	ctx = withTrigger(ctx, eventType, event.GetAction(), event.GetSender().GetLogin())
+
+	// GitHub only lists pull requests from branches in the same repository,
+	// so runs on pull requests from forks are evaluated by other events
+	if len(run.PullRequests) == 0 {
+		logger.Debug().Msg("Check run event has no pull requests")
+		return nil
+	}
+
+	for _, pr := range run.PullRequests {
+		loc := pull.Locator{Owner: owner, Repo: name, Number: pr.GetNumber()}
+		if err := h.Evaluate(ctx, installationID, loc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+)
+
+// CheckSuite tries to auto-merge pull requests when a check suite on their
+// head commit succeeds.
+type CheckSuite struct {
+	Base
+}
+
+func (h *CheckSuite) Handles() []string { return []string{"check_suite"} }
+
+func (h *CheckSuite) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event github.CheckSuiteEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "failed to parse check suite event payload")
+	}
+
+	repo := event.GetRepo()
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	suite := event.GetCheckSuite()
+
+	ctx, logger := githubapp.PrepareRepoContext(ctx, installationID, repo)
+	logger = logger.With().Str(LogKeyGitHubSHA, suite.GetHeadSHA()).Logger()
+	ctx = logger.WithContext(ctx)
+	ctx = withRateLimitSource(ctx, installationID, repo)
+
+	if event.GetAction() != "completed" || !checkSucceeded(suite.GetConclusion()) {
+		return nil
+	}
+
+	// GitHub only lists pull requests from branches in the same repository,
+	// so pull requests from forks are merged by other events
+	h.tryAutoMergeCommit(ctx, installationID, repo.GetOwner().GetLogin(), repo.GetName(), suite.GetHeadSHA(), suite.PullRequests)
+	return nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/messages"
+)
+
+const (
+	// checkRunsMediaType enables the Checks API on older GitHub Enterprise
+	// Server versions.
+	checkRunsMediaType = "application/vnd.github.antiope-preview+json"
+
+	// checkRunReevaluate identifies the action that evaluates a pull request
+	// again.
+	checkRunReevaluate = "reevaluate"
+
+	// maxCheckRunSummary is the maximum length of a check run summary
+	// accepted by GitHub.
+	maxCheckRunSummary = 65535
+)
+
+// checkRunAction is a button shown on a check run. GitHub sends a check_run
+// event with the identifier when a user clicks it.
+type checkRunAction struct {
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	Identifier  string `json:"identifier"`
+}
+
+// checkRunRequest creates or updates a check run. The vendored client does not
+// support actions, so check runs are posted with requests built here.
+type checkRunRequest struct {
+	Name        string                 `json:"name"`
+	HeadSHA     string                 `json:"head_sha,omitempty"`
+	DetailsURL  string                 `json:"details_url,omitempty"`
+	Status      string                 `json:"status"`
+	Conclusion  string                 `json:"conclusion,omitempty"`
+	CompletedAt *time.Time             `json:"completed_at,omitempty"`
+	Output      *github.CheckRunOutput `json:"output"`
+	Actions     []checkRunAction       `json:"actions"`
+}
+
+// postCheckRun creates or updates the check run that reports the policy state
+// of a pull request. If result is nil, the check run only shows the state and
+// description, like a commit status.
+func (b *Base) postCheckRun(ctx context.Context, prctx pull.Context, client *github.Client, rules, state, description string) error {
+	owner, repo, sha := prctx.RepositoryOwner(), prctx.RepositoryName(), prctx.HeadSHA()
+	base, _ := prctx.Branches()
+
+	run := &checkRunRequest{
+		Name:       b.StatusContext(owner, repo, base),
+		HeadSHA:    sha,
+		DetailsURL: b.DetailsURL(owner, repo, prctx.Number()),
+		Output: &github.CheckRunOutput{
+			Title:   github.String(summaryTitle(b.Messages, state)),
+			Summary: github.String(checkRunSummary(rules, description)),
+		},
+		Actions: []checkRunAction{{
+			Label:       b.Messages.Text(messages.CheckRunReevaluate),
+			Description: b.Messages.Text(messages.CheckRunReevaluateDescription),
+			Identifier:  checkRunReevaluate,
+		}},
+	}
+	if state == "pending" {
+		run.Status = "in_progress"
+	} else {
+		now := time.Now()
+		run.Status = "completed"
+		run.Conclusion = checkRunConclusion(state)
+		run.CompletedAt = &now
+	}
+
+	existing, _, err := findCheckRun(ctx, client, owner, repo, sha, run.Name)
+	if err != nil {
+		return err
+	}
+
+	logger := zerolog.Ctx(ctx)
+	method, u := "POST", fmt.Sprintf("repos/%s/%s/check-runs", owner, repo)
+	if existing != nil {
+		if existing.GetStatus() == run.Status && existing.GetConclusion() == run.Conclusion &&
+			existing.GetOutput().GetTitle() == run.Output.GetTitle() && existing.GetOutput().GetSummary() == run.Output.GetSummary() {
+			logger.Debug().Msgf("Check run %q on %s is already %s: %s", run.Name, sha, state, description)
+			b.Metrics.recordUnchangedStatus(owner, repo)
+			return nil
+		}
+		// completed check runs cannot be reopened, so a new run replaces them
+		if existing.GetStatus() != "completed" {
+			method, u = "PATCH", fmt.Sprintf("%s/%d", u, existing.GetID())
+			run.HeadSHA = ""
+		}
+	}
+
+	logger.Info().Msgf("Setting %q check run on %s to %s: %s", run.Name, sha, state, description)
+	req, err := client.NewRequest(method, u, run)
+	if err != nil {
+		return errors.Wrap(err, "failed to create check run request")
+	}
+	req.Header.Set("Accept", checkRunsMediaType)
+
+	_, err = client.Do(ctx, req, nil)
+	return errors.Wrapf(err, "failed to post check run %q", run.Name)
+}
+
+// findCheckRun returns the latest check run with a name on a commit, or nil if
+// there is no such check run.
+func findCheckRun(ctx context.Context, client *github.Client, owner, repo, sha, name string) (*github.CheckRun, *github.Response, error) {
+	runs, res, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, &github.ListCheckRunsOptions{
+		CheckName: &name,
+		Filter:    github.String("latest"),
+	})
+	if err != nil {
+		return nil, res, errors.Wrapf(err, "failed to list check runs for %s", sha)
+	}
+	if len(runs.CheckRuns) == 0 {
+		return nil, res, nil
+	}
+	return runs.CheckRuns[0], res, nil
+}
+
+// checkRunConclusion returns the conclusion of a check run for the state of a
+// completed evaluation. Check runs have no error conclusion, so errors fail.
+func checkRunConclusion(state string) string {
+	if state == "success" {
+		return "success"
+	}
+	return "failure"
+}
+
+// checkRunState returns the state of the commit status equivalent to a check
+// run.
+func checkRunState(run *github.CheckRun) string {
+	if run.GetStatus() != "completed" {
+		return "pending"
+	}
+	if run.GetConclusion() == "success" {
+		return "success"
+	}
+	return "failure"
+}
+
+// checkRunRules returns the Markdown sections for the rules of a result that
+// follow the description in check run summaries.
+func (b *Base) checkRunRules(result *common.Result) string {
+	if result == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, r := range leafResults(result) {
+		if r.Name == "disapproval" && r.Status != common.StatusDisapproved {
+			continue
+		}
+
+		sb.WriteString("\n")
+		writeRuleSection(&sb, b.Messages, r)
+	}
+	return sb.String()
+}
+
+// checkRunSummary returns the Markdown summary of a check run: the
+// description followed by the sections returned by checkRunRules.
+func checkRunSummary(rules, description string) string {
+	summary := description + "\n" + rules
+	if len(summary) > maxCheckRunSummary {
+		end := maxCheckRunSummary
+		for end > 0 && !isRuneStart(summary[end]) {
+			end--
+		}
+		summary = summary[:end]
+	}
+	return summary
+}
+
+// writeRuleSection writes a Markdown section with the status of a rule, who
+// can approve it, and which approvals counted.
+func writeRuleSection(sb *strings.Builder, m *messages.Catalog, r *common.Result) {
+	fmt.Fprintf(sb, "### %s\n\n", r.Name)
+	fmt.Fprintf(sb, "**%s**", m.State(r.Status.String()))
+	if r.Description != "" {
+		fmt.Fprintf(sb, ": %s", r.Description)
+	}
+	sb.WriteString("\n")
+
+	if who := approvers(m, r); who != "" {
+		fmt.Fprintf(sb, "\n%s: %s\n", m.Text(messages.SummaryColumnApprovers), who)
+	}
+	if len(r.Approvals) > 0 {
+		sb.WriteString("\n")
+		for _, a := range r.Approvals {
+			if a.Counted {
+				fmt.Fprintf(sb, "- :white_check_mark: `%s`\n", a.User)
+			} else {
+				fmt.Fprintf(sb, "- :x: `%s`: %s\n", a.User, a.Reason)
+			}
+		}
+	}
+}
+
+// policyState returns the state of the policy status or check run on a
+// commit, or an empty string if the commit has neither.
+func (b *Base) policyState(ctx context.Context, client *github.Client, owner, repo, base, sha string) (string, *github.Response, error) {
+	name := b.StatusContext(owner, repo, base)
+
+	if b.PullOpts.ForRepository(owner, repo).CheckRuns {
+		run, res, err := findCheckRun(ctx, client, owner, repo, sha, name)
+		if err != nil || run == nil {
+			return "", res, err
+		}
+		return checkRunState(run), res, nil
+	}
+
+	status, res, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, sha, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return "", res, errors.Wrap(err, "failed to get statuses")
+	}
+	for _, s := range status.Statuses {
+		if s.GetContext() == name {
+			return s.GetState(), res, nil
+		}
+	}
+	return "", res, nil
+}
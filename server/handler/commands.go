@@ -0,0 +1,162 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/messages"
+)
+
+const (
+	// commandPrefix starts the first line of a comment that runs a command.
+	commandPrefix = "/policy"
+
+	// commandMarker identifies replies to commands, so that they do not
+	// trigger evaluations.
+	commandMarker = "<!-- policy-bot: command -->"
+)
+
+// command is a command in a pull request comment, like "/policy explain
+// security-review".
+type command struct {
+	Name string
+	Args []string
+}
+
+// parseCommand returns the command in the first line of a comment. It returns
+// false if the comment does not start with the command prefix.
+func parseCommand(body string) (command, bool) {
+	line := strings.TrimSpace(body)
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], commandPrefix) {
+		return command{}, false
+	}
+	if len(fields) == 1 {
+		return command{Name: "help"}, true
+	}
+	return command{Name: strings.ToLower(fields[1]), Args: fields[2:]}, true
+}
+
+// isCommandReply returns true if a comment is a reply to a command posted by
+// this app.
+func (b *Base) isCommandReply(c *github.IssueComment) bool {
+	return b.isAppComment(c) && strings.Contains(c.GetBody(), commandMarker)
+}
+
+// runCommand runs a command from a comment by sender and replies with a
+// comment. Only the author of the pull request and users with write access
+// may run commands; commands from other users are ignored without a reply,
+// so that they cannot make the app comment. The evaluation is the outcome of
+// evaluating the pull request for the comment, if it posted a status.
+func (b *Base) runCommand(ctx context.Context, prctx pull.Context, client *github.Client, fetchedConfig FetchedConfig, evaluation *evaluationObservation, cmd command, sender string) error {
+	logger := zerolog.Ctx(ctx)
+	owner, repo, number := prctx.RepositoryOwner(), prctx.RepositoryName(), prctx.Number()
+
+	allowed, err := canRunCommands(ctx, client, prctx, sender)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		logger.Info().Msgf("Ignoring %q command from %s, who cannot run commands", cmd.Name, sender)
+		return nil
+	}
+
+	var reply string
+	switch cmd.Name {
+	case "evaluate", "status", "explain":
+		reply, err = b.commandReply(ctx, prctx, fetchedConfig, evaluation, cmd)
+		if err != nil {
+			return err
+		}
+	default:
+		reply = b.Messages.Text(messages.CommandHelp)
+	}
+
+	logger.Info().Msgf("Replying to %q command from %s", cmd.Name, sender)
+	body := commandMarker + "\n" + reply
+	_, _, err = client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: &body})
+	return errors.Wrap(err, "failed to reply to command")
+}
+
+// commandReply returns the reply to an evaluate, status, or explain command.
+// It uses the result of the evaluation, if there is one, and otherwise
+// evaluates the policy, for example if the outcome was cached.
+func (b *Base) commandReply(ctx context.Context, prctx pull.Context, fetchedConfig FetchedConfig, evaluation *evaluationObservation, cmd command) (string, error) {
+	if fetchedConfig.Missing() || fetchedConfig.Invalid() {
+		return fetchedConfig.Description(b.Messages), nil
+	}
+
+	result, state, description := evaluation.Result, evaluation.State, evaluation.Description
+	if result == nil {
+		var err error
+		if result, state, description, err = b.evaluateFetchedConfig(ctx, prctx, fetchedConfig); err != nil {
+			return "", err
+		}
+	}
+
+	switch cmd.Name {
+	case "evaluate":
+		return b.Messages.Format(messages.CommandEvaluated, messages.Args{
+			"State":       b.Messages.State(state),
+			"Description": description,
+		}), nil
+
+	case "explain":
+		if len(cmd.Args) == 0 {
+			return b.Messages.Text(messages.CommandHelp), nil
+		}
+		name := strings.Join(cmd.Args, " ")
+		if result != nil {
+			for _, r := range leafResults(result) {
+				if strings.EqualFold(r.Name, name) {
+					var sb strings.Builder
+					writeRuleSection(&sb, b.Messages, r)
+					return sb.String(), nil
+				}
+			}
+		}
+		return b.Messages.Format(messages.CommandUnknownRule, messages.Args{"Rule": name}), nil
+	}
+	return b.summaryTable(prctx, result, state, description), nil
+}
+
+// canRunCommands returns true if a user is the author of a pull request or has
+// write access to its repository.
+func canRunCommands(ctx context.Context, client *github.Client, prctx pull.Context, user string) (bool, error) {
+	if pull.CanonicalLogin(user) == pull.CanonicalLogin(prctx.Author()) {
+		return true, nil
+	}
+
+	perm, _, err := client.Repositories.GetPermissionLevel(ctx, prctx.RepositoryOwner(), prctx.RepositoryName(), user)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get permission of %s", user)
+	}
+	switch perm.GetPermission() {
+	case "admin", "write":
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"time"
+
+	"github.com/palantir/policy-bot/server/results"
+)
+
+// ComplianceRecorder collects the evaluations, merges, and status overwrites
+// summarized by compliance reports. Implementations must be safe for
+// concurrent use and must not block.
+type ComplianceRecorder interface {
+	// RecordEvaluation records the latest evaluation of an open pull request.
+	RecordEvaluation(pr results.PullRequest)
+
+	// RecordClose records that a pull request was closed, with the user who
+	// merged it if it was merged.
+	RecordClose(c ClosedPullRequest)
+
+	// RecordOverride records that a user other than the app posted the
+	// policy status of a commit.
+	RecordOverride(o StatusOverride)
+}
+
+// ClosedPullRequest identifies a closed pull request.
+type ClosedPullRequest struct {
+	Owner    string
+	Repo     string
+	Number   int
+	Merged   bool
+	MergedAt time.Time
+	MergedBy string
+}
+
+// StatusOverride is a policy status posted by a user other than the app.
+type StatusOverride struct {
+	Owner   string
+	Repo    string
+	SHA     string
+	Context string
+	State   string
+	Sender  string
+	Time    time.Time
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/messages"
+)
+
+// ComponentStatusContext returns the status context used for a component of
+// the policy of pull requests that target the given base branch.
+func (b *Base) ComponentStatusContext(owner, repo, base, component string) string {
+	return fmt.Sprintf("%s/%s: %s", b.PullOpts.ForRepository(owner, repo).StatusCheckContext, component, base)
+}
+
+// postComponentStatuses evaluates the components of a policy whose files
+// changed and posts a status for each of them.
+func (b *Base) postComponentStatuses(ctx context.Context, prctx pull.Context, client *github.Client, fetchedConfig FetchedConfig) error {
+	if !fetchedConfig.Valid() || len(fetchedConfig.Config.Components) == 0 {
+		return nil
+	}
+
+	results, err := policy.EvaluateComponents(ctx, fetchedConfig.Config, prctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to evaluate components")
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	owner := prctx.RepositoryOwner()
+	repo := prctx.RepositoryName()
+	sha := prctx.HeadSHA()
+	base, _ := prctx.Branches()
+	detailsURL := b.DetailsURL(owner, repo, prctx.Number())
+
+	existing := b.existingStatuses(ctx, client, owner, repo, sha)
+	for _, r := range results {
+		state, description, err := b.componentStatus(ctx, fetchedConfig, r)
+		if err != nil {
+			return err
+		}
+
+		statusContext := b.ComponentStatusContext(owner, repo, base, r.Name)
+		status := &github.RepoStatus{
+			Context:     &statusContext,
+			State:       &state,
+			Description: &description,
+			TargetURL:   &detailsURL,
+		}
+		if err := b.postChangedStatus(ctx, client, owner, repo, sha, status, existing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// componentStatus returns the state and description of the status for the
+// result of a component.
+func (b *Base) componentStatus(ctx context.Context, fetchedConfig FetchedConfig, r policy.ComponentResult) (string, string, error) {
+	if r.Result.Error != nil {
+		statusMessage := b.Messages.Format(messages.StatusEvaluationError, messages.Args{"Config": fetchedConfig})
+		zerolog.Ctx(ctx).Warn().Err(r.Result.Error).Msgf("Failed to evaluate component %q", r.Name)
+		return "error", statusMessage, nil
+	}
+	return resultStatus(b.Messages, &r.Result)
+}
@@ -17,36 +17,49 @@ package handler
 import (
 	"context"
 	"strings"
+	"sync"
 
 	"github.com/google/go-github/github"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
+	"github.com/shurcooL/githubv4"
 
 	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/membership"
 )
 
 type CrossOrgMembershipContext struct {
 	ctx           context.Context
+	owner         string
 	lookupClient  *github.Client
 	installations githubapp.InstallationsService
 	clientCreator githubapp.ClientCreator
 
+	mu      sync.Mutex
 	mbrCtxs map[string]pull.MembershipContext
+
+	// Groups resolves membership in directory groups. If nil, rules that
+	// reference groups fail to evaluate.
+	Groups *membership.Providers
 }
 
-func NewCrossOrgMembershipContext(ctx context.Context, client *github.Client, orgName string, installations githubapp.InstallationsService, clientCreator githubapp.ClientCreator) *CrossOrgMembershipContext {
+func NewCrossOrgMembershipContext(ctx context.Context, client *github.Client, v4client *githubv4.Client, orgName string, installations githubapp.InstallationsService, clientCreator githubapp.ClientCreator) *CrossOrgMembershipContext {
 	mbrCtx := &CrossOrgMembershipContext{
 		ctx:           ctx,
+		owner:         orgName,
 		lookupClient:  client,
 		installations: installations,
 		clientCreator: clientCreator,
 		mbrCtxs:       make(map[string]pull.MembershipContext),
 	}
-	mbrCtx.mbrCtxs[orgName] = pull.NewGitHubMembershipContext(ctx, client)
+	mbrCtx.mbrCtxs[orgName] = pull.NewGitHubMembershipContext(ctx, client, v4client)
 	return mbrCtx
 }
 
 func (c *CrossOrgMembershipContext) getCtxForOrg(name string) (pull.MembershipContext, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	mbrCtx, ok := c.mbrCtxs[name]
 	if !ok {
 		org, _, err := c.lookupClient.Organizations.Get(c.ctx, name)
@@ -64,7 +77,12 @@ func (c *CrossOrgMembershipContext) getCtxForOrg(name string) (pull.MembershipCo
 			return nil, err
 		}
 
-		mbrCtx = pull.NewGitHubMembershipContext(c.ctx, client)
+		v4client, err := c.clientCreator.NewInstallationV4Client(installation.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		mbrCtx = pull.NewGitHubMembershipContext(c.ctx, client, v4client)
 		c.mbrCtxs[name] = mbrCtx
 	}
 
@@ -88,6 +106,50 @@ func (c *CrossOrgMembershipContext) IsOrgMember(org, user string) (bool, error)
 	return mbrCtx.IsOrgMember(org, user)
 }
 
+// PrefetchMembership prefetches memberships using the context of each
+// organization. Teams are grouped by the organization in their name.
+func (c *CrossOrgMembershipContext) PrefetchMembership(user string, teams, orgs []string) error {
+	var names []string
+	teamsByOrg := make(map[string][]string)
+	checkOrg := make(map[string]bool)
+
+	seen := make(map[string]bool)
+	addOrg := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, team := range teams {
+		org := strings.Split(team, "/")[0]
+		addOrg(org)
+		teamsByOrg[org] = append(teamsByOrg[org], team)
+	}
+	for _, org := range orgs {
+		addOrg(org)
+		checkOrg[org] = true
+	}
+
+	for _, name := range names {
+		mbrCtx, err := c.getCtxForOrg(name)
+		if err != nil {
+			return err
+		}
+
+		var orgs []string
+		if checkOrg[name] {
+			orgs = []string{name}
+		}
+		if p, ok := mbrCtx.(pull.MembershipPrefetcher); ok {
+			if err := p.PrefetchMembership(user, teamsByOrg[name], orgs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (c *CrossOrgMembershipContext) IsCollaborator(org, repo, user, desiredPerm string) (bool, error) {
 	mbrCtx, err := c.getCtxForOrg(org)
 	if err != nil {
@@ -95,3 +157,20 @@ func (c *CrossOrgMembershipContext) IsCollaborator(org, repo, user, desiredPerm
 	}
 	return mbrCtx.IsCollaborator(org, repo, user, desiredPerm)
 }
+
+// HasVerifiedSigningKey checks the keys of the user with the installation of
+// the owner of the pull request, because keys do not depend on organizations.
+func (c *CrossOrgMembershipContext) HasVerifiedSigningKey(user string) (bool, error) {
+	mbrCtx, err := c.getCtxForOrg(c.owner)
+	if err != nil {
+		return false, err
+	}
+	return mbrCtx.HasVerifiedSigningKey(user)
+}
+
+func (c *CrossOrgMembershipContext) IsGroupMember(group, user string) (bool, error) {
+	if c.Groups == nil {
+		return false, errors.Errorf("cannot check membership in directory group %s: no group providers are configured", group)
+	}
+	return c.Groups.IsMember(c.ctx, group, user)
+}
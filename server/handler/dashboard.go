@@ -0,0 +1,282 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/scs"
+	"github.com/bluekeyes/templatetree"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"goji.io/pat"
+
+	"github.com/palantir/policy-bot/server/results"
+)
+
+// dashboardPageSize is the number of stored results the dashboard reads at a
+// time.
+const dashboardPageSize = 100
+
+// Dashboard serves a page that lists the open pull requests of an
+// organization or user that are blocked by their policy, grouped by what they
+// are waiting on. It uses the stored results of the latest evaluations, so
+// loading the page does not evaluate any pull requests.
+type Dashboard struct {
+	// Apps are the apps that share the GitHub instance used for login. The
+	// page uses the first app that is installed for the owner.
+	Apps []*App
+
+	Results   results.Store
+	Sessions  *scs.Manager
+	Templates templatetree.HTMLTree
+}
+
+// DashboardGroup is a set of blocked pull requests waiting on the same team,
+// user, or rule.
+type DashboardGroup struct {
+	Name         string                  `json:"name"`
+	PullRequests []*DashboardPullRequest `json:"pull_requests"`
+}
+
+// DashboardPullRequest is a blocked pull request in a group.
+type DashboardPullRequest struct {
+	results.PullRequest
+
+	// DetailsURL is the URL of the details page of the pull request
+	DetailsURL string `json:"details_url"`
+
+	// BlockingRules are the names of the rules that put the pull request in
+	// the group
+	BlockingRules []string `json:"blocking_rules"`
+}
+
+func (h *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	owner := pat.Param(r, "owner")
+
+	app, installation, err := FindInstallation(ctx, h.Apps, owner)
+	if err != nil {
+		return err
+	}
+
+	client, err := app.Base.NewInstallationClient(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create github client")
+	}
+
+	user, err := h.Sessions.Load(r).GetString(SessionKeyUsername)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+
+	// only show repositories the user can read
+	readable := NewReadChecker(client, user)
+
+	var blocked []results.PullRequest
+	opts := results.ListOptions{Owner: owner, Limit: dashboardPageSize}
+	for {
+		prs, next, err := h.Results.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, pr := range prs {
+			if pr.State != "pending" && pr.State != "failure" {
+				continue
+			}
+			ok, err := readable.CanRead(ctx, pr.Owner, pr.Repo)
+			if err != nil {
+				return err
+			}
+			if ok {
+				blocked = append(blocked, pr)
+			}
+		}
+		if next == "" {
+			break
+		}
+		opts.After = next
+	}
+
+	groups := groupBlocked(blocked, app.Base.DetailsURL)
+	newest := r.URL.Query().Get("sort") == "newest"
+	for _, g := range groups {
+		sortByAge(g.PullRequests, newest)
+	}
+
+	if wantsJSON(r) {
+		return writeDetailsJSON(w, groups, fmt.Sprintf("%s-dashboard.json", owner))
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	return h.Templates.ExecuteTemplate(w, "dashboard.html.tmpl", struct {
+		Owner  string
+		User   string
+		Newest bool
+		Groups []*DashboardGroup
+	}{owner, user, newest, groups})
+}
+
+// ReadChecker checks if a user can read repositories, checking each
+// repository once. Create a new checker for each request so that permission
+// changes are seen by the next request.
+type ReadChecker struct {
+	client   *github.Client
+	user     string
+	readable map[string]bool
+}
+
+func NewReadChecker(client *github.Client, user string) *ReadChecker {
+	return &ReadChecker{
+		client:   client,
+		user:     user,
+		readable: make(map[string]bool),
+	}
+}
+
+// CanRead returns true if the user can read the repository.
+func (c *ReadChecker) CanRead(ctx context.Context, owner, repo string) (bool, error) {
+	key := strings.ToLower(owner + "/" + repo)
+	if ok, checked := c.readable[key]; checked {
+		return ok, nil
+	}
+
+	ok, err := canRead(ctx, c.client, owner, repo, c.user)
+	if err != nil {
+		return false, err
+	}
+	c.readable[key] = ok
+	return ok, nil
+}
+
+func canRead(ctx context.Context, client *github.Client, owner, repo, user string) (bool, error) {
+	level, _, err := client.Repositories.GetPermissionLevel(ctx, owner, repo, user)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to get user permission level")
+	}
+	return level.GetPermission() != "none", nil
+}
+
+// groupBlocked groups pull requests by the actors that can approve their
+// pending rules. Pending rules that no listed actor can approve are grouped
+// by rule name and disapproved rules are grouped together. A pull request
+// appears in each group it is waiting on.
+func groupBlocked(prs []results.PullRequest, detailsURL func(string, string, int) string) []*DashboardGroup {
+	byName := make(map[string]*DashboardGroup)
+	for _, pr := range prs {
+		entries := make(map[string]*DashboardPullRequest)
+		add := func(name, rule string) {
+			e, ok := entries[name]
+			if !ok {
+				e = &DashboardPullRequest{PullRequest: pr, DetailsURL: detailsURL(pr.Owner, pr.Repo, pr.Number)}
+				entries[name] = e
+
+				g, ok := byName[name]
+				if !ok {
+					g = &DashboardGroup{Name: name}
+					byName[name] = g
+				}
+				g.PullRequests = append(g.PullRequests, e)
+			}
+			e.BlockingRules = append(e.BlockingRules, rule)
+		}
+
+		for _, rule := range pr.Rules {
+			switch rule.Status {
+			case "disapproved":
+				add("disapproved", rule.Name)
+			case "pending":
+				names := pendingGroupNames(rule)
+				if len(names) == 0 {
+					names = []string{"rule " + rule.Name}
+				}
+				for _, name := range names {
+					add(name, rule.Name)
+				}
+			}
+		}
+	}
+
+	groups := make([]*DashboardGroup, 0, len(byName))
+	for _, g := range byName {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+func pendingGroupNames(rule results.Rule) []string {
+	if rule.Pending == nil {
+		return nil
+	}
+
+	var names []string
+	for _, t := range rule.Pending.Teams {
+		names = append(names, "team "+t)
+	}
+	for _, u := range rule.Pending.Users {
+		names = append(names, "user "+u)
+	}
+	for _, o := range rule.Pending.Organizations {
+		names = append(names, "organization "+o)
+	}
+	for _, g := range rule.Pending.Groups {
+		names = append(names, "group "+g)
+	}
+	for _, a := range rule.Pending.Apps {
+		names = append(names, "app "+a)
+	}
+	return names
+}
+
+// sortByAge sorts pull requests by creation time, oldest first unless newest
+// is true. Pull requests with an unknown creation time sort last.
+func sortByAge(prs []*DashboardPullRequest, newest bool) {
+	sort.SliceStable(prs, func(i, j int) bool {
+		a, b := prs[i].CreatedAt, prs[j].CreatedAt
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero()
+		}
+		if newest {
+			return a.After(b)
+		}
+		return a.Before(b)
+	})
+}
+
+// formatAge returns the approximate time since t.
+func formatAge(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+
+	d := time.Since(t)
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d/(24*time.Hour)))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(d/time.Hour))
+	}
+	return "less than 2 hours"
+}
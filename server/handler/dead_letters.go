@@ -0,0 +1,118 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+
+	"github.com/palantir/policy-bot/server/deadletter"
+)
+
+// DeadLetters provides admin routes to inspect and replay webhook deliveries
+// that failed processing.
+type DeadLetters struct {
+	Queue deadletter.Queue
+
+	// Handlers are the unwrapped event handlers used to replay deliveries,
+	// keyed by app name
+	Handlers map[string][]githubapp.EventHandler
+}
+
+// List writes all failed deliveries, without payloads.
+func (h *DeadLetters) List(w http.ResponseWriter, r *http.Request) error {
+	deliveries, err := h.Queue.List(r.Context())
+	if err != nil {
+		return err
+	}
+
+	for i := range deliveries {
+		deliveries[i].Payload = nil
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, deliveries)
+	return nil
+}
+
+// Replay processes a failed delivery again, removing it from the queue if it
+// succeeds.
+func (h *DeadLetters) Replay(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	d, err := h.Queue.Get(ctx, pat.Param(r, "id"))
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		http.Error(w, fmt.Sprintf("not found: %s", pat.Param(r, "id")), http.StatusNotFound)
+		return nil
+	}
+
+	handler := h.findHandler(d.App, d.EventType)
+	if handler == nil {
+		return errors.Errorf("no handler for event type %q in app %q", d.EventType, d.App)
+	}
+
+	logger := zerolog.Ctx(ctx).With().
+		Str(githubapp.LogKeyEventType, d.EventType).
+		Str(githubapp.LogKeyDeliveryID, d.DeliveryID).
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	logger.Info().Msgf("Replaying delivery from the dead letter queue")
+	if herr := handler.Handle(ctx, d.EventType, d.DeliveryID, d.Payload); herr != nil {
+		d.Error = herr.Error()
+		d.Attempts++
+		d.FailedAt = time.Now()
+		if err := h.Queue.Add(ctx, *d); err != nil {
+			return err
+		}
+		return errors.Wrap(herr, "failed to replay delivery")
+	}
+
+	if err := h.Queue.Remove(ctx, d.ID); err != nil {
+		return err
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, map[string]string{"status": "replayed"})
+	return nil
+}
+
+// Delete removes a failed delivery from the queue without processing it.
+func (h *DeadLetters) Delete(w http.ResponseWriter, r *http.Request) error {
+	if err := h.Queue.Remove(r.Context(), pat.Param(r, "id")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *DeadLetters) findHandler(app, eventType string) githubapp.EventHandler {
+	for _, handler := range h.Handlers[app] {
+		for _, t := range handler.Handles() {
+			if t == eventType {
+				return handler
+			}
+		}
+	}
+	return nil
+}
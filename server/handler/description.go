@@ -0,0 +1,136 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"strings"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/server/messages"
+)
+
+// maxStatusDescription is the maximum length of a commit status description
+// accepted by GitHub.
+const maxStatusDescription = 140
+
+// localizeResult replaces the description of each result in a tree that has a
+// message with the text of the message in the catalog. Without a catalog, the
+// descriptions are already the default English text.
+func localizeResult(m *messages.Catalog, r *common.Result) {
+	if m == nil {
+		return
+	}
+	if r.Message != nil {
+		r.Description = m.Format(r.Message.ID, messages.Args(r.Message.Args))
+	}
+	for _, c := range r.Children {
+		localizeResult(m, c)
+	}
+}
+
+// pendingDescription returns the description of the status for a pending
+// result. It shows the progress of the most actionable blocking rule, the one
+// that needs the fewest additional approvals, so that users can see what is
+// missing without opening the details page. If no pending rule requires
+// approval, it returns the description of the result.
+func pendingDescription(m *messages.Catalog, result *common.Result) string {
+	var blocking *common.Result
+	var blockingRemaining int
+	for _, r := range leafResults(result) {
+		if r.Status != common.StatusPending || r.Error != nil || r.Required <= 0 {
+			continue
+		}
+		remaining := r.Required - countedApprovals(r)
+		if remaining <= 0 {
+			// the rule is pending for another reason, like code owners
+			continue
+		}
+		if blocking == nil || remaining < blockingRemaining {
+			blocking, blockingRemaining = r, remaining
+		}
+	}
+	if blocking == nil {
+		return result.Description
+	}
+
+	desc := m.Format(messages.StatusRuleProgress, messages.Args{
+		"Rule":      blocking.Name,
+		"Approved":  countedApprovals(blocking),
+		"Required":  blocking.Required,
+		"Approvers": statusApprovers(m, blocking.Requires),
+	})
+	return truncateDescription(desc)
+}
+
+func countedApprovals(r *common.Result) int {
+	n := 0
+	for _, d := range r.Approvals {
+		if d.Counted {
+			n++
+		}
+	}
+	return n
+}
+
+// statusApprovers briefly describes the actors who can approve a rule, using
+// the mention syntax for users and teams.
+func statusApprovers(m *messages.Catalog, a *common.Actors) string {
+	if a == nil {
+		return ""
+	}
+
+	var parts []string
+	for _, u := range a.Users {
+		parts = append(parts, "@"+u)
+	}
+	for _, t := range a.Teams {
+		parts = append(parts, "@"+t)
+	}
+	for _, o := range a.Organizations {
+		parts = append(parts, m.Format(messages.StatusApproverOrganization, messages.Args{"Name": o}))
+	}
+	for _, g := range a.Groups {
+		parts = append(parts, g)
+	}
+	for _, app := range a.Apps {
+		parts = append(parts, "@"+app)
+	}
+	if a.Admins {
+		parts = append(parts, m.Text(messages.StatusApproverAdmins))
+	}
+	if a.WriteCollaborators {
+		parts = append(parts, m.Text(messages.StatusApproverWriters))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// truncateDescription shortens a description to the maximum length accepted
+// by GitHub without splitting a character.
+func truncateDescription(desc string) string {
+	const ellipsis = "..."
+	if len(desc) <= maxStatusDescription {
+		return desc
+	}
+
+	end := maxStatusDescription - len(ellipsis)
+	for end > 0 && !isRuneStart(desc[end]) {
+		end--
+	}
+	return desc[:end] + ellipsis
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
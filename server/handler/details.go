@@ -15,6 +15,8 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -24,89 +26,178 @@ import (
 	"github.com/alexedwards/scs"
 	"github.com/bluekeyes/templatetree"
 	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
 	"goji.io/pat"
 
 	"github.com/palantir/policy-bot/policy"
 	"github.com/palantir/policy-bot/policy/common"
 	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/palantir/policy-bot/server/messages"
+	"github.com/palantir/policy-bot/server/rbac"
+	"github.com/palantir/policy-bot/server/results"
 )
 
 type Details struct {
-	Base
+	// Apps are the apps that share the GitHub instance used for login. The
+	// page uses the first app that is installed for the repository owner.
+	Apps []*App
+
+	// History, if set, stores recent evaluations that are shown as a
+	// timeline on the page and served by Evaluation.
+	History history.Store
+
+	// Roles, if set, limits simulations to users with the simulator role.
+	Roles *rbac.Authorizer
+
 	Sessions  *scs.Manager
 	Templates templatetree.HTMLTree
 }
 
-func (h *Details) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
-	ctx := r.Context()
+// detailsRequest is a request for the details of a pull request by a user
+// who can read the repository.
+type detailsRequest struct {
+	Owner  string
+	Repo   string
+	Number int
+	User   string
 
-	owner := pat.Param(r, "owner")
-	repo := pat.Param(r, "repo")
+	App          *App
+	Installation githubapp.Installation
+	Client       *github.Client
+}
 
+// authorize returns the details request for the pull request in the route.
+// If the request is invalid or the user cannot read the repository, it writes
+// an error response and returns nil.
+func (h *Details) authorize(w http.ResponseWriter, r *http.Request) (*detailsRequest, error) {
 	number, err := strconv.Atoi(pat.Param(r, "number"))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("invalid pull request number: %v", err), http.StatusBadRequest)
-		return nil
+		return nil, nil
 	}
 
-	installation, err := h.Installations.GetByOwner(ctx, owner)
+	req, readable, err := newDetailsRequest(r, h.Apps, h.Sessions, pat.Param(r, "owner"), pat.Param(r, "repo"), number)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !readable {
+		req.notFound(w)
+		return nil, nil
 	}
+	return req, nil
+}
 
-	client, err := h.ClientCreator.NewInstallationClient(installation.ID)
-	if err != nil {
-		return errors.Wrap(err, "failed to create github client")
+// newDetailsRequest returns the details request for a pull request and
+// whether the logged in user can read the repository.
+func newDetailsRequest(r *http.Request, apps []*App, sessions *scs.Manager, owner, repo string, number int) (*detailsRequest, bool, error) {
+	ctx := r.Context()
+
+	req := &detailsRequest{
+		Owner:  owner,
+		Repo:   repo,
+		Number: number,
 	}
 
-	v4client, err := h.ClientCreator.NewInstallationV4Client(installation.ID)
+	var err error
+	req.App, req.Installation, err = FindInstallation(ctx, apps, req.Owner)
 	if err != nil {
-		return errors.Wrap(err, "failed to create github client")
+		return nil, false, err
 	}
 
-	sess := h.Sessions.Load(r)
-	user, err := sess.GetString(SessionKeyUsername)
+	req.Client, err = req.App.Base.NewInstallationClient(req.Installation.ID)
 	if err != nil {
-		return errors.Wrap(err, "failed to read sessions")
+		return nil, false, errors.Wrap(err, "failed to create github client")
 	}
 
-	level, _, err := client.Repositories.GetPermissionLevel(ctx, owner, repo, user)
+	sess := sessions.Load(r)
+	req.User, err = sess.GetString(SessionKeyUsername)
 	if err != nil {
-		if isNotFound(err) {
-			http.Error(w, fmt.Sprintf("not found: %s/%s#%d", owner, repo, number), http.StatusNotFound)
-			return nil
-		}
-		return errors.Wrap(err, "failed to get user permission level")
+		return nil, false, errors.Wrap(err, "failed to read sessions")
 	}
 
 	// if the user does not have permission, pretend the repo/PR doesn't exist
-	if level.GetPermission() == "none" {
-		http.Error(w, fmt.Sprintf("not found: %s/%s#%d", owner, repo, number), http.StatusNotFound)
-		return nil
+	readable, err := canRead(ctx, req.Client, req.Owner, req.Repo, req.User)
+	if err != nil {
+		return nil, false, err
+	}
+	return req, readable, nil
+}
+
+// loadPullRequest loads the pull request of the request. It returns a nil pull
+// request if the pull request does not exist.
+func (req *detailsRequest) loadPullRequest(ctx context.Context) (context.Context, *github.PullRequest, pull.Context, error) {
+	base := req.App.Base
+
+	v4client, err := base.NewInstallationV4Client(req.Installation.ID)
+	if err != nil {
+		return ctx, nil, nil, errors.Wrap(err, "failed to create github client")
 	}
 
-	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	pr, _, err := req.Client.PullRequests.Get(ctx, req.Owner, req.Repo, req.Number)
 	if err != nil {
 		if isNotFound(err) {
-			http.Error(w, fmt.Sprintf("not found: %s/%s#%d", owner, repo, number), http.StatusNotFound)
-			return nil
+			return ctx, nil, nil, nil
 		}
-		return errors.Wrap(err, "failed to get pull request")
+		return ctx, nil, nil, errors.Wrap(err, "failed to get pull request")
 	}
 
-	ctx, _ = h.PreparePRContext(ctx, installation.ID, pr)
+	ctx, _ = base.PreparePRContext(ctx, req.Installation.ID, pr)
 
-	mbrCtx := NewCrossOrgMembershipContext(ctx, client, owner, h.Installations, h.ClientCreator)
-	prctx, err := pull.NewGitHubContext(ctx, mbrCtx, client, v4client, pull.Locator{
-		Owner:  owner,
-		Repo:   repo,
-		Number: number,
+	prctx, err := base.NewPullContext(ctx, req.Client, v4client, pull.Locator{
+		Owner:  req.Owner,
+		Repo:   req.Repo,
+		Number: req.Number,
 		Value:  pr,
 	})
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+	return ctx, pr, prctx, nil
+}
+
+func (req *detailsRequest) notFound(w http.ResponseWriter) {
+	http.Error(w, fmt.Sprintf("not found: %s/%s#%d", req.Owner, req.Repo, req.Number), http.StatusNotFound)
+}
+
+func (h *Details) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	req, err := h.authorize(w, r)
+	if req == nil || err != nil {
+		return err
+	}
+
+	canSimulate, err := h.Roles.UserAllowed(r.Context(), req.User, rbac.RoleSimulator)
+	if err != nil {
+		return err
+	}
+
+	sim, err := parseSimulation(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	if sim != nil && !canSimulate {
+		http.Error(w, "simulations require the simulator role", http.StatusForbidden)
+		return nil
+	}
+
+	owner, repo, number := req.Owner, req.Repo, req.Number
+	base, client, user := req.App.Base, req.Client, req.User
+
+	ctx := r.Context()
+	if sim != nil && sim.Policy != "" {
+		ctx = withLinkedIssueReader(ctx, user)
+	}
+
+	ctx, pr, prctx, err := req.loadPullRequest(ctx)
 	if err != nil {
 		return err
 	}
+	if pr == nil {
+		req.notFound(w)
+		return nil
+	}
 
 	var data struct {
 		Error       error
@@ -114,39 +205,82 @@ func (h *Details) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 		PullRequest *github.PullRequest
 		User        string
 		PolicyURL   string
+		Timeline    []history.Entry
+
+		// Simulation is set if the result is for hypothetical changes
+		Simulation  *simulation
+		CanSimulate bool
+		Approvers   []simulationOption
+		Files       []simulationOption
 	}
 
 	data.PullRequest = pr
 	data.User = user
+	data.Simulation = sim
+	data.CanSimulate = canSimulate
+
+	if h.History != nil && !wantsJSON(r) {
+		evals, err := h.History.List(ctx, owner, repo, number)
+		if err != nil {
+			return err
+		}
+		data.Timeline = history.Timeline(evals)
+	}
 
-	config, err := h.ConfigFetcher.ConfigForPR(ctx, prctx, client)
+	// render errors and results as JSON when requested
+	render := func() error {
+		if !wantsJSON(r) {
+			return h.render(w, data)
+		}
+		return writeDetailsJSON(w, detailsJSON(base.Messages, prctx, data.Result, data.Error), fmt.Sprintf("%s-%s-%d.json", owner, repo, number))
+	}
+
+	config, err := base.ConfigFetcher.ConfigForPR(ctx, prctx, client)
 	data.PolicyURL = getPolicyURL(pr, config)
 
 	if err != nil {
 		data.Error = errors.WithMessage(err, fmt.Sprintf("Failed to fetch configuration at ref=%s", config.Ref))
-		return h.render(w, data)
+		return render()
+	}
+
+	if sim != nil && sim.Policy != "" {
+		config.Error = nil
+		if config.Config, err = parseSimulatedPolicy(sim.Policy, base.PullOpts.ForRepository(owner, repo).CommentKeywords); err != nil {
+			data.Error = errors.WithMessage(err, "invalid simulated policy")
+			return render()
+		}
 	}
 
 	if config.Missing() {
-		data.Error = errors.New(config.Description())
-		return h.render(w, data)
+		data.Error = errors.New(config.Description(base.Messages))
+		return render()
 	}
 
 	if config.Invalid() {
-		data.Error = errors.WithMessage(config.Error, config.Description())
-		return h.render(w, data)
+		data.Error = errors.WithMessage(config.Error, config.Description(base.Messages))
+		return render()
 	}
 
 	evaluator, err := policy.ParsePolicy(config.Config)
 	if err != nil {
 		data.Error = errors.WithMessage(err, fmt.Sprintf("invalid policy at ref \"%s\"", config.Ref))
-		return h.render(w, data)
+		return render()
 	}
 
-	result := evaluator.Evaluate(ctx, prctx)
+	evalctx := prctx
+	if sim != nil {
+		evalctx = pull.WithHypothetical(prctx, sim.Hypothetical)
+	}
+
+	result := evaluator.Evaluate(ctx, evalctx)
+	localizeResult(base.Messages, &result)
 	data.Result = &result
 
-	return h.render(w, data)
+	if !wantsJSON(r) {
+		data.Approvers = simulationApprovers(&result, sim)
+		data.Files = simulationFiles(prctx, sim)
+	}
+	return render()
 }
 
 func (h *Details) render(w http.ResponseWriter, data interface{}) error {
@@ -155,6 +289,71 @@ func (h *Details) render(w http.ResponseWriter, data interface{}) error {
 	return h.Templates.ExecuteTemplate(w, "details.html.tmpl", data)
 }
 
+// Evaluation serves a stored evaluation of a pull request. The evaluation does
+// not change when the pull request is evaluated again, so its URL is a
+// permalink.
+func (h *Details) Evaluation(w http.ResponseWriter, r *http.Request) error {
+	req, err := h.authorize(w, r)
+	if req == nil || err != nil {
+		return err
+	}
+
+	var e *history.Evaluation
+	if h.History != nil {
+		if e, err = h.History.Get(r.Context(), pat.Param(r, "id")); err != nil {
+			return err
+		}
+	}
+	if e == nil || results.Key(e.Owner, e.Repo, e.Number) != results.Key(req.Owner, req.Repo, req.Number) {
+		http.Error(w, fmt.Sprintf("evaluation not found: %s", pat.Param(r, "id")), http.StatusNotFound)
+		return nil
+	}
+
+	if wantsJSON(r) {
+		return writeDetailsJSON(w, e, fmt.Sprintf("%s-%s-%d-%s.json", e.Owner, e.Repo, e.Number, e.ID))
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	return h.Templates.ExecuteTemplate(w, "evaluation.html.tmpl", struct {
+		Evaluation *history.Evaluation
+		User       string
+	}{e, req.User})
+}
+
+// wantsJSON returns true if the request asks for the JSON form of a page with
+// the "format=json" query parameter.
+func wantsJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "json"
+}
+
+// detailsJSON returns the stored form of a live evaluation.
+func detailsJSON(m *messages.Catalog, prctx pull.Context, result *common.Result, err error) results.PullRequest {
+	var state, description string
+	switch {
+	case err != nil:
+		state, description = "error", err.Error()
+	case result.Error != nil:
+		state, description = "error", result.Error.Error()
+	default:
+		if state, description, err = resultStatus(m, result); err != nil {
+			state, description = "error", err.Error()
+		}
+	}
+
+	return newResultPullRequest(prctx, result, state, description)
+}
+
+func writeDetailsJSON(w http.ResponseWriter, v interface{}, filename string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
 func getPolicyURL(pr *github.PullRequest, config FetchedConfig) string {
 	base := pr.GetBase().GetRepo().GetHTMLURL()
 	if u, _ := url.Parse(base); u != nil {
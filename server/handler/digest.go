@@ -0,0 +1,177 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// AwaitingPullRequest is an open pull request with approval rules that are
+// waiting for approval.
+type AwaitingPullRequest struct {
+	Owner     string
+	Repo      string
+	Number    int
+	Title     string
+	Author    string
+	URL       string
+	CreatedAt time.Time
+
+	// Rules are the names of the pending rules
+	Rules []string
+}
+
+// AwaitingApproval finds the open pull requests in all installations that
+// have a pending policy status and returns them grouped by the teams that can
+// approve their pending rules.
+func (b *Base) AwaitingApproval(ctx context.Context) (map[string][]*AwaitingPullRequest, error) {
+	logger := zerolog.Ctx(ctx)
+
+	installations, err := b.Installations.ListAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list installations")
+	}
+
+	teams := make(map[string][]*AwaitingPullRequest)
+	for _, installation := range installations {
+		if err := b.findAwaitingApproval(ctx, installation.ID, teams); err != nil {
+			logger.Error().Err(err).Msgf("Failed to find pull requests awaiting approval in installation %d", installation.ID)
+		}
+	}
+	return teams, nil
+}
+
+func (b *Base) findAwaitingApproval(ctx context.Context, installationID int64, teams map[string][]*AwaitingPullRequest) error {
+	logger := zerolog.Ctx(ctx)
+
+	client, err := b.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	repos, err := listInstallationRepositories(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	for _, repo := range repos {
+		owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+		prs, err := listOpenPullRequests(ctx, client, owner, name)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to list pull requests in %s/%s", owner, name)
+			continue
+		}
+
+		for _, pr := range prs {
+			if err := b.addAwaitingApproval(ctx, client, installationID, pr, teams); err != nil {
+				logger.Error().Err(err).Msgf("Failed to evaluate %s/%s#%d", owner, name, pr.GetNumber())
+			}
+		}
+	}
+	return nil
+}
+
+func (b *Base) addAwaitingApproval(ctx context.Context, client *github.Client, installationID int64, pr *github.PullRequest, teams map[string][]*AwaitingPullRequest) error {
+	owner, repo := pr.GetBase().GetRepo().GetOwner().GetLogin(), pr.GetBase().GetRepo().GetName()
+
+	// only evaluate pull requests that are pending to limit API requests
+	state, _, err := b.policyState(ctx, client, owner, repo, pr.GetBase().GetRef(), pr.GetHead().GetSHA())
+	if err != nil {
+		return err
+	}
+	if state != "pending" {
+		return nil
+	}
+
+	v4client, err := b.NewInstallationV4Client(installationID)
+	if err != nil {
+		return err
+	}
+
+	prctx, err := b.NewPullContext(ctx, client, v4client, pull.Locator{
+		Owner:  owner,
+		Repo:   repo,
+		Number: pr.GetNumber(),
+		Value:  pr,
+	})
+	if err != nil {
+		return err
+	}
+
+	fetchedConfig, err := b.ConfigFetcher.ConfigForPR(ctx, prctx, client)
+	if err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("failed to fetch policy: %s", fetchedConfig))
+	}
+	if fetchedConfig.Missing() || fetchedConfig.Invalid() {
+		return nil
+	}
+
+	evaluator, err := policy.ParsePolicy(fetchedConfig.Config)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse policy")
+	}
+
+	result := evaluator.Evaluate(ctx, prctx)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "failed to evaluate policy")
+	}
+
+	awaiting := make(map[string]*AwaitingPullRequest)
+	for _, rule := range pendingResults(&result) {
+		if rule.Requires == nil {
+			continue
+		}
+		for _, team := range rule.Requires.Teams {
+			a, ok := awaiting[team]
+			if !ok {
+				a = &AwaitingPullRequest{
+					Owner:     owner,
+					Repo:      repo,
+					Number:    pr.GetNumber(),
+					Title:     pr.GetTitle(),
+					Author:    pr.GetUser().GetLogin(),
+					URL:       pr.GetHTMLURL(),
+					CreatedAt: pr.GetCreatedAt(),
+				}
+				awaiting[team] = a
+				teams[team] = append(teams[team], a)
+			}
+			a.Rules = append(a.Rules, rule.Name)
+		}
+	}
+	return nil
+}
+
+// pendingResults returns the rule results in a result that are pending.
+func pendingResults(r *common.Result) []*common.Result {
+	var results []*common.Result
+	for _, rule := range leafResults(r) {
+		if rule.Status == common.StatusPending {
+			results = append(results, rule)
+		}
+	}
+	return results
+}
@@ -0,0 +1,234 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	policybotv1 "github.com/palantir/policy-bot/api/policybot/v1"
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// EvaluationService implements the gRPC evaluation service. Like the
+// simulation API, requests use the first app that is installed for the
+// owner.
+type EvaluationService struct {
+	Apps []*App
+}
+
+// Evaluate evaluates a pull request like a webhook would and returns the
+// status that was posted. It waits for the evaluation instead of queueing
+// it.
+func (s *EvaluationService) Evaluate(ctx context.Context, req *policybotv1.EvaluateRequest) (*policybotv1.EvaluateResponse, error) {
+	dr, err := s.newRequest(ctx, req.PullRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, _, err := dr.Client.PullRequests.Get(ctx, dr.Owner, dr.Repo, dr.Number)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, policybotv1.Errorf(policybotv1.NotFound, "not found: %s/%s#%d", dr.Owner, dr.Repo, dr.Number)
+		}
+		return nil, errors.Wrap(err, "failed to get pull request")
+	}
+
+	base := dr.App.Base
+	ctx, _ = base.PreparePRContext(ctx, dr.Installation.ID, pr)
+	ctx, obs := withEvaluationObserver(ctx)
+
+	loc := pull.Locator{Owner: dr.Owner, Repo: dr.Repo, Number: dr.Number, Value: pr}
+	if err := base.Evaluate(ctx, dr.Installation.ID, loc); err != nil {
+		return nil, err
+	}
+	if obs.State == "" {
+		return nil, policybotv1.Errorf(policybotv1.FailedPrecondition,
+			"no status was posted for %s/%s#%d: the repository has no policy or the evaluation was superseded or deferred", dr.Owner, dr.Repo, dr.Number)
+	}
+
+	return &policybotv1.EvaluateResponse{
+		SHA:          obs.SHA,
+		PolicySource: obs.PolicySource,
+		Result:       newAPIResult(obs.Result),
+		State:        obs.State,
+		Description:  obs.Description,
+	}, nil
+}
+
+// Simulate evaluates a pull request with hypothetical changes or an
+// alternate policy. Like the simulation API, it never posts a status.
+func (s *EvaluationService) Simulate(ctx context.Context, req *policybotv1.SimulateRequest) (*policybotv1.EvaluateResponse, error) {
+	dr, err := s.newRequest(ctx, req.PullRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	sim := &simulation{
+		Hypothetical: pull.Hypothetical{
+			Approvers:      req.Approvers,
+			UnchangedFiles: req.UnchangedFiles,
+			AddedLabels:    req.AddedLabels,
+			RemovedLabels:  req.RemovedLabels,
+		},
+		Policy: strings.TrimSpace(req.Policy),
+	}
+
+	ctx, pr, prctx, err := dr.loadPullRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pr == nil {
+		return nil, policybotv1.Errorf(policybotv1.NotFound, "not found: %s/%s#%d", dr.Owner, dr.Repo, dr.Number)
+	}
+
+	base := dr.App.Base
+	config, result, err := evaluateSimulation(ctx, base, dr.Client, prctx, sim)
+
+	res := &policybotv1.EvaluateResponse{SHA: prctx.HeadSHA()}
+	if sim.Policy == "" {
+		res.PolicySource = config.String()
+	}
+
+	switch {
+	case err != nil:
+		res.State, res.Description = "error", err.Error()
+	case result.Error != nil:
+		res.State, res.Description = "error", result.Error.Error()
+	default:
+		if res.State, res.Description, err = resultStatus(base.Messages, result); err != nil {
+			res.State, res.Description = "error", err.Error()
+		}
+	}
+	res.Result = newAPIResult(result)
+	return res, nil
+}
+
+// Validate parses a policy and returns any errors, like the validate
+// command. Remote policies are invalid, because they must be validated in
+// the repository they reference.
+func (s *EvaluationService) Validate(ctx context.Context, req *policybotv1.ValidateRequest) (*policybotv1.ValidateResponse, error) {
+	invalid := func(err error) (*policybotv1.ValidateResponse, error) {
+		return &policybotv1.ValidateResponse{Errors: []string{err.Error()}}, nil
+	}
+
+	b := []byte(req.Policy)
+	if err := policy.DefaultLimits.Check(b); err != nil {
+		return invalid(err)
+	}
+	if policy.IsRemoteConfig(b) {
+		return invalid(errors.New("remote policies cannot be validated; validate the referenced policy instead"))
+	}
+
+	config, err := policy.ParseConfigWithLimits(b, policy.DefaultLimits)
+	if err != nil {
+		return invalid(err)
+	}
+	if _, err := policy.ParsePolicy(config); err != nil {
+		return invalid(err)
+	}
+
+	res := &policybotv1.ValidateResponse{Valid: true}
+	for _, c := range config.Upgrades {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("legacy construct at %s; run 'policy-bot convert' to upgrade", c))
+	}
+	return res, nil
+}
+
+// newRequest returns the details request for a pull request using the first
+// app installed for the owner.
+func (s *EvaluationService) newRequest(ctx context.Context, pr *policybotv1.PullRequest) (*detailsRequest, error) {
+	if pr == nil || pr.Owner == "" || pr.Repo == "" || pr.Number <= 0 {
+		return nil, policybotv1.Errorf(policybotv1.InvalidArgument, "owner, repo, and number are required")
+	}
+
+	req := &detailsRequest{Owner: pr.Owner, Repo: pr.Repo, Number: int(pr.Number)}
+
+	var err error
+	req.App, req.Installation, err = FindInstallation(ctx, s.Apps, pr.Owner)
+	if err != nil {
+		if _, notFound := errors.Cause(err).(githubapp.InstallationNotFound); notFound {
+			return nil, policybotv1.Errorf(policybotv1.NotFound, "no installation for %s", pr.Owner)
+		}
+		return nil, err
+	}
+
+	req.Client, err = req.App.Base.NewInstallationClient(req.Installation.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create github client")
+	}
+	return req, nil
+}
+
+func newAPIResult(r *common.Result) *policybotv1.Result {
+	if r == nil {
+		return nil
+	}
+
+	res := &policybotv1.Result{
+		Name:        r.Name,
+		Description: r.Description,
+		Status:      apiStatus(r.Status),
+		Labels:      r.Labels,
+		Required:    int32(r.Required),
+	}
+	if r.Error != nil {
+		res.Status = policybotv1.StatusError
+		res.Error = r.Error.Error()
+	}
+	for _, a := range r.Approvals {
+		res.Approvals = append(res.Approvals, &policybotv1.ApprovalDecision{
+			User:      a.User,
+			CreatedAt: a.CreatedAt,
+			Counted:   a.Counted,
+			Reason:    a.Reason,
+		})
+	}
+	if r.Requires != nil {
+		res.Requires = &policybotv1.Actors{
+			Users:              r.Requires.Users,
+			Teams:              r.Requires.Teams,
+			Organizations:      r.Requires.Organizations,
+			Groups:             r.Requires.Groups,
+			Admins:             r.Requires.Admins,
+			WriteCollaborators: r.Requires.WriteCollaborators,
+			Apps:               r.Requires.Apps,
+		}
+	}
+	for _, c := range r.Children {
+		res.Children = append(res.Children, newAPIResult(c))
+	}
+	return res
+}
+
+func apiStatus(s common.EvaluationStatus) policybotv1.Status {
+	switch s {
+	case common.StatusSkipped:
+		return policybotv1.StatusSkipped
+	case common.StatusPending:
+		return policybotv1.StatusPending
+	case common.StatusApproved:
+		return policybotv1.StatusApproved
+	case common.StatusDisapproved:
+		return policybotv1.StatusDisapproved
+	}
+	return policybotv1.StatusUnspecified
+}
@@ -16,18 +16,18 @@ package handler
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strings"
 
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
-	"gopkg.in/yaml.v2"
 
 	"github.com/palantir/policy-bot/policy"
 	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/messages"
 )
 
 type FetchedConfig struct {
@@ -37,6 +37,9 @@ type FetchedConfig struct {
 	Path   string
 	Config *policy.Config
 	Error  error
+
+	// Hash is the SHA-256 hash of the policy content, if the policy exists
+	Hash string
 }
 
 func (fc FetchedConfig) Missing() bool {
@@ -55,18 +58,26 @@ func (fc FetchedConfig) String() string {
 	return fmt.Sprintf("%s/%s ref=%s", fc.Owner, fc.Repo, fc.Ref)
 }
 
-func (fc FetchedConfig) Description() string {
+func (fc FetchedConfig) Description(m *messages.Catalog) string {
+	args := messages.Args{"Ref": fc.Ref}
 	switch {
 	case fc.Missing():
-		return fmt.Sprintf("No policy found at ref=%s", fc.Ref)
+		return m.Format(messages.StatusNoPolicy, args)
 	case fc.Invalid():
-		return fmt.Sprintf("Invalid configuration defined by ref=%s", fc.Ref)
+		return m.Format(messages.StatusInvalidConfig, args)
 	}
-	return fmt.Sprintf("Valid policy found for ref=%s", fc.Ref)
+	return m.Format(messages.StatusValidPolicy, args)
 }
 
 type ConfigFetcher struct {
-	PolicyPath string
+	Options *PullEvaluationOptions
+
+	// RemoteClient, if set, creates the client that reads remote policies.
+	// Remote policies must then be owned by the owner of the pull request or
+	// an owner allowed by Options. Otherwise, remote policies are read with
+	// the client for the pull request, which must be able to access the
+	// remote repository.
+	RemoteClient func(ctx context.Context, owner, repo string) (*github.Client, error)
 }
 
 // ConfigForPR fetches the policy configuration for a PR. It returns an error
@@ -79,10 +90,11 @@ func (cf *ConfigFetcher) ConfigForPR(ctx context.Context, prctx pull.Context, cl
 		Owner: prctx.RepositoryOwner(),
 		Repo:  prctx.RepositoryName(),
 		Ref:   base,
-		Path:  cf.PolicyPath,
 	}
+	opts := cf.Options.ForRepository(fc.Owner, fc.Repo)
+	fc.Path = opts.PolicyPath
 
-	configBytes, err := cf.fetchConfig(ctx, client, fc.Owner, fc.Repo, fc.Ref)
+	configBytes, err := cf.fetchConfig(ctx, client, fc.Owner, fc.Repo, fc.Ref, fc.Path)
 	if err != nil {
 		return fc, err
 	}
@@ -90,49 +102,60 @@ func (cf *ConfigFetcher) ConfigForPR(ctx context.Context, prctx pull.Context, cl
 	if configBytes == nil {
 		return fc, nil
 	}
+	fc.Hash = fmt.Sprintf("%x", sha256.Sum256(configBytes))
 
-	config, err := cf.unmarshalConfig(configBytes)
+	config, err := policy.ParseConfigWithLimits(configBytes, policy.DefaultLimits)
 	if err != nil {
 		fc.Error = err
 		return fc, nil
 	}
+	config.AddKeywords(opts.CommentKeywords)
+	if len(config.Upgrades) > 0 {
+		zerolog.Ctx(ctx).Debug().Msgf("Upgraded %d legacy constructs in policy %s", len(config.Upgrades), fc.Path)
+	}
 
 	fc.Config = config
 	return fc, nil
 }
 
-func (cf *ConfigFetcher) fetchConfig(ctx context.Context, client *github.Client, owner, repo, ref string) ([]byte, error) {
+func (cf *ConfigFetcher) fetchConfig(ctx context.Context, client *github.Client, owner, repo, ref, policyPath string) ([]byte, error) {
 	logger := zerolog.Ctx(ctx)
 
-	configBytes, err := cf.fetchConfigContents(ctx, client, owner, repo, ref, cf.PolicyPath)
+	configBytes, err := cf.fetchConfigContents(ctx, client, owner, repo, ref, policyPath)
 	if err != nil {
 		return nil, err
 	}
 
-	var rawConfig map[string]interface{}
-	_ = yaml.Unmarshal(configBytes, &rawConfig)
-
-	if _, isRemote := rawConfig["remote"]; !isRemote {
+	// policies that exceed the limits are returned as-is so that parsing
+	// them marks the policy as invalid
+	if policy.DefaultLimits.Check(configBytes) != nil || !policy.IsRemoteConfig(configBytes) {
 		logger.Debug().Msgf("Found local policy config in %s/%s@%s", owner, repo, ref)
 		return configBytes, nil
 	}
 	logger.Debug().Msgf("Found reference to remote policy in %s/%s@%s", owner, repo, ref)
 
-	var remoteConfig policy.RemoteConfig
-	if err := yaml.UnmarshalStrict(configBytes, &remoteConfig); err != nil {
-		return nil, errors.Wrap(err, "failed to unmarshal reference to remote policy")
+	remoteConfig, err := policy.ParseRemoteConfig(configBytes)
+	if err != nil {
+		return nil, err
 	}
 
 	if remoteConfig.Path == "" {
-		remoteConfig.Path = cf.PolicyPath
+		remoteConfig.Path = policyPath
 	}
 
-	remoteParts := strings.Split(remoteConfig.Remote, "/")
-	if len(remoteParts) != 2 {
-		return nil, errors.Errorf("failed to parse remote config location from %q", remoteConfig.Remote)
+	remoteOwner, remoteRepo, err := remoteConfig.Repository()
+	if err != nil {
+		return nil, err
 	}
 
-	remoteOwner, remoteRepo := remoteParts[0], remoteParts[1]
+	if cf.RemoteClient != nil {
+		if !cf.Options.RemoteOwnerAllowed(owner, remoteOwner) {
+			return nil, errors.Errorf("remote policy repository %s/%s is not owned by %s or an allowed remote owner", remoteOwner, remoteRepo, owner)
+		}
+		if client, err = cf.RemoteClient(ctx, remoteOwner, remoteRepo); err != nil {
+			return nil, err
+		}
+	}
 
 	remotePolicyBytes, err := cf.fetchConfigContents(ctx, client, remoteOwner, remoteRepo, remoteConfig.Ref, remoteConfig.Path)
 	if err != nil {
@@ -191,15 +214,6 @@ func (cf *ConfigFetcher) fetchConfigContents(ctx context.Context, client *github
 	return []byte(content), nil
 }
 
-func (cf *ConfigFetcher) unmarshalConfig(bytes []byte) (*policy.Config, error) {
-	var config policy.Config
-	if err := yaml.UnmarshalStrict(bytes, &config); err != nil {
-		return nil, errors.Wrapf(err, "failed to unmarshall policy")
-	}
-
-	return &config, nil
-}
-
 func isTooLargeError(errorResponse *github.ErrorResponse) bool {
 	for _, error := range errorResponse.Errors {
 		if error.Code == "too_large" {
@@ -20,6 +20,9 @@ import (
 	"strings"
 
 	"github.com/bluekeyes/templatetree"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/messages"
 )
 
 const (
@@ -32,9 +35,30 @@ type FilesConfig struct {
 	Templates string `yaml:"templates"`
 }
 
-func LoadTemplates(c *FilesConfig) (templatetree.HTMLTree, error) {
+// LoadTemplates loads the page templates. Templates format messages from the
+// catalog with the "msg" function, which takes a message ID and then pairs of
+// argument names and values.
+func LoadTemplates(c *FilesConfig, m *messages.Catalog) (templatetree.HTMLTree, error) {
 	root := template.New("root").Funcs(template.FuncMap{
 		"titlecase": strings.Title,
+		"age":       formatAge,
+		"join":      strings.Join,
+		"locale":    m.Locale,
+		"state":     m.State,
+		"msg": func(id string, pairs ...interface{}) (string, error) {
+			if len(pairs)%2 != 0 {
+				return "", errors.Errorf("message %q has an odd number of arguments", id)
+			}
+			args := make(messages.Args, len(pairs)/2)
+			for i := 0; i < len(pairs); i += 2 {
+				name, ok := pairs[i].(string)
+				if !ok {
+					return "", errors.Errorf("message %q has a non-string argument name", id)
+				}
+				args[name] = pairs[i+1]
+			}
+			return m.Format(id, args), nil
+		},
 	})
 
 	dir := c.Templates
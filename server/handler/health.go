@@ -15,16 +15,31 @@
 package handler
 
 import (
+	"context"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/palantir/go-baseapp/baseapp"
 
 	"github.com/palantir/policy-bot/version"
 )
 
+const (
+	DefaultReadinessTimeout  = 5 * time.Second
+	DefaultReadinessCacheTTL = 10 * time.Second
+)
+
 type HealthCheck struct {
-	Status  string `json:"status"`
-	Version string `json:"version"`
+	Status     string                     `json:"status"`
+	Version    string                     `json:"version"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+type ComponentStatus struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
 }
 
 func Health() http.Handler {
@@ -32,3 +47,93 @@ func Health() http.Handler {
 		baseapp.WriteJSON(w, http.StatusOK, &HealthCheck{Status: "ok", Version: version.GetVersion()})
 	})
 }
+
+// ReadinessCheck verifies that a dependency of the server is available.
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Readiness reports whether the server can evaluate pull requests by running
+// checks against its dependencies. Results are cached briefly so that
+// frequent probes do not consume GitHub rate limits.
+type Readiness struct {
+	Checks   []ReadinessCheck
+	Timeout  time.Duration
+	CacheTTL time.Duration
+
+	mu      sync.Mutex
+	last    *HealthCheck
+	checked time.Time
+}
+
+func (h *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	result := h.check(r.Context())
+
+	status := http.StatusOK
+	if result.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	baseapp.WriteJSON(w, status, result)
+}
+
+func (h *Readiness) check(ctx context.Context) *HealthCheck {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ttl := h.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultReadinessCacheTTL
+	}
+	if h.last != nil && time.Since(h.checked) < ttl {
+		return h.last
+	}
+
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultReadinessTimeout
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := &HealthCheck{
+		Status:     "ok",
+		Version:    version.GetVersion(),
+		Components: make(map[string]ComponentStatus, len(h.Checks)),
+	}
+
+	var wg sync.WaitGroup
+	var resultMu sync.Mutex
+	for _, c := range h.Checks {
+		wg.Add(1)
+		go func(c ReadinessCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := c.Check(checkCtx)
+			cs := ComponentStatus{Status: "ok", Duration: time.Since(start).String()}
+			if err != nil {
+				cs.Status = "error"
+				cs.Error = err.Error()
+			}
+
+			resultMu.Lock()
+			defer resultMu.Unlock()
+			result.Components[c.Name] = cs
+			if err != nil {
+				result.Status = "error"
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	// if the request ended, the checks failed because of the caller, not the
+	// dependencies, so the result must not be reused by other probes
+	if ctx.Err() != nil {
+		return result
+	}
+
+	h.last = result
+	h.checked = time.Now()
+	return result
+}
@@ -0,0 +1,267 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/incomplete"
+	"github.com/palantir/policy-bot/server/messages"
+)
+
+const (
+	// MaxIncompleteAttempts is the number of consecutive evaluations of a pull
+	// request that can be stopped by rate limits or transient errors before
+	// the error is reported.
+	MaxIncompleteAttempts = 5
+
+	// DefaultIncompleteInterval is how often an IncompleteRetrier checks for
+	// retries that are due.
+	DefaultIncompleteInterval = 30 * time.Second
+
+	// rateLimitRetryDelay is used when a rate limit error does not say when
+	// the limit resets
+	rateLimitRetryDelay = 10 * time.Minute
+
+	// transientRetryDelay is the delay after the first transient error; it
+	// doubles for each additional attempt
+	transientRetryDelay = time.Minute
+)
+
+// retryTime returns when to retry an evaluation that was stopped by err after
+// the given number of attempts. It returns false if err is not caused by a
+// rate limit or a transient error. Because GraphQL errors only have a
+// message, the reset time of a GraphQL rate limit comes from usage.
+func retryTime(err error, usage pull.GraphQLUsage, attempts int, now time.Time) (time.Time, bool) {
+	backoff := now.Add(transientRetryDelay << uint(attempts-1))
+
+	switch cause := errors.Cause(err).(type) {
+	case *github.RateLimitError:
+		if reset := cause.Rate.Reset.Time; reset.After(now) {
+			return reset, true
+		}
+		return now.Add(rateLimitRetryDelay), true
+	case *github.AbuseRateLimitError:
+		if cause.RetryAfter != nil {
+			return now.Add(*cause.RetryAfter), true
+		}
+		return now.Add(rateLimitRetryDelay), true
+	case *github.AcceptedError:
+		return backoff, true
+	case *github.ErrorResponse:
+		if cause.Response != nil && cause.Response.StatusCode >= 500 {
+			return backoff, true
+		}
+		return time.Time{}, false
+	case net.Error:
+		if cause.Timeout() {
+			return backoff, true
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "rate limit"):
+		if usage.ResetAt.After(now) {
+			return usage.ResetAt, true
+		}
+		return now.Add(rateLimitRetryDelay), true
+	case strings.Contains(msg, "non-200 ok status code: 5"):
+		return backoff, true
+	}
+	return time.Time{}, false
+}
+
+// isIncomplete returns true if err stops an evaluation without a result, but
+// retrying the evaluation later may succeed.
+func isIncomplete(err error) bool {
+	if err == nil {
+		return false
+	}
+	_, ok := retryTime(err, pull.GraphQLUsage{}, 1, time.Now())
+	return ok
+}
+
+func (b *Base) incompleteKey(loc pull.Locator) string {
+	return incomplete.Key(b.App, loc.Owner, loc.Repo, loc.Number)
+}
+
+// deferIncomplete handles an evaluation that was stopped by a rate limit or a
+// transient error. Unless the pull request already used all of its attempts,
+// it marks the evaluation as incomplete, schedules a retry, and posts a
+// pending status if the pull request was loaded. Otherwise, it posts an error
+// status and returns the original error.
+func (b *Base) deferIncomplete(ctx context.Context, installationID int64, loc pull.Locator, client *github.Client, prctx pull.Context, cause error) error {
+	logger := zerolog.Ctx(ctx)
+
+	if b.Incomplete == nil {
+		return cause
+	}
+
+	key := b.incompleteKey(loc)
+	prev, err := b.Incomplete.Get(ctx, key)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get incomplete evaluation")
+		return cause
+	}
+
+	attempts := 1
+	if prev != nil {
+		attempts = prev.Attempts + 1
+	}
+
+	if attempts > MaxIncompleteAttempts {
+		logger.Warn().Err(cause).Msgf("Evaluation did not finish after %d attempts", MaxIncompleteAttempts)
+		b.Metrics.recordIncomplete(loc.Owner, loc.Repo, false)
+
+		if err := b.Incomplete.Clear(ctx, key); err != nil {
+			logger.Error().Err(err).Msg("Failed to clear incomplete evaluation")
+		}
+		if prctx != nil {
+			if err := b.PostStatus(ctx, prctx, client, "error", b.Messages.Text(messages.StatusIncompleteError)); err != nil {
+				logger.Error().Err(err).Msg("Failed to post status for incomplete evaluation")
+			}
+		}
+		return cause
+	}
+
+	var usage pull.GraphQLUsage
+	if ghc, ok := prctx.(*pull.GitHubContext); ok {
+		usage = ghc.GraphQLUsage()
+	}
+	retryAt, _ := retryTime(cause, usage, attempts, time.Now())
+
+	err = b.Incomplete.Mark(ctx, incomplete.Evaluation{
+		App:            b.App,
+		InstallationID: installationID,
+		Owner:          loc.Owner,
+		Repo:           loc.Repo,
+		Number:         loc.Number,
+		Attempts:       attempts,
+		RetryAt:        retryAt,
+		Reason:         cause.Error(),
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to mark incomplete evaluation")
+		return cause
+	}
+
+	logger.Warn().Err(cause).Msgf("Evaluation is incomplete after %d attempts, retrying at %s", attempts, retryAt.Format(time.RFC3339))
+	b.Metrics.recordIncomplete(loc.Owner, loc.Repo, true)
+
+	// the status request may also fail if the rate limit is exhausted, but
+	// the retry posts a status either way
+	if prctx != nil {
+		args := messages.Args{"RetryAt": retryAt.UTC().Format("15:04 MST")}
+		description := b.Messages.Format(messages.StatusIncomplete, args)
+		if u := pull.AsUnavailable(cause); u != nil {
+			args["API"] = u.API
+			description = b.Messages.Format(messages.StatusUnavailable, args)
+		}
+		if err := b.PostStatus(ctx, prctx, client, "pending", description); err != nil {
+			logger.Warn().Err(err).Msg("Failed to post status for incomplete evaluation")
+		}
+	}
+	return nil
+}
+
+// clearIncomplete removes the incomplete marker of a pull request after an
+// evaluation finishes.
+func (b *Base) clearIncomplete(ctx context.Context, loc pull.Locator) {
+	if b.Incomplete == nil {
+		return
+	}
+	if err := b.Incomplete.Clear(ctx, b.incompleteKey(loc)); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to clear incomplete evaluation")
+	}
+}
+
+// IncompleteRetrier queues incomplete evaluations when their retry time
+// passes.
+type IncompleteRetrier struct {
+	Store    incomplete.Store
+	Apps     []*App
+	Interval time.Duration
+	Logger   zerolog.Logger
+}
+
+// Start checks for retries that are due in the background until the context
+// is canceled.
+func (r *IncompleteRetrier) Start(ctx context.Context) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultIncompleteInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.retryDue(ctx, interval)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (r *IncompleteRetrier) retryDue(ctx context.Context, interval time.Duration) {
+	due, err := r.Store.Due(ctx, time.Now())
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Failed to get incomplete evaluations")
+	}
+
+	for _, e := range due {
+		logger := r.Logger.With().Str("key", e.Key()).Logger()
+
+		app := r.findApp(e.App)
+		if app == nil {
+			logger.Warn().Msg("Dropping incomplete evaluation for an unknown app")
+			continue
+		}
+
+		loc := pull.Locator{Owner: e.Owner, Repo: e.Repo, Number: e.Number}
+		if !app.Queue.Enqueue(e.InstallationID, loc) {
+			// the queue is full or draining, so try again later; the marker
+			// survives a restart if it is stored in Redis
+			e.RetryAt = time.Now().Add(interval)
+			if err := r.Store.Mark(ctx, e); err != nil {
+				logger.Error().Err(err).Msg("Failed to reschedule incomplete evaluation")
+			}
+			continue
+		}
+		logger.Debug().Msgf("Queued incomplete evaluation after %d attempts", e.Attempts)
+	}
+}
+
+func (r *IncompleteRetrier) findApp(name string) *App {
+	for _, app := range r.Apps {
+		if app.Name == name {
+			return app
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+type Installation struct {
+	Base
+	Reconciler *Reconciler
+}
+
+// installationInvalidator is implemented by client creators that cache
+// installation credentials.
+type installationInvalidator interface {
+	InvalidateInstallation(installationID int64)
+}
+
+func (h *Installation) Handles() []string {
+	return []string{"installation", "installation_repositories"}
+}
+
+// Handle installation and installation_repositories
+// https://developer.github.com/v3/activity/events/types/#installationevent
+// https://developer.github.com/v3/activity/events/types/#installationrepositoriesevent
+func (h *Installation) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var installation *github.Installation
+	var repos []*github.Repository
+
+	switch eventType {
+	case "installation":
+		var event github.InstallationEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "failed to parse installation event payload")
+		}
+		switch event.GetAction() {
+		case "created":
+		case "deleted", "suspend", "unsuspend", "new_permissions_accepted":
+			// existing tokens are either invalid or have the wrong permissions
+			if inv, ok := h.ClientCreator.(installationInvalidator); ok {
+				inv.InvalidateInstallation(event.GetInstallation().GetID())
+			}
+			return nil
+		default:
+			return nil
+		}
+		installation, repos = event.Installation, event.Repositories
+
+	case "installation_repositories":
+		var event github.InstallationRepositoriesEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "failed to parse installation repositories event payload")
+		}
+		if event.GetAction() != "added" {
+			return nil
+		}
+		installation, repos = event.Installation, event.RepositoriesAdded
+	}
+
+	// repositories in these events do not include owner details
+	owner := installation.GetAccount().GetLogin()
+	for _, r := range repos {
+		r.Owner = &github.User{Login: &owner}
+	}
+
+	// listing pull requests and statuses can take a while, so do it in the background
+	installationID := installation.GetID()
+	logger := *zerolog.Ctx(ctx)
+	go func() {
+		ctx := logger.WithContext(context.Background())
+		if err := h.Reconciler.ReconcileInstallation(ctx, installationID, repos); err != nil {
+			logger.Error().Err(err).Msgf("Failed to reconcile installation %d", installationID)
+		}
+	}()
+
+	return nil
+}
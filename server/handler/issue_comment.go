@@ -27,6 +27,7 @@ import (
 	"github.com/palantir/policy-bot/policy"
 	"github.com/palantir/policy-bot/policy/approval"
 	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/messages"
 )
 
 type IssueComment struct {
@@ -53,6 +54,16 @@ func (h *IssueComment) Handle(ctx context.Context, eventType, deliveryID string,
 		return nil
 	}
 
+	if event.GetAction() != "deleted" && h.isSummaryComment(event.GetComment()) {
+		zerolog.Ctx(ctx).Debug().Msg("Issue comment event is for a summary comment")
+		return nil
+	}
+
+	if event.GetAction() != "deleted" && h.isCommandReply(event.GetComment()) {
+		zerolog.Ctx(ctx).Debug().Msg("Issue comment event is for a command reply")
+		return nil
+	}
+
 	client, err := h.NewInstallationClient(installationID)
 	if err != nil {
 		return err
@@ -69,9 +80,15 @@ func (h *IssueComment) Handle(ctx context.Context, eventType, deliveryID string,
 	}
 
 	ctx, logger := h.PreparePRContext(ctx, installationID, pr)
+	ctx = withTrigger(ctx, eventType, event.GetAction(), event.GetSender().GetLogin())
+
+	unlock, err := h.LockPullRequest(ctx, owner, repo.GetName(), number)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	mbrCtx := NewCrossOrgMembershipContext(ctx, client, owner, h.Installations, h.ClientCreator)
-	prctx, err := pull.NewGitHubContext(ctx, mbrCtx, client, v4client, pull.Locator{
+	prctx, err := h.NewPullContext(ctx, client, v4client, pull.Locator{
 		Owner:  owner,
 		Repo:   repo.GetName(),
 		Number: number,
@@ -97,7 +114,17 @@ func (h *IssueComment) Handle(ctx context.Context, eventType, deliveryID string,
 		logger.Warn().Str(LogKeyAudit, "issue_comment").Msg("Skipped tampering check because the policy is not valid")
 	}
 
-	return h.EvaluateFetchedConfig(ctx, prctx, client, fetchedConfig)
+	// commands reply with the result of this evaluation instead of
+	// evaluating again
+	ctx, evaluation := withEvaluationObserver(ctx)
+	if err := h.EvaluateFetchedConfig(ctx, prctx, client, fetchedConfig); err != nil {
+		return err
+	}
+
+	if cmd, ok := parseCommand(event.GetComment().GetBody()); ok && event.GetAction() == "created" {
+		return h.runCommand(ctx, prctx, client, fetchedConfig, evaluation, cmd, event.GetSender().GetLogin())
+	}
+	return nil
 }
 
 func (h *IssueComment) detectAndLogTampering(ctx context.Context, prctx pull.Context, client *github.Client, event github.IssueCommentEvent, config *policy.Config) (bool, error) {
@@ -125,7 +152,8 @@ func (h *IssueComment) detectAndLogTampering(ctx context.Context, prctx pull.Con
 		msg := fmt.Sprintf("Entity %s edited approval comment by %s", eventAuthor, commentAuthor)
 		logger.Warn().Str(LogKeyAudit, "issue_comment").Msg(msg)
 
-		err := h.PostStatus(ctx, prctx, client, "failure", msg)
+		desc := h.Messages.Format(messages.StatusEditedComment, messages.Args{"Editor": eventAuthor, "Author": commentAuthor})
+		err := h.PostStatus(ctx, prctx, client, "failure", desc)
 		return true, err
 	}
 
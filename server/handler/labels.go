@@ -0,0 +1,111 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// syncLabels adds the labels of pending rules to a pull request and removes
+// the labels of rules that are approved or skipped. Labels shared by several
+// rules stay while any of the rules is pending. Rules that failed to evaluate
+// do not change labels.
+func (b *Base) syncLabels(ctx context.Context, prctx pull.Context, client *github.Client, result *common.Result) error {
+	if result == nil {
+		return nil
+	}
+
+	wanted := make(map[string]string)
+	managed := make(map[string]bool)
+	var failed []string
+	for _, r := range leafResults(result) {
+		if r.Error != nil {
+			failed = append(failed, r.Labels...)
+			continue
+		}
+		for _, l := range r.Labels {
+			managed[strings.ToLower(l)] = true
+			if r.Status == common.StatusPending {
+				wanted[strings.ToLower(l)] = l
+			}
+		}
+	}
+	for _, l := range failed {
+		delete(managed, strings.ToLower(l))
+	}
+	if len(managed) == 0 {
+		return nil
+	}
+
+	owner, repo, number := prctx.RepositoryOwner(), prctx.RepositoryName(), prctx.Number()
+	current, err := listIssueLabels(ctx, client, owner, repo, number)
+	if err != nil {
+		return err
+	}
+
+	logger := zerolog.Ctx(ctx)
+	for key, label := range current {
+		if _, ok := wanted[key]; !ok && managed[key] {
+			logger.Info().Msgf("Removing label %q", label)
+			if _, err := client.Issues.RemoveLabelForIssue(ctx, owner, repo, number, label); err != nil {
+				return errors.Wrapf(err, "failed to remove label %q", label)
+			}
+		}
+	}
+
+	var add []string
+	for key, label := range wanted {
+		if _, ok := current[key]; !ok && managed[key] {
+			add = append(add, label)
+		}
+	}
+	if len(add) > 0 {
+		logger.Info().Msgf("Adding labels %q", add)
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, number, add); err != nil {
+			return errors.Wrap(err, "failed to add labels")
+		}
+	}
+	return nil
+}
+
+// listIssueLabels returns the labels of an issue or pull request, keyed by
+// their lowercase names.
+func listIssueLabels(ctx context.Context, client *github.Client, owner, repo string, number int) (map[string]string, error) {
+	opt := &github.ListOptions{PerPage: 100}
+
+	labels := make(map[string]string)
+	for {
+		page, res, err := client.Issues.ListLabelsByIssue(ctx, owner, repo, number, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list labels")
+		}
+		for _, l := range page {
+			labels[strings.ToLower(l.GetName())] = l.GetName()
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+	return labels, nil
+}
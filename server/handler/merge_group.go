@@ -0,0 +1,153 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/messages"
+)
+
+// mergeGroupRefPattern matches the head ref of a merge group and captures the
+// number of the last pull request in the group.
+var mergeGroupRefPattern = regexp.MustCompile(`^refs/heads/gh-readonly-queue/.+/pr-(\d+)-[0-9a-f]+$`)
+
+// mergeGroupEvent is the payload of a merge_group event.
+type mergeGroupEvent struct {
+	Action     string `json:"action"`
+	MergeGroup struct {
+		HeadSHA string `json:"head_sha"`
+		HeadRef string `json:"head_ref"`
+		BaseRef string `json:"base_ref"`
+	} `json:"merge_group"`
+	Repo         *github.Repository   `json:"repository"`
+	Installation *github.Installation `json:"installation"`
+}
+
+// MergeGroup posts the policy status on the head commits of merge groups so
+// that repositories using merge queues can require the status.
+type MergeGroup struct {
+	Base
+}
+
+func (h *MergeGroup) Handles() []string { return []string{"merge_group"} }
+
+// Handle merge_group
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#merge_group
+func (h *MergeGroup) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event mergeGroupEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "failed to parse merge group event payload")
+	}
+
+	if event.Action != "checks_requested" {
+		return nil
+	}
+
+	repo := event.Repo
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	installationID := event.Installation.GetID()
+
+	ctx, logger := githubapp.PrepareRepoContext(ctx, installationID, repo)
+	logger = logger.With().Str(LogKeyGitHubSHA, event.MergeGroup.HeadSHA).Logger()
+	ctx = logger.WithContext(ctx)
+	ctx = withRateLimitSource(ctx, installationID, repo)
+
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimPrefix(event.MergeGroup.BaseRef, "refs/heads/")
+	number, state, description, err := h.evaluateMergeGroup(ctx, client, installationID, owner, name, event.MergeGroup.HeadRef)
+	if err != nil {
+		return err
+	}
+
+	contextWithBranch := h.StatusContext(owner, name, base)
+	detailsURL := h.BaseConfig.PublicURL
+	if number > 0 {
+		detailsURL = h.DetailsURL(owner, name, number)
+	}
+	return h.postGitHubRepoStatus(ctx, client, owner, name, event.MergeGroup.HeadSHA, &github.RepoStatus{
+		Context:     &contextWithBranch,
+		State:       &state,
+		Description: &description,
+		TargetURL:   &detailsURL,
+	})
+}
+
+// evaluateMergeGroup evaluates the policy of the pull request that created a
+// merge group and returns the state and description of the status to post.
+// Earlier pull requests in the group were evaluated by their own merge
+// groups.
+func (h *MergeGroup) evaluateMergeGroup(ctx context.Context, client *github.Client, installationID int64, owner, repo, headRef string) (int, string, string, error) {
+	logger := zerolog.Ctx(ctx)
+
+	m := mergeGroupRefPattern.FindStringSubmatch(headRef)
+	if m == nil {
+		logger.Warn().Msgf("Failed to find the pull request for merge group ref %s", headRef)
+		return 0, "error", h.Messages.Text(messages.StatusMergeGroupUnknown), nil
+	}
+	number, _ := strconv.Atoi(m[1])
+
+	unlock, err := h.LockPullRequest(ctx, owner, repo, number)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer unlock()
+
+	v4client, err := h.NewInstallationV4Client(installationID)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	loc := pull.Locator{Owner: owner, Repo: repo, Number: number}
+	prctx, err := h.NewPullContext(ctx, client, v4client, loc)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	fetchedConfig, err := h.ConfigFetcher.ConfigForPR(ctx, prctx, client)
+	if err != nil {
+		return 0, "", "", errors.WithMessage(err, fmt.Sprintf("failed to fetch policy: %s", fetchedConfig))
+	}
+	if fetchedConfig.Missing() {
+		return number, "success", h.Messages.Format(messages.StatusMergeGroupNoPolicy, messages.Args{"Number": number}), nil
+	}
+
+	_, state, description, err := h.evaluateFetchedConfig(ctx, prctx, fetchedConfig)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	// must be less than 140 characters to satisfy GitHub API
+	description = fmt.Sprintf("#%d: %s", number, description)
+	if len(description) > 140 {
+		description = description[:137] + "..."
+	}
+	return number, state, description, nil
+}
@@ -0,0 +1,226 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	MetricsKeyEvaluations        = "evaluations"
+	MetricsKeyEvaluationDuration = "evaluation.duration"
+	MetricsKeyCachedEvaluations  = "evaluations.cached"
+	MetricsKeyRulePendingTime    = "rule.pending_time"
+	MetricsKeyUnchangedStatuses  = "statuses.unchanged"
+	MetricsKeyIncomplete         = "evaluations.incomplete"
+	MetricsKeyRuleResults        = "rule.results"
+	MetricsKeyGraphQLQueries     = "github.graphql.queries"
+	MetricsKeyGraphQLCost        = "github.graphql.cost"
+	MetricsKeyGraphQLRemaining   = "github.graphql.remaining"
+	MetricsKeyQueueDepth         = "queue.depth"
+	MetricsKeyReconcileDropped   = "reconcile.dropped"
+
+	MetricTagOrg  = "org"
+	MetricTagRepo = "repo"
+	MetricTagRule = "rule"
+)
+
+// Metrics records metrics about evaluations in a registry. Metric names use
+// the "name[tag:value,...]" format, which the Datadog emitter converts into
+// DogStatsD tags.
+type Metrics struct {
+	Registry metrics.Registry
+
+	// Tags are the dimensions added to evaluation metrics: any of "org",
+	// "repo", and "rule". Each tag increases the number of distinct metrics,
+	// so only enable the ones that are needed.
+	Tags []string
+}
+
+// ValidateMetricTags returns an error if any tag is not a supported
+// dimension for evaluation metrics.
+func ValidateMetricTags(tags []string) error {
+	for _, tag := range tags {
+		switch tag {
+		case MetricTagOrg, MetricTagRepo, MetricTagRule:
+		default:
+			return errors.Errorf("unsupported metric tag %q", tag)
+		}
+	}
+	return nil
+}
+
+// recordEvaluation records the outcome and duration of an evaluation and the
+// status of each rule. For each rule that is still pending, it also records
+// the time since the pull request was opened.
+func (m *Metrics) recordEvaluation(prctx pull.Context, result *common.Result, state string, duration time.Duration) {
+	if m == nil || m.Registry == nil {
+		return
+	}
+
+	tags := m.repositoryTags(prctx.RepositoryOwner(), prctx.RepositoryName())
+
+	metrics.GetOrRegisterCounter(metricName(MetricsKeyEvaluations, append(tags, "state:"+state)), m.Registry).Inc(1)
+	metrics.GetOrRegisterTimer(metricName(MetricsKeyEvaluationDuration, tags), m.Registry).Update(duration)
+
+	if result == nil {
+		return
+	}
+
+	for _, rule := range leafResults(result) {
+		ruleTags := append(tags, "status:"+rule.Status.String())
+		if m.hasTag(MetricTagRule) {
+			ruleTags = append(ruleTags, "rule:"+tagValue(rule.Name))
+		}
+		metrics.GetOrRegisterCounter(metricName(MetricsKeyRuleResults, ruleTags), m.Registry).Inc(1)
+	}
+
+	createdAt := prctx.CreatedAt()
+	if createdAt.IsZero() {
+		return
+	}
+
+	pending := time.Since(createdAt)
+	for _, rule := range pendingResults(result) {
+		ruleTags := tags
+		if m.hasTag(MetricTagRule) {
+			ruleTags = append(tags, "rule:"+tagValue(rule.Name))
+		}
+		metrics.GetOrRegisterTimer(metricName(MetricsKeyRulePendingTime, ruleTags), m.Registry).Update(pending)
+	}
+}
+
+// recordCachedEvaluation records an evaluation that reused a cached outcome.
+func (m *Metrics) recordCachedEvaluation(prctx pull.Context, state string) {
+	if m == nil || m.Registry == nil {
+		return
+	}
+
+	tags := m.repositoryTags(prctx.RepositoryOwner(), prctx.RepositoryName())
+	metrics.GetOrRegisterCounter(metricName(MetricsKeyCachedEvaluations, append(tags, "state:"+state)), m.Registry).Inc(1)
+}
+
+// recordUnchangedStatus records a status that was not posted because the
+// commit already had an identical status.
+func (m *Metrics) recordUnchangedStatus(owner, repo string) {
+	if m == nil || m.Registry == nil {
+		return
+	}
+
+	tags := m.repositoryTags(owner, repo)
+	metrics.GetOrRegisterCounter(metricName(MetricsKeyUnchangedStatuses, tags), m.Registry).Inc(1)
+}
+
+// recordGraphQLUsage records the GraphQL API queries and points used by an
+// evaluation and the points remaining in the rate limit of the installation.
+func (m *Metrics) recordGraphQLUsage(owner, repo string, installationID int64, usage pull.GraphQLUsage) {
+	if m == nil || m.Registry == nil || usage.Queries == 0 {
+		return
+	}
+
+	tags := m.repositoryTags(owner, repo)
+	metrics.GetOrRegisterCounter(metricName(MetricsKeyGraphQLQueries, tags), m.Registry).Inc(int64(usage.Queries))
+	metrics.GetOrRegisterCounter(metricName(MetricsKeyGraphQLCost, tags), m.Registry).Inc(int64(usage.Cost))
+
+	installation := []string{"installation:" + strconv.FormatInt(installationID, 10)}
+	metrics.GetOrRegisterGauge(metricName(MetricsKeyGraphQLRemaining, installation), m.Registry).Update(int64(usage.Remaining))
+}
+
+func (m *Metrics) recordIncomplete(owner, repo string, retried bool) {
+	if m == nil || m.Registry == nil {
+		return
+	}
+
+	tags := append(m.repositoryTags(owner, repo), "retried:"+strconv.FormatBool(retried))
+	metrics.GetOrRegisterCounter(metricName(MetricsKeyIncomplete, tags), m.Registry).Inc(1)
+}
+
+// recordReconcileDropped records a pull request without a status that
+// reconciliation could not queue for evaluation.
+func (m *Metrics) recordReconcileDropped(owner, repo string) {
+	if m == nil || m.Registry == nil {
+		return
+	}
+
+	metrics.GetOrRegisterCounter(metricName(MetricsKeyReconcileDropped, m.repositoryTags(owner, repo)), m.Registry).Inc(1)
+}
+
+// RegisterQueueMetrics registers a gauge with the number of pending
+// evaluations in a queue. The name of the app, if any, is added as a tag.
+func RegisterQueueMetrics(registry metrics.Registry, app string, q *EvaluationQueue) {
+	var tags []string
+	if app != "" {
+		tags = append(tags, "app:"+tagValue(app))
+	}
+
+	gauge := metrics.NewFunctionalGauge(func() int64 { return int64(q.Len()) })
+	if err := registry.Register(metricName(MetricsKeyQueueDepth, tags), gauge); err != nil {
+		// the gauge of a previous queue with the same name is replaced
+		registry.Unregister(metricName(MetricsKeyQueueDepth, tags))
+		_ = registry.Register(metricName(MetricsKeyQueueDepth, tags), gauge)
+	}
+}
+
+func (m *Metrics) repositoryTags(owner, repo string) []string {
+	var tags []string
+	if m.hasTag(MetricTagOrg) {
+		tags = append(tags, "org:"+tagValue(owner))
+	}
+	if m.hasTag(MetricTagRepo) {
+		tags = append(tags, "repo:"+tagValue(owner+"/"+repo))
+	}
+	// limit the capacity so that appending more tags always copies
+	return tags[:len(tags):len(tags)]
+}
+
+func (m *Metrics) hasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func metricName(key string, tags []string) string {
+	if len(tags) == 0 {
+		return key
+	}
+	return key + "[" + strings.Join(tags, ",") + "]"
+}
+
+// tagValue converts a string to a valid tag value by replacing characters
+// that DogStatsD or the metric name format do not allow.
+func tagValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		case r == '-', r == '_', r == '.', r == '/':
+			return r
+		}
+		return '_'
+	}, s)
+}
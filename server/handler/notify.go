@@ -0,0 +1,87 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/lock"
+	"github.com/palantir/policy-bot/server/notify"
+)
+
+// notify records the status posted for a pull request and sends a
+// notification if it changed, if notifications are configured. Failures are
+// logged but do not fail the evaluation.
+func (b *Base) notify(ctx context.Context, prctx pull.Context, result *common.Result, state, description string) {
+	if b.Notifier == nil {
+		return
+	}
+
+	owner, repo, number := prctx.RepositoryOwner(), prctx.RepositoryName(), prctx.Number()
+	base, head := prctx.Branches()
+	statusContext := b.StatusContext(owner, repo, base)
+
+	err := b.Notifier.Update(ctx, statusContext+":"+lock.PullRequestKey(owner, repo, number), notify.Event{
+		Time:        time.Now(),
+		Owner:       owner,
+		Repo:        repo,
+		Number:      number,
+		Title:       prctx.Title(),
+		HeadSHA:     prctx.HeadSHA(),
+		HeadRef:     head,
+		BaseRef:     base,
+		Context:     statusContext,
+		State:       state,
+		Description: description,
+		DetailsURL:  b.DetailsURL(owner, repo, number),
+		Approvers:   countedApprovers(result),
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to send status notification")
+	}
+}
+
+// countedApprovers returns the users whose approvals counted toward any rule in a
+// result, in the order they approved.
+func countedApprovers(result *common.Result) []string {
+	if result == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+
+	var decisions []*common.ApprovalDecision
+	for _, r := range leafResults(result) {
+		decisions = append(decisions, r.Approvals...)
+	}
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[i].CreatedAt.Before(decisions[j].CreatedAt)
+	})
+
+	var users []string
+	for _, d := range decisions {
+		if d.Counted && !seen[d.User] {
+			seen[d.User] = true
+			users = append(users, d.User)
+		}
+	}
+	return users
+}
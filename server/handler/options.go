@@ -0,0 +1,115 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"path"
+	"strings"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// OptionsOverride changes evaluation options for matching repositories.
+// Unset fields keep the value of the options or of an earlier override. The
+// app name and the overrides themselves cannot be overridden.
+type OptionsOverride struct {
+	// Repositories are patterns that match "owner/name" repository names,
+	// like "my-org/*" or "my-org/service-*". A pattern without a slash
+	// matches all repositories owned by that organization or user. Matching
+	// is not case-sensitive.
+	Repositories []string `yaml:"repositories"`
+
+	PolicyPath               string `yaml:"policy_path"`
+	StatusCheckContext       string `yaml:"status_check_context"`
+	PostInsecureStatusChecks *bool  `yaml:"post_insecure_status_checks"`
+	SummaryComment           *bool  `yaml:"summary_comment"`
+	CheckRuns                *bool  `yaml:"check_runs"`
+	RequestReviewers         *bool  `yaml:"request_reviewers"`
+
+	// RuleConcurrency is ignored unless it is positive.
+	RuleConcurrency    int                      `yaml:"rule_concurrency"`
+	PushedDateFallback *pull.PushedDateFallback `yaml:"pushed_date_fallback"`
+
+	// RemoteOwners and CommentKeywords replace the values of the options
+	// instead of adding to them.
+	RemoteOwners    []string         `yaml:"remote_owners"`
+	CommentKeywords *common.Keywords `yaml:"comment_keywords"`
+}
+
+// Matches returns true if the override applies to the repository.
+func (o *OptionsOverride) Matches(owner, repo string) bool {
+	name := strings.ToLower(owner + "/" + repo)
+	for _, pattern := range o.Repositories {
+		pattern = strings.ToLower(pattern)
+		if !strings.Contains(pattern, "/") {
+			pattern += "/*"
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ForRepository returns the options for a repository, after applying all
+// matching overrides in order. If no overrides match, it returns the
+// receiver.
+func (p *PullEvaluationOptions) ForRepository(owner, repo string) *PullEvaluationOptions {
+	opts := p
+	for i := range p.Overrides {
+		o := &p.Overrides[i]
+		if !o.Matches(owner, repo) {
+			continue
+		}
+
+		if opts == p {
+			copied := *p
+			opts = &copied
+		}
+
+		if o.PolicyPath != "" {
+			opts.PolicyPath = o.PolicyPath
+		}
+		if o.StatusCheckContext != "" {
+			opts.StatusCheckContext = o.StatusCheckContext
+		}
+		if o.PostInsecureStatusChecks != nil {
+			opts.PostInsecureStatusChecks = *o.PostInsecureStatusChecks
+		}
+		if o.SummaryComment != nil {
+			opts.SummaryComment = *o.SummaryComment
+		}
+		if o.CheckRuns != nil {
+			opts.CheckRuns = *o.CheckRuns
+		}
+		if o.RequestReviewers != nil {
+			opts.RequestReviewers = *o.RequestReviewers
+		}
+		if o.RuleConcurrency > 0 {
+			opts.RuleConcurrency = o.RuleConcurrency
+		}
+		if o.PushedDateFallback != nil {
+			opts.PushedDateFallback = *o.PushedDateFallback
+		}
+		if o.RemoteOwners != nil {
+			opts.RemoteOwners = o.RemoteOwners
+		}
+		if o.CommentKeywords != nil {
+			opts.CommentKeywords = *o.CommentKeywords
+		}
+	}
+	return opts
+}
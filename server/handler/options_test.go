@@ -0,0 +1,122 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+func TestForRepository(t *testing.T) {
+	config := `
+policy_path: .policy.yml
+summary_comment: true
+rule_concurrency: 4
+pushed_date_fallback: committed_date
+remote_owners: ["central"]
+comment_keywords:
+  approve: ["approved"]
+overrides:
+  - repositories: ["my-org"]
+    policy_path: .github/policy.yml
+    summary_comment: false
+    rule_concurrency: 2
+    comment_keywords:
+      approve: ["genehmigt"]
+  - repositories: ["my-org/service-*"]
+    policy_path: service-policy.yml
+    pushed_date_fallback: ""
+    remote_owners: []
+  - repositories: ["My-Org/service-legacy"]
+    rule_concurrency: 1
+    summary_comment: true
+`
+
+	var opts PullEvaluationOptions
+	require.NoError(t, yaml.Unmarshal([]byte(config), &opts))
+	opts.FillDefaults()
+
+	tests := map[string]struct {
+		Repo string
+
+		PolicyPath         string
+		SummaryComment     bool
+		RuleConcurrency    int
+		PushedDateFallback pull.PushedDateFallback
+		RemoteOwners       []string
+		Approve            []string
+	}{
+		"noMatch": {
+			Repo:               "other-org/service-a",
+			PolicyPath:         ".policy.yml",
+			SummaryComment:     true,
+			RuleConcurrency:    4,
+			PushedDateFallback: pull.PushedDateFallbackCommitted,
+			RemoteOwners:       []string{"central"},
+			Approve:            []string{"approved"},
+		},
+		"organization": {
+			Repo:               "my-org/website",
+			PolicyPath:         ".github/policy.yml",
+			SummaryComment:     false,
+			RuleConcurrency:    2,
+			PushedDateFallback: pull.PushedDateFallbackCommitted,
+			RemoteOwners:       []string{"central"},
+			Approve:            []string{"genehmigt"},
+		},
+		"laterOverrideWins": {
+			Repo:               "my-org/service-a",
+			PolicyPath:         "service-policy.yml",
+			SummaryComment:     false,
+			RuleConcurrency:    2,
+			PushedDateFallback: pull.PushedDateFallbackNone,
+			RemoteOwners:       []string{},
+			Approve:            []string{"genehmigt"},
+		},
+		"threeOverrides": {
+			Repo:               "my-org/service-legacy",
+			PolicyPath:         "service-policy.yml",
+			SummaryComment:     true,
+			RuleConcurrency:    1,
+			PushedDateFallback: pull.PushedDateFallbackNone,
+			RemoteOwners:       []string{},
+			Approve:            []string{"genehmigt"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			parts := strings.SplitN(test.Repo, "/", 2)
+			r := opts.ForRepository(parts[0], parts[1])
+
+			assert.Equal(t, test.PolicyPath, r.PolicyPath, "incorrect policy path")
+			assert.Equal(t, test.SummaryComment, r.SummaryComment, "incorrect summary comment")
+			assert.Equal(t, test.RuleConcurrency, r.RuleConcurrency, "incorrect rule concurrency")
+			assert.Equal(t, test.PushedDateFallback, r.PushedDateFallback, "incorrect pushed date fallback")
+			assert.Equal(t, test.RemoteOwners, r.RemoteOwners, "incorrect remote owners")
+			assert.Equal(t, common.Keywords{Approve: test.Approve}, r.CommentKeywords, "incorrect comment keywords")
+		})
+	}
+
+	assert.Equal(t, ".policy.yml", opts.PolicyPath, "overrides modified the options")
+	assert.Equal(t, 4, opts.RuleConcurrency, "overrides modified the options")
+}
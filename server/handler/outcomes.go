@@ -0,0 +1,245 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/codeowners"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/evalcache"
+)
+
+// outcomeKey returns the key of the cached outcome of evaluating a policy, or
+// an empty string if the outcome cannot be cached. Computing the key loads
+// the comments and reviews of the pull request, which evaluation usually
+// needs anyway.
+func (b *Base) outcomeKey(ctx context.Context, prctx pull.Context, fetchedConfig FetchedConfig) string {
+	if b.Outcomes == nil || !fetchedConfig.Valid() || fetchedConfig.Hash == "" {
+		return ""
+	}
+
+	features := policyFeatures(fetchedConfig)
+	if features.uncacheable {
+		return ""
+	}
+
+	reviews, err := reviewSet(ctx, prctx, fetchedConfig)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to compute evaluation cache key")
+		return ""
+	}
+
+	base, _ := prctx.Branches()
+	in := evalcache.Inputs{
+		App:        b.PullOpts.AppName,
+		Owner:      prctx.RepositoryOwner(),
+		Repo:       prctx.RepositoryName(),
+		Number:     prctx.Number(),
+		HeadSHA:    prctx.HeadSHA(),
+		BaseRef:    base,
+		Author:     prctx.Author(),
+		Title:      prctx.Title(),
+		Body:       prctx.Body(),
+		Labels:     prctx.Labels(),
+		PolicyHash: fetchedConfig.Hash,
+		Reviews:    reviews,
+	}
+
+	// only policies that keep drafts pending depend on the draft state, so
+	// avoid loading it for other policies
+	if d := fetchedConfig.Config.Drafts; d != nil && d.Pending {
+		if in.Draft, err = prctx.IsDraft(); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to compute evaluation cache key")
+			return ""
+		}
+	}
+
+	if features.authorPermission {
+		if in.AuthorPermission, err = prctx.AuthorPermission(); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to compute evaluation cache key")
+			return ""
+		}
+	}
+	if features.codeOwners {
+		if in.CodeOwnersHash, err = codeOwnersHash(prctx); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to compute evaluation cache key")
+			return ""
+		}
+	}
+	return in.Key()
+}
+
+// cacheFeatures are the features of a policy that affect caching.
+type cacheFeatures struct {
+	// authorPermission and codeOwners are true if the outcome depends on the
+	// permission of the author or the CODEOWNERS file
+	authorPermission bool
+	codeOwners       bool
+
+	// uncacheable is true if the outcome depends on the time of the
+	// evaluation or on data that the key cannot include, like the signing
+	// keys of approvers
+	uncacheable bool
+}
+
+func policyFeatures(fetchedConfig FetchedConfig) cacheFeatures {
+	var f cacheFeatures
+	for _, r := range fetchedConfig.Config.ApprovalRules {
+		if r.Predicates.AuthorHasPermission != nil {
+			f.authorPermission = true
+		}
+		if r.Requires.CodeOwners {
+			f.codeOwners = true
+		}
+		if r.Options.ExpireApprovalsAfter > 0 || r.Options.RequireSigningKey {
+			f.uncacheable = true
+		}
+	}
+	return f
+}
+
+// codeOwnersHash returns the hash of the CODEOWNERS file that evaluation
+// uses, or an empty string if the base branch has no CODEOWNERS file.
+func codeOwnersHash(prctx pull.Context) (string, error) {
+	for _, path := range codeowners.Paths {
+		content, err := prctx.BaseFileContent(path)
+		if err != nil {
+			return "", err
+		}
+		if content != nil {
+			sum := sha256.Sum256(content)
+			return path + ":" + hex.EncodeToString(sum[:]), nil
+		}
+	}
+	return "", nil
+}
+
+// reviewSet returns the comments and reviews that match any approval,
+// disapproval, or revocation method in the policy. Comments and reviews that
+// match no method cannot change the outcome of an evaluation.
+func reviewSet(ctx context.Context, prctx pull.Context, fetchedConfig FetchedConfig) ([]string, error) {
+	var reviews []string
+	for i, m := range policyMethods(fetchedConfig) {
+		candidates, err := m.Candidates(ctx, prctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range candidates {
+			reviews = append(reviews, fmt.Sprintf("%d:%s@%s", i, c.User, c.CreatedAt.Format(time.RFC3339Nano)))
+		}
+	}
+	return reviews, nil
+}
+
+// policyMethods returns the approval, disapproval, and revocation methods of
+// a valid policy.
+func policyMethods(fetchedConfig FetchedConfig) []*common.Methods {
+	var methods []*common.Methods
+	for _, r := range fetchedConfig.Config.ApprovalRules {
+		methods = append(methods, r.Options.GetMethods())
+	}
+	if d := fetchedConfig.Config.Policy.Disapproval; d != nil {
+		methods = append(methods, d.Options.GetDisapproveMethods(), d.Options.GetRevokeMethods())
+	}
+	return methods
+}
+
+// filterComments limits the comments that prctx loads to those that match a
+// comment method of the policy. No other part of an evaluation uses
+// comments, so this only reduces memory use.
+func filterComments(prctx pull.Context, fetchedConfig FetchedConfig) {
+	ghc, ok := prctx.(*pull.GitHubContext)
+	if !ok || !fetchedConfig.Valid() {
+		return
+	}
+
+	methods := policyMethods(fetchedConfig)
+	ghc.FilterComments(func(c *pull.Comment) bool {
+		for _, m := range methods {
+			if m.CommentMatches(c.Body) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// cachedOutcome returns the cached outcome for a key, if any.
+func (b *Base) cachedOutcome(ctx context.Context, key string) *evalcache.Outcome {
+	if key == "" {
+		return nil
+	}
+
+	outcome, err := b.Outcomes.Get(ctx, key)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to get cached evaluation outcome")
+		return nil
+	}
+	return outcome
+}
+
+// cacheOutcome caches the outcome of a successful evaluation. Outcomes of
+// evaluations that failed are not cached so that they are retried. If the
+// repository uses check runs, the outcome includes the rule sections of the
+// summary, so posting the outcome again does not remove them.
+func (b *Base) cacheOutcome(ctx context.Context, prctx pull.Context, key string, result *common.Result, state, description string) {
+	if key == "" || result == nil || result.Error != nil {
+		return
+	}
+
+	outcome := evalcache.Outcome{State: state, Description: description}
+	if b.PullOpts.ForRepository(prctx.RepositoryOwner(), prctx.RepositoryName()).CheckRuns {
+		outcome.Rules = b.checkRunRules(result)
+	}
+	if err := b.Outcomes.Put(ctx, key, outcome); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to cache evaluation outcome")
+	}
+}
+
+// postCachedOutcome posts the status of a cached outcome instead of
+// evaluating the policy. Other actions taken after an evaluation already
+// happened when the outcome was cached, except for merging, which may not
+// have been possible at the time.
+func (b *Base) postCachedOutcome(ctx context.Context, prctx pull.Context, client *github.Client, fetchedConfig FetchedConfig, outcome *evalcache.Outcome) error {
+	logger := zerolog.Ctx(ctx)
+	logger.Debug().Msgf("Using cached evaluation outcome: %s", outcome.State)
+
+	b.Metrics.recordCachedEvaluation(prctx, outcome.State)
+
+	state, description, err := b.upstreamStatus(ctx, prctx, client, fetchedConfig, outcome.State, outcome.Description)
+	if err != nil {
+		return err
+	}
+	if err := b.postResult(ctx, prctx, client, outcome.Rules, state, description); err != nil {
+		return err
+	}
+	observeEvaluation(ctx, prctx, fetchedConfig, nil, state, description)
+
+	if state == "success" {
+		if err := b.autoMerge(ctx, prctx, client, fetchedConfig); err != nil {
+			logger.Error().Err(err).Msg("Failed to auto-merge pull request")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/alexedwards/scs"
+	"github.com/bluekeyes/templatetree"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/rbac"
+)
+
+// Playground serves a page that evaluates a pasted policy against an existing
+// pull request or a synthetic pull request described in YAML. It never posts
+// statuses or stores results, so teams can use it to write their first
+// policy.
+type Playground struct {
+	// Apps are the apps that share the GitHub instance used for login. Pull
+	// requests are loaded with the first app that is installed for their
+	// owner.
+	Apps []*App
+
+	// Roles, if set, limits the playground to users with the simulator role.
+	Roles *rbac.Authorizer
+
+	Sessions  *scs.Manager
+	Templates templatetree.HTMLTree
+}
+
+type playgroundData struct {
+	User string
+
+	// Policy, PullRequest, and Synthetic are the submitted form values
+	Policy      string
+	PullRequest string
+	Synthetic   string
+
+	Error  error
+	Result *common.Result
+}
+
+func (h *Playground) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	var data playgroundData
+
+	user, err := h.Sessions.Load(r).GetString(SessionKeyUsername)
+	if err != nil {
+		return errors.Wrap(err, "failed to read sessions")
+	}
+	data.User = user
+
+	allowed, err := h.Roles.UserAllowed(r.Context(), user, rbac.RoleSimulator)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		http.Error(w, "the playground requires the simulator role", http.StatusForbidden)
+		return nil
+	}
+
+	if r.Method != http.MethodPost {
+		return h.render(w, &data)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSimulationBody)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("invalid playground request: %v", err), http.StatusBadRequest)
+		return nil
+	}
+	data.Policy = strings.TrimSpace(r.PostForm.Get("policy"))
+	data.PullRequest = strings.TrimSpace(r.PostForm.Get("pull_request"))
+	data.Synthetic = strings.TrimSpace(r.PostForm.Get("synthetic"))
+
+	ctx, prctx, err := h.pullContext(r, &data)
+	if err != nil {
+		return err
+	}
+	if data.Error == nil {
+		opts := h.Apps[0].Base.PullOpts.ForRepository(prctx.RepositoryOwner(), prctx.RepositoryName())
+		data.Result, data.Error = evaluatePlayground(ctx, prctx, data.Policy, opts.CommentKeywords)
+		if data.Result != nil {
+			localizeResult(h.Apps[0].Base.Messages, data.Result)
+		}
+	}
+
+	if wantsJSON(r) {
+		if prctx == nil {
+			http.Error(w, data.Error.Error(), http.StatusBadRequest)
+			return nil
+		}
+		return writeDetailsJSON(w, detailsJSON(h.Apps[0].Base.Messages, prctx, data.Result, data.Error), "playground.json")
+	}
+	return h.render(w, &data)
+}
+
+// pullContext returns the context of the submitted pull request. If the
+// submitted values are invalid or the user cannot read the pull request, it
+// sets data.Error and returns a nil context.
+func (h *Playground) pullContext(r *http.Request, data *playgroundData) (context.Context, pull.Context, error) {
+	ctx := r.Context()
+
+	switch {
+	case data.PullRequest != "" && data.Synthetic != "":
+		data.Error = errors.New("enter either a pull request or a synthetic pull request, not both")
+
+	case data.PullRequest != "":
+		loc, err := pull.ParseLocator(data.PullRequest)
+		if err != nil {
+			data.Error = err
+			return ctx, nil, nil
+		}
+
+		req, readable, err := newDetailsRequest(r, h.Apps, h.Sessions, loc.Owner, loc.Repo, loc.Number)
+		if _, notInstalled := errors.Cause(err).(githubapp.InstallationNotFound); notInstalled {
+			data.Error = errors.Errorf("%s is not installed for %s", h.Apps[0].Base.PullOpts.AppName, loc.Owner)
+			return ctx, nil, nil
+		}
+		if err != nil {
+			return ctx, nil, err
+		}
+
+		notFound := errors.Errorf("not found: %s/%s#%d", loc.Owner, loc.Repo, loc.Number)
+		if !readable {
+			data.Error = notFound
+			return ctx, nil, nil
+		}
+
+		ctx, pr, prctx, err := req.loadPullRequest(withLinkedIssueReader(ctx, req.User))
+		if err != nil {
+			return ctx, nil, err
+		}
+		if pr == nil {
+			data.Error = notFound
+			return ctx, nil, nil
+		}
+		return ctx, prctx, nil
+
+	case data.Synthetic != "":
+		b := []byte(data.Synthetic)
+		if err := policy.DefaultLimits.Check(b); err != nil {
+			data.Error = err
+			return ctx, nil, nil
+		}
+		s, err := pull.ParseSynthetic(b)
+		if err != nil {
+			data.Error = err
+			return ctx, nil, nil
+		}
+		return ctx, s.Context(), nil
+
+	default:
+		data.Error = errors.New("enter a pull request or a synthetic pull request")
+	}
+	return ctx, nil, nil
+}
+
+func evaluatePlayground(ctx context.Context, prctx pull.Context, text string, keywords common.Keywords) (*common.Result, error) {
+	if text == "" {
+		return nil, errors.New("enter a policy to evaluate")
+	}
+
+	config, err := parseSimulatedPolicy(text, keywords)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid policy")
+	}
+
+	evaluator, err := policy.ParsePolicy(config)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid policy")
+	}
+
+	result := evaluator.Evaluate(ctx, prctx)
+	return &result, nil
+}
+
+func (h *Playground) render(w http.ResponseWriter, data *playgroundData) error {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	return h.Templates.ExecuteTemplate(w, "playground.html.tmpl", data)
+}
@@ -41,15 +41,76 @@ func (h *PullRequest) Handle(ctx context.Context, eventType, deliveryID string,
 
 	installationID := githubapp.GetInstallationIDFromEvent(&event)
 	ctx, _ = h.PreparePRContext(ctx, installationID, event.GetPullRequest())
+	ctx = withTrigger(ctx, eventType, event.GetAction(), event.GetSender().GetLogin())
 
 	switch event.GetAction() {
-	case "opened", "reopened", "synchronize", "edited":
+	case "opened":
+		return h.Evaluate(withPullRequestOpened(ctx), installationID, pull.Locator{
+			Owner:  event.GetRepo().GetOwner().GetLogin(),
+			Repo:   event.GetRepo().GetName(),
+			Number: event.GetPullRequest().GetNumber(),
+			Value:  event.GetPullRequest(),
+		})
+
+	// evaluate draft transitions immediately so that policies that depend on
+	// the draft state do not wait for the next push or review
+	case "reopened", "synchronize", "edited", "ready_for_review", "converted_to_draft":
 		return h.Evaluate(ctx, installationID, pull.Locator{
 			Owner:  event.GetRepo().GetOwner().GetLogin(),
 			Repo:   event.GetRepo().GetName(),
 			Number: event.GetPullRequest().GetNumber(),
 			Value:  event.GetPullRequest(),
 		})
+
+	case "closed":
+		if err := h.forgetResult(ctx, pull.Locator{
+			Owner:  event.GetRepo().GetOwner().GetLogin(),
+			Repo:   event.GetRepo().GetName(),
+			Number: event.GetPullRequest().GetNumber(),
+		}); err != nil {
+			return err
+		}
+		if h.Compliance != nil {
+			h.Compliance.RecordClose(ClosedPullRequest{
+				Owner:    event.GetRepo().GetOwner().GetLogin(),
+				Repo:     event.GetRepo().GetName(),
+				Number:   event.GetPullRequest().GetNumber(),
+				Merged:   event.GetPullRequest().GetMerged(),
+				MergedAt: event.GetPullRequest().GetMergedAt(),
+				MergedBy: event.GetPullRequest().GetMergedBy().GetLogin(),
+			})
+		}
+
+		// pull requests stacked on this one are no longer waiting for it
+		head := event.GetPullRequest().GetHead()
+		if head.GetRepo().GetID() != event.GetRepo().GetID() {
+			return nil
+		}
+		client, err := h.NewInstallationClient(installationID)
+		if err != nil {
+			return err
+		}
+		return h.evaluateDependents(ctx, client, installationID, event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(), head.GetRef())
+
+	// labels may change the result of has_labels predicates; labels added
+	// or removed by the app itself are ignored to avoid evaluating again
+	// after every label sync
+	case "labeled", "unlabeled":
+		loc := pull.Locator{
+			Owner:  event.GetRepo().GetOwner().GetLogin(),
+			Repo:   event.GetRepo().GetName(),
+			Number: event.GetPullRequest().GetNumber(),
+			Value:  event.GetPullRequest(),
+		}
+		if event.GetSender().GetLogin() != h.PullOpts.AppName+"[bot]" {
+			if err := h.Evaluate(ctx, installationID, loc); err != nil {
+				return err
+			}
+		}
+		if event.GetAction() == "labeled" {
+			return h.TryAutoMerge(ctx, installationID, loc)
+		}
+		return nil
 	}
 
 	return nil
@@ -40,12 +40,30 @@ func (h *PullRequestReview) Handle(ctx context.Context, eventType, deliveryID st
 	}
 
 	installationID := githubapp.GetInstallationIDFromEvent(&event)
-	ctx, _ = h.PreparePRContext(ctx, installationID, event.GetPullRequest())
+	ctx, logger := h.PreparePRContext(ctx, installationID, event.GetPullRequest())
+	ctx = withTrigger(ctx, eventType, event.GetAction(), event.GetSender().GetLogin())
 
-	return h.Evaluate(ctx, installationID, pull.Locator{
+	loc := pull.Locator{
 		Owner:  event.GetRepo().GetOwner().GetLogin(),
 		Repo:   event.GetRepo().GetName(),
 		Number: event.GetPullRequest().GetNumber(),
 		Value:  event.GetPullRequest(),
-	})
+	}
+
+	if event.GetAction() == "dismissed" {
+		// the vendored event type does not include the review node ID
+		var dismissal struct {
+			Review struct {
+				NodeID string `json:"node_id"`
+			} `json:"review"`
+		}
+		if err := json.Unmarshal(payload, &dismissal); err != nil {
+			return errors.Wrap(err, "failed to parse dismissed review")
+		}
+
+		logger.Debug().Msgf("Review %d was dismissed, re-evaluating without it", event.GetReview().GetID())
+		return h.evaluate(ctx, installationID, loc, dismissal.Review.NodeID)
+	}
+
+	return h.Evaluate(ctx, installationID, loc)
 }
@@ -0,0 +1,381 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/lock"
+)
+
+const (
+	DefaultQueueWorkers = 4
+	DefaultQueueSize    = 1000
+)
+
+type QueueConfig struct {
+	// Workers is the number of evaluations that run concurrently.
+	Workers int `yaml:"workers"`
+
+	// Size is the maximum number of pending evaluations.
+	Size int `yaml:"size"`
+}
+
+// QueuedEvaluation is a pull request waiting for evaluation.
+type QueuedEvaluation struct {
+	InstallationID int64
+	Locator        pull.Locator
+}
+
+// EvaluationQueue evaluates pull requests asynchronously, outside of the
+// context of a webhook. A pull request is only queued once, even if it is
+// requested multiple times before it is evaluated.
+type EvaluationQueue struct {
+	base   *Base
+	logger zerolog.Logger
+	jobs   chan QueuedEvaluation
+
+	workers int
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	mu          sync.Mutex
+	pending     map[string]bool
+	outstanding int
+	interrupted []QueuedEvaluation
+	draining    bool
+}
+
+func NewEvaluationQueue(base *Base, logger zerolog.Logger, c QueueConfig) *EvaluationQueue {
+	if c.Workers <= 0 {
+		c.Workers = DefaultQueueWorkers
+	}
+	if c.Size <= 0 {
+		c.Size = DefaultQueueSize
+	}
+
+	return &EvaluationQueue{
+		base:    base,
+		logger:  logger,
+		jobs:    make(chan QueuedEvaluation, c.Size),
+		workers: c.Workers,
+		pending: make(map[string]bool),
+	}
+}
+
+// Start starts the workers that process the queue. Workers exit when the
+// context is canceled or the queue is drained.
+func (q *EvaluationQueue) Start(ctx context.Context) {
+	ctx, q.cancel = context.WithCancel(ctx)
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+}
+
+// Enqueue schedules an evaluation of a pull request. It returns false if the
+// queue is full or draining and the evaluation was not scheduled.
+func (q *EvaluationQueue) Enqueue(installationID int64, loc pull.Locator) bool {
+	key := lock.PullRequestKey(loc.Owner, loc.Repo, loc.Number)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.draining {
+		return false
+	}
+	if q.pending[key] {
+		return true
+	}
+
+	select {
+	case q.jobs <- QueuedEvaluation{InstallationID: installationID, Locator: loc}:
+		q.pending[key] = true
+		q.outstanding++
+		return true
+	default:
+		return false
+	}
+}
+
+// EnqueueWait schedules an evaluation of a pull request, waiting while the
+// queue is full. It returns an error if the queue is draining or the context
+// is done before the evaluation was scheduled.
+func (q *EvaluationQueue) EnqueueWait(ctx context.Context, installationID int64, loc pull.Locator) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		q.mu.Lock()
+		draining := q.draining
+		q.mu.Unlock()
+		if draining {
+			return errors.New("evaluation queue is draining")
+		}
+
+		if q.Enqueue(installationID, loc) {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "evaluation queue is full")
+		}
+	}
+}
+
+// Len returns the number of pending evaluations.
+func (q *EvaluationQueue) Len() int {
+	return len(q.jobs)
+}
+
+// Drain stops accepting new evaluations and waits until all pending and
+// running evaluations finish or the context is done. It stops the workers
+// and returns the evaluations that did not finish.
+func (q *EvaluationQueue) Drain(ctx context.Context) []QueuedEvaluation {
+	q.mu.Lock()
+	q.draining = true
+	q.mu.Unlock()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+Wait:
+	for {
+		q.mu.Lock()
+		idle := q.outstanding == 0
+		q.mu.Unlock()
+		if idle {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			break Wait
+		}
+	}
+
+	// running evaluations fail quickly once the context is canceled and are
+	// recorded as interrupted
+	if q.cancel != nil {
+		q.cancel()
+	}
+	q.wg.Wait()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	unfinished := q.interrupted
+	for {
+		select {
+		case job := <-q.jobs:
+			unfinished = append(unfinished, job)
+		default:
+			return unfinished
+		}
+	}
+}
+
+func (q *EvaluationQueue) work(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		select {
+		case job := <-q.jobs:
+			q.evaluate(ctx, job)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *EvaluationQueue) evaluate(ctx context.Context, job QueuedEvaluation) {
+	loc := job.Locator
+
+	q.mu.Lock()
+	delete(q.pending, lock.PullRequestKey(loc.Owner, loc.Repo, loc.Number))
+	q.mu.Unlock()
+
+	var err error
+	defer func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		q.outstanding--
+		if err != nil && ctx.Err() != nil {
+			q.interrupted = append(q.interrupted, job)
+		}
+	}()
+
+	repo := &github.Repository{
+		Name:  &loc.Repo,
+		Owner: &github.User{Login: &loc.Owner},
+	}
+
+	ctx = q.logger.WithContext(withQueued(ctx))
+	ctx, logger := githubapp.PreparePRContext(ctx, job.InstallationID, repo, loc.Number)
+
+	if err = q.base.Evaluate(ctx, job.InstallationID, loc); err != nil {
+		logger.Error().Err(err).Msg("Failed to evaluate queued pull request")
+		if ctx.Err() == nil {
+			q.base.reportError(ctx, loc.Owner, loc.Repo, loc.Number, err, "Failed to evaluate queued pull request")
+		}
+	}
+}
+
+type queuedKey struct{}
+
+// withQueued marks a context as belonging to a queued evaluation.
+func withQueued(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queuedKey{}, true)
+}
+
+// isQueued returns true if a context belongs to a queued evaluation.
+func isQueued(ctx context.Context) bool {
+	queued, _ := ctx.Value(queuedKey{}).(bool)
+	return queued
+}
+
+// EnqueueOpenPullRequests schedules evaluations of all open pull requests in
+// a repository and returns the number of pull requests that were scheduled.
+func (q *EvaluationQueue) EnqueueOpenPullRequests(ctx context.Context, client *github.Client, installationID int64, owner, repo string) (int, error) {
+	prs, err := listOpenPullRequests(ctx, client, owner, repo)
+	if err != nil {
+		return 0, err
+	}
+
+	// do not include the pull request object in the locator: it may be out
+	// of date by the time the evaluation runs
+	count := 0
+	for _, pr := range prs {
+		if q.Enqueue(installationID, pull.Locator{
+			Owner:  owner,
+			Repo:   repo,
+			Number: pr.GetNumber(),
+		}) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// EvaluationEventType is the event type of saved evaluations in the dead
+// letter queue.
+const EvaluationEventType = "policy_bot_evaluation"
+
+type evaluationPayload struct {
+	InstallationID int64  `json:"installation_id"`
+	Owner          string `json:"owner"`
+	Repo           string `json:"repo"`
+	Number         int    `json:"number"`
+}
+
+// MarshalEvaluation encodes an evaluation so it can be saved and replayed by
+// an EvaluationHandler.
+func MarshalEvaluation(e QueuedEvaluation) ([]byte, error) {
+	return json.Marshal(evaluationPayload{
+		InstallationID: e.InstallationID,
+		Owner:          e.Locator.Owner,
+		Repo:           e.Locator.Repo,
+		Number:         e.Locator.Number,
+	})
+}
+
+// UnmarshalEvaluation decodes an evaluation encoded by MarshalEvaluation.
+func UnmarshalEvaluation(b []byte) (QueuedEvaluation, error) {
+	var p evaluationPayload
+	if err := json.Unmarshal(b, &p); err != nil {
+		return QueuedEvaluation{}, errors.Wrap(err, "failed to parse evaluation payload")
+	}
+	return QueuedEvaluation{
+		InstallationID: p.InstallationID,
+		Locator:        pull.Locator{Owner: p.Owner, Repo: p.Repo, Number: p.Number},
+	}, nil
+}
+
+// EvaluationHandler replays saved evaluations, like those that did not finish
+// before the server stopped.
+type EvaluationHandler struct {
+	Base
+}
+
+func (h *EvaluationHandler) Handles() []string {
+	return []string{EvaluationEventType}
+}
+
+func (h *EvaluationHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	e, err := UnmarshalEvaluation(payload)
+	if err != nil {
+		return err
+	}
+
+	loc := e.Locator
+	repo := &github.Repository{
+		Name:  &loc.Repo,
+		Owner: &github.User{Login: &loc.Owner},
+	}
+
+	ctx, _ = githubapp.PreparePRContext(ctx, e.InstallationID, repo, loc.Number)
+	return h.Evaluate(ctx, e.InstallationID, loc)
+}
+
+func listOpenPullRequests(ctx context.Context, client *github.Client, owner, repo string) ([]*github.PullRequest, error) {
+	opt := &github.PullRequestListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var all []*github.PullRequest
+	for {
+		prs, res, err := client.PullRequests.List(ctx, owner, repo, opt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list open pull requests for %s/%s", owner, repo)
+		}
+		all = append(all, prs...)
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+	return all, nil
+}
+
+func listInstallationRepositories(ctx context.Context, client *github.Client) ([]*github.Repository, error) {
+	opt := &github.ListOptions{PerPage: 100}
+
+	var all []*github.Repository
+	for {
+		repos, res, err := client.Apps.ListRepos(ctx, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list installation repositories")
+		}
+		all = append(all, repos...)
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+	return all, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/palantir/go-baseapp/baseapp"
+
+	"github.com/palantir/policy-bot/server/ratelimit"
+)
+
+// DefaultRateLimitTopRepositories is the number of repositories listed for
+// each rate limit if the request does not set one.
+const DefaultRateLimitTopRepositories = 10
+
+// RateLimits serves the current GitHub API rate limit state of each
+// installation, including the repositories that consumed the most of each
+// limit and when the limit will be exhausted at the current rate.
+type RateLimits struct {
+	Tracker *ratelimit.Tracker
+}
+
+func (h *RateLimits) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	top := DefaultRateLimitTopRepositories
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid top: must be a non-negative integer", http.StatusBadRequest)
+			return nil
+		}
+		top = n
+	}
+
+	installations := h.Tracker.Snapshot(top)
+	if owner := r.URL.Query().Get("owner"); owner != "" {
+		filtered := installations[:0]
+		for _, inst := range installations {
+			if inst.Owner == owner {
+				filtered = append(filtered, inst)
+			}
+		}
+		installations = filtered
+	}
+	if installations == nil {
+		installations = []ratelimit.Installation{}
+	}
+
+	baseapp.WriteJSON(w, http.StatusOK, installations)
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	DefaultReconcileMinRateLimit = 500
+)
+
+type ReconcileConfig struct {
+	// OnStartup enables reconciliation of all installations when the server
+	// starts.
+	OnStartup bool `yaml:"on_startup"`
+
+	// MinRateLimit is the number of remaining API requests below which
+	// reconciliation pauses until the rate limit resets.
+	MinRateLimit int `yaml:"min_rate_limit"`
+}
+
+// Reconciler finds open pull requests that do not have a policy status and
+// queues them for evaluation. This covers pull requests opened before the app
+// was installed and events that were missed while the server was down.
+type Reconciler struct {
+	Base
+	Queue  *EvaluationQueue
+	Config ReconcileConfig
+}
+
+// ReconcileAll reconciles every repository of every installation.
+func (r *Reconciler) ReconcileAll(ctx context.Context) error {
+	logger := zerolog.Ctx(ctx)
+
+	installations, err := r.Installations.ListAll(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list installations")
+	}
+
+	for _, installation := range installations {
+		if err := r.ReconcileInstallation(ctx, installation.ID, nil); err != nil {
+			logger.Error().Err(err).Msgf("Failed to reconcile installation %d", installation.ID)
+		}
+	}
+	return nil
+}
+
+// ReconcileInstallation reconciles the given repositories of an installation.
+// If repos is empty, it reconciles all repositories of the installation.
+func (r *Reconciler) ReconcileInstallation(ctx context.Context, installationID int64, repos []*github.Repository) error {
+	logger := zerolog.Ctx(ctx)
+
+	client, err := r.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	if len(repos) == 0 {
+		if repos, err = listInstallationRepositories(ctx, client); err != nil {
+			return err
+		}
+	}
+
+	queued := 0
+	for _, repo := range repos {
+		n, err := r.reconcileRepository(ctx, client, installationID, repo)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to reconcile repository %s", repo.GetFullName())
+			continue
+		}
+		queued += n
+	}
+
+	logger.Info().Msgf("Reconciled installation %d: queued %d pull requests in %d repositories", installationID, queued, len(repos))
+	return nil
+}
+
+func (r *Reconciler) reconcileRepository(ctx context.Context, client *github.Client, installationID int64, repo *github.Repository) (int, error) {
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+	prs, err := listOpenPullRequests(ctx, client, owner, name)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, pr := range prs {
+		state, res, err := r.policyState(ctx, client, owner, name, pr.GetBase().GetRef(), pr.GetHead().GetSHA())
+		if err != nil {
+			return queued, errors.Wrapf(err, "failed to get policy state for %s/%s#%d", owner, name, pr.GetNumber())
+		}
+
+		// wait for space in the queue instead of skipping pull requests,
+		// which would not be reconciled until the next full pass
+		if state == "" {
+			loc := pull.Locator{Owner: owner, Repo: name, Number: pr.GetNumber()}
+			if err := r.Queue.EnqueueWait(ctx, installationID, loc); err != nil {
+				r.Metrics.recordReconcileDropped(owner, name)
+				return queued, errors.WithMessage(err, fmt.Sprintf("failed to queue %s/%s#%d", owner, name, pr.GetNumber()))
+			}
+			queued++
+		}
+
+		if err := r.waitForRateLimit(ctx, res); err != nil {
+			return queued, err
+		}
+	}
+	return queued, nil
+}
+
+// waitForRateLimit blocks until the rate limit resets if the number of
+// remaining requests is below the configured minimum.
+func (r *Reconciler) waitForRateLimit(ctx context.Context, res *github.Response) error {
+	min := r.Config.MinRateLimit
+	if min <= 0 {
+		min = DefaultReconcileMinRateLimit
+	}
+
+	if res == nil || res.Rate.Limit == 0 || res.Rate.Remaining >= min {
+		return nil
+	}
+
+	wait := time.Until(res.Rate.Reset.Time)
+	zerolog.Ctx(ctx).Info().Msgf("Only %d API requests remain, pausing reconciliation for %s", res.Rate.Remaining, wait)
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/palantir/policy-bot/server/results"
+)
+
+// newResultPullRequest returns the stored form of an evaluation.
+func newResultPullRequest(prctx pull.Context, result *common.Result, state, description string) results.PullRequest {
+	base, _ := prctx.Branches()
+	return results.PullRequest{
+		Owner:       prctx.RepositoryOwner(),
+		Repo:        prctx.RepositoryName(),
+		Number:      prctx.Number(),
+		Title:       prctx.Title(),
+		Author:      prctx.Author(),
+		HeadSHA:     prctx.HeadSHA(),
+		BaseRef:     base,
+		CreatedAt:   prctx.CreatedAt(),
+		State:       state,
+		Description: description,
+		EvaluatedAt: time.Now(),
+		Rules:       results.NewRules(result),
+	}
+}
+
+// recordResult stores the latest evaluation of a pull request in the result
+// store, the evaluation history, and the compliance recorder, if configured.
+// Failures are logged but do not fail the evaluation.
+func (b *Base) recordResult(ctx context.Context, prctx pull.Context, result *common.Result, state, description string) {
+	if b.Results == nil && b.History == nil && b.Compliance == nil {
+		return
+	}
+
+	pr := newResultPullRequest(prctx, result, state, description)
+	if b.Compliance != nil {
+		b.Compliance.RecordEvaluation(pr)
+	}
+	if b.Results != nil {
+		if err := b.Results.Put(ctx, pr); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to store evaluation result")
+		}
+	}
+	if b.History != nil {
+		e := history.Evaluation{ID: history.NewID(), PullRequest: pr}
+		if t, ok := ctx.Value(triggerKey{}).(trigger); ok {
+			e.Event, e.Sender = t.event, t.sender
+		}
+		if err := b.History.Add(ctx, e); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to store evaluation history")
+		}
+	}
+}
+
+type triggerKey struct{}
+
+type trigger struct {
+	event  string
+	sender string
+}
+
+// withTrigger records the webhook event and action that caused evaluations
+// in the context and the user who sent the event, for the evaluation history.
+func withTrigger(ctx context.Context, eventType, action, sender string) context.Context {
+	return context.WithValue(ctx, triggerKey{}, trigger{event: eventType + "." + action, sender: sender})
+}
+
+// forgetResult removes a pull request from the result store, if configured.
+func (b *Base) forgetResult(ctx context.Context, loc pull.Locator) error {
+	if b.Results == nil {
+		return nil
+	}
+	return b.Results.Remove(ctx, loc.Owner, loc.Repo, loc.Number)
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+type pullRequestOpenedKey struct{}
+
+// withPullRequestOpened marks evaluations with the returned context as the
+// first evaluation of a pull request, so that every pending rule is new.
+func withPullRequestOpened(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pullRequestOpenedKey{}, true)
+}
+
+// requestReviewers requests reviews from the users and teams that can approve
+// the rules of a result that became pending since the last evaluation. Rules
+// request reviewers if enabled for the repository or if they set the
+// request_review option. It uses the result of the evaluation that posted the
+// status, so the pull request is not evaluated again.
+func (b *Base) requestReviewers(ctx context.Context, prctx pull.Context, client *github.Client, result *common.Result) error {
+	if result == nil {
+		return nil
+	}
+
+	owner, repo := prctx.RepositoryOwner(), prctx.RepositoryName()
+	enabled := b.PullOpts.ForRepository(owner, repo).RequestReviewers
+
+	pending, err := b.newlyPending(ctx, prctx, pendingResults(result))
+	if err != nil {
+		return err
+	}
+
+	var rules []*common.Result
+	for _, r := range pending {
+		if enabled || requestsReview(r.ReviewRequest) {
+			rules = append(rules, r)
+		}
+	}
+
+	req := reviewersForRules(rules, owner, prctx.Author())
+	if len(req.Reviewers) == 0 && len(req.TeamReviewers) == 0 {
+		return nil
+	}
+
+	zerolog.Ctx(ctx).Info().Msgf("Requesting reviews from users %q and teams %q", req.Reviewers, req.TeamReviewers)
+	_, _, err = client.PullRequests.RequestReviewers(ctx, owner, repo, prctx.Number(), req)
+	return errors.Wrap(err, "failed to request reviewers")
+}
+
+// newlyPending returns the pending rules that were not pending in the last
+// evaluation of the pull request and remembers the rules for the next
+// evaluation. If the last pending rules are unknown, all rules are new when
+// the pull request was just opened and none are new otherwise, so that
+// forgotten states do not request reviewers again.
+func (b *Base) newlyPending(ctx context.Context, prctx pull.Context, pending []*common.Result) ([]*common.Result, error) {
+	opened, _ := ctx.Value(pullRequestOpenedKey{}).(bool)
+	if b.PendingRules == nil {
+		if opened {
+			return pending, nil
+		}
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(pending))
+	for _, r := range pending {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+
+	state, err := json.Marshal(names)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode pending rules")
+	}
+
+	key := fmt.Sprintf("pending-rules:%s/%s#%d", prctx.RepositoryOwner(), prctx.RepositoryName(), prctx.Number())
+	prev, err := b.PendingRules.Swap(ctx, key, string(state))
+	if err != nil {
+		return nil, err
+	}
+	if prev == "" {
+		if opened {
+			return pending, nil
+		}
+		return nil, nil
+	}
+
+	var prevNames []string
+	if err := json.Unmarshal([]byte(prev), &prevNames); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Ignoring invalid pending rules")
+		return nil, nil
+	}
+	wasPending := make(map[string]bool, len(prevNames))
+	for _, name := range prevNames {
+		wasPending[name] = true
+	}
+
+	var rules []*common.Result
+	for _, r := range pending {
+		if !wasPending[r.Name] {
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+// requestsReview returns true if a rule explicitly requests reviewers with
+// the request_review option.
+func requestsReview(r *common.ReviewRequest) bool {
+	return r != nil && r.Mode != common.ReviewRequestNone
+}
+
+// reviewersForRules returns the users and teams that can approve the pending
+// rules, selected by the review request of each rule. Teams are
+// only included if they belong to the owner of the repository, because GitHub
+// cannot request reviews from other teams. Organizations, admins, and
+// collaborators are too broad to request.
+func reviewersForRules(rules []*common.Result, owner, author string) github.ReviewersRequest {
+	users := make(map[string]bool)
+	teams := make(map[string]bool)
+
+	for _, r := range rules {
+		if r.Requires == nil {
+			continue
+		}
+
+		// users and teams are selected together; team names contain a slash
+		// and logins cannot
+		var candidates []string
+		for _, u := range r.Requires.Users {
+			if !strings.EqualFold(u, author) {
+				candidates = append(candidates, u)
+			}
+		}
+		for _, t := range r.Requires.Teams {
+			parts := strings.SplitN(t, "/", 2)
+			if len(parts) == 2 && strings.EqualFold(parts[0], owner) {
+				candidates = append(candidates, t)
+			}
+		}
+
+		for _, c := range r.ReviewRequest.Select(candidates) {
+			if i := strings.IndexByte(c, '/'); i >= 0 {
+				teams[c[i+1:]] = true
+			} else {
+				users[c] = true
+			}
+		}
+	}
+
+	return github.ReviewersRequest{
+		Reviewers:     sortedKeys(users),
+		TeamReviewers: sortedKeys(teams),
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/pull"
+)
+
+// RoleMembership checks memberships for role assignment using the first app
+// that is installed for each organization.
+type RoleMembership struct {
+	Apps []*App
+}
+
+func (m *RoleMembership) IsOrgMember(ctx context.Context, org, user string) (bool, error) {
+	mbrCtx, err := m.membershipContext(ctx, org)
+	if err != nil || mbrCtx == nil {
+		return false, err
+	}
+	return mbrCtx.IsOrgMember(org, user)
+}
+
+func (m *RoleMembership) IsTeamMember(ctx context.Context, team, user string) (bool, error) {
+	org := strings.SplitN(team, "/", 2)[0]
+	mbrCtx, err := m.membershipContext(ctx, org)
+	if err != nil || mbrCtx == nil {
+		return false, err
+	}
+	return mbrCtx.IsTeamMember(team, user)
+}
+
+// membershipContext returns nil if no app is installed for the organization.
+func (m *RoleMembership) membershipContext(ctx context.Context, org string) (pull.MembershipContext, error) {
+	app, installation, err := FindInstallation(ctx, m.Apps, org)
+	if err != nil {
+		if _, notFound := errors.Cause(err).(githubapp.InstallationNotFound); notFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	client, err := app.Base.NewInstallationClient(installation.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create github client")
+	}
+	v4client, err := app.Base.NewInstallationV4Client(installation.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create github client")
+	}
+	return pull.NewGitHubMembershipContext(ctx, client, v4client), nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+const (
+	// maxSimulationBody is the maximum size of a simulation request
+	maxSimulationBody = 1 << 20
+
+	// maxSimulationFiles is the maximum number of changed files offered as
+	// simulation options; larger pull requests do not list files
+	maxSimulationFiles = 100
+)
+
+// simulation describes hypothetical changes to a pull request and its
+// policy. Evaluating a simulation never posts a status or records a result.
+type simulation struct {
+	pull.Hypothetical
+
+	// Policy, if set, is the YAML of a policy evaluated instead of the policy
+	// of the pull request
+	Policy string `json:"policy,omitempty"`
+}
+
+// parseSimulation returns the simulation submitted in the form of a details
+// request, or nil if the request is not a simulation.
+func parseSimulation(w http.ResponseWriter, r *http.Request) (*simulation, error) {
+	if r.Method != http.MethodPost {
+		return nil, nil
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSimulationBody)
+	if err := r.ParseForm(); err != nil {
+		return nil, errors.Wrap(err, "invalid simulation")
+	}
+
+	return &simulation{
+		Hypothetical: pull.Hypothetical{
+			Approvers:      r.PostForm["approver"],
+			UnchangedFiles: r.PostForm["unchanged"],
+		},
+		Policy: strings.TrimSpace(r.PostForm.Get("policy")),
+	}, nil
+}
+
+// parseSimulatedPolicy parses the policy of a simulation and adds the
+// deployment's comment keywords. Remote policies are not supported because
+// they would be loaded from another repository.
+func parseSimulatedPolicy(text string, keywords common.Keywords) (*policy.Config, error) {
+	b := []byte(text)
+	if err := policy.DefaultLimits.Check(b); err != nil {
+		return nil, err
+	}
+	if policy.IsRemoteConfig(b) {
+		return nil, errors.New("remote policies cannot be simulated")
+	}
+
+	config, err := policy.ParseConfigWithLimits(b, policy.DefaultLimits)
+	if err != nil {
+		return nil, err
+	}
+	config.AddKeywords(keywords)
+	return config, nil
+}
+
+// simulationOption is a choice offered by the simulation form.
+type simulationOption struct {
+	Name    string
+	Checked bool
+}
+
+// simulationApprovers returns the users who can be assumed to approve: the
+// users listed by approval rules, the users who already tried to approve, and
+// the users checked in the simulation.
+func simulationApprovers(result *common.Result, sim *simulation) []simulationOption {
+	users := make(map[string]bool)
+	if result != nil {
+		for _, r := range leafResults(result) {
+			if r.Requires != nil {
+				for _, u := range r.Requires.Users {
+					users[pull.CanonicalLogin(u)] = true
+				}
+			}
+			for _, d := range r.Approvals {
+				users[pull.CanonicalLogin(d.User)] = true
+			}
+		}
+	}
+
+	checked := make(map[string]bool)
+	if sim != nil {
+		for _, u := range sim.Approvers {
+			users[pull.CanonicalLogin(u)] = true
+			checked[pull.CanonicalLogin(u)] = true
+		}
+	}
+	return simulationOptions(users, checked)
+}
+
+// simulationFiles returns the changed files of a pull request that can be
+// assumed to be unchanged. It returns nil if the files cannot be listed or if
+// there are too many to offer.
+func simulationFiles(prctx pull.Context, sim *simulation) []simulationOption {
+	files, err := prctx.ChangedFiles()
+	if err != nil || len(files) > maxSimulationFiles {
+		return nil
+	}
+
+	names := make(map[string]bool, len(files))
+	for _, f := range files {
+		names[f.Filename] = true
+	}
+
+	checked := make(map[string]bool)
+	if sim != nil {
+		for _, f := range sim.UnchangedFiles {
+			checked[f] = true
+		}
+	}
+	return simulationOptions(names, checked)
+}
+
+func simulationOptions(names, checked map[string]bool) []simulationOption {
+	options := make([]simulationOption, 0, len(names))
+	for name := range names {
+		options = append(options, simulationOption{Name: name, Checked: checked[name]})
+	}
+	sort.Slice(options, func(i, j int) bool { return options[i].Name < options[j].Name })
+	return options
+}
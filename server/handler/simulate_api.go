@@ -0,0 +1,129 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+)
+
+// SimulateAPI evaluates a pull request with hypothetical changes or an
+// alternate policy and returns the result. Like simulations on the details
+// page, it never posts a status or stores a result. Requests use the first
+// app that is installed for the owner.
+type SimulateAPI struct {
+	Apps []*App
+}
+
+type simulateRequest struct {
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+
+	simulation
+}
+
+func (h *SimulateAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	var sr simulateRequest
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSimulationBody)
+	if err := json.NewDecoder(r.Body).Decode(&sr); err != nil {
+		http.Error(w, fmt.Sprintf("invalid simulation: %v", err), http.StatusBadRequest)
+		return nil
+	}
+	if sr.Owner == "" || sr.Repo == "" || sr.Number <= 0 {
+		http.Error(w, "invalid simulation: owner, repo, and number are required", http.StatusBadRequest)
+		return nil
+	}
+	sr.Policy = strings.TrimSpace(sr.Policy)
+
+	req := &detailsRequest{Owner: sr.Owner, Repo: sr.Repo, Number: sr.Number}
+
+	var err error
+	req.App, req.Installation, err = FindInstallation(r.Context(), h.Apps, sr.Owner)
+	if err != nil {
+		if _, notFound := errors.Cause(err).(githubapp.InstallationNotFound); notFound {
+			req.notFound(w)
+			return nil
+		}
+		return err
+	}
+
+	req.Client, err = req.App.Base.NewInstallationClient(req.Installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create github client")
+	}
+
+	ctx, pr, prctx, err := req.loadPullRequest(r.Context())
+	if err != nil {
+		return err
+	}
+	if pr == nil {
+		req.notFound(w)
+		return nil
+	}
+
+	base := req.App.Base
+	_, result, err := evaluateSimulation(ctx, base, req.Client, prctx, &sr.simulation)
+
+	baseapp.WriteJSON(w, http.StatusOK, detailsJSON(base.Messages, prctx, result, err))
+	return nil
+}
+
+// evaluateSimulation evaluates a simulation of a pull request and returns
+// the policy of the repository, even if the simulation replaces it. Errors in
+// the policy are returned as errors, which are reported in the response.
+func evaluateSimulation(ctx context.Context, base *Base, client *github.Client, prctx pull.Context, sim *simulation) (FetchedConfig, *common.Result, error) {
+	fetched, err := base.ConfigFetcher.ConfigForPR(ctx, prctx, client)
+	if err != nil {
+		return fetched, nil, errors.WithMessage(err, fmt.Sprintf("Failed to fetch configuration at ref=%s", fetched.Ref))
+	}
+
+	config := fetched
+	if sim.Policy != "" {
+		config.Error = nil
+		if config.Config, err = parseSimulatedPolicy(sim.Policy, base.PullOpts.ForRepository(prctx.RepositoryOwner(), prctx.RepositoryName()).CommentKeywords); err != nil {
+			return fetched, nil, errors.WithMessage(err, "invalid simulated policy")
+		}
+	}
+
+	if config.Missing() {
+		return fetched, nil, errors.New(config.Description(base.Messages))
+	}
+	if config.Invalid() {
+		return fetched, nil, errors.WithMessage(config.Error, config.Description(base.Messages))
+	}
+
+	evaluator, err := policy.ParsePolicy(config.Config)
+	if err != nil {
+		return fetched, nil, errors.WithMessage(err, fmt.Sprintf("invalid policy at ref \"%s\"", config.Ref))
+	}
+
+	result := evaluator.Evaluate(ctx, pull.WithHypothetical(prctx, sim.Hypothetical))
+	localizeResult(base.Messages, &result)
+	return fetched, &result, nil
+}
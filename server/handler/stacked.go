@@ -0,0 +1,96 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/messages"
+)
+
+// upstreamStatus returns the state and description to post for a pull
+// request. If the policy requires upstream approval and the pull request is
+// stacked on an open pull request, a successful state is pending until the
+// policy status of the upstream pull request is also successful.
+func (b *Base) upstreamStatus(ctx context.Context, prctx pull.Context, client *github.Client, fetchedConfig FetchedConfig, state, description string) (string, string, error) {
+	if state != "success" || !fetchedConfig.Valid() {
+		return state, description, nil
+	}
+	if stacked := fetchedConfig.Config.Stacked; stacked == nil || !stacked.RequireUpstreamApproval {
+		return state, description, nil
+	}
+
+	upstream, err := prctx.Upstream()
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to load upstream pull request")
+	}
+	if upstream == nil || upstream.Merged {
+		return state, description, nil
+	}
+
+	owner, repo := prctx.RepositoryOwner(), prctx.RepositoryName()
+	upstreamState, _, err := b.policyState(ctx, client, owner, repo, upstream.Base, upstream.HeadSHA)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to get policy state of upstream pull request #%d", upstream.Number)
+	}
+	if upstreamState == "success" {
+		return state, description, nil
+	}
+
+	zerolog.Ctx(ctx).Debug().Msgf("Policy is approved, but upstream pull request #%d is not", upstream.Number)
+	return "pending", b.Messages.Format(messages.StatusUpstreamPending, messages.Args{"Number": upstream.Number}), nil
+}
+
+// evaluateDependents schedules evaluations of the open pull requests stacked
+// on a branch, so that they notice when their upstream pull request is
+// approved, merged, or closed.
+func (b *Base) evaluateDependents(ctx context.Context, client *github.Client, installationID int64, owner, repo, branch string) error {
+	if b.Queue == nil {
+		return nil
+	}
+
+	opt := &github.PullRequestListOptions{
+		State:       "open",
+		Base:        branch,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	count := 0
+	for {
+		prs, res, err := client.PullRequests.List(ctx, owner, repo, opt)
+		if err != nil {
+			return errors.Wrapf(err, "failed to list pull requests stacked on %s", branch)
+		}
+		for _, pr := range prs {
+			if b.Queue.Enqueue(installationID, pull.Locator{Owner: owner, Repo: repo, Number: pr.GetNumber()}) {
+				count++
+			}
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+
+	if count > 0 {
+		zerolog.Ctx(ctx).Debug().Msgf("Queued %d pull requests stacked on %s", count, branch)
+	}
+	return nil
+}
@@ -17,12 +17,14 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/messages"
 )
 
 type Status struct {
@@ -50,10 +52,16 @@ func (h *Status) Handle(ctx context.Context, eventType, deliveryID string, paylo
 	}
 
 	ctx, logger := githubapp.PrepareRepoContext(ctx, installationID, repo)
+	ctx = withRateLimitSource(ctx, installationID, repo)
 
-	// ignore contexts that are not ours
-	if !strings.HasPrefix(event.GetContext(), h.PullOpts.StatusCheckContext) {
+	// other successful statuses may make pull requests ready to auto-merge,
+	// but are otherwise ignored
+	opts := h.PullOpts.ForRepository(ownerName, repoName)
+	if !strings.HasPrefix(event.GetContext(), opts.StatusCheckContext) {
 		logger.Debug().Msgf("Ignoring context event for '%s'", event.GetContext())
+		if event.GetState() == "success" {
+			return h.tryAutoMergeBranches(ctx, client, installationID, &event)
+		}
 		return nil
 	}
 
@@ -73,8 +81,20 @@ func (h *Status) Handle(ctx context.Context, eventType, deliveryID string, paylo
 				event.GetTargetURL(),
 			)
 
+		if h.Compliance != nil {
+			h.Compliance.RecordOverride(StatusOverride{
+				Owner:   ownerName,
+				Repo:    repoName,
+				SHA:     commitSHA,
+				Context: event.GetContext(),
+				State:   event.GetState(),
+				Sender:  sender.GetLogin(),
+				Time:    time.Now(),
+			})
+		}
+
 		// must be less than 140 characters to satisfy GitHub API
-		desc := fmt.Sprintf("'%s' overwrote status to '%s'", sender.GetLogin(), event.GetState())
+		desc := h.Messages.Format(messages.StatusOverwritten, messages.Args{"Sender": sender.GetLogin(), "State": event.GetState()})
 
 		// unlike in other code, use a single context here because we want to
 		// replace a forged context with a failure, not post a general status
@@ -89,5 +109,42 @@ func (h *Status) Handle(ctx context.Context, eventType, deliveryID string, paylo
 		return err
 	}
 
+	// component statuses do not affect stacked pull requests
+	if strings.HasPrefix(event.GetContext(), opts.StatusCheckContext+"/") {
+		return nil
+	}
+
+	// the status changed, so pull requests stacked on the branches that point
+	// to the commit may require a different status
+	for _, branch := range event.Branches {
+		if err := h.evaluateDependents(ctx, client, installationID, ownerName, repoName, branch.GetName()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tryAutoMergeCommit tries to merge the open pull requests whose head is the
+// commit of a status event. It only finds pull requests from branches in the
+// same repository.
+func (h *Status) tryAutoMergeBranches(ctx context.Context, client *github.Client, installationID int64, event *github.StatusEvent) error {
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	sha := event.GetCommit().GetSHA()
+
+	for _, branch := range event.Branches {
+		if branch.GetCommit().GetSHA() != sha {
+			continue
+		}
+
+		prs, _, err := client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+			State: "open",
+			Head:  owner + ":" + branch.GetName(),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to list pull requests for branch %s", branch.GetName())
+		}
+		h.tryAutoMergeCommit(ctx, installationID, owner, repo, sha, prs)
+	}
 	return nil
 }
@@ -0,0 +1,185 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/pull"
+	"github.com/palantir/policy-bot/server/messages"
+)
+
+// summaryMarker identifies the summary comment so it can be found and edited
+// by later evaluations.
+const summaryMarker = "<!-- policy-bot: summary -->"
+
+// isSummaryComment returns true if a comment is a summary posted by this app.
+// Comments by other apps are ignored, even if they contain the marker.
+func (b *Base) isSummaryComment(c *github.IssueComment) bool {
+	return b.isAppComment(c) && strings.Contains(c.GetBody(), summaryMarker)
+}
+
+// isAppComment returns true if a comment was posted by the bot user of this
+// app.
+func (b *Base) isAppComment(c *github.IssueComment) bool {
+	return pull.CanonicalLogin(c.GetUser().GetLogin()) == pull.AppLogin(b.PullOpts.AppName)
+}
+
+// postSummaryComment creates or updates the summary comment on a pull request,
+// if summary comments are enabled for the repository.
+func (b *Base) postSummaryComment(ctx context.Context, prctx pull.Context, client *github.Client, result *common.Result, state, description string) error {
+	owner, repo, number := prctx.RepositoryOwner(), prctx.RepositoryName(), prctx.Number()
+	if !b.PullOpts.ForRepository(owner, repo).SummaryComment {
+		return nil
+	}
+
+	body := b.summaryBody(prctx, result, state, description)
+
+	existing, err := b.findSummaryComment(ctx, client, owner, repo, number)
+	if err != nil {
+		return err
+	}
+
+	logger := zerolog.Ctx(ctx)
+	switch {
+	case existing == nil:
+		logger.Info().Msg("Creating summary comment")
+		_, _, err = client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: &body})
+	case existing.GetBody() != body:
+		logger.Info().Msgf("Updating summary comment %d", existing.GetID())
+		_, _, err = client.Issues.EditComment(ctx, owner, repo, existing.GetID(), &github.IssueComment{Body: &body})
+	}
+	return errors.Wrap(err, "failed to post summary comment")
+}
+
+func (b *Base) findSummaryComment(ctx context.Context, client *github.Client, owner, repo string, number int) (*github.IssueComment, error) {
+	opt := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	for {
+		comments, res, err := client.Issues.ListComments(ctx, owner, repo, number, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list comments")
+		}
+		for _, c := range comments {
+			if b.isSummaryComment(c) {
+				return c, nil
+			}
+		}
+		if res.NextPage == 0 {
+			return nil, nil
+		}
+		opt.Page = res.NextPage
+	}
+}
+
+func (b *Base) summaryBody(prctx pull.Context, result *common.Result, state, description string) string {
+	return summaryMarker + "\n" + b.summaryTable(prctx, result, state, description)
+}
+
+// summaryTable returns a Markdown table with the status of each rule, preceded
+// by the overall status and followed by a link to the details page.
+func (b *Base) summaryTable(prctx pull.Context, result *common.Result, state, description string) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "**%s**: %s\n", summaryTitle(b.Messages, state), description)
+
+	if result != nil {
+		var rows []string
+		for _, r := range leafResults(result) {
+			if r.Name == "disapproval" && r.Status != common.StatusDisapproved {
+				continue
+			}
+			rows = append(rows, fmt.Sprintf("| %s | %s | %s | %s |", escapeTableCell(r.Name), b.Messages.State(r.Status.String()), escapeTableCell(r.Description), approvers(b.Messages, r)))
+		}
+
+		if len(rows) > 0 {
+			fmt.Fprintf(&sb, "\n| %s | %s | %s | %s |\n",
+				b.Messages.Text(messages.SummaryColumnRule),
+				b.Messages.Text(messages.SummaryColumnStatus),
+				b.Messages.Text(messages.SummaryColumnDetails),
+				b.Messages.Text(messages.SummaryColumnApprovers))
+			sb.WriteString("| --- | --- | --- | --- |\n")
+			sb.WriteString(strings.Join(rows, "\n") + "\n")
+		}
+	}
+
+	detailsURL := b.DetailsURL(prctx.RepositoryOwner(), prctx.RepositoryName(), prctx.Number())
+	fmt.Fprintf(&sb, "\n[%s](%s)\n", b.Messages.Text(messages.SummaryViewDetails), detailsURL)
+	return sb.String()
+}
+
+func summaryTitle(m *messages.Catalog, state string) string {
+	switch state {
+	case "success":
+		return m.Text(messages.SummaryTitleSuccess)
+	case "failure":
+		return m.Text(messages.SummaryTitleFailure)
+	case "pending":
+		return m.Text(messages.SummaryTitlePending)
+	}
+	return m.Text(messages.SummaryTitleError)
+}
+
+// approvers describes the actors who can approve a pending rule.
+func approvers(m *messages.Catalog, r *common.Result) string {
+	if r.Status != common.StatusPending || r.Requires == nil {
+		return ""
+	}
+
+	var parts []string
+	add := func(id string, names []string) {
+		for _, name := range names {
+			parts = append(parts, m.Format(id, messages.Args{"Name": name}))
+		}
+	}
+	add(messages.SummaryApproverUser, r.Requires.Users)
+	add(messages.SummaryApproverTeam, r.Requires.Teams)
+	add(messages.SummaryApproverOrganization, r.Requires.Organizations)
+	add(messages.SummaryApproverGroup, r.Requires.Groups)
+	add(messages.SummaryApproverApp, r.Requires.Apps)
+	if r.Requires.Admins {
+		parts = append(parts, m.Text(messages.SummaryApproverAdmins))
+	}
+	if r.Requires.WriteCollaborators {
+		parts = append(parts, m.Text(messages.SummaryApproverWriters))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// leafResults returns the results in a tree that have no children.
+func leafResults(r *common.Result) []*common.Result {
+	if len(r.Children) == 0 {
+		return []*common.Result{r}
+	}
+
+	var results []*common.Result
+	for _, c := range r.Children {
+		results = append(results, leafResults(c)...)
+	}
+	return results
+}
+
+func escapeTableCell(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// WebhookRoute is the webhook handler for one GitHub App.
+type WebhookRoute struct {
+	Secret  string
+	Handler http.Handler
+}
+
+// WebhookRouter sends each webhook delivery to the first route whose secret
+// produces the signature of the delivery. This allows multiple GitHub Apps to
+// share a webhook URL. Every route must have a secret; deliveries that no
+// secret validates are rejected.
+//
+// The routes slice is never modified in place: changes replace it with a
+// copy, so deliveries can read a snapshot without holding the lock.
+type WebhookRouter struct {
+	mu     sync.RWMutex
+	routes []WebhookRoute
+}
+
+// AddRoute adds a route and returns its index.
+func (h *WebhookRouter) AddRoute(route WebhookRoute) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	routes := make([]WebhookRoute, len(h.routes), len(h.routes)+1)
+	copy(routes, h.routes)
+	h.routes = append(routes, route)
+	return len(h.routes) - 1
+}
+
+// SetRoute replaces the route at an index, for example when the webhook
+// secret of an app changes.
+func (h *WebhookRouter) SetRoute(i int, route WebhookRoute) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	routes := make([]WebhookRoute, len(h.routes))
+	copy(routes, h.routes)
+	routes[i] = route
+	h.routes = routes
+}
+
+func (h *WebhookRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read webhook payload")
+	}
+
+	h.mu.RLock()
+	routes := h.routes
+	h.mu.RUnlock()
+
+	signature := r.Header.Get("X-Hub-Signature")
+	for _, route := range routes {
+		if route.Secret != "" && github.ValidateSignature(signature, body, []byte(route.Secret)) == nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			route.Handler.ServeHTTP(w, r)
+			return nil
+		}
+	}
+
+	http.Error(w, "invalid webhook signature", http.StatusBadRequest)
+	return nil
+}
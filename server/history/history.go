@@ -0,0 +1,295 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package history stores recent evaluations of each pull request so that a
+// specific evaluation can be linked and exported after newer evaluations
+// replace it.
+package history
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/redis"
+	"github.com/palantir/policy-bot/server/results"
+)
+
+const (
+	DefaultMaxPerPullRequest = 50
+	DefaultTTL               = 30 * 24 * time.Hour
+	DefaultMaxPullRequests   = 1000
+
+	redisKeyPrefix = "policy-bot:history:"
+)
+
+type Config struct {
+	// Enabled enables storing evaluations.
+	Enabled bool `yaml:"enabled"`
+
+	// MaxPerPullRequest is the number of evaluations kept for each pull
+	// request. Older evaluations are discarded.
+	MaxPerPullRequest int `yaml:"max_per_pull_request"`
+
+	// TTL is how long evaluations are kept after the last evaluation of
+	// their pull request.
+	TTL time.Duration `yaml:"ttl"`
+
+	// MaxPullRequests is the maximum number of pull requests with evaluations
+	// kept in memory. It does not apply when evaluations are stored in Redis.
+	MaxPullRequests int `yaml:"max_pull_requests"`
+}
+
+// Evaluation is a stored evaluation of a pull request.
+type Evaluation struct {
+	ID string `json:"id"`
+
+	// Event is the webhook event and action that caused the evaluation, like
+	// "pull_request.synchronize", and Sender is the user who caused the
+	// event. Both are empty for evaluations that no event caused directly,
+	// like retries.
+	Event  string `json:"event,omitempty"`
+	Sender string `json:"sender,omitempty"`
+
+	results.PullRequest
+}
+
+// NewID returns a new random evaluation ID.
+func NewID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// Store stores recent evaluations of pull requests.
+type Store interface {
+	// Add stores an evaluation, discarding the oldest evaluation of the pull
+	// request if it has too many.
+	Add(ctx context.Context, e Evaluation) error
+
+	// Get returns the evaluation with the given ID, or nil if it does not
+	// exist or was discarded.
+	Get(ctx context.Context, id string) (*Evaluation, error)
+
+	// List returns the stored evaluations of a pull request, newest first.
+	List(ctx context.Context, owner, repo string, number int) ([]Evaluation, error)
+}
+
+// New returns a Store for the given configuration, or nil if storing
+// evaluations is disabled. If client is non-nil, evaluations are stored in
+// Redis. Otherwise, they are stored in memory.
+func New(c Config, client *redis.Client) Store {
+	if !c.Enabled {
+		return nil
+	}
+	if c.MaxPerPullRequest <= 0 {
+		c.MaxPerPullRequest = DefaultMaxPerPullRequest
+	}
+	if c.TTL <= 0 {
+		c.TTL = DefaultTTL
+	}
+	if c.MaxPullRequests <= 0 {
+		c.MaxPullRequests = DefaultMaxPullRequests
+	}
+	if client != nil {
+		return &RedisStore{Client: client, MaxPerPullRequest: c.MaxPerPullRequest, TTL: c.TTL}
+	}
+	return NewMemoryStore(c.MaxPerPullRequest, c.TTL, c.MaxPullRequests)
+}
+
+// MemoryStore is a Store that keeps evaluations in memory.
+type MemoryStore struct {
+	maxPerPullRequest int
+	ttl               time.Duration
+	maxPullRequests   int
+
+	mu  sync.Mutex
+	prs map[string][]Evaluation
+	ids map[string]string
+}
+
+func NewMemoryStore(maxPerPullRequest int, ttl time.Duration, maxPullRequests int) *MemoryStore {
+	return &MemoryStore{
+		maxPerPullRequest: maxPerPullRequest,
+		ttl:               ttl,
+		maxPullRequests:   maxPullRequests,
+		prs:               make(map[string][]Evaluation),
+		ids:               make(map[string]string),
+	}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, e Evaluation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := results.Key(e.Owner, e.Repo, e.Number)
+	evals := append([]Evaluation{e}, s.prs[key]...)
+	for len(evals) > s.maxPerPullRequest {
+		delete(s.ids, evals[len(evals)-1].ID)
+		evals = evals[:len(evals)-1]
+	}
+	s.prs[key] = evals
+	s.ids[e.ID] = key
+
+	s.expire(time.Now())
+	return nil
+}
+
+// expire removes pull requests whose latest evaluation is older than the TTL
+// or, if there are too many pull requests, the pull request that was
+// evaluated least recently.
+func (s *MemoryStore) expire(now time.Time) {
+	var oldest string
+	for key, evals := range s.prs {
+		if now.Sub(evals[0].EvaluatedAt) > s.ttl {
+			s.remove(key)
+			continue
+		}
+		if oldest == "" || evals[0].EvaluatedAt.Before(s.prs[oldest][0].EvaluatedAt) {
+			oldest = key
+		}
+	}
+	if len(s.prs) > s.maxPullRequests {
+		s.remove(oldest)
+	}
+}
+
+func (s *MemoryStore) remove(key string) {
+	for _, e := range s.prs[key] {
+		delete(s.ids, e.ID)
+	}
+	delete(s.prs, key)
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Evaluation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.prs[s.ids[id]] {
+		if e.ID == id {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, owner, repo string, number int) ([]Evaluation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Evaluation(nil), s.prs[results.Key(owner, repo, number)]...), nil
+}
+
+// RedisStore is a Store that keeps evaluations in Redis, so that all servers
+// sharing the Redis instance see the same evaluations. Each evaluation is a
+// key and each pull request has a list of evaluation IDs. Redis expires the
+// keys.
+type RedisStore struct {
+	Client            *redis.Client
+	MaxPerPullRequest int
+	TTL               time.Duration
+}
+
+func evaluationKey(id string) string {
+	return redisKeyPrefix + "evaluation:" + id
+}
+
+func pullRequestKey(owner, repo string, number int) string {
+	return redisKeyPrefix + "pr:" + results.Key(owner, repo, number)
+}
+
+func (s *RedisStore) Add(ctx context.Context, e Evaluation) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal evaluation")
+	}
+
+	ttl := int64(s.TTL / time.Second)
+	if _, err := s.Client.Do(ctx, "SET", evaluationKey(e.ID), b, "EX", ttl); err != nil {
+		return errors.Wrap(err, "failed to store evaluation")
+	}
+
+	key := pullRequestKey(e.Owner, e.Repo, e.Number)
+	if _, err := s.Client.Do(ctx, "LPUSH", key, e.ID); err != nil {
+		return errors.Wrap(err, "failed to store evaluation")
+	}
+	if _, err := s.Client.Do(ctx, "LTRIM", key, 0, s.MaxPerPullRequest-1); err != nil {
+		return errors.Wrap(err, "failed to trim evaluations")
+	}
+	if _, err := s.Client.Do(ctx, "EXPIRE", key, ttl); err != nil {
+		return errors.Wrap(err, "failed to expire evaluations")
+	}
+	return nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, id string) (*Evaluation, error) {
+	reply, err := s.Client.Do(ctx, "GET", evaluationKey(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get evaluation")
+	}
+	if reply == nil {
+		return nil, nil
+	}
+
+	var e Evaluation
+	if err := json.Unmarshal([]byte(reply.(string)), &e); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal evaluation")
+	}
+	return &e, nil
+}
+
+func (s *RedisStore) List(ctx context.Context, owner, repo string, number int) ([]Evaluation, error) {
+	reply, err := s.Client.Do(ctx, "LRANGE", pullRequestKey(owner, repo, number), 0, -1)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list evaluations")
+	}
+
+	ids, _ := reply.([]interface{})
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{"MGET"}
+	for _, id := range ids {
+		args = append(args, evaluationKey(id.(string)))
+	}
+	reply, err = s.Client.Do(ctx, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get evaluations")
+	}
+
+	values, _ := reply.([]interface{})
+	evals := make([]Evaluation, 0, len(values))
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		var e Evaluation
+		if err := json.Unmarshal([]byte(v.(string)), &e); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal evaluation")
+		}
+		evals = append(evals, e)
+	}
+
+	sort.SliceStable(evals, func(i, j int) bool {
+		return evals[i].EvaluatedAt.After(evals[j].EvaluatedAt)
+	})
+	return evals, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/palantir/policy-bot/server/results"
+)
+
+// Entry is an evaluation in a timeline and the changes since the previous
+// evaluation of the pull request.
+type Entry struct {
+	Evaluation
+
+	Changes []string
+}
+
+// Timeline returns an entry for each of the evaluations of a pull request,
+// which must be ordered newest first, like the result of Store.List. Each
+// entry describes how the head commit, status, rules, and approvals changed
+// since the previous stored evaluation.
+func Timeline(evals []Evaluation) []Entry {
+	entries := make([]Entry, len(evals))
+	for i, e := range evals {
+		entries[i].Evaluation = e
+		if i == len(evals)-1 {
+			entries[i].Changes = []string{"Oldest stored evaluation"}
+			continue
+		}
+		entries[i].Changes = changes(evals[i+1], e)
+	}
+	return entries
+}
+
+func changes(prev, next Evaluation) []string {
+	var cs []string
+	if prev.HeadSHA != next.HeadSHA {
+		cs = append(cs, fmt.Sprintf("Head changed from %.10s to %.10s", prev.HeadSHA, next.HeadSHA))
+	}
+	if prev.State != next.State {
+		cs = append(cs, fmt.Sprintf("Status changed from %s to %s", prev.State, next.State))
+	}
+
+	prevRules := make(map[string]int, len(prev.Rules))
+	for i, r := range prev.Rules {
+		prevRules[r.Name] = i
+	}
+	for _, r := range next.Rules {
+		i, ok := prevRules[r.Name]
+		if !ok {
+			cs = append(cs, fmt.Sprintf("Rule %q added as %s", r.Name, r.Status))
+			continue
+		}
+		p := prev.Rules[i]
+		if p.Status != r.Status {
+			cs = append(cs, fmt.Sprintf("Rule %q changed from %s to %s", r.Name, p.Status, r.Status))
+		}
+
+		counted := make(map[string]bool)
+		for _, a := range p.Approvals {
+			if a.Counted {
+				counted[a.User] = true
+			}
+		}
+		for _, a := range r.Approvals {
+			switch {
+			case a.Counted && !counted[a.User]:
+				cs = append(cs, fmt.Sprintf("Approval by %s counted for rule %q", a.User, r.Name))
+			case !a.Counted && counted[a.User]:
+				cs = append(cs, fmt.Sprintf("Approval by %s no longer counts for rule %q: %s", a.User, r.Name, a.Reason))
+			case !a.Counted && strings.HasPrefix(a.Reason, "invalidated by push") && !invalidated(p, a.User):
+				cs = append(cs, fmt.Sprintf("Approval by %s %s for rule %q", a.User, a.Reason, r.Name))
+			}
+		}
+	}
+	return cs
+}
+
+func invalidated(r results.Rule, user string) bool {
+	for _, a := range r.Approvals {
+		if a.User == user && strings.HasPrefix(a.Reason, "invalidated by push") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,252 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package incomplete records evaluations that could not finish because of
+// GitHub rate limits or transient errors, so that they are retried later
+// instead of reporting an error.
+package incomplete
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/lock"
+	"github.com/palantir/policy-bot/server/redis"
+)
+
+const (
+	// MarkerTTL is how long a marker is kept after it is last updated
+	MarkerTTL = 24 * time.Hour
+
+	redisMarkerPrefix = "policy-bot:incomplete:"
+	redisScheduleKey  = "policy-bot:incomplete-schedule"
+)
+
+// Evaluation is the marker of an incomplete evaluation.
+type Evaluation struct {
+	// App is the name of the app that evaluates the pull request
+	App string `json:"app"`
+
+	InstallationID int64  `json:"installation_id"`
+	Owner          string `json:"owner"`
+	Repo           string `json:"repo"`
+	Number         int    `json:"number"`
+
+	// Attempts is the number of evaluations that did not finish
+	Attempts int `json:"attempts"`
+
+	// RetryAt is when the evaluation is retried
+	RetryAt time.Time `json:"retry_at"`
+
+	// Reason is the error that stopped the last attempt
+	Reason string `json:"reason"`
+}
+
+// Key returns the key of the marker for the evaluation.
+func (e Evaluation) Key() string {
+	return Key(e.App, e.Owner, e.Repo, e.Number)
+}
+
+// Key returns the key of the marker for a pull request evaluated by an app.
+func Key(app, owner, repo string, number int) string {
+	return app + ":" + lock.PullRequestKey(owner, repo, number)
+}
+
+// Store stores the markers of incomplete evaluations.
+type Store interface {
+	// Get returns the marker with the given key, or nil if there is none.
+	Get(ctx context.Context, key string) (*Evaluation, error)
+
+	// Mark adds or replaces the marker of an evaluation and schedules a retry
+	// at the evaluation's RetryAt time.
+	Mark(ctx context.Context, e Evaluation) error
+
+	// Clear removes the marker with the given key, if it exists.
+	Clear(ctx context.Context, key string) error
+
+	// Due returns the evaluations whose retry time is not after now. Each
+	// scheduled retry is returned by exactly one call, but the marker remains
+	// until it is cleared or marked again.
+	Due(ctx context.Context, now time.Time) ([]Evaluation, error)
+}
+
+// New returns a Store that uses Redis if client is non-nil. Otherwise,
+// markers are kept in memory and are lost when the process stops.
+func New(client *redis.Client) Store {
+	if client != nil {
+		return &RedisStore{Client: client}
+	}
+	return NewMemoryStore()
+}
+
+type memoryEntry struct {
+	evaluation Evaluation
+	scheduled  bool
+	updated    time.Time
+}
+
+// MemoryStore is a Store that keeps markers in memory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Evaluation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || time.Since(entry.updated) > MarkerTTL {
+		return nil, nil
+	}
+	e := entry.evaluation
+	return &e, nil
+}
+
+func (s *MemoryStore) Mark(ctx context.Context, e Evaluation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[e.Key()] = &memoryEntry{evaluation: e, scheduled: true, updated: time.Now()}
+	return nil
+}
+
+func (s *MemoryStore) Clear(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) Due(ctx context.Context, now time.Time) ([]Evaluation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Evaluation
+	for key, entry := range s.entries {
+		if now.Sub(entry.updated) > MarkerTTL {
+			delete(s.entries, key)
+			continue
+		}
+		if entry.scheduled && !entry.evaluation.RetryAt.After(now) {
+			entry.scheduled = false
+			due = append(due, entry.evaluation)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].RetryAt.Before(due[j].RetryAt) })
+	return due, nil
+}
+
+// RedisStore is a Store that keeps markers in Redis, so that any server
+// sharing the Redis instance can retry an evaluation, including after the
+// server that started it stops. Scheduled retries are the members of a sorted
+// set with the retry time as the score.
+type RedisStore struct {
+	Client *redis.Client
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (*Evaluation, error) {
+	reply, err := s.Client.Do(ctx, "GET", redisMarkerPrefix+key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get incomplete evaluation %s", key)
+	}
+
+	str, ok := reply.(string)
+	if !ok {
+		return nil, nil
+	}
+
+	var e Evaluation
+	if err := json.Unmarshal([]byte(str), &e); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal incomplete evaluation %s", key)
+	}
+	return &e, nil
+}
+
+func (s *RedisStore) Mark(ctx context.Context, e Evaluation) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal incomplete evaluation")
+	}
+
+	key := e.Key()
+	ttl := int64(MarkerTTL / time.Millisecond)
+	if _, err := s.Client.Do(ctx, "SET", redisMarkerPrefix+key, b, "PX", ttl); err != nil {
+		return errors.Wrapf(err, "failed to mark incomplete evaluation %s", key)
+	}
+	if _, err := s.Client.Do(ctx, "ZADD", redisScheduleKey, unixMillis(e.RetryAt), key); err != nil {
+		return errors.Wrapf(err, "failed to schedule incomplete evaluation %s", key)
+	}
+	return nil
+}
+
+func (s *RedisStore) Clear(ctx context.Context, key string) error {
+	if _, err := s.Client.Do(ctx, "DEL", redisMarkerPrefix+key); err != nil {
+		return errors.Wrapf(err, "failed to clear incomplete evaluation %s", key)
+	}
+	if _, err := s.Client.Do(ctx, "ZREM", redisScheduleKey, key); err != nil {
+		return errors.Wrapf(err, "failed to unschedule incomplete evaluation %s", key)
+	}
+	return nil
+}
+
+func (s *RedisStore) Due(ctx context.Context, now time.Time) ([]Evaluation, error) {
+	reply, err := s.Client.Do(ctx, "ZRANGEBYSCORE", redisScheduleKey, "-inf", unixMillis(now))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list scheduled evaluations")
+	}
+	members, _ := reply.([]interface{})
+
+	var due []Evaluation
+	for _, m := range members {
+		key, ok := m.(string)
+		if !ok {
+			continue
+		}
+
+		// removing the member claims the retry: if another server removed it
+		// first, that server retries the evaluation
+		removed, err := s.Client.Do(ctx, "ZREM", redisScheduleKey, key)
+		if err != nil {
+			return due, errors.Wrapf(err, "failed to claim incomplete evaluation %s", key)
+		}
+		if n, _ := removed.(int64); n == 0 {
+			continue
+		}
+
+		e, err := s.Get(ctx, key)
+		if err != nil {
+			return due, err
+		}
+		if e != nil {
+			due = append(due, *e)
+		}
+	}
+	return due, nil
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lock provides mutual exclusion for pull request evaluations, either
+// within a single server or across all servers sharing a Redis instance. Redis
+// is the only supported shared backend.
+package lock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/redis"
+)
+
+const (
+	DefaultTTL         = 2 * time.Minute
+	DefaultWaitTimeout = 1 * time.Minute
+)
+
+type Config struct {
+	// TTL is the maximum time a lock is held if the holder never releases it,
+	// for example because the process crashed. Redis locks are renewed while
+	// they are held.
+	TTL time.Duration `yaml:"ttl"`
+
+	// WaitTimeout is the maximum time to wait when acquiring a lock.
+	WaitTimeout time.Duration `yaml:"wait_timeout"`
+}
+
+// Locker acquires exclusive locks on named keys.
+type Locker interface {
+	// Lock blocks until the lock for key is acquired, the context is
+	// canceled, or the wait timeout expires. On success, it returns a function
+	// that releases the lock.
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+// New returns a Locker for the given configuration. If client is non-nil,
+// locks are coordinated through Redis. Otherwise, locks only apply within a
+// single process.
+func New(c Config, client *redis.Client) Locker {
+	if c.TTL == 0 {
+		c.TTL = DefaultTTL
+	}
+	if c.WaitTimeout == 0 {
+		c.WaitTimeout = DefaultWaitTimeout
+	}
+
+	if client != nil {
+		return &RedisLocker{
+			Client:      client,
+			TTL:         c.TTL,
+			WaitTimeout: c.WaitTimeout,
+		}
+	}
+	return NewLocalLocker(c.WaitTimeout)
+}
+
+// PullRequestKey returns the lock key for a pull request.
+func PullRequestKey(owner, repo string, number int) string {
+	return fmt.Sprintf("%s/%s#%d", owner, repo, number)
+}
+
+// LocalLocker is a Locker that only provides exclusion within one process.
+type LocalLocker struct {
+	waitTimeout time.Duration
+
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+func NewLocalLocker(waitTimeout time.Duration) *LocalLocker {
+	return &LocalLocker{
+		waitTimeout: waitTimeout,
+		locks:       make(map[string]chan struct{}),
+	}
+}
+
+func (l *LocalLocker) Lock(ctx context.Context, key string) (func(), error) {
+	ctx, cancel := context.WithTimeout(ctx, l.waitTimeout)
+	defer cancel()
+
+	for {
+		l.mu.Lock()
+		held, ok := l.locks[key]
+		if !ok {
+			done := make(chan struct{})
+			l.locks[key] = done
+			l.mu.Unlock()
+
+			var once sync.Once
+			return func() {
+				once.Do(func() {
+					l.mu.Lock()
+					delete(l.locks, key)
+					l.mu.Unlock()
+					close(done)
+				})
+			}, nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return nil, waitError(key, ctx.Err())
+		}
+	}
+}
+
+func waitError(key string, err error) error {
+	return errors.Wrapf(err, "failed to acquire lock for %s", key)
+}
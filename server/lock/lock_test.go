@@ -0,0 +1,54 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalLocker(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocalLocker(100 * time.Millisecond)
+
+	unlock, err := l.Lock(ctx, "org/repo#1")
+	require.NoError(t, err)
+
+	_, err = l.Lock(ctx, "org/repo#1")
+	assert.Error(t, err, "lock was acquired while held")
+
+	other, err := l.Lock(ctx, "org/repo#2")
+	require.NoError(t, err, "lock for a different key was not acquired")
+	other()
+
+	acquired := make(chan error)
+	go func() {
+		unlock, err := l.Lock(ctx, "org/repo#1")
+		if err == nil {
+			unlock()
+		}
+		acquired <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	unlock()
+	unlock() // unlocking again has no effect
+
+	assert.NoError(t, <-acquired, "waiting lock was not acquired after release")
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/server/redis"
+)
+
+const (
+	redisKeyPrefix = "policy-bot:lock:"
+
+	minRetryDelay = 50 * time.Millisecond
+	maxRetryDelay = 1 * time.Second
+)
+
+// releaseScript deletes the lock only if it is still held by the caller, so
+// an expired lock that was acquired by another replica is never released.
+const releaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+// renewScript resets the expiration of the lock only if it is still held by
+// the caller.
+const renewScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+
+// RedisLocker is a Locker that provides exclusion across all processes that
+// share a Redis server.
+type RedisLocker struct {
+	Client      *redis.Client
+	TTL         time.Duration
+	WaitTimeout time.Duration
+}
+
+func (l *RedisLocker) Lock(ctx context.Context, key string) (func(), error) {
+	logger := zerolog.Ctx(ctx)
+
+	waitCtx, cancel := context.WithTimeout(ctx, l.WaitTimeout)
+	defer cancel()
+
+	rkey := redisKeyPrefix + key
+	token := xid.New().String()
+	ttl := int64(l.TTL / time.Millisecond)
+
+	delay := minRetryDelay
+	for {
+		reply, err := l.Client.Do(waitCtx, "SET", rkey, token, "NX", "PX", ttl)
+		if err != nil {
+			return nil, waitError(key, err)
+		}
+		if reply != nil {
+			break
+		}
+
+		logger.Debug().Msgf("Lock for %s is held by another process, waiting %s", key, delay)
+		select {
+		case <-time.After(delay):
+		case <-waitCtx.Done():
+			return nil, waitError(key, waitCtx.Err())
+		}
+
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.renew(ctx, key, rkey, token, stop)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+
+		// use a fresh context so locks are released even if the request ended
+		releaseCtx, cancel := context.WithTimeout(context.Background(), redis.DefaultDialTimeout)
+		defer cancel()
+
+		if _, err := l.Client.Do(releaseCtx, "EVAL", releaseScript, 1, rkey, token); err != nil {
+			logger.Warn().Err(err).Msgf("Failed to release lock for %s; it will expire after %s", key, l.TTL)
+		}
+	}, nil
+}
+
+// renew extends the expiration of a held lock every third of the TTL until
+// stop is closed, so that evaluations that take longer than the TTL keep
+// the lock. The TTL still limits how long the lock is held if the process
+// stops without releasing it.
+func (l *RedisLocker) renew(ctx context.Context, key, rkey, token string, stop <-chan struct{}) {
+	logger := zerolog.Ctx(ctx)
+
+	ttl := int64(l.TTL / time.Millisecond)
+	ticker := time.NewTicker(l.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		renewCtx, cancel := context.WithTimeout(context.Background(), redis.DefaultDialTimeout)
+		reply, err := l.Client.Do(renewCtx, "EVAL", renewScript, 1, rkey, token, ttl)
+		cancel()
+
+		switch {
+		case err != nil:
+			logger.Warn().Err(err).Msgf("Failed to renew lock for %s", key)
+		case reply == int64(0):
+			logger.Error().Msgf("Lock for %s expired before it was renewed and may be held by another process", key)
+			return
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/server/redis/redistest"
+)
+
+func newLockServer(t *testing.T) *redistest.Server {
+	srv, err := redistest.NewServer()
+	require.NoError(t, err)
+
+	// emulate the scripts with the same commands the Lua scripts call
+	srv.AddScript(releaseScript, func(call redistest.Call, keys, args []string) interface{} {
+		if call("GET", keys[0]) == args[0] {
+			return call("DEL", keys[0])
+		}
+		return int64(0)
+	})
+	srv.AddScript(renewScript, func(call redistest.Call, keys, args []string) interface{} {
+		if call("GET", keys[0]) == args[0] {
+			return call("PEXPIRE", keys[0], args[1])
+		}
+		return int64(0)
+	})
+	return srv
+}
+
+func TestRedisLocker(t *testing.T) {
+	ctx := context.Background()
+	key := "org/repo#1"
+	rkey := redisKeyPrefix + key
+
+	t.Run("contention", func(t *testing.T) {
+		srv := newLockServer(t)
+		defer srv.Close()
+
+		l1 := &RedisLocker{Client: srv.Client(), TTL: time.Minute, WaitTimeout: time.Second}
+		l2 := &RedisLocker{Client: srv.Client(), TTL: time.Minute, WaitTimeout: 100 * time.Millisecond}
+
+		unlock, err := l1.Lock(ctx, key)
+		require.NoError(t, err)
+
+		_, err = l2.Lock(ctx, key)
+		assert.Error(t, err, "lock was acquired while held by another locker")
+
+		acquired := make(chan error)
+		go func() {
+			unlock, err := l1.Lock(ctx, key)
+			if err == nil {
+				unlock()
+			}
+			acquired <- err
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		unlock()
+
+		assert.NoError(t, <-acquired, "waiting lock was not acquired after release")
+		assert.Nil(t, srv.Do("GET", rkey), "lock was not released")
+	})
+
+	t.Run("renewal", func(t *testing.T) {
+		srv := newLockServer(t)
+		defer srv.Close()
+
+		l := &RedisLocker{Client: srv.Client(), TTL: 150 * time.Millisecond, WaitTimeout: 50 * time.Millisecond}
+
+		unlock, err := l.Lock(ctx, key)
+		require.NoError(t, err)
+
+		// hold the lock for several TTLs
+		time.Sleep(500 * time.Millisecond)
+
+		assert.NotNil(t, srv.Do("GET", rkey), "lock expired while held")
+		assert.True(t, srv.Calls("PEXPIRE") >= 2, "lock was not renewed")
+
+		_, err = l.Lock(ctx, key)
+		assert.Error(t, err, "renewed lock was acquired while held")
+
+		unlock()
+		renewals := srv.Calls("PEXPIRE")
+		time.Sleep(200 * time.Millisecond)
+		assert.Equal(t, renewals, srv.Calls("PEXPIRE"), "lock was renewed after release")
+		assert.Nil(t, srv.Do("GET", rkey), "lock was not released")
+	})
+
+	t.Run("releaseHeldByOther", func(t *testing.T) {
+		srv := newLockServer(t)
+		defer srv.Close()
+
+		l := &RedisLocker{Client: srv.Client(), TTL: time.Minute, WaitTimeout: time.Second}
+
+		unlock, err := l.Lock(ctx, key)
+		require.NoError(t, err)
+
+		// simulate the lock expiring and another process acquiring it
+		srv.Do("SET", rkey, "other-token")
+
+		unlock()
+		assert.Equal(t, "other-token", srv.Do("GET", rkey), "lock held by another process was released")
+	})
+}
@@ -0,0 +1,181 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/redis"
+)
+
+const (
+	redisSequencePrefix = "policy-bot:sequence:"
+	redisFinishedPrefix = "policy-bot:finished:"
+
+	// SequenceTTL is how long sequence numbers are kept in Redis after the
+	// last event for a key
+	SequenceTTL = 24 * time.Hour
+)
+
+// Sequencer orders work on a key, like the evaluations of a pull request, by
+// the time the work was requested. While holding the lock for the key, a
+// caller uses the sequence number assigned when the work was requested to
+// check if work requested later already finished. If so, the result of the
+// work would be older than the result that is already visible and the caller
+// can skip it.
+type Sequencer interface {
+	// Next returns a sequence number for key that is greater than all
+	// previous sequence numbers for the key.
+	Next(ctx context.Context, key string) (int64, error)
+
+	// Superseded returns true if work with a greater sequence number finished.
+	Superseded(ctx context.Context, key string, seq int64) (bool, error)
+
+	// Finish must be called once for each sequence number returned by Next.
+	// If completed is false, the work failed or was skipped and does not
+	// supersede work with smaller sequence numbers.
+	Finish(ctx context.Context, key string, seq int64, completed bool) error
+}
+
+// NewSequencer returns a Sequencer that uses Redis if client is non-nil.
+// Otherwise, sequence numbers only apply within a single process.
+func NewSequencer(client *redis.Client) Sequencer {
+	if client != nil {
+		return &RedisSequencer{Client: client}
+	}
+	return NewLocalSequencer()
+}
+
+// LocalSequencer is a Sequencer for a single process.
+type LocalSequencer struct {
+	mu       sync.Mutex
+	next     map[string]int64
+	finished map[string]int64
+	pending  map[string]int
+}
+
+func NewLocalSequencer() *LocalSequencer {
+	return &LocalSequencer{
+		next:     make(map[string]int64),
+		finished: make(map[string]int64),
+		pending:  make(map[string]int),
+	}
+}
+
+func (s *LocalSequencer) Next(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next[key]++
+	s.pending[key]++
+	return s.next[key], nil
+}
+
+func (s *LocalSequencer) Superseded(ctx context.Context, key string, seq int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.finished[key] > seq, nil
+}
+
+func (s *LocalSequencer) Finish(ctx context.Context, key string, seq int64, completed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if completed && seq > s.finished[key] {
+		s.finished[key] = seq
+	}
+
+	// forget keys without pending work so the maps do not grow forever; new
+	// work starts over at a sequence number that is never superseded
+	if s.pending[key]--; s.pending[key] <= 0 {
+		delete(s.next, key)
+		delete(s.finished, key)
+		delete(s.pending, key)
+	}
+	return nil
+}
+
+// RedisSequencer is a Sequencer for all processes that share a Redis server.
+// Callers must hold the lock for a key when calling Superseded or Finish.
+type RedisSequencer struct {
+	Client *redis.Client
+}
+
+func (s *RedisSequencer) Next(ctx context.Context, key string) (int64, error) {
+	rkey := redisSequencePrefix + key
+
+	reply, err := s.Client.Do(ctx, "INCR", rkey)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get sequence number for %s", key)
+	}
+	if _, err := s.Client.Do(ctx, "PEXPIRE", rkey, int64(SequenceTTL/time.Millisecond)); err != nil {
+		return 0, errors.Wrapf(err, "failed to set expiration of sequence number for %s", key)
+	}
+
+	seq, ok := reply.(int64)
+	if !ok {
+		return 0, errors.Errorf("unexpected sequence number reply for %s: %v", key, reply)
+	}
+	return seq, nil
+}
+
+func (s *RedisSequencer) Superseded(ctx context.Context, key string, seq int64) (bool, error) {
+	finished, err := s.finished(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return finished > seq, nil
+}
+
+func (s *RedisSequencer) Finish(ctx context.Context, key string, seq int64, completed bool) error {
+	if !completed {
+		return nil
+	}
+
+	finished, err := s.finished(ctx, key)
+	if err != nil {
+		return err
+	}
+	if seq <= finished {
+		return nil
+	}
+
+	if _, err := s.Client.Do(ctx, "SET", redisFinishedPrefix+key, seq, "PX", int64(SequenceTTL/time.Millisecond)); err != nil {
+		return errors.Wrapf(err, "failed to record finished sequence number for %s", key)
+	}
+	return nil
+}
+
+func (s *RedisSequencer) finished(ctx context.Context, key string) (int64, error) {
+	reply, err := s.Client.Do(ctx, "GET", redisFinishedPrefix+key)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get finished sequence number for %s", key)
+	}
+
+	switch v := reply.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		seq, err := strconv.ParseInt(v, 10, 64)
+		return seq, errors.Wrapf(err, "invalid finished sequence number for %s", key)
+	}
+	return 0, errors.Errorf("unexpected finished sequence number reply for %s: %v", key, reply)
+}
@@ -0,0 +1,207 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package membership resolves membership in groups managed by external
+// directories, so that approval rules can reference directory groups
+// alongside GitHub teams.
+package membership
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultCacheTTL      = 10 * time.Minute
+	DefaultTimeout       = 10 * time.Second
+	DefaultMaxCacheUsers = 10000
+)
+
+type Config struct {
+	// Providers are the directories that can be referenced by approval
+	// rules. A group is referenced as "provider-name/group-name".
+	Providers []ProviderConfig `yaml:"providers"`
+
+	// CacheTTL is how long the groups of a user are cached
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	// Timeout is the maximum time for each request to a directory
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// ProviderConfig configures one provider. Exactly one of the provider
+// blocks must be set.
+type ProviderConfig struct {
+	Name string `yaml:"name"`
+
+	SCIM *SCIMConfig `yaml:"scim"`
+	Okta *OktaConfig `yaml:"okta"`
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c Config) Validate() error {
+	names := make(map[string]bool)
+	for _, pc := range c.Providers {
+		if pc.Name == "" || strings.Contains(pc.Name, "/") {
+			return errors.Errorf("invalid group provider name %q", pc.Name)
+		}
+		if names[pc.Name] {
+			return errors.Errorf("duplicate group provider name %q", pc.Name)
+		}
+		names[pc.Name] = true
+
+		if _, err := newProvider(pc, http.DefaultClient); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newProvider(c ProviderConfig, client *http.Client) (Provider, error) {
+	switch {
+	case c.SCIM != nil && c.Okta != nil:
+		return nil, errors.Errorf("group provider %q configures more than one directory", c.Name)
+	case c.SCIM != nil:
+		return NewSCIMProvider(*c.SCIM, client)
+	case c.Okta != nil:
+		return NewOktaProvider(*c.Okta, client)
+	}
+	return nil, errors.Errorf("group provider %q does not configure a directory", c.Name)
+}
+
+// Provider lists the groups of users in a directory.
+type Provider interface {
+	// Groups returns the names of the groups that the user with the given
+	// GitHub login belongs to. It returns no groups if the directory has no
+	// user with the login.
+	Groups(ctx context.Context, login string) ([]string, error)
+}
+
+// Providers checks group membership using named providers and caches the
+// groups of each user.
+type Providers struct {
+	providers map[string]Provider
+	ttl       time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedGroups
+}
+
+type cachedGroups struct {
+	groups  []string
+	expires time.Time
+}
+
+// New returns the Providers for the configuration, or nil if no providers
+// are configured.
+func New(c Config) (*Providers, error) {
+	if len(c.Providers) == 0 {
+		return nil, nil
+	}
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = DefaultCacheTTL
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+
+	client := &http.Client{Timeout: c.Timeout}
+	providers := make(map[string]Provider)
+	for _, pc := range c.Providers {
+		p, err := newProvider(pc, client)
+		if err != nil {
+			return nil, err
+		}
+		providers[pc.Name] = p
+	}
+
+	return &Providers{
+		providers: providers,
+		ttl:       c.CacheTTL,
+		cache:     make(map[string]cachedGroups),
+	}, nil
+}
+
+// IsMember returns true if the user with the given GitHub login is a member
+// of the group. Groups are specified as "provider-name/group-name" and group
+// names are not case-sensitive.
+func (p *Providers) IsMember(ctx context.Context, group, login string) (bool, error) {
+	parts := strings.SplitN(group, "/", 2)
+	if len(parts) != 2 {
+		return false, errors.Errorf("invalid group %q: groups must be specified as provider-name/group-name", group)
+	}
+
+	provider, ok := p.providers[parts[0]]
+	if !ok {
+		return false, errors.Errorf("unknown group provider %q", parts[0])
+	}
+
+	groups, err := p.groups(ctx, parts[0], provider, login)
+	if err != nil {
+		return false, err
+	}
+	for _, g := range groups {
+		if strings.EqualFold(g, parts[1]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *Providers) groups(ctx context.Context, name string, provider Provider, login string) ([]string, error) {
+	key := name + "/" + strings.ToLower(login)
+	now := time.Now()
+
+	p.mu.Lock()
+	cached, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.groups, nil
+	}
+
+	groups, err := provider.Groups(ctx, login)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get groups from %s", name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.cache) >= DefaultMaxCacheUsers {
+		for k, c := range p.cache {
+			if now.After(c.expires) {
+				delete(p.cache, k)
+			}
+		}
+		if len(p.cache) >= DefaultMaxCacheUsers {
+			p.cache = make(map[string]cachedGroups)
+		}
+	}
+	p.cache[key] = cachedGroups{groups: groups, expires: now.Add(p.ttl)}
+	return groups, nil
+}
+
+func checkResponse(res *http.Response, name string) error {
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return errors.Errorf("%s returned status %d: %s", name, res.StatusCode, strings.TrimSpace(string(msg)))
+}
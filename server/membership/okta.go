@@ -0,0 +1,284 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package membership
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/rs/xid"
+)
+
+const (
+	DefaultOktaScopes = "okta.users.read okta.groups.read"
+)
+
+type OktaConfig struct {
+	// URL is the URL of the Okta organization, like
+	// "https://example.okta.com"
+	URL string `yaml:"url"`
+
+	// Token is an API token. Set either Token or OAuth.
+	Token string `yaml:"token"`
+
+	// OAuth authenticates as an API service application
+	OAuth *OktaOAuthConfig `yaml:"oauth"`
+
+	// LoginAttribute is the user profile attribute that contains the GitHub
+	// login of each user, like "githubUsername"
+	LoginAttribute string `yaml:"login_attribute"`
+}
+
+type OktaOAuthConfig struct {
+	ClientID string `yaml:"client_id"`
+
+	// PrivateKeyFile is the path to the PEM-encoded RSA key registered with
+	// the application
+	PrivateKeyFile string `yaml:"private_key_file"`
+
+	// KeyID is the ID of the key, if the application has several keys
+	KeyID string `yaml:"key_id"`
+
+	// Scopes are the requested scopes. The default is "okta.users.read
+	// okta.groups.read".
+	Scopes string `yaml:"scopes"`
+}
+
+// OktaProvider lists the groups of users in Okta. Users are found by
+// searching for the login attribute in their profiles. Suspended and
+// deprovisioned users belong to no groups.
+type OktaProvider struct {
+	config OktaConfig
+	client *http.Client
+	tokens *oktaTokenSource
+}
+
+func NewOktaProvider(c OktaConfig, client *http.Client) (*OktaProvider, error) {
+	if c.URL == "" {
+		return nil, errors.New("okta group provider must have a URL")
+	}
+	if c.LoginAttribute == "" {
+		return nil, errors.New("okta group provider must have a login attribute")
+	}
+	if (c.Token == "") == (c.OAuth == nil) {
+		return nil, errors.New("okta group provider must have exactly one of a token or OAuth credentials")
+	}
+	c.URL = strings.TrimSuffix(c.URL, "/")
+
+	p := &OktaProvider{config: c, client: client}
+	if c.OAuth != nil {
+		tokens, err := newOktaTokenSource(c.URL, *c.OAuth, client)
+		if err != nil {
+			return nil, err
+		}
+		p.tokens = tokens
+	}
+	return p, nil
+}
+
+type oktaUser struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+type oktaGroup struct {
+	Profile struct {
+		Name string `json:"name"`
+	} `json:"profile"`
+}
+
+func (p *OktaProvider) Groups(ctx context.Context, login string) ([]string, error) {
+	q := url.Values{}
+	q.Set("search", fmt.Sprintf("profile.%s eq %q", p.config.LoginAttribute, login))
+
+	var users []oktaUser
+	if _, err := p.get(ctx, p.config.URL+"/api/v1/users?"+q.Encode(), &users); err != nil {
+		return nil, errors.Wrap(err, "failed to find okta user")
+	}
+
+	var groups []string
+	for _, u := range users {
+		if u.Status == "SUSPENDED" || u.Status == "DEPROVISIONED" {
+			continue
+		}
+
+		next := fmt.Sprintf("%s/api/v1/users/%s/groups?limit=200", p.config.URL, url.PathEscape(u.ID))
+		for next != "" {
+			var page []oktaGroup
+			var err error
+			if next, err = p.get(ctx, next, &page); err != nil {
+				return nil, errors.Wrap(err, "failed to list okta groups")
+			}
+			for _, g := range page {
+				groups = append(groups, g.Profile.Name)
+			}
+		}
+	}
+	return groups, nil
+}
+
+var oktaNextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// get decodes the response for a URL into out and returns the URL of the
+// next page, if any.
+func (p *OktaProvider) get(ctx context.Context, u string, out interface{}) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	if p.tokens != nil {
+		token, err := p.tokens.Token(ctx)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.Header.Set("Authorization", "SSWS "+p.config.Token)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "okta request failed")
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res, "okta"); err != nil {
+		return "", err
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return "", errors.Wrap(err, "failed to parse okta response")
+	}
+
+	for _, link := range res.Header["Link"] {
+		if m := oktaNextLink.FindStringSubmatch(link); m != nil {
+			return m[1], nil
+		}
+	}
+	return "", nil
+}
+
+// oktaTokenSource gets access tokens for an API service application using
+// the client credentials flow with a private key JWT.
+type oktaTokenSource struct {
+	client   *http.Client
+	config   OktaOAuthConfig
+	key      interface{}
+	tokenURL string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newOktaTokenSource(orgURL string, c OktaOAuthConfig, client *http.Client) (*oktaTokenSource, error) {
+	if c.ClientID == "" || c.PrivateKeyFile == "" {
+		return nil, errors.New("okta OAuth credentials must have a client ID and private key file")
+	}
+	if c.Scopes == "" {
+		c.Scopes = DefaultOktaScopes
+	}
+
+	b, err := ioutil.ReadFile(c.PrivateKeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read okta private key")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse okta private key")
+	}
+
+	return &oktaTokenSource{
+		client:   client,
+		config:   c,
+		key:      key,
+		tokenURL: orgURL + "/oauth2/v1/token",
+	}, nil
+}
+
+// Token returns a cached access token, getting a new one if it is close to
+// expiring.
+func (s *oktaTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Until(s.expires) > time.Minute {
+		return s.token, nil
+	}
+
+	now := time.Now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": s.config.ClientID,
+		"sub": s.config.ClientID,
+		"aud": s.tokenURL,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"jti": xid.New().String(),
+	})
+	if s.config.KeyID != "" {
+		assertion.Header["kid"] = s.config.KeyID
+	}
+	signed, err := assertion.SignedString(s.key)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign okta client assertion")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("scope", s.config.Scopes)
+	form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+	form.Set("client_assertion", signed)
+
+	req, err := http.NewRequest(http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create okta token request")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get okta access token")
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res, "okta token endpoint"); err != nil {
+		return "", err
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", errors.Wrap(err, "failed to parse okta access token")
+	}
+
+	s.token = token.AccessToken
+	s.expires = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	return s.token, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package membership
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultSCIMLoginAttribute = "userName"
+)
+
+type SCIMConfig struct {
+	// URL is the base URL of the SCIM 2.0 API, like
+	// "https://directory.example.com/scim/v2"
+	URL string `yaml:"url"`
+
+	// Token is the bearer token for requests
+	Token string `yaml:"token"`
+
+	// LoginAttribute is the user attribute that contains the GitHub login of
+	// each user. The default is "userName".
+	LoginAttribute string `yaml:"login_attribute"`
+}
+
+// SCIMProvider lists the groups of users in a directory that implements the
+// SCIM 2.0 protocol, such as a corporate LDAP directory exposed with a SCIM
+// gateway. Users are found by filtering on the login attribute and their
+// groups are read from the standard "groups" attribute.
+type SCIMProvider struct {
+	config SCIMConfig
+	client *http.Client
+}
+
+func NewSCIMProvider(c SCIMConfig, client *http.Client) (*SCIMProvider, error) {
+	if c.URL == "" {
+		return nil, errors.New("scim group provider must have a URL")
+	}
+	if c.LoginAttribute == "" {
+		c.LoginAttribute = DefaultSCIMLoginAttribute
+	}
+	c.URL = strings.TrimSuffix(c.URL, "/")
+	return &SCIMProvider{config: c, client: client}, nil
+}
+
+type scimListResponse struct {
+	Resources []struct {
+		Groups []struct {
+			Display string `json:"display"`
+		} `json:"groups"`
+	} `json:"Resources"`
+}
+
+func (p *SCIMProvider) Groups(ctx context.Context, login string) ([]string, error) {
+	q := url.Values{}
+	q.Set("filter", fmt.Sprintf("%s eq %q", p.config.LoginAttribute, login))
+	q.Set("attributes", "groups")
+
+	req, err := http.NewRequest(http.MethodGet, p.config.URL+"/Users?"+q.Encode(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/scim+json")
+	if p.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.config.Token)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "scim request failed")
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res, "scim server"); err != nil {
+		return nil, err
+	}
+
+	var list scimListResponse
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		return nil, errors.Wrap(err, "failed to parse scim response")
+	}
+
+	var groups []string
+	for _, r := range list.Resources {
+		for _, g := range r.Groups {
+			groups = append(groups, g.Display)
+		}
+	}
+	return groups, nil
+}
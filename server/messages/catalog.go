@@ -0,0 +1,178 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messages
+
+import (
+	"github.com/palantir/policy-bot/policy/common"
+)
+
+// IDs of the messages formatted by handlers. Messages used only by page
+// templates are referenced by their IDs in the templates.
+const (
+	StatusForcePush          = "status.force_push"
+	StatusTimeout            = "status.timeout"
+	StatusNoPolicy           = "status.no_policy"
+	StatusInvalidConfig      = "status.invalid_config"
+	StatusValidPolicy        = "status.valid_policy"
+	StatusInvalidPolicy      = "status.invalid_policy"
+	StatusTooLarge           = "status.too_large"
+	StatusEvaluationError    = "status.evaluation_error"
+	StatusSkipped            = "status.skipped"
+	StatusRuleProgress       = "status.rule_progress"
+	StatusIncomplete         = "status.incomplete"
+	StatusUnavailable        = "status.unavailable"
+	StatusEditedComment      = "status.edited_comment"
+	StatusOverwritten        = "status.overwritten"
+	StatusMergeGroupUnknown  = "status.merge_group_unknown"
+	StatusMergeGroupNoPolicy = "status.merge_group_no_policy"
+	StatusUpstreamPending    = "status.upstream_pending"
+	StatusIncompleteError    = "status.incomplete_error"
+
+	StatusApproverOrganization = "status.approver.organization"
+	StatusApproverAdmins       = "status.approver.admins"
+	StatusApproverWriters      = "status.approver.writers"
+
+	SummaryTitleSuccess    = "summary.title.success"
+	SummaryTitleFailure    = "summary.title.failure"
+	SummaryTitlePending    = "summary.title.pending"
+	SummaryTitleError      = "summary.title.error"
+	SummaryColumnRule      = "summary.column.rule"
+	SummaryColumnStatus    = "summary.column.status"
+	SummaryColumnDetails   = "summary.column.details"
+	SummaryColumnApprovers = "summary.column.approvers"
+	SummaryViewDetails     = "summary.view_details"
+
+	SummaryApproverUser         = "summary.approver.user"
+	SummaryApproverTeam         = "summary.approver.team"
+	SummaryApproverOrganization = "summary.approver.organization"
+	SummaryApproverGroup        = "summary.approver.group"
+	SummaryApproverApp          = "summary.approver.app"
+	SummaryApproverAdmins       = "summary.approver.admins"
+	SummaryApproverWriters      = "summary.approver.writers"
+
+	CheckRunReevaluate            = "check_run.reevaluate"
+	CheckRunReevaluateDescription = "check_run.reevaluate_description"
+
+	CommandHelp        = "command.help"
+	CommandEvaluated   = "command.evaluated"
+	CommandUnknownRule = "command.unknown_rule"
+)
+
+// defaults are the English messages. Every message ID must have a default.
+var defaults = map[string]string{
+	StatusForcePush:          "Re-evaluating after a force-push",
+	StatusTimeout:            "Evaluation timed out, retrying",
+	StatusNoPolicy:           "No policy found at ref={{.Ref}}",
+	StatusInvalidConfig:      "Invalid configuration defined by ref={{.Ref}}",
+	StatusValidPolicy:        "Valid policy found for ref={{.Ref}}",
+	StatusInvalidPolicy:      "Invalid policy defined by {{.Config}}",
+	StatusTooLarge:           "Pull request is too large to evaluate: {{.Error}}",
+	StatusEvaluationError:    "Error evaluating policy defined by {{.Config}}",
+	StatusSkipped:            "All rules were skipped. At least one rule must match.",
+	StatusRuleProgress:       "{{.Rule}}: {{.Approved}}/{{.Required}}{{if .Approvers}} from {{.Approvers}}{{end}}",
+	StatusIncomplete:         "Evaluation incomplete, retrying at {{.RetryAt}}",
+	StatusUnavailable:        "Some rules are unknown because the GitHub {{.API}} API is unavailable, retrying at {{.RetryAt}}",
+	StatusEditedComment:      "Entity {{.Editor}} edited approval comment by {{.Author}}",
+	StatusOverwritten:        "'{{.Sender}}' overwrote status to '{{.State}}'",
+	StatusMergeGroupUnknown:  "Unable to find the pull request for this merge group",
+	StatusMergeGroupNoPolicy: "No policy applies to #{{.Number}}",
+	StatusUpstreamPending:    "Waiting for approval of upstream pull request #{{.Number}}",
+	StatusIncompleteError:    "Error evaluating policy: GitHub is rate limited or unavailable",
+
+	StatusApproverOrganization: "{{.Name}} members",
+	StatusApproverAdmins:       "admins",
+	StatusApproverWriters:      "writers",
+
+	SummaryTitleSuccess:    "Policy approved",
+	SummaryTitleFailure:    "Policy disapproved",
+	SummaryTitlePending:    "Policy pending",
+	SummaryTitleError:      "Policy error",
+	SummaryColumnRule:      "Rule",
+	SummaryColumnStatus:    "Status",
+	SummaryColumnDetails:   "Details",
+	SummaryColumnApprovers: "Who can approve",
+	SummaryViewDetails:     "View details",
+
+	SummaryApproverUser:         "`{{.Name}}`",
+	SummaryApproverTeam:         "team `{{.Name}}`",
+	SummaryApproverOrganization: "members of `{{.Name}}`",
+	SummaryApproverGroup:        "group `{{.Name}}`",
+	SummaryApproverApp:          "app `{{.Name}}`",
+	SummaryApproverAdmins:       "repository admins",
+	SummaryApproverWriters:      "users with write access",
+
+	CheckRunReevaluate:            "Re-evaluate",
+	CheckRunReevaluateDescription: "Evaluate the policy again",
+
+	CommandHelp:        "Available commands:\n\n- `/policy evaluate`: evaluate the policy again\n- `/policy status`: show the status of each rule\n- `/policy explain <rule>`: explain the status of a rule\n",
+	CommandEvaluated:   "Evaluated the policy. **{{.State}}**: {{.Description}}",
+	CommandUnknownRule: "No rule named `{{.Rule}}` applies to this pull request.",
+
+	"state.success":     "Success",
+	"state.failure":     "Failure",
+	"state.pending":     "Pending",
+	"state.error":       "Error",
+	"state.approved":    "Approved",
+	"state.disapproved": "Disapproved",
+	"state.skipped":     "Skipped",
+
+	"details.title":             "Details",
+	"details.view_policy":       "View the policy definition on GitHub",
+	"details.view_pull_request": "View the pull request on GitHub",
+	"details.error":             "Error",
+	"details.status":            "Status: {{.State}}",
+	"details.download_json":     "Download JSON",
+	"details.timeline":          "Timeline",
+	"details.trigger":           "after {{.Event}}{{if .Sender}} by {{.Sender}}{{end}}",
+	"details.background":        "background evaluation",
+	"details.commit":            "at {{.SHA}}",
+	"details.no_changes":        "No changes",
+
+	"simulation.title":     "What if…",
+	"simulation.approvers": "Assume these users approve the pull request",
+	"simulation.files":     "Assume these files are not changed",
+	"simulation.policy":    "Evaluate this policy instead of the policy of the pull request",
+	"simulation.run":       "Simulate",
+	"simulation.reset":     "Reset",
+	"simulation.banner":    "Simulated result for hypothetical changes. Nothing was posted to GitHub.",
+
+	"playground.title":        "Policy playground",
+	"playground.intro":        "Evaluate a policy against a pull request without posting a status.",
+	"playground.policy":       "Policy",
+	"playground.pull_request": "Pull request, like owner/repo#123 or a pull request URL",
+	"playground.synthetic":    "Or describe a synthetic pull request in YAML",
+	"playground.run":          "Evaluate",
+
+	"evaluation.title":        "Evaluation {{.ID}}",
+	"evaluation.view_current": "View the current details",
+	"evaluation.evaluated":    "Evaluated {{.Time}} at commit {{.SHA}}{{if .Event}} after {{.Event}}{{if .Sender}} by {{.Sender}}{{end}}{{end}}.",
+
+	"dashboard.title":        "Dashboard",
+	"dashboard.sort":         "Sort:",
+	"dashboard.oldest_first": "oldest first",
+	"dashboard.newest_first": "newest first",
+	"dashboard.heading":      "Pull requests blocked by policy in {{.Owner}}",
+	"dashboard.waiting_on":   "Waiting on {{.Name}} ({{.Count}})",
+	"dashboard.opened_by":    "Opened by {{.Author}} {{.Age}} ago, waiting on {{.Rules}}",
+	"dashboard.empty":        "No blocked pull requests.",
+}
+
+// the descriptions of results are defined with the policy so that they can
+// be formatted without a catalog
+func init() {
+	for id, text := range common.Messages {
+		defaults[id] = text
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package messages contains the user-facing text of policy-bot, like status
+// descriptions, bot comments, and page labels. Each message is a Go template.
+// Deployments may replace messages with catalogs for a locale and with
+// individual overrides.
+package messages
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	DefaultLocale = "en"
+)
+
+type Config struct {
+	// Locale selects the catalog used for messages, like "de" or "pt-BR". If
+	// there is no catalog for a regional locale, the catalog for its language
+	// is used instead.
+	Locale string `yaml:"locale"`
+
+	// Directory contains catalogs named "<locale>.yml", each a map from
+	// message IDs to templates. Messages missing from a catalog use the
+	// default English text.
+	Directory string `yaml:"directory"`
+
+	// Overrides replace individual messages, after applying the catalog
+	Overrides map[string]string `yaml:"overrides"`
+}
+
+// Args are the values available to a message template.
+type Args map[string]interface{}
+
+// Catalog formats messages. A nil Catalog formats the default messages.
+type Catalog struct {
+	locale    string
+	templates map[string]*template.Template
+}
+
+// New loads the catalog for the configured locale and applies overrides.
+func New(c Config) (*Catalog, error) {
+	cat := &Catalog{
+		locale:    DefaultLocale,
+		templates: make(map[string]*template.Template),
+	}
+
+	texts := make(map[string]string, len(defaults))
+	for id, text := range defaults {
+		texts[id] = text
+	}
+
+	if c.Locale != "" && c.Locale != DefaultLocale {
+		locale, catalog, err := readCatalog(c.Directory, c.Locale)
+		if err != nil {
+			return nil, err
+		}
+		if err := merge(texts, catalog, "catalog "+locale); err != nil {
+			return nil, err
+		}
+		cat.locale = locale
+	}
+	if err := merge(texts, c.Overrides, "overrides"); err != nil {
+		return nil, err
+	}
+
+	for id, text := range texts {
+		tmpl, err := template.New(id).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid template for message %q", id)
+		}
+		cat.templates[id] = tmpl
+	}
+	return cat, nil
+}
+
+// readCatalog reads the catalog for a locale, falling back to the catalog for
+// the language of the locale. It returns the locale of the catalog it read.
+func readCatalog(dir, locale string) (string, map[string]string, error) {
+	if dir == "" {
+		return "", nil, errors.Errorf("a messages directory is required for locale %q", locale)
+	}
+
+	candidates := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+
+	for _, l := range candidates {
+		path := filepath.Join(dir, l+".yml")
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "failed to read message catalog %s", path)
+		}
+
+		var catalog map[string]string
+		if err := yaml.UnmarshalStrict(b, &catalog); err != nil {
+			return "", nil, errors.Wrapf(err, "failed to parse message catalog %s", path)
+		}
+		return l, catalog, nil
+	}
+	return "", nil, errors.Errorf("no message catalog for locale %q in %s", locale, dir)
+}
+
+func merge(texts, replacements map[string]string, source string) error {
+	for id, text := range replacements {
+		if _, ok := defaults[id]; !ok {
+			return errors.Errorf("unknown message %q in %s", id, source)
+		}
+		texts[id] = text
+	}
+	return nil
+}
+
+// Locale returns the locale of the catalog.
+func (c *Catalog) Locale() string {
+	if c == nil {
+		return DefaultLocale
+	}
+	return c.locale
+}
+
+// Format returns the message with the given ID. If the template for the
+// message fails, Format returns the default message instead.
+func (c *Catalog) Format(id string, args Args) string {
+	if c != nil {
+		if tmpl, ok := c.templates[id]; ok {
+			if s, err := execute(tmpl, args); err == nil {
+				return s
+			}
+		}
+	}
+
+	text, ok := defaults[id]
+	if !ok {
+		return id
+	}
+	tmpl, err := template.New(id).Parse(text)
+	if err != nil {
+		return id
+	}
+	if s, err := execute(tmpl, args); err == nil {
+		return s
+	}
+	return id
+}
+
+// Text returns the message with the given ID, which takes no arguments.
+func (c *Catalog) Text(id string) string {
+	return c.Format(id, nil)
+}
+
+// State returns the label for the state of a status or the status of a rule,
+// like "pending" or "approved".
+func (c *Catalog) State(state string) string {
+	id := "state." + state
+	if _, ok := defaults[id]; !ok {
+		return strings.Title(state)
+	}
+	return c.Text(id)
+}
+
+func execute(tmpl *template.Template, args Args) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, args); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultMessageTemplate = "{{.Owner}}/{{.Repo}}#{{.Number}} is {{.Event}}: {{.Description}}"
+)
+
+// Request is the body and any additional headers of a notification request.
+type Request struct {
+	Body   []byte
+	Header map[string]string
+}
+
+// Endpoint converts events into requests for a specific kind of receiver.
+type Endpoint interface {
+	Config() EndpointConfig
+	Request(e Event) (*Request, error)
+	SummaryRequest(s Summary) (*Request, error)
+}
+
+// NewEndpoint returns the Endpoint for the configuration.
+func NewEndpoint(c EndpointConfig) (Endpoint, error) {
+	switch c.Type {
+	case "", EndpointWebhook:
+		return &WebhookEndpoint{config: c}, nil
+	case EndpointTeams:
+		tmpl, err := parseTemplate(c)
+		if err != nil {
+			return nil, err
+		}
+		return &TeamsEndpoint{config: c, template: tmpl}, nil
+	}
+	return nil, errors.Errorf("unknown notification endpoint type %q", c.Type)
+}
+
+func parseTemplate(c EndpointConfig) (*template.Template, error) {
+	text := c.Template
+	if text == "" {
+		text = DefaultMessageTemplate
+	}
+	tmpl, err := template.New("message").Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid message template for %s", c.URL)
+	}
+	return tmpl, nil
+}
+
+// WebhookEndpoint sends the event as JSON, signed with the endpoint secret.
+type WebhookEndpoint struct {
+	config EndpointConfig
+}
+
+func (w *WebhookEndpoint) Config() EndpointConfig {
+	return w.config
+}
+
+func (w *WebhookEndpoint) Request(e Event) (*Request, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal notification")
+	}
+
+	return w.request(payload), nil
+}
+
+func (w *WebhookEndpoint) SummaryRequest(s Summary) (*Request, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal summary")
+	}
+	return w.request(payload), nil
+}
+
+func (w *WebhookEndpoint) request(payload []byte) *Request {
+	r := &Request{Body: payload}
+	if w.config.Secret != "" {
+		r.Header = map[string]string{HeaderSignature: Sign(w.config.Secret, payload)}
+	}
+	return r
+}
+
+// TeamsEndpoint sends a message card to a Microsoft Teams incoming webhook.
+type TeamsEndpoint struct {
+	config   EndpointConfig
+	template *template.Template
+}
+
+func (t *TeamsEndpoint) Config() EndpointConfig {
+	return t.config
+}
+
+type teamsMessageCard struct {
+	Type            string        `json:"@type"`
+	Context         string        `json:"@context"`
+	Summary         string        `json:"summary"`
+	ThemeColor      string        `json:"themeColor"`
+	Title           string        `json:"title"`
+	Text            string        `json:"text"`
+	PotentialAction []teamsAction `json:"potentialAction,omitempty"`
+}
+
+type teamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []teamsTarget `json:"targets"`
+}
+
+type teamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+func (t *TeamsEndpoint) Request(e Event) (*Request, error) {
+	var text bytes.Buffer
+	if err := t.template.Execute(&text, e); err != nil {
+		return nil, errors.Wrap(err, "failed to render message template")
+	}
+
+	title := fmt.Sprintf("%s/%s#%d: %s", e.Owner, e.Repo, e.Number, e.Event)
+	payload, err := json.Marshal(teamsMessageCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		Summary:    title,
+		ThemeColor: themeColor(e.Event),
+		Title:      title,
+		Text:       text.String(),
+		PotentialAction: []teamsAction{{
+			Type:    "OpenUri",
+			Name:    "View details",
+			Targets: []teamsTarget{{OS: "default", URI: e.DetailsURL}},
+		}},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal message card")
+	}
+	return &Request{Body: payload}, nil
+}
+
+// SummaryRequest sends the text of the summary as a message card. The
+// endpoint template is not used.
+func (t *TeamsEndpoint) SummaryRequest(s Summary) (*Request, error) {
+	payload, err := json.Marshal(teamsMessageCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		Summary:    s.Title,
+		ThemeColor: themeColor(s.Event),
+		Title:      s.Title,
+		Text:       s.Text,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal message card")
+	}
+	return &Request{Body: payload}, nil
+}
+
+func themeColor(event string) string {
+	switch event {
+	case EventApproved:
+		return "2cbe4e"
+	case EventBlocked:
+		return "cb2431"
+	}
+	return "dbab09"
+}
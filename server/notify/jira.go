@@ -0,0 +1,271 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultJiraKeyPattern = `\b[A-Z][A-Z0-9_]+-[1-9][0-9]*\b`
+	DefaultJiraComment    = `{{.Owner}}/{{.Repo}}#{{.Number}} was approved{{if .Approvers}} by {{join .Approvers ", "}}{{end}}. Details: {{.DetailsURL}}`
+)
+
+type JiraConfig struct {
+	// URL is the base URL of the Jira instance, like
+	// "https://example.atlassian.net"
+	URL string `yaml:"url"`
+
+	// Username and Token authenticate requests. With a username, the token
+	// is an API token used for basic authentication, as in Jira Cloud.
+	// Without a username, the token is a personal access token, as in Jira
+	// Server and Data Center.
+	Username string `yaml:"username"`
+	Token    string `yaml:"token"`
+
+	// Transition is the name of the transition, or of the status it leads
+	// to, to apply to linked issues. If empty or not available for an issue,
+	// the issue is not transitioned.
+	Transition string `yaml:"transition"`
+
+	// Comment is a Go template for the comment added to linked issues. It
+	// is executed with the event as data and may use the "join" function.
+	// Set it to "-" to disable comments.
+	Comment string `yaml:"comment"`
+
+	// KeyPattern is a regular expression that finds issue keys in the title
+	// and head branch of a pull request.
+	KeyPattern string `yaml:"key_pattern"`
+
+	// Projects limits the issues updated to those in these projects. If
+	// empty, issues in all projects are updated.
+	Projects []string `yaml:"projects"`
+
+	// Organizations limits the pull requests that update issues to those in
+	// these organizations. If empty, pull requests in all organizations
+	// update issues.
+	Organizations []string `yaml:"organizations"`
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c JiraConfig) Validate() error {
+	if c.URL == "" {
+		return errors.New("jira integration must have a URL")
+	}
+	_, _, err := c.parse()
+	return err
+}
+
+func (c JiraConfig) parse() (*regexp.Regexp, *template.Template, error) {
+	pattern := c.KeyPattern
+	if pattern == "" {
+		pattern = DefaultJiraKeyPattern
+	}
+	keys, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid jira key pattern")
+	}
+
+	if c.Comment == "-" {
+		return keys, nil, nil
+	}
+
+	text := c.Comment
+	if text == "" {
+		text = DefaultJiraComment
+	}
+	comment, err := template.New("comment").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid jira comment template")
+	}
+	return keys, comment, nil
+}
+
+// JiraHook transitions and comments on the Jira issues linked to a pull
+// request when it is approved. Issues are linked by mentioning their keys in
+// the title or head branch of the pull request.
+type JiraHook struct {
+	config  JiraConfig
+	client  *http.Client
+	keys    *regexp.Regexp
+	comment *template.Template
+}
+
+func NewJiraHook(c JiraConfig, client *http.Client) (*JiraHook, error) {
+	keys, comment, err := c.parse()
+	if err != nil {
+		return nil, err
+	}
+	c.URL = strings.TrimSuffix(c.URL, "/")
+	return &JiraHook{config: c, client: client, keys: keys, comment: comment}, nil
+}
+
+func (j *JiraHook) Name() string {
+	return "jira"
+}
+
+// Wants returns true for approvals of pull requests with a known previous
+// state. Approvals after an unknown state may repeat an earlier approval,
+// which would comment on the issues again.
+func (j *JiraHook) Wants(e Event) bool {
+	return e.Event == EventApproved && e.PreviousState != "" && matchesAny(j.config.Organizations, e.Owner)
+}
+
+func (j *JiraHook) Handle(ctx context.Context, e Event) error {
+	logger := zerolog.Ctx(ctx)
+
+	var firstErr error
+	for _, key := range j.issueKeys(e) {
+		if err := j.update(ctx, key, e); err != nil {
+			logger.Error().Err(err).Msgf("Failed to update Jira issue %s", key)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// issueKeys returns the unique issue keys in the title and head branch of a
+// pull request that belong to the configured projects.
+func (j *JiraHook) issueKeys(e Event) []string {
+	seen := make(map[string]bool)
+
+	var keys []string
+	for _, key := range j.keys.FindAllString(e.Title+"\n"+e.HeadRef, -1) {
+		project := key[:strings.LastIndex(key, "-")]
+		if seen[key] || !matchesAny(j.config.Projects, project) {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (j *JiraHook) update(ctx context.Context, key string, e Event) error {
+	logger := zerolog.Ctx(ctx)
+
+	if j.config.Transition != "" {
+		id, err := j.findTransition(ctx, key)
+		if err != nil {
+			return err
+		}
+		if id == "" {
+			logger.Debug().Msgf("Jira issue %s does not have the %q transition", key, j.config.Transition)
+		} else {
+			body := map[string]interface{}{"transition": map[string]string{"id": id}}
+			if err := j.do(ctx, http.MethodPost, key, "transitions", body, nil); err != nil {
+				return errors.Wrap(err, "failed to transition issue")
+			}
+			logger.Info().Msgf("Transitioned Jira issue %s", key)
+		}
+	}
+
+	if j.comment != nil {
+		var text bytes.Buffer
+		if err := j.comment.Execute(&text, e); err != nil {
+			return errors.Wrap(err, "failed to render jira comment")
+		}
+		body := map[string]string{"body": text.String()}
+		if err := j.do(ctx, http.MethodPost, key, "comment", body, nil); err != nil {
+			return errors.Wrap(err, "failed to comment on issue")
+		}
+		logger.Info().Msgf("Commented on Jira issue %s", key)
+	}
+	return nil
+}
+
+// findTransition returns the ID of the configured transition for an issue,
+// or the empty string if the issue does not have the transition in its
+// current status.
+func (j *JiraHook) findTransition(ctx context.Context, key string) (string, error) {
+	var res struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			To   struct {
+				Name string `json:"name"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := j.do(ctx, http.MethodGet, key, "transitions", nil, &res); err != nil {
+		return "", errors.Wrap(err, "failed to list transitions")
+	}
+
+	for _, t := range res.Transitions {
+		if strings.EqualFold(t.Name, j.config.Transition) || strings.EqualFold(t.To.Name, j.config.Transition) {
+			return t.ID, nil
+		}
+	}
+	return "", nil
+}
+
+func (j *JiraHook) do(ctx context.Context, method, key, resource string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal request")
+		}
+		body = bytes.NewReader(b)
+	}
+
+	u := fmt.Sprintf("%s/rest/api/2/issue/%s/%s", j.config.URL, url.PathEscape(key), resource)
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if j.config.Username != "" {
+		req.SetBasicAuth(j.config.Username, j.config.Token)
+	} else if j.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+j.config.Token)
+	}
+
+	res, err := j.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "jira request failed")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return errors.Errorf("jira returned status %d: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			return errors.Wrap(err, "failed to parse jira response")
+		}
+	}
+	return nil
+}
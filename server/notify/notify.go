@@ -0,0 +1,427 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notify sends signed webhooks to external services and runs
+// integrations like Jira when the policy status of a pull request changes.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	EventApproved    = "approved"
+	EventInvalidated = "invalidated"
+	EventBlocked     = "blocked"
+
+	// EventReport is a scheduled compliance report. Unlike other events, it
+	// is only sent to endpoints that list it explicitly.
+	EventReport = "report"
+
+	EndpointWebhook = "webhook"
+	EndpointTeams   = "teams"
+
+	HeaderEvent     = "X-Policy-Bot-Event"
+	HeaderDelivery  = "X-Policy-Bot-Delivery"
+	HeaderSignature = "X-Policy-Bot-Signature"
+
+	DefaultTimeout    = 10 * time.Second
+	DefaultRetries    = 2
+	DefaultRetryDelay = 1 * time.Second
+)
+
+type Config struct {
+	// Endpoints are the URLs that receive notifications
+	Endpoints []EndpointConfig `yaml:"endpoints"`
+
+	// Timeout is the maximum time for each request to an endpoint
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Retries is the number of times a failed request is retried. Set a
+	// negative value to disable retries.
+	Retries int `yaml:"retries"`
+
+	// Jira transitions and comments on the Jira issues linked to pull
+	// requests when they are approved.
+	Jira *JiraConfig `yaml:"jira"`
+}
+
+type EndpointConfig struct {
+	// Type is the kind of endpoint: "webhook" (the default) receives the
+	// event as JSON and "teams" is a Microsoft Teams incoming webhook that
+	// receives a message card.
+	Type string `yaml:"type"`
+
+	URL string `yaml:"url"`
+
+	// Secret is the key used to sign payloads. If empty, payloads are not
+	// signed.
+	Secret string `yaml:"secret"`
+
+	// Events limits the notifications sent to the endpoint. If empty, all
+	// events except "report" are sent.
+	Events []string `yaml:"events"`
+
+	// Organizations limits the notifications sent to the endpoint to pull
+	// requests in these organizations. If empty, notifications for all
+	// organizations are sent.
+	Organizations []string `yaml:"organizations"`
+
+	// Template is a Go template for the text of chat messages, like those
+	// sent to Microsoft Teams. It is executed with the event as data.
+	Template string `yaml:"template"`
+}
+
+func (c EndpointConfig) wants(e Event) bool {
+	return matchesAny(c.Events, e.Event) && matchesAny(c.Organizations, e.Owner)
+}
+
+func (c EndpointConfig) wantsSummary(s Summary) bool {
+	for _, event := range c.Events {
+		if strings.EqualFold(event, s.Event) {
+			return matchesAny(c.Organizations, s.Owner)
+		}
+	}
+	return false
+}
+
+func matchesAny(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c Config) Validate() error {
+	if c.Jira != nil {
+		if err := c.Jira.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, e := range c.Endpoints {
+		if e.URL == "" {
+			return errors.New("notification endpoints must have a URL")
+		}
+		switch e.Type {
+		case "", EndpointWebhook, EndpointTeams:
+		default:
+			return errors.Errorf("unknown notification endpoint type %q", e.Type)
+		}
+		if _, err := parseTemplate(e); err != nil {
+			return err
+		}
+		for _, event := range e.Events {
+			switch event {
+			case EventApproved, EventInvalidated, EventBlocked, EventReport:
+			default:
+				return errors.Errorf("unknown notification event %q", event)
+			}
+		}
+	}
+	return nil
+}
+
+// Transition returns the event for a change from one status state to
+// another, or the empty string if the change is not notable. If the previous
+// state is unknown, because it expired or was lost in a restart, there is no
+// transition, so events are not sent again for the current state.
+func Transition(prev, state string) string {
+	switch {
+	case prev == "":
+		return ""
+	case state == "success" && prev != "success":
+		return EventApproved
+	case state == "pending" && prev == "success":
+		return EventInvalidated
+	case state == "failure" && prev != "failure":
+		return EventBlocked
+	}
+	return ""
+}
+
+// Event describes a change in the policy status of a pull request.
+type Event struct {
+	Event         string    `json:"event"`
+	Time          time.Time `json:"time"`
+	Owner         string    `json:"owner"`
+	Repo          string    `json:"repo"`
+	Number        int       `json:"number"`
+	Title         string    `json:"title"`
+	HeadSHA       string    `json:"head_sha"`
+	HeadRef       string    `json:"head_ref"`
+	BaseRef       string    `json:"base_ref"`
+	Context       string    `json:"context"`
+	PreviousState string    `json:"previous_state,omitempty"`
+	State         string    `json:"state"`
+	Description   string    `json:"description"`
+	DetailsURL    string    `json:"details_url"`
+
+	// Approvers are the users whose approvals counted toward the policy.
+	Approvers []string `json:"approvers,omitempty"`
+}
+
+// Summary is a periodic report about an organization, like a compliance
+// report.
+type Summary struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Owner string    `json:"owner"`
+
+	// Title and Text are a plain text rendering of the summary for chat
+	// messages.
+	Title string `json:"title"`
+	Text  string `json:"text"`
+
+	// Report is the structured content of the summary.
+	Report interface{} `json:"report"`
+}
+
+// Hook is an integration that acts on events itself, rather than receiving
+// a request from the notifier.
+type Hook interface {
+	// Name identifies the hook in logs.
+	Name() string
+
+	// Wants returns true if the hook handles the event.
+	Wants(e Event) bool
+
+	// Handle acts on the event. It is called in the background.
+	Handle(ctx context.Context, e Event) error
+}
+
+// Notifier tracks the status of each pull request and sends events to the
+// configured endpoints and hooks when the status changes.
+type Notifier struct {
+	Config    Config
+	States    StateStore
+	Client    *http.Client
+	Endpoints []Endpoint
+	Hooks     []Hook
+
+	wg sync.WaitGroup
+}
+
+// New returns a Notifier for the configuration, or nil if no endpoints or
+// hooks are configured.
+func New(c Config, states StateStore) (*Notifier, error) {
+	if len(c.Endpoints) == 0 && c.Jira == nil {
+		return nil, nil
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Retries == 0 {
+		c.Retries = DefaultRetries
+	}
+
+	endpoints := make([]Endpoint, 0, len(c.Endpoints))
+	for _, ec := range c.Endpoints {
+		e, err := NewEndpoint(ec)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	client := &http.Client{Timeout: c.Timeout}
+
+	var hooks []Hook
+	if c.Jira != nil {
+		jira, err := NewJiraHook(*c.Jira, client)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, jira)
+	}
+
+	return &Notifier{
+		Config:    c,
+		States:    states,
+		Client:    client,
+		Endpoints: endpoints,
+		Hooks:     hooks,
+	}, nil
+}
+
+// Update records the latest status of a pull request. If the status changed
+// in a notable way, it sends the event to all interested endpoints in the
+// background.
+func (n *Notifier) Update(ctx context.Context, key string, e Event) error {
+	prev, err := n.States.Swap(ctx, key, e.State)
+	if err != nil {
+		return err
+	}
+
+	e.PreviousState = prev
+	e.Event = Transition(prev, e.State)
+	if e.Event == "" {
+		return nil
+	}
+
+	logger := *zerolog.Ctx(ctx)
+	for _, endpoint := range n.Endpoints {
+		if !endpoint.Config().wants(e) {
+			continue
+		}
+
+		req, err := endpoint.Request(e)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to create %s notification for %s", e.Event, endpoint.Config().URL)
+			continue
+		}
+
+		n.wg.Add(1)
+		go func(url string, req *Request) {
+			defer n.wg.Done()
+			if err := n.send(url, e.Event, req); err != nil {
+				logger.Error().Err(err).Msgf("Failed to send %s notification to %s", e.Event, url)
+			}
+		}(endpoint.Config().URL, req)
+	}
+
+	for _, hook := range n.Hooks {
+		if !hook.Wants(e) {
+			continue
+		}
+
+		n.wg.Add(1)
+		go func(hook Hook) {
+			defer n.wg.Done()
+			hookCtx := logger.WithContext(context.Background())
+			if err := hook.Handle(hookCtx, e); err != nil {
+				logger.Error().Err(err).Msgf("Failed to handle %s event with %s", e.Event, hook.Name())
+			}
+		}(hook)
+	}
+	return nil
+}
+
+// Summarize sends a summary to all interested endpoints and waits for the
+// requests to finish. Failures are logged and the number of endpoints that
+// received the summary is returned.
+func (n *Notifier) Summarize(ctx context.Context, s Summary) int {
+	logger := *zerolog.Ctx(ctx)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sent := 0
+	for _, endpoint := range n.Endpoints {
+		if !endpoint.Config().wantsSummary(s) {
+			continue
+		}
+
+		req, err := endpoint.SummaryRequest(s)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to create %s notification for %s", s.Event, endpoint.Config().URL)
+			continue
+		}
+
+		wg.Add(1)
+		go func(url string, req *Request) {
+			defer wg.Done()
+			if err := n.send(url, s.Event, req); err != nil {
+				logger.Error().Err(err).Msgf("Failed to send %s notification to %s", s.Event, url)
+				return
+			}
+			mu.Lock()
+			sent++
+			mu.Unlock()
+		}(endpoint.Config().URL, req)
+	}
+	wg.Wait()
+	return sent
+}
+
+// Wait blocks until all pending notifications are sent or the context is
+// done.
+func (n *Notifier) Wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func (n *Notifier) send(url, event string, r *Request) error {
+	delivery := xid.New().String()
+	delay := DefaultRetryDelay
+
+	var err error
+	for attempt := 0; attempt <= n.Config.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = n.post(url, event, delivery, r); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (n *Notifier) post(url, event, delivery string, r *Request) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(r.Body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create notification request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, delivery)
+	for k, v := range r.Header {
+		req.Header.Set(k, v)
+	}
+
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send notification")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return errors.Errorf("notification endpoint returned status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature of a payload in the format used by the
+// signature header: "sha256=" followed by the hex-encoded HMAC-SHA256 of the
+// payload.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
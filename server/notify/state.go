@@ -0,0 +1,111 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/redis"
+)
+
+const (
+	DefaultStateTTL       = 30 * 24 * time.Hour
+	DefaultMaxLocalStates = 10000
+
+	redisKeyPrefix = "policy-bot:state:"
+)
+
+// StateStore remembers the last status posted for each pull request.
+type StateStore interface {
+	// Swap stores the state for key and returns the previous state, or the
+	// empty string if there was no previous state.
+	Swap(ctx context.Context, key, state string) (string, error)
+}
+
+// NewStateStore returns a StateStore that uses Redis if client is non-nil and
+// memory otherwise.
+func NewStateStore(client *redis.Client) StateStore {
+	if client != nil {
+		return &RedisStateStore{Client: client, TTL: DefaultStateTTL}
+	}
+	return NewMemoryStateStore(DefaultMaxLocalStates)
+}
+
+// MemoryStateStore is a StateStore that keeps states in memory. When it is
+// full, the least recently updated state is discarded.
+type MemoryStateStore struct {
+	maxSize int
+
+	mu     sync.Mutex
+	states map[string]memoryState
+}
+
+type memoryState struct {
+	state   string
+	updated time.Time
+}
+
+func NewMemoryStateStore(maxSize int) *MemoryStateStore {
+	return &MemoryStateStore{
+		maxSize: maxSize,
+		states:  make(map[string]memoryState),
+	}
+}
+
+func (s *MemoryStateStore) Swap(ctx context.Context, key, state string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.states[key].state
+	s.states[key] = memoryState{state: state, updated: time.Now()}
+
+	if len(s.states) > s.maxSize {
+		var oldest string
+		var oldestTime time.Time
+		for k, v := range s.states {
+			if oldest == "" || v.updated.Before(oldestTime) {
+				oldest, oldestTime = k, v.updated
+			}
+		}
+		delete(s.states, oldest)
+	}
+	return prev, nil
+}
+
+// RedisStateStore is a StateStore that keeps states in Redis, so that all
+// servers sharing the Redis instance see the same transitions.
+type RedisStateStore struct {
+	Client *redis.Client
+	TTL    time.Duration
+}
+
+func (s *RedisStateStore) Swap(ctx context.Context, key, state string) (string, error) {
+	key = redisKeyPrefix + key
+
+	reply, err := s.Client.Do(ctx, "GETSET", key, state)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to store pull request state")
+	}
+	if _, err := s.Client.Do(ctx, "EXPIRE", key, int64(s.TTL/time.Second)); err != nil {
+		return "", errors.Wrap(err, "failed to set pull request state expiration")
+	}
+
+	prev, _ := reply.(string)
+	return prev, nil
+}
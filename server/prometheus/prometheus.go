@@ -0,0 +1,197 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prometheus exports the metrics in a registry in the Prometheus text
+// format, so the server can be scraped without a separate emitter.
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	DefaultPath      = "/metrics"
+	DefaultNamespace = "policybot"
+
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// quantiles are the quantiles exported for timers and histograms.
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+type Config struct {
+	// Enabled serves the metrics at Path
+	Enabled bool `yaml:"enabled"`
+
+	// Path is the route of the metrics. The default is "/metrics".
+	Path string `yaml:"path"`
+
+	// Namespace is the prefix of exported metric names. The default is
+	// "policybot".
+	Namespace string `yaml:"namespace"`
+
+	// MetricTags are the labels added to evaluation metrics: any of "org",
+	// "repo", and "rule".
+	MetricTags []string `yaml:"metric_tags"`
+}
+
+func (c *Config) FillDefaults() {
+	if c.Path == "" {
+		c.Path = DefaultPath
+	}
+	if c.Namespace == "" {
+		c.Namespace = DefaultNamespace
+	}
+}
+
+// Handler returns a handler that writes the metrics in a registry in the
+// Prometheus text format. Metric names in the "name[tag:value,...]" format
+// are exported with the tags as labels. Counters and meters are counters,
+// gauges are gauges, and timers and histograms are summaries. Timers are
+// exported in seconds.
+func Handler(registry metrics.Registry, namespace string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		out := bufio.NewWriter(w)
+		write(out, registry, namespace)
+		_ = out.Flush()
+	})
+}
+
+// family is the series of a metric, including the _sum and _count series of
+// summaries.
+type family struct {
+	typ    string
+	series []string
+}
+
+func write(out *bufio.Writer, registry metrics.Registry, namespace string) {
+	families := make(map[string]*family)
+	add := func(name, typ, suffix, labels string, value float64) {
+		f, ok := families[name]
+		if !ok {
+			f = &family{typ: typ}
+			families[name] = f
+		}
+		f.series = append(f.series, name+suffix+labels+" "+strconv.FormatFloat(value, 'g', -1, 64))
+	}
+
+	registry.Each(func(key string, i interface{}) {
+		base, tags := parseKey(key)
+		name := metricName(namespace, base)
+		labels := formatLabels(tags)
+
+		switch m := i.(type) {
+		case metrics.Counter:
+			add(name+"_total", "counter", "", labels, float64(m.Count()))
+		case metrics.Meter:
+			add(name+"_total", "counter", "", labels, float64(m.Snapshot().Count()))
+		case metrics.Gauge:
+			add(name, "gauge", "", labels, float64(m.Value()))
+		case metrics.GaugeFloat64:
+			add(name, "gauge", "", labels, m.Value())
+		case metrics.Timer:
+			s := m.Snapshot()
+			name += "_seconds"
+			for j, v := range s.Percentiles(quantiles) {
+				add(name, "summary", "", formatLabels(append(tags, quantileTag(quantiles[j]))), v/1e9)
+			}
+			add(name, "summary", "_sum", labels, float64(s.Sum())/1e9)
+			add(name, "summary", "_count", labels, float64(s.Count()))
+		case metrics.Histogram:
+			s := m.Snapshot()
+			for j, v := range s.Percentiles(quantiles) {
+				add(name, "summary", "", formatLabels(append(tags, quantileTag(quantiles[j]))), v)
+			}
+			add(name, "summary", "_sum", labels, float64(s.Sum()))
+			add(name, "summary", "_count", labels, float64(s.Count()))
+		}
+	})
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := families[name]
+		fmt.Fprintf(out, "# TYPE %s %s\n", name, f.typ)
+		sort.Strings(f.series)
+		for _, s := range f.series {
+			fmt.Fprintln(out, s)
+		}
+	}
+}
+
+// parseKey splits a metric key in the "name[tag:value,...]" format into its
+// name and tags.
+func parseKey(key string) (string, []string) {
+	i := strings.IndexByte(key, '[')
+	if i < 0 || !strings.HasSuffix(key, "]") {
+		return key, nil
+	}
+	return key[:i], strings.Split(key[i+1:len(key)-1], ",")
+}
+
+// metricName converts a metric name to a valid Prometheus name in the
+// namespace.
+func metricName(namespace, name string) string {
+	if namespace != "" {
+		name = namespace + "_" + name
+	}
+	return sanitize(name)
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func quantileTag(q float64) string {
+	return "quantile:" + strconv.FormatFloat(q, 'g', -1, 64)
+}
+
+// formatLabels converts tags in the "name:value" format to Prometheus labels.
+func formatLabels(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	labels := make([]string, 0, len(tags))
+	for _, t := range tags {
+		name, value := t, ""
+		if i := strings.IndexByte(t, ':'); i >= 0 {
+			name, value = t[:i], t[i+1:]
+		}
+		labels = append(labels, sanitize(name)+`="`+labelEscaper.Replace(value)+`"`)
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// labelEscaper escapes label values as required by the text format, which
+// only escapes backslashes, double quotes, and line feeds.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
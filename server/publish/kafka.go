@@ -0,0 +1,90 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type KafkaConfig struct {
+	// RESTProxyURL is the base URL of a Confluent-compatible Kafka REST
+	// Proxy, like "http://localhost:8082"
+	RESTProxyURL string `yaml:"rest_proxy_url"`
+
+	Topic string `yaml:"topic"`
+
+	// Username and Password are used for basic authentication, if set
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// KafkaPublisher produces records to a Kafka topic through a REST Proxy. The
+// key is used as the record key, so results for the same pull request are
+// written to the same partition.
+type KafkaPublisher struct {
+	Config KafkaConfig
+	Client *http.Client
+}
+
+func NewKafkaPublisher(c KafkaConfig, client *http.Client) (*KafkaPublisher, error) {
+	if c.RESTProxyURL == "" || c.Topic == "" {
+		return nil, errors.New("the Kafka publisher requires a REST proxy URL and a topic")
+	}
+	return &KafkaPublisher{Config: c, Client: client}, nil
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, key string, payload []byte) error {
+	body, err := json.Marshal(kafkaRecords{
+		Records: []kafkaRecord{{Key: key, Value: payload}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal Kafka record")
+	}
+
+	u := strings.TrimSuffix(p.Config.RESTProxyURL, "/") + "/topics/" + url.PathEscape(p.Config.Topic)
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create Kafka request")
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if p.Config.Username != "" {
+		req.SetBasicAuth(p.Config.Username, p.Config.Password)
+	}
+
+	res, err := p.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to send Kafka record")
+	}
+	defer res.Body.Close()
+
+	return checkResponse(res, "Kafka REST Proxy")
+}
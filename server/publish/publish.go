@@ -0,0 +1,178 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package publish sends evaluation results to message buses so other systems
+// can consume them.
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/server/audit"
+)
+
+const (
+	DefaultTimeout   = 10 * time.Second
+	DefaultQueueSize = 1000
+)
+
+type Config struct {
+	SQS    *SQSConfig    `yaml:"sqs"`
+	PubSub *PubSubConfig `yaml:"pubsub"`
+	Kafka  *KafkaConfig  `yaml:"kafka"`
+
+	// QueueSize is the maximum number of records waiting to be published.
+	// Records are dropped while the queue is full.
+	QueueSize int `yaml:"queue_size"`
+}
+
+// Publisher sends messages to a message bus. The key identifies the pull
+// request and may be used for ordering or partitioning.
+type Publisher interface {
+	Publish(ctx context.Context, key string, payload []byte) error
+}
+
+// New returns the publishers for the configuration.
+func New(c Config) ([]Publisher, error) {
+	client := &http.Client{Timeout: DefaultTimeout}
+
+	var publishers []Publisher
+	if c.SQS != nil {
+		p, err := NewSQSPublisher(*c.SQS, client)
+		if err != nil {
+			return nil, err
+		}
+		publishers = append(publishers, p)
+	}
+	if c.PubSub != nil {
+		p, err := NewPubSubPublisher(*c.PubSub, client)
+		if err != nil {
+			return nil, err
+		}
+		publishers = append(publishers, p)
+	}
+	if c.Kafka != nil {
+		p, err := NewKafkaPublisher(*c.Kafka, client)
+		if err != nil {
+			return nil, err
+		}
+		publishers = append(publishers, p)
+	}
+	return publishers, nil
+}
+
+// Sink is an audit.Sink that publishes each evaluation record as JSON.
+type Sink struct {
+	Publishers []Publisher
+}
+
+func (s *Sink) Write(ctx context.Context, r *audit.Record) error {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal evaluation record")
+	}
+
+	key := fmt.Sprintf("%s/%s#%d", r.Owner, r.Repo, r.Number)
+
+	var firstErr error
+	for _, p := range s.Publishers {
+		if err := p.Publish(ctx, key, payload); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// AsyncSink is an audit.Sink that publishes records in the background, so
+// that slow message buses do not delay evaluations. Records are published
+// one at a time in the order they are written.
+type AsyncSink struct {
+	Sink audit.Sink
+
+	records chan asyncRecord
+	wg      sync.WaitGroup
+}
+
+type asyncRecord struct {
+	logger zerolog.Logger
+	record *audit.Record
+}
+
+// NewAsyncSink returns an AsyncSink that queues at most size records and
+// starts publishing them in the background.
+func NewAsyncSink(sink audit.Sink, size int) *AsyncSink {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+
+	s := &AsyncSink{
+		Sink:    sink,
+		records: make(chan asyncRecord, size),
+	}
+	go s.publish()
+	return s
+}
+
+// Write queues a record to publish. It returns an error without waiting if
+// the queue is full.
+func (s *AsyncSink) Write(ctx context.Context, r *audit.Record) error {
+	s.wg.Add(1)
+	select {
+	case s.records <- asyncRecord{logger: *zerolog.Ctx(ctx), record: r}:
+		return nil
+	default:
+		s.wg.Done()
+		return errors.New("publish queue is full, dropping evaluation record")
+	}
+}
+
+func (s *AsyncSink) publish() {
+	for r := range s.records {
+		ctx := r.logger.WithContext(context.Background())
+		if err := s.Sink.Write(ctx, r.record); err != nil {
+			r.logger.Error().Err(err).Msg("Failed to publish evaluation record")
+		}
+		s.wg.Done()
+	}
+}
+
+// Wait blocks until all queued records are published or the context is
+// canceled.
+func (s *AsyncSink) Wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func checkResponse(res *http.Response, target string) error {
+	if res.StatusCode >= 300 {
+		return errors.Errorf("%s returned status %d", target, res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/googleauth"
+)
+
+const (
+	DefaultPubSubEndpoint = "https://pubsub.googleapis.com"
+
+	pubsubScope = "https://www.googleapis.com/auth/pubsub"
+)
+
+type PubSubConfig struct {
+	// Topic is the full name of the topic, like
+	// "projects/my-project/topics/policy-bot"
+	Topic string `yaml:"topic"`
+
+	// CredentialsFile is the path to a service account key file. If unset,
+	// the file named by the GOOGLE_APPLICATION_CREDENTIALS environment
+	// variable is used, or if that is unset, the service account of the
+	// Compute Engine metadata server.
+	CredentialsFile string `yaml:"credentials_file"`
+
+	// OrderingKeys enables setting the pull request as the ordering key of
+	// each message. The topic's subscriptions must enable message ordering.
+	OrderingKeys bool `yaml:"ordering_keys"`
+}
+
+// PubSubPublisher publishes messages to a Google Cloud Pub/Sub topic.
+type PubSubPublisher struct {
+	Config   PubSubConfig
+	Endpoint string
+	Client   *http.Client
+	Tokens   *googleauth.TokenSource
+}
+
+func NewPubSubPublisher(c PubSubConfig, client *http.Client) (*PubSubPublisher, error) {
+	if !strings.HasPrefix(c.Topic, "projects/") || !strings.Contains(c.Topic, "/topics/") {
+		return nil, errors.Errorf("invalid Pub/Sub topic %q", c.Topic)
+	}
+
+	tokens, err := googleauth.NewTokenSource(client, pubsubScope, c.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PubSubPublisher{
+		Config:   c,
+		Endpoint: DefaultPubSubEndpoint,
+		Client:   client,
+		Tokens:   tokens,
+	}, nil
+}
+
+type pubsubRequest struct {
+	Messages []pubsubMessage `json:"messages"`
+}
+
+type pubsubMessage struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+func (p *PubSubPublisher) Publish(ctx context.Context, key string, payload []byte) error {
+	token, err := p.Tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+
+	msg := pubsubMessage{
+		Data:       payload,
+		Attributes: map[string]string{"pull_request": key},
+	}
+	if p.Config.OrderingKeys {
+		msg.OrderingKey = key
+	}
+
+	body, err := json.Marshal(pubsubRequest{Messages: []pubsubMessage{msg}})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal Pub/Sub message")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.Endpoint+"/v1/"+p.Config.Topic+":publish", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create Pub/Sub request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := p.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to publish Pub/Sub message")
+	}
+	defer res.Body.Close()
+
+	return checkResponse(res, "Pub/Sub")
+}
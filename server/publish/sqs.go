@@ -0,0 +1,115 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/sigv4"
+)
+
+type SQSConfig struct {
+	// QueueURL is the URL of the queue, like
+	// "https://sqs.us-east-1.amazonaws.com/123456789012/policy-bot"
+	QueueURL string `yaml:"queue_url"`
+
+	// Region is the region of the queue. If empty, it is derived from the
+	// queue URL.
+	Region string `yaml:"region"`
+
+	// AccessKeyID and SecretAccessKey are the credentials used to send
+	// messages. If unset, the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and
+	// AWS_SESSION_TOKEN environment variables are used.
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+}
+
+// SQSPublisher sends messages to an Amazon SQS queue. For FIFO queues, the
+// key is used as the message group, so results for the same pull request are
+// delivered in order.
+type SQSPublisher struct {
+	QueueURL string
+	Signer   sigv4.Signer
+	Client   *http.Client
+}
+
+func NewSQSPublisher(c SQSConfig, client *http.Client) (*SQSPublisher, error) {
+	u, err := url.Parse(c.QueueURL)
+	if err != nil || c.QueueURL == "" {
+		return nil, errors.Errorf("invalid SQS queue URL %q", c.QueueURL)
+	}
+
+	region := c.Region
+	if region == "" {
+		// hosts have the form sqs.<region>.amazonaws.com
+		if parts := strings.Split(u.Hostname(), "."); len(parts) > 2 && parts[0] == "sqs" {
+			region = parts[1]
+		}
+	}
+	if region == "" {
+		return nil, errors.New("the SQS publisher requires a region")
+	}
+
+	creds := sigv4.Credentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey}
+	if !creds.Valid() {
+		creds = sigv4.EnvCredentials()
+	}
+	if !creds.Valid() {
+		return nil, errors.New("the SQS publisher requires credentials")
+	}
+
+	return &SQSPublisher{
+		QueueURL: c.QueueURL,
+		Signer:   sigv4.Signer{Credentials: creds, Region: region, Service: "sqs"},
+		Client:   client,
+	}, nil
+}
+
+func (p *SQSPublisher) Publish(ctx context.Context, key string, payload []byte) error {
+	form := url.Values{}
+	form.Set("Action", "SendMessage")
+	form.Set("Version", "2012-11-05")
+	form.Set("MessageBody", string(payload))
+	if strings.HasSuffix(p.QueueURL, ".fifo") {
+		hash := sha256.Sum256(payload)
+		form.Set("MessageGroupId", key)
+		form.Set("MessageDeduplicationId", hex.EncodeToString(hash[:]))
+	}
+	body := []byte(form.Encode())
+
+	req, err := http.NewRequest(http.MethodPost, p.QueueURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create SQS request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	p.Signer.Sign(req, body, time.Now())
+
+	res, err := p.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to send SQS message")
+	}
+	defer res.Body.Close()
+
+	return checkResponse(res, "SQS")
+}
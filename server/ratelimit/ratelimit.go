@@ -0,0 +1,360 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit tracks the GitHub API rate limits of each installation
+// using the headers of API responses, so operators can see which
+// installations and repositories consume the most of each limit.
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gregjones/httpcache"
+	"github.com/palantir/go-githubapp/githubapp"
+)
+
+const (
+	// DefaultResource is the resource of responses that do not name one
+	DefaultResource = "core"
+
+	// minProjectionWindow is the time a limit must be observed before its
+	// exhaustion is projected, so that a burst of requests at the start of
+	// a window does not produce an alarming projection
+	minProjectionWindow = time.Minute
+)
+
+// Source identifies the installation and repository that a request is made
+// for. Requests without a source are attributed using their URL, if
+// possible.
+type Source struct {
+	InstallationID int64
+	Owner          string
+	Repo           string
+}
+
+type sourceKey struct{}
+
+// WithSource returns a context that attributes GitHub requests to a source.
+func WithSource(ctx context.Context, s Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, s)
+}
+
+// SourceFromContext returns the source of requests made with ctx, if any.
+func SourceFromContext(ctx context.Context) (Source, bool) {
+	s, ok := ctx.Value(sourceKey{}).(Source)
+	return s, ok
+}
+
+// Tracker records the latest rate limit state of each installation and the
+// points consumed by each repository in the current limit window. It is
+// safe for concurrent use.
+type Tracker struct {
+	mu            sync.Mutex
+	installations map[installationKey]*installation
+
+	now func() time.Time
+}
+
+type installationKey struct {
+	app string
+	id  int64
+}
+
+type installation struct {
+	owner     string
+	resources map[string]*resource
+}
+
+type resource struct {
+	limit     int
+	remaining int
+	used      int
+	reset     time.Time
+	updated   time.Time
+
+	windowStart     time.Time
+	windowStartUsed int
+
+	repos map[string]*Repository
+}
+
+// NewTracker creates an empty tracker.
+func NewTracker() *Tracker {
+	return &Tracker{
+		installations: make(map[installationKey]*installation),
+		now:           time.Now,
+	}
+}
+
+// Middleware returns client middleware that records the rate limit headers
+// of responses for the named app. Responses served from the client cache
+// are ignored because they do not consume the limit.
+func (t *Tracker) Middleware(app string) githubapp.ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			res, err := next.RoundTrip(r)
+			if res != nil && res.Header.Get(httpcache.XFromCache) == "" {
+				t.observe(app, sourceForRequest(r), res.Header)
+			}
+			return res, err
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
+
+// sourceForRequest returns the source in the context of the request or,
+// for REST requests, the repository in the URL.
+func sourceForRequest(r *http.Request) Source {
+	s, ok := SourceFromContext(r.Context())
+	if ok && s.Owner != "" {
+		return s
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	for i := 0; i+2 < len(parts); i++ {
+		if parts[i] == "repos" {
+			s.Owner, s.Repo = parts[i+1], parts[i+2]
+			break
+		}
+	}
+	return s
+}
+
+func (t *Tracker) observe(app string, s Source, h http.Header) {
+	limit, ok := headerInt(h, "X-RateLimit-Limit")
+	if !ok {
+		return
+	}
+	remaining, _ := headerInt(h, "X-RateLimit-Remaining")
+	resetUnix, _ := headerInt(h, "X-RateLimit-Reset")
+	used, ok := headerInt(h, "X-RateLimit-Used")
+	if !ok {
+		used = limit - remaining
+	}
+
+	name := h.Get("X-RateLimit-Resource")
+	if name == "" {
+		name = DefaultResource
+	}
+	reset := time.Unix(int64(resetUnix), 0)
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := installationKey{app: app, id: s.InstallationID}
+	inst, ok := t.installations[key]
+	if !ok {
+		inst = &installation{resources: make(map[string]*resource)}
+		t.installations[key] = inst
+	}
+	if s.Owner != "" {
+		inst.owner = s.Owner
+	}
+
+	res, ok := inst.resources[name]
+	newWindow := !ok || !res.reset.Equal(reset)
+	if newWindow {
+		// a new window, so the usage of the previous window is discarded
+		res = &resource{
+			reset:           reset,
+			windowStart:     now,
+			windowStartUsed: used,
+			repos:           make(map[string]*Repository),
+		}
+		inst.resources[name] = res
+	}
+
+	// responses to concurrent requests may arrive out of order, so only the
+	// highest usage in the window is kept and usage never decreases
+	points := 1
+	if !newWindow {
+		points = used - res.used
+		if points < 0 {
+			points = 0
+		}
+	}
+	if newWindow || used >= res.used {
+		res.used = used
+		res.remaining = remaining
+	}
+	res.limit = limit
+	res.updated = now
+
+	repo := "unknown"
+	if s.Owner != "" && s.Repo != "" {
+		repo = s.Owner + "/" + s.Repo
+	}
+	usage, ok := res.repos[repo]
+	if !ok {
+		usage = &Repository{Name: repo}
+		res.repos[repo] = usage
+	}
+	usage.Requests++
+	usage.Points += points
+}
+
+func headerInt(h http.Header, name string) (int, bool) {
+	v, err := strconv.Atoi(h.Get(name))
+	return v, err == nil
+}
+
+// Installation is the rate limit state of an installation.
+type Installation struct {
+	App            string     `json:"app,omitempty"`
+	InstallationID int64      `json:"installation_id"`
+	Owner          string     `json:"owner,omitempty"`
+	Resources      []Resource `json:"resources"`
+}
+
+// Resource is the state of one rate limit, such as "core" or "graphql", in
+// its current window.
+type Resource struct {
+	Name      string    `json:"name"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Used      int       `json:"used"`
+	Reset     time.Time `json:"reset"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// PointsPerMinute is the average rate of consumption since the window
+	// was first observed
+	PointsPerMinute float64 `json:"points_per_minute"`
+
+	// ProjectedExhaustion is when the limit will be exhausted at the current
+	// rate, if that is before it resets
+	ProjectedExhaustion *time.Time `json:"projected_exhaustion,omitempty"`
+
+	// TopRepositories are the repositories that consumed the most points
+	// in the window
+	TopRepositories []Repository `json:"top_repositories"`
+}
+
+// Repository is the usage of a rate limit by one repository. Points are
+// estimated from the change in usage reported by each response, so they
+// are approximate when requests are concurrent.
+type Repository struct {
+	Name     string `json:"name"`
+	Requests int    `json:"requests"`
+	Points   int    `json:"points"`
+}
+
+// Snapshot returns the state of every installation with a limit that has not
+// reset, ordered by the highest fraction of any limit used. Each resource
+// includes at most top repositories.
+func (t *Tracker) Snapshot(top int) []Installation {
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var installations []Installation
+	for key, inst := range t.installations {
+		out := Installation{App: key.app, InstallationID: key.id, Owner: inst.owner}
+		for name, res := range inst.resources {
+			if !res.reset.After(now) {
+				delete(inst.resources, name)
+				continue
+			}
+			out.Resources = append(out.Resources, res.snapshot(name, now, top))
+		}
+		if len(inst.resources) == 0 {
+			delete(t.installations, key)
+			continue
+		}
+
+		sort.Slice(out.Resources, func(i, j int) bool { return out.Resources[i].Name < out.Resources[j].Name })
+		installations = append(installations, out)
+	}
+
+	sort.Slice(installations, func(i, j int) bool {
+		fi, fj := maxFractionUsed(installations[i]), maxFractionUsed(installations[j])
+		if fi != fj {
+			return fi > fj
+		}
+		if installations[i].App != installations[j].App {
+			return installations[i].App < installations[j].App
+		}
+		return installations[i].InstallationID < installations[j].InstallationID
+	})
+	return installations
+}
+
+func (res *resource) snapshot(name string, now time.Time, top int) Resource {
+	out := Resource{
+		Name:      name,
+		Limit:     res.limit,
+		Remaining: res.remaining,
+		Used:      res.used,
+		Reset:     res.reset,
+		UpdatedAt: res.updated,
+	}
+
+	if elapsed := res.updated.Sub(res.windowStart); elapsed >= minProjectionWindow {
+		out.PointsPerMinute = float64(res.used-res.windowStartUsed) / elapsed.Minutes()
+	}
+
+	switch {
+	case res.remaining <= 0:
+		exhausted := res.updated
+		out.ProjectedExhaustion = &exhausted
+	case out.PointsPerMinute > 0:
+		minutes := float64(res.remaining) / out.PointsPerMinute
+		exhausted := res.updated.Add(time.Duration(minutes * float64(time.Minute)))
+		if exhausted.Before(res.reset) {
+			out.ProjectedExhaustion = &exhausted
+		}
+	}
+
+	for _, r := range res.repos {
+		out.TopRepositories = append(out.TopRepositories, *r)
+	}
+	sort.Slice(out.TopRepositories, func(i, j int) bool {
+		ri, rj := out.TopRepositories[i], out.TopRepositories[j]
+		if ri.Points != rj.Points {
+			return ri.Points > rj.Points
+		}
+		if ri.Requests != rj.Requests {
+			return ri.Requests > rj.Requests
+		}
+		return ri.Name < rj.Name
+	})
+	if top > 0 && len(out.TopRepositories) > top {
+		out.TopRepositories = out.TopRepositories[:top]
+	}
+	return out
+}
+
+func maxFractionUsed(inst Installation) float64 {
+	var max float64
+	for _, r := range inst.Resources {
+		if r.Limit > 0 {
+			if f := float64(r.Used) / float64(r.Limit); f > max {
+				max = f
+			}
+		}
+	}
+	return max
+}
@@ -0,0 +1,218 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rbac
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultOIDCClaim = "groups"
+
+	// minKeyRefresh limits how often unknown key IDs fetch the keys again
+	minKeyRefresh = time.Minute
+)
+
+type OIDCConfig struct {
+	// Issuer is the URL of the provider. Its discovery document lists the
+	// keys that sign tokens.
+	Issuer string `yaml:"issuer"`
+
+	// Audience must be one of the audiences of a token
+	Audience string `yaml:"audience"`
+
+	// Claim is the claim that contains the values in Roles, either a string
+	// or a list of strings. The default is "groups".
+	Claim string `yaml:"claim"`
+
+	// Roles maps values of the claim to roles
+	Roles map[string]Role `yaml:"roles"`
+}
+
+type oidcVerifier struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+func newOIDCVerifier(c OIDCConfig) *oidcVerifier {
+	if c.Claim == "" {
+		c.Claim = DefaultOIDCClaim
+	}
+	c.Issuer = strings.TrimSuffix(c.Issuer, "/")
+
+	return &oidcVerifier{
+		config: c,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// role verifies a token and returns the highest role of its claim values.
+func (v *oidcVerifier) role(ctx context.Context, raw string) (Role, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid)
+	})
+	if err != nil {
+		return RoleNone, errors.Wrap(err, "invalid token")
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return RoleNone, errors.New("token does not expire")
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != v.config.Issuer {
+		return RoleNone, errors.Errorf("unexpected issuer %q", iss)
+	}
+	if !stringClaimContains(claims["aud"], v.config.Audience) {
+		return RoleNone, errors.New("token is not for the configured audience")
+	}
+
+	role := RoleNone
+	for value, r := range v.config.Roles {
+		if r > role && stringClaimContains(claims[v.config.Claim], value) {
+			role = r
+		}
+	}
+	return role, nil
+}
+
+func (v *oidcVerifier) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	lookup := func() *rsa.PublicKey {
+		if kid == "" && len(v.keys) == 1 {
+			for _, k := range v.keys {
+				return k
+			}
+		}
+		return v.keys[kid]
+	}
+
+	if k := lookup(); k != nil {
+		return k, nil
+	}
+	if time.Since(v.fetched) < minKeyRefresh {
+		return nil, errors.Errorf("unknown key %q", kid)
+	}
+
+	keys, err := v.fetchKeys(ctx)
+	v.fetched = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	v.keys = keys
+
+	if k := lookup(); k != nil {
+		return k, nil
+	}
+	return nil, errors.Errorf("unknown key %q", kid)
+}
+
+func (v *oidcVerifier) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := v.getJSON(ctx, v.config.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document does not have a jwks_uri")
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := v.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid modulus of key %q", k.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid exponent of key %q", k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+func (v *oidcVerifier) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create oidc request")
+	}
+
+	res, err := v.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch %s", url)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("failed to fetch %s: %s", url, res.Status)
+	}
+	return errors.Wrapf(json.NewDecoder(res.Body).Decode(out), "failed to decode %s", url)
+}
+
+// stringClaimContains returns true if a claim is the value or is a list that
+// contains the value.
+func stringClaimContains(claim interface{}, value string) bool {
+	switch c := claim.(type) {
+	case string:
+		return c == value
+	case []interface{}:
+		for _, v := range c {
+			if s, ok := v.(string); ok && s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rbac assigns roles to the callers of the admin API and to the users
+// of the web interface. Roles are ordered: each role has the permissions of
+// the roles before it.
+package rbac
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+type Role int
+
+const (
+	// RoleNone has no permissions.
+	RoleNone Role = iota
+
+	// RoleViewer may read the state of the server, like dead letters.
+	RoleViewer
+
+	// RoleSimulator may evaluate hypothetical changes and pasted policies.
+	RoleSimulator
+
+	// RoleOperator may force evaluations and replay or delete webhooks.
+	RoleOperator
+)
+
+var roleNames = []string{"none", "viewer", "simulator", "operator"}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return "unknown"
+	}
+	return roleNames[r]
+}
+
+// ParseRole returns the role with the given name.
+func ParseRole(name string) (Role, error) {
+	for i, n := range roleNames {
+		if strings.EqualFold(name, n) {
+			return Role(i), nil
+		}
+	}
+	return RoleNone, errors.Errorf("invalid role %q, allowed values: %v", name, roleNames[1:])
+}
+
+func (r *Role) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+
+	role, err := ParseRole(name)
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+type Config struct {
+	// Enabled assigns roles to admin API callers and web users. If false,
+	// admin tokens have all permissions and every user who can read a
+	// repository may run simulations.
+	Enabled bool `yaml:"enabled"`
+
+	// Tokens are bearer tokens for the admin API and their roles
+	Tokens []TokenConfig `yaml:"tokens"`
+
+	// OIDC accepts ID tokens from an OpenID Connect provider as bearer
+	// tokens for the admin API
+	OIDC OIDCConfig `yaml:"oidc"`
+
+	// GitHub assigns roles to users of the web interface
+	GitHub GitHubConfig `yaml:"github"`
+}
+
+type TokenConfig struct {
+	Token string `yaml:"token"`
+	Role  Role   `yaml:"role"`
+}
+
+type GitHubConfig struct {
+	// Users maps user logins to roles
+	Users map[string]Role `yaml:"users"`
+
+	// Organizations maps organizations to the role of their members
+	Organizations map[string]Role `yaml:"organizations"`
+
+	// Teams maps teams, as "org/team-slug", to the role of their members
+	Teams map[string]Role `yaml:"teams"`
+}
+
+// Membership checks the organization and team membership of GitHub users.
+type Membership interface {
+	IsOrgMember(ctx context.Context, org, user string) (bool, error)
+	IsTeamMember(ctx context.Context, team, user string) (bool, error)
+}
+
+// Authorizer assigns roles. A nil Authorizer means that RBAC is disabled.
+type Authorizer struct {
+	config     Config
+	tokens     []TokenConfig
+	oidc       *oidcVerifier
+	membership Membership
+}
+
+// New creates an Authorizer. The adminTokens have the operator role, so that
+// enabling RBAC does not change the permissions of existing tokens.
+func New(c Config, adminTokens []string, membership Membership) (*Authorizer, error) {
+	a := &Authorizer{
+		config:     c,
+		membership: membership,
+	}
+
+	for _, t := range c.Tokens {
+		if t.Token == "" {
+			return nil, errors.New("rbac tokens must not be empty")
+		}
+		if t.Role == RoleNone {
+			return nil, errors.New("rbac tokens must have a role")
+		}
+	}
+	a.tokens = append(a.tokens, c.Tokens...)
+	for _, t := range adminTokens {
+		a.tokens = append(a.tokens, TokenConfig{Token: t, Role: RoleOperator})
+	}
+
+	if c.OIDC.Issuer != "" {
+		if c.OIDC.Audience == "" {
+			return nil, errors.New("rbac oidc audience must be set")
+		}
+		a.oidc = newOIDCVerifier(c.OIDC)
+	}
+	return a, nil
+}
+
+// TokenRole returns the role of the bearer token of a request. It returns
+// RoleNone if the request has no valid token.
+func (a *Authorizer) TokenRole(r *http.Request) Role {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return RoleNone
+	}
+	presented := strings.TrimPrefix(auth, "Bearer ")
+
+	role := RoleNone
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(t.Token)) == 1 && t.Role > role {
+			role = t.Role
+		}
+	}
+
+	if role == RoleNone && a.oidc != nil {
+		oidcRole, err := a.oidc.role(r.Context(), presented)
+		if err != nil {
+			zerolog.Ctx(r.Context()).Debug().Err(err).Msg("Rejected OIDC token")
+		}
+		role = oidcRole
+	}
+	return role
+}
+
+// RequireToken returns middleware that rejects requests whose bearer token
+// does not have at least the given role.
+func (a *Authorizer) RequireToken(role Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			if a.TokenRole(r) < role {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UserRole returns the highest role of a GitHub user.
+func (a *Authorizer) UserRole(ctx context.Context, user string) (Role, error) {
+	if user == "" {
+		return RoleNone, nil
+	}
+
+	role := RoleNone
+	for login, r := range a.config.GitHub.Users {
+		if strings.EqualFold(login, user) && r > role {
+			role = r
+		}
+	}
+
+	for org, r := range a.config.GitHub.Organizations {
+		if r <= role {
+			continue
+		}
+		member, err := a.membership.IsOrgMember(ctx, org, user)
+		if err != nil {
+			return RoleNone, errors.WithMessage(err, "failed to check organization membership")
+		}
+		if member {
+			role = r
+		}
+	}
+
+	for team, r := range a.config.GitHub.Teams {
+		if r <= role {
+			continue
+		}
+		member, err := a.membership.IsTeamMember(ctx, team, user)
+		if err != nil {
+			return RoleNone, errors.WithMessage(err, "failed to check team membership")
+		}
+		if member {
+			role = r
+		}
+	}
+	return role, nil
+}
+
+// UserAllowed returns true if a GitHub user has at least the given role. If
+// the Authorizer is nil, all users are allowed.
+func (a *Authorizer) UserAllowed(ctx context.Context, user string, role Role) (bool, error) {
+	if a == nil {
+		return true, nil
+	}
+	userRole, err := a.UserRole(ctx, user)
+	return userRole >= role, err
+}
@@ -0,0 +1,226 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redis is a minimal Redis client that supports the small set of
+// commands needed to coordinate multiple instances of the server.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultDialTimeout = 5 * time.Second
+	DefaultMaxIdle     = 4
+)
+
+// ErrNil is returned when a command returns a nil reply.
+var ErrNil = errors.New("redis: nil reply")
+
+type Config struct {
+	Address  string `yaml:"address"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+// Client is a pooled Redis client. It is safe for concurrent use.
+type Client struct {
+	config Config
+
+	mu   sync.Mutex
+	idle []*conn
+}
+
+func NewClient(c Config) *Client {
+	return &Client{config: c}
+}
+
+// Do executes a command and returns the reply. Replies are strings, int64s,
+// []interface{}, or nil. Error replies are returned as errors.
+func (c *Client) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = cn.SetDeadline(deadline)
+	} else {
+		_ = cn.SetDeadline(time.Time{})
+	}
+
+	reply, err := cn.do(args...)
+	if err != nil {
+		if _, isReplyErr := err.(replyError); !isReplyErr {
+			_ = cn.Close()
+			return nil, err
+		}
+	}
+
+	c.put(cn)
+	return reply, err
+}
+
+// Close closes all idle connections.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cn := range c.idle {
+		_ = cn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	d := net.Dialer{Timeout: DefaultDialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", c.config.Address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "redis: failed to connect to %s", c.config.Address)
+	}
+
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if c.config.Password != "" {
+		if _, err := cn.do("AUTH", c.config.Password); err != nil {
+			_ = cn.Close()
+			return nil, errors.Wrap(err, "redis: authentication failed")
+		}
+	}
+	if c.config.DB != 0 {
+		if _, err := cn.do("SELECT", c.config.DB); err != nil {
+			_ = cn.Close()
+			return nil, errors.Wrap(err, "redis: failed to select database")
+		}
+	}
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.idle) >= DefaultMaxIdle {
+		_ = cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+type replyError string
+
+func (e replyError) Error() string {
+	return "redis: " + string(e)
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (cn *conn) do(args ...interface{}) (interface{}, error) {
+	if err := cn.write(args); err != nil {
+		return nil, errors.Wrap(err, "redis: failed to write command")
+	}
+	return cn.read()
+}
+
+func (cn *conn) write(args []interface{}) error {
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var s string
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		default:
+			s = fmt.Sprint(v)
+		}
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(s), s)
+	}
+	return cn.w.Flush()
+}
+
+func (cn *conn) read() (interface{}, error) {
+	line, err := cn.r.ReadString('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "redis: failed to read reply")
+	}
+	if len(line) < 3 {
+		return nil, errors.Errorf("redis: malformed reply %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, replyError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "redis: malformed bulk length")
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(cn.r, buf); err != nil {
+			return nil, errors.Wrap(err, "redis: failed to read bulk reply")
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "redis: malformed array length")
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = cn.read(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, errors.Errorf("redis: unknown reply type %q", line[0])
+}
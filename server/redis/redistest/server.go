@@ -0,0 +1,505 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redistest provides an in-memory server that speaks the Redis
+// protocol, for testing packages that use the redis client. It supports the
+// commands used by the server and emulates Lua scripts with Go functions.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/palantir/policy-bot/server/redis"
+)
+
+// Call runs a command on the server, like redis.call in a Lua script.
+type Call func(args ...string) interface{}
+
+// Script emulates a Lua script. It runs atomically, like a real script.
+type Script func(call Call, keys, args []string) interface{}
+
+type status string
+
+type replyError string
+
+// Server is an in-memory Redis server. It is safe for concurrent use.
+type Server struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	scripts map[string]Script
+	calls   map[string]int
+	values  map[string]string
+	hashes  map[string]map[string]string
+	zsets   map[string]map[string]float64
+	expires map[string]time.Time
+}
+
+// NewServer starts a server listening on a random local port.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		ln:      ln,
+		scripts: make(map[string]Script),
+		calls:   make(map[string]int),
+		values:  make(map[string]string),
+		hashes:  make(map[string]map[string]string),
+		zsets:   make(map[string]map[string]float64),
+		expires: make(map[string]time.Time),
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Client returns a client connected to the server.
+func (s *Server) Client() *redis.Client {
+	return redis.NewClient(redis.Config{Address: s.ln.Addr().String()})
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.ln.Close()
+}
+
+// AddScript registers fn to run when a client evaluates script.
+func (s *Server) AddScript(script string, fn Script) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scripts[script] = fn
+}
+
+// Calls returns the number of times a command was called, including calls
+// made by scripts.
+func (s *Server) Calls(cmd string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[strings.ToUpper(cmd)]
+}
+
+// Do runs a command directly, as if it was sent by a client.
+func (s *Server) Do(args ...string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.exec(args)
+}
+
+func (s *Server) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(nc)
+	}
+}
+
+func (s *Server) handle(nc net.Conn) {
+	defer nc.Close()
+
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		writeReply(w, s.Do(args...))
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs a command. The caller must hold s.mu.
+func (s *Server) exec(args []string) interface{} {
+	if len(args) == 0 {
+		return replyError("ERR empty command")
+	}
+
+	cmd := strings.ToUpper(args[0])
+	s.calls[cmd]++
+	for _, key := range keys(cmd, args[1:]) {
+		s.expire(key)
+	}
+
+	switch cmd {
+	case "PING", "AUTH", "SELECT":
+		return status("OK")
+
+	case "GET":
+		if v, ok := s.values[args[1]]; ok {
+			return v
+		}
+		return nil
+
+	case "SET":
+		return s.set(args[1], args[2], args[3:])
+
+	case "DEL":
+		n := int64(0)
+		for _, key := range args[1:] {
+			if s.delete(key) {
+				n++
+			}
+		}
+		return n
+
+	case "PEXPIRE":
+		if !s.exists(args[1]) {
+			return int64(0)
+		}
+		ms, _ := strconv.ParseInt(args[2], 10, 64)
+		s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return int64(1)
+
+	case "HSET":
+		h := s.hash(args[1])
+		n := int64(0)
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				n++
+			}
+			h[args[i]] = args[i+1]
+		}
+		return n
+
+	case "HGET":
+		if v, ok := s.hashes[args[1]][args[2]]; ok {
+			return v
+		}
+		return nil
+
+	case "HMGET":
+		values := make([]interface{}, 0, len(args)-2)
+		for _, field := range args[2:] {
+			if v, ok := s.hashes[args[1]][field]; ok {
+				values = append(values, v)
+			} else {
+				values = append(values, nil)
+			}
+		}
+		return values
+
+	case "HDEL":
+		n := int64(0)
+		for _, field := range args[2:] {
+			if _, ok := s.hashes[args[1]][field]; ok {
+				delete(s.hashes[args[1]], field)
+				n++
+			}
+		}
+		return n
+
+	case "HLEN":
+		return int64(len(s.hashes[args[1]]))
+
+	case "HVALS":
+		fields := make([]string, 0, len(s.hashes[args[1]]))
+		for f := range s.hashes[args[1]] {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+
+		values := make([]interface{}, 0, len(fields))
+		for _, f := range fields {
+			values = append(values, s.hashes[args[1]][f])
+		}
+		return values
+
+	case "ZADD":
+		z := s.zset(args[1])
+		n := int64(0)
+		for i := 2; i+1 < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return replyError("ERR value is not a valid float")
+			}
+			if _, ok := z[args[i+1]]; !ok {
+				n++
+			}
+			z[args[i+1]] = score
+		}
+		return n
+
+	case "ZCARD":
+		return int64(len(s.zsets[args[1]]))
+
+	case "ZRANGE":
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		return s.zrange(args[1], start, stop)
+
+	case "ZRANGEBYLEX":
+		return s.zrangeByLex(args[1], args[2], args[3], args[4:])
+
+	case "ZREM":
+		n := int64(0)
+		for _, member := range args[2:] {
+			if _, ok := s.zsets[args[1]][member]; ok {
+				delete(s.zsets[args[1]], member)
+				n++
+			}
+		}
+		return n
+
+	case "EVAL":
+		fn, ok := s.scripts[args[1]]
+		if !ok {
+			return replyError("NOSCRIPT unknown script")
+		}
+		numKeys, _ := strconv.Atoi(args[2])
+		return fn(func(args ...string) interface{} { return s.exec(args) }, args[3:3+numKeys], args[3+numKeys:])
+	}
+	return replyError(fmt.Sprintf("ERR unknown command '%s'", cmd))
+}
+
+// keys returns the keys of a command, so expired keys can be deleted before
+// the command runs.
+func keys(cmd string, args []string) []string {
+	switch {
+	case len(args) == 0:
+		return nil
+	case cmd == "DEL":
+		return args
+	case cmd == "EVAL":
+		return nil
+	}
+	return args[:1]
+}
+
+func (s *Server) set(key, value string, opts []string) interface{} {
+	var nx bool
+	var ttl time.Duration
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToUpper(opts[i]) {
+		case "NX":
+			nx = true
+		case "PX", "EX":
+			n, _ := strconv.ParseInt(opts[i+1], 10, 64)
+			ttl = time.Duration(n) * time.Millisecond
+			if strings.ToUpper(opts[i]) == "EX" {
+				ttl = time.Duration(n) * time.Second
+			}
+			i++
+		}
+	}
+
+	if nx && s.exists(key) {
+		return nil
+	}
+	s.delete(key)
+	s.values[key] = value
+	if ttl > 0 {
+		s.expires[key] = time.Now().Add(ttl)
+	}
+	return status("OK")
+}
+
+func (s *Server) exists(key string) bool {
+	_, isValue := s.values[key]
+	_, isHash := s.hashes[key]
+	_, isZSet := s.zsets[key]
+	return isValue || isHash || isZSet
+}
+
+func (s *Server) delete(key string) bool {
+	existed := s.exists(key)
+	delete(s.values, key)
+	delete(s.hashes, key)
+	delete(s.zsets, key)
+	delete(s.expires, key)
+	return existed
+}
+
+func (s *Server) expire(key string) {
+	if at, ok := s.expires[key]; ok && !time.Now().Before(at) {
+		s.delete(key)
+	}
+}
+
+func (s *Server) hash(key string) map[string]string {
+	if s.hashes[key] == nil {
+		s.hashes[key] = make(map[string]string)
+	}
+	return s.hashes[key]
+}
+
+func (s *Server) zset(key string) map[string]float64 {
+	if s.zsets[key] == nil {
+		s.zsets[key] = make(map[string]float64)
+	}
+	return s.zsets[key]
+}
+
+func (s *Server) zrange(key string, start, stop int) []interface{} {
+	z := s.zsets[key]
+	members := make([]string, 0, len(z))
+	for m := range z {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if z[members[i]] != z[members[j]] {
+			return z[members[i]] < z[members[j]]
+		}
+		return members[i] < members[j]
+	})
+
+	n := len(members)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+
+	values := []interface{}{}
+	for i := start; i <= stop; i++ {
+		values = append(values, members[i])
+	}
+	return values
+}
+
+// zrangeByLex returns the members between min and max, assuming all members
+// have the same score, like Redis does.
+func (s *Server) zrangeByLex(key, min, max string, opts []string) interface{} {
+	offset, count := 0, -1
+	if len(opts) == 3 && strings.ToUpper(opts[0]) == "LIMIT" {
+		offset, _ = strconv.Atoi(opts[1])
+		count, _ = strconv.Atoi(opts[2])
+	}
+
+	members := make([]string, 0, len(s.zsets[key]))
+	for m := range s.zsets[key] {
+		if aboveMin(m, min) && belowMax(m, max) {
+			members = append(members, m)
+		}
+	}
+	sort.Strings(members)
+
+	values := []interface{}{}
+	for i := offset; i < len(members) && (count < 0 || len(values) < count); i++ {
+		values = append(values, members[i])
+	}
+	return values
+}
+
+func aboveMin(member, min string) bool {
+	switch {
+	case min == "-":
+		return true
+	case strings.HasPrefix(min, "["):
+		return member >= min[1:]
+	case strings.HasPrefix(min, "("):
+		return member > min[1:]
+	}
+	return false
+}
+
+func belowMax(member, max string) bool {
+	switch {
+	case max == "+":
+		return true
+	case strings.HasPrefix(max, "["):
+		return member <= max[1:]
+	case strings.HasPrefix(max, "("):
+		return member < max[1:]
+	}
+	return false
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("expected array, got %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("expected bulk string, got %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		fmt.Fprint(w, "$-1\r\n")
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case replyError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		fmt.Fprintf(w, "-ERR unsupported reply type %T\r\n", v)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/server/handler"
+	"github.com/palantir/policy-bot/server/results"
+)
+
+// NoTeam is the team used for the time to approval of rules that no team can
+// approve.
+const NoTeam = "(no team)"
+
+// Report summarizes the policy compliance of an organization over a period.
+type Report struct {
+	Organization string    `json:"organization"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+
+	// Merges is the number of pull requests merged during the period
+	Merges int `json:"merges"`
+
+	// MergesByRule counts the merged pull requests approved by each rule
+	MergesByRule map[string]int `json:"merges_by_rule"`
+
+	// MergedWithoutApproval lists the pull requests that were merged when
+	// their policy status was not successful
+	MergedWithoutApproval []MergedPullRequest `json:"merged_without_approval"`
+
+	// MergedWithUnapprovedRules lists the pull requests that were merged
+	// with a successful policy status while some rules were not approved,
+	// like the unused branches of an "or" policy
+	MergedWithUnapprovedRules []MergedPullRequest `json:"merged_with_unapproved_rules"`
+
+	// Unevaluated is the number of merged pull requests that were not
+	// evaluated since the server started
+	Unevaluated int `json:"unevaluated"`
+
+	// Overrides lists the policy statuses posted by users instead of the app
+	Overrides []Override `json:"overrides"`
+
+	// TimeToApproval is the average time for each team between a rule
+	// waiting for the team and the rule being approved
+	TimeToApproval []TeamApprovalTime `json:"time_to_approval"`
+}
+
+// MergedPullRequest is a merged pull request and its last evaluation.
+type MergedPullRequest struct {
+	Repo     string    `json:"repo"`
+	Number   int       `json:"number"`
+	Title    string    `json:"title"`
+	MergedBy string    `json:"merged_by"`
+	MergedAt time.Time `json:"merged_at"`
+	State    string    `json:"state"`
+
+	// Rules are the rules that were not approved or skipped
+	Rules []string `json:"rules"`
+}
+
+// Override is a policy status posted by a user.
+type Override struct {
+	Repo    string    `json:"repo"`
+	SHA     string    `json:"sha"`
+	Context string    `json:"context"`
+	State   string    `json:"state"`
+	Sender  string    `json:"sender"`
+	Time    time.Time `json:"time"`
+}
+
+// TeamApprovalTime is the average time to approval of a team.
+type TeamApprovalTime struct {
+	Team      string        `json:"team"`
+	Approvals int           `json:"approvals"`
+	Average   time.Duration `json:"average_ns"`
+}
+
+// Collector aggregates compliance data in memory. It implements
+// handler.ComplianceRecorder. Data is lost when the server restarts, so the
+// first report after a restart covers only part of the period.
+type Collector struct {
+	mu    sync.Mutex
+	start time.Time
+	orgs  map[string]*orgStats
+	open  map[string]*openPullRequest
+}
+
+var _ handler.ComplianceRecorder = &Collector{}
+
+type orgStats struct {
+	name     string
+	report   Report
+	approval map[string]*approvalTime
+}
+
+type approvalTime struct {
+	count int
+	total time.Duration
+}
+
+type openPullRequest struct {
+	last    results.PullRequest
+	pending map[string]pendingRule
+}
+
+type pendingRule struct {
+	since time.Time
+	teams []string
+}
+
+// NewCollector returns an empty Collector with a period starting now.
+func NewCollector() *Collector {
+	return &Collector{
+		start: time.Now(),
+		orgs:  make(map[string]*orgStats),
+		open:  make(map[string]*openPullRequest),
+	}
+}
+
+func (c *Collector) org(owner string) *orgStats {
+	key := strings.ToLower(owner)
+	s, ok := c.orgs[key]
+	if !ok {
+		s = &orgStats{
+			name:     owner,
+			report:   Report{MergesByRule: make(map[string]int)},
+			approval: make(map[string]*approvalTime),
+		}
+		c.orgs[key] = s
+	}
+	return s
+}
+
+func (c *Collector) RecordEvaluation(pr results.PullRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := results.Key(pr.Owner, pr.Repo, pr.Number)
+	open, ok := c.open[key]
+	if !ok {
+		open = &openPullRequest{pending: make(map[string]pendingRule)}
+		c.open[key] = open
+	}
+	open.last = pr
+
+	for _, rule := range pr.Rules {
+		switch rule.Status {
+		case common.StatusPending.String():
+			if _, ok := open.pending[rule.Name]; !ok {
+				p := pendingRule{since: pr.EvaluatedAt}
+				if rule.Pending != nil {
+					p.teams = rule.Pending.Teams
+				}
+				open.pending[rule.Name] = p
+			}
+
+		case common.StatusApproved.String():
+			p, ok := open.pending[rule.Name]
+			if !ok {
+				continue
+			}
+			delete(open.pending, rule.Name)
+
+			teams := p.teams
+			if len(teams) == 0 {
+				teams = []string{NoTeam}
+			}
+			stats := c.org(pr.Owner)
+			for _, team := range teams {
+				t, ok := stats.approval[strings.ToLower(team)]
+				if !ok {
+					t = &approvalTime{}
+					stats.approval[strings.ToLower(team)] = t
+				}
+				t.count++
+				t.total += pr.EvaluatedAt.Sub(p.since)
+			}
+
+		default:
+			delete(open.pending, rule.Name)
+		}
+	}
+}
+
+func (c *Collector) RecordClose(pr handler.ClosedPullRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := results.Key(pr.Owner, pr.Repo, pr.Number)
+	open := c.open[key]
+	delete(c.open, key)
+
+	if !pr.Merged {
+		return
+	}
+
+	stats := c.org(pr.Owner)
+	stats.report.Merges++
+	if open == nil {
+		stats.report.Unevaluated++
+		return
+	}
+
+	merged := MergedPullRequest{
+		Repo:     pr.Repo,
+		Number:   pr.Number,
+		Title:    open.last.Title,
+		MergedBy: pr.MergedBy,
+		MergedAt: pr.MergedAt,
+		State:    open.last.State,
+	}
+	for _, rule := range open.last.Rules {
+		switch rule.Status {
+		case common.StatusApproved.String():
+			stats.report.MergesByRule[rule.Name]++
+		case common.StatusSkipped.String():
+		default:
+			merged.Rules = append(merged.Rules, rule.Name)
+		}
+	}
+
+	switch {
+	case open.last.State != "success":
+		stats.report.MergedWithoutApproval = append(stats.report.MergedWithoutApproval, merged)
+	case len(merged.Rules) > 0:
+		stats.report.MergedWithUnapprovedRules = append(stats.report.MergedWithUnapprovedRules, merged)
+	}
+}
+
+func (c *Collector) RecordOverride(o handler.StatusOverride) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.org(o.Owner)
+	stats.report.Overrides = append(stats.report.Overrides, Override{
+		Repo:    o.Repo,
+		SHA:     o.SHA,
+		Context: o.Context,
+		State:   o.State,
+		Sender:  o.Sender,
+		Time:    o.Time,
+	})
+}
+
+// Flush returns the reports for the period ending at end and starts a new
+// period. Organizations without activity are omitted. Pull requests that are
+// still open carry over to the next period.
+func (c *Collector) Flush(end time.Time) []*Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reports := make([]*Report, 0, len(c.orgs))
+	for _, stats := range c.orgs {
+		r := stats.report
+		r.Organization = stats.name
+		r.Start = c.start
+		r.End = end
+		for team, t := range stats.approval {
+			r.TimeToApproval = append(r.TimeToApproval, TeamApprovalTime{
+				Team:      team,
+				Approvals: t.count,
+				Average:   t.total / time.Duration(t.count),
+			})
+		}
+		sort.Slice(r.TimeToApproval, func(i, j int) bool {
+			return r.TimeToApproval[i].Team < r.TimeToApproval[j].Team
+		})
+		reports = append(reports, &r)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Organization < reports[j].Organization
+	})
+
+	c.start = end
+	c.orgs = make(map[string]*orgStats)
+	return reports
+}
@@ -0,0 +1,268 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package report sends scheduled policy compliance reports for each
+// organization, summarizing merges, overrides, and approval times.
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/server/audit"
+	"github.com/palantir/policy-bot/server/digest"
+	"github.com/palantir/policy-bot/server/notify"
+)
+
+const (
+	DefaultWeekday = "monday"
+)
+
+type Config struct {
+	// Enabled collects compliance data and sends reports
+	Enabled bool `yaml:"enabled"`
+
+	// Schedule is when reports are sent. If no weekdays are set, reports are
+	// sent weekly on Monday.
+	Schedule digest.ScheduleConfig `yaml:"schedule"`
+
+	// Organizations limits reports to these organizations. If empty, reports
+	// are sent for all organizations with activity.
+	Organizations []string `yaml:"organizations"`
+
+	// Storage, if set, uploads each report as JSON to object storage.
+	// Reports are also sent to notification endpoints that list the
+	// "report" event.
+	Storage *StorageConfig `yaml:"storage"`
+}
+
+type StorageConfig struct {
+	// Provider is the object storage service: "s3" or "gcs"
+	Provider string `yaml:"provider"`
+
+	Bucket   string `yaml:"bucket"`
+	Region   string `yaml:"region"`
+	Endpoint string `yaml:"endpoint"`
+
+	// AccessKeyID and SecretAccessKey are the credentials used to upload
+	// reports. If unset, the standard AWS environment variables are used.
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+
+	// Prefix is prepended to all object keys
+	Prefix string `yaml:"prefix"`
+}
+
+// Reporter sends scheduled compliance reports.
+type Reporter struct {
+	Config    Config
+	Schedule  *digest.Schedule
+	Collector *Collector
+	Notifier  *notify.Notifier
+	Store     audit.ObjectStore
+	Logger    zerolog.Logger
+}
+
+// New returns a Reporter for the configuration, or nil if reports are not
+// enabled. The notifier may be nil.
+func New(c Config, notifier *notify.Notifier, logger zerolog.Logger) (*Reporter, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	if len(c.Schedule.Weekdays) == 0 {
+		c.Schedule.Weekdays = []string{DefaultWeekday}
+	}
+	schedule, err := digest.ParseSchedule(c.Schedule)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid report schedule")
+	}
+
+	var store audit.ObjectStore
+	if c.Storage != nil {
+		s, err := audit.NewS3Store(audit.ArchiveConfig{
+			Provider:        c.Storage.Provider,
+			Bucket:          c.Storage.Bucket,
+			Region:          c.Storage.Region,
+			Endpoint:        c.Storage.Endpoint,
+			AccessKeyID:     c.Storage.AccessKeyID,
+			SecretAccessKey: c.Storage.SecretAccessKey,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize report storage")
+		}
+		store = s
+	}
+
+	if notifier == nil && store == nil {
+		return nil, errors.New("reports require notification endpoints or storage")
+	}
+
+	return &Reporter{
+		Config:    c,
+		Schedule:  schedule,
+		Collector: NewCollector(),
+		Notifier:  notifier,
+		Store:     store,
+		Logger:    logger,
+	}, nil
+}
+
+// Start sends reports on the schedule until the context is canceled.
+func (r *Reporter) Start(ctx context.Context) {
+	go func() {
+		for {
+			next := r.Schedule.Next(time.Now())
+			r.Logger.Debug().Msgf("Next compliance report at %s", next)
+
+			select {
+			case <-time.After(time.Until(next)):
+			case <-ctx.Done():
+				return
+			}
+
+			if err := r.Send(r.Logger.WithContext(ctx)); err != nil {
+				r.Logger.Error().Err(err).Msg("Failed to send compliance reports")
+			}
+		}
+	}()
+}
+
+// Send ends the current period and delivers the report of each organization.
+// Failures for one organization do not prevent reports for others.
+func (r *Reporter) Send(ctx context.Context) error {
+	sent := 0
+	for _, report := range r.Collector.Flush(time.Now()) {
+		if !r.wants(report.Organization) {
+			continue
+		}
+
+		if r.Store != nil {
+			if err := r.upload(ctx, report); err != nil {
+				r.Logger.Error().Err(err).Msgf("Failed to upload compliance report for %s", report.Organization)
+			}
+		}
+		if r.Notifier != nil {
+			if err := r.notify(ctx, report); err != nil {
+				r.Logger.Error().Err(err).Msgf("Failed to send compliance report for %s", report.Organization)
+			}
+		}
+		sent++
+	}
+
+	r.Logger.Info().Msgf("Sent %d compliance reports", sent)
+	return nil
+}
+
+func (r *Reporter) wants(org string) bool {
+	if len(r.Config.Organizations) == 0 {
+		return true
+	}
+	for _, o := range r.Config.Organizations {
+		if strings.EqualFold(o, org) {
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the object key of a report: the organization and the date the
+// period ended, after the configured prefix.
+func (r *Reporter) Key(report *Report) string {
+	date := report.End.In(r.Schedule.Location).Format("2006-01-02")
+	return r.Config.Storage.Prefix + path.Join(strings.ToLower(report.Organization), date+".json")
+}
+
+func (r *Reporter) upload(ctx context.Context, report *Report) error {
+	body, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal report")
+	}
+	return r.Store.Put(ctx, r.Key(report), "application/json", body)
+}
+
+func (r *Reporter) notify(ctx context.Context, report *Report) error {
+	var text bytes.Buffer
+	if err := textTemplate.Execute(&text, report); err != nil {
+		return errors.Wrap(err, "failed to render report")
+	}
+
+	sent := r.Notifier.Summarize(ctx, notify.Summary{
+		Event:  notify.EventReport,
+		Time:   report.End,
+		Owner:  report.Organization,
+		Title:  fmt.Sprintf("Policy compliance report for %s", report.Organization),
+		Text:   text.String(),
+		Report: report,
+	})
+	zerolog.Ctx(ctx).Debug().Msgf("Sent compliance report for %s to %d endpoints", report.Organization, sent)
+	return nil
+}
+
+var textTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date":   func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+	"join":   strings.Join,
+	"rules":  sortedRules,
+	"minute": func(d time.Duration) time.Duration { return d.Round(time.Minute) },
+}).Parse(`{{.Organization}}: {{date .Start}} to {{date .End}}
+
+{{.Merges}} pull requests merged ({{.Unevaluated}} not evaluated)
+{{range rules .MergesByRule}}
+  {{.Name}}: {{.Count}}{{end}}
+
+Merged without approval: {{len .MergedWithoutApproval}}
+{{- range .MergedWithoutApproval}}
+  {{.Repo}}#{{.Number}} by {{.MergedBy}} ({{.State}}): {{join .Rules ", "}}{{end}}
+
+Merged with unapproved rules: {{len .MergedWithUnapprovedRules}}
+{{- range .MergedWithUnapprovedRules}}
+  {{.Repo}}#{{.Number}} by {{.MergedBy}}: {{join .Rules ", "}}{{end}}
+
+Status overrides: {{len .Overrides}}
+{{- range .Overrides}}
+  {{.Repo}}@{{.SHA}} set to {{.State}} by {{.Sender}}{{end}}
+
+Average time to approval:
+{{- range .TimeToApproval}}
+  {{.Team}}: {{minute .Average}} ({{.Approvals}} approvals){{end}}
+`))
+
+type ruleCount struct {
+	Name  string
+	Count int
+}
+
+func sortedRules(m map[string]int) []ruleCount {
+	counts := make([]ruleCount, 0, len(m))
+	for name, count := range m {
+		counts = append(counts, ruleCount{Name: name, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
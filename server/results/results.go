@@ -0,0 +1,395 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package results stores the latest evaluation of each open pull request so
+// that evaluation state can be queried across pull requests.
+package results
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/server/redis"
+)
+
+const (
+	DefaultMaxSize = 10000
+
+	// redisKey is a hash of pull requests by sort key. redisIndexKey is a
+	// sorted set of the same keys with equal scores, so pull requests are
+	// listed by owner and in pages with ZRANGEBYLEX, and redisEvaluatedKey is
+	// a sorted set of the keys scored by evaluation time, so the least
+	// recently evaluated pull request is found without reading the hash.
+	redisKey          = "policy-bot:results:pull-requests"
+	redisIndexKey     = "policy-bot:results:index"
+	redisEvaluatedKey = "policy-bot:results:evaluated"
+)
+
+type Config struct {
+	// MaxSize is the maximum number of stored pull requests. When the store
+	// is full, the pull request that was evaluated least recently is
+	// discarded.
+	MaxSize int `yaml:"max_size"`
+}
+
+// PullRequest is the latest evaluation of a pull request.
+type PullRequest struct {
+	Owner   string `json:"owner"`
+	Repo    string `json:"repo"`
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	Author  string `json:"author"`
+	HeadSHA string `json:"head_sha"`
+	BaseRef string `json:"base_ref"`
+
+	// CreatedAt is when the pull request was opened
+	CreatedAt time.Time `json:"created_at"`
+
+	// State is the state of the posted status: "success", "pending",
+	// "failure", or "error"
+	State       string    `json:"state"`
+	Description string    `json:"description"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Rule is the result of an approval rule or of the disapproval policy.
+type Rule struct {
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Description string `json:"description,omitempty"`
+
+	// Pending lists the actors who can approve the rule if it is pending
+	Pending *common.Actors `json:"pending,omitempty"`
+
+	// Approvals lists the approval candidates of an approval rule
+	Approvals []Approval `json:"approvals,omitempty"`
+}
+
+// Approval is an approval candidate and whether it counted toward a rule.
+type Approval struct {
+	User    string `json:"user"`
+	Counted bool   `json:"counted"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Key identifies a pull request.
+func Key(owner, repo string, number int) string {
+	return strings.ToLower(fmt.Sprintf("%s/%s#%d", owner, repo, number))
+}
+
+// sortKey identifies a pull request like Key, but pads the number so that
+// sort keys order pull requests by owner, repository, and number.
+func sortKey(owner, repo string, number int) string {
+	return strings.ToLower(fmt.Sprintf("%s/%s#%010d", owner, repo, number))
+}
+
+func (pr PullRequest) sortKey() string {
+	return sortKey(pr.Owner, pr.Repo, pr.Number)
+}
+
+// ownerPrefix returns the prefix of the sort keys of pull requests in the
+// repositories of owner.
+func ownerPrefix(owner string) string {
+	return strings.ToLower(owner) + "/"
+}
+
+// NewRules returns the rules of an evaluation result. Rules are the leaves
+// of the result tree.
+func NewRules(result *common.Result) []Rule {
+	var rules []Rule
+	collectRules(result, &rules)
+	return rules
+}
+
+func collectRules(r *common.Result, rules *[]Rule) {
+	if r == nil {
+		return
+	}
+	if len(r.Children) > 0 {
+		for _, c := range r.Children {
+			collectRules(c, rules)
+		}
+		return
+	}
+
+	rule := Rule{
+		Name:        r.Name,
+		Status:      r.Status.String(),
+		Description: r.Description,
+	}
+	if r.Error != nil {
+		rule.Status = "error"
+	}
+	if r.Status == common.StatusPending && r.Error == nil {
+		rule.Pending = r.Requires
+	}
+	for _, a := range r.Approvals {
+		rule.Approvals = append(rule.Approvals, Approval{User: a.User, Counted: a.Counted, Reason: a.Reason})
+	}
+	*rules = append(*rules, rule)
+}
+
+// ListOptions select a page of stored pull requests.
+type ListOptions struct {
+	// Owner, if set, limits the pull requests to repositories of the owner.
+	Owner string
+
+	// After is the cursor returned with the previous page, if any.
+	After string
+
+	// Limit is the maximum number of pull requests to return. If it is zero,
+	// all remaining pull requests are returned.
+	Limit int
+}
+
+// Store stores the latest evaluation of pull requests.
+type Store interface {
+	// Put stores a pull request, replacing any previous evaluation.
+	Put(ctx context.Context, pr PullRequest) error
+
+	// List returns a page of stored pull requests, ordered by owner,
+	// repository, and number, and the cursor of the next page. The cursor is
+	// empty if there are no more pull requests.
+	List(ctx context.Context, opts ListOptions) ([]PullRequest, string, error)
+
+	// Remove deletes a pull request, if it exists.
+	Remove(ctx context.Context, owner, repo string, number int) error
+}
+
+// New returns a Store for the given configuration. If client is non-nil, pull
+// requests are stored in Redis. Otherwise, they are stored in memory.
+func New(c Config, client *redis.Client) Store {
+	if c.MaxSize <= 0 {
+		c.MaxSize = DefaultMaxSize
+	}
+	if client != nil {
+		return &RedisStore{Client: client, MaxSize: c.MaxSize}
+	}
+	return NewMemoryStore(c.MaxSize)
+}
+
+// MemoryStore is a Store that keeps pull requests in memory.
+type MemoryStore struct {
+	maxSize int
+
+	mu  sync.Mutex
+	prs map[string]PullRequest
+}
+
+func NewMemoryStore(maxSize int) *MemoryStore {
+	return &MemoryStore{
+		maxSize: maxSize,
+		prs:     make(map[string]PullRequest),
+	}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, pr PullRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prs[pr.sortKey()] = pr
+	if len(s.prs) > s.maxSize {
+		delete(s.prs, oldest(s.prs).sortKey())
+	}
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, opts ListOptions) ([]PullRequest, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := ""
+	if opts.Owner != "" {
+		prefix = ownerPrefix(opts.Owner)
+	}
+
+	keys := make([]string, 0, len(s.prs))
+	for k := range s.prs {
+		if strings.HasPrefix(k, prefix) && k > opts.After {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var next string
+	if opts.Limit > 0 && len(keys) > opts.Limit {
+		keys = keys[:opts.Limit]
+		next = keys[len(keys)-1]
+	}
+
+	prs := make([]PullRequest, 0, len(keys))
+	for _, k := range keys {
+		prs = append(prs, s.prs[k])
+	}
+	return prs, next, nil
+}
+
+func (s *MemoryStore) Remove(ctx context.Context, owner, repo string, number int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.prs, sortKey(owner, repo, number))
+	return nil
+}
+
+// RedisStore is a Store that keeps pull requests in Redis, so that all
+// servers sharing the Redis instance see the same evaluations. Listing reads
+// only the requested page of pull requests.
+type RedisStore struct {
+	Client  *redis.Client
+	MaxSize int
+}
+
+func (s *RedisStore) Put(ctx context.Context, pr PullRequest) error {
+	b, err := json.Marshal(pr)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal pull request")
+	}
+
+	key := pr.sortKey()
+	if _, err := s.Client.Do(ctx, "HSET", redisKey, key, b); err != nil {
+		return errors.Wrap(err, "failed to store pull request")
+	}
+	if _, err := s.Client.Do(ctx, "ZADD", redisIndexKey, 0, key); err != nil {
+		return errors.Wrap(err, "failed to index pull request")
+	}
+	if _, err := s.Client.Do(ctx, "ZADD", redisEvaluatedKey, pr.EvaluatedAt.UnixNano()/int64(time.Millisecond), key); err != nil {
+		return errors.Wrap(err, "failed to index pull request")
+	}
+
+	reply, err := s.Client.Do(ctx, "ZCARD", redisEvaluatedKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to count pull requests")
+	}
+	if n, _ := reply.(int64); n > int64(s.MaxSize) {
+		reply, err := s.Client.Do(ctx, "ZRANGE", redisEvaluatedKey, 0, n-int64(s.MaxSize)-1)
+		if err != nil {
+			return errors.Wrap(err, "failed to list oldest pull requests")
+		}
+		return s.remove(ctx, stringValues(reply)...)
+	}
+	return nil
+}
+
+func (s *RedisStore) List(ctx context.Context, opts ListOptions) ([]PullRequest, string, error) {
+	min, max := "-", "+"
+	if opts.Owner != "" {
+		// "0" is the character after "/", so this range contains every key
+		// that starts with the prefix
+		prefix := ownerPrefix(opts.Owner)
+		min, max = "["+prefix, "("+strings.TrimSuffix(prefix, "/")+"0"
+	}
+	if opts.After != "" && (min == "-" || opts.After >= min[1:]) {
+		min = "(" + opts.After
+	}
+
+	args := []interface{}{"ZRANGEBYLEX", redisIndexKey, min, max}
+	if opts.Limit > 0 {
+		// request one extra key to know if there is another page
+		args = append(args, "LIMIT", 0, opts.Limit+1)
+	}
+	reply, err := s.Client.Do(ctx, args...)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to list pull requests")
+	}
+
+	keys := stringValues(reply)
+	var next string
+	if opts.Limit > 0 && len(keys) > opts.Limit {
+		keys = keys[:opts.Limit]
+		next = keys[len(keys)-1]
+	}
+	if len(keys) == 0 {
+		return []PullRequest{}, "", nil
+	}
+
+	args = []interface{}{"HMGET", redisKey}
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	reply, err = s.Client.Do(ctx, args...)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to get pull requests")
+	}
+
+	values, _ := reply.([]interface{})
+	prs := make([]PullRequest, 0, len(values))
+	for _, v := range values {
+		// pull requests removed since listing the index are nil
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var pr PullRequest
+		if err := json.Unmarshal([]byte(str), &pr); err != nil {
+			return nil, "", errors.Wrap(err, "failed to unmarshal pull request")
+		}
+		prs = append(prs, pr)
+	}
+	return prs, next, nil
+}
+
+func (s *RedisStore) Remove(ctx context.Context, owner, repo string, number int) error {
+	return s.remove(ctx, sortKey(owner, repo, number))
+}
+
+func (s *RedisStore) remove(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	for _, cmd := range [][]interface{}{
+		{"HDEL", redisKey},
+		{"ZREM", redisIndexKey},
+		{"ZREM", redisEvaluatedKey},
+	} {
+		for _, k := range keys {
+			cmd = append(cmd, k)
+		}
+		if _, err := s.Client.Do(ctx, cmd...); err != nil {
+			return errors.Wrap(err, "failed to remove pull request")
+		}
+	}
+	return nil
+}
+
+func oldest(prs map[string]PullRequest) PullRequest {
+	var old PullRequest
+	for _, pr := range prs {
+		if old.Owner == "" || pr.EvaluatedAt.Before(old.EvaluatedAt) {
+			old = pr
+		}
+	}
+	return old
+}
+
+func stringValues(reply interface{}) []string {
+	values, _ := reply.([]interface{})
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package results
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/policy-bot/server/redis/redistest"
+)
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2018, 6, 29, 12, 0, 0, 0, time.UTC)
+
+	stores := map[string]func(t *testing.T, maxSize int) (Store, func()){
+		"memory": func(t *testing.T, maxSize int) (Store, func()) {
+			return NewMemoryStore(maxSize), func() {}
+		},
+		"redis": func(t *testing.T, maxSize int) (Store, func()) {
+			srv, err := redistest.NewServer()
+			require.NoError(t, err)
+			return &RedisStore{Client: srv.Client(), MaxSize: maxSize}, func() { srv.Close() }
+		},
+	}
+
+	put := func(t *testing.T, s Store, owner, repo string, number int, evaluatedAt time.Time) {
+		require.NoError(t, s.Put(ctx, PullRequest{
+			Owner:       owner,
+			Repo:        repo,
+			Number:      number,
+			State:       "pending",
+			EvaluatedAt: evaluatedAt,
+		}))
+	}
+
+	keys := func(prs []PullRequest) []string {
+		keys := []string{}
+		for _, pr := range prs {
+			keys = append(keys, Key(pr.Owner, pr.Repo, pr.Number))
+		}
+		return keys
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("listByOwner", func(t *testing.T) {
+				s, done := newStore(t, 10)
+				defer done()
+
+				put(t, s, "palantir", "policy-bot", 10, now)
+				put(t, s, "palantir", "bulldozer", 2, now)
+				put(t, s, "palantir", "policy-bot", 9, now)
+				put(t, s, "Palantir-Labs", "tools", 1, now)
+				put(t, s, "other", "repo", 1, now)
+
+				prs, next, err := s.List(ctx, ListOptions{Owner: "Palantir"})
+				require.NoError(t, err)
+				assert.Empty(t, next)
+				assert.Equal(t, []string{"palantir/bulldozer#2", "palantir/policy-bot#9", "palantir/policy-bot#10"}, keys(prs))
+
+				prs, _, err = s.List(ctx, ListOptions{})
+				require.NoError(t, err)
+				assert.Len(t, prs, 5)
+
+				prs, _, err = s.List(ctx, ListOptions{Owner: "missing"})
+				require.NoError(t, err)
+				assert.Empty(t, prs)
+			})
+
+			t.Run("paginate", func(t *testing.T) {
+				s, done := newStore(t, 10)
+				defer done()
+
+				for i := 1; i <= 5; i++ {
+					put(t, s, "palantir", "policy-bot", i, now)
+				}
+				put(t, s, "other", "repo", 1, now)
+
+				var pages [][]string
+				opts := ListOptions{Owner: "palantir", Limit: 2}
+				for {
+					prs, next, err := s.List(ctx, opts)
+					require.NoError(t, err)
+					pages = append(pages, keys(prs))
+					if next == "" {
+						break
+					}
+					opts.After = next
+				}
+
+				assert.Equal(t, [][]string{
+					{"palantir/policy-bot#1", "palantir/policy-bot#2"},
+					{"palantir/policy-bot#3", "palantir/policy-bot#4"},
+					{"palantir/policy-bot#5"},
+				}, pages)
+			})
+
+			t.Run("evictOldest", func(t *testing.T) {
+				s, done := newStore(t, 2)
+				defer done()
+
+				put(t, s, "palantir", "policy-bot", 1, now.Add(2*time.Minute))
+				put(t, s, "palantir", "policy-bot", 2, now)
+				put(t, s, "palantir", "policy-bot", 3, now.Add(time.Minute))
+
+				prs, _, err := s.List(ctx, ListOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, []string{"palantir/policy-bot#1", "palantir/policy-bot#3"}, keys(prs))
+			})
+
+			t.Run("remove", func(t *testing.T) {
+				s, done := newStore(t, 10)
+				defer done()
+
+				put(t, s, "palantir", "policy-bot", 1, now)
+				put(t, s, "palantir", "policy-bot", 2, now)
+				require.NoError(t, s.Remove(ctx, "Palantir", "Policy-Bot", 1))
+
+				prs, _, err := s.List(ctx, ListOptions{Owner: "palantir"})
+				require.NoError(t, err)
+				assert.Equal(t, []string{"palantir/policy-bot#2"}, keys(prs))
+			})
+		})
+	}
+}
+
+func TestRedisStoreReadsOnlyPage(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := redistest.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	s := &RedisStore{Client: srv.Client(), MaxSize: 10}
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, s.Put(ctx, PullRequest{Owner: "palantir", Repo: "policy-bot", Number: i}))
+	}
+
+	prs, next, err := s.List(ctx, ListOptions{Owner: "palantir", Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, prs, 2)
+	assert.NotEmpty(t, next)
+
+	assert.Equal(t, 0, srv.Calls("HVALS"), "listing must not read the whole hash")
+	assert.Equal(t, 1, srv.Calls("HMGET"))
+}
@@ -0,0 +1,276 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/policy-bot/server/googleauth"
+	"github.com/palantir/policy-bot/server/sigv4"
+)
+
+const (
+	gcpScope = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+type VaultConfig struct {
+	// Address is the URL of the Vault server. The default is the value of
+	// the VAULT_ADDR environment variable.
+	Address string `yaml:"address"`
+
+	// Token authenticates requests. The default is the value of the
+	// VAULT_TOKEN environment variable.
+	Token string `yaml:"token"`
+
+	// TokenFile is the path to a file that contains the token. It is read
+	// before each request, so the token may be renewed by another process.
+	TokenFile string `yaml:"token_file"`
+
+	// Namespace is the Vault Enterprise namespace
+	Namespace string `yaml:"namespace"`
+}
+
+type AWSConfig struct {
+	// Region is the region of the secrets. The default is the value of the
+	// AWS_REGION environment variable. Secrets referenced by ARN always use
+	// the region in the ARN.
+	Region string `yaml:"region"`
+}
+
+type GCPConfig struct {
+	// CredentialsFile is the path to a service account key file. If unset,
+	// the file named by the GOOGLE_APPLICATION_CREDENTIALS environment
+	// variable is used, or if that is unset, the service account of the
+	// Compute Engine metadata server.
+	CredentialsFile string `yaml:"credentials_file"`
+}
+
+func checkResponse(res *http.Response, target string) error {
+	if res.StatusCode >= 300 {
+		return errors.Errorf("%s returned status %d", target, res.StatusCode)
+	}
+	return nil
+}
+
+// vaultBackend reads secrets from Vault. The name of a secret is its API
+// path, like "secret/data/policy-bot" for a KV version 2 engine mounted at
+// "secret". It returns the fields of the secret as a JSON object.
+type vaultBackend struct {
+	config VaultConfig
+	client *http.Client
+}
+
+func (b *vaultBackend) fetch(ctx context.Context, name string) (string, error) {
+	address := b.config.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return "", errors.New("vault address is not configured")
+	}
+
+	token := b.config.Token
+	if b.config.TokenFile != "" {
+		t, err := ioutil.ReadFile(b.config.TokenFile)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read vault token")
+		}
+		token = strings.TrimSpace(string(t))
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(address, "/")+"/v1/"+strings.TrimPrefix(name, "/"), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create vault request")
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if b.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", b.config.Namespace)
+	}
+
+	res, err := b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrap(err, "vault request failed")
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res, "vault"); err != nil {
+		return "", err
+	}
+
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return "", errors.Wrap(err, "failed to parse vault response")
+	}
+
+	// KV version 2 nests the fields under "data" next to "metadata"
+	fields := secret.Data
+	if data, ok := fields["data"]; ok {
+		if _, ok := fields["metadata"]; ok {
+			return string(data), nil
+		}
+	}
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode vault secret")
+	}
+	return string(encoded), nil
+}
+
+// awsBackend reads secrets from AWS Secrets Manager using credentials from
+// the standard environment variables. The name of a secret is its name or
+// ARN.
+type awsBackend struct {
+	config AWSConfig
+	client *http.Client
+}
+
+func (b *awsBackend) fetch(ctx context.Context, name string) (string, error) {
+	region := b.config.Region
+	if parts := strings.Split(name, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return "", errors.New("aws region is not configured")
+	}
+
+	creds := sigv4.EnvCredentials()
+	if !creds.Valid() {
+		return "", errors.New("aws credentials are not configured")
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal request")
+	}
+
+	endpoint := fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", region)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create secrets manager request")
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	signer := sigv4.Signer{Credentials: creds, Region: region, Service: "secretsmanager"}
+	signer.Sign(req, body, time.Now())
+
+	res, err := b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrap(err, "secrets manager request failed")
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res, "secrets manager"); err != nil {
+		return "", err
+	}
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary []byte `json:"SecretBinary"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return "", errors.Wrap(err, "failed to parse secrets manager response")
+	}
+	if secret.SecretString != "" {
+		return secret.SecretString, nil
+	}
+	return string(secret.SecretBinary), nil
+}
+
+// gcpBackend reads secrets from Google Cloud Secret Manager. The name of a
+// secret is its resource name, like "projects/p/secrets/s" for the latest
+// version or "projects/p/secrets/s/versions/3" for a specific version.
+type gcpBackend struct {
+	config GCPConfig
+	client *http.Client
+
+	mu     sync.Mutex
+	tokens *googleauth.TokenSource
+}
+
+func (b *gcpBackend) fetch(ctx context.Context, name string) (string, error) {
+	b.mu.Lock()
+	if b.tokens == nil {
+		tokens, err := googleauth.NewTokenSource(b.client, gcpScope, b.config.CredentialsFile)
+		if err != nil {
+			b.mu.Unlock()
+			return "", err
+		}
+		b.tokens = tokens
+	}
+	tokens := b.tokens
+	b.mu.Unlock()
+
+	token, err := tokens.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://secretmanager.googleapis.com/v1/"+name+":access", nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create secret manager request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrap(err, "secret manager request failed")
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res, "secret manager"); err != nil {
+		return "", err
+	}
+
+	var secret struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return "", errors.Wrap(err, "failed to parse secret manager response")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(secret.Payload.Data)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode secret")
+	}
+	return string(data), nil
+}
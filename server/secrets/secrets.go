@@ -0,0 +1,227 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secrets loads configuration values from secret managers and
+// re-fetches them periodically so that secrets can be rotated without
+// restarting the server.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	SchemeVault = "vault://"
+	SchemeAWS   = "aws-sm://"
+	SchemeGCP   = "gcp-sm://"
+
+	DefaultRefreshInterval = 10 * time.Minute
+	DefaultTimeout         = 10 * time.Second
+)
+
+type Config struct {
+	// RefreshInterval is how often secrets are fetched again. Set a negative
+	// value to disable refreshing.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	// Timeout is the maximum time for each request to a secret manager
+	Timeout time.Duration `yaml:"timeout"`
+
+	Vault VaultConfig `yaml:"vault"`
+	AWS   AWSConfig   `yaml:"aws"`
+	GCP   GCPConfig   `yaml:"gcp"`
+}
+
+// IsReference returns true if a configuration value refers to a secret in a
+// secret manager instead of containing the secret.
+func IsReference(value string) bool {
+	for _, scheme := range []string{SchemeVault, SchemeAWS, SchemeGCP} {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// reference is a parsed secret reference: the scheme, the name of the secret
+// in the secret manager, and optionally a key to read from a JSON secret.
+type reference struct {
+	scheme string
+	name   string
+	key    string
+}
+
+func parseReference(value string) reference {
+	var ref reference
+	for _, scheme := range []string{SchemeVault, SchemeAWS, SchemeGCP} {
+		if strings.HasPrefix(value, scheme) {
+			ref.scheme = scheme
+			value = strings.TrimPrefix(value, scheme)
+			break
+		}
+	}
+	if i := strings.LastIndex(value, "#"); i >= 0 {
+		ref.name, ref.key = value[:i], value[i+1:]
+	} else {
+		ref.name = value
+	}
+	return ref
+}
+
+// backend fetches the raw value of a secret.
+type backend interface {
+	fetch(ctx context.Context, name string) (string, error)
+}
+
+// Manager resolves secret references and keeps them up to date.
+type Manager struct {
+	config   Config
+	logger   zerolog.Logger
+	backends map[string]backend
+
+	mu       sync.Mutex
+	watchers []*watcher
+}
+
+type watcher struct {
+	ref    string
+	value  string
+	update func(string) error
+}
+
+func New(c Config, logger zerolog.Logger) *Manager {
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = DefaultRefreshInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+
+	client := &http.Client{Timeout: c.Timeout}
+	return &Manager{
+		config: c,
+		logger: logger,
+		backends: map[string]backend{
+			SchemeVault: &vaultBackend{config: c.Vault, client: client},
+			SchemeAWS:   &awsBackend{config: c.AWS, client: client},
+			SchemeGCP:   &gcpBackend{config: c.GCP, client: client},
+		},
+	}
+}
+
+// Resolve returns the secret for a configuration value. Values that are not
+// secret references are returned unchanged.
+func (m *Manager) Resolve(ctx context.Context, value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+
+	ref := parseReference(value)
+	if ref.scheme == SchemeVault && ref.key == "" {
+		return "", errors.Errorf("vault secret reference %s must name a field after '#'", value)
+	}
+
+	raw, err := m.backends[ref.scheme].fetch(ctx, ref.name)
+	if err != nil {
+		return "", errors.WithMessage(err, "failed to fetch secret "+value)
+	}
+	if ref.key == "" {
+		return raw, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return "", errors.Wrapf(err, "secret %s is not a JSON object", value)
+	}
+	field, ok := fields[ref.key].(string)
+	if !ok {
+		return "", errors.Errorf("secret %s does not have a string field %q", value, ref.key)
+	}
+	return field, nil
+}
+
+// Watch resolves a configuration value and calls update with the secret. If
+// the value is a secret reference, update is called again whenever the
+// secret changes. If the first call fails, Watch returns the error.
+func (m *Manager) Watch(ctx context.Context, value string, update func(string) error) error {
+	secret, err := m.Resolve(ctx, value)
+	if err != nil {
+		return err
+	}
+	if err := update(secret); err != nil {
+		return err
+	}
+
+	if IsReference(value) {
+		m.mu.Lock()
+		m.watchers = append(m.watchers, &watcher{ref: value, value: secret, update: update})
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+// Start refreshes watched secrets in the background until the context is
+// done.
+func (m *Manager) Start(ctx context.Context) {
+	if m.config.RefreshInterval < 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.Refresh(ctx)
+			}
+		}
+	}()
+}
+
+// Refresh fetches all watched secrets and updates those that changed.
+// Failures are logged and the previous values stay in use.
+func (m *Manager) Refresh(ctx context.Context) {
+	m.mu.Lock()
+	watchers := append([]*watcher(nil), m.watchers...)
+	m.mu.Unlock()
+
+	for _, w := range watchers {
+		secret, err := m.Resolve(ctx, w.ref)
+		if err != nil {
+			m.logger.Error().Err(err).Msgf("Failed to refresh secret %s", w.ref)
+			continue
+		}
+		if secret == w.value {
+			continue
+		}
+		if err := w.update(secret); err != nil {
+			m.logger.Error().Err(err).Msgf("Failed to apply new value of secret %s", w.ref)
+			continue
+		}
+		w.value = secret
+		m.logger.Info().Msgf("Applied new value of secret %s", w.ref)
+	}
+}
@@ -15,36 +15,80 @@
 package server
 
 import (
-	"fmt"
+	"context"
+	"crypto/ed25519"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs"
 	"github.com/bluekeyes/hatpear"
 	"github.com/c2h5oh/datasize"
-	"github.com/die-net/lrucache"
 	"github.com/gregjones/httpcache"
 	"github.com/palantir/go-baseapp/baseapp"
 	"github.com/palantir/go-baseapp/baseapp/datadog"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/palantir/go-githubapp/oauth2"
 	"github.com/pkg/errors"
-	"github.com/rs/zerolog"
 	"goji.io"
 	"goji.io/pat"
 
+	policybotv1 "github.com/palantir/policy-bot/api/policybot/v1"
+	"github.com/palantir/policy-bot/server/allowlist"
+	"github.com/palantir/policy-bot/server/audit"
+	"github.com/palantir/policy-bot/server/deadletter"
+	"github.com/palantir/policy-bot/server/digest"
+	"github.com/palantir/policy-bot/server/errorreport"
+	"github.com/palantir/policy-bot/server/evalcache"
+	"github.com/palantir/policy-bot/server/githubclient"
+	"github.com/palantir/policy-bot/server/graphql"
 	"github.com/palantir/policy-bot/server/handler"
-	"github.com/palantir/policy-bot/version"
+	"github.com/palantir/policy-bot/server/history"
+	"github.com/palantir/policy-bot/server/incomplete"
+	"github.com/palantir/policy-bot/server/lock"
+	"github.com/palantir/policy-bot/server/membership"
+	"github.com/palantir/policy-bot/server/messages"
+	"github.com/palantir/policy-bot/server/notify"
+	"github.com/palantir/policy-bot/server/prometheus"
+	"github.com/palantir/policy-bot/server/publish"
+	"github.com/palantir/policy-bot/server/ratelimit"
+	"github.com/palantir/policy-bot/server/rbac"
+	"github.com/palantir/policy-bot/server/redis"
+	"github.com/palantir/policy-bot/server/report"
+	"github.com/palantir/policy-bot/server/results"
+	"github.com/palantir/policy-bot/server/secrets"
+	"github.com/palantir/policy-bot/server/tracing"
 )
 
 const (
 	DefaultSessionLifetime = 24 * time.Hour
+
+	MinEnterpriseMajorVersion = 2
+	MinEnterpriseMinorVersion = 22
+
+	LogKeyGitHubApp = "github_app"
 )
 
 type Server struct {
 	config *Config
 	base   *baseapp.Server
+	apps   []*app
+
+	deadLetters deadletter.Queue
+	tracker     *deadletter.Tracker
+	spans       *tracing.Exporter
+	archiver    *audit.Archiver
+	notifier    *notify.Notifier
+	publisher   *publish.AsyncSink
+	digests     *digest.Digest
+	reports     *report.Reporter
+	secrets     *secrets.Manager
+	allowlist   *allowlist.Allowlist
+	errors      errorreport.Reporter
+	retrier     *handler.IncompleteRetrier
 }
 
 // New instantiates a new Server.
@@ -79,62 +123,214 @@ func New(c *Config) (*Server, error) {
 		return nil, errors.Wrap(err, "failed to initialize base server")
 	}
 
-	maxSize := int64(50 * datasize.MB)
-	if c.Cache.MaxSize != 0 {
-		maxSize = int64(c.Cache.MaxSize)
+	var spans *tracing.Exporter
+	if c.Tracing.Endpoint != "" {
+		spans = tracing.NewExporter(c.Tracing, logger)
+		tracing.SetTracer(tracing.NewTracer(c.Tracing, spans))
 	}
 
-	userAgent := fmt.Sprintf("%s/%s", c.Options.AppName, version.GetVersion())
-	cc, err := githubapp.NewDefaultCachingClientCreator(
-		c.Github,
-		githubapp.WithClientUserAgent(userAgent),
-		githubapp.WithClientCaching(true, func() httpcache.Cache {
-			return lrucache.New(maxSize, 0)
-		}),
-		githubapp.WithClientMiddleware(
-			githubapp.ClientLogging(zerolog.DebugLevel),
-			githubapp.ClientMetrics(base.Registry()),
-		),
-	)
+	var redisClient *redis.Client
+	if c.Redis != nil && c.Redis.Address != "" {
+		redisClient = redis.NewClient(*c.Redis)
+	}
+
+	locker := lock.New(c.Locking, redisClient)
+	sequencer := lock.NewSequencer(redisClient)
+	incompleteStore := incomplete.New(redisClient)
+	deadLetters := deadletter.New(c.DeadLetters, redisClient)
+	tracker := deadletter.NewTracker()
+
+	auditSink, err := audit.New(c.Audit, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize audit sink")
+	}
+
+	var auditSinks audit.MultiSink
+	if auditSink != nil {
+		auditSinks = append(auditSinks, auditSink)
+	}
+
+	var archiver *audit.Archiver
+	if c.Audit.Archive != nil {
+		archiver, err = audit.NewArchiver(*c.Audit.Archive, logger)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize audit archive")
+		}
+		auditSinks = append(auditSinks, archiver)
+	}
+
+	// published records are not part of the audit log: they include the
+	// chain fields of the audit record, but a failed publish does not affect
+	// the chain
+	publishers, err := publish.New(c.Publish)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to initialize client creator")
+		return nil, errors.Wrap(err, "failed to initialize publishers")
+	}
+	var publisher *publish.AsyncSink
+	var publisherSink audit.Sink
+	if len(publishers) > 0 {
+		publisher = publish.NewAsyncSink(&publish.Sink{Publishers: publishers}, c.Publish.QueueSize)
+		publisherSink = publisher
+	}
+
+	switch len(auditSinks) {
+	case 0:
+		auditSink = nil
+	case 1:
+		auditSink = auditSinks[0]
+	default:
+		auditSink = auditSinks
+	}
+
+	notifier, err := notify.New(c.Notify, notify.NewStateStore(redisClient))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize notifications")
+	}
+
+	secretManager := secrets.New(c.Secrets, logger)
+
+	if auditSink != nil && c.Audit.Chain.Enabled {
+		var key ed25519.PrivateKey
+		if c.Audit.Chain.SigningKey != "" {
+			value, err := secretManager.Resolve(context.Background(), c.Audit.Chain.SigningKey)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to resolve audit signing key")
+			}
+			if key, err = audit.ParseSigningKey(value); err != nil {
+				return nil, err
+			}
+		}
+		if auditSink, err = audit.NewChain(c.Audit.Chain, key, auditSink); err != nil {
+			return nil, errors.Wrap(err, "failed to initialize audit chain")
+		}
+	}
+
+	reporter, err := errorreport.New(c.ErrorReporting, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize error reporting")
 	}
 
-	appClient, err := cc.NewAppClient()
+	groups, err := membership.New(c.Membership)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to initialize Github app client")
+		return nil, errors.Wrap(err, "failed to initialize group providers")
+	}
+
+	// results are only stored for the GraphQL API and the dashboard
+	var resultStore results.Store
+	if c.GraphQL.Enabled || c.Dashboard.Enabled {
+		resultStore = results.New(c.GraphQL.Results, redisClient)
 	}
 
-	basePolicyHandler := handler.Base{
-		ClientCreator: cc,
-		BaseConfig:    &c.Server,
-		Installations: githubapp.NewInstallationsService(appClient),
+	historyStore := history.New(c.History, redisClient)
 
-		PullOpts: &c.Options,
-		ConfigFetcher: &handler.ConfigFetcher{
-			PolicyPath: c.Options.PolicyPath,
+	catalog, err := messages.New(c.Messages)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load messages")
+	}
+
+	reports, err := report.New(c.Reports, notifier, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize compliance reports")
+	}
+
+	shared := sharedResources{
+		base:         base,
+		logger:       logger,
+		locker:       locker,
+		sequencer:    sequencer,
+		audit:        auditSink,
+		publisher:    publisherSink,
+		notifier:     notifier,
+		groups:       groups,
+		secrets:      secretManager,
+		errors:       reporter,
+		results:      resultStore,
+		outcomes:     evalcache.New(c.EvaluationCache, redisClient),
+		pendingRules: notify.NewStateStore(redisClient),
+		responses:    newResponseCache(c.Cache, redisClient, base),
+		metrics: &handler.Metrics{
+			Registry: base.Registry(),
+			Tags:     mergeMetricTags(c.Datadog.MetricTags, c.Prometheus.MetricTags),
 		},
+		incomplete: incompleteStore,
+		history:    historyStore,
+		messages:   catalog,
+		rateLimits: ratelimit.NewTracker(),
+	}
+	if reports != nil {
+		shared.compliance = reports.Collector
 	}
 
-	dispatcher := githubapp.NewDefaultEventDispatcher(c.Github,
-		&handler.PullRequest{Base: basePolicyHandler},
-		&handler.PullRequestReview{Base: basePolicyHandler},
-		&handler.IssueComment{Base: basePolicyHandler},
-		&handler.Status{Base: basePolicyHandler},
-	)
+	apps := make([]*app, 0, 1+len(c.Apps))
+	for _, ac := range append([]AppConfig{{Github: c.Github, GHE: c.GHE, Webhooks: c.Webhooks}}, c.Apps...) {
+		a, err := newApp(c, ac, shared)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, a)
+	}
+	primary := apps[0]
 
-	templates, err := handler.LoadTemplates(&c.Files)
+	var sources []digest.Source
+	for _, a := range apps {
+		sources = append(sources, a.Base.AwaitingApproval)
+	}
+	digests, err := digest.New(c.Digest, logger, redisClient, sources...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize digests")
+	}
+
+	webhooks := &handler.WebhookRouter{}
+	deadLetterHandlers := make(map[string][]githubapp.EventHandler)
+	for _, a := range apps {
+		eventHandlers := deadletter.Wrap(deadLetters, c.DeadLetters, tracker, a.Name, a.eventHandlers...)
+		eventHandlers = errorreport.Wrap(reporter, a.Name, eventHandlers...)
+
+		secrets := append([]string{a.config.Github.App.WebhookSecret}, a.config.Webhooks.AdditionalSecrets...)
+		for _, secret := range secrets {
+			if err := addWebhookRoute(webhooks, secretManager, a.config.Github, secret, eventHandlers); err != nil {
+				return nil, errors.Wrap(err, "failed to load webhook secret")
+			}
+		}
+		deadLetterHandlers[a.Name] = append(a.eventHandlers, &handler.EvaluationHandler{Base: *a.Base})
+	}
+
+	templates, err := handler.LoadTemplates(&c.Files, catalog)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to load templates")
 	}
 
 	mux := base.Mux()
+	if reporter != nil {
+		mux.Use(errorreport.Middleware(reporter))
+	}
 
 	// webhook route
-	mux.Handle(pat.Post(githubapp.DefaultWebhookRoute), dispatcher)
+	var webhookHandler http.Handler = hatpear.Try(webhooks)
+
+	var webhookAllowlist *allowlist.Allowlist
+	if c.WebhookAllowlist.Enabled {
+		var urls []string
+		for _, a := range apps {
+			urls = append(urls, a.config.Github.V3APIURL)
+		}
+		if webhookAllowlist, err = allowlist.New(c.WebhookAllowlist, logger, urls...); err != nil {
+			return nil, errors.WithMessage(err, "failed to initialize webhook allowlist")
+		}
+		if err := webhookAllowlist.Refresh(context.Background()); err != nil {
+			return nil, errors.WithMessage(err, "failed to load webhook allowlist")
+		}
+		webhookHandler = webhookAllowlist.Middleware(webhookHandler)
+	}
+	traceWebhooks := tracing.Middleware(func(r *http.Request) string {
+		return "webhook " + r.Header.Get("X-GitHub-Event")
+	})
+	mux.Handle(pat.Post(githubapp.DefaultWebhookRoute), traceWebhooks(webhookHandler))
 
 	// additional API routes
 	mux.Handle(pat.Get("/api/health"), handler.Health())
+	mux.Handle(pat.Get("/healthz"), handler.Health())
+	mux.Handle(pat.Get("/readyz"), newReadiness(apps, redisClient))
 	mux.Handle(pat.Get(oauth2.DefaultRoute), oauth2.NewHandler(
 		oauth2.GetConfig(c.Github, nil),
 		oauth2.ForceTLS(forceTLS),
@@ -148,32 +344,282 @@ func New(c *Config) (*Server, error) {
 	mux.Handle(pat.Get("/favicon.ico"), http.RedirectHandler("/static/img/favicon.ico", http.StatusFound))
 	mux.Handle(pat.Get("/static/*"), handler.Static("/static/", &c.Files))
 	mux.Handle(pat.Get("/"), hatpear.Try(&handler.Index{
-		Base:         basePolicyHandler,
+		Base:         *primary.Base,
 		GithubConfig: &c.Github,
 		Templates:    templates,
 	}))
 
+	var roles *rbac.Authorizer
+	if c.RBAC.Enabled {
+		roles, err = rbac.New(c.RBAC, c.Admin.Tokens, &handler.RoleMembership{Apps: loginApps(apps)})
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to initialize rbac")
+		}
+	}
+
 	details := goji.SubMux()
 	details.Use(handler.RequireLogin(sessions))
-	details.Handle(pat.Get("/:owner/:repo/:number"), hatpear.Try(&handler.Details{
-		Base:      basePolicyHandler,
+	detailsHandler := &handler.Details{
+		Apps:      loginApps(apps),
+		History:   historyStore,
+		Roles:     roles,
 		Sessions:  sessions,
 		Templates: templates,
-	}))
+	}
+	details.Handle(pat.Get("/:owner/:repo/:number"), hatpear.Try(detailsHandler))
+	details.Handle(pat.Post("/:owner/:repo/:number"), hatpear.Try(detailsHandler))
+	details.Handle(pat.Get("/:owner/:repo/:number/evaluations/:id"), hatpear.Try(hatpear.HandlerFunc(detailsHandler.Evaluation)))
 	mux.Handle(pat.New("/details/*"), details)
 
+	if c.Dashboard.Enabled {
+		dashboard := goji.SubMux()
+		dashboard.Use(handler.RequireLogin(sessions))
+		dashboard.Handle(pat.Get("/:owner"), hatpear.Try(&handler.Dashboard{
+			Apps:      loginApps(apps),
+			Results:   resultStore,
+			Sessions:  sessions,
+			Templates: templates,
+		}))
+		mux.Handle(pat.New("/dashboard/*"), dashboard)
+	}
+
+	if c.Playground.Enabled {
+		playground := handler.RequireLogin(sessions)(hatpear.Try(&handler.Playground{
+			Apps:      loginApps(apps),
+			Roles:     roles,
+			Sessions:  sessions,
+			Templates: templates,
+		}))
+		mux.Handle(pat.Get("/playground"), playground)
+		mux.Handle(pat.Post("/playground"), playground)
+	}
+
+	// admin routes are only enabled if tokens or roles are configured
+	if len(c.Admin.Tokens) > 0 || roles != nil {
+		deadLetterHandler := &handler.DeadLetters{
+			Queue:    deadLetters,
+			Handlers: deadLetterHandlers,
+		}
+
+		// without RBAC, every admin token may use every route
+		require := func(rbac.Role) func(http.Handler) http.Handler {
+			return handler.RequireAdminToken(c.Admin.Tokens)
+		}
+		if roles != nil {
+			require = roles.RequireToken
+		}
+		viewer, operator := require(rbac.RoleViewer), require(rbac.RoleOperator)
+
+		// metrics can include the names of private repositories and rules
+		if c.Prometheus.Enabled {
+			mux.Handle(pat.Get(c.Prometheus.Path), viewer(prometheus.Handler(base.Registry(), c.Prometheus.Namespace)))
+		}
+
+		admin := goji.SubMux()
+		admin.Handle(pat.Get("/deadletters"), viewer(hatpear.Try(hatpear.HandlerFunc(deadLetterHandler.List))))
+		admin.Handle(pat.Get("/ratelimits"), viewer(hatpear.Try(&handler.RateLimits{Tracker: shared.rateLimits})))
+		admin.Handle(pat.Post("/deadletters/:id/replay"), operator(hatpear.Try(hatpear.HandlerFunc(deadLetterHandler.Replay))))
+		admin.Handle(pat.Delete("/deadletters/:id"), operator(hatpear.Try(hatpear.HandlerFunc(deadLetterHandler.Delete))))
+
+		adminEvaluate := &handler.AdminEvaluate{}
+		for _, a := range apps {
+			adminEvaluate.Apps = append(adminEvaluate.Apps, a.App)
+		}
+		admin.Handle(pat.Post("/evaluate/:owner/:repo/:number"), operator(hatpear.Try(hatpear.HandlerFunc(adminEvaluate.PullRequest))))
+		admin.Handle(pat.Post("/evaluate/:owner/:repo"), operator(hatpear.Try(hatpear.HandlerFunc(adminEvaluate.Repository))))
+		admin.Handle(pat.Post("/evaluate/:owner"), operator(hatpear.Try(hatpear.HandlerFunc(adminEvaluate.Installation))))
+
+		mux.Handle(pat.New("/api/admin/*"), admin)
+
+		simulate := &handler.SimulateAPI{Apps: adminEvaluate.Apps}
+		mux.Handle(pat.Post("/api/simulate"), require(rbac.RoleSimulator)(hatpear.Try(simulate)))
+
+		if c.GRPC.Enabled {
+			service := policybotv1.NewEvaluationServiceHandlers(&handler.EvaluationService{Apps: adminEvaluate.Apps})
+			mux.Handle(pat.Post(policybotv1.EvaluateMethod), operator(service.Evaluate))
+			mux.Handle(pat.Post(policybotv1.SimulateMethod), require(rbac.RoleSimulator)(service.Simulate))
+			mux.Handle(pat.Post(policybotv1.ValidateMethod), viewer(service.Validate))
+		}
+	}
+
+	if c.GraphQL.Enabled {
+		graphqlHandler := handler.RequireLogin(sessions)(hatpear.Try(&graphql.Handler{
+			Apps:       loginApps(apps),
+			Roles:      roles,
+			Results:    resultStore,
+			Sessions:   sessions,
+			DetailsURL: primary.Base.DetailsURL,
+		}))
+		mux.Handle(pat.Get("/api/graphql"), graphqlHandler)
+		mux.Handle(pat.Post("/api/graphql"), graphqlHandler)
+	}
+
+	retrier := &handler.IncompleteRetrier{
+		Store:  incompleteStore,
+		Logger: logger,
+	}
+	for _, a := range apps {
+		retrier.Apps = append(retrier.Apps, a.App)
+	}
+
 	return &Server{
 		config: c,
 		base:   base,
+		apps:   apps,
+
+		deadLetters: deadLetters,
+		tracker:     tracker,
+		spans:       spans,
+		archiver:    archiver,
+		notifier:    notifier,
+		publisher:   publisher,
+		digests:     digests,
+		reports:     reports,
+		secrets:     secretManager,
+		allowlist:   webhookAllowlist,
+		errors:      reporter,
+		retrier:     retrier,
 	}, nil
 }
 
-// Start is blocking and long-running
+// mergeMetricTags returns the tags in either list without duplicates.
+func mergeMetricTags(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	tags := make([]string, 0, len(a)+len(b))
+	for _, list := range [][]string{a, b} {
+		for _, t := range list {
+			if !seen[t] {
+				seen[t] = true
+				tags = append(tags, t)
+			}
+		}
+	}
+	return tags
+}
+
+// addWebhookRoute adds a route that accepts deliveries signed with a secret.
+// The secret may come from a secret manager, in which case the route is
+// replaced when the secret changes.
+func addWebhookRoute(webhooks *handler.WebhookRouter, secretManager *secrets.Manager, gh githubapp.Config, secret string, eventHandlers []githubapp.EventHandler) error {
+	route := -1
+	return secretManager.Watch(context.Background(), secret, func(secret string) error {
+		if secret == "" {
+			return errors.New("webhook secret must not be empty")
+		}
+		gh.App.WebhookSecret = secret
+		r := handler.WebhookRoute{
+			Secret:  secret,
+			Handler: githubapp.NewDefaultEventDispatcher(gh, eventHandlers...),
+		}
+		if route < 0 {
+			route = webhooks.AddRoute(r)
+		} else {
+			webhooks.SetRoute(route, r)
+		}
+		return nil
+	})
+}
+
+// newResponseCache returns the cache of GitHub API responses shared by all
+// apps. Cached responses do not contain credentials and are validated with
+// the credentials of each request before they are used.
+func newResponseCache(c CachingConfig, redisClient *redis.Client, base *baseapp.Server) httpcache.Cache {
+	maxSize := int64(50 * datasize.MB)
+	if c.MaxSize != 0 {
+		maxSize = int64(c.MaxSize)
+	}
+	if !c.Redis {
+		redisClient = nil
+	}
+	return githubclient.NewResponseCache(maxSize, redisClient, c.TTL, base.Registry())
+}
+
+func newReadiness(apps []*app, redisClient *redis.Client) *handler.Readiness {
+	readiness := &handler.Readiness{}
+	for _, a := range apps {
+		readiness.Checks = append(readiness.Checks, a.readinessChecks()...)
+	}
+
+	if redisClient != nil {
+		readiness.Checks = append(readiness.Checks, handler.ReadinessCheck{
+			Name: "redis",
+			Check: func(ctx context.Context) error {
+				_, err := redisClient.Do(ctx, "PING")
+				return errors.Wrap(err, "failed to reach Redis")
+			},
+		})
+	}
+	return readiness
+}
+
+// Start is blocking and long-running. It returns after the server receives
+// SIGTERM or SIGINT and shuts down.
 func (s *Server) Start() error {
 	if s.config.Datadog.Address != "" {
-		if err := datadog.StartEmitter(s.base, s.config.Datadog); err != nil {
+		if err := datadog.StartEmitter(s.base, s.config.Datadog.Config); err != nil {
 			return err
 		}
 	}
-	return s.base.Start()
+
+	logger := s.base.Logger()
+
+	// scheduled jobs stop when the server shuts down
+	ctx, cancel := context.WithCancel(logger.WithContext(context.Background()))
+	defer cancel()
+
+	if s.spans != nil {
+		s.spans.Start(context.Background())
+	}
+	if s.archiver != nil {
+		s.archiver.Start(context.Background())
+	}
+	if s.digests != nil {
+		s.digests.Start(ctx)
+	}
+	if s.reports != nil {
+		s.reports.Start(context.Background())
+	}
+	s.secrets.Start(context.Background())
+	if s.allowlist != nil {
+		s.allowlist.Start(context.Background())
+	}
+	s.retrier.Start(context.Background())
+
+	for _, a := range s.apps {
+		a.Queue.Start(context.Background())
+		if a.tokens != nil {
+			a.tokens.Start(a.logger.WithContext(context.Background()))
+		}
+
+		if s.config.Reconcile.OnStartup {
+			go func(a *app) {
+				logger := a.logger
+				if err := a.reconciler.ReconcileAll(logger.WithContext(context.Background())); err != nil {
+					logger.Error().Err(err).Msg("Failed to reconcile installations")
+				}
+			}(a)
+		}
+	}
+
+	if err := s.resumeEvaluations(logger.WithContext(context.Background())); err != nil {
+		logger.Error().Err(err).Msg("Failed to resume saved evaluations")
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.base.Start()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		logger.Info().Msgf("Received %s, shutting down", sig)
+		cancel()
+		return s.shutdown()
+	}
 }
@@ -0,0 +1,164 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/policy-bot/server/deadletter"
+	"github.com/palantir/policy-bot/server/handler"
+)
+
+const (
+	DefaultShutdownTimeout = 25 * time.Second
+
+	shutdownReason = "interrupted by server shutdown"
+)
+
+type ShutdownConfig struct {
+	// Timeout is the maximum time to wait for in-flight webhooks and queued
+	// evaluations to finish when the server stops.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// shutdown stops accepting requests, waits for in-flight webhooks and queued
+// evaluations to finish, and saves any unfinished work to the dead letter
+// queue so it can be replayed.
+func (s *Server) shutdown() error {
+	logger := s.base.Logger()
+
+	timeout := s.config.Shutdown.Timeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// stops accepting new connections and waits for webhook handlers to return
+	if err := s.base.HTTPServer().Shutdown(ctx); err != nil {
+		logger.Warn().Err(err).Msg("Not all requests finished before the shutdown deadline")
+	}
+
+	// use a fresh context for saving, as the shutdown context may be done
+	saveCtx := logger.WithContext(context.Background())
+
+	if n, err := s.tracker.Save(saveCtx, s.deadLetters, shutdownReason); err != nil {
+		logger.Error().Err(err).Msg("Failed to save in-flight webhook deliveries")
+	} else if n > 0 {
+		logger.Warn().Msgf("Saved %d in-flight webhook deliveries to the dead letter queue", n)
+	}
+
+	for _, a := range s.apps {
+		for _, e := range a.Queue.Drain(ctx) {
+			if err := saveEvaluation(saveCtx, s.deadLetters, a.Name, e); err != nil {
+				logger.Error().Err(err).Msgf("Failed to save evaluation of %s/%s#%d", e.Locator.Owner, e.Locator.Repo, e.Locator.Number)
+			}
+		}
+	}
+
+	if s.notifier != nil {
+		s.notifier.Wait(ctx)
+	}
+
+	if s.publisher != nil {
+		s.publisher.Wait(ctx)
+	}
+
+	if s.errors != nil {
+		s.errors.Wait(ctx)
+	}
+
+	if s.archiver != nil {
+		if err := s.archiver.Flush(saveCtx); err != nil {
+			logger.Error().Err(err).Msg("Failed to archive audit records")
+		}
+	}
+
+	if s.spans != nil {
+		if err := s.spans.Flush(saveCtx); err != nil {
+			logger.Warn().Err(err).Msg("Failed to export spans")
+		}
+	}
+
+	logger.Info().Msg("Server stopped")
+	return nil
+}
+
+func saveEvaluation(ctx context.Context, q deadletter.Queue, app string, e handler.QueuedEvaluation) error {
+	payload, err := handler.MarshalEvaluation(e)
+	if err != nil {
+		return err
+	}
+
+	zerolog.Ctx(ctx).Warn().Msgf("Saving unfinished evaluation of %s/%s#%d to the dead letter queue", e.Locator.Owner, e.Locator.Repo, e.Locator.Number)
+	return q.Add(ctx, deadletter.Delivery{
+		ID:        xid.New().String(),
+		App:       app,
+		EventType: handler.EvaluationEventType,
+		Payload:   payload,
+		Error:     shutdownReason,
+		Attempts:  1,
+		FailedAt:  time.Now(),
+	})
+}
+
+// resumeEvaluations queues evaluations that were saved when a server stopped
+// and removes them from the dead letter queue.
+func (s *Server) resumeEvaluations(ctx context.Context) error {
+	logger := zerolog.Ctx(ctx)
+
+	deliveries, err := s.deadLetters.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	apps := make(map[string]*app, len(s.apps))
+	for _, a := range s.apps {
+		apps[a.Name] = a
+	}
+
+	resumed := 0
+	for _, d := range deliveries {
+		a, ok := apps[d.App]
+		if d.EventType != handler.EvaluationEventType || !ok {
+			continue
+		}
+
+		e, err := handler.UnmarshalEvaluation(d.Payload)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("Ignoring invalid saved evaluation %s", d.ID)
+			continue
+		}
+
+		if !a.Queue.Enqueue(e.InstallationID, e.Locator) {
+			logger.Warn().Msg("Evaluation queue is full, leaving remaining saved evaluations in the dead letter queue")
+			break
+		}
+		if err := s.deadLetters.Remove(ctx, d.ID); err != nil {
+			return err
+		}
+		resumed++
+	}
+
+	if resumed > 0 {
+		logger.Info().Msgf("Resumed %d saved evaluations", resumed)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Middleware returns HTTP middleware that records a server span for each
+// request. If the request has a traceparent header, the span continues the
+// remote trace.
+func Middleware(name func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := ContextWithRemoteParent(r.Context(), r.Header.Get("traceparent"))
+			ctx, span := Start(ctx, name(r), SpanKindServer)
+			defer span.Finish()
+
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.target", r.URL.Path)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Transport wraps a round tripper to record a client span for each request.
+// It has the same signature as githubapp.ClientMiddleware.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return roundTripper{next: next}
+}
+
+type roundTripper struct {
+	next http.RoundTripper
+}
+
+func (rt roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	name := "GitHub " + r.Method + " " + r.URL.Path
+	if strings.HasSuffix(r.URL.Path, "/graphql") {
+		name = "GitHub GraphQL"
+	}
+
+	ctx, span := Start(r.Context(), name, SpanKindClient)
+	defer span.Finish()
+
+	// round trippers must not modify the request, so the header is set on a
+	// copy
+	if span != nil {
+		r = r.Clone(ctx)
+		r.Header.Set("traceparent", span.TraceParent())
+	}
+	span.SetAttribute("http.method", r.Method)
+	span.SetAttribute("http.url", r.URL.String())
+
+	res, err := rt.next.RoundTrip(r)
+	if err != nil {
+		span.SetError(err)
+		return res, err
+	}
+
+	span.SetAttribute("http.status_code", res.StatusCode)
+	if res.StatusCode >= 400 {
+		span.SetError(httpError(res.Status))
+	}
+	return res, nil
+}
+
+type httpError string
+
+func (e httpError) Error() string { return string(e) }
@@ -0,0 +1,248 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing records spans for webhook handling, pull request evaluation,
+// and GitHub API requests and exports them to an OpenTelemetry collector
+// using the OTLP/HTTP JSON protocol.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultServiceName = "policy-bot"
+)
+
+type Config struct {
+	// Endpoint is the OTLP/HTTP traces endpoint, like
+	// "http://localhost:4318/v1/traces". If empty, tracing is disabled.
+	Endpoint string `yaml:"endpoint"`
+
+	// Headers are added to every export request, for example to authenticate
+	// with a collector.
+	Headers map[string]string `yaml:"headers"`
+
+	// ServiceName is reported as the "service.name" resource attribute
+	ServiceName string `yaml:"service_name"`
+
+	// SampleRatio is the fraction of traces to record, between 0 and 1. If
+	// zero, all traces are recorded.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type contextKey struct{}
+
+var (
+	mu     sync.RWMutex
+	tracer *Tracer
+)
+
+// SetTracer sets the tracer used by Start. Set a nil tracer to disable
+// tracing.
+func SetTracer(t *Tracer) {
+	mu.Lock()
+	defer mu.Unlock()
+	tracer = t
+}
+
+func getTracer() *Tracer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return tracer
+}
+
+// Tracer creates spans and sends finished spans to an exporter.
+type Tracer struct {
+	exporter    *Exporter
+	sampleRatio float64
+}
+
+func NewTracer(c Config, exporter *Exporter) *Tracer {
+	ratio := c.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	return &Tracer{exporter: exporter, sampleRatio: ratio}
+}
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// SpanKind describes the relationship of a span to remote systems.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Span is a timed operation in a trace. All methods are safe to call on a nil
+// span, which is returned when tracing is disabled.
+type Span struct {
+	tracer *Tracer
+
+	TraceID  TraceID
+	SpanID   SpanID
+	ParentID SpanID
+	Sampled  bool
+
+	Name  string
+	Kind  SpanKind
+	Start time.Time
+	End   time.Time
+
+	mu         sync.Mutex
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+// Start creates a span that is a child of the span in ctx, if any, and
+// returns a context containing the new span.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	t := getTracer()
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &Span{
+		tracer:     t,
+		SpanID:     newSpanID(),
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+
+	if parent := FromContext(ctx); parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentID = parent.SpanID
+		s.Sampled = parent.Sampled
+	} else {
+		s.TraceID = newTraceID()
+		s.Sampled = t.sample(s.TraceID)
+	}
+
+	return context.WithValue(ctx, contextKey{}, s), s
+}
+
+// FromContext returns the current span in ctx or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(contextKey{}).(*Span)
+	return s
+}
+
+// SetAttribute records a key-value pair on the span. Values should be strings,
+// booleans, or numbers.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed. A nil error is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// Finish ends the span and queues it for export. Only the first call has an
+// effect.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	if s.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.add(s)
+	}
+}
+
+// TraceParent returns the W3C trace context header value for the span.
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", s.TraceID, s.SpanID, flags)
+}
+
+// ContextWithRemoteParent returns a context with a parent span parsed from a
+// W3C traceparent header value. Spans started from the context continue the
+// remote trace. If the value is invalid, the context is returned unchanged.
+func ContextWithRemoteParent(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return ctx
+	}
+
+	var parent Span
+	if n, err := hex.Decode(parent.TraceID[:], []byte(parts[1])); err != nil || n != len(parent.TraceID) {
+		return ctx
+	}
+	if n, err := hex.Decode(parent.SpanID[:], []byte(parts[2])); err != nil || n != len(parent.SpanID) {
+		return ctx
+	}
+	parent.Sampled = strings.HasSuffix(parts[3], "1")
+	return context.WithValue(ctx, contextKey{}, &parent)
+}
+
+func (t *Tracer) sample(id TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	// use the trace ID as the source of randomness so decisions are stable
+	return float64(binary.BigEndian.Uint64(id[8:])>>11)/float64(1<<53) < t.sampleRatio
+}
+
+func newTraceID() (id TraceID) {
+	_, _ = rand.Read(id[:])
+	return
+}
+
+func newSpanID() (id SpanID) {
+	_, _ = rand.Read(id[:])
+	return
+}